@@ -1,13 +1,12 @@
 package backup
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"os"
-	path "path/filepath"
 	"runtime/debug"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -23,20 +22,14 @@ import (
 	"github.com/spf13/cobra"
 )
 
-// This function handles setup that can be done before parsing flags.
+/*
+ * This function handles setup that can be done before parsing flags.  The
+ * parsed flags are passed to Run, which sets them on flags of its own, but are
+ * read from cmd until then, such as to start the daemon.
+ */
 func DoInit(cmd *cobra.Command) {
-	CleanupGroup = &sync.WaitGroup{}
-	CleanupGroup.Add(1)
 	gplog.InitializeLogging("gpbackup", "")
 	SetCmdFlags(cmd.Flags())
-	_ = cmd.MarkFlagRequired(options.DBNAME)
-	utils.InitializeSignalHandler(DoCleanup, "backup process", &wasTerminated)
-	objectCounts = make(map[string]int)
-}
-
-func DoFlagValidation(cmd *cobra.Command) {
-	validateFlagCombinations(cmd.Flags())
-	validateFlagValues()
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -44,76 +37,90 @@ func DoSetup() {
 	SetLoggerVerbosity()
 	gplog.Verbose("Backup Command: %s", os.Args)
 	gplog.Info("gpbackup version = %s", GetVersion())
+	RecordFlagValues()
 
+	parentCtx := state.runCtx
+	state.runCtx, state.cancelRun = utils.NewTimeoutContext(parentCtx, MustGetFlagInt(options.TIMEOUT))
 	utils.CheckGpexpandRunning(utils.BackupPreventedByGpexpandMessage)
 	timestamp := history.CurrentTimestamp()
 	createBackupLockFile(timestamp)
 	initializeConnectionPool(timestamp)
-	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
+	go cancelQueriesOnTimeout(state.runCtx, parentCtx, MustGetFlagString(options.DBNAME), timestamp)
+	gplog.Info("Greenplum Database Version = %s", state.connectionPool.Version.VersionString)
 
 	gplog.Info("Starting backup of database %s", MustGetFlagString(options.DBNAME))
-	opts, err := options.NewOptions(cmdFlags)
+	opts, err := options.NewOptions(state.cmdFlags)
+	gplog.FatalOnError(err)
+	err = opts.ExpandFilterPatternsFromCatalog(state.connectionPool, state.cmdFlags)
 	gplog.FatalOnError(err)
 
 	validateFilterLists(opts)
+	validateObjectTypeFilters(opts)
+	state.objectTypeSet = toc.NewObjectTypeSet(opts.GetIncludedObjectTypes(), opts.GetExcludedObjectTypes())
+	err = opts.QuoteTablePredicates(state.connectionPool)
+	gplog.FatalOnError(err)
+	state.tablePredicates = opts.GetTablePredicates()
+	err = opts.QuoteColumnMasks(state.connectionPool)
+	gplog.FatalOnError(err)
+	state.columnMasks = opts.GetColumnMasks()
 
-	err = opts.ExpandIncludesForPartitions(connectionPool, cmdFlags)
+	err = opts.ExpandIncludesForPartitions(state.connectionPool, state.cmdFlags)
 	gplog.FatalOnError(err)
 
-	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
-	globalCluster = cluster.NewCluster(segConfig)
-	segPrefix := filepath.GetSegPrefix(connectionPool)
-	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
+	segConfig := cluster.MustGetSegmentConfiguration(state.connectionPool)
+	state.globalCluster = cluster.NewCluster(segConfig)
+	state.globalCluster.Executor = &utils.ContextExecutor{Context: state.runCtx}
+	segPrefix := filepath.GetSegPrefix(state.connectionPool)
+	state.globalFPInfo = filepath.NewFilePathInfo(state.globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
 	if MustGetFlagBool(options.METADATA_ONLY) {
-		_, err = globalCluster.ExecuteLocalCommand(fmt.Sprintf("mkdir -p %s", globalFPInfo.GetDirForContent(-1)))
+		_, err = state.globalCluster.ExecuteLocalCommand(fmt.Sprintf("mkdir -p %s", state.globalFPInfo.GetDirForContent(-1)))
 		gplog.FatalOnError(err)
 	} else {
 		createBackupDirectoriesOnAllHosts()
 	}
-	globalTOC = &toc.TOC{}
-	globalTOC.InitializeMetadataEntryMap()
+	state.globalTOC = &toc.TOC{}
+	state.globalTOC.InitializeMetadataEntryMap()
 	utils.InitializePipeThroughParameters(!MustGetFlagBool(options.NO_COMPRESSION), MustGetFlagInt(options.COMPRESSION_LEVEL))
-	getQuotedRoleNames(connectionPool)
+	getQuotedRoleNames(state.connectionPool)
 
 	pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG)
 
 	if pluginConfigFlag != "" {
-		pluginConfig, err = utils.ReadPluginConfig(pluginConfigFlag)
-		gplog.FatalOnError(err)
-		configFilename := path.Base(pluginConfig.ConfigPath)
-		configDirname := path.Dir(pluginConfig.ConfigPath)
-		pluginConfig.ConfigPath = path.Join(configDirname, timestamp+"_"+configFilename)
-		_ = cmdFlags.Set(options.PLUGIN_CONFIG, pluginConfig.ConfigPath)
-		gplog.Debug("Plugin config path: %s", pluginConfig.ConfigPath)
+		state.pluginConfig = readPluginConfigs(pluginConfigFlag)
+		state.pluginConfig.SetContext(state.runCtx)
+		state.pluginConfig.SetHostConfigPath(timestamp)
+		_ = state.cmdFlags.Set(options.PLUGIN_CONFIG, state.pluginConfig.ConfigPath)
+		gplog.Debug("Plugin config path: %s", state.pluginConfig.ConfigPath)
 	}
 
 	initializeBackupReport(*opts)
 
 	if pluginConfigFlag != "" {
-		backupReport.PluginVersion = pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
-		pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
-		pluginConfig.SetupPluginForBackup(globalCluster, globalFPInfo)
+		state.backupReport.PluginVersion = state.pluginConfig.CheckPluginExistsOnAllHosts(state.globalCluster)
+		state.backupReport.Copies = getBackupCopies()
+		state.pluginConfig.CopyPluginConfigToAllHosts(state.globalCluster)
+		state.pluginConfig.SetupPluginForBackup(state.globalCluster, state.globalFPInfo)
 	}
 }
 
 func DoBackup() {
-	gplog.Info("Backup Timestamp = %s", globalFPInfo.Timestamp)
-	gplog.Info("Backup Database = %s", connectionPool.DBName)
-	gplog.Verbose("Backup Parameters: {%s}", strings.ReplaceAll(backupReport.BackupParamsString, "\n", ", "))
+	gplog.Info("Backup Timestamp = %s", state.globalFPInfo.Timestamp)
+	gplog.Info("Backup Database = %s", state.connectionPool.DBName)
+	gplog.Verbose("Backup Parameters: {%s}", strings.ReplaceAll(state.backupReport.BackupParamsString, "\n", ", "))
 
 	pluginConfigFlag := MustGetFlagString(options.PLUGIN_CONFIG)
 	targetBackupTimestamp := ""
 	var targetBackupFPInfo filepath.FilePathInfo
 	if MustGetFlagBool(options.INCREMENTAL) {
 		targetBackupTimestamp = GetTargetBackupTimestamp()
-		targetBackupFPInfo = filepath.NewFilePathInfo(globalCluster, globalFPInfo.UserSpecifiedBackupDir,
-			targetBackupTimestamp, globalFPInfo.UserSpecifiedSegPrefix)
+		targetBackupFPInfo = filepath.NewFilePathInfo(state.globalCluster, state.globalFPInfo.UserSpecifiedBackupDir,
+			targetBackupTimestamp, state.globalFPInfo.UserSpecifiedSegPrefix)
 
 		if pluginConfigFlag != "" {
 			// These files need to be downloaded from the remote system into the local filesystem
-			pluginConfig.MustRestoreFile(targetBackupFPInfo.GetConfigFilePath())
-			pluginConfig.MustRestoreFile(targetBackupFPInfo.GetTOCFilePath())
-			pluginConfig.MustRestoreFile(targetBackupFPInfo.GetPluginConfigPath())
+			state.pluginConfig.MustRestoreFile(targetBackupFPInfo.GetConfigFilePath())
+			state.pluginConfig.MustRestoreFile(targetBackupFPInfo.GetTOCFilePath())
+			state.pluginConfig.MustRestoreFile(targetBackupFPInfo.GetPluginConfigPath())
 		}
 	}
 
@@ -122,10 +129,14 @@ func DoBackup() {
 	if !(MustGetFlagBool(options.METADATA_ONLY) || MustGetFlagBool(options.DATA_ONLY)) {
 		backupIncrementalMetadata()
 	}
+	validateTablePredicates(dataTables)
+	ValidateColumnMasks(dataTables)
+	ValidateTablesCopiedByQuery(state.connectionPool, dataTables)
 	CheckTablesContainData(dataTables)
-	metadataFilename := globalFPInfo.GetMetadataFilePath()
+	metadataFilename := state.globalFPInfo.GetMetadataFilePath()
 	gplog.Info("Metadata will be written to %s", metadataFilename)
 	metadataFile := utils.NewFileWithByteCountFromFile(metadataFilename)
+	metadataFile.Names = getObjectNames()
 
 	backupSessionGUC(metadataFile)
 	if !MustGetFlagBool(options.DATA_ONLY) {
@@ -137,6 +148,8 @@ func DoBackup() {
 		isFilteredBackup := !isFullBackup
 		backupPredata(metadataFile, metadataTables, isFilteredBackup)
 		backupPostdata(metadataFile)
+		toc.LogExcludedDependencyWarnings(state.globalTOC.GetMetadataObjectTypes(), state.objectTypeSet, nil)
+		recordIdentifierReferences(metadataFile)
 	}
 
 	/*
@@ -144,7 +157,8 @@ func DoBackup() {
 	 * perform a metadata only backup if the database contains no tables
 	 * or only external tables
 	 */
-	if !backupReport.MetadataOnly {
+	plainScriptTables := make([]Table, 0)
+	if !state.backupReport.MetadataOnly {
 		backupSetTables := dataTables
 
 		targetBackupRestorePlan := make([]history.RestorePlanEntry, 0)
@@ -153,30 +167,40 @@ func DoBackup() {
 
 			targetBackupTOC := toc.NewTOC(targetBackupFPInfo.GetTOCFilePath())
 			targetBackupRestorePlan = history.ReadConfigFile(targetBackupFPInfo.GetConfigFilePath()).RestorePlan
-			backupSetTables = FilterTablesForIncremental(targetBackupTOC, globalTOC, dataTables)
+			backupSetTables = FilterTablesForIncremental(targetBackupTOC, state.globalTOC, dataTables)
 		}
 
-		backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
-		backupData(backupSetTables)
+		state.backupReport.RestorePlan = PopulateRestorePlan(backupSetTables, targetBackupRestorePlan, dataTables)
+		if isPlainFormat() {
+			plainScriptTables = backupSetTables
+		} else {
+			backupData(backupSetTables)
+		}
 	}
 	if MustGetFlagBool(options.WITH_STATS) {
 		backupStatistics(metadataTables)
 	}
+	if isPlainFormat() {
+		writePlainScript(metadataFilename, plainScriptTables)
+	}
 
-	globalTOC.WriteToFileAndMakeReadOnly(globalFPInfo.GetTOCFilePath())
-	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
+	state.globalTOC.WriteToFileAndMakeReadOnly(state.globalFPInfo.GetTOCFilePath())
+	for connNum := 0; connNum < state.connectionPool.NumConns; connNum++ {
 		// COMMIT TRANSACTION
-		connectionPool.MustCommit(connNum)
+		state.connectionPool.MustCommit(connNum)
 	}
 	metadataFile.Close()
 	if pluginConfigFlag != "" {
-		pluginConfig.MustBackupFile(metadataFilename)
-		pluginConfig.MustBackupFile(globalFPInfo.GetTOCFilePath())
+		state.pluginConfig.MustBackupFile(metadataFilename)
+		state.pluginConfig.MustBackupFile(state.globalFPInfo.GetTOCFilePath())
+		if isPlainFormat() {
+			state.pluginConfig.MustBackupFile(state.globalFPInfo.GetPlainScriptFilePath())
+		}
 		if MustGetFlagBool(options.WITH_STATS) {
-			pluginConfig.MustBackupFile(globalFPInfo.GetStatisticsFilePath())
+			state.pluginConfig.MustBackupFile(state.globalFPInfo.GetStatisticsFilePath())
 		}
-		_ = utils.CopyFile(pluginConfigFlag, globalFPInfo.GetPluginConfigPath())
-		pluginConfig.MustBackupFile(globalFPInfo.GetPluginConfigPath())
+		_ = utils.CopyFile(pluginConfigFlag, state.globalFPInfo.GetPluginConfigPath())
+		state.pluginConfig.MustBackupFile(state.globalFPInfo.GetPluginConfigPath())
 	}
 }
 
@@ -196,7 +220,7 @@ func backupGlobals(metadataFile *utils.FileWithByteCount) {
 }
 
 func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableOnly bool) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Writing pre-data metadata")
@@ -210,8 +234,12 @@ func backupPredata(metadataFile *utils.FileWithByteCount, tables []Table, tableO
 	if !tableOnly {
 		functions, funcInfoMap = retrieveFunctions(&objects, metadataMap)
 	}
-	objects = append(objects, convertToSortableSlice(tables)...)
-	relationMetadata := GetMetadataForObjectType(connectionPool, TYPE_RELATION)
+	for _, table := range tables {
+		if _, entry := table.GetMetadataEntry(); shouldBackupObjectType(entry.ObjectType) {
+			objects = append(objects, table)
+		}
+	}
+	relationMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_RELATION)
 	addToMetadataMap(relationMetadata, metadataMap)
 
 	if !tableOnly {
@@ -255,35 +283,35 @@ func backupData(tables []Table) {
 
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file backup")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		utils.VerifyHelperVersionOnSegments(version, state.globalCluster)
 		oidList := make([]string, 0, len(tables))
 		for _, table := range tables {
 			if !table.SkipDataBackup() {
 				oidList = append(oidList, fmt.Sprintf("%d", table.Oid))
 			}
 		}
-		utils.WriteOidListToSegments(oidList, globalCluster, globalFPInfo)
-		utils.CreateFirstSegmentPipeOnAllHosts(oidList[0], globalCluster, globalFPInfo)
+		utils.WriteOidListToSegments(oidList, state.globalCluster, state.globalFPInfo)
+		utils.CreateFirstSegmentPipeOnAllHosts(oidList[0], state.globalCluster, state.globalFPInfo)
 		compressStr := fmt.Sprintf(" --compression-level %d", MustGetFlagInt(options.COMPRESSION_LEVEL))
 		if MustGetFlagBool(options.NO_COMPRESSION) {
 			compressStr = " --compression-level 0"
 		}
 		// Do not pass through the --on-error-continue flag because it does not apply to gpbackup
-		utils.StartGpbackupHelpers(globalCluster, globalFPInfo, "--backup-agent",
-			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false, false, &wasTerminated)
+		utils.StartGpbackupHelpers(state.runCtx, state.globalCluster, state.globalFPInfo, "--backup-agent",
+			MustGetFlagString(options.PLUGIN_CONFIG), compressStr, false, false)
 	}
 	gplog.Info("Writing data to file")
 	rowsCopiedMaps := backupDataForAllTables(tables)
 	AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) && MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		pluginConfig.BackupSegmentTOCs(globalCluster, globalFPInfo)
+		state.pluginConfig.BackupSegmentTOCs(state.globalCluster, state.globalFPInfo)
 	}
 
 	logCompletionMessage("Data backup")
 }
 
 func backupPostdata(metadataFile *utils.FileWithByteCount) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Writing post-data metadata")
@@ -291,7 +319,7 @@ func backupPostdata(metadataFile *utils.FileWithByteCount) {
 	backupIndexes(metadataFile)
 	backupRules(metadataFile)
 	backupTriggers(metadataFile)
-	if connectionPool.Version.AtLeast("6") {
+	if state.connectionPool.Version.AtLeast("6") {
 		backupDefaultPrivileges(metadataFile)
 		if len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) == 0 {
 			backupEventTriggers(metadataFile)
@@ -302,51 +330,115 @@ func backupPostdata(metadataFile *utils.FileWithByteCount) {
 }
 
 func backupStatistics(tables []Table) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
-	statisticsFilename := globalFPInfo.GetStatisticsFilePath()
+	statisticsFilename := state.globalFPInfo.GetStatisticsFilePath()
 	gplog.Info("Writing query planner statistics to %s", statisticsFilename)
 	statisticsFile := utils.NewFileWithByteCountFromFile(statisticsFilename)
+	statisticsFile.Names = getObjectNames()
 	defer statisticsFile.Close()
 	backupTableStatistics(statisticsFile, tables)
+	state.globalTOC.RecordIdentifierReferences("statistics", statisticsFile.References())
 
 	logCompletionMessage("Query planner statistics backup")
 }
 
-func DoTeardown() {
-	backupFailed := false
-	defer func() {
-		DoCleanup(backupFailed)
+/*
+ * Restore uses the names found in the printed statements to rewrite schema,
+ * table, and database names when redirecting objects.
+ */
+func getObjectNames() *utils.ObjectNames {
+	quotedDBName := utils.QuoteIdent(state.connectionPool, state.connectionPool.DBName)
+	return utils.NewObjectNames(quotedDBName, GetSchemaQualifiedObjectNames(state.connectionPool))
+}
 
-		errorCode := gplog.GetErrorCode()
-		if errorCode == 0 {
-			gplog.Info("Backup completed successfully")
-		}
-		os.Exit(errorCode)
-	}()
+func recordIdentifierReferences(metadataFile *utils.FileWithByteCount) {
+	references := metadataFile.References()
+	for _, section := range []string{"global", "predata", "postdata"} {
+		state.globalTOC.RecordIdentifierReferences(section, references)
+	}
+}
 
-	errStr := ""
-	if err := recover(); err != nil {
-		// gplog's Fatal will cause a panic with error code 2
-		if gplog.GetErrorCode() != 2 {
-			gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
-			gplog.SetErrorCode(2)
-		} else {
-			errStr = fmt.Sprintf("%v", err)
-		}
-		backupFailed = true
+/*
+ * Returns the message of a panic caused by gplog.Fatal, or logs the stack of
+ * a panic with any other cause and returns an empty string.
+ */
+func getFatalErrorMessage(panicValue interface{}) string {
+	// gplog's Fatal will cause a panic with error code 2
+	if gplog.GetErrorCode() != 2 {
+		gplog.Error(fmt.Sprintf("%v: %s", panicValue, debug.Stack()))
+		gplog.SetErrorCode(2)
+		return ""
+	}
+	errStr := fmt.Sprintf("%v", panicValue)
+	// The error of a query canceled by --timeout does not say why it was canceled
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" && !strings.Contains(errStr, timeoutMsg) {
+		errStr = strings.Replace(errStr, "[CRITICAL]:-", fmt.Sprintf("[CRITICAL]:-%s: ", timeoutMsg), 1)
 	}
-	if wasTerminated {
+	return errStr
+}
+
+// Returns a message saying how long the backup ran for if --timeout expired, or "" otherwise
+func getTimeoutMessage() string {
+	if state.runCtx.Err() != context.DeadlineExceeded {
+		return ""
+	}
+	return fmt.Sprintf("Backup timed out after %d seconds", MustGetFlagInt(options.TIMEOUT))
+}
+
+/*
+ * Catalog queries and lock waits cannot be canceled through a context, so
+ * they are canceled from another session once --timeout expires or the
+ * backup is canceled, which cancels runCtx through its parent context.  The
+ * queries are left alone when runCtx is canceled by the cleanup of a backup
+ * that was not canceled.
+ */
+func cancelQueriesOnTimeout(runCtx context.Context, parentCtx context.Context, dbname string, timestamp string) {
+	<-runCtx.Done()
+	if runCtx.Err() == context.DeadlineExceeded {
+		gplog.Warn("Backup timed out, canceling queries in progress")
+	} else if parentCtx.Err() != nil {
+		gplog.Warn("Backup canceled, canceling queries in progress")
+	} else {
+		return
+	}
+	utils.CancelApplicationQueries(dbname, fmt.Sprintf("gpbackup_%s", timestamp))
+}
+
+// Stops the backup once --timeout expires, rather than continuing on to the next step
+func checkTimeout() {
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" {
+		gplog.Fatal(errors.New(timeoutMsg), "")
+	}
+}
+
+// Returns whether the backup was canceled, so the steps left are skipped, or stops it if --timeout expired
+func wasCanceled() bool {
+	checkTimeout()
+	return state.runCtx.Err() != nil
+}
+
+/*
+ * Writes the history, config, and report files of the backup and cleans up
+ * the plugin, unless the backup was canceled.  Returns whether the backup
+ * failed, which it has if it was canceled.
+ */
+func finishBackup(backupFailed bool, errStr string) bool {
+	if state.wasTerminated {
 		/*
 		 * Don't print an error or create a report file if the backup was canceled,
-		 * as the signal handler will take care of cleanup and return codes.  Just
-		 * wait until the signal handler's DoCleanup completes so the main goroutine
-		 * doesn't exit while cleanup is still in progress.
+		 * as Run returns the context's error instead.  Just wait until the DoCleanup
+		 * started by the cancellation completes so that Run doesn't return while
+		 * cleanup is still in progress.
 		 */
-		CleanupGroup.Wait()
-		backupFailed = true
-		return
+		state.cleanupGroup.Wait()
+		return true
+	}
+	// The report is still written and the plugin cleaned up if --timeout canceled the backup's commands
+	state.globalCluster = utils.ClusterWithoutContext(state.globalCluster)
+	if state.pluginConfig != nil {
+		state.pluginConfig.SetContext(context.Background())
 	}
 	if errStr != "" {
 		fmt.Println(errStr)
@@ -357,51 +449,57 @@ func DoTeardown() {
 	 * Only create a report file if we fail after the cluster is initialized
 	 * and a backup directory exists in which to create the report file.
 	 */
-	if globalFPInfo.Timestamp != "" {
-		_, statErr := os.Stat(globalFPInfo.GetDirForContent(-1))
+	if state.globalFPInfo.Timestamp != "" {
+		_, statErr := os.Stat(state.globalFPInfo.GetDirForContent(-1))
 		if statErr != nil { // Even if this isn't os.IsNotExist, don't try to write a report file in case of further errors
-			return
+			return backupFailed
 		}
-		historyFilename := globalFPInfo.GetBackupHistoryFilePath()
-		reportFilename := globalFPInfo.GetBackupReportFilePath()
-		configFilename := globalFPInfo.GetConfigFilePath()
+		historyFilename := state.globalFPInfo.GetBackupHistoryFilePath()
+		reportFilename := state.globalFPInfo.GetBackupReportFilePath()
+		configFilename := state.globalFPInfo.GetConfigFilePath()
 
 		time.Sleep(time.Second) // We sleep for 1 second to ensure multiple backups do not start within the same second.
 
-		if backupReport != nil {
+		if state.backupReport != nil {
 			if !backupFailed {
-				backupReport.BackupConfig.Status = history.BackupStatusSucceed
+				state.backupReport.BackupConfig.Status = history.BackupStatusSucceed
+			}
+			if len(state.backupReport.Copies) > 0 {
+				recordCopyStatuses()
 			}
-			backupReport.ConstructBackupParamsString()
-			err := history.WriteBackupHistory(historyFilename, &backupReport.BackupConfig)
+			state.backupReport.ConstructBackupParamsString()
+			err := history.WriteBackupHistory(historyFilename, &state.backupReport.BackupConfig)
 			if err != nil {
 				gplog.Error(fmt.Sprintf("%v", err))
 			}
-			history.WriteConfigFile(&backupReport.BackupConfig, configFilename)
-			if backupReport.BackupConfig.EndTime == "" {
-				backupReport.BackupConfig.EndTime = history.CurrentTimestamp()
+			history.WriteConfigFile(&state.backupReport.BackupConfig, configFilename)
+			if state.backupReport.BackupConfig.EndTime == "" {
+				state.backupReport.BackupConfig.EndTime = history.CurrentTimestamp()
 			}
-			endtime, _ := time.ParseInLocation("20060102150405", backupReport.BackupConfig.EndTime, operating.System.Local)
-			backupReport.WriteBackupReportFile(reportFilename, globalFPInfo.Timestamp, endtime, objectCounts, errMsg)
-			report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gpbackup", !backupFailed)
-			if pluginConfig != nil {
-				err = pluginConfig.BackupFile(configFilename)
+			endtime, _ := time.ParseInLocation("20060102150405", state.backupReport.BackupConfig.EndTime, operating.System.Local)
+			if state.pluginConfig != nil {
+				state.backupReport.PluginRetries = state.pluginConfig.NumRetries()
+			}
+			state.backupReport.WriteBackupReportFile(reportFilename, state.globalFPInfo.Timestamp, endtime, state.objectCounts, errMsg)
+			report.EmailReport(state.globalCluster, state.globalFPInfo.Timestamp, reportFilename, "gpbackup", !backupFailed)
+			if state.pluginConfig != nil {
+				err = state.pluginConfig.BackupFile(configFilename)
 				if err != nil {
 					gplog.Error(fmt.Sprintf("%v", err))
-					return
+					return backupFailed
 				}
-				err = pluginConfig.BackupFile(reportFilename)
+				err = state.pluginConfig.BackupFile(reportFilename)
 				if err != nil {
 					gplog.Error(fmt.Sprintf("%v", err))
-					return
+					return backupFailed
 				}
 			}
 		}
-		if pluginConfig != nil {
-			pluginConfig.CleanupPluginForBackup(globalCluster, globalFPInfo)
-			pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+		if state.pluginConfig != nil {
+			state.pluginConfig.CleanupPluginForBackup(state.globalCluster, state.globalFPInfo)
 		}
 	}
+	return backupFailed
 }
 
 func DoCleanup(backupFailed bool) {
@@ -410,30 +508,36 @@ func DoCleanup(backupFailed bool) {
 			gplog.Warn("Encountered error during cleanup: %v", err)
 		}
 		gplog.Verbose("Cleanup complete")
-		CleanupGroup.Done()
+		state.cleanupGroup.Done()
 	}()
 
 	gplog.Verbose("Beginning cleanup")
-	if globalFPInfo.Timestamp != "" {
+	// Cancel the queries and commands in progress before cleaning up after them
+	state.cancelRun()
+	cleanupCluster := utils.ClusterWithoutContext(state.globalCluster)
+	if state.globalFPInfo.Timestamp != "" {
 		if MustGetFlagBool(options.SINGLE_DATA_FILE) {
 			if backupFailed {
 				// Cleanup only if terminated or fataled
-				utils.CleanUpSegmentHelperProcesses(globalCluster, globalFPInfo, "backup")
+				utils.CleanUpSegmentHelperProcesses(cleanupCluster, state.globalFPInfo, "backup")
 			}
-			if wasTerminated {
+			if state.wasTerminated {
 				// It is possible for the COPY command to become orphaned if an agent process is killed
-				utils.TerminateHangingCopySessions(connectionPool, globalFPInfo, "gpbackup")
+				utils.TerminateHangingCopySessions(state.connectionPool, state.globalFPInfo, "gpbackup")
 			}
-			utils.CleanUpHelperFilesOnAllHosts(globalCluster, globalFPInfo)
+			utils.CleanUpHelperFilesOnAllHosts(cleanupCluster, state.globalFPInfo)
 		}
 	}
-	err := backupLockFile.Unlock()
-	if err != nil && backupLockFile != "" {
-		gplog.Warn("Failed to remove lock file %s.", backupLockFile)
+	if state.pluginConfig != nil {
+		state.pluginConfig.DeletePluginConfigOnAllHosts(cleanupCluster)
+	}
+	err := state.backupLockFile.Unlock()
+	if err != nil && state.backupLockFile != "" {
+		gplog.Warn("Failed to remove lock file %s.", state.backupLockFile)
 	}
-	if connectionPool != nil {
-		cancelBlockedQueries(globalFPInfo.Timestamp)
-		connectionPool.Close()
+	if state.connectionPool != nil {
+		cancelBlockedQueries(state.globalFPInfo.Timestamp)
+		state.connectionPool.Close()
 	}
 }
 
@@ -485,7 +589,7 @@ func GetVersion() string {
 }
 
 func logCompletionMessage(msg string) {
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("%s incomplete", msg)
 	} else {
 		gplog.Info("%s complete", msg)
@@ -1,7 +1,18 @@
 package backup
 
 import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -22,4 +33,163 @@ var _ = Describe("backup internal tests", func() {
 			Expect(string(log.Contents())).To(ContainSubstring("Data backup complete"))
 		})
 	})
+	Describe("filterDataTablesByObjectType", func() {
+		table := Table{Relation: Relation{Schema: "public", Name: "foo"}}
+		foreignTable := Table{Relation: Relation{Schema: "public", Name: "bar"}, TableDefinition: TableDefinition{ForeignDef: ForeignTableDefinition{Server: "server"}}}
+		AfterEach(func() {
+			state.objectTypeSet = nil
+		})
+		It("keeps the data of every table without an object type filter", func() {
+			Expect(filterDataTablesByObjectType([]Table{table, foreignTable})).To(Equal([]Table{table, foreignTable}))
+		})
+		It("skips the data of tables whose object type is excluded", func() {
+			state.objectTypeSet = toc.NewObjectTypeSet(nil, []string{"TABLE"})
+			Expect(filterDataTablesByObjectType([]Table{table, foreignTable})).To(Equal([]Table{foreignTable}))
+		})
+		It("skips the data of tables whose object type is not included", func() {
+			state.objectTypeSet = toc.NewObjectTypeSet([]string{"VIEW", "FOREIGN TABLE"}, nil)
+			Expect(filterDataTablesByObjectType([]Table{table, foreignTable})).To(Equal([]Table{foreignTable}))
+		})
+	})
+	Describe("withMetadataState", func() {
+		var backupFlags *pflag.FlagSet
+		backupTOC := &toc.TOC{}
+		BeforeEach(func() {
+			backupFlags = pflag.NewFlagSet("gpbackup", pflag.ContinueOnError)
+			SetCmdFlags(backupFlags)
+			_ = backupFlags.Set(options.INCLUDE_SCHEMA, "foo")
+			state.globalTOC = backupTOC
+			state.tablePredicates = map[string]string{"public.foo": "i > 0"}
+		})
+		AfterEach(func() {
+			state.globalTOC = nil
+			state.tablePredicates = nil
+		})
+		It("generates metadata without the flags and filters of the backup and restores them afterward", func() {
+			withMetadataState(nil, func() {
+				Expect(MustGetFlagStringArray(options.INCLUDE_SCHEMA)).To(BeEmpty())
+				Expect(state.tablePredicates).To(BeNil())
+				state.globalTOC = &toc.TOC{}
+			})
+
+			Expect(state.cmdFlags).To(Equal(backupFlags))
+			Expect(state.globalTOC).To(BeIdenticalTo(backupTOC))
+			Expect(state.tablePredicates).To(Equal(map[string]string{"public.foo": "i > 0"}))
+		})
+		It("restores the state of the backup if generating metadata fails", func() {
+			func() {
+				defer func() { _ = recover() }()
+				withMetadataState(nil, func() {
+					state.globalTOC = &toc.TOC{}
+					panic("query failed")
+				})
+			}()
+
+			Expect(state.cmdFlags).To(Equal(backupFlags))
+			Expect(state.globalTOC).To(BeIdenticalTo(backupTOC))
+		})
+	})
+	Describe("runScheduledBackup", func() {
+		schedule := &Schedule{Retries: 1, RetryDelay: 1}
+		scheduledBackup := ScheduledBackup{Name: "nightly", flagValues: map[string][]string{"dbname": {"testdb"}}}
+		AfterEach(func() {
+			gplog.SetErrorCode(0)
+		})
+		It("retries a failed backup and records the last attempt", func() {
+			// Run fails immediately without a version
+			SetVersion("")
+			backupStatus := &ScheduledBackupStatus{Name: "nightly"}
+			statuses := make([]string, 0)
+
+			runScheduledBackup(context.Background(), schedule, scheduledBackup, backupStatus, func() {
+				statuses = append(statuses, backupStatus.Status)
+			})
+
+			Expect(statuses).To(Equal([]string{DaemonStatusRunning, DaemonStatusRetrying, DaemonStatusRunning}))
+			Expect(backupStatus.Status).To(Equal(history.BackupStatusFailed))
+			Expect(backupStatus.Attempts).To(Equal(2))
+			Expect(backupStatus.Error).To(Equal("The gpbackup version must be set with SetVersion before running a backup"))
+			Expect(backupStatus.LastEndTime).ToNot(BeEmpty())
+			Expect(string(log.Contents())).To(ContainSubstring("Scheduled backup nightly failed, retrying in 1s"))
+		})
+		It("does not retry a backup once the daemon is stopped", func() {
+			SetVersion("")
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			backupStatus := &ScheduledBackupStatus{Name: "nightly"}
+
+			runScheduledBackup(ctx, schedule, scheduledBackup, backupStatus, func() {})
+
+			Expect(backupStatus.Status).To(Equal(history.BackupStatusFailed))
+			Expect(backupStatus.Attempts).To(Equal(1))
+		})
+	})
+	Describe("writeDaemonStatus", func() {
+		It("writes the status of the scheduled backups", func() {
+			statusDir, err := ioutil.TempDir("", "gpbackup_daemon")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(statusDir)
+			statusFile := path.Join(statusDir, "status.yaml")
+			status := &DaemonStatus{Pid: 1234, StartTime: "20240101000000", Backups: []ScheduledBackupStatus{
+				{Name: "nightly", Status: history.BackupStatusSucceed, NextRun: "20240102010000", LastTimestamp: "20240101010000", Attempts: 1},
+			}}
+
+			writeDaemonStatus(statusFile, status)
+			status.Backups[0].Status = DaemonStatusRunning
+			writeDaemonStatus(statusFile, status)
+
+			contents, err := ioutil.ReadFile(statusFile)
+			Expect(err).ToNot(HaveOccurred())
+			writtenStatus := &DaemonStatus{}
+			Expect(yaml.Unmarshal(contents, writtenStatus)).To(Succeed())
+			Expect(writtenStatus).To(Equal(status))
+			_, err = os.Stat(statusFile + ".tmp")
+			Expect(os.IsNotExist(err)).To(BeTrue())
+		})
+	})
+	Describe("runState", func() {
+		It("terminates a backup canceled before it completes", func() {
+			runState := newRunState(context.Background())
+
+			Expect(runState.terminate()).To(BeTrue())
+			Expect(runState.complete()).To(BeTrue())
+			Expect(runState.wasTerminated).To(BeTrue())
+		})
+		It("does not terminate a backup canceled after it completes", func() {
+			runState := newRunState(context.Background())
+
+			Expect(runState.complete()).To(BeFalse())
+			Expect(runState.terminate()).To(BeFalse())
+			Expect(runState.wasTerminated).To(BeFalse())
+		})
+	})
+	Describe("wasCanceled", func() {
+		var runCtx context.Context
+		BeforeEach(func() {
+			runCtx = state.runCtx
+		})
+		AfterEach(func() {
+			state.runCtx = runCtx
+		})
+		It("returns false while the backup is running", func() {
+			state.runCtx = context.Background()
+
+			Expect(wasCanceled()).To(BeFalse())
+		})
+		It("returns true once the backup is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			state.runCtx = ctx
+
+			Expect(wasCanceled()).To(BeTrue())
+		})
+		It("stops the backup once --timeout expires", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			state.runCtx = ctx
+
+			defer testhelper.ShouldPanicWithMessage("timed out after")
+			wasCanceled()
+		})
+	})
 })
@@ -0,0 +1,107 @@
+package backup
+
+/*
+ * This file contains functions for generating the metadata of a database
+ * without backing it up, so that it can be compared with a backup or
+ * migrated to another cluster.
+ */
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/spf13/pflag"
+)
+
+/*
+ * Writes the metadata that a full metadata-only backup of the database that
+ * conn is connected to would contain to metadataFile, and returns the TOC
+ * describing it.  The catalog is read with the same queries a backup uses,
+ * but no backup files are written.  conn must have a single connection, as
+ * tables are locked on every connection, and the transaction the catalog is
+ * read in is rolled back before returning.
+ */
+func GenerateMetadata(conn *dbconn.DBConn, metadataFile *utils.FileWithByteCount, withGlobals bool) *toc.TOC {
+	var metadataTOC *toc.TOC
+	withMetadataState(conn, func() {
+		InitializeMetadataParams(state.connectionPool)
+		state.connectionPool.MustBegin(0)
+		defer state.connectionPool.MustRollback(0)
+		SetSessionGUCs(0)
+
+		generateMetadata(metadataFile, withGlobals)
+		metadataTOC = state.globalTOC
+	})
+	return metadataTOC
+}
+
+/*
+ * Writes the metadata that a full backup of the database that conn is
+ * connected to would contain, including its global metadata, to metadataFile,
+ * and returns the TOC describing it along with a data entry for each table
+ * whose data would be backed up, for migrating the database to another
+ * cluster.  The rows copied for each table are left as 0.
+ *
+ * As in a backup, a transaction is begun and the tables are locked on every
+ * connection of conn, so the data copied out of the tables with
+ * CopyTableOutToProgram on any of them matches the metadata.  The
+ * transactions end when conn is closed.
+ */
+func GenerateMigrationMetadata(conn *dbconn.DBConn, metadataFile *utils.FileWithByteCount, timestamp string) *toc.TOC {
+	var metadataTOC *toc.TOC
+	withMetadataState(conn, func() {
+		InitializeMetadataParams(state.connectionPool)
+		for connNum := 0; connNum < state.connectionPool.NumConns; connNum++ {
+			state.connectionPool.MustExec(fmt.Sprintf("SET application_name TO 'gpbackup_%s'", timestamp), connNum)
+			state.connectionPool.MustBegin(connNum)
+			SetSessionGUCs(connNum)
+		}
+
+		dataTables := generateMetadata(metadataFile, true)
+		AddTableDataEntriesToTOC(dataTables, nil)
+		metadataTOC = state.globalTOC
+	})
+	return metadataTOC
+}
+
+/*
+ * Metadata is generated with the same package state a backup uses, so it is
+ * generated with a new state that is replaced by the saved one afterward.
+ * Every flag is left at its default, as in a backup taken without any
+ * filtering flags, whatever flags were set with SetCmdFlags.
+ */
+func withMetadataState(conn *dbconn.DBConn, generate func()) {
+	savedState := state
+	defer func() {
+		state = savedState
+	}()
+
+	state = newRunState(context.Background())
+	SetCmdFlags(pflag.NewFlagSet("gpbackup", pflag.ContinueOnError))
+	state.connectionPool = conn
+	generate()
+}
+
+// Returns the tables whose data would be backed up
+func generateMetadata(metadataFile *utils.FileWithByteCount, withGlobals bool) []Table {
+	state.objectCounts = make(map[string]int)
+	state.globalTOC = &toc.TOC{}
+	state.globalTOC.InitializeMetadataEntryMap()
+	getQuotedRoleNames(state.connectionPool)
+
+	gplog.Info("Gathering metadata of database %s", state.connectionPool.DBName)
+	metadataTables, dataTables := RetrieveAndProcessTables()
+	metadataFile.Names = getObjectNames()
+	backupSessionGUC(metadataFile)
+	if withGlobals {
+		backupGlobals(metadataFile)
+	}
+	backupPredata(metadataFile, metadataTables, false)
+	backupPostdata(metadataFile)
+	recordIdentifierReferences(metadataFile)
+	return dataTables
+}
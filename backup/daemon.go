@@ -0,0 +1,357 @@
+package backup
+
+/*
+ * This file contains functions for running gpbackup as a daemon that takes
+ * the backups in a schedule file when they are due.
+ */
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// Only one daemon may run on a host, so that scheduled backups never overlap
+	daemonLockFile = "/tmp/gpbackup_daemon.lck"
+
+	DaemonStatusScheduled = "Scheduled"
+	DaemonStatusRunning   = "Running"
+	DaemonStatusRetrying  = "Retrying"
+)
+
+/*
+ * The schedule file lists the backups for the daemon to take, e.g.
+ *
+ *   status-file: /home/gpadmin/gpbackup_daemon_status.yaml
+ *   retries: 2
+ *   retry-delay: 300
+ *   backups:
+ *     - name: sales-weekly-full
+ *       schedule: "0 1 * * 0"
+ *       flags:
+ *         dbname: sales
+ *         backup-dir: /data/backups
+ *         leaf-partition-data: true
+ *     - name: sales-daily-incremental
+ *       schedule: "0 1 * * 1-6"
+ *       flags:
+ *         dbname: sales
+ *         backup-dir: /data/backups
+ *         leaf-partition-data: true
+ *         incremental: true
+ *
+ * Each backup's flags are those it would be passed on the gpbackup command
+ * line, which may include a --config file, and each schedule is in the format
+ * described for utils.CronSchedule.  A failed backup is retried up to the
+ * given number of times, waiting retry-delay seconds before the first retry
+ * and twice as long before each one after.
+ */
+type Schedule struct {
+	StatusFile string `yaml:"status-file"`
+	Retries    int
+	RetryDelay int `yaml:"retry-delay"`
+	Backups    []ScheduledBackup
+}
+
+type ScheduledBackup struct {
+	Name     string
+	Schedule string
+	Flags    map[string]interface{}
+
+	cronSchedule *utils.CronSchedule
+	flagValues   map[string][]string
+}
+
+/*
+ * The status file is rewritten whenever the status of a scheduled backup
+ * changes, with the last attempt at each backup and when it is next due.
+ * Status is one of the DaemonStatus constants or a history.BackupStatus.
+ */
+type DaemonStatus struct {
+	Pid       int
+	StartTime string
+	Backups   []ScheduledBackupStatus
+}
+
+type ScheduledBackupStatus struct {
+	Name          string
+	Status        string
+	NextRun       string
+	LastStartTime string `yaml:",omitempty"`
+	LastEndTime   string `yaml:",omitempty"`
+	LastTimestamp string `yaml:",omitempty"`
+	Attempts      int    `yaml:",omitempty"`
+	Error         string `yaml:",omitempty"`
+}
+
+const defaultRetryDelay = 60
+
+func ReadScheduleFile(filename string) (*Schedule, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	schedule := &Schedule{RetryDelay: defaultRetryDelay}
+	err = yaml.UnmarshalStrict(contents, schedule)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse schedule file %s: %v", filename, err)
+	}
+	err = schedule.validate()
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid schedule file %s", filename)
+	}
+	return schedule, nil
+}
+
+func (schedule *Schedule) validate() error {
+	if len(schedule.Backups) == 0 {
+		return errors.New("No backups are scheduled")
+	}
+	if schedule.Retries < 0 {
+		return errors.New("retries must be 0 or greater")
+	}
+	if schedule.RetryDelay < 1 {
+		return errors.New("retry-delay must be 1 or greater")
+	}
+	names := make(map[string]bool)
+	for i := range schedule.Backups {
+		backup := &schedule.Backups[i]
+		if backup.Name == "" {
+			return errors.Errorf("Backup %d has no name", i+1)
+		}
+		if names[backup.Name] {
+			return errors.Errorf("Backup %s is scheduled more than once", backup.Name)
+		}
+		names[backup.Name] = true
+		var err error
+		backup.cronSchedule, err = utils.ParseCronSchedule(backup.Schedule)
+		if err != nil {
+			return errors.Wrapf(err, "Backup %s", backup.Name)
+		}
+		backup.flagValues, err = options.ParseYAMLFlagValues(backup.Flags)
+		if err != nil {
+			return errors.Wrapf(err, "Backup %s", backup.Name)
+		}
+		err = validateScheduledBackupFlags(backup.flagValues)
+		if err != nil {
+			return errors.Wrapf(err, "Backup %s", backup.Name)
+		}
+	}
+	return nil
+}
+
+/*
+ * Checks the flags that can be checked before the backup runs, so that a
+ * mistake in the schedule file is found when the daemon starts.
+ */
+func validateScheduledBackupFlags(flagValues map[string][]string) error {
+	for _, daemonFlag := range []string{options.DAEMON, options.SCHEDULE} {
+		if _, ok := flagValues[daemonFlag]; ok {
+			return errors.Errorf("Flag --%s may not be set for a scheduled backup", daemonFlag)
+		}
+	}
+	flags := pflag.NewFlagSet("gpbackup", pflag.ContinueOnError)
+	options.SetBackupFlagDefaults(flags)
+	err := options.SetFlagValues(flags, flagValues)
+	if err != nil {
+		return err
+	}
+	if !flags.Changed(options.DBNAME) && !flags.Changed(options.CONFIG) {
+		return errors.Errorf("The --%s flag must be set", options.DBNAME)
+	}
+	return nil
+}
+
+/*
+ * Only the logging flags may be passed along with --daemon and --schedule, as
+ * the flags for each backup are given in the schedule file.
+ */
+func validateDaemonFlags(flags *pflag.FlagSet) {
+	if MustGetFlagString(options.SCHEDULE) == "" {
+		gplog.Fatal(errors.Errorf("--%s must be specified with --%s", options.SCHEDULE, options.DAEMON), "")
+	}
+	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
+	allowedFlags := []string{options.DAEMON, options.SCHEDULE, options.DEBUG, options.QUIET, options.VERBOSE}
+	flags.Visit(func(flag *pflag.Flag) {
+		if !utils.Exists(allowedFlags, flag.Name) {
+			gplog.Fatal(errors.Errorf("--%s may not be specified with --%s; set the flags for each backup in the schedule file instead", flag.Name, options.DAEMON), "")
+		}
+	})
+}
+
+/*
+ * Runs the daemon until the process receives a termination signal, then
+ * exits the process once any backup in progress has been cleaned up.
+ */
+func DoDaemon() {
+	defer func() {
+		if panicValue := recover(); panicValue != nil {
+			if errStr := getFatalErrorMessage(panicValue); errStr != "" {
+				fmt.Println(errStr)
+			}
+		}
+		os.Exit(gplog.GetErrorCode())
+	}()
+	validateDaemonFlags(state.cmdFlags)
+	SetLoggerVerbosity()
+	gplog.Info("gpbackup version = %s", GetVersion())
+	schedule, err := ReadScheduleFile(MustGetFlagString(options.SCHEDULE))
+	gplog.FatalOnError(err)
+	if schedule.StatusFile == "" {
+		schedule.StatusFile = path.Join(path.Dir(gplog.GetLogFilePath()), "gpbackup_daemon_status.yaml")
+	}
+
+	lock := mustLockFile(daemonLockFile, "Another gpbackup daemon is already running")
+	defer func() {
+		_ = lock.Unlock()
+	}()
+
+	ctx, cancel := utils.NewSignalContext(context.Background(), "gpbackup daemon")
+	defer cancel()
+	RunDaemon(ctx, schedule)
+	gplog.SetErrorCode(0)
+	gplog.Info("gpbackup daemon stopped")
+}
+
+/*
+ * Takes each scheduled backup whenever it is due until ctx is canceled.
+ * Backups are taken one at a time, and a backup that becomes due while
+ * another is in progress is taken once that one completes.  A backup that
+ * became due more than once while another was in progress is only taken once.
+ */
+func RunDaemon(ctx context.Context, schedule *Schedule) {
+	status := DaemonStatus{Pid: os.Getpid(), StartTime: history.CurrentTimestamp()}
+	nextRuns := make([]time.Time, len(schedule.Backups))
+	now := operating.System.Now()
+	for i, backup := range schedule.Backups {
+		nextRuns[i] = backup.cronSchedule.Next(now)
+		status.Backups = append(status.Backups, ScheduledBackupStatus{
+			Name:    backup.Name,
+			Status:  DaemonStatusScheduled,
+			NextRun: formatDaemonTime(nextRuns[i]),
+		})
+	}
+	gplog.Info("Starting gpbackup daemon with scheduled backups %s; writing status to %s", schedule.backupNames(), schedule.StatusFile)
+	writeDaemonStatus(schedule.StatusFile, &status)
+
+	for {
+		// Break ties by the order of the backups in the schedule file, e.g. so a full backup precedes an incremental one
+		nextIndex := 0
+		for i := range nextRuns {
+			if nextRuns[i].Before(nextRuns[nextIndex]) {
+				nextIndex = i
+			}
+		}
+		backup := schedule.Backups[nextIndex]
+		gplog.Verbose("Next scheduled backup is %s at %s", backup.Name, nextRuns[nextIndex].Format(time.RFC1123))
+		timer := time.NewTimer(nextRuns[nextIndex].Sub(operating.System.Now()))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		backupStatus := &status.Backups[nextIndex]
+		runScheduledBackup(ctx, schedule, backup, backupStatus, func() {
+			writeDaemonStatus(schedule.StatusFile, &status)
+		})
+		nextRuns[nextIndex] = backup.cronSchedule.Next(operating.System.Now())
+		backupStatus.NextRun = formatDaemonTime(nextRuns[nextIndex])
+		writeDaemonStatus(schedule.StatusFile, &status)
+	}
+}
+
+/*
+ * Takes the backup, retrying it if it fails.  The backup's history entry and
+ * report are written by the backup itself, as they would be by gpbackup.
+ */
+func runScheduledBackup(ctx context.Context, schedule *Schedule, backup ScheduledBackup, backupStatus *ScheduledBackupStatus, statusChanged func()) {
+	retryDelay := time.Duration(schedule.RetryDelay) * time.Second
+	for attempt := 1; ; attempt++ {
+		gplog.Info("Starting scheduled backup %s (attempt %d of %d)", backup.Name, attempt, schedule.Retries+1)
+		backupStatus.Status = DaemonStatusRunning
+		backupStatus.Attempts = attempt
+		backupStatus.LastStartTime = history.CurrentTimestamp()
+		backupStatus.LastEndTime = ""
+		backupStatus.Error = ""
+		statusChanged()
+
+		result, err := Run(ctx, Config{Flags: backup.flagValues})
+		backupStatus.LastEndTime = history.CurrentTimestamp()
+		if err == nil {
+			gplog.Info("Scheduled backup %s completed with timestamp %s", backup.Name, result.Timestamp)
+			backupStatus.Status = history.BackupStatusSucceed
+			backupStatus.LastTimestamp = result.Timestamp
+			return
+		}
+		backupStatus.Status = history.BackupStatusFailed
+		backupStatus.Error = err.Error()
+		if ctx.Err() != nil {
+			gplog.Warn("Scheduled backup %s was canceled", backup.Name)
+			return
+		}
+		if attempt > schedule.Retries {
+			gplog.Error("Scheduled backup %s failed: %v", backup.Name, err)
+			return
+		}
+
+		gplog.Warn("Scheduled backup %s failed, retrying in %s: %v", backup.Name, retryDelay, err)
+		backupStatus.Status = DaemonStatusRetrying
+		statusChanged()
+		timer := time.NewTimer(retryDelay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			backupStatus.Status = history.BackupStatusFailed
+			return
+		case <-timer.C:
+		}
+		retryDelay *= 2
+	}
+}
+
+func (schedule *Schedule) backupNames() string {
+	names := make([]string, len(schedule.Backups))
+	for i, backup := range schedule.Backups {
+		names[i] = backup.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func formatDaemonTime(t time.Time) string {
+	return t.Format("20060102150405")
+}
+
+/*
+ * The status file is replaced rather than rewritten in place, so that it can
+ * be read at any time.  A status file that cannot be written does not stop
+ * the daemon.
+ */
+func writeDaemonStatus(filename string, status *DaemonStatus) {
+	contents, err := yaml.Marshal(status)
+	if err == nil {
+		tempFilename := filename + ".tmp"
+		err = ioutil.WriteFile(tempFilename, contents, 0644)
+		if err == nil {
+			err = os.Rename(tempFilename, filename)
+		}
+	}
+	if err != nil {
+		gplog.Warn("Unable to write daemon status file %s: %v", filename, err)
+	}
+}
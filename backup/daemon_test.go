@@ -0,0 +1,126 @@
+package backup_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/backup"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/daemon tests", func() {
+	Describe("ReadScheduleFile", func() {
+		var scheduleFile string
+		writeScheduleFile := func(contents string) {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_schedule*.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = file.WriteString(contents)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(file.Close()).To(Succeed())
+			scheduleFile = file.Name()
+		}
+		AfterEach(func() {
+			_ = os.Remove(scheduleFile)
+		})
+		It("reads the scheduled backups", func() {
+			writeScheduleFile(`
+status-file: /tmp/status.yaml
+retries: 2
+retry-delay: 300
+backups:
+  - name: weekly-full
+    schedule: "0 1 * * 0"
+    flags:
+      dbname: sales
+      leaf-partition-data: true
+  - name: daily-incremental
+    schedule: "@daily"
+    flags:
+      dbname: sales
+      leaf-partition-data: true
+      incremental: true
+      include-schema:
+        - public
+        - sales
+`)
+
+			schedule, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(schedule.StatusFile).To(Equal("/tmp/status.yaml"))
+			Expect(schedule.Retries).To(Equal(2))
+			Expect(schedule.RetryDelay).To(Equal(300))
+			Expect(schedule.Backups).To(HaveLen(2))
+			Expect(schedule.Backups[0].Name).To(Equal("weekly-full"))
+			Expect(schedule.Backups[1].Schedule).To(Equal("@daily"))
+		})
+		It("defaults to no retries and a retry delay of one minute", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      dbname: sales\n")
+
+			schedule, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(schedule.Retries).To(Equal(0))
+			Expect(schedule.RetryDelay).To(Equal(60))
+		})
+		It("accepts a backup whose database is set in a config file", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      config: /home/gpadmin/nightly.yaml\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).ToNot(HaveOccurred())
+		})
+		It("returns an error if no backups are scheduled", func() {
+			writeScheduleFile("retries: 2\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid schedule file %s: No backups are scheduled", scheduleFile)))
+		})
+		It("returns an error for an unknown field", func() {
+			writeScheduleFile("retry: 2\nbackups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      dbname: sales\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf("Unable to parse schedule file %s", scheduleFile))))
+		})
+		It("returns an error if two backups have the same name", func() {
+			writeScheduleFile(`
+backups:
+  - name: nightly
+    schedule: "@daily"
+    flags:
+      dbname: sales
+  - name: nightly
+    schedule: "@daily"
+    flags:
+      dbname: hr
+`)
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid schedule file %s: Backup nightly is scheduled more than once", scheduleFile)))
+		})
+		It("returns an error for an invalid schedule", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"0 25 * * *\"\n    flags:\n      dbname: sales\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf(`Invalid schedule file %s: Backup nightly: Invalid schedule "0 25 * * *": hour "25" must be between 0 and 23`, scheduleFile)))
+		})
+		It("returns an error for an unknown flag", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      dbname: sales\n      not-a-flag: true\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid schedule file %s: Backup nightly: Unknown flag: --not-a-flag", scheduleFile)))
+		})
+		It("returns an error if a backup does not set the database", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      jobs: 4\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid schedule file %s: Backup nightly: The --dbname flag must be set", scheduleFile)))
+		})
+		It("returns an error if a backup sets --daemon", func() {
+			writeScheduleFile("backups:\n  - name: nightly\n    schedule: \"@daily\"\n    flags:\n      dbname: sales\n      daemon: true\n")
+
+			_, err := backup.ReadScheduleFile(scheduleFile)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid schedule file %s: Backup nightly: Flag --daemon may not be set for a scheduled backup", scheduleFile)))
+		})
+	})
+})
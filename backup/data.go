@@ -5,6 +5,7 @@ package backup
  */
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"sync"
@@ -14,6 +15,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 	"gopkg.in/cheggaaa/pb.v1"
 )
 
@@ -43,9 +45,118 @@ func AddTableDataEntriesToTOC(tables []Table, rowsCopiedMaps []map[uint32]int64)
 				}
 			}
 			attributes := ConstructTableAttributesList(table.ColumnDefs)
-			globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName)
+			maskedColumns := make(map[string]string)
+			for column, mask := range GetColumnMasks(table) {
+				maskedColumns[column] = mask.Method
+			}
+			if len(maskedColumns) == 0 {
+				maskedColumns = nil
+			}
+			state.globalTOC.AddMasterDataEntry(table.Schema, table.Name, table.Oid, attributes, rowsCopied, table.PartitionLevelInfo.RootName, GetTablePredicate(table), maskedColumns)
+		}
+	}
+}
+
+/*
+ * Leaf partitions backed up with --leaf-partition-data use the predicate of
+ * their root partition if they do not have one of their own.
+ */
+func GetTablePredicate(table Table) string {
+	if predicate, ok := state.tablePredicates[table.FQN()]; ok {
+		return predicate
+	}
+	if table.PartitionLevelInfo.RootName != "" {
+		return state.tablePredicates[utils.MakeFQN(table.Schema, table.PartitionLevelInfo.RootName)]
+	}
+	return ""
+}
+
+/*
+ * Returns the masking rules for the columns of a table, keyed by column name.
+ * As with predicates, leaf partitions use the rules of their root partition.
+ */
+func GetColumnMasks(table Table) map[string]options.ColumnMask {
+	masks := make(map[string]options.ColumnMask)
+	if len(state.columnMasks) == 0 {
+		return masks
+	}
+	for _, column := range table.ColumnDefs {
+		if mask, ok := state.columnMasks[utils.MakeFQN(table.FQN(), column.Name)]; ok {
+			masks[column.Name] = mask
+		} else if table.PartitionLevelInfo.RootName != "" {
+			rootFQN := utils.MakeFQN(table.Schema, table.PartitionLevelInfo.RootName)
+			if mask, ok := state.columnMasks[utils.MakeFQN(rootFQN, column.Name)]; ok {
+				masks[column.Name] = mask
+			}
 		}
 	}
+	return masks
+}
+
+/*
+ * Masked values are cast back to the column type so that the data can be
+ * restored into the unchanged table definition.  NULLs are preserved by every
+ * method other than null, which replaces all values.
+ */
+func ConstructMaskedColumnExpression(column ColumnDefinition, mask options.ColumnMask) string {
+	textValue := fmt.Sprintf("%s::text", column.Name)
+	salt := fmt.Sprintf("'%s'", utils.EscapeSingleQuotes(mask.Salt))
+	var expression string
+	switch mask.Method {
+	case options.MASK_NULL:
+		expression = "NULL"
+	case options.MASK_HASH:
+		expression = fmt.Sprintf("md5(%s || %s)", salt, textValue)
+	case options.MASK_FIXED:
+		expression = fmt.Sprintf("CASE WHEN %s IS NULL THEN NULL ELSE '%s' END", column.Name, utils.EscapeSingleQuotes(mask.Value))
+	case options.MASK_FAKE:
+		/*
+		 * Each letter and digit is replaced with a letter or digit derived from
+		 * a hash of the value and its position, so the result keeps the length,
+		 * case, and punctuation of the original value and is deterministic.
+		 * Only the digits of a numeric value are replaced, so that NaN stays a
+		 * valid numeric value.
+		 */
+		charHash := fmt.Sprintf("get_byte(decode(md5(%s || %s || i::text), 'hex'), 0)", salt, textValue)
+		charCases := fmt.Sprintf("WHEN ascii(c) BETWEEN 48 AND 57 THEN chr(48 + %[1]s %% 10)", charHash)
+		if !maskableNumericType.MatchString(column.Type) {
+			charCases += fmt.Sprintf(" WHEN ascii(c) BETWEEN 65 AND 90 THEN chr(65 + %[1]s %% 26) WHEN ascii(c) BETWEEN 97 AND 122 THEN chr(97 + %[1]s %% 26)", charHash)
+		}
+		expression = fmt.Sprintf(`coalesce((SELECT string_agg(CASE %[1]s ELSE c END, '' ORDER BY i) FROM (SELECT i, substr(%[2]s, i, 1) AS c FROM generate_series(1, length(%[2]s)) AS i) AS chars), %[2]s)`, charCases, textValue)
+	}
+	return fmt.Sprintf("(%s)::%s AS %s", expression, column.Type, column.Name)
+}
+
+func ConstructTableSelectList(table Table) string {
+	if len(table.ColumnDefs) == 0 {
+		return "*"
+	}
+	masks := GetColumnMasks(table)
+	columns := make([]string, 0)
+	for _, column := range table.ColumnDefs {
+		if mask, ok := masks[column.Name]; ok {
+			columns = append(columns, ConstructMaskedColumnExpression(column, mask))
+		} else {
+			columns = append(columns, column.Name)
+		}
+	}
+	return strings.Join(columns, ", ")
+}
+
+/*
+ * Tables with a predicate or masked columns are copied out through a query
+ * instead of directly; this returns that query, or "" if it is not needed.
+ */
+func ConstructCopyQuery(table Table) string {
+	predicate := GetTablePredicate(table)
+	if predicate == "" && len(GetColumnMasks(table)) == 0 {
+		return ""
+	}
+	whereClause := ""
+	if predicate != "" {
+		whereClause = fmt.Sprintf(" WHERE %s", predicate)
+	}
+	return fmt.Sprintf("SELECT %s FROM %s%s", ConstructTableSelectList(table), table.FQN(), whereClause)
 }
 
 type BackupProgressCounters struct {
@@ -54,7 +165,7 @@ type BackupProgressCounters struct {
 	ProgressBar    utils.ProgressBar
 }
 
-func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
+func CopyTableOut(ctx context.Context, connectionPool *dbconn.DBConn, table Table, destinationToWrite string, connNum int) (int64, error) {
 	checkPipeExistsCommand := ""
 	customPipeThroughCommand := utils.GetPipeThroughProgram().OutputCommand
 	sendToDestinationCommand := ">"
@@ -68,14 +179,27 @@ func CopyTableOut(connectionPool *dbconn.DBConn, table Table, destinationToWrite
 		checkPipeExistsCommand = fmt.Sprintf("(test -p \"%s\" || (echo \"Pipe not found %s\">&2; exit 1)) && ", destinationToWrite, destinationToWrite)
 		customPipeThroughCommand = "cat -"
 	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+		sendToDestinationCommand = fmt.Sprintf("| %s backup_data %s", state.pluginConfig.ExecutablePath, state.pluginConfig.ConfigPath)
 	}
 
-	copyCommand := fmt.Sprintf("PROGRAM '%s%s %s %s'", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+	program := fmt.Sprintf("%s%s %s %s", checkPipeExistsCommand, customPipeThroughCommand, sendToDestinationCommand, destinationToWrite)
+	return CopyTableOutToProgram(ctx, connectionPool, table, program, connNum)
+}
+
+/*
+ * Copies the data of the table on each segment to the standard input of a
+ * shell command run on that segment, in which <SEGID> and <SEG_DATA_DIR> are
+ * replaced as in a backup file path.  Returns the number of rows copied.
+ */
+func CopyTableOutToProgram(ctx context.Context, connectionPool *dbconn.DBConn, table Table, program string, connNum int) (int64, error) {
+	copyCommand := fmt.Sprintf("PROGRAM '%s'", program)
 
 	query := fmt.Sprintf("COPY %s TO %s WITH CSV DELIMITER '%s' ON SEGMENT IGNORE EXTERNAL PARTITIONS;", table.FQN(), copyCommand, tableDelim)
+	if copyQuery := ConstructCopyQuery(table); copyQuery != "" {
+		query = fmt.Sprintf("COPY (%s) TO %s WITH CSV DELIMITER '%s' ON SEGMENT;", copyQuery, copyCommand, tableDelim)
+	}
 	gplog.Verbose(query)
-	result, err := connectionPool.Exec(query, connNum)
+	result, err := connectionPool.ExecContext(ctx, query, connNum)
 	if err != nil {
 		return 0, err
 	}
@@ -99,13 +223,15 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 
 		destinationToWrite := ""
 		if MustGetFlagBool(options.SINGLE_DATA_FILE) {
-			destinationToWrite = fmt.Sprintf("%s_%d", globalFPInfo.GetSegmentPipePathForCopyCommand(), table.Oid)
+			destinationToWrite = fmt.Sprintf("%s_%d", state.globalFPInfo.GetSegmentPipePathForCopyCommand(), table.Oid)
 		} else {
-			destinationToWrite = globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, utils.GetPipeThroughProgram().Extension, false)
+			destinationToWrite = state.globalFPInfo.GetTableBackupFilePathForCopyCommand(table.Oid, utils.GetPipeThroughProgram().Extension, false)
 		}
-		rowsCopied, err := CopyTableOut(connectionPool, table, destinationToWrite, whichConn)
+		copyCtx, cancelCopy := utils.NewTimeoutContext(state.runCtx, MustGetFlagInt(options.COPY_TIMEOUT))
+		rowsCopied, err := CopyTableOut(copyCtx, state.connectionPool, table, destinationToWrite, whichConn)
+		cancelCopy()
 		if err != nil {
-			return err
+			return getCopyError(copyCtx, table.FQN(), err)
 		}
 		rowsCopiedMap[table.Oid] = rowsCopied
 		counters.ProgressBar.Increment()
@@ -113,6 +239,17 @@ func BackupSingleTableData(table Table, rowsCopiedMap map[uint32]int64, counters
 	return nil
 }
 
+// The error of a COPY canceled by a timeout does not say which timeout expired
+func getCopyError(copyCtx context.Context, tableFQN string, err error) error {
+	if copyCtx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" {
+		return errors.Errorf("%s while backing up data for table %s", timeoutMsg, tableFQN)
+	}
+	return errors.Errorf("Backing up data for table %s took more than the --%s of %d seconds", tableFQN, options.COPY_TIMEOUT, MustGetFlagInt(options.COPY_TIMEOUT))
+}
+
 func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	var numExtOrForeignTables int64
 	for _, table := range tables {
@@ -123,7 +260,12 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	counters := BackupProgressCounters{NumRegTables: 0, TotalRegTables: int64(len(tables)) - numExtOrForeignTables}
 	counters.ProgressBar = utils.NewProgressBar(int(counters.TotalRegTables), "Tables backed up: ", utils.PB_INFO)
 	counters.ProgressBar.Start()
-	rowsCopiedMaps := make([]map[uint32]int64, connectionPool.NumConns)
+	numWorkers := state.connectionPool.NumConns
+	if state.pluginConfig != nil && !MustGetFlagBool(options.SINGLE_DATA_FILE) {
+		// Each table is copied through its own plugin process
+		numWorkers = state.pluginConfig.LimitConcurrency(numWorkers)
+	}
+	rowsCopiedMaps := make([]map[uint32]int64, numWorkers)
 	/*
 	 * We break when an interrupt is received and rely on
 	 * TerminateHangingCopySessions to kill any COPY statements
@@ -132,13 +274,13 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	tasks := make(chan Table, len(tables))
 	var workerPool sync.WaitGroup
 	var copyErr error
-	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
+	for connNum := 0; connNum < numWorkers; connNum++ {
 		rowsCopiedMaps[connNum] = make(map[uint32]int64)
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
 			for table := range tasks {
-				if wasTerminated || copyErr != nil {
+				if state.runCtx.Err() != nil || copyErr != nil {
 					counters.ProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
 				}
@@ -154,10 +296,11 @@ func backupDataForAllTables(tables []Table) []map[uint32]int64 {
 	}
 	close(tasks)
 	workerPool.Wait()
+	checkTimeout()
 
 	var agentErr error
 	if MustGetFlagBool(options.SINGLE_DATA_FILE) {
-		agentErr = utils.CheckAgentErrorsOnSegments(globalCluster, globalFPInfo)
+		agentErr = utils.CheckAgentErrorsOnSegments(state.globalCluster, state.globalFPInfo)
 	}
 
 	if copyErr != nil && agentErr != nil {
@@ -182,13 +325,13 @@ func printDataBackupWarnings(numExtTables int64) {
 }
 
 func CheckTablesContainData(tables []Table) {
-	if !backupReport.MetadataOnly {
+	if !state.backupReport.MetadataOnly {
 		for _, table := range tables {
 			if !table.SkipDataBackup() {
 				return
 			}
 		}
 		gplog.Warn("No tables in backup set contain data. Performing metadata-only backup instead.")
-		backupReport.MetadataOnly = true
+		state.backupReport.MetadataOnly = true
 	}
 }
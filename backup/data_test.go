@@ -1,6 +1,7 @@
 package backup_test
 
 import (
+	"context"
 	"fmt"
 	"regexp"
 
@@ -57,6 +58,22 @@ var _ = Describe("backup/data tests", func() {
 			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)"}}
 			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
 		})
+		It("adds the table predicate to the TOC entry for a table backed up with a predicate", func() {
+			backup.SetTablePredicates(map[string]string{"public.table": "a > 1"})
+			defer backup.SetTablePredicates(nil)
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", Predicate: "a > 1"}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
+		It("adds the masking methods to the TOC entry for a table with masked columns", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.table.a": {Method: options.MASK_HASH, Salt: "secret"}})
+			defer backup.SetColumnMasks(nil)
+			tables := []backup.Table{table}
+			backup.AddTableDataEntriesToTOC(tables, rowsCopiedMaps)
+			expectedDataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "table", Oid: 1, AttributeString: "(a)", MaskedColumns: map[string]string{"a": "hash"}}}
+			Expect(tocfile.DataEntries).To(Equal(expectedDataEntries))
+		})
 		It("does not add an entry for an external table to the TOC", func() {
 			table.IsExternal = true
 			tables := []backup.Table{table}
@@ -79,7 +96,7 @@ var _ = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456.gz"
 
-			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, testTable, filename, defaultConnNum)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -92,7 +109,7 @@ var _ = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, testTable, filename, defaultConnNum)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -102,7 +119,7 @@ var _ = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
 
-			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, testTable, filename, defaultConnNum)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -115,7 +132,52 @@ var _ = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
-			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will back up the rows of a table matching its predicate", func() {
+			backup.SetTablePredicates(map[string]string{"public.foo": "region = 'EU'"})
+			defer backup.SetTablePredicates(nil)
+			predicateTable := backup.Table{Relation: testTable.Relation, TableDefinition: backup.TableDefinition{ColumnDefs: []backup.ColumnDefinition{{Name: "id"}, {Name: "region"}}}}
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
+			execStr := regexp.QuoteMeta("COPY (SELECT id, region FROM public.foo WHERE region = 'EU') TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, predicateTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will back up the rows of a leaf partition matching the predicate of its root partition", func() {
+			backup.SetTablePredicates(map[string]string{"public.foo": "region = 'EU'"})
+			defer backup.SetTablePredicates(nil)
+			leafTable := backup.Table{
+				Relation: backup.Relation{Oid: 3457, Schema: "public", Name: "foo_1_prt_1"},
+				TableDefinition: backup.TableDefinition{
+					ColumnDefs:         []backup.ColumnDefinition{{Name: "id"}},
+					PartitionLevelInfo: backup.PartitionLevelInfo{Level: "l", RootName: "foo"},
+				},
+			}
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
+			execStr := regexp.QuoteMeta("COPY (SELECT id FROM public.foo_1_prt_1 WHERE region = 'EU') TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3457' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3457"
+
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, leafTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("will back up a table with masked columns", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.foo.ssn": {Method: options.MASK_NULL}})
+			defer backup.SetColumnMasks(nil)
+			maskedTable := backup.Table{Relation: testTable.Relation, TableDefinition: backup.TableDefinition{ColumnDefs: []backup.ColumnDefinition{{Name: "id", Type: "integer"}, {Name: "ssn", Type: "text"}}}}
+			utils.SetPipeThroughProgram(utils.PipeThroughProgram{Name: "cat", OutputCommand: "cat -", InputCommand: "cat -", Extension: ""})
+			execStr := regexp.QuoteMeta("COPY (SELECT id, (NULL)::text AS ssn FROM public.foo) TO PROGRAM 'cat - > <SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456' WITH CSV DELIMITER ',' ON SEGMENT;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
+
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, maskedTable, filename, defaultConnNum)
 
 			Expect(err).ShouldNot(HaveOccurred())
 		})
@@ -125,9 +187,47 @@ var _ = Describe("backup/data tests", func() {
 			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
 			filename := "<SEG_DATA_DIR>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_3456"
 
-			_, err := backup.CopyTableOut(connectionPool, testTable, filename, defaultConnNum)
+			_, err := backup.CopyTableOut(context.Background(), connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+	Describe("CopyTableOutToProgram", func() {
+		It("copies the data of a table to a program and returns the rows copied", func() {
+			testTable := backup.Table{Relation: backup.Relation{Schema: "public", Name: "foo"}}
+			execStr := regexp.QuoteMeta(`COPY public.foo TO PROGRAM 'ssh host "cat > /tmp/pipe_<SEGID>"' WITH CSV DELIMITER ',' ON SEGMENT IGNORE EXTERNAL PARTITIONS;`)
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(0, 10))
+
+			rowsCopied, err := backup.CopyTableOutToProgram(context.Background(), connectionPool, testTable, `ssh host "cat > /tmp/pipe_<SEGID>"`, defaultConnNum)
 
 			Expect(err).ShouldNot(HaveOccurred())
+			Expect(rowsCopied).To(Equal(int64(10)))
+		})
+	})
+	Describe("ConstructMaskedColumnExpression", func() {
+		column := backup.ColumnDefinition{Name: "email", Type: "character varying(64)"}
+		It("replaces every value with NULL for the null method", func() {
+			expression := backup.ConstructMaskedColumnExpression(column, options.ColumnMask{Method: options.MASK_NULL})
+			Expect(expression).To(Equal("(NULL)::character varying(64) AS email"))
+		})
+		It("hashes the salted value for the hash method", func() {
+			expression := backup.ConstructMaskedColumnExpression(column, options.ColumnMask{Method: options.MASK_HASH, Salt: "pepper's"})
+			Expect(expression).To(Equal("(md5('pepper''s' || email::text))::character varying(64) AS email"))
+		})
+		It("replaces non-NULL values with the fixed value for the fixed method", func() {
+			expression := backup.ConstructMaskedColumnExpression(column, options.ColumnMask{Method: options.MASK_FIXED, Value: "nobody@example.com"})
+			Expect(expression).To(Equal("(CASE WHEN email IS NULL THEN NULL ELSE 'nobody@example.com' END)::character varying(64) AS email"))
+		})
+		It("replaces letters and digits with derived ones for the fake method", func() {
+			expression := backup.ConstructMaskedColumnExpression(column, options.ColumnMask{Method: options.MASK_FAKE})
+			charHash := "get_byte(decode(md5('' || email::text || i::text), 'hex'), 0)"
+			Expect(expression).To(Equal(fmt.Sprintf("(coalesce((SELECT string_agg(CASE WHEN ascii(c) BETWEEN 48 AND 57 THEN chr(48 + %[1]s %% 10) WHEN ascii(c) BETWEEN 65 AND 90 THEN chr(65 + %[1]s %% 26) WHEN ascii(c) BETWEEN 97 AND 122 THEN chr(97 + %[1]s %% 26) ELSE c END, '' ORDER BY i) FROM (SELECT i, substr(email::text, i, 1) AS c FROM generate_series(1, length(email::text)) AS i) AS chars), email::text))::character varying(64) AS email", charHash)))
+		})
+		It("replaces only the digits of a numeric value for the fake method", func() {
+			numericColumn := backup.ColumnDefinition{Name: "salary", Type: "numeric(10,2)"}
+			expression := backup.ConstructMaskedColumnExpression(numericColumn, options.ColumnMask{Method: options.MASK_FAKE})
+			charHash := "get_byte(decode(md5('' || salary::text || i::text), 'hex'), 0)"
+			Expect(expression).To(Equal(fmt.Sprintf("(coalesce((SELECT string_agg(CASE WHEN ascii(c) BETWEEN 48 AND 57 THEN chr(48 + %[1]s %% 10) ELSE c END, '' ORDER BY i) FROM (SELECT i, substr(salary::text, i, 1) AS c FROM generate_series(1, length(salary::text)) AS i) AS chars), salary::text))::numeric(10,2) AS salary", charHash)))
 		})
 	})
 	Describe("BackupSingleTableData", func() {
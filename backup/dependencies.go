@@ -2,6 +2,7 @@ package backup
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -225,12 +226,31 @@ func breakCircularDependencies(depMap DependencyMap) {
 	}
 }
 
-func PrintDependentObjectStatements(metadataFile *utils.FileWithByteCount, toc *toc.TOC, objects []Sortable, metadataMap MetadataMap, constraints []Constraint, funcInfoMap map[uint32]FunctionInfo) {
+/*
+ * Converts an object's unique ID and dependencies to the form stored in the
+ * TOC, with dependencies sorted so that the TOC contents are deterministic.
+ */
+func getTOCDependencies(object Sortable, dependencies DependencyMap) (toc.UniqueID, []toc.UniqueID) {
+	var tocDependencies []toc.UniqueID
+	for dependency := range dependencies[object.GetUniqueID()] {
+		tocDependencies = append(tocDependencies, toc.UniqueID(dependency))
+	}
+	sort.Slice(tocDependencies, func(i, j int) bool {
+		if tocDependencies[i].ClassID != tocDependencies[j].ClassID {
+			return tocDependencies[i].ClassID < tocDependencies[j].ClassID
+		}
+		return tocDependencies[i].Oid < tocDependencies[j].Oid
+	})
+	return toc.UniqueID(object.GetUniqueID()), tocDependencies
+}
+
+func PrintDependentObjectStatements(metadataFile *utils.FileWithByteCount, toc *toc.TOC, objects []Sortable, metadataMap MetadataMap, constraints []Constraint, funcInfoMap map[uint32]FunctionInfo, dependencies DependencyMap) {
 	conMap := make(map[string][]Constraint)
 	for _, constraint := range constraints {
 		conMap[constraint.OwningObject] = append(conMap[constraint.OwningObject], constraint)
 	}
 	for _, object := range objects {
+		firstEntry := len(toc.PredataEntries)
 		objMetadata := metadataMap[object.GetUniqueID()]
 		switch obj := object.(type) {
 		case BaseType:
@@ -272,6 +292,8 @@ func PrintDependentObjectStatements(metadataFile *utils.FileWithByteCount, toc *
 		case UserMapping:
 			PrintCreateUserMappingStatement(metadataFile, toc, obj)
 		}
+		objectID, objectDependencies := getTOCDependencies(object, dependencies)
+		toc.SetPredataEntryDependencies(firstEntry, objectID, objectDependencies)
 		// Remove ACLs from metadataMap for the current object since they have been processed
 		delete(metadataMap, object.GetUniqueID())
 	}
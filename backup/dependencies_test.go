@@ -6,6 +6,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -136,7 +137,7 @@ var _ = Describe("backup/dependencies tests", func() {
 			constraints := []backup.Constraint{
 				{Name: "check_constraint", ConDef: sql.NullString{String: "CHECK (VALUE > 2)", Valid: true}, OwningObject: "public.domain"},
 			}
-			backup.PrintDependentObjectStatements(backupfile, tocfile, objects, metadataMap, constraints, funcInfoMap)
+			backup.PrintDependentObjectStatements(backupfile, tocfile, objects, metadataMap, constraints, funcInfoMap, backup.DependencyMap{})
 			testhelper.ExpectRegexp(buffer, `
 CREATE FUNCTION public.function(integer, integer) RETURNS integer AS
 $_$SELECT $1 + $2$_$
@@ -181,9 +182,28 @@ CREATE TRUSTED PROTOCOL ext_protocol (readfunc = public.read_from_s3, writefunc
 COMMENT ON PROTOCOL ext_protocol IS 'protocol';
 `)
 		})
+		It("records where the names are printed so that a redirect rewrites them in the dependent objects", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "public", Name: "function"},
+				{Schema: "public", Name: "domain"},
+				{Schema: "public", Name: "relation", IsRelation: true},
+			})
+			objects = []backup.Sortable{
+				backup.Domain{Oid: 4, Schema: "public", Name: "domain", BaseType: "numeric"},
+				backup.Function{Oid: 1, Schema: "public", Name: "function", FunctionBody: "SELECT count(*) FROM public.relation WHERE $1 > 0",
+					Arguments: sql.NullString{String: "public.domain", Valid: true}, IdentArgs: sql.NullString{String: "public.domain", Valid: true},
+					ResultType: sql.NullString{String: "bigint", Valid: true}, Language: "sql"},
+			}
+			backup.PrintDependentObjectStatements(backupfile, tocfile, objects, backup.MetadataMap{}, []backup.Constraint{}, funcInfoMap, backup.DependencyMap{})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE DOMAIN foo2.domain AS numeric;",
+				"CREATE FUNCTION foo2.function(foo2.domain) RETURNS bigint AS\n$_$SELECT count(*) FROM foo2.relation WHERE $1 > 0$_$\nLANGUAGE sql;",
+			}))
+		})
 		It("prints create statements for dependent types, functions, protocols, and tables (no domain constraint)", func() {
 			constraints := make([]backup.Constraint, 0)
-			backup.PrintDependentObjectStatements(backupfile, tocfile, objects, metadataMap, constraints, funcInfoMap)
+			backup.PrintDependentObjectStatements(backupfile, tocfile, objects, metadataMap, constraints, funcInfoMap, backup.DependencyMap{})
 			testhelper.ExpectRegexp(buffer, `
 CREATE FUNCTION public.function(integer, integer) RETURNS integer AS
 $_$SELECT $1 + $2$_$
@@ -1,6 +1,7 @@
 package backup
 
 import (
+	"context"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -20,69 +21,100 @@ import (
  */
 
 /*
- * Non-flag variables
+ * The state of a backup, which a new backup replaces as a whole so that
+ * nothing is left over from a previous backup in the same process.  As the
+ * functions of this package share the state of the backup in progress, only
+ * one backup may run in a process at a time.
  */
-var (
-	backupReport         *report.Report
-	connectionPool       *dbconn.DBConn
-	globalCluster        *cluster.Cluster
-	globalFPInfo         filepath.FilePathInfo
-	globalTOC            *toc.TOC
-	objectCounts         map[string]int
-	pluginConfig         *utils.PluginConfig
-	version              string
+type runState struct {
+	backupReport   *report.Report
+	connectionPool *dbconn.DBConn
+	globalCluster  *cluster.Cluster
+	globalFPInfo   filepath.FilePathInfo
+	globalTOC      *toc.TOC
+	objectCounts   map[string]int
+	pluginConfig   *utils.PluginConfig
+	/*
+	 * The backup is terminated if it is canceled before it completes.  The
+	 * mutex orders the two, as the backup is canceled on another goroutine.
+	 */
+	terminationMutex     sync.Mutex
 	wasTerminated        bool
+	completed            bool
 	backupLockFile       lockfile.Lockfile
 	filterRelationClause string
+	objectTypeSet        *utils.FilterSet
+	tablePredicates      map[string]string
+	columnMasks          map[string]options.ColumnMask
 	quotedRoleNames      map[string]string
+	cmdFlags             *pflag.FlagSet
+	// The flags as they were set for the backup, before setup rewrites any of them
+	flagValues map[string][]string
 	/*
-	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
-	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
-	 * or the signal handler.
+	 * Canceled when the backup is canceled or --timeout expires, which cancels
+	 * the COPY commands, cluster commands, and plugin commands in progress.
 	 */
-	CleanupGroup *sync.WaitGroup
-)
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	/*
+	 * Used for synchronizing DoCleanup.  The group is incremented when the
+	 * state is created, and a canceled backup waits for the DoCleanup of the
+	 * cancellation to finish before returning.
+	 */
+	cleanupGroup *sync.WaitGroup
+}
 
-/*
- * Command-line flags
- */
-var cmdFlags *pflag.FlagSet
+func newRunState(ctx context.Context) *runState {
+	cleanupGroup := &sync.WaitGroup{}
+	cleanupGroup.Add(1)
+	return &runState{
+		objectCounts: make(map[string]int),
+		runCtx:       ctx,
+		cancelRun:    func() {},
+		cleanupGroup: cleanupGroup,
+	}
+}
+
+var (
+	state   = newRunState(context.Background())
+	version string
+)
 
 /*
  * Setter functions
  */
 
 func SetCmdFlags(flagSet *pflag.FlagSet) {
-	cmdFlags = flagSet
-	options.SetBackupFlagDefaults(cmdFlags)
+	state.cmdFlags = flagSet
+	options.SetBackupFlagDefaults(state.cmdFlags)
 }
 
 func SetConnection(conn *dbconn.DBConn) {
-	connectionPool = conn
+	state.connectionPool = conn
 }
 
 func SetCluster(cluster *cluster.Cluster) {
-	globalCluster = cluster
+	state.globalCluster = cluster
 }
 
 func SetFPInfo(fpInfo filepath.FilePathInfo) {
-	globalFPInfo = fpInfo
+	state.globalFPInfo = fpInfo
 }
 
 func SetPluginConfig(config *utils.PluginConfig) {
-	pluginConfig = config
+	state.pluginConfig = config
 }
 
 func SetReport(report *report.Report) {
-	backupReport = report
+	state.backupReport = report
 }
 
 func GetReport() *report.Report {
-	return backupReport
+	return state.backupReport
 }
 
 func SetTOC(toc *toc.TOC) {
-	globalTOC = toc
+	state.globalTOC = toc
 }
 
 func SetVersion(v string) {
@@ -90,31 +122,43 @@ func SetVersion(v string) {
 }
 
 func SetFilterRelationClause(filterClause string) {
-	filterRelationClause = filterClause
+	state.filterRelationClause = filterClause
+}
+
+func SetObjectTypeSet(objectSet *utils.FilterSet) {
+	state.objectTypeSet = objectSet
+}
+
+func SetTablePredicates(predicates map[string]string) {
+	state.tablePredicates = predicates
+}
+
+func SetColumnMasks(masks map[string]options.ColumnMask) {
+	state.columnMasks = masks
 }
 
 func SetQuotedRoleNames(quotedRoles map[string]string) {
-	quotedRoleNames = quotedRoles
+	state.quotedRoleNames = quotedRoles
 }
 
 // Util functions to enable ease of access to global flag values
 
 func MustGetFlagString(flagName string) string {
-	return options.MustGetFlagString(cmdFlags, flagName)
+	return options.MustGetFlagString(state.cmdFlags, flagName)
 }
 
 func MustGetFlagInt(flagName string) int {
-	return options.MustGetFlagInt(cmdFlags, flagName)
+	return options.MustGetFlagInt(state.cmdFlags, flagName)
 }
 
 func MustGetFlagBool(flagName string) bool {
-	return options.MustGetFlagBool(cmdFlags, flagName)
+	return options.MustGetFlagBool(state.cmdFlags, flagName)
 }
 
 func MustGetFlagStringSlice(flagName string) []string {
-	return options.MustGetFlagStringSlice(cmdFlags, flagName)
+	return options.MustGetFlagStringSlice(state.cmdFlags, flagName)
 }
 
 func MustGetFlagStringArray(flagName string) []string {
-	return options.MustGetFlagStringArray(cmdFlags, flagName)
+	return options.MustGetFlagStringArray(state.cmdFlags, flagName)
 }
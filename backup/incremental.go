@@ -46,10 +46,10 @@ func GetLatestMatchingBackupTimestamp() string {
 	var contents *history.History
 	var latestMatchingBackupHistoryEntry *history.BackupConfig
 	var err error
-	if iohelper.FileExistsAndIsReadable(globalFPInfo.GetBackupHistoryFilePath()) {
-		contents, err = history.NewHistory(globalFPInfo.GetBackupHistoryFilePath())
+	if iohelper.FileExistsAndIsReadable(state.globalFPInfo.GetBackupHistoryFilePath()) {
+		contents, err = history.NewHistory(state.globalFPInfo.GetBackupHistoryFilePath())
 		gplog.FatalOnError(err)
-		latestMatchingBackupHistoryEntry = GetLatestMatchingBackupConfig(contents, &backupReport.BackupConfig)
+		latestMatchingBackupHistoryEntry = GetLatestMatchingBackupConfig(contents, &state.backupReport.BackupConfig)
 	}
 
 	if latestMatchingBackupHistoryEntry == nil {
@@ -80,6 +80,7 @@ func matchesIncrementalFlags(backupConfig *history.BackupConfig, currentBackupCo
 		pluginBinaryName == currentBackupConfig.Plugin &&
 		backupConfig.SingleDataFile == MustGetFlagBool(options.SINGLE_DATA_FILE) &&
 		backupConfig.Compressed == currentBackupConfig.Compressed &&
+		backupConfig.DataSubset == currentBackupConfig.DataSubset &&
 		// Expanding of the include list happens before this now so we must compare again current backup config
 		utils.NewIncludeSet(backupConfig.IncludeRelations).Equals(utils.NewIncludeSet(currentBackupConfig.IncludeRelations)) &&
 		utils.NewIncludeSet(backupConfig.IncludeSchemas).Equals(utils.NewIncludeSet(MustGetFlagStringArray(options.INCLUDE_SCHEMA))) &&
@@ -90,7 +91,7 @@ func matchesIncrementalFlags(backupConfig *history.BackupConfig, currentBackupCo
 func PopulateRestorePlan(changedTables []Table,
 	restorePlan []history.RestorePlanEntry, allTables []Table) []history.RestorePlanEntry {
 	currBackupRestorePlanEntry := history.RestorePlanEntry{
-		Timestamp: globalFPInfo.Timestamp,
+		Timestamp: state.globalFPInfo.Timestamp,
 		TableFQNs: make([]string, 0, len(changedTables)),
 	}
 
@@ -6,8 +6,10 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/metadata_globals tests", func() {
@@ -460,4 +462,42 @@ GRANT ALL ON TABLESPACE test_tablespace TO testrole;`,
 			testutils.AssertBufferContents(tocfile.GlobalEntries, buffer, expectedStatements...)
 		})
 	})
+	Describe("redirecting global metadata", func() {
+		BeforeEach(func() {
+			backupfile.Names = utils.NewObjectNames(`"Test DB"`, []utils.ObjectName{{Schema: "testdb", Name: "testdb", IsRelation: true}})
+		})
+		It("rewrites every name of the database printed by PrintCreateDatabaseStatement and PrintDatabaseGUCs", func() {
+			db := backup.Database{Oid: 1, Name: `"Test DB"`, Tablespace: "pg_default"}
+			dbMetadataMap := backup.MetadataMap{db.GetUniqueID(): {Owner: "testrole", Comment: `Copied from DATABASE "Test DB"`, SecurityLabelProvider: "dummy", SecurityLabel: "unclassified",
+				Privileges: []backup.ACL{{Grantee: "testrole", Connect: true}}}}
+			backup.PrintCreateDatabaseStatement(backupfile, tocfile, emptyDB, db, dbMetadataMap)
+			backup.PrintDatabaseGUCs(backupfile, tocfile, []string{"SET search_path TO testdb"}, `"Test DB"`)
+
+			Expect(testutils.RedirectDatabaseInBuffer(tocfile, backupfile, buffer, "global", `"Test DB"`, "newdb")).To(Equal([]string{
+				`CREATE DATABASE newdb TEMPLATE template0;`,
+				`COMMENT ON DATABASE newdb IS 'Copied from DATABASE "Test DB"';`,
+				`ALTER DATABASE newdb OWNER TO testrole;`,
+				`REVOKE ALL ON DATABASE newdb FROM PUBLIC;
+REVOKE ALL ON DATABASE newdb FROM testrole;
+GRANT CONNECT ON DATABASE newdb TO testrole;`,
+				`SECURITY LABEL FOR dummy ON DATABASE newdb IS 'unclassified';`,
+				`ALTER DATABASE newdb SET search_path TO testdb;`,
+			}))
+		})
+		It("leaves the statements printed by the other global metadata functions unchanged", func() {
+			testhelper.SetDBVersion(connectionPool, "5.9.0")
+			backup.PrintSessionGUCs(backupfile, tocfile, backup.SessionGUCs{ClientEncoding: "UTF8"})
+			backup.PrintCreateResourceQueueStatements(backupfile, tocfile, []backup.ResourceQueue{{Oid: 1, Name: "testdb", ActiveStatements: 1, MaxCost: "-1.00", MinCost: "0.00", Priority: "medium", MemoryLimit: "-1"}}, backup.MetadataMap{})
+			backup.PrintResetResourceGroupStatements(backupfile, tocfile)
+			backup.PrintCreateResourceGroupStatements(backupfile, tocfile, []backup.ResourceGroup{{Oid: 2, Name: "testdb", CPURateLimit: "10", MemoryLimit: "20", Concurrency: "15", MemorySharedQuota: "25", MemorySpillRatio: "30"}}, backup.MetadataMap{})
+			backup.PrintCreateRoleStatements(backupfile, tocfile, []backup.Role{{Oid: 3, Name: "testdb", ConnectionLimit: -1, ResQueue: "testdb", TimeConstraints: []backup.TimeConstraint{}}}, backup.MetadataMap{})
+			backup.PrintRoleGUCStatements(backupfile, tocfile, map[string][]backup.RoleGUC{"testdb": {{RoleName: "testdb", DbName: `"Test DB"`, Config: "SET search_path TO testdb"}}})
+			backup.PrintRoleMembershipStatements(backupfile, tocfile, []backup.RoleMember{{Role: "testdb", Member: "testrole"}})
+			backup.PrintCreateTablespaceStatements(backupfile, tocfile, []backup.Tablespace{{Oid: 4, Tablespace: "testdb", FileLocation: "'/data/testdb.testdb'"}}, backup.MetadataMap{})
+			expectedStatements := testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "global", "")
+
+			Expect(testutils.RedirectDatabaseInBuffer(tocfile, backupfile, buffer, "global", `"Test DB"`, "newdb")).To(Equal(expectedStatements))
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "global", "newschema")).To(Equal(expectedStatements))
+		})
+	})
 })
@@ -0,0 +1,118 @@
+package backup
+
+/*
+ * This file contains functions related to writing a backup in the plain
+ * format, a single SQL script that can be replayed with psql.
+ */
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+func isPlainFormat() bool {
+	return MustGetFlagString(options.FORMAT) == options.FORMAT_PLAIN
+}
+
+/*
+ * The script contains the session GUCs, then the predata statements in TOC
+ * order, then a COPY ... FROM stdin block for each table, then the postdata
+ * statements.  Global objects are left out, as they are for a gprestore run
+ * without --with-globals, since replaying them would affect the whole cluster.
+ */
+func writePlainScript(metadataFilename string, tables []Table) {
+	scriptFilename := state.globalFPInfo.GetPlainScriptFilePath()
+	gplog.Info("Writing plain format script to %s", scriptFilename)
+	scriptFile := utils.NewFileWithByteCountFromFile(scriptFilename)
+	defer scriptFile.Close()
+	metadataFile, err := os.Open(metadataFilename)
+	gplog.FatalOnError(err)
+	defer metadataFile.Close()
+
+	scriptFile.MustPrintf("--\n-- Greenplum Database plain format backup\n--\n-- Timestamp: %s\n-- Database: %s\n--\n", state.globalFPInfo.Timestamp, state.connectionPool.DBName)
+	writePlainScriptStatements(scriptFile, state.globalTOC.GetSQLStatementForObjectTypes("global", metadataFile, []string{"SESSION GUCS"}, []string{}, []string{}, []string{}, []string{}, []string{}))
+	writePlainScriptStatements(scriptFile, state.globalTOC.GetSQLStatementForObjectTypes("predata", metadataFile, []string{}, []string{}, []string{}, []string{}, []string{}, []string{}))
+	writePlainScriptData(scriptFile, tables)
+	writePlainScriptStatements(scriptFile, state.globalTOC.GetSQLStatementForObjectTypes("postdata", metadataFile, []string{}, []string{}, []string{}, []string{}, []string{}, []string{}))
+	scriptFile.MustPrintln()
+}
+
+func writePlainScriptStatements(scriptFile *utils.FileWithByteCount, statements []toc.StatementWithType) {
+	for _, statement := range statements {
+		scriptFile.MustPrint(statement.Statement)
+	}
+}
+
+func writePlainScriptData(scriptFile *utils.FileWithByteCount, tables []Table) {
+	dataTables := make([]Table, 0)
+	for _, table := range tables {
+		if table.SkipDataBackup() {
+			gplog.Verbose("Skipping data backup of table %s because it is either an external or foreign table.", table.FQN())
+		} else {
+			dataTables = append(dataTables, table)
+		}
+	}
+	if len(dataTables) == 0 {
+		return
+	}
+
+	progressBar := utils.NewProgressBar(len(dataTables), "Tables backed up: ", utils.PB_INFO)
+	progressBar.Start()
+	for _, table := range dataTables {
+		if wasCanceled() {
+			return
+		}
+		gplog.Verbose("Writing data for table %s to plain format script", table.FQN())
+		dataFilename := state.globalFPInfo.GetTableBackupFilePath(-1, table.Oid, "", false)
+		copyCtx, cancelCopy := utils.NewTimeoutContext(state.runCtx, MustGetFlagInt(options.COPY_TIMEOUT))
+		_, err := CopyTableOutToCoordinatorFile(copyCtx, state.connectionPool, table, dataFilename, 0)
+		cancelCopy()
+		if err != nil {
+			gplog.Fatal(getCopyError(copyCtx, table.FQN(), err), "")
+		}
+
+		scriptFile.MustPrintf("\n\nCOPY %s %s FROM stdin;\n", table.FQN(), ConstructTableAttributesList(table.ColumnDefs))
+		appendFileToScript(scriptFile, dataFilename)
+		scriptFile.MustPrint("\\.\n")
+		progressBar.Increment()
+	}
+	progressBar.Finish()
+}
+
+/*
+ * The data is copied in text format, which is what psql expects after a
+ * COPY ... FROM stdin, to a file on the coordinator so that it can be read
+ * back in by gpbackup.
+ */
+func CopyTableOutToCoordinatorFile(ctx context.Context, connectionPool *dbconn.DBConn, table Table, filename string, connNum int) (int64, error) {
+	query := fmt.Sprintf("COPY %s TO '%s' IGNORE EXTERNAL PARTITIONS;", table.FQN(), utils.EscapeSingleQuotes(filename))
+	if copyQuery := ConstructCopyQuery(table); copyQuery != "" {
+		query = fmt.Sprintf("COPY (%s) TO '%s';", copyQuery, utils.EscapeSingleQuotes(filename))
+	}
+	gplog.Verbose(query)
+	result, err := connectionPool.ExecContext(ctx, query, connNum)
+	if err != nil {
+		return 0, err
+	}
+	numRows, _ := result.RowsAffected()
+	return numRows, nil
+}
+
+func appendFileToScript(scriptFile *utils.FileWithByteCount, filename string) {
+	dataFile, err := os.Open(filename)
+	gplog.FatalOnError(err)
+	bytesWritten, err := io.Copy(scriptFile.Writer, dataFile)
+	gplog.FatalOnError(err, "Unable to write to file")
+	scriptFile.ByteCount += uint64(bytesWritten)
+	_ = dataFile.Close()
+	err = os.Remove(filename)
+	gplog.FatalOnError(err)
+}
@@ -0,0 +1,43 @@
+package backup_test
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/options"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/plain tests", func() {
+	Describe("CopyTableOutToCoordinatorFile", func() {
+		testTable := backup.Table{
+			Relation:        backup.Relation{SchemaOid: 2345, Oid: 3456, Schema: "public", Name: "foo"},
+			TableDefinition: backup.TableDefinition{ColumnDefs: []backup.ColumnDefinition{{Name: "id", Type: "integer"}, {Name: "name", Type: "text"}}},
+		}
+		filename := "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101_3456"
+		It("copies a table to a file on the coordinator", func() {
+			execStr := regexp.QuoteMeta("COPY public.foo TO '/data/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101_3456' IGNORE EXTERNAL PARTITIONS;")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+
+			_, err := backup.CopyTableOutToCoordinatorFile(context.Background(), connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+		It("copies the filtered and masked rows of a table to a file on the coordinator", func() {
+			backup.SetTablePredicates(map[string]string{"public.foo": "id < 100"})
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.foo.name": {Method: options.MASK_FIXED, Value: "anonymous"}})
+			defer backup.SetTablePredicates(nil)
+			defer backup.SetColumnMasks(nil)
+			execStr := regexp.QuoteMeta("COPY (SELECT id, (CASE WHEN name IS NULL THEN NULL ELSE 'anonymous' END)::text AS name FROM public.foo WHERE id < 100) TO '/data/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101_3456';")
+			mock.ExpectExec(execStr).WillReturnResult(sqlmock.NewResult(10, 0))
+
+			_, err := backup.CopyTableOutToCoordinatorFile(context.Background(), connectionPool, testTable, filename, defaultConnNum)
+
+			Expect(err).ShouldNot(HaveOccurred())
+		})
+	})
+})
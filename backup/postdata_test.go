@@ -5,8 +5,10 @@ import (
 
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/postdata tests", func() {
@@ -57,6 +59,18 @@ var _ = Describe("backup/postdata tests", func() {
 				"ALTER TABLE public.testtable REPLICA IDENTITY USING INDEX testindex;",
 			)
 		})
+		It("records where the schema of the table is printed so that a redirect rewrites it in the index definition", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{{Schema: "foo", Name: "bar", IsRelation: true}, {Schema: "foo", Name: "bar_idx", IsRelation: true}})
+			index = backup.IndexDefinition{Oid: 1, Name: "bar_idx", OwningSchema: "foo", OwningTable: "bar", Tablespace: "test_tablespace", IsClustered: true,
+				Def: sql.NullString{String: "CREATE INDEX bar_idx ON foo.bar USING btree(foo)", Valid: true}}
+			backup.PrintCreateIndexStatements(backupfile, tocfile, []backup.IndexDefinition{index}, emptyMetadataMap)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "postdata", "foo2")).To(Equal([]string{
+				"CREATE INDEX bar_idx ON foo2.bar USING btree(foo);",
+				"ALTER INDEX foo2.bar_idx SET TABLESPACE test_tablespace;",
+				"ALTER TABLE foo2.bar CLUSTER ON bar_idx;",
+			}))
+		})
 	})
 	Context("PrintCreateRuleStatements", func() {
 		rule := backup.RuleDefinition{Oid: 1, Name: "testrule", OwningSchema: "public", OwningTable: "testtable", Def: sql.NullString{String: "CREATE RULE update_notify AS ON UPDATE TO testtable DO NOTIFY testtable;", Valid: true}}
@@ -74,6 +88,18 @@ var _ = Describe("backup/postdata tests", func() {
 			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, "CREATE RULE update_notify AS ON UPDATE TO testtable DO NOTIFY testtable;",
 				"COMMENT ON RULE testrule ON public.testtable IS 'This is a rule comment.';")
 		})
+		It("records where the schema of the table is printed so that a redirect rewrites it in the rule definition but not the comment", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{{Schema: "foo", Name: "bar", IsRelation: true}})
+			rule := backup.RuleDefinition{Oid: 1, Name: "bar_rule", OwningSchema: "foo", OwningTable: "bar",
+				Def: sql.NullString{String: "CREATE RULE bar_rule AS\n    ON UPDATE TO foo.bar DO NOTIFY bar;", Valid: true}}
+			ruleMetadataMap := backup.MetadataMap{rule.GetUniqueID(): {Comment: "Notifies foo.bar listeners"}}
+			backup.PrintCreateRuleStatements(backupfile, tocfile, []backup.RuleDefinition{rule}, ruleMetadataMap)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "postdata", "foo2")).To(Equal([]string{
+				"CREATE RULE bar_rule AS\n    ON UPDATE TO foo2.bar DO NOTIFY bar;",
+				"COMMENT ON RULE bar_rule ON foo2.bar IS 'Notifies foo.bar listeners';",
+			}))
+		})
 	})
 	Context("PrintCreateTriggerStatements", func() {
 		trigger := backup.TriggerDefinition{Oid: 1, Name: "testtrigger", OwningSchema: "public", OwningTable: "testtable", Def: sql.NullString{String: "CREATE TRIGGER sync_testtable AFTER INSERT OR DELETE OR UPDATE ON testtable FOR EACH STATEMENT EXECUTE PROCEDURE flatfile_update_trigger()", Valid: true}}
@@ -91,6 +117,29 @@ var _ = Describe("backup/postdata tests", func() {
 			testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, "CREATE TRIGGER sync_testtable AFTER INSERT OR DELETE OR UPDATE ON testtable FOR EACH STATEMENT EXECUTE PROCEDURE flatfile_update_trigger();",
 				"COMMENT ON TRIGGER testtrigger ON public.testtable IS 'This is a trigger comment.';")
 		})
+		It("records where the names are printed so that a redirect rewrites the table and functions of the triggers", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "bar", IsRelation: true},
+				{Schema: "foo", Name: "sync_bar"},
+				{Schema: "foo", Name: "abort_any_command"},
+			})
+			trigger := backup.TriggerDefinition{Oid: 1, Name: "sync_bar", OwningSchema: "foo", OwningTable: "bar",
+				Def: sql.NullString{String: "CREATE TRIGGER sync_bar AFTER INSERT ON foo.bar FOR EACH STATEMENT EXECUTE PROCEDURE foo.sync_bar()", Valid: true}}
+			backup.PrintCreateTriggerStatements(backupfile, tocfile, []backup.TriggerDefinition{trigger}, backup.MetadataMap{})
+			eventTrigger := backup.EventTrigger{Oid: 2, Name: "testeventtrigger", Event: "ddl_command_start", FunctionName: "foo.abort_any_command", Enabled: "D"}
+			backup.PrintCreateEventTriggerStatements(backupfile, tocfile, []backup.EventTrigger{eventTrigger}, backup.MetadataMap{})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "postdata", "foo2")).To(Equal([]string{
+				"CREATE TRIGGER sync_bar AFTER INSERT ON foo2.bar FOR EACH STATEMENT EXECUTE PROCEDURE foo2.sync_bar();",
+				"CREATE EVENT TRIGGER testeventtrigger\nON ddl_command_start\nEXECUTE PROCEDURE foo2.abort_any_command();",
+				"ALTER EVENT TRIGGER testeventtrigger DISABLE;",
+			}))
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "postdata", "foo", "bar", "baz")).To(Equal([]string{
+				"CREATE TRIGGER sync_bar AFTER INSERT ON foo.baz FOR EACH STATEMENT EXECUTE PROCEDURE foo.sync_bar();",
+				"CREATE EVENT TRIGGER testeventtrigger\nON ddl_command_start\nEXECUTE PROCEDURE foo.abort_any_command();",
+				"ALTER EVENT TRIGGER testeventtrigger DISABLE;",
+			}))
+		})
 	})
 	Context("PrintCreateEventTriggerStatements", func() {
 		It("can print a basic event trigger", func() {
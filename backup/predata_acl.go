@@ -59,9 +59,12 @@ type MetadataMap map[UniqueID]ObjectMetadata
 func PrintStatements(metadataFile *utils.FileWithByteCount, toc *toc.TOC,
 	obj toc.TOCObject, statements []string) {
 	for _, statement := range statements {
+		section, entry := obj.GetMetadataEntry()
+		if !shouldBackupStatement(entry.ObjectType, statement) {
+			continue
+		}
 		start := metadataFile.ByteCount
 		metadataFile.MustPrintf("\n\n%s\n", statement)
-		section, entry := obj.GetMetadataEntry()
 		toc.AddMetadataEntry(section, entry, start, metadataFile.ByteCount)
 	}
 }
@@ -77,7 +80,7 @@ func PrintObjectMetadata(metadataFile *utils.FileWithByteCount, toc *toc.TOC,
 		statements = append(statements, strings.TrimSpace(comment))
 	}
 	if owner := metadata.GetOwnerStatement(obj.FQN(), entry.ObjectType); owner != "" {
-		if !(connectionPool.Version.Before("5") && entry.ObjectType == "LANGUAGE") {
+		if !(state.connectionPool.Version.Before("5") && entry.ObjectType == "LANGUAGE") {
 			// Languages have implicit owners in 4.3, but do not support ALTER OWNER
 			statements = append(statements, strings.TrimSpace(owner))
 		}
@@ -253,7 +256,7 @@ func ParseACL(aclStr string) *ACL {
 			}
 			lastChar = char
 		}
-		if quotedRoleName, ok := quotedRoleNames[grantee]; ok {
+		if quotedRoleName, ok := state.quotedRoleNames[grantee]; ok {
 			acl.Grantee = quotedRoleName
 		} else {
 			acl.Grantee = grantee
@@ -447,7 +450,7 @@ func createPrivilegeStrings(acl ACL, objectType string) (string, string) {
 }
 func (obj ObjectMetadata) GetOwnerStatement(objectName string, objectType string) string {
 	typeStr := objectType
-	if connectionPool.Version.Before("6") && (objectType == "SEQUENCE" || objectType == "VIEW") {
+	if state.connectionPool.Version.Before("6") && (objectType == "SEQUENCE" || objectType == "VIEW") {
 		typeStr = "TABLE"
 	} else if objectType == "FOREIGN SERVER" {
 		typeStr = "SERVER"
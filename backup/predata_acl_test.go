@@ -9,6 +9,8 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -134,6 +136,14 @@ GRANT ALL ON TABLE public.tablename TO anothertestrole;
 GRANT SELECT,INSERT,UPDATE,DELETE,TRUNCATE,REFERENCES ON TABLE public.tablename TO testrole;
 GRANT TRIGGER ON TABLE public.tablename TO PUBLIC;`)
 		})
+		It("does not print statements for excluded metadata pseudo types", func() {
+			backup.SetObjectTypeSet(toc.NewObjectTypeSet([]string{}, []string{"ACL", "COMMENT"}))
+			defer backup.SetObjectTypeSet(nil)
+			tableMetadata := backup.ObjectMetadata{Privileges: privileges, Owner: "testrole", Comment: "This is a table comment."}
+			backup.PrintObjectMetadata(backupfile, tocfile, tableMetadata, table, "")
+			Expect(string(buffer.Contents())).To(Equal("\n\nALTER TABLE public.tablename OWNER TO testrole;\n"))
+			Expect(tocfile.PredataEntries).To(HaveLen(1))
+		})
 		It("prints SERVER for ALTER and FOREIGN SERVER for GRANT/REVOKE for a foreign server", func() {
 			server := backup.ForeignServer{Name: "foreignserver"}
 			serverPrivileges := testutils.DefaultACLForType("testrole", "FOREIGN SERVER")
@@ -189,6 +199,26 @@ ALTER %s public.sequencename OWNER TO testrole;`, expectedKeyword))
 ALTER %s public.viewname OWNER TO testrole;`, expectedKeyword))
 			})
 		})
+		It("records where the names are printed so that a redirect rewrites the table but not the comment", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{{Schema: "foo", Name: "tablename", IsRelation: true}})
+			table := backup.Table{Relation: backup.Relation{Schema: "foo", Name: "tablename"}}
+			tableMetadata := backup.ObjectMetadata{Comment: "Copied from foo.tablename; see foo.tablename", Owner: "testrole",
+				Privileges: []backup.ACL{{Grantee: "testrole", Select: true}}, SecurityLabelProvider: "dummy", SecurityLabel: "foo.tablename"}
+			backup.PrintObjectMetadata(backupfile, tocfile, tableMetadata, table, "")
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"COMMENT ON TABLE foo2.tablename IS 'Copied from foo.tablename; see foo.tablename';",
+				"ALTER TABLE foo2.tablename OWNER TO testrole;",
+				"REVOKE ALL ON TABLE foo2.tablename FROM PUBLIC;\nREVOKE ALL ON TABLE foo2.tablename FROM testrole;\nGRANT SELECT ON TABLE foo2.tablename TO testrole;",
+				"SECURITY LABEL FOR dummy ON TABLE foo2.tablename IS 'foo.tablename';",
+			}))
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "tablename", "newname")).To(Equal([]string{
+				"COMMENT ON TABLE foo.newname IS 'Copied from foo.tablename; see foo.tablename';",
+				"ALTER TABLE foo.newname OWNER TO testrole;",
+				"REVOKE ALL ON TABLE foo.newname FROM PUBLIC;\nREVOKE ALL ON TABLE foo.newname FROM testrole;\nGRANT SELECT ON TABLE foo.newname TO testrole;",
+				"SECURITY LABEL FOR dummy ON TABLE foo.newname IS 'foo.tablename';",
+			}))
+		})
 	})
 	Describe("PrintDefaultPrivilegeStatements", func() {
 		privs := []backup.ACL{{Grantee: "", Usage: true}}
@@ -6,6 +6,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/ginkgo/extensions/table"
@@ -643,4 +644,41 @@ DROP TABLE public.partition_table_ext_part_;`)
 DROP TABLE public.partition_table_ext_part_;`)
 		})
 	})
+	Describe("redirecting external objects", func() {
+		funcInfoMap := map[uint32]backup.FunctionInfo{
+			1: {QualifiedName: "foo.read_fn_s3", Arguments: sql.NullString{String: "", Valid: true}},
+			2: {QualifiedName: "foo.write_fn_s3", Arguments: sql.NullString{String: "", Valid: true}},
+		}
+		tables := []backup.Table{
+			{Relation: backup.Relation{Oid: 1, Schema: "foo", Name: "partition_table_ext_part_"}},
+			{Relation: backup.Relation{Oid: 2, Schema: "foo", Name: "partition_table"}},
+		}
+		externalPartition := backup.PartitionInfo{PartitionRuleOid: 1, ParentRelationOid: 2, ParentSchema: "foo", ParentRelationName: "partition_table",
+			RelationOid: 1, PartitionName: "partition_name", IsExternal: true}
+		BeforeEach(func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "read_fn_s3"},
+				{Schema: "foo", Name: "write_fn_s3"},
+				{Schema: "foo", Name: "partition_table", IsRelation: true},
+				{Schema: "foo", Name: "partition_table_ext_part_", IsRelation: true},
+			})
+		})
+		It("rewrites the schema of the protocol functions and of the tables whose partition is exchanged", func() {
+			protocol := backup.ExternalProtocol{Oid: 1, Name: "s3", Owner: "testrole", ReadFunction: 1, WriteFunction: 2}
+			backup.PrintCreateExternalProtocolStatement(backupfile, tocfile, protocol, funcInfoMap, backup.ObjectMetadata{})
+			backup.PrintExchangeExternalPartitionStatements(backupfile, tocfile, []backup.PartitionInfo{externalPartition}, map[uint32]backup.PartitionInfo{}, tables)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE PROTOCOL s3 (readfunc = foo2.read_fn_s3, writefunc = foo2.write_fn_s3);",
+				"ALTER TABLE foo2.partition_table EXCHANGE PARTITION partition_name WITH TABLE foo2.partition_table_ext_part_ WITHOUT VALIDATION;\n\nDROP TABLE foo2.partition_table_ext_part_;",
+			}))
+		})
+		It("rewrites the name of the table whose partition is exchanged", func() {
+			backup.PrintExchangeExternalPartitionStatements(backupfile, tocfile, []backup.PartitionInfo{externalPartition}, map[uint32]backup.PartitionInfo{}, tables)
+
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "partition_table", "baz")).To(Equal([]string{
+				"ALTER TABLE foo.baz EXCHANGE PARTITION partition_name WITH TABLE foo.partition_table_ext_part_ WITHOUT VALIDATION;\n\nDROP TABLE foo.partition_table_ext_part_;",
+			}))
+		})
+	})
 })
@@ -238,7 +238,7 @@ func PrintCreateLanguageStatements(metadataFile *utils.FileWithByteCount, toc *t
 	for _, procLang := range procLangs {
 		start := metadataFile.ByteCount
 		metadataFile.MustPrintf("\n\nCREATE ")
-		if connectionPool.Version.AtLeast("6") {
+		if state.connectionPool.Version.AtLeast("6") {
 			metadataFile.MustPrintf("OR REPLACE ")
 		}
 		if procLang.PlTrusted {
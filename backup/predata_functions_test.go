@@ -6,6 +6,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -873,4 +874,82 @@ GRANT ALL ON LANGUAGE plperl TO testrole;`,
 	OPTIONS (host 'localhost', dbname 'testdb');`)
 		})
 	})
+	Describe("redirecting functions and related objects", func() {
+		funcInfoMap := map[uint32]backup.FunctionInfo{
+			1: {QualifiedName: "foo.sfunc", Arguments: sql.NullString{String: "foo.mytype, integer", Valid: true}},
+			2: {QualifiedName: "foo.handler", Arguments: sql.NullString{String: "", Valid: true}},
+		}
+		BeforeEach(func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "bar", IsRelation: true},
+				{Schema: "foo", Name: "count_bar"},
+				{Schema: "foo", Name: "sfunc"},
+				{Schema: "foo", Name: "agg"},
+				{Schema: "foo", Name: "handler"},
+				{Schema: "foo", Name: "validator"},
+				{Schema: "foo", Name: "cast_func"},
+				{Schema: "foo", Name: "converter"},
+				{Schema: "foo", Name: "conv"},
+				{Schema: "foo", Name: "mytype"},
+				{Schema: "foo", Name: "~>~"},
+			})
+		})
+		It("rewrites the schema in function bodies and in the functions, types, and operators the objects use", func() {
+			function := backup.Function{Oid: 1, Schema: "foo", Name: "count_bar", Arguments: sql.NullString{String: "foo.mytype", Valid: true},
+				IdentArgs: sql.NullString{String: "foo.mytype", Valid: true}, ResultType: sql.NullString{String: "bigint", Valid: true},
+				FunctionBody: "SELECT count(*) FROM foo.bar WHERE 'foo.bar' <> ''", Language: "sql", Volatility: "v", ExecLocation: "a"}
+			backup.PrintCreateFunctionStatement(backupfile, tocfile, function, backup.ObjectMetadata{Owner: "testrole", Comment: "Counts foo.bar"})
+			aggregate := backup.Aggregate{Oid: 2, Schema: "foo", Name: "agg", Arguments: sql.NullString{String: "integer", Valid: true},
+				IdentArgs: sql.NullString{String: "integer", Valid: true}, TransitionFunction: 1, TransitionDataType: "foo.mytype",
+				SortOperator: "~>~", SortOperatorSchema: "foo", InitValIsNull: true, MInitValIsNull: true}
+			backup.PrintCreateAggregateStatement(backupfile, tocfile, aggregate, funcInfoMap, backup.ObjectMetadata{})
+			cast := backup.Cast{Oid: 3, SourceTypeFQN: "foo.mytype", TargetTypeFQN: "integer", FunctionSchema: "foo", FunctionName: "cast_func",
+				FunctionArgs: "foo.mytype", CastContext: "e", CastMethod: "f"}
+			backup.PrintCreateCastStatement(backupfile, tocfile, cast, backup.ObjectMetadata{})
+			conversion := backup.Conversion{Oid: 4, Schema: "foo", Name: "conv", ForEncoding: "UTF8", ToEncoding: "LATIN1", ConversionFunction: "foo.converter"}
+			backup.PrintCreateConversionStatements(backupfile, tocfile, []backup.Conversion{conversion}, backup.MetadataMap{})
+			language := backup.ProceduralLanguage{Oid: 5, Name: "plfoo", Owner: "testrole", IsPl: true, Handler: 2}
+			backup.PrintCreateLanguageStatements(backupfile, tocfile, []backup.ProceduralLanguage{language}, funcInfoMap, backup.MetadataMap{})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE FUNCTION foo2.count_bar(foo2.mytype) RETURNS bigint AS\n$$SELECT count(*) FROM foo2.bar WHERE 'foo.bar' <> ''$$\nLANGUAGE sql;",
+				"COMMENT ON FUNCTION foo2.count_bar(foo2.mytype) IS 'Counts foo.bar';",
+				"ALTER FUNCTION foo2.count_bar(foo2.mytype) OWNER TO testrole;",
+				"CREATE AGGREGATE foo2.agg(integer) (\n\tSFUNC = foo2.sfunc,\n\tSTYPE = foo2.mytype,\n\tSORTOP = foo2.\"~>~\"\n);",
+				"CREATE CAST (foo2.mytype AS integer)\n\tWITH FUNCTION foo2.cast_func(foo2.mytype);",
+				"CREATE CONVERSION foo2.conv FOR 'UTF8' TO 'LATIN1' FROM foo2.converter;",
+				"CREATE PROCEDURAL LANGUAGE plfoo HANDLER foo2.handler;",
+				"ALTER FUNCTION foo2.handler() OWNER TO testrole;",
+			}))
+		})
+		It("rewrites the schema of the functions a foreign-data wrapper uses but leaves its servers and user mappings alone", func() {
+			funcInfoMap[3] = backup.FunctionInfo{QualifiedName: "foo.validator", Arguments: sql.NullString{String: "text[], oid", Valid: true}}
+			handler := backup.Function{Oid: 2, Schema: "foo", Name: "handler", Arguments: sql.NullString{String: "", Valid: true},
+				IdentArgs: sql.NullString{String: "", Valid: true}, ResultType: sql.NullString{String: "fdw_handler", Valid: true},
+				FunctionBody: "handler", BinaryPath: "$libdir/foreigndata", Language: "c", Volatility: "v", ExecLocation: "a"}
+			backup.PrintCreateFunctionStatement(backupfile, tocfile, handler, backup.ObjectMetadata{})
+			fdw := backup.ForeignDataWrapper{Oid: 1, Name: "foreigndata", Handler: 2, Validator: 3}
+			backup.PrintCreateForeignDataWrapperStatement(backupfile, tocfile, fdw, funcInfoMap, backup.ObjectMetadata{})
+			server := backup.ForeignServer{Oid: 2, Name: "foreignserver", ForeignDataWrapper: "foreigndata", Options: "dbname 'foo.bar'"}
+			backup.PrintCreateServerStatement(backupfile, tocfile, server, backup.ObjectMetadata{})
+			backup.PrintCreateUserMappingStatement(backupfile, tocfile, backup.UserMapping{Oid: 3, User: "testrole", Server: "foreignserver"})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE FUNCTION foo2.handler() RETURNS fdw_handler AS\n'$libdir/foreigndata', 'handler'\nLANGUAGE c;",
+				"CREATE FOREIGN DATA WRAPPER foreigndata\n\tHANDLER foo2.handler\n\tVALIDATOR foo2.validator;",
+				"CREATE SERVER foreignserver\n\tFOREIGN DATA WRAPPER foreigndata\n\tOPTIONS (dbname 'foo.bar');",
+				"CREATE USER MAPPING FOR testrole\n\tSERVER foreignserver;",
+			}))
+		})
+		It("rewrites the schema in a function body that is not dollar-quoted", func() {
+			function := backup.Function{Oid: 1, Schema: "foo", Name: "count_bar", Arguments: sql.NullString{String: "", Valid: true},
+				IdentArgs: sql.NullString{String: "", Valid: true}, ResultType: sql.NullString{String: "bigint", Valid: true},
+				BinaryPath: "-", FunctionBody: "SELECT count(*) FROM foo.bar", Language: "sql", Volatility: "v", ExecLocation: "a"}
+			backup.PrintCreateFunctionStatement(backupfile, tocfile, function, backup.ObjectMetadata{})
+
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "bar", "baz")).To(Equal([]string{
+				"CREATE FUNCTION foo.count_bar() RETURNS bigint AS\n$$SELECT count(*) FROM foo.baz bar$$\nLANGUAGE sql;",
+			}))
+		})
+	})
 })
@@ -3,8 +3,10 @@ package backup_test
 import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/predata_operators tests", func() {
@@ -201,4 +203,40 @@ var _ = Describe("backup/predata_operators tests", func() {
 			testutils.AssertBufferContents(tocfile.PredataEntries, buffer, expectedStatements...)
 		})
 	})
+	Describe("redirecting operators", func() {
+		It("rewrites the schema of the operators and of the functions, types, and families they use", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "##"},
+				{Schema: "foo", Name: "###"},
+				{Schema: "foo", Name: "path_inter"},
+				{Schema: "foo", Name: "path"},
+				{Schema: "foo", Name: "testfam"},
+				{Schema: "foo", Name: "testclass"},
+			})
+			operator := backup.Operator{Oid: 1, Schema: "foo", Name: "##", Procedure: "foo.path_inter", LeftArgType: "foo.path", RightArgType: "foo.path",
+				CommutatorOp: "foo.##", NegatorOp: "foo.###", RestrictFunction: "-", JoinFunction: "-"}
+			backup.PrintCreateOperatorStatement(backupfile, tocfile, operator, emptyMetadata)
+			operatorFamily := backup.OperatorFamily{Oid: 2, Schema: "foo", Name: "testfam", IndexMethod: "hash"}
+			backup.PrintCreateOperatorFamilyStatements(backupfile, tocfile, []backup.OperatorFamily{operatorFamily}, backup.MetadataMap{})
+			operatorClass := backup.OperatorClass{Oid: 3, Schema: "foo", Name: "testclass", FamilySchema: "foo", FamilyName: "testfam", IndexMethod: "hash",
+				Type: "foo.path", StorageType: "-",
+				Operators: []backup.OperatorClassOperator{{StrategyNumber: 1, Operator: "foo.##(foo.path,foo.path)"}},
+				Functions: []backup.OperatorClassFunction{{SupportNumber: 1, FunctionName: "foo.path_inter(foo.path,foo.path)"}}}
+			backup.PrintCreateOperatorClassStatement(backupfile, tocfile, operatorClass, emptyMetadata)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{`CREATE OPERATOR foo2.## (
+	PROCEDURE = foo2.path_inter,
+	LEFTARG = foo2.path,
+	RIGHTARG = foo2.path,
+	COMMUTATOR = OPERATOR(foo2.##),
+	NEGATOR = OPERATOR(foo2.###)
+);`,
+				"CREATE OPERATOR FAMILY foo2.testfam USING hash;",
+				`CREATE OPERATOR CLASS foo2.testclass
+	FOR TYPE foo2.path USING hash FAMILY foo2.testfam AS
+	OPERATOR 1 foo2.##(foo2.path,foo2.path),
+	FUNCTION 1 foo2.path_inter(foo2.path,foo2.path);`,
+			}))
+		})
+	})
 })
@@ -245,7 +245,7 @@ func PrintCreateSequenceStatements(metadataFile *utils.FileWithByteCount,
 		start := metadataFile.ByteCount
 		definition := sequence.Definition
 		metadataFile.MustPrintln("\n\nCREATE SEQUENCE", sequence.FQN())
-		if connectionPool.Version.AtLeast("6") {
+		if state.connectionPool.Version.AtLeast("6") {
 			metadataFile.MustPrintln("\tSTART WITH", definition.StartVal)
 		} else if !definition.IsCalled {
 			metadataFile.MustPrintln("\tSTART WITH", definition.LastVal)
@@ -11,6 +11,7 @@ import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -54,6 +55,26 @@ var _ = Describe("backup/predata_relations tests", func() {
 
 SELECT pg_catalog.setval('public.seq_name', 7, true);`, getSeqDefReplace()))
 		})
+		It("records where the schema of the sequence is printed so that a redirect rewrites it in the setval and owner statements", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: `"Foo Schema"`, Name: "seq_name", IsRelation: true},
+				{Schema: `"Foo Schema"`, Name: "tablename", IsRelation: true},
+			})
+			sequence := backup.Sequence{Relation: backup.Relation{Schema: `"Foo Schema"`, Name: "seq_name"}, OwningTableSchema: `"Foo Schema"`,
+				OwningColumn: `"Foo Schema".tablename.col_one`, Definition: seqDefault.Definition}
+			backup.PrintCreateSequenceStatements(backupfile, tocfile, []backup.Sequence{sequence}, emptySequenceMetadataMap)
+			backup.PrintAlterSequenceStatements(backupfile, tocfile, []backup.Sequence{sequence})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", `"it's"`)).To(Equal([]string{fmt.Sprintf(`CREATE SEQUENCE "it's".seq_name%s
+	INCREMENT BY 1
+	NO MAXVALUE
+	NO MINVALUE
+	CACHE 5;
+
+SELECT pg_catalog.setval('"it''s".seq_name', 7, true);`, getSeqDefReplace()),
+				`ALTER SEQUENCE "it's".seq_name OWNED BY "it's".tablename.col_one;`,
+			}))
+		})
 		It("can print a decreasing sequence", func() {
 			sequences := []backup.Sequence{seqNegIncr}
 			backup.PrintCreateSequenceStatements(backupfile, tocfile, sequences, emptySequenceMetadataMap)
@@ -241,6 +262,34 @@ GRANT ALL ON shamwow.shazam TO testrole;`}
 			testutils.AssertBufferContents(tocfile.PredataEntries, buffer,
 				`CREATE VIEW shamwow.shazam WITH (security_barrier=true) AS SELECT count(*) FROM pg_tables;`)
 		})
+		It("records where the schema is printed so that a redirect rewrites it in the view definition but not in an alias", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{{Schema: "foo", Name: "myview", IsRelation: true}, {Schema: "foo", Name: "foo", IsRelation: true}})
+			view = backup.View{Oid: 1, Schema: "foo", Name: "myview", Definition: sql.NullString{String: " SELECT foo.i\n   FROM foo.foo;", Valid: true}}
+			backup.PrintCreateViewStatement(backupfile, tocfile, view, emptyMetadata)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE VIEW foo2.myview AS  SELECT foo.i\n   FROM foo2.foo;",
+			}))
+		})
+		It("records where the names are printed so that a redirect rewrites the tables a materialized view selects from", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "myview", IsRelation: true},
+				{Schema: "foo", Name: "bar", IsRelation: true},
+				{Schema: "foo", Name: "add_one"},
+			})
+			view = backup.View{Oid: 1, Schema: "foo", Name: "myview", IsMaterialized: true,
+				Definition: sql.NullString{String: " SELECT foo.add_one(bar.i) AS i\n   FROM foo.bar\n  WHERE bar.s <> 'foo.bar';", Valid: true}}
+			backup.PrintCreateViewStatement(backupfile, tocfile, view, backup.ObjectMetadata{Owner: "testrole"})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE MATERIALIZED VIEW foo2.myview AS  SELECT foo2.add_one(bar.i) AS i\n   FROM foo2.bar\n  WHERE bar.s <> 'foo.bar'\nWITH NO DATA;",
+				"ALTER MATERIALIZED VIEW foo2.myview OWNER TO testrole;",
+			}))
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "bar", "baz")).To(Equal([]string{
+				"CREATE MATERIALIZED VIEW foo.myview AS  SELECT foo.add_one(bar.i) AS i\n   FROM foo.baz bar\n  WHERE bar.s <> 'foo.bar'\nWITH NO DATA;",
+				"ALTER MATERIALIZED VIEW foo.myview OWNER TO testrole;",
+			}))
+		})
 	})
 	Describe("PrintAlterSequenceStatements", func() {
 		baseSequence := backup.Relation{Schema: "public", Name: "seq_name"}
@@ -6,8 +6,10 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/predata_relations tests", func() {
@@ -43,6 +45,76 @@ var _ = Describe("backup/predata_relations tests", func() {
 FORMAT 'TEXT'
 ENCODING 'UTF-8';`)
 		})
+		Context("redirecting a table", func() {
+			BeforeEach(func() {
+				backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+					{Schema: "foo", Name: "bar", IsRelation: true},
+					{Schema: "foo", Name: "bar_i_seq", IsRelation: true},
+					{Schema: "foo", Name: "parent", IsRelation: true},
+					{Schema: "foo", Name: "mytype"},
+					{Schema: "foo", Name: "mycoll"},
+				})
+				testTable.Relation = backup.Relation{Schema: "foo", Name: "bar"}
+				testTable.ColumnDefs = []backup.ColumnDefinition{
+					{Oid: 0, Num: 1, Name: "foo", Type: "integer", HasDefault: true, DefaultVal: "nextval('foo.bar_i_seq'::regclass)", StatTarget: 3, Comment: "foo.bar column"},
+					{Oid: 1, Num: 2, Name: "bar", Type: "foo.mytype", Collation: "foo.mycoll", StatTarget: -1},
+				}
+				testTable.Inherits = []string{"foo.parent"}
+			})
+			It("rewrites the schema in the column defaults and types and the INHERITS clause, but not in comments", func() {
+				tableMetadata := backup.ObjectMetadata{Owner: "testrole", Comment: "Copied from foo.bar"}
+				backup.PrintCreateTableStatement(backupfile, tocfile, testTable, tableMetadata)
+
+				Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{`CREATE TABLE foo2.bar (
+	foo integer DEFAULT nextval('foo2.bar_i_seq'::regclass),
+	bar foo2.mytype COLLATE foo2.mycoll
+) INHERITS (foo2.parent) DISTRIBUTED RANDOMLY;
+
+ALTER TABLE ONLY foo2.bar ALTER COLUMN foo SET STATISTICS 3;`,
+					"COMMENT ON TABLE foo2.bar IS 'Copied from foo.bar';",
+					"ALTER TABLE foo2.bar OWNER TO testrole;",
+					"COMMENT ON COLUMN foo2.bar.foo IS 'foo.bar column';",
+				}))
+			})
+			It("rewrites the name of the table but not those of the column or the other relations", func() {
+				backup.PrintCreateTableStatement(backupfile, tocfile, testTable, backup.ObjectMetadata{Comment: "Copied from foo.bar"})
+
+				Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "bar", "baz")).To(Equal([]string{`CREATE TABLE foo.baz (
+	foo integer DEFAULT nextval('foo.bar_i_seq'::regclass),
+	bar foo.mytype COLLATE foo.mycoll
+) INHERITS (foo.parent) DISTRIBUTED RANDOMLY;
+
+ALTER TABLE ONLY foo.baz ALTER COLUMN foo SET STATISTICS 3;`,
+					"COMMENT ON TABLE foo.baz IS 'Copied from foo.bar';",
+					"COMMENT ON COLUMN foo.baz.foo IS 'foo.bar column';",
+				}))
+			})
+			It("rewrites the table in the column privileges and security labels and the replica identity", func() {
+				testTable.ColumnDefs = []backup.ColumnDefinition{{Oid: 0, Num: 1, Name: "i", Type: "integer", StatTarget: -1,
+					Privileges: sql.NullString{String: "testrole=r/testrole", Valid: true}, SecurityLabelProvider: "dummy", SecurityLabel: "foo.bar label"}}
+				testTable.ReplicaIdentity = "f"
+				backup.PrintPostCreateTableStatements(backupfile, tocfile, testTable, backup.ObjectMetadata{Owner: "testrole"})
+
+				Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "predata", "foo", "bar", "baz")).To(Equal([]string{
+					"ALTER TABLE foo.baz OWNER TO testrole;",
+					"REVOKE ALL (i) ON TABLE foo.baz FROM PUBLIC;\nREVOKE ALL (i) ON TABLE foo.baz FROM testrole;\nGRANT SELECT (i) ON TABLE foo.baz TO testrole;",
+					"SECURITY LABEL FOR dummy ON COLUMN foo.baz.i IS 'foo.bar label';",
+					"ALTER TABLE foo.baz REPLICA IDENTITY FULL;",
+				}))
+			})
+			It("rewrites the schema in an external table definition", func() {
+				testTable.IsExternal = true
+				testTable.ColumnDefs = []backup.ColumnDefinition{{Oid: 0, Num: 1, Name: "foo", Type: "foo.mytype", StatTarget: -1}}
+				backup.PrintCreateTableStatement(backupfile, tocfile, testTable, noMetadata)
+
+				Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{`CREATE READABLE EXTERNAL WEB TABLE foo2.bar (
+	foo foo2.mytype
+) 
+FORMAT 'TEXT'
+ENCODING 'UTF-8';`,
+				}))
+			})
+		})
 	})
 	Describe("PrintRegularTableCreateStatement", func() {
 		rowOneEncoding := backup.ColumnDefinition{Oid: 0, Num: 1, Name: "i", Type: "integer", Encoding: "compresstype=none,blocksize=32768,compresslevel=0", StatTarget: -1}
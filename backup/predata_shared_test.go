@@ -6,8 +6,10 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/predata_shared tests", func() {
@@ -146,6 +148,29 @@ var _ = Describe("backup/predata_shared tests", func() {
 				testutils.AssertBufferContents(tocfile.PostdataEntries, buffer, `ALTER TABLE public.tablename ADD CONSTRAINT check1 CHECK (VALUE <> 42::numeric);`)
 			})
 		})
+		It("records where the names are printed so that a redirect rewrites the tables and functions the constraints use", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "tablename", IsRelation: true},
+				{Schema: "foo", Name: "other", IsRelation: true},
+				{Schema: "foo", Name: "is_valid"},
+			})
+			check := backup.Constraint{Oid: 1, Schema: "foo", Name: "tablename_check", ConType: "c", ConDef: sql.NullString{String: "CHECK (foo.is_valid(i))", Valid: true},
+				OwningObject: "foo.tablename", ConIsLocal: true}
+			foreign := backup.Constraint{Oid: 2, Schema: "foo", Name: "tablename_i_fkey", ConType: "f", ConDef: sql.NullString{String: "FOREIGN KEY (i) REFERENCES foo.other(i)", Valid: true},
+				OwningObject: "foo.tablename"}
+			backup.PrintConstraintStatements(backupfile, tocfile, []backup.Constraint{foreign, check}, backup.MetadataMap{check.GetUniqueID(): {Comment: "Calls foo.is_valid"}})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "postdata", "foo2")).To(Equal([]string{
+				"ALTER TABLE foo2.tablename ADD CONSTRAINT tablename_check CHECK (foo2.is_valid(i));",
+				"COMMENT ON CONSTRAINT tablename_check ON foo2.tablename IS 'Calls foo.is_valid';",
+				"ALTER TABLE ONLY foo2.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES foo2.other(i);",
+			}))
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "postdata", "foo", "other", "newname")).To(Equal([]string{
+				"ALTER TABLE foo.tablename ADD CONSTRAINT tablename_check CHECK (foo.is_valid(i));",
+				"COMMENT ON CONSTRAINT tablename_check ON foo.tablename IS 'Calls foo.is_valid';",
+				"ALTER TABLE ONLY foo.tablename ADD CONSTRAINT tablename_i_fkey FOREIGN KEY (i) REFERENCES foo.newname(i);",
+			}))
+		})
 	})
 	Describe("PrintCreateSchemaStatements", func() {
 		It("can print a basic schema", func() {
@@ -3,8 +3,10 @@ package backup_test
 import (
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/predata_textsearch tests", func() {
@@ -85,4 +87,47 @@ var _ = Describe("backup/predata_textsearch tests", func() {
 			testutils.AssertBufferContents(tocfile.PredataEntries, buffer, expectedStatements...)
 		})
 	})
+	Describe("redirecting text search objects", func() {
+		It("rewrites the schema of the text search objects and of the functions, templates, parsers, and dictionaries they use", func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "testparser"},
+				{Schema: "foo", Name: "testtemplate"},
+				{Schema: "foo", Name: "testdictionary"},
+				{Schema: "foo", Name: "testconfiguration"},
+				{Schema: "foo", Name: "start_func"},
+				{Schema: "foo", Name: "token_func"},
+				{Schema: "foo", Name: "lexize_func"},
+			})
+			parser := backup.TextSearchParser{Oid: 1, Schema: "foo", Name: "testparser", StartFunc: "foo.start_func", TokenFunc: "foo.token_func",
+				EndFunc: "pg_catalog.prsd_end", LexTypesFunc: "pg_catalog.prsd_lextype"}
+			backup.PrintCreateTextSearchParserStatement(backupfile, tocfile, parser, backup.ObjectMetadata{})
+			template := backup.TextSearchTemplate{Oid: 2, Schema: "foo", Name: "testtemplate", LexizeFunc: "foo.lexize_func"}
+			backup.PrintCreateTextSearchTemplateStatement(backupfile, tocfile, template, backup.ObjectMetadata{})
+			dictionary := backup.TextSearchDictionary{Oid: 3, Schema: "foo", Name: "testdictionary", Template: "foo.testtemplate", InitOption: "stopwords = 'foo.english'"}
+			backup.PrintCreateTextSearchDictionaryStatement(backupfile, tocfile, dictionary, backup.ObjectMetadata{})
+			configuration := backup.TextSearchConfiguration{Oid: 4, Schema: "foo", Name: "testconfiguration", Parser: "foo.testparser",
+				TokenToDicts: map[string][]string{"word": {"foo.testdictionary", "pg_catalog.simple"}}}
+			backup.PrintCreateTextSearchConfigurationStatement(backupfile, tocfile, configuration, backup.ObjectMetadata{})
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{`CREATE TEXT SEARCH PARSER foo2.testparser (
+	START = foo2.start_func,
+	GETTOKEN = foo2.token_func,
+	END = pg_catalog.prsd_end,
+	LEXTYPES = pg_catalog.prsd_lextype
+);`,
+				`CREATE TEXT SEARCH TEMPLATE foo2.testtemplate (
+	LEXIZE = foo2.lexize_func
+);`,
+				`CREATE TEXT SEARCH DICTIONARY foo2.testdictionary (
+	TEMPLATE = foo2.testtemplate,
+	stopwords = 'foo.english'
+);`,
+				`CREATE TEXT SEARCH CONFIGURATION foo2.testconfiguration (
+	PARSER = foo2.testparser
+);`,
+				`ALTER TEXT SEARCH CONFIGURATION foo2.testconfiguration
+	ADD MAPPING FOR "word" WITH foo2.testdictionary, pg_catalog.simple;`,
+			}))
+		})
+	})
 })
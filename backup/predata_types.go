@@ -74,7 +74,7 @@ func PrintCreateBaseTypeStatement(metadataFile *utils.FileWithByteCount, toc *to
 	if base.Send != "" {
 		metadataFile.MustPrintf(",\n\tSEND = %s", base.Send)
 	}
-	if connectionPool.Version.AtLeast("5") {
+	if state.connectionPool.Version.AtLeast("5") {
 		if base.ModIn != "" {
 			metadataFile.MustPrintf(",\n\tTYPMOD_IN = %s", base.ModIn)
 		}
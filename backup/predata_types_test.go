@@ -6,8 +6,10 @@ import (
 
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("backup/predata_types tests", func() {
@@ -300,4 +302,68 @@ ALTER TYPE public.base_type
 			testutils.AssertBufferContents(tocfile.PredataEntries, buffer, expectedStatements...)
 		})
 	})
+	Describe("redirecting types", func() {
+		BeforeEach(func() {
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{
+				{Schema: "foo", Name: "shell_type"},
+				{Schema: "foo", Name: "base_type"},
+				{Schema: "foo", Name: "domain_type"},
+				{Schema: "foo", Name: "composite_type"},
+				{Schema: "foo", Name: "enum_type"},
+				{Schema: "foo", Name: "range_type"},
+				{Schema: "foo", Name: "mycoll"},
+				{Schema: "foo", Name: "input_fn"},
+				{Schema: "foo", Name: "output_fn"},
+				{Schema: "foo", Name: "min_value"},
+				{Schema: "foo", Name: "range_diff"},
+				{Schema: "foo", Name: "range_ops"},
+			})
+		})
+		It("rewrites the schema of the types and of the functions, types, and collations they use, but not in literals", func() {
+			backup.PrintCreateShellTypeStatements(backupfile, tocfile, []backup.ShellType{{Oid: 1, Schema: "foo", Name: "shell_type"}}, []backup.BaseType{}, []backup.RangeType{})
+			base := backup.BaseType{Oid: 2, Schema: "foo", Name: "base_type", Input: "foo.input_fn", Output: "foo.output_fn", InternalLength: -1,
+				Alignment: "c", Storage: "p", DefaultVal: "foo.base_type", Element: "foo.shell_type", Category: "U"}
+			backup.PrintCreateBaseTypeStatement(backupfile, tocfile, base, emptyMetadata)
+			domain := backup.Domain{Oid: 3, Schema: "foo", Name: "domain_type", BaseType: "foo.base_type", DefaultVal: "'foo.base_type'::foo.base_type", Collation: "foo.mycoll"}
+			constraints := []backup.Constraint{{Name: "domain_check", ConDef: sql.NullString{String: "CHECK (VALUE > foo.min_value())", Valid: true}}}
+			backup.PrintCreateDomainStatement(backupfile, tocfile, domain, emptyMetadata, constraints)
+			composite := backup.CompositeType{Oid: 4, Schema: "foo", Name: "composite_type",
+				Attributes: []backup.Attribute{{Name: "foo", Type: "foo.domain_type", Collation: "foo.mycoll", Comment: "'Uses foo.domain_type'"}}}
+			backup.PrintCreateCompositeTypeStatement(backupfile, tocfile, composite, emptyMetadata)
+			enum := backup.EnumType{Oid: 5, Schema: "foo", Name: "enum_type", EnumLabels: "'foo.enum_type',\n\t'bar'"}
+			backup.PrintCreateEnumTypeStatements(backupfile, tocfile, []backup.EnumType{enum}, emptyMetadataMap)
+			rangeType := backup.RangeType{Oid: 6, Schema: "foo", Name: "range_type", SubType: "foo.base_type", SubTypeOpClass: "foo.range_ops",
+				Collation: "foo.mycoll", SubTypeDiff: "foo.range_diff"}
+			backup.PrintCreateRangeTypeStatement(backupfile, tocfile, rangeType, emptyMetadata)
+			collation := backup.Collation{Oid: 7, Schema: "foo", Name: "mycoll", Collate: "foo.UTF-8", Ctype: "foo.UTF-8"}
+			backup.PrintCreateCollationStatements(backupfile, tocfile, []backup.Collation{collation}, emptyMetadataMap)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "predata", "foo2")).To(Equal([]string{
+				"CREATE TYPE foo2.shell_type;",
+				`CREATE TYPE foo2.base_type (
+	INPUT = foo2.input_fn,
+	OUTPUT = foo2.output_fn,
+	DEFAULT = 'foo.base_type',
+	ELEMENT = foo2.shell_type
+);`,
+				`CREATE DOMAIN foo2.domain_type AS foo2.base_type DEFAULT 'foo.base_type'::foo2.base_type COLLATE foo2.mycoll
+	CONSTRAINT domain_check CHECK (VALUE > foo2.min_value());`,
+				`CREATE TYPE foo2.composite_type AS (
+	foo foo2.domain_type COLLATE foo2.mycoll
+);`,
+				"COMMENT ON COLUMN foo2.composite_type.foo IS 'Uses foo.domain_type';",
+				`CREATE TYPE foo2.enum_type AS ENUM (
+	'foo.enum_type',
+	'bar'
+);`,
+				`CREATE TYPE foo2.range_type AS RANGE (
+	SUBTYPE = foo2.base_type,
+	SUBTYPE_OPCLASS = foo2.range_ops,
+	COLLATION = foo2.mycoll,
+	SUBTYPE_DIFF = foo2.range_diff
+);`,
+				"CREATE COLLATION foo2.mycoll (LC_COLLATE = 'foo.UTF-8', LC_CTYPE = 'foo.UTF-8');",
+			}))
+		})
+	})
 })
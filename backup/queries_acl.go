@@ -323,9 +323,9 @@ func getQuotedRoleNames(connectionPool *dbconn.DBConn) map[string]string {
 	query := `SELECT rolname AS rolename, quote_ident(rolname) AS quotedrolename FROM pg_authid`
 	err := connectionPool.Select(&results, query)
 	gplog.FatalOnError(err)
-	quotedRoleNames = make(map[string]string)
+	state.quotedRoleNames = make(map[string]string)
 	for _, result := range results {
-		quotedRoleNames[result.RoleName] = result.QuotedRoleName
+		state.quotedRoleNames[result.RoleName] = result.QuotedRoleName
 	}
-	return quotedRoleNames
+	return state.quotedRoleNames
 }
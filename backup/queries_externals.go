@@ -155,6 +155,25 @@ func (pi PartitionInfo) GetMetadataEntry() (string, toc.MetadataEntry) {
 		}
 }
 
+// Returns the oids of the partition tables with at least one external leaf partition
+func GetPartitionTablesWithExternalPartitions(connectionPool *dbconn.DBConn) map[uint32]bool {
+	results := make([]struct{ Oid uint32 }, 0)
+	query := `
+	SELECT DISTINCT pp.parrelid AS oid
+	FROM pg_partition pp
+		JOIN pg_partition_rule pr ON pr.paroid = pp.oid
+		JOIN pg_exttable e ON e.reloid = pr.parchildrelid
+	WHERE pp.paristemplate = false`
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+
+	tableOids := make(map[uint32]bool, len(results))
+	for _, result := range results {
+		tableOids[result.Oid] = true
+	}
+	return tableOids
+}
+
 func GetExternalPartitionInfo(connectionPool *dbconn.DBConn) ([]PartitionInfo, map[uint32]PartitionInfo) {
 	results := make([]PartitionInfo, 0)
 	query := `
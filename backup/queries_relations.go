@@ -6,6 +6,7 @@ package backup
  */
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"strings"
@@ -19,24 +20,24 @@ import (
 )
 
 func relationAndSchemaFilterClause() string {
-	if filterRelationClause != "" {
-		return filterRelationClause
+	if state.filterRelationClause != "" {
+		return state.filterRelationClause
 	}
-	filterRelationClause = SchemaFilterClause("n")
+	state.filterRelationClause = SchemaFilterClause("n")
 	if len(MustGetFlagStringArray(options.EXCLUDE_RELATION)) > 0 {
-		excludeOids := getOidsFromRelationList(connectionPool, MustGetFlagStringArray(options.EXCLUDE_RELATION))
+		excludeOids := getOidsFromRelationList(state.connectionPool, MustGetFlagStringArray(options.EXCLUDE_RELATION))
 		if len(excludeOids) > 0 {
-			filterRelationClause += fmt.Sprintf("\nAND c.oid NOT IN (%s)", strings.Join(excludeOids, ", "))
+			state.filterRelationClause += fmt.Sprintf("\nAND c.oid NOT IN (%s)", strings.Join(excludeOids, ", "))
 		}
 	}
 	if len(MustGetFlagStringArray(options.INCLUDE_RELATION)) > 0 {
-		quotedIncludeRelations, err := options.QuoteTableNames(connectionPool, MustGetFlagStringArray(options.INCLUDE_RELATION))
+		quotedIncludeRelations, err := options.QuoteTableNames(state.connectionPool, MustGetFlagStringArray(options.INCLUDE_RELATION))
 		gplog.FatalOnError(err)
 
-		includeOids := getOidsFromRelationList(connectionPool, quotedIncludeRelations)
-		filterRelationClause += fmt.Sprintf("\nAND c.oid IN (%s)", strings.Join(includeOids, ", "))
+		includeOids := getOidsFromRelationList(state.connectionPool, quotedIncludeRelations)
+		state.filterRelationClause += fmt.Sprintf("\nAND c.oid IN (%s)", strings.Join(includeOids, ", "))
 	}
-	return filterRelationClause
+	return state.filterRelationClause
 }
 
 func getOidsFromRelationList(connectionPool *dbconn.DBConn, quotedIncludeRelations []string) []string {
@@ -377,9 +378,10 @@ func LockTablesWithConnection(connectionPool *dbconn.DBConn, tables []Relation,
 	for i, currentBatch := range tableBatches {
 		_, err := connectionPool.Exec(fmt.Sprintf("LOCK TABLE %s IN ACCESS SHARE MODE", currentBatch), whichConn)
 		if err != nil {
-			if wasTerminated {
+			if state.runCtx.Err() == context.Canceled {
+				// Run returns once the cleanup of the cancellation completes, so stop locking tables
 				gplog.Warn("Interrupt received while acquiring ACCESS SHARE locks on tables")
-				select {} // wait for cleanup thread to exit gpbackup
+				return
 			} else {
 				gplog.FatalOnError(err)
 			}
@@ -256,3 +256,43 @@ func ExtensionFilterClause(namespace string) string {
 
 	return fmt.Sprintf("%s NOT IN (select objid from pg_depend where deptype = 'e')", oidStr)
 }
+
+/*
+ * The names of the objects that statements can refer to by a schema-qualified
+ * name.  Backup uses them to find the schema and relation names in the
+ * statements it prints, so that restore can redirect them.  Operator names
+ * are printed without quotes, so they are not quoted here either.
+ */
+func GetSchemaQualifiedObjectNames(connectionPool *dbconn.DBConn) []utils.ObjectName {
+	catalogQueries := []string{
+		"SELECT relnamespace AS namespace, quote_ident(relname) AS name, true AS isrelation FROM pg_class",
+		"SELECT pronamespace, quote_ident(proname), false FROM pg_proc",
+		"SELECT typnamespace, quote_ident(typname), false FROM pg_type",
+		"SELECT oprnamespace, oprname, false FROM pg_operator",
+		"SELECT opcnamespace, quote_ident(opcname), false FROM pg_opclass",
+		"SELECT connamespace, quote_ident(conname), false FROM pg_conversion",
+	}
+	if connectionPool.Version.AtLeast("5") {
+		catalogQueries = append(catalogQueries,
+			"SELECT opfnamespace, quote_ident(opfname), false FROM pg_opfamily",
+			"SELECT prsnamespace, quote_ident(prsname), false FROM pg_ts_parser",
+			"SELECT tmplnamespace, quote_ident(tmplname), false FROM pg_ts_template",
+			"SELECT dictnamespace, quote_ident(dictname), false FROM pg_ts_dict",
+			"SELECT cfgnamespace, quote_ident(cfgname), false FROM pg_ts_config")
+	}
+	if connectionPool.Version.AtLeast("6") {
+		catalogQueries = append(catalogQueries, "SELECT collnamespace, quote_ident(collname), false FROM pg_collation")
+	}
+	query := fmt.Sprintf(`
+	SELECT quote_ident(n.nspname) AS schema,
+		o.name,
+		o.isrelation
+	FROM (%s) o
+		JOIN pg_namespace n ON o.namespace = n.oid
+	WHERE %s`, strings.Join(catalogQueries, "\n\t\tUNION ALL "), SchemaFilterClause("n"))
+
+	results := make([]utils.ObjectName, 0)
+	err := connectionPool.Select(&results, query)
+	gplog.FatalOnError(err)
+	return results
+}
@@ -0,0 +1,186 @@
+package backup
+
+/*
+ * This file contains the API for running a backup from another Go program
+ * instead of from the gpbackup command line.
+ */
+
+import (
+	"context"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+/*
+ * Flags holds the values of gpbackup's command-line flags, keyed by the flag
+ * names in the options package, e.g. options.DBNAME.  Flags that may be
+ * passed more than once, such as --include-table, take each of their values
+ * in turn, and boolean flags take "true" or "false".
+ *
+ * LogDir is the directory the log file is written to, which defaults to
+ * gpAdminLogs in the home directory as with gpbackup.  It is only used if
+ * logging has not already been initialized in this process.
+ */
+type Config struct {
+	Flags  map[string][]string
+	LogDir string
+}
+
+type Result struct {
+	Timestamp    string
+	BackupConfig history.BackupConfig
+}
+
+// Backups in the same process share the package state, so only one may run at a time
+var runMutex sync.Mutex
+
+/*
+ * Runs a backup as gpbackup would with the flags in config, but returns an
+ * error instead of exiting the process if the backup fails.  The version
+ * recorded in the backup must have been set with SetVersion.
+ *
+ * Canceling ctx before the backup completes aborts it in the same way as
+ * sending gpbackup a termination signal, in which case the error returned is
+ * ctx.Err() and no history or report file is written.  Canceling ctx after
+ * that does not affect the result.  Run returns once cleanup is complete.
+ */
+func Run(ctx context.Context, config Config) (*Result, error) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	if version == "" {
+		return nil, errors.New("The gpbackup version must be set with SetVersion before running a backup")
+	}
+	state = newRunState(ctx)
+	// The state of this run, including its canceled context, must not be left for later runs in the process
+	defer func() {
+		state = newRunState(context.Background())
+	}()
+	SetCmdFlags(pflag.NewFlagSet("gpbackup", pflag.ContinueOnError))
+	err := options.SetFlagValues(state.cmdFlags, config.Flags)
+	if err != nil {
+		return nil, err
+	}
+	err = applyConfigFile(state.cmdFlags)
+	if err != nil {
+		return nil, err
+	}
+	gplog.InitializeLogging("gpbackup", config.LogDir)
+	gplog.SetErrorCode(0)
+
+	var cleanupOnce sync.Once
+	cleanup := func(backupFailed bool) {
+		cleanupOnce.Do(func() { DoCleanup(backupFailed) })
+	}
+	backupDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if !state.terminate() {
+				return
+			}
+			cleanupOnce.Do(func() {
+				gplog.Warn("Context canceled, aborting backup process")
+				DoCleanup(true)
+			})
+		case <-backupDone:
+		}
+	}()
+
+	backupFailed := false
+	errStr, runErr := runRecovering(func() {
+		validateFlagCombinations(state.cmdFlags)
+		validateFlagValues()
+		DoSetup()
+		DoBackup()
+	})
+	terminated := state.complete()
+	close(backupDone)
+	if runErr != nil {
+		backupFailed = true
+	}
+	_, teardownErr := runRecovering(func() {
+		backupFailed = finishBackup(backupFailed, errStr)
+	})
+	var result *Result
+	if !terminated && runErr == nil && teardownErr == nil {
+		result = &Result{Timestamp: state.globalFPInfo.Timestamp, BackupConfig: state.backupReport.BackupConfig}
+	}
+	cleanup(backupFailed)
+
+	switch {
+	case terminated:
+		return nil, ctx.Err()
+	case runErr != nil:
+		return nil, runErr
+	case teardownErr != nil:
+		return nil, teardownErr
+	}
+	if gplog.GetErrorCode() == 0 {
+		gplog.Info("Backup completed successfully")
+	}
+	return result, nil
+}
+
+/*
+ * Returns the code gpbackup exits with once Run returns err, which is the
+ * error code of the backup, or 2 if it failed or was canceled.  An error that
+ * was not already logged, such as that of an invalid config file, is logged.
+ */
+func GetExitCode(err error) int {
+	if err == nil {
+		return gplog.GetErrorCode()
+	}
+	if gplog.GetErrorCode() != 2 && err != context.Canceled {
+		gplog.Error(err.Error())
+	}
+	return 2
+}
+
+/*
+ * Marks the backup as terminated, unless it has already completed, as by then
+ * the history and report of a successful backup may already have been
+ * written.  Returns whether the backup was terminated.
+ */
+func (s *runState) terminate() bool {
+	s.terminationMutex.Lock()
+	defer s.terminationMutex.Unlock()
+	if s.completed {
+		return false
+	}
+	s.wasTerminated = true
+	return true
+}
+
+// Marks the backup as completed and returns whether it was terminated first
+func (s *runState) complete() bool {
+	s.terminationMutex.Lock()
+	defer s.terminationMutex.Unlock()
+	s.completed = true
+	return s.wasTerminated
+}
+
+/*
+ * Runs f and returns the error of any panic it causes, along with the message
+ * to record in the backup report, which is only set if gplog.Fatal caused it.
+ */
+func runRecovering(f func()) (errStr string, err error) {
+	defer func() {
+		if panicValue := recover(); panicValue != nil {
+			errStr = getFatalErrorMessage(panicValue)
+			if errStr != "" {
+				err = errors.New(report.ParseErrorMessage(errStr))
+			} else {
+				err = errors.Errorf("%v", panicValue)
+			}
+		}
+	}()
+	f()
+	return "", nil
+}
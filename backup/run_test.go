@@ -0,0 +1,111 @@
+package backup_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("backup/run tests", func() {
+	Describe("Run", func() {
+		BeforeEach(func() {
+			backup.SetVersion("1.0.0")
+		})
+		AfterEach(func() {
+			backup.SetVersion("")
+			gplog.SetErrorCode(0)
+		})
+		It("returns an error if the version is not set", func() {
+			backup.SetVersion("")
+
+			_, err := backup.Run(context.Background(), backup.Config{Flags: map[string][]string{options.DBNAME: {"testdb"}}})
+
+			Expect(err).To(MatchError("The gpbackup version must be set with SetVersion before running a backup"))
+		})
+		It("returns an error if the database name is not set", func() {
+			_, err := backup.Run(context.Background(), backup.Config{})
+
+			Expect(err).To(MatchError("The --dbname flag must be set"))
+		})
+		It("returns an error if the database name is not set in the config file either", func() {
+			configFile, err := ioutil.TempFile("", "gpbackup_config*.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(configFile.Name())
+			_, err = configFile.WriteString("jobs: 4\n")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configFile.Close()).To(Succeed())
+
+			_, err = backup.Run(context.Background(), backup.Config{Flags: map[string][]string{options.CONFIG: {configFile.Name()}}})
+
+			Expect(err).To(MatchError("The --dbname flag must be set"))
+		})
+		It("validates the flags set in the config file", func() {
+			configFile, err := ioutil.TempFile("", "gpbackup_config*.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.Remove(configFile.Name())
+			_, err = configFile.WriteString("dbname: testdb\ndata-only: true\nprofiles:\n  metadata:\n    metadata-only: true\n")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(configFile.Close()).To(Succeed())
+
+			_, err = backup.Run(context.Background(), backup.Config{Flags: map[string][]string{
+				options.CONFIG:         {configFile.Name()},
+				options.CONFIG_PROFILE: {"metadata"},
+			}})
+
+			Expect(err).To(MatchError("The following flags may not be specified together: data-only, metadata-only, incremental"))
+		})
+		It("returns an error for an unknown flag", func() {
+			_, err := backup.Run(context.Background(), backup.Config{Flags: map[string][]string{options.DBNAME: {"testdb"}, "unknown-flag": {"true"}}})
+
+			Expect(err).To(MatchError("Unknown flag: --unknown-flag"))
+		})
+		It("returns the error that would cause gpbackup to exit instead of exiting", func() {
+			_, err := backup.Run(context.Background(), backup.Config{Flags: map[string][]string{
+				options.DBNAME:        {"testdb"},
+				options.DATA_ONLY:     {"true"},
+				options.METADATA_ONLY: {"true"},
+			}})
+
+			Expect(err).To(MatchError("The following flags may not be specified together: data-only, metadata-only, incremental"))
+		})
+		It("returns an error for a negative timeout", func() {
+			_, err := backup.Run(context.Background(), backup.Config{Flags: map[string][]string{
+				options.DBNAME:  {"testdb"},
+				options.TIMEOUT: {"-1"},
+			}})
+
+			Expect(err).To(MatchError("--timeout must be 0 or greater"))
+		})
+	})
+	Describe("GetExitCode", func() {
+		AfterEach(func() {
+			gplog.SetErrorCode(0)
+		})
+		It("returns the error code of a backup that did not fail", func() {
+			gplog.SetErrorCode(1)
+
+			Expect(backup.GetExitCode(nil)).To(Equal(1))
+		})
+		It("logs an error that was not already logged and returns 2", func() {
+			_, stderr, _ := testhelper.SetupTestLogger()
+
+			Expect(backup.GetExitCode(errors.New("Invalid config file"))).To(Equal(2))
+			Expect(string(stderr.Contents())).To(ContainSubstring("[ERROR]:-Invalid config file"))
+		})
+		It("returns 2 without logging an error for a canceled backup", func() {
+			_, stderr, _ := testhelper.SetupTestLogger()
+
+			Expect(backup.GetExitCode(context.Canceled)).To(Equal(2))
+			Expect(string(stderr.Contents())).To(BeEmpty())
+		})
+	})
+})
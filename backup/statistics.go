@@ -59,7 +59,7 @@ func GenerateAttributeStatisticsQueries(table Table, attStat AttributeStatistic)
 	inheritStr := ""
 	attributeSlotsQueryStr := ""
 	var attributeQueries []string
-	if connectionPool.Version.AtLeast("6") {
+	if state.connectionPool.Version.AtLeast("6") {
 		inheritStr = fmt.Sprintf("\n\t%t::boolean,", attStat.Inherit)
 		attributeSlotsQueryStr = generateAttributeSlotsQueryMaster(attStat)
 	} else {
@@ -5,6 +5,7 @@ import (
 
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/lib/pq"
 
 	. "github.com/onsi/ginkgo"
@@ -133,6 +134,23 @@ fmt.Sprintf(`INSERT INTO pg_statistic VALUES (
 			testutils.AssertBufferContents(tocfile.StatisticsEntries, buffer, expected...)
 		})
 	})
+	Describe("redirecting statistics", func() {
+		It("records where the table is printed so that a redirect rewrites it in the statistics queries", func() {
+			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "statistics")
+			backupfile.Names = utils.NewObjectNames("testdb", []utils.ObjectName{{Schema: "foo", Name: "bar", IsRelation: true}})
+			table := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "foo", Name: "bar"}}
+			tupleStats := map[uint32]backup.TupleStatistic{1: {Schema: "foo", Table: "bar", RelPages: 1, RelTuples: 2}}
+
+			backup.PrintStatisticsStatements(backupfile, tocfile, []backup.Table{table}, map[uint32][]backup.AttributeStatistic{}, tupleStats)
+
+			Expect(testutils.RedirectSchemaInBuffer(tocfile, backupfile, buffer, "statistics", "foo2")).To(Equal([]string{
+				"UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 2.000000::real\nWHERE oid = 'foo2.bar'::regclass::oid;",
+			}))
+			Expect(testutils.RedirectTableInBuffer(tocfile, backupfile, buffer, "statistics", "foo", "bar", `"Bar's"`)).To(Equal([]string{
+				"UPDATE pg_class\nSET\n\trelpages = 1::int,\n\treltuples = 2.000000::real\nWHERE oid = 'foo.\"Bar''s\"'::regclass::oid;",
+			}))
+		})
+	})
 	Describe("GenerateTupleStatisticsQuery", func() {
 		It("generates tuple statistics query with double quotes and a single quote in the table name and schema name", func() {
 			tableTestTable := backup.Table{Relation: backup.Relation{Schema: `"""test'schema"""`, Name: `"""test'table"""`}}
@@ -2,12 +2,15 @@ package backup
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
@@ -19,10 +22,143 @@ import (
 
 func validateFilterLists(opts *options.Options) {
 	gplog.Verbose("Validating Tables and Schemas exist in Database")
-	ValidateTablesExist(connectionPool, opts.GetIncludedTables(), false)
-	ValidateTablesExist(connectionPool, opts.GetExcludedTables(), true)
-	ValidateSchemasExist(connectionPool, opts.GetIncludedSchemas(), false)
-	ValidateSchemasExist(connectionPool, opts.GetExcludedSchemas(), true)
+	ValidateTablesExist(state.connectionPool, opts.GetIncludedTables(), false)
+	ValidateTablesExist(state.connectionPool, opts.GetExcludedTables(), true)
+	ValidateSchemasExist(state.connectionPool, opts.GetIncludedSchemas(), false)
+	ValidateSchemasExist(state.connectionPool, opts.GetExcludedSchemas(), true)
+}
+
+/*
+ * Comments, owners, privileges, and security labels are only written along
+ * with the objects they belong to, so they can be excluded from a backup but
+ * cannot be backed up on their own.
+ */
+func validateObjectTypeFilters(opts *options.Options) {
+	for _, objectType := range opts.GetIncludedObjectTypes() {
+		if utils.Exists(toc.MetadataPseudoTypes, objectType) {
+			gplog.Fatal(errors.Errorf("Cannot use --include-object-type with %s during backup.  Use --exclude-object-type to exclude %s instead.", objectType, objectType), "")
+		}
+	}
+}
+
+/*
+ * A predicate for a table that is not in the backup set would otherwise be
+ * silently ignored, so we fail rather than risk backing up the full contents
+ * of a table the user meant to subset.
+ */
+func validateTablePredicates(dataTables []Table) {
+	if len(state.tablePredicates) == 0 {
+		return
+	}
+	backupSetFQNs := make([]string, 0)
+	for _, table := range dataTables {
+		if table.SkipDataBackup() {
+			continue
+		}
+		backupSetFQNs = append(backupSetFQNs, table.FQN())
+		if table.PartitionLevelInfo.RootName != "" {
+			backupSetFQNs = append(backupSetFQNs, utils.MakeFQN(table.Schema, table.PartitionLevelInfo.RootName))
+		}
+	}
+	backupSetTables := utils.NewSet(backupSetFQNs)
+	predicateTables := make([]string, 0)
+	for tableName := range state.tablePredicates {
+		predicateTables = append(predicateTables, tableName)
+	}
+	sort.Strings(predicateTables)
+	for _, tableName := range predicateTables {
+		if !backupSetTables.MatchesFilter(tableName) {
+			gplog.Fatal(errors.Errorf("Table %s in --table-predicate-file is not a table whose data is included in the backup", tableName), "")
+		}
+	}
+}
+
+/*
+ * A table with a predicate or masked columns is copied out through a query,
+ * which unlike a COPY of the table itself cannot ignore external partitions,
+ * so the data of a partition table with external partitions would be read
+ * from the external tables as well.
+ */
+func ValidateTablesCopiedByQuery(connectionPool *dbconn.DBConn, dataTables []Table) {
+	if (len(state.tablePredicates) == 0 && len(state.columnMasks) == 0) || connectionPool.Version.AtLeast("7") {
+		return
+	}
+	externalPartitionTables := GetPartitionTablesWithExternalPartitions(connectionPool)
+	for _, table := range dataTables {
+		if externalPartitionTables[table.Oid] && ConstructCopyQuery(table) != "" {
+			gplog.Fatal(errors.Errorf("Cannot use a table predicate or masked columns for table %s, which has external partitions.  Use --%s to back up its leaf partitions separately.",
+				table.FQN(), options.LEAF_PARTITION_DATA), "")
+		}
+	}
+}
+
+var (
+	maskableTextType    = regexp.MustCompile(`^(text|character varying|character|citext)(\(\d+\))?$`)
+	// Faking the digits of an integer could overflow it, and the text of a float may be in exponent form or Infinity
+	maskableNumericType = regexp.MustCompile(`^numeric(\(\d+(,\d+)?\))?$`)
+)
+
+/*
+ * Every masked column must belong to a table whose data is backed up, and its
+ * masking method must produce values that can be restored into the column.
+ * A fixed value is cast to the type of its column here, so that a value that
+ * is not valid for the column fails the backup before any data is written
+ * rather than partway through the COPY of its table.
+ */
+func ValidateColumnMasks(dataTables []Table) {
+	if len(state.columnMasks) == 0 {
+		return
+	}
+	maskedColumns := make(map[string]bool)
+	for _, table := range dataTables {
+		if table.SkipDataBackup() {
+			continue
+		}
+		for columnName, mask := range GetColumnMasks(table) {
+			var column ColumnDefinition
+			for _, columnDef := range table.ColumnDefs {
+				if columnDef.Name == columnName {
+					column = columnDef
+					break
+				}
+			}
+			columnFQN := utils.MakeFQN(table.FQN(), columnName)
+			switch mask.Method {
+			case options.MASK_NULL:
+				if column.NotNull {
+					gplog.Fatal(errors.Errorf("Cannot use masking method null for column %s, which has a NOT NULL constraint", columnFQN), "")
+				}
+			case options.MASK_HASH:
+				if !maskableTextType.MatchString(column.Type) {
+					gplog.Fatal(errors.Errorf("Cannot use masking method hash for column %s of type %s.  Only text columns can be hashed.", columnFQN, column.Type), "")
+				}
+			case options.MASK_FIXED:
+				_, err := state.connectionPool.Exec(fmt.Sprintf("SELECT '%s'::%s", utils.EscapeSingleQuotes(mask.Value), column.Type))
+				if err != nil {
+					gplog.Fatal(errors.Errorf("Cannot use fixed value %s for column %s of type %s: %v", mask.Value, columnFQN, column.Type, err), "")
+				}
+			case options.MASK_FAKE:
+				if !maskableTextType.MatchString(column.Type) && !maskableNumericType.MatchString(column.Type) {
+					gplog.Fatal(errors.Errorf("Cannot use masking method fake for column %s of type %s.  Only text and numeric columns can be faked.", columnFQN, column.Type), "")
+				}
+			}
+			maskedColumns[columnFQN] = true
+			if table.PartitionLevelInfo.RootName != "" {
+				rootFQN := utils.MakeFQN(table.Schema, table.PartitionLevelInfo.RootName)
+				maskedColumns[utils.MakeFQN(rootFQN, columnName)] = true
+			}
+		}
+	}
+	configColumns := make([]string, 0)
+	for columnName := range state.columnMasks {
+		configColumns = append(configColumns, columnName)
+	}
+	sort.Strings(configColumns)
+	for _, columnName := range configColumns {
+		if !maskedColumns[columnName] {
+			gplog.Fatal(errors.Errorf("Column %s in --masking-config is not a column of a table whose data is included in the backup", columnName), "")
+		}
+	}
 }
 
 func ValidateSchemasExist(connectionPool *dbconn.DBConn, schemaList []string, excludeSet bool) {
@@ -52,7 +188,7 @@ func ValidateTablesExist(conn *dbconn.DBConn, tableList []string, excludeSet boo
 		return
 	}
 
-	quotedIncludeRelations, err := options.QuoteTableNames(connectionPool, tableList)
+	quotedIncludeRelations, err := options.QuoteTableNames(state.connectionPool, tableList)
 	gplog.FatalOnError(err)
 	// todo perhaps store quoted list in options??
 
@@ -91,16 +227,46 @@ func ValidateTablesExist(conn *dbconn.DBConn, tableList []string, excludeSet boo
 	}
 }
 
+/*
+ * Sets the flags given in the --config file, which must be done before any
+ * other flags are validated, and checks that the required flags were set on
+ * the command line or in the file.
+ */
+func applyConfigFile(flags *pflag.FlagSet) error {
+	err := options.ApplyConfigFile(flags)
+	if err != nil {
+		return err
+	}
+	if !flags.Changed(options.DBNAME) {
+		return errors.Errorf("The --%s flag must be set", options.DBNAME)
+	}
+	return nil
+}
+
 func validateFlagCombinations(flags *pflag.FlagSet) {
 	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.METADATA_ONLY, options.INCREMENTAL)
-	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
-	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE)
-	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE)
+	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_SCHEMA_PATTERN, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.INCLUDE_RELATION_PATTERN)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_SCHEMA_PATTERN, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_FILE, options.INCLUDE_SCHEMA_PATTERN)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_FILE, options.EXCLUDE_SCHEMA_PATTERN, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE, options.EXCLUDE_RELATION_PATTERN, options.INCLUDE_RELATION_PATTERN)
 	options.CheckExclusiveFlags(flags, options.JOBS, options.METADATA_ONLY, options.SINGLE_DATA_FILE)
 	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.LEAF_PARTITION_DATA)
 	options.CheckExclusiveFlags(flags, options.NO_COMPRESSION, options.COMPRESSION_LEVEL)
-	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.INCLUDE_OBJECT_TYPE, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.INCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.TABLE_PREDICATE_FILE)
+	options.CheckExclusiveFlags(flags, options.INCREMENTAL, options.TABLE_PREDICATE_FILE)
+	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.MASKING_CONFIG)
+	options.CheckExclusiveFlags(flags, options.INCREMENTAL, options.MASKING_CONFIG)
+	// Statistics contain sample values from each column, which would leak the unmasked data
+	options.CheckExclusiveFlags(flags, options.WITH_STATS, options.MASKING_CONFIG)
+	if MustGetFlagString(options.SCHEDULE) != "" {
+		gplog.Fatal(errors.Errorf("--%s must be specified with --%s", options.DAEMON, options.SCHEDULE), "")
+	}
+	if len(MustGetFlagStringArray(options.COPY_PLUGIN_CONFIG)) > 0 && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		gplog.Fatal(errors.Errorf("--%s must be specified with --%s", options.PLUGIN_CONFIG, options.COPY_PLUGIN_CONFIG), "")
+	}
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !MustGetFlagBool(options.INCREMENTAL) {
 		gplog.Fatal(errors.Errorf("--from-timestamp must be specified with --incremental"), "")
 	}
@@ -114,24 +280,43 @@ func validateFlagValues() {
 	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
+	for _, copyPluginConfig := range MustGetFlagStringArray(options.COPY_PLUGIN_CONFIG) {
+		err = utils.ValidateFullPath(copyPluginConfig)
+		gplog.FatalOnError(err)
+	}
 	err = utils.ValidateCompressionLevel(MustGetFlagInt(options.COMPRESSION_LEVEL))
 	gplog.FatalOnError(err)
+	err = utils.ValidateTimeout(options.TIMEOUT, MustGetFlagInt(options.TIMEOUT))
+	gplog.FatalOnError(err)
+	err = utils.ValidateTimeout(options.COPY_TIMEOUT, MustGetFlagInt(options.COPY_TIMEOUT))
+	gplog.FatalOnError(err)
 	if MustGetFlagString(options.FROM_TIMESTAMP) != "" && !filepath.IsValidTimestamp(MustGetFlagString(options.FROM_TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.",
 			MustGetFlagString(options.FROM_TIMESTAMP)), "")
 	}
+	format := MustGetFlagString(options.FORMAT)
+	if format != options.FORMAT_DIRECTORY && format != options.FORMAT_PLAIN {
+		gplog.Fatal(errors.Errorf("Invalid format %s.  Valid formats are %s and %s.", format, options.FORMAT_DIRECTORY, options.FORMAT_PLAIN), "")
+	}
+	if format == options.FORMAT_PLAIN {
+		for _, flag := range []string{options.SINGLE_DATA_FILE, options.INCREMENTAL, options.WITH_STATS} {
+			if MustGetFlagBool(flag) {
+				gplog.Fatal(errors.Errorf("--%s cannot be used with --format %s", flag, options.FORMAT_PLAIN), "")
+			}
+		}
+	}
 }
 
 func validateFromTimestamp(fromTimestamp string) {
-	fromTimestampFPInfo := filepath.NewFilePathInfo(globalCluster, globalFPInfo.UserSpecifiedBackupDir,
-		fromTimestamp, globalFPInfo.UserSpecifiedSegPrefix)
+	fromTimestampFPInfo := filepath.NewFilePathInfo(state.globalCluster, state.globalFPInfo.UserSpecifiedBackupDir,
+		fromTimestamp, state.globalFPInfo.UserSpecifiedSegPrefix)
 	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		// The config file needs to be downloaded from the remote system into the local filesystem
-		pluginConfig.MustRestoreFile(fromTimestampFPInfo.GetConfigFilePath())
+		state.pluginConfig.MustRestoreFile(fromTimestampFPInfo.GetConfigFilePath())
 	}
 	fromBackupConfig := history.ReadConfigFile(fromTimestampFPInfo.GetConfigFilePath())
 
-	if !matchesIncrementalFlags(fromBackupConfig, &backupReport.BackupConfig) {
+	if !matchesIncrementalFlags(fromBackupConfig, &state.backupReport.BackupConfig) {
 		gplog.Fatal(errors.Errorf("The flags of the backup with timestamp = %s does not match "+
 			"that of the current one. Please refer to the report to view the flags supplied for the"+
 			"previous backup.", fromTimestampFPInfo.Timestamp), "")
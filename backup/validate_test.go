@@ -1,10 +1,13 @@
 package backup_test
 
 import (
+	"regexp"
+
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
 )
@@ -14,6 +17,58 @@ var _ = Describe("backup/validate tests", func() {
 	AfterEach(func() {
 		filterList = []string{}
 	})
+	Describe("ValidateTablesCopiedByQuery", func() {
+		partitionTable := backup.Table{Relation: backup.Relation{Oid: 1, Schema: "public", Name: "sales"}, TableDefinition: backup.TableDefinition{PartitionLevelInfo: backup.PartitionLevelInfo{Level: "p"}}}
+		otherTable := backup.Table{Relation: backup.Relation{Oid: 2, Schema: "public", Name: "orders"}}
+		BeforeEach(func() {
+			testhelper.SetDBVersion(connectionPool, "6.0.0")
+		})
+		AfterEach(func() {
+			backup.SetTablePredicates(nil)
+			backup.SetColumnMasks(nil)
+		})
+		It("passes without predicates or masks, without querying the partitions", func() {
+			backup.ValidateTablesCopiedByQuery(connectionPool, []backup.Table{partitionTable})
+		})
+		It("passes if the partition tables with external partitions have no predicate or masks", func() {
+			backup.SetTablePredicates(map[string]string{"public.orders": "id > 1"})
+			mock.ExpectQuery("SELECT DISTINCT pp.parrelid").WillReturnRows(sqlmock.NewRows([]string{"oid"}).AddRow(1))
+			backup.ValidateTablesCopiedByQuery(connectionPool, []backup.Table{partitionTable, otherTable})
+		})
+		It("panics if a partition table with external partitions has a predicate", func() {
+			backup.SetTablePredicates(map[string]string{"public.sales": "id > 1"})
+			mock.ExpectQuery("SELECT DISTINCT pp.parrelid").WillReturnRows(sqlmock.NewRows([]string{"oid"}).AddRow(1))
+			defer testhelper.ShouldPanicWithMessage("Cannot use a table predicate or masked columns for table public.sales, which has external partitions.  Use --leaf-partition-data to back up its leaf partitions separately.")
+			backup.ValidateTablesCopiedByQuery(connectionPool, []backup.Table{partitionTable, otherTable})
+		})
+	})
+	Describe("ValidateColumnMasks", func() {
+		table := backup.Table{Relation: backup.Relation{Schema: "public", Name: "users"}, TableDefinition: backup.TableDefinition{ColumnDefs: []backup.ColumnDefinition{
+			{Name: "id", Type: "integer"}, {Name: "salary", Type: "numeric(10,2)"}, {Name: "email", Type: "text"}}}}
+		AfterEach(func() {
+			backup.SetColumnMasks(nil)
+		})
+		It("passes if a fixed value can be cast to the type of its column", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.users.id": {Method: options.MASK_FIXED, Value: "0"}})
+			mock.ExpectExec(regexp.QuoteMeta("SELECT '0'::integer")).WillReturnResult(sqlmock.NewResult(0, 1))
+			backup.ValidateColumnMasks([]backup.Table{table})
+		})
+		It("panics if a fixed value cannot be cast to the type of its column", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.users.id": {Method: options.MASK_FIXED, Value: "none"}})
+			mock.ExpectExec(regexp.QuoteMeta("SELECT 'none'::integer")).WillReturnError(errors.New("invalid input syntax for integer"))
+			defer testhelper.ShouldPanicWithMessage("Cannot use fixed value none for column public.users.id of type integer: invalid input syntax for integer")
+			backup.ValidateColumnMasks([]backup.Table{table})
+		})
+		It("passes if a numeric column is faked", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.users.salary": {Method: options.MASK_FAKE}})
+			backup.ValidateColumnMasks([]backup.Table{table})
+		})
+		It("panics if an integer column is faked", func() {
+			backup.SetColumnMasks(map[string]options.ColumnMask{"public.users.id": {Method: options.MASK_FAKE}})
+			defer testhelper.ShouldPanicWithMessage("Cannot use masking method fake for column public.users.id of type integer.  Only text and numeric columns can be faked.")
+			backup.ValidateColumnMasks([]backup.Table{table})
+		})
+	})
 	Describe("ValidateSchemasExist", func() {
 		It("passes if there are no filter schemas", func() {
 			backup.ValidateSchemasExist(connectionPool, filterList, false)
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path"
 	"reflect"
+	"sort"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -11,6 +12,7 @@ import (
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/nightlyone/lockfile"
 	"github.com/pkg/errors"
@@ -38,25 +40,25 @@ func SetLoggerVerbosity() {
 }
 
 func initializeConnectionPool(timestamp string) {
-	connectionPool = dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
-	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
-	utils.ValidateGPDBVersionCompatibility(connectionPool)
-	InitializeMetadataParams(connectionPool)
-	for connNum := 0; connNum < connectionPool.NumConns; connNum++ {
-		connectionPool.MustExec(fmt.Sprintf("SET application_name TO 'gpbackup_%s'", timestamp), connNum)
+	state.connectionPool = dbconn.NewDBConnFromEnvironment(MustGetFlagString(options.DBNAME))
+	state.connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
+	utils.ValidateGPDBVersionCompatibility(state.connectionPool)
+	InitializeMetadataParams(state.connectionPool)
+	for connNum := 0; connNum < state.connectionPool.NumConns; connNum++ {
+		state.connectionPool.MustExec(fmt.Sprintf("SET application_name TO 'gpbackup_%s'", timestamp), connNum)
 		// BEGIN TRANSACTION
-		connectionPool.MustBegin(connNum)
+		state.connectionPool.MustBegin(connNum)
 		SetSessionGUCs(connNum)
 	}
 }
 
 func SetSessionGUCs(connNum int) {
 	// These GUCs ensure the dumps portability accross systems
-	connectionPool.MustExec("SET search_path TO pg_catalog", connNum)
-	connectionPool.MustExec("SET statement_timeout = 0", connNum)
-	connectionPool.MustExec("SET DATESTYLE = ISO", connNum)
-	connectionPool.MustExec("SET standard_conforming_strings = 1", connNum) // Needed for 4.3, default on in 5+
-	connectionPool.MustExec("SET enable_mergejoin TO off", connNum)
+	state.connectionPool.MustExec("SET search_path TO pg_catalog", connNum)
+	state.connectionPool.MustExec("SET statement_timeout = 0", connNum)
+	state.connectionPool.MustExec("SET DATESTYLE = ISO", connNum)
+	state.connectionPool.MustExec("SET standard_conforming_strings = 1", connNum) // Needed for 4.3, default on in 5+
+	state.connectionPool.MustExec("SET enable_mergejoin TO off", connNum)
 
 	// The fix to raise the max of extra_float_digits GUC is going out with
 	// GPDB 4.3.33.1. This means if we set the GUC using 'SET
@@ -64,35 +66,49 @@ func SetSessionGUCs(connNum int) {
 	// our Semver package only allows up to 3 digits. To avoid any complicated
 	// version diffs of setting this GUC, we use set_config() with a subquery
 	// getting the max value of the GUC.
-	connectionPool.MustExec("SELECT set_config('extra_float_digits', (SELECT max_val FROM pg_settings WHERE name = 'extra_float_digits'), false)", connNum)
+	state.connectionPool.MustExec("SELECT set_config('extra_float_digits', (SELECT max_val FROM pg_settings WHERE name = 'extra_float_digits'), false)", connNum)
 
-	if connectionPool.Version.AtLeast("5") {
-		connectionPool.MustExec("SET synchronize_seqscans TO off", connNum)
+	if state.connectionPool.Version.AtLeast("5") {
+		state.connectionPool.MustExec("SET synchronize_seqscans TO off", connNum)
 	}
-	if connectionPool.Version.AtLeast("6") {
-		connectionPool.MustExec("SET INTERVALSTYLE = POSTGRES", connNum)
-		connectionPool.MustExec("SET lock_timeout = 0", connNum)
+	if state.connectionPool.Version.AtLeast("6") {
+		state.connectionPool.MustExec("SET INTERVALSTYLE = POSTGRES", connNum)
+		state.connectionPool.MustExec("SET lock_timeout = 0", connNum)
 	}
 }
 
+/*
+ * Records the flags of the backup for its config.  Setup replaces
+ * --plugin-config with the path of a temporary copy and adds the tables its
+ * filters expand to, so this must be called before either.
+ */
+func RecordFlagValues() {
+	state.flagValues = options.GetFlagValues(state.cmdFlags)
+}
+
 func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plugin string, timestamp string, opts options.Options) *history.BackupConfig {
 	backupConfig := history.BackupConfig{
 		BackupDir:             MustGetFlagString(options.BACKUP_DIR),
 		BackupVersion:         backupVersion,
-		Compressed:            !MustGetFlagBool(options.NO_COMPRESSION),
+		Compressed:            !MustGetFlagBool(options.NO_COMPRESSION) && MustGetFlagString(options.FORMAT) != options.FORMAT_PLAIN,
 		DatabaseName:          dbName,
 		DatabaseVersion:       dbVersion,
 		DataOnly:              MustGetFlagBool(options.DATA_ONLY),
+		DataSubset:            len(opts.GetTablePredicates()) > 0,
+		ExcludeObjectTypes:    opts.GetExcludedObjectTypes(),
 		ExcludeRelations:      MustGetFlagStringArray(options.EXCLUDE_RELATION),
 		ExcludeSchemaFiltered: len(MustGetFlagStringArray(options.EXCLUDE_SCHEMA)) > 0,
 		ExcludeSchemas:        MustGetFlagStringArray(options.EXCLUDE_SCHEMA),
 		ExcludeTableFiltered:  len(MustGetFlagStringArray(options.EXCLUDE_RELATION)) > 0,
+		Format:                MustGetFlagString(options.FORMAT),
+		IncludeObjectTypes:    opts.GetIncludedObjectTypes(),
 		IncludeRelations:      opts.GetOriginalIncludedTables(),
 		IncludeSchemaFiltered: len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) > 0,
 		IncludeSchemas:        MustGetFlagStringArray(options.INCLUDE_SCHEMA),
 		IncludeTableFiltered:  len(opts.GetOriginalIncludedTables()) > 0,
 		Incremental:           MustGetFlagBool(options.INCREMENTAL),
 		LeafPartitionData:     MustGetFlagBool(options.LEAF_PARTITION_DATA),
+		MaskedColumns:         getMaskedColumnNames(opts),
 		MetadataOnly:          MustGetFlagBool(options.METADATA_ONLY),
 		Plugin:                plugin,
 		SingleDataFile:        MustGetFlagBool(options.SINGLE_DATA_FILE),
@@ -100,89 +116,192 @@ func NewBackupConfig(dbName string, dbVersion string, backupVersion string, plug
 		WithoutGlobals:        MustGetFlagBool(options.WITHOUT_GLOBALS),
 		WithStatistics:        MustGetFlagBool(options.WITH_STATS),
 		Status:                history.BackupStatusFailed,
+		Flags:                 state.flagValues,
 	}
 
 	return &backupConfig
 }
 
+func getMaskedColumnNames(opts options.Options) []string {
+	maskedColumns := make([]string, 0)
+	for columnName := range opts.GetColumnMasks() {
+		maskedColumns = append(maskedColumns, columnName)
+	}
+	sort.Strings(maskedColumns)
+	return maskedColumns
+}
+
 func initializeBackupReport(opts options.Options) {
-	escapedDBName := dbconn.MustSelectString(connectionPool, fmt.Sprintf("select quote_ident(datname) AS string FROM pg_database where datname='%s'", utils.EscapeSingleQuotes(connectionPool.DBName)))
+	escapedDBName := dbconn.MustSelectString(state.connectionPool, fmt.Sprintf("select quote_ident(datname) AS string FROM pg_database where datname='%s'", utils.EscapeSingleQuotes(state.connectionPool.DBName)))
 	plugin := ""
-	if pluginConfig != nil {
-		_, plugin = path.Split(pluginConfig.ExecutablePath)
+	if state.pluginConfig != nil {
+		// A backup with several destinations is recorded as taken with the plugin given by --plugin-config
+		primaryPluginConfig := state.pluginConfig
+		if copies := state.pluginConfig.Copies(); len(copies) > 0 {
+			primaryPluginConfig = copies[0]
+		}
+		_, plugin = path.Split(primaryPluginConfig.ExecutablePath)
 	}
-	config := NewBackupConfig(escapedDBName, connectionPool.Version.VersionString, version,
-		plugin, globalFPInfo.Timestamp, opts)
+	config := NewBackupConfig(escapedDBName, state.connectionPool.Version.VersionString, version,
+		plugin, state.globalFPInfo.Timestamp, opts)
 
 	isFilteredBackup := config.IncludeTableFiltered || config.IncludeSchemaFiltered ||
-		config.ExcludeTableFiltered || config.ExcludeSchemaFiltered
+		config.ExcludeTableFiltered || config.ExcludeSchemaFiltered || config.DataSubset
 	dbSize := ""
 	if !MustGetFlagBool(options.METADATA_ONLY) && !isFilteredBackup {
 		gplog.Verbose("Getting database size")
 		//Potentially expensive query
-		dbSize = GetDBSize(connectionPool)
+		dbSize = GetDBSize(state.connectionPool)
 	}
 
-	backupReport = &report.Report{
+	state.backupReport = &report.Report{
 		DatabaseSize: dbSize,
 		BackupConfig: *config,
 	}
-	backupReport.ConstructBackupParamsString()
+	state.backupReport.ConstructBackupParamsString()
 }
 
 func createBackupLockFile(timestamp string) {
-	var err error
 	timestampLockFile := fmt.Sprintf("/tmp/%s.lck", timestamp)
-	backupLockFile, err = lockfile.New(timestampLockFile)
+	state.backupLockFile = mustLockFile(timestampLockFile, fmt.Sprintf("A backup with timestamp %s is already in progress. Wait 1 second and try the backup again.", timestamp))
+}
+
+// Locks the given lock file, or exits with the given message if another process holds it
+func mustLockFile(filename string, inUseMessage string) lockfile.Lockfile {
+	lock, err := lockfile.New(filename)
 	gplog.FatalOnError(err)
-	err = backupLockFile.TryLock()
+	err = lock.TryLock()
 	if err != nil {
 		gplog.Error(err.Error())
-		gplog.Fatal(errors.Errorf("A backup with timestamp %s is already in progress. Wait 1 second and try the backup again.", timestamp), "")
+		gplog.Fatal(errors.New(inUseMessage), "")
 	}
+	return lock
 }
 
 func createBackupDirectoriesOnAllHosts() {
-	remoteOutput := globalCluster.GenerateAndExecuteCommand("Creating backup directories",
+	remoteOutput := state.globalCluster.GenerateAndExecuteCommand("Creating backup directories",
 		cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER,
 		func(contentID int) string {
-			return fmt.Sprintf("mkdir -p %s", globalFPInfo.GetDirForContent(contentID))
+			return fmt.Sprintf("mkdir -p %s", state.globalFPInfo.GetDirForContent(contentID))
 		})
-	globalCluster.CheckClusterError(remoteOutput, "Unable to create backup directories", func(contentID int) string {
-		return fmt.Sprintf("Unable to create backup directory %s", globalFPInfo.GetDirForContent(contentID))
+	state.globalCluster.CheckClusterError(remoteOutput, "Unable to create backup directories", func(contentID int) string {
+		return fmt.Sprintf("Unable to create backup directory %s", state.globalFPInfo.GetDirForContent(contentID))
 	})
 }
 
+/*
+ * A backup given a --backup-dir along with --plugin-config, or given any
+ * --copy-plugin-config, is copied to each of those destinations by the
+ * built-in storage copies.
+ */
+func readPluginConfigs(pluginConfigFile string) *utils.PluginConfig {
+	config, err := utils.ReadPluginConfig(pluginConfigFile)
+	gplog.FatalOnError(err)
+	copyPluginConfigFiles := MustGetFlagStringArray(options.COPY_PLUGIN_CONFIG)
+	localCopy := MustGetFlagString(options.BACKUP_DIR) != ""
+	if len(copyPluginConfigFiles) == 0 && !localCopy {
+		return config
+	}
+	copies := []*utils.PluginConfig{config}
+	for _, copyPluginConfigFile := range copyPluginConfigFiles {
+		copyConfig, err := utils.ReadPluginConfig(copyPluginConfigFile)
+		gplog.FatalOnError(err)
+		copies = append(copies, copyConfig)
+	}
+	config, err = utils.NewCopiesPluginConfig(copies, localCopy)
+	gplog.FatalOnError(err)
+	return config
+}
+
+func getBackupCopies() []history.BackupCopy {
+	destinations := state.pluginConfig.CopyDestinations()
+	copies := make([]history.BackupCopy, len(destinations))
+	for i, destination := range destinations {
+		copies[i].Status = history.BackupStatusSucceed
+		if destination.Plugin == nil {
+			copies[i].BackupDir = state.globalFPInfo.UserSpecifiedBackupDir
+		} else {
+			_, copies[i].Plugin = path.Split(destination.Plugin.ExecutablePath)
+			copies[i].Destination = destination.Plugin.Destination()
+		}
+	}
+	return copies
+}
+
+func recordCopyStatuses() {
+	failures := state.pluginConfig.CollectCopyFailures(state.globalCluster, state.globalFPInfo)
+	for i := range state.backupReport.Copies {
+		if failure, failed := failures[i]; failed {
+			state.backupReport.Copies[i].Status = history.BackupStatusFailed
+			gplog.Warn("The copy of the backup with %s failed: %s", state.backupReport.Copies[i], failure)
+		}
+	}
+}
+
 /*
  * Metadata retrieval wrapper functions
  */
 
 func RetrieveAndProcessTables() ([]Table, []Table) {
-	quotedIncludeRelations, err := options.QuoteTableNames(connectionPool, MustGetFlagStringArray(options.INCLUDE_RELATION))
+	quotedIncludeRelations, err := options.QuoteTableNames(state.connectionPool, MustGetFlagStringArray(options.INCLUDE_RELATION))
 	gplog.FatalOnError(err)
 
-	tableRelations := GetIncludedUserTableRelations(connectionPool, quotedIncludeRelations)
-	LockTables(connectionPool, tableRelations)
+	tableRelations := GetIncludedUserTableRelations(state.connectionPool, quotedIncludeRelations)
+	LockTables(state.connectionPool, tableRelations)
 
-	if connectionPool.Version.AtLeast("6") {
-		tableRelations = append(tableRelations, GetForeignTableRelations(connectionPool)...)
+	if state.connectionPool.Version.AtLeast("6") {
+		tableRelations = append(tableRelations, GetForeignTableRelations(state.connectionPool)...)
 	}
 
-	tables := ConstructDefinitionsForTables(connectionPool, tableRelations)
+	tables := ConstructDefinitionsForTables(state.connectionPool, tableRelations)
 
 	metadataTables, dataTables := SplitTablesByPartitionType(tables, quotedIncludeRelations)
-	objectCounts["Tables"] = len(metadataTables)
+	state.objectCounts["Tables"] = len(metadataTables)
+
+	return metadataTables, filterDataTablesByObjectType(dataTables)
+}
+
+/*
+ * The data of a table filtered out with --include-object-type or
+ * --exclude-object-type could not be restored without the table's DDL, so it
+ * is not backed up either.
+ */
+func filterDataTablesByObjectType(dataTables []Table) []Table {
+	filteredTables := make([]Table, 0, len(dataTables))
+	for _, table := range dataTables {
+		if _, entry := table.GetMetadataEntry(); shouldBackupObjectType(entry.ObjectType) {
+			filteredTables = append(filteredTables, table)
+		} else {
+			gplog.Verbose("Skipping data backup of %s, as %s is filtered out by object type", table.FQN(), entry.ObjectType)
+		}
+	}
+	return filteredTables
+}
+
+/*
+ * Returns false if the user has filtered out objectType with
+ * --include-object-type or --exclude-object-type.
+ */
+func shouldBackupObjectType(objectType string) bool {
+	return state.objectTypeSet == nil || state.objectTypeSet.MatchesFilter(objectType)
+}
 
-	return metadataTables, dataTables
+// Also checks the ACL, COMMENT, OWNER, and SECURITY LABEL pseudo types of the statement
+func shouldBackupStatement(objectType string, statement string) bool {
+	return state.objectTypeSet == nil || toc.ShouldIncludeObjectType(state.objectTypeSet, objectType, statement)
 }
 
 func retrieveFunctions(sortables *[]Sortable, metadataMap MetadataMap) ([]Function, map[uint32]FunctionInfo) {
 	gplog.Verbose("Retrieving function information")
-	functionMetadata := GetMetadataForObjectType(connectionPool, TYPE_FUNCTION)
+	// Function information is needed by other object types even if functions are not backed up
+	funcInfoMap := GetFunctionOidToInfoMap(state.connectionPool)
+	if !shouldBackupObjectType("FUNCTION") {
+		return []Function{}, funcInfoMap
+	}
+	functionMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_FUNCTION)
 	addToMetadataMap(functionMetadata, metadataMap)
-	functions := GetFunctionsAllVersions(connectionPool)
-	funcInfoMap := GetFunctionOidToInfoMap(connectionPool)
-	objectCounts["Functions"] = len(functions)
+	functions := GetFunctionsAllVersions(state.connectionPool)
+	state.objectCounts["Functions"] = len(functions)
 	*sortables = append(*sortables, convertToSortableSlice(functions)...)
 
 	return functions, funcInfoMap
@@ -190,26 +309,34 @@ func retrieveFunctions(sortables *[]Sortable, metadataMap MetadataMap) ([]Functi
 
 func retrieveAndBackupTypes(metadataFile *utils.FileWithByteCount, sortables *[]Sortable, metadataMap MetadataMap) {
 	gplog.Verbose("Retrieving type information")
-	shells := GetShellTypes(connectionPool)
-	bases := GetBaseTypes(connectionPool)
-	composites := GetCompositeTypes(connectionPool)
-	domains := GetDomainTypes(connectionPool)
+	shells := make([]ShellType, 0)
+	bases := make([]BaseType, 0)
+	composites := make([]CompositeType, 0)
+	domains := make([]Domain, 0)
 	rangeTypes := make([]RangeType, 0)
-	if connectionPool.Version.AtLeast("6") {
-		rangeTypes = GetRangeTypes(connectionPool)
+	if shouldBackupObjectType("TYPE") {
+		shells = GetShellTypes(state.connectionPool)
+		bases = GetBaseTypes(state.connectionPool)
+		composites = GetCompositeTypes(state.connectionPool)
+		if state.connectionPool.Version.AtLeast("6") {
+			rangeTypes = GetRangeTypes(state.connectionPool)
+		}
 	}
-	typeMetadata := GetMetadataForObjectType(connectionPool, TYPE_TYPE)
+	if shouldBackupObjectType("DOMAIN") {
+		domains = GetDomainTypes(state.connectionPool)
+	}
+	typeMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_TYPE)
 
 	backupShellTypes(metadataFile, shells, bases, rangeTypes)
-	if connectionPool.Version.AtLeast("5") {
+	if state.connectionPool.Version.AtLeast("5") && shouldBackupObjectType("TYPE") {
 		backupEnumTypes(metadataFile, typeMetadata)
 	}
 
-	objectCounts["Types"] += len(shells)
-	objectCounts["Types"] += len(bases)
-	objectCounts["Types"] += len(composites)
-	objectCounts["Types"] += len(domains)
-	objectCounts["Types"] += len(rangeTypes)
+	state.objectCounts["Types"] += len(shells)
+	state.objectCounts["Types"] += len(bases)
+	state.objectCounts["Types"] += len(composites)
+	state.objectCounts["Types"] += len(domains)
+	state.objectCounts["Types"] += len(rangeTypes)
 	*sortables = append(*sortables, convertToSortableSlice(bases)...)
 	*sortables = append(*sortables, convertToSortableSlice(composites)...)
 	*sortables = append(*sortables, convertToSortableSlice(domains)...)
@@ -217,27 +344,34 @@ func retrieveAndBackupTypes(metadataFile *utils.FileWithByteCount, sortables *[]
 	addToMetadataMap(typeMetadata, metadataMap)
 }
 
+// Constraints are always retrieved, as domain constraints are printed along with their domains
 func retrieveConstraints(tables ...Relation) ([]Constraint, MetadataMap) {
 	gplog.Verbose("Retrieving constraints")
-	constraints := GetConstraints(connectionPool, tables...)
-	conMetadata := GetCommentsForObjectType(connectionPool, TYPE_CONSTRAINT)
+	constraints := GetConstraints(state.connectionPool, tables...)
+	conMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_CONSTRAINT)
 	return constraints, conMetadata
 }
 
 func retrieveAndBackupSequences(metadataFile *utils.FileWithByteCount,
 	relationMetadata MetadataMap) []Sequence {
+	if !shouldBackupObjectType("SEQUENCE") {
+		return []Sequence{}
+	}
 	gplog.Verbose("Writing CREATE SEQUENCE statements to metadata file")
-	sequences := GetAllSequences(connectionPool)
-	objectCounts["Sequences"] = len(sequences)
-	PrintCreateSequenceStatements(metadataFile, globalTOC, sequences, relationMetadata)
+	sequences := GetAllSequences(state.connectionPool)
+	state.objectCounts["Sequences"] = len(sequences)
+	PrintCreateSequenceStatements(metadataFile, state.globalTOC, sequences, relationMetadata)
 	return sequences
 }
 
 func retrieveProtocols(sortables *[]Sortable, metadataMap MetadataMap) []ExternalProtocol {
+	if !shouldBackupObjectType("PROTOCOL") {
+		return []ExternalProtocol{}
+	}
 	gplog.Verbose("Retrieving protocols")
-	protocols := GetExternalProtocols(connectionPool)
-	objectCounts["Protocols"] = len(protocols)
-	protoMetadata := GetMetadataForObjectType(connectionPool, TYPE_PROTOCOL)
+	protocols := GetExternalProtocols(state.connectionPool)
+	state.objectCounts["Protocols"] = len(protocols)
+	protoMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_PROTOCOL)
 
 	*sortables = append(*sortables, convertToSortableSlice(protocols)...)
 	addToMetadataMap(protoMetadata, metadataMap)
@@ -247,14 +381,19 @@ func retrieveProtocols(sortables *[]Sortable, metadataMap MetadataMap) []Externa
 
 func retrieveViews(sortables *[]Sortable) {
 	gplog.Verbose("Retrieving views")
-	views := GetAllViews(connectionPool)
-	objectCounts["Views"] = len(views)
+	views := make([]View, 0)
+	for _, view := range GetAllViews(state.connectionPool) {
+		if shouldBackupObjectType(view.ObjectType()) {
+			views = append(views, view)
+		}
+	}
+	state.objectCounts["Views"] = len(views)
 
 	*sortables = append(*sortables, convertToSortableSlice(views)...)
 }
 
 func retrieveTSObjects(sortables *[]Sortable, metadataMap MetadataMap) {
-	if !connectionPool.Version.AtLeast("5") {
+	if !state.connectionPool.Version.AtLeast("5") {
 		return
 	}
 	gplog.Verbose("Retrieving Text Search Parsers")
@@ -265,40 +404,52 @@ func retrieveTSObjects(sortables *[]Sortable, metadataMap MetadataMap) {
 }
 
 func retrieveTSParsers(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("TEXT SEARCH PARSER") {
+		return
+	}
 	gplog.Verbose("Retrieving Text Search Parsers")
-	parsers := GetTextSearchParsers(connectionPool)
-	objectCounts["Text Search Parsers"] = len(parsers)
-	parserMetadata := GetCommentsForObjectType(connectionPool, TYPE_TSPARSER)
+	parsers := GetTextSearchParsers(state.connectionPool)
+	state.objectCounts["Text Search Parsers"] = len(parsers)
+	parserMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_TSPARSER)
 
 	*sortables = append(*sortables, convertToSortableSlice(parsers)...)
 	addToMetadataMap(parserMetadata, metadataMap)
 }
 
 func retrieveTSTemplates(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("TEXT SEARCH TEMPLATE") {
+		return
+	}
 	gplog.Verbose("Retrieving TEXT SEARCH TEMPLATE information")
-	templates := GetTextSearchTemplates(connectionPool)
-	objectCounts["Text Search Templates"] = len(templates)
-	templateMetadata := GetCommentsForObjectType(connectionPool, TYPE_TSTEMPLATE)
+	templates := GetTextSearchTemplates(state.connectionPool)
+	state.objectCounts["Text Search Templates"] = len(templates)
+	templateMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_TSTEMPLATE)
 
 	*sortables = append(*sortables, convertToSortableSlice(templates)...)
 	addToMetadataMap(templateMetadata, metadataMap)
 }
 
 func retrieveTSDictionaries(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("TEXT SEARCH DICTIONARY") {
+		return
+	}
 	gplog.Verbose("Retrieving TEXT SEARCH DICTIONARY information")
-	dictionaries := GetTextSearchDictionaries(connectionPool)
-	objectCounts["Text Search Dictionaries"] = len(dictionaries)
-	dictionaryMetadata := GetMetadataForObjectType(connectionPool, TYPE_TSDICTIONARY)
+	dictionaries := GetTextSearchDictionaries(state.connectionPool)
+	state.objectCounts["Text Search Dictionaries"] = len(dictionaries)
+	dictionaryMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_TSDICTIONARY)
 
 	*sortables = append(*sortables, convertToSortableSlice(dictionaries)...)
 	addToMetadataMap(dictionaryMetadata, metadataMap)
 }
 
 func retrieveTSConfigurations(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("TEXT SEARCH CONFIGURATION") {
+		return
+	}
 	gplog.Verbose("Retrieving TEXT SEARCH CONFIGURATION information")
-	configurations := GetTextSearchConfigurations(connectionPool)
-	objectCounts["Text Search Configurations"] = len(configurations)
-	configurationMetadata := GetMetadataForObjectType(connectionPool, TYPE_TSCONFIGURATION)
+	configurations := GetTextSearchConfigurations(state.connectionPool)
+	state.objectCounts["Text Search Configurations"] = len(configurations)
+	configurationMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_TSCONFIGURATION)
 
 	*sortables = append(*sortables, convertToSortableSlice(configurations)...)
 	addToMetadataMap(configurationMetadata, metadataMap)
@@ -310,47 +461,59 @@ func retrieveOperatorObjects(sortables *[]Sortable, metadataMap MetadataMap) {
 }
 
 func retrieveOperators(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("OPERATOR") {
+		return
+	}
 	gplog.Verbose("Retrieving OPERATOR information")
-	operators := GetOperators(connectionPool)
-	objectCounts["Operators"] = len(operators)
-	operatorMetadata := GetMetadataForObjectType(connectionPool, TYPE_OPERATOR)
+	operators := GetOperators(state.connectionPool)
+	state.objectCounts["Operators"] = len(operators)
+	operatorMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_OPERATOR)
 
 	*sortables = append(*sortables, convertToSortableSlice(operators)...)
 	addToMetadataMap(operatorMetadata, metadataMap)
 }
 
 func retrieveOperatorClasses(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("OPERATOR CLASS") {
+		return
+	}
 	gplog.Verbose("Retrieving OPERATOR CLASS information")
-	operatorClasses := GetOperatorClasses(connectionPool)
-	objectCounts["Operator Classes"] = len(operatorClasses)
-	operatorClassMetadata := GetMetadataForObjectType(connectionPool, TYPE_OPERATORCLASS)
+	operatorClasses := GetOperatorClasses(state.connectionPool)
+	state.objectCounts["Operator Classes"] = len(operatorClasses)
+	operatorClassMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_OPERATORCLASS)
 
 	*sortables = append(*sortables, convertToSortableSlice(operatorClasses)...)
 	addToMetadataMap(operatorClassMetadata, metadataMap)
 }
 
 func retrieveAggregates(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("AGGREGATE") {
+		return
+	}
 	gplog.Verbose("Retrieving AGGREGATE information")
-	aggregates := GetAggregates(connectionPool)
-	objectCounts["Aggregates"] = len(aggregates)
-	aggMetadata := GetMetadataForObjectType(connectionPool, TYPE_AGGREGATE)
+	aggregates := GetAggregates(state.connectionPool)
+	state.objectCounts["Aggregates"] = len(aggregates)
+	aggMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_AGGREGATE)
 
 	*sortables = append(*sortables, convertToSortableSlice(aggregates)...)
 	addToMetadataMap(aggMetadata, metadataMap)
 }
 
 func retrieveCasts(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("CAST") {
+		return
+	}
 	gplog.Verbose("Retrieving CAST information")
-	casts := GetCasts(connectionPool)
-	objectCounts["Casts"] = len(casts)
-	castMetadata := GetCommentsForObjectType(connectionPool, TYPE_CAST)
+	casts := GetCasts(state.connectionPool)
+	state.objectCounts["Casts"] = len(casts)
+	castMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_CAST)
 
 	*sortables = append(*sortables, convertToSortableSlice(casts)...)
 	addToMetadataMap(castMetadata, metadataMap)
 }
 
 func retrieveFDWObjects(sortables *[]Sortable, metadataMap MetadataMap) {
-	if !connectionPool.Version.AtLeast("6") {
+	if !state.connectionPool.Version.AtLeast("6") {
 		return
 	}
 	retrieveForeignDataWrappers(sortables, metadataMap)
@@ -359,29 +522,38 @@ func retrieveFDWObjects(sortables *[]Sortable, metadataMap MetadataMap) {
 }
 
 func retrieveForeignDataWrappers(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("FOREIGN DATA WRAPPER") {
+		return
+	}
 	gplog.Verbose("Writing CREATE FOREIGN DATA WRAPPER statements to metadata file")
-	wrappers := GetForeignDataWrappers(connectionPool)
-	objectCounts["Foreign Data Wrappers"] = len(wrappers)
-	fdwMetadata := GetMetadataForObjectType(connectionPool, TYPE_FOREIGNDATAWRAPPER)
+	wrappers := GetForeignDataWrappers(state.connectionPool)
+	state.objectCounts["Foreign Data Wrappers"] = len(wrappers)
+	fdwMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_FOREIGNDATAWRAPPER)
 
 	*sortables = append(*sortables, convertToSortableSlice(wrappers)...)
 	addToMetadataMap(fdwMetadata, metadataMap)
 }
 
 func retrieveForeignServers(sortables *[]Sortable, metadataMap MetadataMap) {
+	if !shouldBackupObjectType("FOREIGN SERVER") {
+		return
+	}
 	gplog.Verbose("Writing CREATE SERVER statements to metadata file")
-	servers := GetForeignServers(connectionPool)
-	objectCounts["Foreign Servers"] = len(servers)
-	serverMetadata := GetMetadataForObjectType(connectionPool, TYPE_FOREIGNSERVER)
+	servers := GetForeignServers(state.connectionPool)
+	state.objectCounts["Foreign Servers"] = len(servers)
+	serverMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_FOREIGNSERVER)
 
 	*sortables = append(*sortables, convertToSortableSlice(servers)...)
 	addToMetadataMap(serverMetadata, metadataMap)
 }
 
 func retrieveUserMappings(sortables *[]Sortable) {
+	if !shouldBackupObjectType("USER MAPPING") {
+		return
+	}
 	gplog.Verbose("Writing CREATE USER MAPPING statements to metadata file")
-	mappings := GetUserMappings(connectionPool)
-	objectCounts["User Mappings"] = len(mappings)
+	mappings := GetUserMappings(state.connectionPool)
+	state.objectCounts["User Mappings"] = len(mappings)
 	// No comments, owners, or ACLs on UserMappings so no need to get metadata
 
 	*sortables = append(*sortables, convertToSortableSlice(mappings)...)
@@ -389,8 +561,8 @@ func retrieveUserMappings(sortables *[]Sortable) {
 
 func backupSessionGUC(metadataFile *utils.FileWithByteCount) {
 	gplog.Verbose("Writing Session Configuration Parameters to metadata file")
-	gucs := GetSessionGUCs(connectionPool)
-	PrintSessionGUCs(metadataFile, globalTOC, gucs)
+	gucs := GetSessionGUCs(state.connectionPool)
+	PrintSessionGUCs(metadataFile, state.globalTOC, gucs)
 }
 
 /*
@@ -398,66 +570,87 @@ func backupSessionGUC(metadataFile *utils.FileWithByteCount) {
  */
 
 func backupTablespaces(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("TABLESPACE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE TABLESPACE statements to metadata file")
-	tablespaces := GetTablespaces(connectionPool)
-	objectCounts["Tablespaces"] = len(tablespaces)
-	tablespaceMetadata := GetMetadataForObjectType(connectionPool, TYPE_TABLESPACE)
-	PrintCreateTablespaceStatements(metadataFile, globalTOC, tablespaces, tablespaceMetadata)
+	tablespaces := GetTablespaces(state.connectionPool)
+	state.objectCounts["Tablespaces"] = len(tablespaces)
+	tablespaceMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_TABLESPACE)
+	PrintCreateTablespaceStatements(metadataFile, state.globalTOC, tablespaces, tablespaceMetadata)
 }
 
 func backupCreateDatabase(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("DATABASE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE DATABASE statement to metadata file")
-	defaultDB := GetDefaultDatabaseEncodingInfo(connectionPool)
-	db := GetDatabaseInfo(connectionPool)
-	dbMetadata := GetMetadataForObjectType(connectionPool, TYPE_DATABASE)
-	PrintCreateDatabaseStatement(metadataFile, globalTOC, defaultDB, db, dbMetadata)
+	defaultDB := GetDefaultDatabaseEncodingInfo(state.connectionPool)
+	db := GetDatabaseInfo(state.connectionPool)
+	dbMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_DATABASE)
+	PrintCreateDatabaseStatement(metadataFile, state.globalTOC, defaultDB, db, dbMetadata)
 }
 
 func backupDatabaseGUCs(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("DATABASE GUC") {
+		return
+	}
 	gplog.Verbose("Writing Database Configuration Parameters to metadata file")
-	databaseGucs := GetDatabaseGUCs(connectionPool)
-	objectCounts["Database GUCs"] = len(databaseGucs)
-	PrintDatabaseGUCs(metadataFile, globalTOC, databaseGucs, connectionPool.DBName)
+	databaseGucs := GetDatabaseGUCs(state.connectionPool)
+	state.objectCounts["Database GUCs"] = len(databaseGucs)
+	PrintDatabaseGUCs(metadataFile, state.globalTOC, databaseGucs, state.connectionPool.DBName)
 }
 
 func backupResourceQueues(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("RESOURCE QUEUE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE RESOURCE QUEUE statements to metadata file")
-	resQueues := GetResourceQueues(connectionPool)
-	objectCounts["Resource Queues"] = len(resQueues)
-	resQueueMetadata := GetCommentsForObjectType(connectionPool, TYPE_RESOURCEQUEUE)
-	PrintCreateResourceQueueStatements(metadataFile, globalTOC, resQueues, resQueueMetadata)
+	resQueues := GetResourceQueues(state.connectionPool)
+	state.objectCounts["Resource Queues"] = len(resQueues)
+	resQueueMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_RESOURCEQUEUE)
+	PrintCreateResourceQueueStatements(metadataFile, state.globalTOC, resQueues, resQueueMetadata)
 }
 
 func backupResourceGroups(metadataFile *utils.FileWithByteCount) {
-	if !connectionPool.Version.AtLeast("5") {
+	if !state.connectionPool.Version.AtLeast("5") || !shouldBackupObjectType("RESOURCE GROUP") {
 		return
 	}
 	gplog.Verbose("Writing CREATE RESOURCE GROUP statements to metadata file")
-	resGroups := GetResourceGroups(connectionPool)
-	objectCounts["Resource Groups"] = len(resGroups)
-	resGroupMetadata := GetCommentsForObjectType(connectionPool, TYPE_RESOURCEGROUP)
-	PrintResetResourceGroupStatements(metadataFile, globalTOC)
-	PrintCreateResourceGroupStatements(metadataFile, globalTOC, resGroups, resGroupMetadata)
+	resGroups := GetResourceGroups(state.connectionPool)
+	state.objectCounts["Resource Groups"] = len(resGroups)
+	resGroupMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_RESOURCEGROUP)
+	PrintResetResourceGroupStatements(metadataFile, state.globalTOC)
+	PrintCreateResourceGroupStatements(metadataFile, state.globalTOC, resGroups, resGroupMetadata)
 }
 
 func backupRoles(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("ROLE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE ROLE statements to metadata file")
-	roles := GetRoles(connectionPool)
-	objectCounts["Roles"] = len(roles)
-	roleMetadata := GetMetadataForObjectType(connectionPool, TYPE_ROLE)
-	PrintCreateRoleStatements(metadataFile, globalTOC, roles, roleMetadata)
+	roles := GetRoles(state.connectionPool)
+	state.objectCounts["Roles"] = len(roles)
+	roleMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_ROLE)
+	PrintCreateRoleStatements(metadataFile, state.globalTOC, roles, roleMetadata)
 }
 
 func backupRoleGUCs(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("ROLE GUCS") {
+		return
+	}
 	gplog.Verbose("Writing ROLE Configuration Parameter to meadata file")
-	roleGUCs := GetRoleGUCs(connectionPool)
-	PrintRoleGUCStatements(metadataFile, globalTOC, roleGUCs)
+	roleGUCs := GetRoleGUCs(state.connectionPool)
+	PrintRoleGUCStatements(metadataFile, state.globalTOC, roleGUCs)
 }
 
 func backupRoleGrants(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("ROLE GRANT") {
+		return
+	}
 	gplog.Verbose("Writing GRANT ROLE statements to metadata file")
-	roleMembers := GetRoleMembers(connectionPool)
-	PrintRoleMembershipStatements(metadataFile, globalTOC, roleMembers)
+	roleMembers := GetRoleMembers(state.connectionPool)
+	PrintRoleMembershipStatements(metadataFile, state.globalTOC, roleMembers)
 }
 
 /*
@@ -465,36 +658,42 @@ func backupRoleGrants(metadataFile *utils.FileWithByteCount) {
  */
 
 func backupSchemas(metadataFile *utils.FileWithByteCount, partitionAlteredSchemas map[string]bool) {
+	if !shouldBackupObjectType("SCHEMA") {
+		return
+	}
 	gplog.Verbose("Writing CREATE SCHEMA statements to metadata file")
-	schemas := GetAllUserSchemas(connectionPool, partitionAlteredSchemas)
-	objectCounts["Schemas"] = len(schemas)
-	schemaMetadata := GetMetadataForObjectType(connectionPool, TYPE_SCHEMA)
-	PrintCreateSchemaStatements(metadataFile, globalTOC, schemas, schemaMetadata)
+	schemas := GetAllUserSchemas(state.connectionPool, partitionAlteredSchemas)
+	state.objectCounts["Schemas"] = len(schemas)
+	schemaMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_SCHEMA)
+	PrintCreateSchemaStatements(metadataFile, state.globalTOC, schemas, schemaMetadata)
 }
 
 func backupProceduralLanguages(metadataFile *utils.FileWithByteCount,
 	functions []Function, funcInfoMap map[uint32]FunctionInfo, functionMetadata MetadataMap) {
+	if !shouldBackupObjectType("LANGUAGE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE PROCEDURAL LANGUAGE statements to metadata file")
-	procLangs := GetProceduralLanguages(connectionPool)
-	objectCounts["Procedural Languages"] = len(procLangs)
+	procLangs := GetProceduralLanguages(state.connectionPool)
+	state.objectCounts["Procedural Languages"] = len(procLangs)
 	langFuncs, _ := ExtractLanguageFunctions(functions, procLangs)
 	for _, langFunc := range langFuncs {
-		PrintCreateFunctionStatement(metadataFile, globalTOC, langFunc, functionMetadata[langFunc.GetUniqueID()])
+		PrintCreateFunctionStatement(metadataFile, state.globalTOC, langFunc, functionMetadata[langFunc.GetUniqueID()])
 	}
-	procLangMetadata := GetMetadataForObjectType(connectionPool, TYPE_PROCLANGUAGE)
-	PrintCreateLanguageStatements(metadataFile, globalTOC, procLangs, funcInfoMap, procLangMetadata)
+	procLangMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_PROCLANGUAGE)
+	PrintCreateLanguageStatements(metadataFile, state.globalTOC, procLangs, funcInfoMap, procLangMetadata)
 }
 
 func backupShellTypes(metadataFile *utils.FileWithByteCount, shellTypes []ShellType, baseTypes []BaseType, rangeTypes []RangeType) {
 	gplog.Verbose("Writing CREATE TYPE statements for shell types to metadata file")
-	PrintCreateShellTypeStatements(metadataFile, globalTOC, shellTypes, baseTypes, rangeTypes)
+	PrintCreateShellTypeStatements(metadataFile, state.globalTOC, shellTypes, baseTypes, rangeTypes)
 }
 
 func backupEnumTypes(metadataFile *utils.FileWithByteCount, typeMetadata MetadataMap) {
 	gplog.Verbose("Writing CREATE TYPE statements for enum types to metadata file")
-	enums := GetEnumTypes(connectionPool)
-	objectCounts["Types"] += len(enums)
-	PrintCreateEnumTypeStatements(metadataFile, globalTOC, enums, typeMetadata)
+	enums := GetEnumTypes(state.connectionPool)
+	state.objectCounts["Types"] += len(enums)
+	PrintCreateEnumTypeStatements(metadataFile, state.globalTOC, enums, typeMetadata)
 }
 
 func createBackupSet(objSlice []Sortable) (backupSet map[UniqueID]bool) {
@@ -538,67 +737,78 @@ func backupDependentObjects(metadataFile *utils.FileWithByteCount, tables []Tabl
 	gplog.Verbose("Writing CREATE statements for dependent objects to metadata file")
 
 	backupSet := createBackupSet(sortables)
-	relevantDeps := GetDependencies(connectionPool, backupSet)
-	if connectionPool.Version.Is("4") && !tableOnly {
+	relevantDeps := GetDependencies(state.connectionPool, backupSet)
+	if state.connectionPool.Version.Is("4") && !tableOnly {
 		AddProtocolDependenciesForGPDB4(relevantDeps, tables, protocols)
 	}
 	sortedSlice := TopologicalSort(sortables, relevantDeps)
 
-	PrintDependentObjectStatements(metadataFile, globalTOC, sortedSlice, filteredMetadata, constraints, funcInfoMap)
-	PrintAlterSequenceStatements(metadataFile, globalTOC, sequences)
-	extPartInfo, partInfoMap := GetExternalPartitionInfo(connectionPool)
+	PrintDependentObjectStatements(metadataFile, state.globalTOC, sortedSlice, filteredMetadata, constraints, funcInfoMap, relevantDeps)
+	if shouldBackupObjectType("SEQUENCE OWNER") {
+		PrintAlterSequenceStatements(metadataFile, state.globalTOC, sequences)
+	}
+	if !shouldBackupObjectType("EXCHANGE PARTITION") {
+		return
+	}
+	extPartInfo, partInfoMap := GetExternalPartitionInfo(state.connectionPool)
 	if len(extPartInfo) > 0 {
 		gplog.Verbose("Writing EXCHANGE PARTITION statements to metadata file")
-		PrintExchangeExternalPartitionStatements(metadataFile, globalTOC, extPartInfo, partInfoMap, tables)
+		PrintExchangeExternalPartitionStatements(metadataFile, state.globalTOC, extPartInfo, partInfoMap, tables)
 	}
 }
 
 func backupConversions(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("CONVERSION") {
+		return
+	}
 	gplog.Verbose("Writing CREATE CONVERSION statements to metadata file")
-	conversions := GetConversions(connectionPool)
-	objectCounts["Conversions"] = len(conversions)
-	convMetadata := GetMetadataForObjectType(connectionPool, TYPE_CONVERSION)
-	PrintCreateConversionStatements(metadataFile, globalTOC, conversions, convMetadata)
+	conversions := GetConversions(state.connectionPool)
+	state.objectCounts["Conversions"] = len(conversions)
+	convMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_CONVERSION)
+	PrintCreateConversionStatements(metadataFile, state.globalTOC, conversions, convMetadata)
 }
 
 func backupOperatorFamilies(metadataFile *utils.FileWithByteCount) {
-	if !connectionPool.Version.AtLeast("5") {
+	if !state.connectionPool.Version.AtLeast("5") || !shouldBackupObjectType("OPERATOR FAMILY") {
 		return
 	}
 	gplog.Verbose("Writing CREATE OPERATOR FAMILY statements to metadata file")
-	operatorFamilies := GetOperatorFamilies(connectionPool)
-	objectCounts["Operator Families"] = len(operatorFamilies)
-	operatorFamilyMetadata := GetMetadataForObjectType(connectionPool, TYPE_OPERATORFAMILY)
-	PrintCreateOperatorFamilyStatements(metadataFile, globalTOC, operatorFamilies, operatorFamilyMetadata)
+	operatorFamilies := GetOperatorFamilies(state.connectionPool)
+	state.objectCounts["Operator Families"] = len(operatorFamilies)
+	operatorFamilyMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_OPERATORFAMILY)
+	PrintCreateOperatorFamilyStatements(metadataFile, state.globalTOC, operatorFamilies, operatorFamilyMetadata)
 }
 
 func backupCollations(metadataFile *utils.FileWithByteCount) {
-	if !connectionPool.Version.AtLeast("6") {
+	if !state.connectionPool.Version.AtLeast("6") || !shouldBackupObjectType("COLLATION") {
 		return
 	}
 	gplog.Verbose("Writing CREATE COLLATION statements to metadata file")
-	collations := GetCollations(connectionPool)
-	objectCounts["Collations"] = len(collations)
-	collationMetadata := GetMetadataForObjectType(connectionPool, TYPE_COLLATION)
-	PrintCreateCollationStatements(metadataFile, globalTOC, collations, collationMetadata)
+	collations := GetCollations(state.connectionPool)
+	state.objectCounts["Collations"] = len(collations)
+	collationMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_COLLATION)
+	PrintCreateCollationStatements(metadataFile, state.globalTOC, collations, collationMetadata)
 }
 
 func backupExtensions(metadataFile *utils.FileWithByteCount) {
 	if !(len(MustGetFlagStringArray(options.INCLUDE_SCHEMA)) == 0 &&
-		connectionPool.Version.AtLeast("5")) {
+		state.connectionPool.Version.AtLeast("5")) || !shouldBackupObjectType("EXTENSION") {
 		return
 	}
 	gplog.Verbose("Writing CREATE EXTENSION statements to metadata file")
-	extensions := GetExtensions(connectionPool)
-	objectCounts["Extensions"] = len(extensions)
-	extensionMetadata := GetCommentsForObjectType(connectionPool, TYPE_EXTENSION)
-	PrintCreateExtensionStatements(metadataFile, globalTOC, extensions, extensionMetadata)
+	extensions := GetExtensions(state.connectionPool)
+	state.objectCounts["Extensions"] = len(extensions)
+	extensionMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_EXTENSION)
+	PrintCreateExtensionStatements(metadataFile, state.globalTOC, extensions, extensionMetadata)
 }
 
 func backupConstraints(metadataFile *utils.FileWithByteCount, constraints []Constraint, conMetadata MetadataMap) {
+	if !shouldBackupObjectType("CONSTRAINT") {
+		return
+	}
 	gplog.Verbose("Writing ADD CONSTRAINT statements to metadata file")
-	objectCounts["Constraints"] = len(constraints)
-	PrintConstraintStatements(metadataFile, globalTOC, constraints, conMetadata)
+	state.objectCounts["Constraints"] = len(constraints)
+	PrintConstraintStatements(metadataFile, state.globalTOC, constraints, conMetadata)
 }
 
 /*
@@ -606,42 +816,57 @@ func backupConstraints(metadataFile *utils.FileWithByteCount, constraints []Cons
  */
 
 func backupIndexes(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("INDEX") {
+		return
+	}
 	gplog.Verbose("Writing CREATE INDEX statements to metadata file")
-	indexes := GetIndexes(connectionPool)
-	objectCounts["Indexes"] = len(indexes)
-	indexMetadata := GetCommentsForObjectType(connectionPool, TYPE_INDEX)
-	PrintCreateIndexStatements(metadataFile, globalTOC, indexes, indexMetadata)
+	indexes := GetIndexes(state.connectionPool)
+	state.objectCounts["Indexes"] = len(indexes)
+	indexMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_INDEX)
+	PrintCreateIndexStatements(metadataFile, state.globalTOC, indexes, indexMetadata)
 }
 
 func backupRules(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("RULE") {
+		return
+	}
 	gplog.Verbose("Writing CREATE RULE statements to metadata file")
-	rules := GetRules(connectionPool)
-	objectCounts["Rules"] = len(rules)
-	ruleMetadata := GetCommentsForObjectType(connectionPool, TYPE_RULE)
-	PrintCreateRuleStatements(metadataFile, globalTOC, rules, ruleMetadata)
+	rules := GetRules(state.connectionPool)
+	state.objectCounts["Rules"] = len(rules)
+	ruleMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_RULE)
+	PrintCreateRuleStatements(metadataFile, state.globalTOC, rules, ruleMetadata)
 }
 
 func backupTriggers(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("TRIGGER") {
+		return
+	}
 	gplog.Verbose("Writing CREATE TRIGGER statements to metadata file")
-	triggers := GetTriggers(connectionPool)
-	objectCounts["Triggers"] = len(triggers)
-	triggerMetadata := GetCommentsForObjectType(connectionPool, TYPE_TRIGGER)
-	PrintCreateTriggerStatements(metadataFile, globalTOC, triggers, triggerMetadata)
+	triggers := GetTriggers(state.connectionPool)
+	state.objectCounts["Triggers"] = len(triggers)
+	triggerMetadata := GetCommentsForObjectType(state.connectionPool, TYPE_TRIGGER)
+	PrintCreateTriggerStatements(metadataFile, state.globalTOC, triggers, triggerMetadata)
 }
 
 func backupEventTriggers(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("EVENT TRIGGER") {
+		return
+	}
 	gplog.Verbose("Writing CREATE EVENT TRIGGER statements to metadata file")
-	eventTriggers := GetEventTriggers(connectionPool)
-	objectCounts["Event Triggers"] = len(eventTriggers)
-	eventTriggerMetadata := GetMetadataForObjectType(connectionPool, TYPE_EVENTTRIGGER)
-	PrintCreateEventTriggerStatements(metadataFile, globalTOC, eventTriggers, eventTriggerMetadata)
+	eventTriggers := GetEventTriggers(state.connectionPool)
+	state.objectCounts["Event Triggers"] = len(eventTriggers)
+	eventTriggerMetadata := GetMetadataForObjectType(state.connectionPool, TYPE_EVENTTRIGGER)
+	PrintCreateEventTriggerStatements(metadataFile, state.globalTOC, eventTriggers, eventTriggerMetadata)
 }
 
 func backupDefaultPrivileges(metadataFile *utils.FileWithByteCount) {
+	if !shouldBackupObjectType("DEFAULT PRIVILEGES") {
+		return
+	}
 	gplog.Verbose("Writing ALTER DEFAULT PRIVILEGES statements to metadata file")
-	defaultPrivileges := GetDefaultPrivileges(connectionPool)
-	objectCounts["DEFAULT PRIVILEGES"] = len(defaultPrivileges)
-	PrintDefaultPrivilegesStatements(metadataFile, globalTOC, defaultPrivileges)
+	defaultPrivileges := GetDefaultPrivileges(state.connectionPool)
+	state.objectCounts["DEFAULT PRIVILEGES"] = len(defaultPrivileges)
+	PrintDefaultPrivilegesStatements(metadataFile, state.globalTOC, defaultPrivileges)
 }
 
 /*
@@ -649,14 +874,17 @@ func backupDefaultPrivileges(metadataFile *utils.FileWithByteCount) {
  */
 
 func backupTableStatistics(statisticsFile *utils.FileWithByteCount, tables []Table) {
-	attStats := GetAttributeStatistics(connectionPool, tables)
-	tupleStats := GetTupleStatistics(connectionPool, tables)
+	if !shouldBackupObjectType("STATISTICS") {
+		return
+	}
+	attStats := GetAttributeStatistics(state.connectionPool, tables)
+	tupleStats := GetTupleStatistics(state.connectionPool, tables)
 
 	backupSessionGUC(statisticsFile)
-	PrintStatisticsStatements(statisticsFile, globalTOC, tables, attStats, tupleStats)
+	PrintStatisticsStatements(statisticsFile, state.globalTOC, tables, attStats, tupleStats)
 }
 
 func backupIncrementalMetadata() {
-	aoTableEntries := GetAOIncrementalMetadata(connectionPool)
-	globalTOC.IncrementalMetadata.AO = aoTableEntries
+	aoTableEntries := GetAOIncrementalMetadata(state.connectionPool)
+	state.globalTOC.IncrementalMetadata.AO = aoTableEntries
 }
@@ -776,6 +776,30 @@ var _ = Describe("backup and restore end to end tests", func() {
 				`SELECT count(*) FROM pg_statistic WHERE starelid='schema3.foo3'::regclass::oid;`)
 			Expect(actualStatisticCount).To(Equal("1"))
 		})
+		It("runs gprestore with --redirect-table restoring the table, its index, and its data under the new name", func() {
+			testhelper.AssertQueryRuns(restoreConn,
+				"DROP SCHEMA IF EXISTS schema3 CASCADE; CREATE SCHEMA schema3;")
+			defer testhelper.AssertQueryRuns(restoreConn,
+				"DROP SCHEMA schema3 CASCADE")
+			testhelper.AssertQueryRuns(backupConn,
+				"CREATE INDEX foo3_idx1 ON schema2.foo3(i)")
+			defer testhelper.AssertQueryRuns(backupConn,
+				"DROP INDEX schema2.foo3_idx1")
+			timestamp := gpbackup(gpbackupPath, backupHelperPath)
+			gprestore(gprestorePath, restoreHelperPath, timestamp,
+				"--redirect-db", "restoredb",
+				"--include-table", "schema2.foo3",
+				"--redirect-schema", "schema3",
+				"--redirect-table", "foo4")
+
+			assertDataRestored(restoreConn, map[string]int{
+				"schema3.foo4": 100,
+			})
+
+			actualIndexTable := dbconn.MustSelectString(restoreConn,
+				`SELECT tablename AS string FROM pg_indexes WHERE schemaname='schema3' AND indexname='foo3_idx1';`)
+			Expect(actualIndexTable).To(Equal("foo4"))
+		})
 		It("runs gprestore with --redirect-schema to redirect data back to the original database which still contain the original tables", func() {
 			skipIfOldBackupVersionBefore("1.17.0")
 			testhelper.AssertQueryRuns(backupConn,
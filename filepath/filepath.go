@@ -11,6 +11,7 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -18,11 +19,14 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
 )
 
 type FilePathInfo struct {
 	PID                    int
 	SegDirMap              map[int]string
+	BackupDirMap           map[int]string
 	Timestamp              string
 	UserSpecifiedBackupDir string
 	UserSpecifiedSegPrefix string
@@ -55,7 +59,14 @@ func (backupFPInfo *FilePathInfo) IsUserSpecifiedBackupDir() bool {
 	return backupFPInfo.UserSpecifiedBackupDir != ""
 }
 
+func (backupFPInfo *FilePathInfo) IsBackupDirMapped() bool {
+	return len(backupFPInfo.BackupDirMap) > 0
+}
+
 func (backupFPInfo *FilePathInfo) GetDirForContent(contentID int) string {
+	if mappedDir, ok := backupFPInfo.BackupDirMap[contentID]; ok {
+		return path.Join(mappedDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
+	}
 	if backupFPInfo.IsUserSpecifiedBackupDir() {
 		segDir := fmt.Sprintf("%s%d", backupFPInfo.UserSpecifiedSegPrefix, contentID)
 		return path.Join(backupFPInfo.UserSpecifiedBackupDir, segDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp)
@@ -78,17 +89,27 @@ func (backupFPInfo *FilePathInfo) GetSegmentPipePathForCopyCommand() string {
 }
 
 func (backupFPInfo *FilePathInfo) GetTableBackupFilePath(contentID int, tableOid uint32, extension string, singleDataFile bool) string {
+	if backupFPInfo.IsBackupDirMapped() {
+		backupFilePath := backupFPInfo.getTableBackupFileName(tableOid, extension, singleDataFile)
+		return path.Join(backupFPInfo.GetDirForContent(contentID), backupFPInfo.replaceCopyFormatStringsInPath(backupFilePath, contentID))
+	}
 	templateFilePath := backupFPInfo.GetTableBackupFilePathForCopyCommand(tableOid, extension, singleDataFile)
 	return backupFPInfo.replaceCopyFormatStringsInPath(templateFilePath, contentID)
 }
 
-func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid uint32, extension string, singleDataFile bool) string {
+func (backupFPInfo *FilePathInfo) getTableBackupFileName(tableOid uint32, extension string, singleDataFile bool) string {
 	backupFilePath := fmt.Sprintf("gpbackup_<SEGID>_%s", backupFPInfo.Timestamp)
 	if !singleDataFile {
 		backupFilePath += fmt.Sprintf("_%d", tableOid)
 	}
+	return backupFilePath + extension
+}
 
-	backupFilePath += extension
+func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid uint32, extension string, singleDataFile bool) string {
+	backupFilePath := backupFPInfo.getTableBackupFileName(tableOid, extension, singleDataFile)
+	if backupFPInfo.IsBackupDirMapped() {
+		return fmt.Sprintf("%s/%s", backupFPInfo.getMappedBackupDirForCopyCommand(), path.Join("backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath))
+	}
 	baseDir := "<SEG_DATA_DIR>"
 	if backupFPInfo.IsUserSpecifiedBackupDir() {
 		baseDir = path.Join(backupFPInfo.UserSpecifiedBackupDir, fmt.Sprintf("%s<SEGID>", backupFPInfo.UserSpecifiedSegPrefix))
@@ -96,9 +117,34 @@ func (backupFPInfo *FilePathInfo) GetTableBackupFilePathForCopyCommand(tableOid
 	return path.Join(baseDir, "backups", backupFPInfo.Timestamp[0:8], backupFPInfo.Timestamp, backupFilePath)
 }
 
+/*
+ * COPY only substitutes the content ID and data directory of each segment into
+ * its command, so the directory of each segment in the backup directory map
+ * is selected by a shell case statement on the content ID, and a segment that
+ * is not in the map reads from its data directory.  The command is quoted as
+ * a SQL string, so each directory is double quoted for the shell, which
+ * ReadBackupDirMapFile makes safe by rejecting the characters that are special
+ * in either quoting.
+ */
+func (backupFPInfo *FilePathInfo) getMappedBackupDirForCopyCommand() string {
+	contentIDs := make([]int, 0)
+	for contentID := range backupFPInfo.BackupDirMap {
+		if contentID != -1 {
+			contentIDs = append(contentIDs, contentID)
+		}
+	}
+	sort.Ints(contentIDs)
+	var segmentCases strings.Builder
+	for _, contentID := range contentIDs {
+		segmentCases.WriteString(fmt.Sprintf(`(%d) echo "%s";; `, contentID, backupFPInfo.BackupDirMap[contentID]))
+	}
+	return fmt.Sprintf(`"$(case <SEGID> in %s*) echo "<SEG_DATA_DIR>";; esac)"`, segmentCases.String())
+}
+
 var metadataFilenameMap = map[string]string{
 	"config":                "config.yaml",
 	"metadata":              "metadata.sql",
+	"plain script":          "script.sql",
 	"statistics":            "statistics.sql",
 	"table of contents":     "toc.yaml",
 	"report":                "report",
@@ -120,6 +166,10 @@ func (backupFPInfo *FilePathInfo) GetMetadataFilePath() string {
 	return backupFPInfo.GetBackupFilePath("metadata")
 }
 
+func (backupFPInfo *FilePathInfo) GetPlainScriptFilePath() string {
+	return backupFPInfo.GetBackupFilePath("plain script")
+}
+
 func (backupFPInfo *FilePathInfo) GetStatisticsFilePath() string {
 	return backupFPInfo.GetBackupFilePath("statistics")
 }
@@ -189,6 +239,52 @@ func GetSegPrefix(connectionPool *dbconn.DBConn) string {
 	return segPrefix
 }
 
+/*
+ * The backup directory map file is a YAML mapping of each host of the cluster
+ * to the content IDs on that host and the directory of each, which contains
+ * the backups/<date>/<timestamp> directories of that content as the
+ * <backup-dir>/<segment prefix><content ID> directory of a backup would.
+ * A content ID must be mapped on the host it is on, and one that is not mapped
+ * keeps its backup files in its data directory.
+ */
+func ReadBackupDirMapFile(filename string, c *cluster.Cluster) (map[int]string, error) {
+	contents, err := operating.System.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	hostDirMap := make(map[string]map[int]string)
+	err = yaml.UnmarshalStrict(contents, &hostDirMap)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse backup directory map file %s: %v", filename, err)
+	}
+
+	backupDirMap := make(map[int]string)
+	for host, contentDirMap := range hostDirMap {
+		for contentID, dir := range contentDirMap {
+			if _, ok := c.ByContent[contentID]; !ok {
+				return nil, errors.Errorf("Content %d on host %s in backup directory map file %s is not in the cluster", contentID, host, filename)
+			}
+			if clusterHost := c.GetHostForContent(contentID); clusterHost != host {
+				return nil, errors.Errorf("Content %d is on host %s, not on host %s as in backup directory map file %s", contentID, clusterHost, host, filename)
+			}
+			if !path.IsAbs(dir) {
+				return nil, errors.Errorf("Directory %s of content %d in backup directory map file %s is not an absolute path", dir, contentID, filename)
+			}
+			if i := strings.IndexFunc(dir, isUnsafeInCopyCommand); i != -1 {
+				return nil, errors.Errorf("Directory %s of content %d in backup directory map file %s contains %q, which cannot be used in a backup directory",
+					dir, contentID, filename, dir[i])
+			}
+			backupDirMap[contentID] = path.Clean(dir)
+		}
+	}
+	return backupDirMap, nil
+}
+
+// The characters that end or are expanded within a double quoted shell string in a SQL string
+func isUnsafeInCopyCommand(r rune) bool {
+	return strings.ContainsRune("'\"$`\\", r) || r < ' ' || r == 0x7f
+}
+
 func ParseSegPrefix(backupDir string, timestamp string) string {
 	segPrefix := ""
 	if len(backupDir) > 0 {
@@ -1,6 +1,7 @@
 package filepath_test
 
 import (
+	"io/ioutil"
 	"os"
 	path "path/filepath"
 	"testing"
@@ -62,6 +63,17 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.SegDirMap).To(HaveLen(1))
 			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101"))
 		})
+		It("returns the content directory based on the backup directory map", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "")
+			fpInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0"}
+			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/mnt/coordinator/backups/20170101/20170101010101"))
+			Expect(fpInfo.GetDirForContent(0)).To(Equal("/mnt/disk1/seg0/backups/20170101/20170101010101"))
+		})
+		It("returns the content directory in the data directory of a content ID that is not in the backup directory map", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "")
+			fpInfo.BackupDirMap = map[int]string{0: "/mnt/disk1/seg0"}
+			Expect(fpInfo.GetDirForContent(-1)).To(Equal("/data/gpseg-1/backups/20170101/20170101010101"))
+		})
 	})
 	Describe("GetTableBackupFilePathForCopyCommand()", func() {
 		It("returns table file path for copy command", func() {
@@ -96,6 +108,16 @@ var _ = Describe("filepath tests", func() {
 			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
 			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, ".gzip", true)).To(Equal("/foo/bar/gpseg<SEGID>/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101.gzip"))
 		})
+		It("returns table file path for copy command based on the backup directory map", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "")
+			fpInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0", 1: "/mnt/disk2/seg1"}
+			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, ".gzip", false)).To(Equal(`"$(case <SEGID> in (0) echo "/mnt/disk1/seg0";; (1) echo "/mnt/disk2/seg1";; *) echo "<SEG_DATA_DIR>";; esac)"/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234.gzip`))
+		})
+		It("returns table file path for copy command that reads from the data directory of a segment that is not in the backup directory map", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "")
+			fpInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 1: "/mnt/disk 2/seg1"}
+			Expect(fpInfo.GetTableBackupFilePathForCopyCommand(1234, "", false)).To(Equal(`"$(case <SEGID> in (1) echo "/mnt/disk 2/seg1";; *) echo "<SEG_DATA_DIR>";; esac)"/backups/20170101/20170101010101/gpbackup_<SEGID>_20170101010101_1234`))
+		})
 	})
 	Describe("GetReportFilePath", func() {
 		It("returns report file path", func() {
@@ -107,6 +129,16 @@ var _ = Describe("filepath tests", func() {
 			Expect(fpInfo.GetBackupReportFilePath()).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report"))
 		})
 	})
+	Describe("GetPlainScriptFilePath", func() {
+		It("returns plain script file path", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
+			Expect(fpInfo.GetPlainScriptFilePath()).To(Equal("/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_script.sql"))
+		})
+		It("returns plain script file path based on user specified path", func() {
+			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
+			Expect(fpInfo.GetPlainScriptFilePath()).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_script.sql"))
+		})
+	})
 	Describe("GetTableBackupFilePath", func() {
 		It("returns table file path", func() {
 			fpInfo := NewFilePathInfo(c, "", "20170101010101", "gpseg")
@@ -124,6 +156,76 @@ var _ = Describe("filepath tests", func() {
 			fpInfo := NewFilePathInfo(c, "/foo/bar", "20170101010101", "gpseg")
 			Expect(fpInfo.GetTableBackupFilePath(-1, 1234, "", true)).To(Equal("/foo/bar/gpseg-1/backups/20170101/20170101010101/gpbackup_-1_20170101010101"))
 		})
+		It("returns table file path based on the backup directory map", func() {
+			fpInfo := NewFilePathInfo(c, "", "20170101010101", "")
+			fpInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0"}
+			Expect(fpInfo.GetTableBackupFilePath(0, 1234, ".gz", false)).To(Equal("/mnt/disk1/seg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_1234.gz"))
+		})
+	})
+	Describe("ReadBackupDirMapFile", func() {
+		BeforeEach(func() {
+			c = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: masterDir, Hostname: "mdw"},
+				{ContentID: 0, DataDir: segDirOne, Hostname: "sdw1"},
+				{ContentID: 1, DataDir: segDirTwo, Hostname: "sdw1"},
+			})
+		})
+		AfterEach(func() {
+			operating.System.ReadFile = ioutil.ReadFile
+		})
+		mapFileContents := func(contents string) {
+			operating.System.ReadFile = func(string) ([]byte, error) { return []byte(contents), nil }
+		}
+
+		It("maps each content ID to its directory", func() {
+			mapFileContents(`
+mdw:
+  -1: /mnt/coordinator
+sdw1:
+  0: /mnt/disk1/seg0
+  1: /mnt/disk2/seg1/
+`)
+			backupDirMap, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupDirMap).To(Equal(map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0", 1: "/mnt/disk2/seg1"}))
+		})
+		It("returns an error if the file cannot be parsed", func() {
+			mapFileContents("mdw: /mnt/coordinator")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(HaveOccurred())
+			Expect(err.Error()).To(HavePrefix("Unable to parse backup directory map file /tmp/dirmap.yaml"))
+		})
+		It("returns an error if a content ID is mapped on the wrong host", func() {
+			mapFileContents("mdw: {-1: /mnt/coordinator, 0: /mnt/disk1/seg0}\nsdw1: {1: /mnt/disk2/seg1}")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(MatchError("Content 0 is on host sdw1, not on host mdw as in backup directory map file /tmp/dirmap.yaml"))
+		})
+		It("returns an error if a content ID is not in the cluster", func() {
+			mapFileContents("mdw: {-1: /mnt/coordinator}\nsdw1: {0: /mnt/disk1/seg0, 1: /mnt/disk2/seg1, 2: /mnt/disk3/seg2}")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(MatchError("Content 2 on host sdw1 in backup directory map file /tmp/dirmap.yaml is not in the cluster"))
+		})
+		It("returns an error if a directory is not an absolute path", func() {
+			mapFileContents("mdw: {-1: /mnt/coordinator}\nsdw1: {0: /mnt/disk1/seg0, 1: disk2/seg1}")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(MatchError("Directory disk2/seg1 of content 1 in backup directory map file /tmp/dirmap.yaml is not an absolute path"))
+		})
+		It("maps only the content IDs in the file", func() {
+			mapFileContents("sdw1: {0: /mnt/disk1/seg0}")
+			backupDirMap, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupDirMap).To(Equal(map[int]string{0: "/mnt/disk1/seg0"}))
+		})
+		It("returns an error if a directory contains a character that cannot be used in a COPY command", func() {
+			mapFileContents("mdw: {-1: /mnt/coordinator}\nsdw1: {0: /mnt/disk1/seg0, 1: \"/mnt/it's/seg1\"}")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(MatchError(`Directory /mnt/it's/seg1 of content 1 in backup directory map file /tmp/dirmap.yaml contains '\'', which cannot be used in a backup directory`))
+		})
+		It("returns an error if a directory contains a shell expansion", func() {
+			mapFileContents("sdw1: {0: /mnt/$HOME/seg0}")
+			_, err := ReadBackupDirMapFile("/tmp/dirmap.yaml", c)
+			Expect(err).To(MatchError("Directory /mnt/$HOME/seg0 of content 0 in backup directory map file /tmp/dirmap.yaml contains '$', which cannot be used in a backup directory"))
+		})
 	})
 	Describe("ParseSegPrefix", func() {
 		AfterEach(func() {
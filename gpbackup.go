@@ -3,10 +3,12 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	. "github.com/greenplum-db/gpbackup/backup"
 	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -17,10 +19,13 @@ func main() {
 		Args:    cobra.NoArgs,
 		Version: GetVersion(),
 		Run: func(cmd *cobra.Command, args []string) {
-			defer DoTeardown()
-			DoFlagValidation(cmd)
-			DoSetup()
-			DoBackup()
+			if MustGetFlagBool(options.DAEMON) {
+				DoDaemon()
+			}
+			ctx, cancel := utils.NewSignalContext(context.Background(), "backup process")
+			_, err := Run(ctx, Config{Flags: options.GetSetFlagValues(cmd.Flags())})
+			cancel()
+			os.Exit(GetExitCode(err))
 		}}
 	rootCmd.SetArgs(options.HandleSingleDashes(os.Args[1:]))
 	DoInit(rootCmd)
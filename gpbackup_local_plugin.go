@@ -0,0 +1,11 @@
+// +build gpbackup_local_plugin
+
+package main
+
+import (
+	. "github.com/greenplum-db/gpbackup/localplugin"
+)
+
+func main() {
+	DoLocalPlugin()
+}
@@ -0,0 +1,11 @@
+// +build gpbackup_plugin_test
+
+package main
+
+import (
+	. "github.com/greenplum-db/gpbackup/plugintest"
+)
+
+func main() {
+	DoPluginTest()
+}
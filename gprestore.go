@@ -3,10 +3,12 @@
 package main
 
 import (
+	"context"
 	"os"
 
 	"github.com/greenplum-db/gpbackup/options"
 	. "github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/spf13/cobra"
 )
 
@@ -17,10 +19,10 @@ func main() {
 		Args:    cobra.NoArgs,
 		Version: GetVersion(),
 		Run: func(cmd *cobra.Command, args []string) {
-			defer DoTeardown()
-			DoValidation(cmd)
-			DoSetup()
-			DoRestore()
+			ctx, cancel := utils.NewSignalContext(context.Background(), "restore process")
+			_, err := Run(ctx, Config{Flags: options.GetSetFlagValues(cmd.Flags())})
+			cancel()
+			os.Exit(GetExitCode(err))
 		}}
 	rootCmd.SetArgs(options.HandleSingleDashes(os.Args[1:]))
 	DoInit(rootCmd)
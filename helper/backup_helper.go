@@ -30,6 +30,15 @@ func doBackupAgent() error {
 	tocfile := &toc.SegmentTOC{}
 	tocfile.DataEntries = make(map[uint]toc.SegmentDataEntry)
 
+	var pluginConfig *utils.PluginConfig
+	if *pluginConfigFile != "" {
+		var err error
+		pluginConfig, err = utils.ReadPluginConfig(*pluginConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+
 	oidList, err := getOidListFromFile()
 	if err != nil {
 		return err
@@ -60,7 +69,7 @@ func doBackupAgent() error {
 			return err
 		}
 		if i == 0 {
-			finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, err = getBackupPipeWriter(*compressionLevel)
+			finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, err = getBackupPipeWriter(*compressionLevel, pluginConfig)
 			if err != nil {
 				return err
 			}
@@ -95,7 +104,13 @@ func doBackupAgent() error {
 	}
 	_ = bufIoWriter.Flush()
 	_ = writeHandle.Close()
-	if *pluginConfigFile != "" {
+	if pluginConfig != nil && pluginConfig.BuffersData() {
+		log("Uploading buffered data to plugin destination")
+		err := uploadBufferedData(pluginConfig)
+		if err != nil {
+			return err
+		}
+	} else if pluginConfig != nil {
 		/*
 		 * When using a plugin, the agent may take longer to finish than the
 		 * main gpbackup process. We either write the TOC file if the agent finishes
@@ -129,12 +144,12 @@ func getBackupPipeReader(currentPipe string) (io.Reader, io.ReadCloser, error) {
 	return reader, readHandle, nil
 }
 
-func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Writer, io.WriteCloser, *exec.Cmd, error) {
+func getBackupPipeWriter(compressLevel int, pluginConfig *utils.PluginConfig) (io.Writer, *gzip.Writer, *bufio.Writer, io.WriteCloser, *exec.Cmd, error) {
 	var writeHandle io.WriteCloser
 	var err error
 	var writeCmd *exec.Cmd
-	if *pluginConfigFile != "" {
-		writeCmd, writeHandle, err = startBackupPluginCommand()
+	if pluginConfig != nil && !pluginConfig.BuffersData() {
+		writeCmd, writeHandle, err = startBackupPluginCommand(pluginConfig)
 	} else {
 		writeHandle, err = os.Create(*dataFile)
 	}
@@ -156,11 +171,7 @@ func getBackupPipeWriter(compressLevel int) (io.Writer, *gzip.Writer, *bufio.Wri
 	return finalWriter, gzipWriter, bufIoWriter, writeHandle, writeCmd, nil
 }
 
-func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser, error) {
-	pluginConfig, err := utils.ReadPluginConfig(*pluginConfigFile)
-	if err != nil {
-		return nil, nil, err
-	}
+func startBackupPluginCommand(pluginConfig *utils.PluginConfig) (*exec.Cmd, io.WriteCloser, error) {
 	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
 	writeCmd := exec.Command("bash", "-c", cmdStr)
 
@@ -175,3 +186,32 @@ func startBackupPluginCommand() (*exec.Cmd, io.WriteCloser, error) {
 	}
 	return writeCmd, writeHandle, nil
 }
+
+/*
+ * With buffer_data in the retry section of the plugin config, the data is
+ * written to the local data file and then backed up with the plugin, so that
+ * backup_data can be retried with the same data.  The local file is removed
+ * once it is backed up.
+ */
+func uploadBufferedData(pluginConfig *utils.PluginConfig) error {
+	cmdStr := fmt.Sprintf("%s backup_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
+	output, err := pluginConfig.RunWithRetries("backup_data", func() (string, error) {
+		dataHandle, err := os.Open(*dataFile)
+		if err != nil {
+			return "", err
+		}
+		defer dataHandle.Close()
+		cmd := exec.Command("bash", "-c", cmdStr)
+		cmd.Stdin = dataHandle
+		output, err := cmd.CombinedOutput()
+		return string(output), err
+	})
+	writeErr := writeRetriesFile(pluginConfig)
+	if err != nil {
+		return errors.Wrap(err, strings.TrimSpace(output))
+	}
+	if writeErr != nil {
+		return writeErr
+	}
+	return utils.RemoveFileIfExists(*dataFile)
+}
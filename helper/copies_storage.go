@@ -0,0 +1,247 @@
+package helper
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Storage copies runs each plugin command with every destination of the
+ * backup that has not failed in the backup directory the command is given,
+ * as described in utils/plugin_copies.go.
+ */
+
+func runCopiesCommand(config *utils.PluginConfig, command string, args []string) error {
+	var backupDir string
+	switch command {
+	case "setup_plugin_for_backup", "setup_plugin_for_restore", "cleanup_plugin_for_backup", "cleanup_plugin_for_restore":
+		backupDir = args[1]
+	case "backup_file", "restore_file", "backup_data":
+		backupDir = path.Dir(args[1])
+	default:
+		return errors.Errorf("Plugin command %s is not supported by storage %s", command, utils.CopiesStorage)
+	}
+	destinations, err := remainingCopyDestinations(config, backupDir)
+	if err != nil {
+		return err
+	}
+
+	var failures map[int]error
+	switch command {
+	case "restore_file":
+		return restoreFileFromCopies(destinations, args[1])
+	case "backup_data":
+		gplog.Verbose("Copying data to %s", args[1])
+		failures = backupDataToCopies(destinations, args[1])
+	default:
+		failures = runOnCopies(destinations, command, args[1:])
+	}
+	return recordCopyFailures(backupDir, command, destinations, failures)
+}
+
+// Returns the destinations that have not failed in backupDir
+func remainingCopyDestinations(config *utils.PluginConfig, backupDir string) ([]utils.CopyDestination, error) {
+	contents, err := ioutil.ReadFile(utils.GetCopyFailuresFilePath(backupDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	failures := utils.ParseCopyFailures(string(contents))
+	destinations := make([]utils.CopyDestination, 0)
+	for _, destination := range config.CopyDestinations() {
+		if _, failed := failures[destination.Index]; !failed {
+			destinations = append(destinations, destination)
+		}
+	}
+	if len(destinations) == 0 {
+		return nil, errors.New("Every copy of the backup has failed")
+	}
+	return destinations, nil
+}
+
+/*
+ * Files other than data files are written to the backup directory by
+ * gpbackup, so only the plugins have anything to do.
+ */
+func runOnCopies(destinations []utils.CopyDestination, command string, args []string) map[int]error {
+	failures := make(map[int]error)
+	for _, destination := range destinations {
+		plugin := destination.Plugin
+		if plugin == nil {
+			continue
+		}
+		output, err := plugin.RunWithRetries(command, func() (string, error) {
+			commandArgs := append([]string{command, plugin.ConfigPath}, args...)
+			output, err := exec.Command(plugin.ExecutablePath, commandArgs...).CombinedOutput()
+			return string(output), err
+		})
+		if err != nil {
+			failures[destination.Index] = errors.Errorf("%v: %s", err, strings.TrimSpace(output))
+		}
+	}
+	return failures
+}
+
+func restoreFileFromCopies(destinations []utils.CopyDestination, filename string) error {
+	err := errors.Errorf("%s was not found in the backup directory", filename)
+	for _, destination := range destinations {
+		if destination.Plugin == nil {
+			if _, statErr := os.Stat(filename); statErr == nil {
+				return nil
+			}
+			continue
+		}
+		err = runOnCopies([]utils.CopyDestination{destination}, "restore_file", []string{filename})[destination.Index]
+		if err == nil {
+			return nil
+		}
+		gplog.Error("restore_file failed for %s: %v", destination, err)
+	}
+	return err
+}
+
+// A destination of backup_data, which the data is written to as it is read
+type copyWriter struct {
+	destination utils.CopyDestination
+	writer      io.WriteCloser
+	command     *exec.Cmd
+	stderr      *bytes.Buffer
+	err         error
+}
+
+func startCopyWriter(destination utils.CopyDestination, filename string) (*copyWriter, error) {
+	if destination.Plugin == nil {
+		file, err := os.Create(filename)
+		if err != nil {
+			return nil, err
+		}
+		return &copyWriter{destination: destination, writer: file}, nil
+	}
+	// backup_data cannot be retried, as the data read by the failed attempt is gone
+	command := exec.Command(destination.Plugin.ExecutablePath, "backup_data", destination.Plugin.ConfigPath, filename)
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	command.Stderr = stderr
+	err = command.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &copyWriter{destination: destination, writer: stdin, command: command, stderr: stderr}, nil
+}
+
+func (writer *copyWriter) write(data []byte) {
+	if writer.err == nil {
+		_, writer.err = writer.writer.Write(data)
+	}
+}
+
+func (writer *copyWriter) finish() error {
+	closeErr := writer.writer.Close()
+	if writer.err == nil {
+		writer.err = closeErr
+	}
+	if writer.command != nil {
+		// The plugin's own error explains a failed write better than the broken pipe does
+		waitErr := writer.command.Wait()
+		if waitErr != nil {
+			writer.err = errors.Errorf("%v: %s", waitErr, strings.TrimSpace(writer.stderr.String()))
+		}
+	}
+	return writer.err
+}
+
+/*
+ * Tees the data on stdin to every destination, dropping a destination as
+ * soon as writing to it fails so that the others can carry on.
+ */
+func backupDataToCopies(destinations []utils.CopyDestination, filename string) map[int]error {
+	failures := make(map[int]error)
+	writers := make([]*copyWriter, 0)
+	for _, destination := range destinations {
+		writer, err := startCopyWriter(destination, filename)
+		if err != nil {
+			failures[destination.Index] = err
+			continue
+		}
+		writers = append(writers, writer)
+	}
+
+	buffer := make([]byte, 1024*1024)
+	for !allCopyWritersFailed(writers) {
+		numBytes, err := os.Stdin.Read(buffer)
+		for _, writer := range writers {
+			writer.write(buffer[:numBytes])
+		}
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			for _, writer := range writers {
+				if writer.err == nil {
+					writer.err = err
+				}
+			}
+		}
+	}
+
+	for _, writer := range writers {
+		err := writer.finish()
+		if err != nil {
+			failures[writer.destination.Index] = err
+		}
+	}
+	return failures
+}
+
+func allCopyWritersFailed(writers []*copyWriter) bool {
+	for _, writer := range writers {
+		if writer.err == nil {
+			return false
+		}
+	}
+	return true
+}
+
+/*
+ * Records the destinations that failed, so that they are skipped by later
+ * commands and reported by gpbackup.  Returns an error if none succeeded.
+ */
+func recordCopyFailures(backupDir string, command string, destinations []utils.CopyDestination, failures map[int]error) error {
+	if len(failures) == 0 {
+		return nil
+	}
+	failuresFile, err := os.OpenFile(utils.GetCopyFailuresFilePath(backupDir), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	for _, destination := range destinations {
+		failure, failed := failures[destination.Index]
+		if !failed {
+			continue
+		}
+		gplog.Error("%s failed for %s, so the backup is no longer copied there: %v", command, destination, failure)
+		_, err = failuresFile.WriteString(utils.FormatCopyFailure(destination.Index, failure))
+		if err != nil {
+			_ = failuresFile.Close()
+			return err
+		}
+	}
+	err = failuresFile.Close()
+	if err != nil {
+		return err
+	}
+	if len(failures) == len(destinations) {
+		return errors.Errorf("%s failed for every copy of the backup", command)
+	}
+	return nil
+}
@@ -0,0 +1,262 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The copy agent copies the files of one segment of a backup listed on its
+ * stdin to another destination, as described in utils/backup_copy.go.  Files
+ * are read from local files, or from the plugin in --plugin-config, and
+ * written to local files, or to the plugin in --copy-to-plugin-config.
+ *
+ * A plugin is called for each file as gpbackup and gprestore call it: with
+ * restore_data and backup_data for the data files of a segment, and with
+ * restore_file and backup_file for every other file, which are the files on
+ * the coordinator and the table of contents of each segment.  Those are read
+ * and written through a local file at the path the plugin stores them by.
+ */
+
+func doCopyAgent() error {
+	var sourcePlugin, destinationPlugin *utils.PluginConfig
+	var err error
+	if *pluginConfigFile != "" {
+		sourcePlugin, err = utils.ReadPluginConfig(*pluginConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+	if *copyToPluginConfigFile != "" {
+		destinationPlugin, err = utils.ReadPluginConfig(*copyToPluginConfigFile)
+		if err != nil {
+			return err
+		}
+	}
+	contents, err := ioutil.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	files, err := utils.ParseBackupFileCopies(string(contents))
+	if err != nil {
+		return err
+	}
+	for _, file := range files {
+		err = copyBackupFile(sourcePlugin, destinationPlugin, file)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to copy %s to %s", file.Source, file.Destination)
+		}
+	}
+	log("Copied %d files", len(files))
+	return nil
+}
+
+// The size and md5 checksum of a file, computed as it is copied and again as it is read back
+type fileChecksum struct {
+	size int64
+	md5  string
+}
+
+func newFileChecksum(size int64, hash []byte) fileChecksum {
+	return fileChecksum{size: size, md5: hex.EncodeToString(hash)}
+}
+
+func isBackupDataFile(filename string) bool {
+	return *content != -1 && !strings.HasSuffix(filename, "_toc.yaml")
+}
+
+func copyBackupFile(sourcePlugin *utils.PluginConfig, destinationPlugin *utils.PluginConfig, file utils.BackupFileCopy) error {
+	source, err := openBackupFile(sourcePlugin, file.Source)
+	if err != nil {
+		return err
+	}
+	hash := md5.New()
+	size, err := writeBackupFile(destinationPlugin, file.Destination, io.TeeReader(source, hash))
+	closeErr := source.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+	copied := newFileChecksum(size, hash.Sum(nil))
+
+	if destinationPlugin != nil && !isBackupDataFile(file.Destination) {
+		// Reading the copy back replaces the local file, which may be the one it was copied from
+		putBack, err := setLocalFileAside(file.Destination)
+		if err != nil {
+			return err
+		}
+		defer func() {
+			putBackErr := putBack()
+			if putBackErr != nil {
+				log("Unable to put back %s: %v", file.Destination, putBackErr)
+			}
+		}()
+	}
+	destination, err := openBackupFile(destinationPlugin, file.Destination)
+	if err != nil {
+		return err
+	}
+	hash = md5.New()
+	size, err = io.Copy(hash, destination)
+	closeErr = destination.Close()
+	if err != nil {
+		return err
+	} else if closeErr != nil {
+		return closeErr
+	}
+	written := newFileChecksum(size, hash.Sum(nil))
+
+	if written != copied {
+		return errors.Errorf("The copy read back has %d bytes with md5 checksum %s, but %d bytes with md5 checksum %s were copied",
+			written.size, written.md5, copied.size, copied.md5)
+	}
+	log("Copied %s to %s (%d bytes, md5 checksum %s)", file.Source, file.Destination, copied.size, copied.md5)
+	return nil
+}
+
+/*
+ * Moves a local file aside until the returned function is called, which puts
+ * it back in place of any file at its path by then.
+ */
+func setLocalFileAside(filename string) (func() error, error) {
+	asideFilename := filename + "_copy_agent"
+	err := os.Rename(filename, asideFilename)
+	if err != nil {
+		return nil, err
+	}
+	return func() error {
+		return os.Rename(asideFilename, filename)
+	}, nil
+}
+
+func openBackupFile(plugin *utils.PluginConfig, filename string) (io.ReadCloser, error) {
+	if plugin == nil {
+		return os.Open(filename)
+	}
+	if !isBackupDataFile(filename) {
+		err := plugin.RestoreFile(filename)
+		if err != nil {
+			return nil, err
+		}
+		return os.Open(filename)
+	}
+	command := exec.Command(plugin.ExecutablePath, "restore_data", plugin.ConfigPath, filename)
+	stdout, err := command.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	stderr := &bytes.Buffer{}
+	command.Stderr = stderr
+	err = command.Start()
+	if err != nil {
+		return nil, err
+	}
+	return &pluginReader{stdout: stdout, command: command, stderr: stderr}, nil
+}
+
+// The data restored by a plugin with restore_data, which is only complete if the plugin succeeds
+type pluginReader struct {
+	stdout  io.ReadCloser
+	command *exec.Cmd
+	stderr  *bytes.Buffer
+	atEOF   bool
+}
+
+func (reader *pluginReader) Read(data []byte) (int, error) {
+	numBytes, err := reader.stdout.Read(data)
+	if err == io.EOF {
+		reader.atEOF = true
+	}
+	return numBytes, err
+}
+
+func (reader *pluginReader) Close() error {
+	if !reader.atEOF {
+		// The copy has already failed, so the plugin need not finish
+		_ = reader.command.Process.Kill()
+		_ = reader.command.Wait()
+		return nil
+	}
+	err := reader.command.Wait()
+	if err != nil {
+		return errors.Errorf("restore_data failed: %v: %s", err, strings.TrimSpace(reader.stderr.String()))
+	}
+	return nil
+}
+
+// Returns the number of bytes written
+func writeBackupFile(plugin *utils.PluginConfig, filename string, reader io.Reader) (int64, error) {
+	if plugin == nil {
+		return writeLocalBackupFile(filename, reader)
+	}
+	if !isBackupDataFile(filename) {
+		size, err := writeLocalBackupFile(filename, reader)
+		if err != nil {
+			return size, err
+		}
+		return size, plugin.BackupFile(filename)
+	}
+	command := exec.Command(plugin.ExecutablePath, "backup_data", plugin.ConfigPath, filename)
+	stdin, err := command.StdinPipe()
+	if err != nil {
+		return 0, err
+	}
+	stderr := &bytes.Buffer{}
+	command.Stderr = stderr
+	err = command.Start()
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(stdin, reader)
+	closeErr := stdin.Close()
+	// The plugin's own error explains a failed write better than the broken pipe does
+	waitErr := command.Wait()
+	if waitErr != nil {
+		return size, errors.Errorf("backup_data failed: %v: %s", waitErr, strings.TrimSpace(stderr.String()))
+	} else if err != nil {
+		return size, err
+	}
+	return size, closeErr
+}
+
+/*
+ * A file left by an earlier copy that failed is replaced, even though backup
+ * files are read-only.  The file is removed before it is written, so a file
+ * copied to the path it is read from is still read in full.
+ */
+func writeLocalBackupFile(filename string, reader io.Reader) (int64, error) {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return 0, err
+	}
+	err = utils.RemoveFileIfExists(filename)
+	if err != nil {
+		return 0, err
+	}
+	file, err := os.Create(filename)
+	if err != nil {
+		return 0, err
+	}
+	size, err := io.Copy(file, reader)
+	if err != nil {
+		_ = file.Close()
+		return size, err
+	}
+	err = file.Sync()
+	if err != nil {
+		_ = file.Close()
+		return size, err
+	}
+	return size, file.Close()
+}
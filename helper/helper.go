@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/signal"
 	"runtime/debug"
@@ -41,21 +42,26 @@ var (
  * Command-line flags
  */
 var (
-	backupAgent      *bool
-	compressionLevel *int
-	content          *int
-	dataFile         *string
-	oidFile          *string
-	onErrorContinue  *bool
-	pipeFile         *string
-	pluginConfigFile *string
-	printVersion     *bool
-	restoreAgent     *bool
-	tocFile          *string
-	isFiltered       *bool
+	backupAgent            *bool
+	compressionLevel       *int
+	content                *int
+	copyAgent              *bool
+	copyToPluginConfigFile *string
+	dataFile               *string
+	oidFile                *string
+	onErrorContinue        *bool
+	pipeFile               *string
+	pluginConfigFile       *string
+	printVersion           *bool
+	restoreAgent           *bool
+	tocFile                *string
+	isFiltered             *bool
 )
 
 func DoHelper() {
+	if IsStoragePluginCommand(os.Args[1:]) {
+		DoStoragePlugin(os.Args[1:])
+	}
 	var err error
 	defer func() {
 		if wasTerminated {
@@ -84,6 +90,13 @@ func DoHelper() {
 		err = doBackupAgent()
 	} else if *restoreAgent {
 		err = doRestoreAgent()
+	} else if *copyAgent {
+		// gprestore reads the error of a copy agent from its output rather than an error file
+		err = doCopyAgent()
+		if err != nil {
+			logError("%v", err)
+		}
+		return
 	}
 	if err != nil {
 		gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
@@ -99,6 +112,8 @@ func InitializeGlobals() {
 
 	backupAgent = flag.Bool("backup-agent", false, "Use gpbackup_helper as an agent for backup")
 	content = flag.Int("content", -2, "Content ID of the corresponding segment")
+	copyAgent = flag.Bool("copy-agent", false, "Use gpbackup_helper as an agent for copying a backup to another destination")
+	copyToPluginConfigFile = flag.String("copy-to-plugin-config", "", "The configuration file to use for the plugin to copy a backup to")
 	compressionLevel = flag.Int("compression-level", 0, "The level of compression to use with gzip. O indicates no compression.")
 	dataFile = flag.String("data-file", "", "Absolute path to the data file")
 	oidFile = flag.String("oid-file", "", "Absolute path to the file containing a list of oids to restore")
@@ -147,6 +162,15 @@ func getOidListFromFile() ([]int, error) {
 	return oidList, nil
 }
 
+// gpbackup and gprestore read the number of plugin command retries from this file to count them in the report
+func writeRetriesFile(pluginConfig *utils.PluginConfig) error {
+	numRetries := pluginConfig.NumRetries()
+	if numRetries == 0 {
+		return nil
+	}
+	return ioutil.WriteFile(fmt.Sprintf("%s_retries", *pipeFile), []byte(fmt.Sprintf("%d\n", numRetries)), 0644)
+}
+
 func flushAndCloseRestoreWriter() error {
 	if writer != nil {
 		err := writer.Flush()
@@ -172,7 +196,7 @@ func flushAndCloseRestoreWriter() error {
 
 func DoCleanup() {
 	defer CleanupGroup.Done()
-	if wasTerminated {
+	if wasTerminated && !*copyAgent {
 		/*
 		 * If the agent dies during the last table copy, it can still report
 		 * success, so we create an error file and check for its presence in
@@ -2,6 +2,7 @@ package helper
 
 import (
 	"bufio"
+	"bytes"
 	"compress/gzip"
 	"fmt"
 	"io"
@@ -263,6 +264,14 @@ func startRestorePluginCommand(toc *toc.SegmentTOC, oidList []int) (io.Reader, b
 		cmdStr = fmt.Sprintf("%s restore_data %s %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath, *dataFile)
 	}
 	log(fmt.Sprintf("%s", cmdStr))
+	if pluginConfig.BuffersData() {
+		command := "restore_data"
+		if isSubset {
+			command = "restore_data_subset"
+		}
+		readHandle, err := downloadBufferedData(pluginConfig, command, cmdStr)
+		return readHandle, isSubset, err
+	}
 	cmd := exec.Command("bash", "-c", cmdStr)
 
 	readHandle, err := cmd.StdoutPipe()
@@ -274,3 +283,38 @@ func startRestorePluginCommand(toc *toc.SegmentTOC, oidList []int) (io.Reader, b
 	err = cmd.Start()
 	return readHandle, isSubset, err
 }
+
+/*
+ * With buffer_data in the retry section of the plugin config, the data is
+ * restored with the plugin to the local data file before it is read, so that
+ * restore_data can be retried from the start.  The file is removed once it is
+ * opened, so that it is deleted when the helper exits.
+ */
+func downloadBufferedData(pluginConfig *utils.PluginConfig, command string, cmdStr string) (io.Reader, error) {
+	output, err := pluginConfig.RunWithRetries(command, func() (string, error) {
+		dataHandle, err := os.Create(*dataFile)
+		if err != nil {
+			return "", err
+		}
+		defer dataHandle.Close()
+		var stderr bytes.Buffer
+		cmd := exec.Command("bash", "-c", cmdStr)
+		cmd.Stdout = dataHandle
+		cmd.Stderr = &stderr
+		err = cmd.Run()
+		return stderr.String(), err
+	})
+	writeErr := writeRetriesFile(pluginConfig)
+	if err != nil {
+		_ = utils.RemoveFileIfExists(*dataFile)
+		return nil, errors.Wrap(err, strings.TrimSpace(output))
+	}
+	if writeErr != nil {
+		return nil, writeErr
+	}
+	readHandle, err := os.Open(*dataFile)
+	if err != nil {
+		return nil, err
+	}
+	return readHandle, utils.RemoveFileIfExists(*dataFile)
+}
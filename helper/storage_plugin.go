@@ -0,0 +1,202 @@
+package helper
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	path "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * When a plugin config specifies a built-in storage type in place of an
+ * executablepath, gpbackup and gprestore call gpbackup_helper as the plugin,
+ * so it accepts the plugin API commands described in plugins/README.md.
+ */
+
+const storagePluginAPIVersion = utils.PluginCapabilitiesVersion
+
+var storagePluginCapabilities = utils.PluginCapabilities{
+	RestoreSubset: true,
+	DeleteBackup:  true,
+	ListBackups:   true,
+}
+
+func IsStoragePluginCommand(args []string) bool {
+	return len(args) > 0 && !strings.HasPrefix(args[0], "-")
+}
+
+func DoStoragePlugin(args []string) {
+	gplog.InitializeLogging("gpbackup_helper", "")
+	// Plugin commands may stream data to stdout, so only errors are printed
+	gplog.SetVerbosity(gplog.LOGERROR)
+	operating.InitializeSystemFunctions()
+
+	err := runStoragePluginCommand(args[0], args[1:])
+	if err != nil {
+		gplog.Error("%s failed: %v", args[0], err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+func runStoragePluginCommand(command string, args []string) error {
+	numArgs := map[string]int{
+		"setup_plugin_for_backup":    3,
+		"setup_plugin_for_restore":   3,
+		"cleanup_plugin_for_backup":  3,
+		"cleanup_plugin_for_restore": 3,
+		"backup_file":                2,
+		"restore_file":               2,
+		"backup_data":                2,
+		"restore_data":               2,
+		"restore_data_subset":        3,
+		"delete_backup":              2,
+		"list_backups":               1,
+	}
+	switch command {
+	case "plugin_api_version":
+		fmt.Println(storagePluginAPIVersion)
+		return nil
+	case "plugin_capabilities":
+		output, err := yaml.Marshal(storagePluginCapabilities)
+		if err != nil {
+			return err
+		}
+		fmt.Print(string(output))
+		return nil
+	}
+	expectedArgs, ok := numArgs[command]
+	if !ok {
+		return errors.Errorf("Unknown plugin command %s", command)
+	}
+	// The setup and cleanup commands are also passed a content ID for some scopes
+	if len(args) < expectedArgs {
+		return errors.Errorf("Expected %d arguments but found %d", expectedArgs, len(args))
+	}
+	config, err := utils.ReadPluginConfig(args[0])
+	if err != nil {
+		return err
+	}
+	if config.Storage == utils.CopiesStorage {
+		return runCopiesCommand(config, command, args)
+	}
+	s3, err := newStorageClient(config, args[0])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "setup_plugin_for_backup":
+		if utils.PluginScope(args[2]) == utils.MASTER {
+			return s3.CheckBucket()
+		}
+	case "setup_plugin_for_restore":
+		if utils.PluginScope(args[2]) == utils.MASTER {
+			err = s3.CheckBucket()
+			if err != nil {
+				return err
+			}
+		}
+		// gprestore reads the files it restores from the local backup directory
+		return os.MkdirAll(args[1], 0755)
+	case "cleanup_plugin_for_backup", "cleanup_plugin_for_restore":
+		return nil
+	case "backup_file":
+		gplog.Verbose("Uploading %s", args[1])
+		return s3.UploadFile(args[1])
+	case "restore_file":
+		gplog.Verbose("Downloading %s", args[1])
+		err = os.MkdirAll(path.Dir(args[1]), 0755)
+		if err != nil {
+			return err
+		}
+		return s3.DownloadFile(args[1])
+	case "backup_data":
+		gplog.Verbose("Uploading data to %s", args[1])
+		return s3.Upload(s3.KeyForFile(args[1]), bufio.NewReader(os.Stdin))
+	case "restore_data":
+		gplog.Verbose("Downloading data from %s", args[1])
+		return downloadToStdout(func(writer io.Writer) error {
+			return s3.Download(s3.KeyForFile(args[1]), writer)
+		})
+	case "restore_data_subset":
+		offsets, err := readSubsetOffsets(args[2])
+		if err != nil {
+			return err
+		}
+		gplog.Verbose("Downloading %d tables from %s", len(offsets)/2, args[1])
+		return downloadToStdout(func(writer io.Writer) error {
+			for i := 0; i < len(offsets); i += 2 {
+				err := s3.DownloadRange(s3.KeyForFile(args[1]), offsets[i], offsets[i+1], writer)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case "delete_backup":
+		gplog.Verbose("Deleting backup %s", args[1])
+		return s3.DeleteBackup(args[1])
+	case "list_backups":
+		timestamps, err := s3.ListBackups()
+		if err != nil {
+			return err
+		}
+		for _, timestamp := range timestamps {
+			fmt.Println(timestamp)
+		}
+	}
+	return nil
+}
+
+func newStorageClient(config *utils.PluginConfig, configFile string) (*utils.S3Client, error) {
+	if config.Storage != utils.S3Storage {
+		return nil, errors.Errorf("Plugin config %s does not use storage %s", configFile, utils.S3Storage)
+	}
+	return utils.NewS3Client(config.Options)
+}
+
+func downloadToStdout(download func(writer io.Writer) error) error {
+	writer := bufio.NewWriter(os.Stdout)
+	err := download(writer)
+	if err != nil {
+		return err
+	}
+	return writer.Flush()
+}
+
+/*
+ * The offsets file written by the restore agent holds the number of tables
+ * followed by the start and end byte of each, separated by spaces.
+ */
+func readSubsetOffsets(offsetsFile string) ([]int64, error) {
+	contents, err := operating.System.ReadFile(offsetsFile)
+	if err != nil {
+		return nil, err
+	}
+	fields := strings.Fields(string(contents))
+	if len(fields) == 0 {
+		return nil, errors.Errorf("Offsets file %s is empty", offsetsFile)
+	}
+	numTables, err := strconv.Atoi(fields[0])
+	if err != nil || len(fields) != 2*numTables+1 {
+		return nil, errors.Errorf("Offsets file %s is formatted incorrectly", offsetsFile)
+	}
+	offsets := make([]int64, 2*numTables)
+	for i := range offsets {
+		offsets[i], err = strconv.ParseInt(fields[i+1], 10, 64)
+		if err != nil {
+			return nil, errors.Errorf("Offsets file %s is formatted incorrectly", offsetsFile)
+		}
+	}
+	return offsets, nil
+}
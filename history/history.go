@@ -1,6 +1,7 @@
 package history
 
 import (
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -32,17 +33,22 @@ type BackupConfig struct {
 	DatabaseName          string
 	DatabaseVersion       string
 	DataOnly              bool
+	DataSubset            bool
 	DateDeleted           string
+	ExcludeObjectTypes    []string `yaml:",omitempty"`
 	ExcludeRelations      []string
 	ExcludeSchemaFiltered bool
 	ExcludeSchemas        []string
 	ExcludeTableFiltered  bool
+	Format                string `yaml:",omitempty"`
+	IncludeObjectTypes    []string `yaml:",omitempty"`
 	IncludeRelations      []string
 	IncludeSchemaFiltered bool
 	IncludeSchemas        []string
 	IncludeTableFiltered  bool
 	Incremental           bool
 	LeafPartitionData     bool
+	MaskedColumns         []string `yaml:",omitempty"`
 	MetadataOnly          bool
 	Plugin                string
 	PluginVersion         string
@@ -53,12 +59,55 @@ type BackupConfig struct {
 	WithoutGlobals        bool
 	WithStatistics        bool
 	Status                string
+	// The destinations of a backup taken to more than one, such as a --backup-dir and a plugin
+	Copies []BackupCopy `yaml:",omitempty"`
+	// Every flag set on the command line or in the --config file, for reproducing the backup
+	Flags map[string][]string `yaml:",omitempty"`
 }
 
 func (backup *BackupConfig) Failed() bool {
 	return backup.Status == BackupStatusFailed
 }
 
+/*
+ * A backup taken to several destinations is written in full to each of them,
+ * and the copy in one destination may fail while the others succeed, so the
+ * backup can be restored from any copy whose Status is BackupStatusSucceed.
+ * Destination identifies where a plugin stored a copy, as returned by
+ * PluginConfig.Destination, so that copies made with different configs of
+ * the same plugin can be told apart.  Copies recorded before destinations
+ * were recorded only have the name of the plugin.
+ */
+type BackupCopy struct {
+	BackupDir   string `yaml:",omitempty"`
+	Plugin      string `yaml:",omitempty"`
+	Destination string `yaml:",omitempty"`
+	Status      string
+}
+
+func (backupCopy BackupCopy) String() string {
+	if backupCopy.Plugin != "" && backupCopy.Destination != "" {
+		return fmt.Sprintf("plugin %s at %s", backupCopy.Plugin, backupCopy.Destination)
+	} else if backupCopy.Plugin != "" {
+		return fmt.Sprintf("plugin %s", backupCopy.Plugin)
+	} else if backupCopy.BackupDir == "" {
+		return "the segment data directories"
+	}
+	return fmt.Sprintf("backup directory %s", backupCopy.BackupDir)
+}
+
+/*
+ * Returns whether the copy is in the same place as other.  A copy without a
+ * recorded destination is taken to be in the same place as any copy made
+ * with the same plugin.
+ */
+func (backupCopy BackupCopy) SameDestination(other BackupCopy) bool {
+	if backupCopy.Plugin != other.Plugin || filepath.Clean(backupCopy.BackupDir) != filepath.Clean(other.BackupDir) {
+		return false
+	}
+	return backupCopy.Destination == "" || other.Destination == "" || backupCopy.Destination == other.Destination
+}
+
 func ReadConfigFile(filename string) *BackupConfig {
 	config := &BackupConfig{}
 	contents, err := ioutil.ReadFile(filename)
@@ -0,0 +1,275 @@
+package localplugin
+
+/*
+ * This package is a reference implementation of the plugin API described in
+ * plugins/README.md, written as gpbackup_local_plugin.  It stores backups in a
+ * directory on the local filesystem, such as one on shared storage mounted at
+ * the same path on every host, given by the "directory" option:
+ *
+ *   executablepath: /usr/local/greenplum-db/bin/gpbackup_local_plugin
+ *   options:
+ *     directory: /mnt/backups
+ *
+ * Files are stored under <directory>/backups/<date>/<timestamp>/, matching
+ * the backup directory they are written to locally.
+ */
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+var version = "dev"
+
+var capabilities = utils.PluginCapabilities{
+	RestoreSubset: true,
+	DeleteBackup:  true,
+	ListBackups:   true,
+}
+
+type pluginConfig struct {
+	// gpbackup adds other keys, such as capabilities, to the config it copies to each host
+	Options map[string]string `yaml:"options"`
+}
+
+func DoLocalPlugin() {
+	err := Run(os.Args[1:], os.Stdin, os.Stdout)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gpbackup_local_plugin: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+/*
+ * Runs the plugin command in args, reading any data to back up from stdin and
+ * writing any restored data to stdout.
+ */
+func Run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("No command given")
+	}
+	command, args := args[0], args[1:]
+	switch command {
+	case "--version":
+		_, err := fmt.Fprintf(stdout, "gpbackup_local_plugin version %s\n", version)
+		return err
+	case "plugin_api_version":
+		_, err := fmt.Fprintln(stdout, utils.PluginCapabilitiesVersion)
+		return err
+	case "plugin_capabilities":
+		output, err := yaml.Marshal(capabilities)
+		if err != nil {
+			return err
+		}
+		_, err = stdout.Write(output)
+		return err
+	}
+
+	numArgs := map[string]int{
+		"setup_plugin_for_backup":    3,
+		"setup_plugin_for_restore":   3,
+		"cleanup_plugin_for_backup":  3,
+		"cleanup_plugin_for_restore": 3,
+		"backup_file":                2,
+		"restore_file":               2,
+		"backup_data":                2,
+		"restore_data":               2,
+		"restore_data_subset":        3,
+		"delete_backup":              2,
+		"list_backups":               1,
+	}
+	expectedArgs, ok := numArgs[command]
+	if !ok {
+		return errors.Errorf("Unknown command %s", command)
+	}
+	// The setup and cleanup commands are also passed a content ID for some scopes
+	if len(args) < expectedArgs {
+		return errors.Errorf("%s expects %d arguments but found %d", command, expectedArgs, len(args))
+	}
+	directory, err := readDirectory(args[0])
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "setup_plugin_for_backup":
+		return os.MkdirAll(destinationDir(directory, args[1]), 0755)
+	case "setup_plugin_for_restore":
+		// gprestore reads the files it restores from the local backup directory
+		return os.MkdirAll(args[1], 0755)
+	case "cleanup_plugin_for_backup", "cleanup_plugin_for_restore":
+		return nil
+	case "backup_file":
+		return copyFile(args[1], destinationFile(directory, args[1]))
+	case "restore_file":
+		return copyFile(destinationFile(directory, args[1]), args[1])
+	case "backup_data":
+		return writeFile(destinationFile(directory, args[1]), stdin)
+	case "restore_data":
+		file, err := os.Open(destinationFile(directory, args[1]))
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		_, err = io.Copy(stdout, file)
+		return err
+	case "restore_data_subset":
+		return restoreDataSubset(destinationFile(directory, args[1]), args[2], stdout)
+	case "delete_backup":
+		return deleteBackup(directory, args[1])
+	case "list_backups":
+		return listBackups(directory, stdout)
+	}
+	return nil
+}
+
+func readDirectory(configFile string) (string, error) {
+	contents, err := ioutil.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	config := pluginConfig{}
+	err = yaml.Unmarshal(contents, &config)
+	if err != nil {
+		return "", errors.Errorf("Unable to parse plugin config %s: %v", configFile, err)
+	}
+	directory := config.Options["directory"]
+	if !path.IsAbs(directory) {
+		return "", errors.Errorf("The directory option in plugin config %s must be an absolute path", configFile)
+	}
+	return directory, nil
+}
+
+// The local backup directory is <backup dir>/backups/<date>/<timestamp>
+func destinationDir(directory string, localDir string) string {
+	timestampDir := path.Base(localDir)
+	dateDir := path.Base(path.Dir(localDir))
+	return path.Join(directory, "backups", dateDir, timestampDir)
+}
+
+func destinationFile(directory string, localFile string) string {
+	return path.Join(destinationDir(directory, path.Dir(localFile)), path.Base(localFile))
+}
+
+func copyFile(source string, destination string) error {
+	sourceFile, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer sourceFile.Close()
+	return writeFile(destination, sourceFile)
+}
+
+/*
+ * The data is written to a temporary file that is renamed once it is
+ * complete, so that a failed backup never leaves a partial file to restore.
+ */
+func writeFile(filename string, reader io.Reader) error {
+	err := os.MkdirAll(path.Dir(filename), 0755)
+	if err != nil {
+		return err
+	}
+	tempFile, err := ioutil.TempFile(path.Dir(filename), path.Base(filename)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(tempFile, reader)
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), filename)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+	return nil
+}
+
+/*
+ * The offsets file holds the number of ranges followed by the start and end
+ * byte of each, all separated by spaces, and the ranges are written in order.
+ */
+func restoreDataSubset(filename string, offsetsFile string, stdout io.Writer) error {
+	contents, err := ioutil.ReadFile(offsetsFile)
+	if err != nil {
+		return err
+	}
+	fields := strings.Fields(string(contents))
+	numRanges := -1
+	if len(fields) > 0 {
+		numRanges, _ = strconv.Atoi(fields[0])
+	}
+	if numRanges < 0 || len(fields) != 2*numRanges+1 {
+		return errors.Errorf("Offsets file %s is formatted incorrectly", offsetsFile)
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	for i := 1; i < len(fields); i += 2 {
+		start, startErr := strconv.ParseInt(fields[i], 10, 64)
+		end, endErr := strconv.ParseInt(fields[i+1], 10, 64)
+		if startErr != nil || endErr != nil || end < start {
+			return errors.Errorf("Offsets file %s is formatted incorrectly", offsetsFile)
+		}
+		_, err = file.Seek(start, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		_, err = io.CopyN(stdout, file, end-start)
+		if err != nil {
+			return errors.Wrapf(err, "Unable to read bytes %d to %d of %s", start, end, filename)
+		}
+	}
+	return nil
+}
+
+func deleteBackup(directory string, timestamp string) error {
+	if len(timestamp) != 14 {
+		return errors.Errorf("Invalid timestamp %s", timestamp)
+	}
+	dateDir := path.Join(directory, "backups", timestamp[0:8])
+	backupDir := path.Join(dateDir, timestamp)
+	if _, err := os.Stat(backupDir); err != nil {
+		return errors.Errorf("Backup %s not found in %s", timestamp, directory)
+	}
+	err := os.RemoveAll(backupDir)
+	if err != nil {
+		return err
+	}
+	// The date directory is removed with its last backup
+	_ = os.Remove(dateDir)
+	return nil
+}
+
+// Backups are listed in order, as the date and timestamp directories sort by time
+func listBackups(directory string, stdout io.Writer) error {
+	timestampDirs, err := path.Glob(path.Join(directory, "backups", "[0-9]*", "[0-9]*"))
+	if err != nil {
+		return err
+	}
+	for _, timestampDir := range timestampDirs {
+		timestamp := path.Base(timestampDir)
+		if !filepath.IsValidTimestamp(timestamp) || !strings.HasPrefix(timestamp, path.Base(path.Dir(timestampDir))) {
+			continue
+		}
+		_, err = fmt.Fprintln(stdout, timestamp)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package options
+
+/*
+ * This file contains functions for reading flag values from the YAML file
+ * passed to --config.
+ */
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * The config file maps flag names to values, with a list of values for flags
+ * that may be passed more than once, e.g.
+ *
+ *   jobs: 4
+ *   include-table:
+ *     - public.foo
+ *     - public.bar
+ *   profiles:
+ *     nightly:
+ *       incremental: true
+ *       leaf-partition-data: true
+ *
+ * The values of the profile selected with --config-profile override the
+ * values at the top level of the file.
+ */
+type configFile struct {
+	Values   map[string]interface{} `yaml:",inline"`
+	Profiles map[string]map[string]interface{}
+}
+
+// Flags that control where the other flags come from, which the config file may not set
+var nonConfigFlags = []string{CONFIG, CONFIG_PROFILE, DAEMON, SCHEDULE, "help", "version"}
+
+/*
+ * Sets every flag given in the --config file that was not passed on the
+ * command line, so that command-line flags override the file.  Values equal
+ * to a flag's default are ignored, so the file does not set a flag that
+ * conflicts with another flag without changing its value.
+ */
+func ApplyConfigFile(flags *pflag.FlagSet) error {
+	filename := MustGetFlagString(flags, CONFIG)
+	profile := MustGetFlagString(flags, CONFIG_PROFILE)
+	if filename == "" {
+		if profile != "" {
+			return errors.Errorf("--%s must be specified with --%s", CONFIG, CONFIG_PROFILE)
+		}
+		return nil
+	}
+	values, err := ReadConfigFile(filename, profile)
+	if err != nil {
+		return err
+	}
+	for _, name := range sortedFlagNames(values) {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return errors.Errorf("Unknown flag %s in config file %s", name, filename)
+		}
+		if flags.Changed(name) || isDefaultValue(flag, values[name]) {
+			delete(values, name)
+		}
+	}
+	err = SetFlagValues(flags, values)
+	if err != nil {
+		return errors.Wrapf(err, "Invalid config file %s", filename)
+	}
+	return nil
+}
+
+/*
+ * Returns the flag values in the config file, with those of the given profile
+ * in place of any at the top level of the file, keyed by flag name in the form
+ * taken by SetFlagValues.
+ */
+func ReadConfigFile(filename string, profile string) (map[string][]string, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	config := configFile{}
+	err = yaml.UnmarshalStrict(contents, &config)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse config file %s: %v", filename, err)
+	}
+	fileValues := config.Values
+	if profile != "" {
+		profileValues, ok := config.Profiles[profile]
+		if !ok {
+			return nil, errors.Errorf("Profile %s not found in config file %s", profile, filename)
+		}
+		fileValues = make(map[string]interface{})
+		for name, value := range config.Values {
+			fileValues[name] = value
+		}
+		for name, value := range profileValues {
+			fileValues[name] = value
+		}
+	}
+
+	for name := range fileValues {
+		for _, nonConfigFlag := range nonConfigFlags {
+			if name == nonConfigFlag {
+				return nil, errors.Errorf("Flag %s may not be set in config file %s", name, filename)
+			}
+		}
+	}
+	values, err := ParseYAMLFlagValues(fileValues)
+	if err != nil {
+		return nil, errors.Wrapf(err, "Invalid config file %s", filename)
+	}
+	return values, nil
+}
+
+/*
+ * Converts flag values read from YAML, each of which is a single value or a
+ * list of values, to the form taken by SetFlagValues.
+ */
+func ParseYAMLFlagValues(yamlValues map[string]interface{}) (map[string][]string, error) {
+	values := make(map[string][]string)
+	for name, value := range yamlValues {
+		var err error
+		values[name], err = configValueToStrings(value)
+		if err != nil {
+			return nil, errors.Errorf("Invalid value for flag %s: %v", name, err)
+		}
+	}
+	return values, nil
+}
+
+func configValueToStrings(value interface{}) ([]string, error) {
+	switch value := value.(type) {
+	case nil:
+		return []string{}, nil
+	case []interface{}:
+		values := make([]string, len(value))
+		for i, element := range value {
+			elementValues, err := configValueToStrings(element)
+			if err != nil {
+				return nil, err
+			}
+			if len(elementValues) != 1 {
+				return nil, errors.New("lists may only contain single values")
+			}
+			values[i] = elementValues[0]
+		}
+		return values, nil
+	case map[interface{}]interface{}:
+		return nil, errors.New("expected a single value or a list of values")
+	default:
+		return []string{fmt.Sprintf("%v", value)}, nil
+	}
+}
+
+func isDefaultValue(flag *pflag.Flag, values []string) bool {
+	if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+		return len(values) == 0 && len(sliceValue.GetSlice()) == 0
+	}
+	return len(values) == 1 && values[0] == flag.DefValue
+}
+
+/*
+ * Returns the values of every flag that was set on the command line or in the
+ * config file, in the form taken by SetFlagValues, so that the same flags can
+ * be passed again without the config file.
+ */
+func GetFlagValues(flags *pflag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+	flags.Visit(func(flag *pflag.Flag) {
+		for _, nonConfigFlag := range nonConfigFlags {
+			if flag.Name == nonConfigFlag {
+				return
+			}
+		}
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			values[flag.Name] = sliceValue.GetSlice()
+		} else {
+			values[flag.Name] = []string{flag.Value.String()}
+		}
+	})
+	return values
+}
@@ -0,0 +1,159 @@
+package options_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/spf13/pflag"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("options/config tests", func() {
+	var (
+		myflags    *pflag.FlagSet
+		configFile string
+	)
+	writeConfigFile := func(contents string) {
+		file, err := ioutil.TempFile("/tmp", "gpbackup_test_config*.yaml")
+		Expect(err).To(Not(HaveOccurred()))
+		_, err = file.WriteString(contents)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(file.Close()).To(Succeed())
+		configFile = file.Name()
+		Expect(myflags.Set(options.CONFIG, configFile)).To(Succeed())
+	}
+	BeforeEach(func() {
+		myflags = &pflag.FlagSet{}
+		options.SetBackupFlagDefaults(myflags)
+		configFile = ""
+	})
+	AfterEach(func() {
+		if configFile != "" {
+			_ = os.Remove(configFile)
+		}
+	})
+	Describe("ApplyConfigFile", func() {
+		It("does nothing if no config file is given", func() {
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(options.GetFlagValues(myflags)).To(BeEmpty())
+		})
+		It("sets the flags in the config file", func() {
+			writeConfigFile(`
+dbname: testdb
+jobs: 4
+with-stats: true
+include-table:
+  - public.foo
+  - public.bar
+`)
+
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(options.MustGetFlagString(myflags, options.DBNAME)).To(Equal("testdb"))
+			Expect(options.MustGetFlagInt(myflags, options.JOBS)).To(Equal(4))
+			Expect(options.MustGetFlagBool(myflags, options.WITH_STATS)).To(BeTrue())
+			Expect(options.MustGetFlagStringArray(myflags, options.INCLUDE_RELATION)).To(Equal([]string{"public.foo", "public.bar"}))
+			Expect(myflags.Changed(options.JOBS)).To(BeTrue())
+		})
+		It("does not override flags passed on the command line", func() {
+			Expect(myflags.Parse([]string{"--jobs", "8", "--include-table", "public.baz"})).To(Succeed())
+			writeConfigFile("dbname: testdb\njobs: 4\ninclude-table:\n  - public.foo\n")
+
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(options.MustGetFlagString(myflags, options.DBNAME)).To(Equal("testdb"))
+			Expect(options.MustGetFlagInt(myflags, options.JOBS)).To(Equal(8))
+			Expect(options.MustGetFlagStringArray(myflags, options.INCLUDE_RELATION)).To(Equal([]string{"public.baz"}))
+		})
+		It("does not set flags to their default values", func() {
+			writeConfigFile("jobs: 1\nmetadata-only: false\ninclude-table: []\n")
+
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(myflags.Changed(options.JOBS)).To(BeFalse())
+			Expect(myflags.Changed(options.METADATA_ONLY)).To(BeFalse())
+			Expect(myflags.Changed(options.INCLUDE_RELATION)).To(BeFalse())
+		})
+		It("uses the values of the selected profile in place of the other values", func() {
+			writeConfigFile(`
+dbname: testdb
+jobs: 4
+profiles:
+  nightly:
+    jobs: 8
+    backup-dir: /nightly
+  weekly:
+    jobs: 2
+`)
+			Expect(myflags.Set(options.CONFIG_PROFILE, "nightly")).To(Succeed())
+
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(options.MustGetFlagString(myflags, options.DBNAME)).To(Equal("testdb"))
+			Expect(options.MustGetFlagInt(myflags, options.JOBS)).To(Equal(8))
+			Expect(options.MustGetFlagString(myflags, options.BACKUP_DIR)).To(Equal("/nightly"))
+		})
+		It("returns an error if the profile is not in the config file", func() {
+			writeConfigFile("dbname: testdb\nprofiles:\n  nightly:\n    jobs: 8\n")
+			Expect(myflags.Set(options.CONFIG_PROFILE, "weekly")).To(Succeed())
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Profile weekly not found in config file %s", configFile)))
+		})
+		It("returns an error if a profile is selected without a config file", func() {
+			Expect(myflags.Set(options.CONFIG_PROFILE, "nightly")).To(Succeed())
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError("--config must be specified with --config-profile"))
+		})
+		It("returns an error for an unknown flag", func() {
+			writeConfigFile("dbname: testdb\nnot-a-flag: true\n")
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Unknown flag not-a-flag in config file %s", configFile)))
+		})
+		It("returns an error if the config file sets --config", func() {
+			writeConfigFile("config: /tmp/other.yaml\n")
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Flag config may not be set in config file %s", configFile)))
+		})
+		It("returns an error if a flag is given a mapping", func() {
+			writeConfigFile("include-table:\n  public: foo\n")
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid config file %s: Invalid value for flag include-table: expected a single value or a list of values", configFile)))
+		})
+		It("returns an error if a flag that may only be passed once is given a list", func() {
+			writeConfigFile("dbname:\n  - db1\n  - db2\n")
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Invalid config file %s: Flag --dbname takes exactly one value", configFile)))
+		})
+		It("returns an error for an invalid value", func() {
+			writeConfigFile("jobs: many\n")
+
+			err := options.ApplyConfigFile(myflags)
+			Expect(err).To(MatchError(ContainSubstring(fmt.Sprintf(`Invalid config file %s: Invalid value "many" for flag --jobs`, configFile))))
+		})
+	})
+	Describe("GetFlagValues", func() {
+		It("returns the values of the flags that were set, other than the config file flags", func() {
+			Expect(myflags.Parse([]string{"--dbname", "testdb", "--include-table", "public.foo", "--include-table", "public.bar"})).To(Succeed())
+			writeConfigFile("jobs: 4\nwith-stats: true\n")
+			Expect(options.ApplyConfigFile(myflags)).To(Succeed())
+
+			Expect(options.GetFlagValues(myflags)).To(Equal(map[string][]string{
+				options.DBNAME:           {"testdb"},
+				options.INCLUDE_RELATION: {"public.foo", "public.bar"},
+				options.JOBS:             {"4"},
+				options.WITH_STATS:       {"true"},
+			}))
+		})
+	})
+})
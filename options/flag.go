@@ -6,6 +6,7 @@ package options
 
 import (
 	"regexp"
+	"sort"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -14,66 +15,123 @@ import (
 )
 
 const (
-	BACKUP_DIR            = "backup-dir"
-	COMPRESSION_LEVEL     = "compression-level"
-	DATA_ONLY             = "data-only"
-	DBNAME                = "dbname"
-	DEBUG                 = "debug"
-	EXCLUDE_RELATION      = "exclude-table"
-	EXCLUDE_RELATION_FILE = "exclude-table-file"
-	EXCLUDE_SCHEMA        = "exclude-schema"
-	EXCLUDE_SCHEMA_FILE   = "exclude-schema-file"
-	FROM_TIMESTAMP        = "from-timestamp"
-	INCLUDE_RELATION      = "include-table"
-	INCLUDE_RELATION_FILE = "include-table-file"
-	INCLUDE_SCHEMA        = "include-schema"
-	INCLUDE_SCHEMA_FILE   = "include-schema-file"
-	INCREMENTAL           = "incremental"
-	JOBS                  = "jobs"
-	LEAF_PARTITION_DATA   = "leaf-partition-data"
-	METADATA_ONLY         = "metadata-only"
-	NO_COMPRESSION        = "no-compression"
-	PLUGIN_CONFIG         = "plugin-config"
-	QUIET                 = "quiet"
-	SINGLE_DATA_FILE      = "single-data-file"
-	VERBOSE               = "verbose"
-	WITH_STATS            = "with-stats"
-	CREATE_DB             = "create-db"
-	ON_ERROR_CONTINUE     = "on-error-continue"
-	REDIRECT_DB           = "redirect-db"
-	RUN_ANALYZE           = "run-analyze"
-	TIMESTAMP             = "timestamp"
-	WITH_GLOBALS          = "with-globals"
-	REDIRECT_SCHEMA       = "redirect-schema"
-	TRUNCATE_TABLE        = "truncate-table"
-	WITHOUT_GLOBALS       = "without-globals"
+	BACKUP_DIR               = "backup-dir"
+	BACKUP_DIR_MAP_FILE      = "backup-dir-map-file"
+	COMPRESSION_LEVEL        = "compression-level"
+	CONFIG                   = "config"
+	CONFIG_PROFILE           = "config-profile"
+	COPY_PLUGIN_CONFIG       = "copy-plugin-config"
+	COPY_TIMEOUT             = "copy-timeout"
+	COPY_TO_DIR              = "copy-to-dir"
+	COPY_TO_PLUGIN_CONFIG    = "copy-to-plugin-config"
+	DAEMON                   = "daemon"
+	DATA_ONLY                = "data-only"
+	DBNAME                   = "dbname"
+	DEBUG                    = "debug"
+	DIFF                     = "diff"
+	DIFF_FORMAT              = "diff-format"
+	DIFF_TIMESTAMP           = "diff-timestamp"
+	EXCLUDE_OBJECT_TYPE      = "exclude-object-type"
+	EXCLUDE_RELATION         = "exclude-table"
+	EXCLUDE_RELATION_FILE    = "exclude-table-file"
+	EXCLUDE_RELATION_PATTERN = "exclude-table-pattern"
+	EXCLUDE_SCHEMA           = "exclude-schema"
+	EXCLUDE_SCHEMA_FILE      = "exclude-schema-file"
+	EXCLUDE_SCHEMA_PATTERN   = "exclude-schema-pattern"
+	FORMAT                   = "format"
+	FROM_TIMESTAMP           = "from-timestamp"
+	INCLUDE_OBJECT_TYPE      = "include-object-type"
+	INCLUDE_RELATION         = "include-table"
+	INCLUDE_RELATION_FILE    = "include-table-file"
+	INCLUDE_RELATION_PATTERN = "include-table-pattern"
+	INCLUDE_SCHEMA           = "include-schema"
+	INCLUDE_SCHEMA_FILE      = "include-schema-file"
+	INCLUDE_SCHEMA_PATTERN   = "include-schema-pattern"
+	INCREMENTAL              = "incremental"
+	JOBS                     = "jobs"
+	LEAF_PARTITION_DATA      = "leaf-partition-data"
+	MASKING_CONFIG           = "masking-config"
+	METADATA_ONLY            = "metadata-only"
+	NO_COMPRESSION           = "no-compression"
+	PLUGIN_CONFIG            = "plugin-config"
+	QUIET                    = "quiet"
+	SCHEDULE                 = "schedule"
+	SINGLE_DATA_FILE         = "single-data-file"
+	TABLE_PREDICATE_FILE     = "table-predicate-file"
+	TIMEOUT                  = "timeout"
+	VERBOSE                  = "verbose"
+	WITH_STATS               = "with-stats"
+	CREATE_DB                = "create-db"
+	LIST                     = "list"
+	MIGRATE_FROM_DBNAME      = "migrate-from-dbname"
+	MIGRATE_FROM_HOST        = "migrate-from-host"
+	MIGRATE_FROM_PORT        = "migrate-from-port"
+	ON_ERROR_CONTINUE        = "on-error-continue"
+	PRINT_DDL                = "print-ddl"
+	PRINT_DDL_FILE           = "print-ddl-file"
+	REBUILD_HISTORY          = "rebuild-history"
+	REDIRECT_DB              = "redirect-db"
+	RUN_ANALYZE              = "run-analyze"
+	TIMESTAMP                = "timestamp"
+	WITH_GLOBALS             = "with-globals"
+	REDIRECT_SCHEMA          = "redirect-schema"
+	REDIRECT_TABLE           = "redirect-table"
+	TRUNCATE_TABLE           = "truncate-table"
+	USE_LIST                 = "use-list"
+	WITHOUT_GLOBALS          = "without-globals"
+)
+
+const (
+	FORMAT_DIRECTORY = "directory"
+	FORMAT_PLAIN     = "plain"
+)
+
+const (
+	DIFF_FORMAT_TEXT = "text"
+	DIFF_FORMAT_JSON = "json"
 )
 
 func SetBackupFlagDefaults(flagSet *pflag.FlagSet) {
-	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written")
+	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory to which all backup files will be written. With --plugin-config, a full copy of the backup is kept there as well.")
+	flagSet.String(CONFIG, "", "A YAML file mapping flag names to values, e.g. \"jobs: 4\", which sets the flags not passed on the command line. Named sets of values under \"profiles\" in the file may be selected with --config-profile.")
+	flagSet.String(CONFIG_PROFILE, "", "The profile in the --config file whose values override the other values in the file")
 	flagSet.Int(COMPRESSION_LEVEL, 1, "Level of compression to use during data backup. Valid values are between 1 and 9.")
+	flagSet.StringArray(COPY_PLUGIN_CONFIG, []string{}, "The configuration file of another plugin to write a full copy of the backup with, in addition to --plugin-config. --copy-plugin-config can be specified multiple times.")
+	flagSet.Int(COPY_TIMEOUT, 0, "Cancel the backup if the data of any one table takes more than this many seconds to back up. 0 means no timeout.")
+	flagSet.Bool(DAEMON, false, "Run until terminated, taking the backups in the --schedule file when they are due")
 	flagSet.Bool(DATA_ONLY, false, "Only back up data, do not back up metadata")
 	flagSet.String(DBNAME, "", "The database to be backed up")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
+	flagSet.StringArray(EXCLUDE_OBJECT_TYPE, []string{}, "Back up all metadata except objects of the specified type(s), e.g. FUNCTION, TRIGGER, ACL, or COMMENT. --exclude-object-type can be specified multiple times.")
 	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Back up all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas to be excluded from the backup")
+	flagSet.StringArray(EXCLUDE_SCHEMA_PATTERN, []string{}, "Back up all metadata except objects in schemas matching the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --exclude-schema-pattern can be specified multiple times.")
 	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Back up all metadata except the specified table(s). --exclude-table can be specified multiple times.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be excluded from the backup")
+	flagSet.StringArray(EXCLUDE_RELATION_PATTERN, []string{}, "Back up all metadata except tables whose fully-qualified names match the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales.orders_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --exclude-table-pattern can be specified multiple times.")
+	flagSet.String(FORMAT, FORMAT_DIRECTORY, "The format of the backup. \"directory\" writes data files on each segment for use with gprestore, \"plain\" writes a single SQL script that can be replayed with psql.")
 	flagSet.String(FROM_TIMESTAMP, "", "A timestamp to use to base the current incremental backup off")
 	flagSet.Bool("help", false, "Help for gpbackup")
+	flagSet.StringArray(INCLUDE_OBJECT_TYPE, []string{}, "Back up only metadata for objects of the specified type(s), e.g. TABLE, VIEW, or INDEX. --include-object-type can be specified multiple times.")
 	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Back up only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schema(s) to be included in the backup")
+	flagSet.StringArray(INCLUDE_SCHEMA_PATTERN, []string{}, "Back up only schemas matching the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --include-schema-pattern can be specified multiple times.")
 	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Back up only the specified table(s). --include-table can be specified multiple times.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified tables to be included in the backup")
+	flagSet.StringArray(INCLUDE_RELATION_PATTERN, []string{}, "Back up only tables whose fully-qualified names match the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales.orders_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --include-table-pattern can be specified multiple times.")
 	flagSet.Bool(INCREMENTAL, false, "Only back up data for AO tables that have been modified since the last backup")
 	flagSet.Int(JOBS, 1, "The number of parallel connections to use when backing up data")
 	flagSet.Bool(LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
+	flagSet.String(MASKING_CONFIG, "", "A YAML file mapping fully-qualified columns to masking rules (null, hash, fixed, or fake). Masked columns are anonymized in the backed up data.")
 	flagSet.Bool(METADATA_ONLY, false, "Only back up metadata, do not back up data")
 	flagSet.Bool(NO_COMPRESSION, false, "Disable compression of data files")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.String(SCHEDULE, "", "A YAML file listing the backups to take with --daemon, each with a cron-style schedule and the flags to back up with")
 	flagSet.Bool(SINGLE_DATA_FILE, false, "Back up all data to a single file instead of one per table")
+	flagSet.String(TABLE_PREDICATE_FILE, "", "A YAML file mapping fully-qualified tables to WHERE clauses. Only rows matching a table's predicate are backed up, and the backup is marked as a data subset.")
+	flagSet.Int(TIMEOUT, 0, "Cancel the backup if it takes more than this many seconds. 0 means no timeout.")
 	flagSet.Bool(VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(WITH_STATS, false, "Back up query plan statistics")
 	flagSet.Bool(WITHOUT_GLOBALS, false, "Disable backup of global metadata")
@@ -81,30 +139,55 @@ func SetBackupFlagDefaults(flagSet *pflag.FlagSet) {
 
 func SetRestoreFlagDefaults(flagSet *pflag.FlagSet) {
 	flagSet.String(BACKUP_DIR, "", "The absolute path of the directory in which the backup files to be restored are located")
+	flagSet.String(BACKUP_DIR_MAP_FILE, "", "A YAML file mapping each host to the content IDs on it and the absolute path of the directory of each, e.g. \"sdw1: {0: /mnt/seg0}\", in which the backup files to be restored are located in place of <backup-dir>/<segment prefix><content ID>")
+	flagSet.String(CONFIG, "", "A YAML file mapping flag names to values, e.g. \"jobs: 4\", which sets the flags not passed on the command line. Named sets of values under \"profiles\" in the file may be selected with --config-profile.")
+	flagSet.String(CONFIG_PROFILE, "", "The profile in the --config file whose values override the other values in the file")
+	flagSet.Int(COPY_TIMEOUT, 0, "Cancel the restore if the data of any one table takes more than this many seconds to restore. 0 means no timeout.")
+	flagSet.String(COPY_TO_DIR, "", "Copy the backup with --timestamp from its backup directory or the plugin in --plugin-config to this directory, verify the copy, record it in the backup history file, and exit")
+	flagSet.String(COPY_TO_PLUGIN_CONFIG, "", "Copy the backup with --timestamp from its backup directory or the plugin in --plugin-config to the plugin in this config, verify the copy, record it in the backup history file, and exit")
 	flagSet.Bool(CREATE_DB, false, "Create the database before metadata restore")
 	flagSet.Bool(DATA_ONLY, false, "Only restore data, do not restore metadata")
 	flagSet.Bool(DEBUG, false, "Print verbose and debug log messages")
+	flagSet.Bool(DIFF, false, "Compare the metadata in the backup with the metadata of the database it would be restored into, print the objects that were added, removed, or changed, and exit")
+	flagSet.String(DIFF_FORMAT, DIFF_FORMAT_TEXT, "The format in which --diff prints the differences, text or json")
+	flagSet.String(DIFF_TIMESTAMP, "", "With --diff, compare the backup with the backup with this timestamp instead of with a database, including the rows copied for each table and the incremental metadata of append-optimized tables")
+	flagSet.StringArray(EXCLUDE_OBJECT_TYPE, []string{}, "Restore all metadata except objects of the specified type(s), e.g. FUNCTION, TRIGGER, ACL, or COMMENT. --exclude-object-type can be specified multiple times.")
 	flagSet.StringArray(EXCLUDE_SCHEMA, []string{}, "Restore all metadata except objects in the specified schema(s). --exclude-schema can be specified multiple times.")
 	flagSet.String(EXCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will not be restored")
+	flagSet.StringArray(EXCLUDE_SCHEMA_PATTERN, []string{}, "Restore all metadata except objects in schemas matching the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --exclude-schema-pattern can be specified multiple times.")
 	flagSet.StringArray(EXCLUDE_RELATION, []string{}, "Restore all metadata except the specified relation(s). --exclude-table can be specified multiple times.")
 	flagSet.String(EXCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will not be restored")
+	flagSet.StringArray(EXCLUDE_RELATION_PATTERN, []string{}, "Restore all metadata except relations whose fully-qualified names match the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales.orders_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --exclude-table-pattern can be specified multiple times.")
 	flagSet.Bool("help", false, "Help for gprestore")
+	flagSet.StringArray(INCLUDE_OBJECT_TYPE, []string{}, "Restore only metadata for objects of the specified type(s), e.g. TABLE, VIEW, or INDEX. --include-object-type can be specified multiple times.")
 	flagSet.StringArray(INCLUDE_SCHEMA, []string{}, "Restore only the specified schema(s). --include-schema can be specified multiple times.")
 	flagSet.String(INCLUDE_SCHEMA_FILE, "", "A file containing a list of schemas that will be restored")
+	flagSet.StringArray(INCLUDE_SCHEMA_PATTERN, []string{}, "Restore only schemas matching the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --include-schema-pattern can be specified multiple times.")
 	flagSet.StringArray(INCLUDE_RELATION, []string{}, "Restore only the specified relation(s). --include-table can be specified multiple times.")
 	flagSet.String(INCLUDE_RELATION_FILE, "", "A file containing a list of fully-qualified relation(s) that will be restored")
+	flagSet.StringArray(INCLUDE_RELATION_PATTERN, []string{}, "Restore only relations whose fully-qualified names match the specified pattern(s). Each pattern must start with \"glob:\" for a shell-style glob, e.g. \"glob:sales.orders_*\", or \"regex:\" for a regular expression, e.g. \"regex:tmp_[0-9]+\". --include-table-pattern can be specified multiple times.")
 	flagSet.Bool(INCREMENTAL, false, "BETA FEATURE: Only restore data for all heap tables and only AO tables that have been modified since the last backup")
 	flagSet.Bool(METADATA_ONLY, false, "Only restore metadata, do not restore data")
 	flagSet.Int(JOBS, 1, "Number of parallel connections to use when restoring table data and post-data")
+	flagSet.Bool(LIST, false, "Print a numbered list of the metadata and data entries in the backup and exit, for use with --use-list")
+	flagSet.String(MIGRATE_FROM_DBNAME, "", "Restore this database of another cluster directly, streaming the data of each table from its segments into the segments of this cluster, instead of restoring a backup")
+	flagSet.String(MIGRATE_FROM_HOST, "", "The coordinator host of the cluster to migrate --migrate-from-dbname from.  Defaults to PGHOST.")
+	flagSet.Int(MIGRATE_FROM_PORT, 0, "The coordinator port of the cluster to migrate --migrate-from-dbname from.  Defaults to PGPORT.")
 	flagSet.Bool(ON_ERROR_CONTINUE, false, "Log errors and continue restore, instead of exiting on first error")
 	flagSet.String(PLUGIN_CONFIG, "", "The configuration file to use for a plugin")
+	flagSet.Bool(PRINT_DDL, false, "Print the metadata statements in the backup that would be restored and exit, without connecting to a database")
+	flagSet.String(PRINT_DDL_FILE, "", "The file to which --print-ddl writes the metadata statements, instead of stdout")
 	flagSet.Bool("version", false, "Print version number and exit")
 	flagSet.Bool(QUIET, false, "Suppress non-warning, non-error log messages")
+	flagSet.Bool(REBUILD_HISTORY, false, "Add the backups stored through the plugin in --plugin-config that are missing from the backup history file to it, such as to recover a lost history file, and exit")
 	flagSet.String(REDIRECT_DB, "", "Restore to the specified database instead of the database that was backed up")
 	flagSet.String(REDIRECT_SCHEMA, "", "Restore to the specified schema instead of the schema that was backed up")
+	flagSet.String(REDIRECT_TABLE, "", "Restore the table given with --include-table under the specified name instead of the name it was backed up with")
 	flagSet.Bool(WITH_GLOBALS, false, "Restore global metadata")
+	flagSet.Int(TIMEOUT, 0, "Cancel the restore if it takes more than this many seconds. 0 means no timeout.")
 	flagSet.String(TIMESTAMP, "", "The timestamp to be restored, in the format YYYYMMDDHHMMSS")
 	flagSet.Bool(TRUNCATE_TABLE, false, "Removes data of the tables getting restored")
+	flagSet.String(USE_LIST, "", "A file in the format printed by --list. Only the entries left uncommented are restored, in the order they appear in the file.")
 	flagSet.Bool(VERBOSE, false, "Print verbose log messages")
 	flagSet.Bool(WITH_STATS, false, "Restore query plan statistics")
 	flagSet.Bool(LEAF_PARTITION_DATA, false, "For partition tables, create one data file per leaf partition instead of one data file for the whole table")
@@ -147,6 +230,58 @@ func HandleSingleDashes(args []string) []string {
 	return newArgs
 }
 
+/*
+ * Sets flags from values keyed by flag name, as if they had been passed on the
+ * command line, for callers that do not parse command-line arguments.  Flags
+ * that may be passed more than once take each of their values in turn, and
+ * all other flags must have exactly one value.
+ */
+func SetFlagValues(flags *pflag.FlagSet, values map[string][]string) error {
+	for _, name := range sortedFlagNames(values) {
+		flag := flags.Lookup(name)
+		if flag == nil {
+			return errors.Errorf("Unknown flag: --%s", name)
+		}
+		isRepeatable := flag.Value.Type() == "stringArray" || flag.Value.Type() == "stringSlice"
+		if !isRepeatable && len(values[name]) != 1 {
+			return errors.Errorf("Flag --%s takes exactly one value", name)
+		}
+		for _, value := range values[name] {
+			if err := flags.Set(name, value); err != nil {
+				return errors.Wrapf(err, "Invalid value %q for flag --%s", value, name)
+			}
+		}
+	}
+	return nil
+}
+
+/*
+ * Returns the values of the flags that were set, keyed by flag name in the
+ * form SetFlagValues takes, so that flags parsed from the command line can be
+ * passed on to a backup or restore run in the same process.
+ */
+func GetSetFlagValues(flags *pflag.FlagSet) map[string][]string {
+	values := make(map[string][]string)
+	flags.Visit(func(flag *pflag.Flag) {
+		if sliceValue, ok := flag.Value.(pflag.SliceValue); ok {
+			values[flag.Name] = sliceValue.GetSlice()
+		} else {
+			values[flag.Name] = []string{flag.Value.String()}
+		}
+	})
+	return values
+}
+
+// Returns the names of the flags in values in sorted order
+func sortedFlagNames(values map[string][]string) []string {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 func MustGetFlagString(cmdFlags *pflag.FlagSet, flagName string) string {
 	value, err := cmdFlags.GetString(flagName)
 	gplog.FatalOnError(err)
@@ -39,6 +39,54 @@ var _ = Describe("utils/flag tests", func() {
 				options.CheckExclusiveFlags(flagSet, "stringFlag", "boolFlag")
 			})
 		})
+		Context("SetFlagValues", func() {
+			BeforeEach(func() {
+				_ = flagSet.StringArray("arrayFlag", []string{}, "This is a sample string array flag.")
+			})
+			It("sets flags as if they were passed on the command line", func() {
+				err := options.SetFlagValues(flagSet, map[string][]string{"stringFlag": {"foo"}, "boolFlag": {"true"}, "arrayFlag": {"bar", "baz"}})
+
+				Expect(err).ToNot(HaveOccurred())
+				Expect(options.MustGetFlagString(flagSet, "stringFlag")).To(Equal("foo"))
+				Expect(options.MustGetFlagBool(flagSet, "boolFlag")).To(BeTrue())
+				Expect(options.MustGetFlagStringArray(flagSet, "arrayFlag")).To(Equal([]string{"bar", "baz"}))
+				Expect(flagSet.Changed("stringFlag")).To(BeTrue())
+				Expect(flagSet.Changed("intFlag")).To(BeFalse())
+			})
+			It("returns an error for an unknown flag", func() {
+				err := options.SetFlagValues(flagSet, map[string][]string{"unknownFlag": {"foo"}})
+
+				Expect(err).To(MatchError("Unknown flag: --unknownFlag"))
+			})
+			It("returns an error if a flag that may only be passed once has several values", func() {
+				err := options.SetFlagValues(flagSet, map[string][]string{"stringFlag": {"foo", "bar"}})
+
+				Expect(err).To(MatchError("Flag --stringFlag takes exactly one value"))
+			})
+			It("returns an error for an invalid value", func() {
+				err := options.SetFlagValues(flagSet, map[string][]string{"intFlag": {"foo"}})
+
+				Expect(err).To(HaveOccurred())
+				Expect(err.Error()).To(HavePrefix(`Invalid value "foo" for flag --intFlag`))
+			})
+		})
+		Context("GetSetFlagValues", func() {
+			BeforeEach(func() {
+				_ = flagSet.StringArray("arrayFlag", []string{}, "This is a sample string array flag.")
+			})
+			It("returns the values of the flags that were set in the form SetFlagValues takes", func() {
+				Expect(flagSet.Parse([]string{"--stringFlag", "foo", "--arrayFlag", "bar", "--arrayFlag", "baz,qux"})).To(Succeed())
+
+				values := options.GetSetFlagValues(flagSet)
+
+				Expect(values).To(Equal(map[string][]string{"stringFlag": {"foo"}, "arrayFlag": {"bar", "baz,qux"}}))
+				otherFlagSet := pflag.NewFlagSet("otherFlags", pflag.ContinueOnError)
+				_ = otherFlagSet.String("stringFlag", "", "This is a sample string flag.")
+				_ = otherFlagSet.StringArray("arrayFlag", []string{}, "This is a sample string array flag.")
+				Expect(options.SetFlagValues(otherFlagSet, values)).To(Succeed())
+				Expect(options.MustGetFlagStringArray(otherFlagSet, "arrayFlag")).To(Equal([]string{"bar", "baz,qux"}))
+			})
+		})
 		Context("HandleSingleDashes", func() {
 			It("replaces single dash at beginning of command", func() {
 				result := options.HandleSingleDashes([]string{"-some_flag", "some_argument"})
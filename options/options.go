@@ -2,13 +2,18 @@ package options
 
 import (
 	"fmt"
+	"io/ioutil"
+	"regexp"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/toc"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v2"
 )
 
 // This is meant to be a read only package. Values inside should only be
@@ -22,6 +27,15 @@ type Options struct {
 	IncludedSchemas           []string
 	originalIncludedRelations []string
 	RedirectSchema            string
+	RedirectTable             string
+	IncludedObjectTypes       []string
+	ExcludedObjectTypes       []string
+	IncludedRelationPatterns  []string
+	ExcludedRelationPatterns  []string
+	IncludedSchemaPatterns    []string
+	ExcludedSchemaPatterns    []string
+	TablePredicates           map[string]string
+	ColumnMasks               map[string]ColumnMask
 }
 
 func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
@@ -66,6 +80,42 @@ func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
 		}
 	}
 
+	redirectTable := ""
+	if initialFlags.Lookup(REDIRECT_TABLE) != nil {
+		redirectTable, err = initialFlags.GetString(REDIRECT_TABLE)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	includedObjectTypes, err := getObjectTypeFilters(initialFlags, INCLUDE_OBJECT_TYPE)
+	if err != nil {
+		return nil, err
+	}
+
+	excludedObjectTypes, err := getObjectTypeFilters(initialFlags, EXCLUDE_OBJECT_TYPE)
+	if err != nil {
+		return nil, err
+	}
+
+	patterns := make(map[string][]string)
+	for _, patternFlag := range []string{INCLUDE_RELATION_PATTERN, EXCLUDE_RELATION_PATTERN, INCLUDE_SCHEMA_PATTERN, EXCLUDE_SCHEMA_PATTERN} {
+		patterns[patternFlag], err = getFilterPatterns(initialFlags, patternFlag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	tablePredicates, err := getTablePredicates(initialFlags)
+	if err != nil {
+		return nil, err
+	}
+
+	columnMasks, err := getColumnMasks(initialFlags)
+	if err != nil {
+		return nil, err
+	}
+
 	return &Options{
 		IncludedRelations:         includedRelations,
 		ExcludedRelations:         excludedRelations,
@@ -74,9 +124,164 @@ func NewOptions(initialFlags *pflag.FlagSet) (*Options, error) {
 		isLeafPartitionData:       leafPartitionData,
 		originalIncludedRelations: includedRelations,
 		RedirectSchema:            redirectSchema,
+		RedirectTable:             redirectTable,
+		IncludedObjectTypes:       includedObjectTypes,
+		ExcludedObjectTypes:       excludedObjectTypes,
+		IncludedRelationPatterns:  patterns[INCLUDE_RELATION_PATTERN],
+		ExcludedRelationPatterns:  patterns[EXCLUDE_RELATION_PATTERN],
+		IncludedSchemaPatterns:    patterns[INCLUDE_SCHEMA_PATTERN],
+		ExcludedSchemaPatterns:    patterns[EXCLUDE_SCHEMA_PATTERN],
+		TablePredicates:           tablePredicates,
+		ColumnMasks:               columnMasks,
 	}, nil
 }
 
+var leadingWhereKeyword = regexp.MustCompile(`(?i)^\s*WHERE\b`)
+
+/*
+ * The predicate file is a YAML mapping of fully-qualified table names, in the
+ * same form as --include-table, to the WHERE clause used to select the rows
+ * of that table to back up.  The leading WHERE keyword is optional.
+ */
+func getTablePredicates(initialFlags *pflag.FlagSet) (map[string]string, error) {
+	tablePredicates := make(map[string]string)
+	if initialFlags.Lookup(TABLE_PREDICATE_FILE) == nil {
+		return tablePredicates, nil
+	}
+	filename, err := initialFlags.GetString(TABLE_PREDICATE_FILE)
+	if err != nil || filename == "" {
+		return tablePredicates, err
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	filePredicates := make(map[string]string)
+	err = yaml.UnmarshalStrict(contents, &filePredicates)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse table predicate file %s: %v", filename, err)
+	}
+
+	tableNames := make([]string, 0)
+	for tableName, predicate := range filePredicates {
+		tableNames = append(tableNames, tableName)
+		predicate = strings.TrimSpace(leadingWhereKeyword.ReplaceAllString(predicate, ""))
+		if predicate == "" {
+			return nil, errors.Errorf("Table %s in table predicate file %s has an empty predicate", tableName, filename)
+		}
+		tablePredicates[tableName] = predicate
+	}
+	err = utils.ValidateFQNs(tableNames)
+	if err != nil {
+		return nil, err
+	}
+	return tablePredicates, nil
+}
+
+const (
+	MASK_NULL  = "null"
+	MASK_HASH  = "hash"
+	MASK_FIXED = "fixed"
+	MASK_FAKE  = "fake"
+)
+
+var MaskingMethods = []string{MASK_NULL, MASK_HASH, MASK_FIXED, MASK_FAKE}
+
+type ColumnMask struct {
+	Method string
+	Value  string `yaml:",omitempty"`
+	Salt   string `yaml:",omitempty"`
+}
+
+/*
+ * The masking config is a YAML mapping of fully-qualified column names, in the
+ * form schema.table.column, to the masking rule to apply to that column, e.g.
+ *
+ * public.users.email:
+ *   method: hash
+ *   salt: s3cr3t
+ * public.users.name:
+ *   method: fixed
+ *   value: REDACTED
+ *
+ * As "null" is a YAML keyword, the null method must be quoted.
+ */
+func getColumnMasks(initialFlags *pflag.FlagSet) (map[string]ColumnMask, error) {
+	columnMasks := make(map[string]ColumnMask)
+	if initialFlags.Lookup(MASKING_CONFIG) == nil {
+		return columnMasks, nil
+	}
+	filename, err := initialFlags.GetString(MASKING_CONFIG)
+	if err != nil || filename == "" {
+		return columnMasks, err
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	err = yaml.UnmarshalStrict(contents, &columnMasks)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse masking config %s: %v", filename, err)
+	}
+
+	for columnName, mask := range columnMasks {
+		parts := strings.Split(columnName, ".")
+		if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+			return nil, errors.Errorf("Masked column %s in masking config %s must be of the form schema.table.column", columnName, filename)
+		}
+		mask.Method = strings.ToLower(strings.TrimSpace(mask.Method))
+		if !utils.Exists(MaskingMethods, mask.Method) {
+			return nil, errors.Errorf("Unrecognized masking method \"%s\" for column %s in masking config %s. Valid masking methods are: %s",
+				mask.Method, columnName, filename, strings.Join(MaskingMethods, ", "))
+		}
+		columnMasks[columnName] = mask
+	}
+	return columnMasks, nil
+}
+
+func getFilterPatterns(initialFlags *pflag.FlagSet, patternFlag string) ([]string, error) {
+	if initialFlags.Lookup(patternFlag) == nil {
+		return []string{}, nil
+	}
+	patterns, err := initialFlags.GetStringArray(patternFlag)
+	if err != nil {
+		return nil, err
+	}
+	for _, pattern := range patterns {
+		_, err = utils.CompileFilterPattern(pattern)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return patterns, nil
+}
+
+/*
+ * Object types are matched case-insensitively against the object types written
+ * to the TOC, plus the ACL, COMMENT, OWNER, and SECURITY LABEL pseudo types.
+ */
+func getObjectTypeFilters(initialFlags *pflag.FlagSet, filterFlag string) ([]string, error) {
+	objectTypes := make([]string, 0)
+	if initialFlags.Lookup(filterFlag) == nil {
+		return objectTypes, nil
+	}
+	filters, err := initialFlags.GetStringArray(filterFlag)
+	if err != nil {
+		return nil, err
+	}
+	validTypes := append(append([]string{}, toc.ObjectTypes...), toc.MetadataPseudoTypes...)
+	for _, filter := range filters {
+		objectType := strings.ToUpper(strings.Join(strings.Fields(filter), " "))
+		if !utils.Exists(validTypes, objectType) {
+			return nil, errors.Errorf("Unrecognized object type %s for --%s. Valid object types are: %s", filter, filterFlag, strings.Join(validTypes, ", "))
+		}
+		if !utils.Exists(objectTypes, objectType) {
+			objectTypes = append(objectTypes, objectType)
+		}
+	}
+	return objectTypes, nil
+}
+
 func setFiltersFromFile(initialFlags *pflag.FlagSet, filterFlag string, filterFileFlag string) ([]string, error) {
 	filters, err := initialFlags.GetStringArray(filterFlag)
 	if err != nil {
@@ -134,6 +339,149 @@ func (o Options) GetExcludedSchemas() []string {
 	return o.ExcludedSchemas
 }
 
+func (o Options) GetIncludedObjectTypes() []string {
+	return o.IncludedObjectTypes
+}
+
+func (o Options) GetExcludedObjectTypes() []string {
+	return o.ExcludedObjectTypes
+}
+
+func (o Options) GetTablePredicates() map[string]string {
+	return o.TablePredicates
+}
+
+func (o Options) GetColumnMasks() map[string]ColumnMask {
+	return o.ColumnMasks
+}
+
+func (o Options) HasFilterPatterns() bool {
+	return len(o.IncludedRelationPatterns) > 0 || len(o.ExcludedRelationPatterns) > 0 ||
+		len(o.IncludedSchemaPatterns) > 0 || len(o.ExcludedSchemaPatterns) > 0
+}
+
+/*
+ * Expands the table and schema filter patterns into the corresponding filter
+ * lists and flags, so that the rest of backup and restore only has to handle
+ * lists of names.  The keys of relations and schemas are unquoted names for
+ * patterns to match against, and the values are the names to add to the
+ * filter lists.  An include pattern matching nothing is an error, as it would
+ * otherwise silently turn into an unfiltered backup or restore.
+ */
+func (o *Options) ExpandFilterPatterns(flags *pflag.FlagSet, relations map[string]string, schemas map[string]string) error {
+	includeRelations, unmatched, err := utils.MatchFilterPatterns(relations, o.IncludedRelationPatterns)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		return errors.Errorf("No tables match --%s pattern(s): %s", INCLUDE_RELATION_PATTERN, strings.Join(unmatched, ", "))
+	}
+	for _, fqn := range includeRelations {
+		if utils.Exists(o.IncludedRelations, fqn) {
+			continue
+		}
+		err = flags.Set(INCLUDE_RELATION, fqn)
+		if err != nil {
+			return err
+		}
+		o.AddIncludedRelation(fqn)
+		o.originalIncludedRelations = append(o.originalIncludedRelations, fqn)
+	}
+
+	excludeRelations, unmatched, err := utils.MatchFilterPatterns(relations, o.ExcludedRelationPatterns)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		gplog.Warn("No tables match --%s pattern(s): %s", EXCLUDE_RELATION_PATTERN, strings.Join(unmatched, ", "))
+	}
+	o.ExcludedRelations, err = appendFilters(flags, EXCLUDE_RELATION, o.ExcludedRelations, excludeRelations)
+	if err != nil {
+		return err
+	}
+
+	includeSchemas, unmatched, err := utils.MatchFilterPatterns(schemas, o.IncludedSchemaPatterns)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		return errors.Errorf("No schemas match --%s pattern(s): %s", INCLUDE_SCHEMA_PATTERN, strings.Join(unmatched, ", "))
+	}
+	o.IncludedSchemas, err = appendFilters(flags, INCLUDE_SCHEMA, o.IncludedSchemas, includeSchemas)
+	if err != nil {
+		return err
+	}
+
+	excludeSchemas, unmatched, err := utils.MatchFilterPatterns(schemas, o.ExcludedSchemaPatterns)
+	if err != nil {
+		return err
+	}
+	if len(unmatched) > 0 {
+		gplog.Warn("No schemas match --%s pattern(s): %s", EXCLUDE_SCHEMA_PATTERN, strings.Join(unmatched, ", "))
+	}
+	o.ExcludedSchemas, err = appendFilters(flags, EXCLUDE_SCHEMA, o.ExcludedSchemas, excludeSchemas)
+	return err
+}
+
+func appendFilters(flags *pflag.FlagSet, filterFlag string, filters []string, newFilters []string) ([]string, error) {
+	for _, filter := range newFilters {
+		if utils.Exists(filters, filter) {
+			continue
+		}
+		err := flags.Set(filterFlag, filter)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+/*
+ * Expands the filter patterns against the user tables and schemas in the
+ * database being backed up.  Leaf partitions are not matched, as partition
+ * tables are filtered by their root partition.
+ */
+func (o *Options) ExpandFilterPatternsFromCatalog(conn *dbconn.DBConn, flags *pflag.FlagSet) error {
+	if !o.HasFilterPatterns() {
+		return nil
+	}
+	systemSchemas := Options{}
+	relationQuery := fmt.Sprintf(`
+SELECT
+	n.nspname AS schemaname,
+	c.relname AS tablename
+FROM pg_class c
+JOIN pg_namespace n
+	ON c.relnamespace = n.oid
+WHERE %s
+AND (relkind = 'r' OR relkind = 'f')
+AND c.oid NOT IN (SELECT parchildrelid FROM pg_partition_rule)
+AND %s`, systemSchemas.schemaFilterClause("n"), ExtensionFilterClause("c"))
+	tables := make([]FqnStruct, 0)
+	err := conn.Select(&tables, relationQuery)
+	if err != nil {
+		return err
+	}
+	relations := make(map[string]string, len(tables))
+	for _, table := range tables {
+		fqn := fmt.Sprintf("%s.%s", table.SchemaName, table.TableName)
+		relations[fqn] = fqn
+	}
+
+	schemaQuery := fmt.Sprintf(`SELECT n.nspname AS string FROM pg_namespace n WHERE %s`, systemSchemas.schemaFilterClause("n"))
+	schemaNames, err := dbconn.SelectStringSlice(conn, schemaQuery)
+	if err != nil {
+		return err
+	}
+	schemas := make(map[string]string, len(schemaNames))
+	for _, schema := range schemaNames {
+		schemas[schema] = schema
+	}
+
+	return o.ExpandFilterPatterns(flags, relations, schemas)
+}
+
 func (o *Options) AddIncludedRelation(relation string) {
 	o.IncludedRelations = append(o.IncludedRelations, relation)
 }
@@ -259,6 +607,41 @@ func (o *Options) QuoteIncludeRelations(conn *dbconn.DBConn) error {
 	return nil
 }
 
+// Replaces the table names in the predicate map with their quoted forms, to match table FQNs in the catalog
+func (o *Options) QuoteTablePredicates(conn *dbconn.DBConn) error {
+	tableNames := make([]string, 0)
+	for tableName := range o.TablePredicates {
+		tableNames = append(tableNames, tableName)
+	}
+	quotedNames, err := QuoteTableNames(conn, tableNames)
+	if err != nil {
+		return err
+	}
+
+	quotedPredicates := make(map[string]string)
+	for i, tableName := range tableNames {
+		quotedPredicates[quotedNames[i]] = o.TablePredicates[tableName]
+	}
+	o.TablePredicates = quotedPredicates
+	return nil
+}
+
+// Replaces the column names in the masking config with their quoted forms, to match column FQNs in the catalog
+func (o *Options) QuoteColumnMasks(conn *dbconn.DBConn) error {
+	quotedMasks := make(map[string]ColumnMask)
+	quoteIdentColumnFQNQuery := `SELECT quote_ident('%s') || '.' || quote_ident('%s') || '.' || quote_ident('%s') AS string`
+	for columnName, mask := range o.ColumnMasks {
+		parts := strings.Split(utils.EscapeSingleQuotes(columnName), ".")
+		quotedName, err := dbconn.SelectString(conn, fmt.Sprintf(quoteIdentColumnFQNQuery, parts[0], parts[1], parts[2]))
+		if err != nil {
+			return err
+		}
+		quotedMasks[quotedName] = mask
+	}
+	o.ColumnMasks = quotedMasks
+	return nil
+}
+
 func (o Options) getUserTableRelationsWithIncludeFiltering(connectionPool *dbconn.DBConn, includedRelationsQuoted []string) ([]FqnStruct, error) {
 	includeOids, err := getOidsFromRelationList(connectionPool, includedRelationsQuoted)
 	if err != nil {
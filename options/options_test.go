@@ -1,6 +1,7 @@
 package options_test
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 
@@ -202,6 +203,183 @@ var _ = Describe("options", func() {
 			_, err = options.NewOptions(myflags)
 			Expect(err).To(HaveOccurred())
 		})
+		It("normalizes included and excluded object types", func() {
+			err := myflags.Set(options.INCLUDE_OBJECT_TYPE, "table")
+			Expect(err).ToNot(HaveOccurred())
+			err = myflags.Set(options.INCLUDE_OBJECT_TYPE, "materialized  view")
+			Expect(err).ToNot(HaveOccurred())
+			err = myflags.Set(options.EXCLUDE_OBJECT_TYPE, "Security Label")
+			Expect(err).ToNot(HaveOccurred())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(subject.GetIncludedObjectTypes()).To(Equal([]string{"TABLE", "MATERIALIZED VIEW"}))
+			Expect(subject.GetExcludedObjectTypes()).To(Equal([]string{"SECURITY LABEL"}))
+		})
+		It("returns an error upon an unrecognized object type", func() {
+			err := myflags.Set(options.EXCLUDE_OBJECT_TYPE, "FUNCTIONS")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(MatchError(ContainSubstring("Unrecognized object type FUNCTIONS for --exclude-object-type")))
+		})
+		It("returns the table predicates from the predicate file", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("public.users: \"WHERE region = 'EU'\"\nsales.orders: id < 1000\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.TABLE_PREDICATE_FILE, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			Expect(subject.GetTablePredicates()).To(Equal(map[string]string{"public.users": "region = 'EU'", "sales.orders": "id < 1000"}))
+		})
+		It("returns an error if a table in the predicate file has an empty predicate", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("public.users: WHERE\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.TABLE_PREDICATE_FILE, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Table public.users in table predicate file %s has an empty predicate", file.Name())))
+		})
+		It("returns an error if a table in the predicate file is not fully qualified", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("users: id < 10\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.TABLE_PREDICATE_FILE, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(HaveOccurred())
+		})
+		It("returns the column masks from the masking config", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("public.users.email:\n  method: Hash\n  salt: pepper\npublic.users.name:\n  method: fixed\n  value: REDACTED\npublic.users.ssn:\n  method: \"null\"\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.MASKING_CONFIG, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			subject, err := options.NewOptions(myflags)
+			Expect(err).To(Not(HaveOccurred()))
+
+			Expect(subject.GetColumnMasks()).To(Equal(map[string]options.ColumnMask{
+				"public.users.email": {Method: options.MASK_HASH, Salt: "pepper"},
+				"public.users.name":  {Method: options.MASK_FIXED, Value: "REDACTED"},
+				"public.users.ssn":   {Method: options.MASK_NULL},
+			}))
+		})
+		It("returns an error if the masking config contains an unrecognized masking method", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("public.users.email:\n  method: scramble\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.MASKING_CONFIG, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf(`Unrecognized masking method "scramble" for column public.users.email in masking config %s. Valid masking methods are: null, hash, fixed, fake`, file.Name())))
+		})
+		It("returns an error if a column in the masking config is not fully qualified", func() {
+			file, err := ioutil.TempFile("/tmp", "gpbackup_test_options*.yaml")
+			Expect(err).To(Not(HaveOccurred()))
+			defer func() {
+				_ = os.Remove(file.Name())
+			}()
+			_, err = file.WriteString("users.email:\n  method: hash\n")
+			Expect(err).To(Not(HaveOccurred()))
+			err = file.Close()
+			Expect(err).To(Not(HaveOccurred()))
+
+			err = myflags.Set(options.MASKING_CONFIG, file.Name())
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(MatchError(fmt.Sprintf("Masked column users.email in masking config %s must be of the form schema.table.column", file.Name())))
+		})
+		It("returns an error upon an invalid filter pattern", func() {
+			err := myflags.Set(options.INCLUDE_RELATION_PATTERN, "regex:public.(foo")
+			Expect(err).ToNot(HaveOccurred())
+			_, err = options.NewOptions(myflags)
+			Expect(err).To(MatchError(ContainSubstring("Invalid filter pattern regex:public.(foo")))
+		})
+		Describe("ExpandFilterPatterns", func() {
+			relations := map[string]string{"sales.orders_20260101": "sales.orders_20260101", "sales.orders_2025": "sales.orders_2025", "tmp_x.Foo": `tmp_x."Foo"`}
+			schemas := map[string]string{"sales": "sales", "tmp_x": "tmp_x", "tmp_y": "tmp_y"}
+			It("adds relations matching include patterns to the include list and flag", func() {
+				err := myflags.Set(options.INCLUDE_RELATION_PATTERN, "glob:sales.orders_2026*")
+				Expect(err).ToNot(HaveOccurred())
+				subject, err := options.NewOptions(myflags)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = subject.ExpandFilterPatterns(myflags, relations, schemas)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subject.GetIncludedTables()).To(Equal([]string{"sales.orders_20260101"}))
+				Expect(subject.GetOriginalIncludedTables()).To(Equal([]string{"sales.orders_20260101"}))
+				Expect(options.MustGetFlagStringArray(myflags, options.INCLUDE_RELATION)).To(Equal([]string{"sales.orders_20260101"}))
+			})
+			It("adds schemas and relations matching exclude patterns to the exclude lists", func() {
+				err := myflags.Set(options.EXCLUDE_SCHEMA_PATTERN, "regex:tmp_.*")
+				Expect(err).ToNot(HaveOccurred())
+				err = myflags.Set(options.EXCLUDE_RELATION_PATTERN, "glob:tmp_x.F*")
+				Expect(err).ToNot(HaveOccurred())
+				subject, err := options.NewOptions(myflags)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = subject.ExpandFilterPatterns(myflags, relations, schemas)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subject.GetExcludedSchemas()).To(Equal([]string{"tmp_x", "tmp_y"}))
+				Expect(subject.GetExcludedTables()).To(Equal([]string{`tmp_x."Foo"`}))
+				Expect(options.MustGetFlagStringArray(myflags, options.EXCLUDE_SCHEMA)).To(Equal([]string{"tmp_x", "tmp_y"}))
+			})
+			It("returns an error if an include pattern matches nothing", func() {
+				err := myflags.Set(options.INCLUDE_SCHEMA_PATTERN, "glob:nothing_*")
+				Expect(err).ToNot(HaveOccurred())
+				subject, err := options.NewOptions(myflags)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = subject.ExpandFilterPatterns(myflags, relations, schemas)
+				Expect(err).To(MatchError("No schemas match --include-schema-pattern pattern(s): glob:nothing_*"))
+			})
+			It("does not return an error if an exclude pattern matches nothing", func() {
+				err := myflags.Set(options.EXCLUDE_RELATION_PATTERN, "regex:nothing.*")
+				Expect(err).ToNot(HaveOccurred())
+				subject, err := options.NewOptions(myflags)
+				Expect(err).ToNot(HaveOccurred())
+
+				err = subject.ExpandFilterPatterns(myflags, relations, schemas)
+				Expect(err).ToNot(HaveOccurred())
+				Expect(subject.GetExcludedTables()).To(BeEmpty())
+			})
+		})
 		Describe("AddIncludeRelation", func() {
 			It("it adds a relation", func() {
 				subject, err := options.NewOptions(myflags)
@@ -90,9 +90,24 @@ delete_backup() {
 
 }
 
+list_backups() {
+  echo "list_backups $1" >> /tmp/plugin_out.txt
+  for timestamp_dir in /tmp/plugin_dest/*/*; do
+    if [ -d "$timestamp_dir" ] ; then
+      basename "$timestamp_dir"
+    fi
+  done
+}
+
 plugin_api_version(){
-  echo "0.4.0"
-  echo "0.4.0" >> /tmp/plugin_out.txt
+  echo "0.5.0"
+  echo "0.5.0" >> /tmp/plugin_out.txt
+}
+
+plugin_capabilities(){
+  echo "plugin_capabilities $1" >> /tmp/plugin_out.txt
+  echo "delete_backup: true"
+  echo "list_backups: true"
 }
 
 --version(){
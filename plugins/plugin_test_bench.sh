@@ -86,6 +86,16 @@ if (( 0 == $(echo "$MINIMUM_API_VERSION $api_version" | awk '{print ($1 <= $2)}'
 fi
 echo "[PASSED] plugin_api_version"
 
+if (( 1 == $(echo "0.5.0 $api_version" | awk '{print ($1 <= $2)}') )) ; then
+  echo "[RUNNING] plugin_capabilities"
+  $plugin plugin_capabilities $plugin_config > /dev/null
+  if [ $? -ne 0 ] ; then
+    echo "Failed to get plugin capabilities"
+    exit 1
+  fi
+  echo "[PASSED] plugin_capabilities"
+fi
+
 echo "[RUNNING] --version"
 native_version=`$plugin --version`
 echo "$native_version" | grep --regexp '.* version .*' > /dev/null 2>&1
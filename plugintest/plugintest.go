@@ -0,0 +1,591 @@
+package plugintest
+
+/*
+ * This package contains gpbackup_plugin_test, which checks that a plugin
+ * conforms to the plugin API described in plugins/README.md.  It runs every
+ * command of the API against the destination in the given plugin config, and
+ * checks that everything backed up is restored byte for byte.
+ *
+ * Usage: gpbackup_plugin_test <plugin executable> <plugin config>
+ *
+ * Backups are written under a temporary directory, with timestamps chosen at
+ * random so that concurrent runs against one destination do not collide, and
+ * are deleted from the destination afterward if the plugin supports it.
+ */
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"os/exec"
+	path "path/filepath"
+	"strings"
+	"time"
+
+	"github.com/blang/semver"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * Runs the plugin with the given arguments, passing it stdin, and returns
+ * what it wrote to stdout.  An error is returned if the plugin failed.
+ */
+type RunFunc func(args []string, stdin io.Reader) ([]byte, error)
+
+func ExecRunner(executable string) RunFunc {
+	return func(args []string, stdin io.Reader) ([]byte, error) {
+		cmd := exec.Command(executable, args...)
+		cmd.Stdin = stdin
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		err := cmd.Run()
+		if err != nil {
+			return stdout.Bytes(), errors.Errorf("%s %s failed: %v: %s",
+				path.Base(executable), strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+		}
+		return stdout.Bytes(), nil
+	}
+}
+
+func DoPluginTest() {
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: gpbackup_plugin_test <plugin executable> <plugin config>")
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	executable, configPath := flag.Arg(0), flag.Arg(1)
+	if !path.IsAbs(configPath) {
+		fmt.Fprintln(os.Stderr, "The plugin config must be given as an absolute path")
+		os.Exit(2)
+	}
+	if _, err := os.Stat(configPath); err != nil {
+		fmt.Fprintf(os.Stderr, "Unable to read plugin config: %v\n", err)
+		os.Exit(2)
+	}
+	suite := NewSuite(ExecRunner(executable), configPath, os.Stdout)
+	if suite.Run() > 0 {
+		os.Exit(1)
+	}
+}
+
+type Suite struct {
+	run          RunFunc
+	configPath   string
+	output       io.Writer
+	localDir     string
+	apiVersion   semver.Version
+	capabilities *utils.PluginCapabilities
+	timestamps   []string
+	random       *rand.Rand
+}
+
+type testCase struct {
+	name string
+	// Returns the reason to skip the test, if the plugin does not support what it tests
+	skip func(suite *Suite) string
+	test func(suite *Suite) error
+}
+
+var testCases = []testCase{
+	{name: "plugin_api_version", test: testAPIVersion},
+	{name: "--version", test: testVersion},
+	{name: "plugin_capabilities", test: testCapabilities},
+	{name: "setup and cleanup for backup", test: testBackupHooks},
+	{name: "setup and cleanup for restore", test: testRestoreHooks},
+	{name: "backup_file and restore_file", test: testBackupAndRestoreFile},
+	{name: "restore_file of a file that was not backed up", test: testRestoreMissingFile},
+	{name: "backup_data and restore_data", test: testBackupAndRestoreData},
+	{name: "backup_data and restore_data with no data", test: testBackupAndRestoreNoData},
+	{name: "restore_data of data that was not backed up", test: testRestoreMissingData},
+	{name: "restore_data_subset", skip: skipUnlessRestoreSubset, test: testRestoreDataSubset},
+	{name: "delete_backup", skip: skipUnlessDeleteBackup, test: testDeleteBackup},
+	{name: "list_backups", skip: skipUnlessListBackups, test: testListBackups},
+	{name: "unknown command", test: testUnknownCommand},
+}
+
+func NewSuite(run RunFunc, configPath string, output io.Writer) *Suite {
+	return &Suite{
+		run:        run,
+		configPath: configPath,
+		output:     output,
+		random:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+/*
+ * Runs every test and returns the number that failed.  The remaining tests
+ * are not run if the API version of the plugin cannot be determined.
+ */
+func (suite *Suite) Run() int {
+	var err error
+	suite.localDir, err = ioutil.TempDir("", "gpbackup_plugin_test")
+	if err != nil {
+		fmt.Fprintf(suite.output, "[FAILED] Unable to create local backup directory: %v\n", err)
+		return 1
+	}
+	defer suite.cleanup()
+
+	numPassed, numFailed, numSkipped := 0, 0, 0
+	for _, tc := range testCases {
+		if tc.skip != nil {
+			if reason := tc.skip(suite); reason != "" {
+				fmt.Fprintf(suite.output, "[SKIPPED] %s: %s\n", tc.name, reason)
+				numSkipped++
+				continue
+			}
+		}
+		fmt.Fprintf(suite.output, "[RUNNING] %s\n", tc.name)
+		err := tc.test(suite)
+		if err != nil {
+			fmt.Fprintf(suite.output, "[FAILED] %s: %v\n", tc.name, err)
+			numFailed++
+			if tc.name == "plugin_api_version" {
+				break
+			}
+			continue
+		}
+		fmt.Fprintf(suite.output, "[PASSED] %s\n", tc.name)
+		numPassed++
+	}
+	fmt.Fprintf(suite.output, "%d passed, %d failed, %d skipped\n", numPassed, numFailed, numSkipped)
+	return numFailed
+}
+
+func (suite *Suite) cleanup() {
+	if suite.capabilities != nil && suite.capabilities.DeleteBackup {
+		for _, timestamp := range suite.timestamps {
+			// Most tests leave a backup behind, and deleting one that a test already deleted fails harmlessly
+			_, _ = suite.run([]string{"delete_backup", suite.configPath, timestamp}, nil)
+		}
+	}
+	_ = os.RemoveAll(suite.localDir)
+}
+
+/*
+ * Returns a new local backup directory, <local dir>/backups/<date>/<timestamp>,
+ * for a timestamp in the past that is not used by another test.
+ */
+func (suite *Suite) newBackupDir() (string, string, error) {
+	var timestamp string
+	for timestamp == "" || suite.usesTimestamp(timestamp) {
+		start := time.Date(2000, time.January, 1, 0, 0, 0, 0, time.UTC)
+		backupTime := start.Add(time.Duration(suite.random.Int63n(int64(20*365*24*time.Hour/time.Second))) * time.Second)
+		timestamp = backupTime.Format("20060102150405")
+	}
+	suite.timestamps = append(suite.timestamps, timestamp)
+	backupDir := path.Join(suite.localDir, "backups", timestamp[0:8], timestamp)
+	return backupDir, timestamp, os.MkdirAll(backupDir, 0755)
+}
+
+func (suite *Suite) usesTimestamp(timestamp string) bool {
+	for _, usedTimestamp := range suite.timestamps {
+		if timestamp == usedTimestamp {
+			return true
+		}
+	}
+	return false
+}
+
+func (suite *Suite) randomData(size int) []byte {
+	data := make([]byte, size)
+	_, _ = suite.random.Read(data)
+	return data
+}
+
+func (suite *Suite) runCommand(command string, args ...string) ([]byte, error) {
+	return suite.run(append([]string{command, suite.configPath}, args...), nil)
+}
+
+/*
+ * The setup and cleanup hooks are called once for the master, once for each
+ * segment host, and once for each segment, as gpbackup and gprestore do.
+ */
+func (suite *Suite) runHooks(hook string, backupDir string) error {
+	for _, scopeArgs := range [][]string{
+		{string(utils.MASTER), "-1"},
+		{string(utils.SEGMENT_HOST)},
+		{string(utils.SEGMENT), "0"},
+	} {
+		_, err := suite.runCommand(hook, append([]string{backupDir}, scopeArgs...)...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (suite *Suite) backupData(filename string, data []byte) error {
+	_, err := suite.run([]string{"backup_data", suite.configPath, filename}, bytes.NewReader(data))
+	return err
+}
+
+/*
+ * Backs up data and a file for a new timestamp, as a minimal backup to
+ * restore or delete.
+ */
+func (suite *Suite) backUpDataAndFile(data []byte) (string, string, string, error) {
+	backupDir, timestamp, err := suite.newBackupDir()
+	if err != nil {
+		return "", "", "", err
+	}
+	err = suite.runHooks("setup_plugin_for_backup", backupDir)
+	if err != nil {
+		return "", "", "", err
+	}
+	dataFile := path.Join(backupDir, fmt.Sprintf("gpbackup_0_%s", timestamp))
+	err = suite.backupData(dataFile, data)
+	if err != nil {
+		return "", "", "", err
+	}
+	filename := path.Join(backupDir, fmt.Sprintf("gpbackup_%s_metadata.sql", timestamp))
+	err = ioutil.WriteFile(filename, data, 0644)
+	if err != nil {
+		return "", "", "", err
+	}
+	_, err = suite.runCommand("backup_file", filename)
+	if err != nil {
+		return "", "", "", err
+	}
+	return timestamp, dataFile, filename, suite.runHooks("cleanup_plugin_for_backup", backupDir)
+}
+
+// Returns an error describing the first difference between the expected and actual bytes
+func compareBytes(description string, expected []byte, actual []byte) error {
+	for i := 0; i < len(expected) && i < len(actual); i++ {
+		if expected[i] != actual[i] {
+			return errors.Errorf("%s differs from what was backed up at byte %d", description, i)
+		}
+	}
+	if len(expected) != len(actual) {
+		return errors.Errorf("%s has %d bytes but %d were backed up", description, len(actual), len(expected))
+	}
+	return nil
+}
+
+/*
+ * Tests
+ */
+
+func testAPIVersion(suite *Suite) error {
+	output, err := suite.run([]string{"plugin_api_version"}, nil)
+	if err != nil {
+		return err
+	}
+	suite.apiVersion, err = semver.Make(strings.TrimSpace(string(output)))
+	if err != nil {
+		return errors.Errorf("Unable to parse API version %q: %v", strings.TrimSpace(string(output)), err)
+	}
+	if suite.apiVersion.LT(semver.MustParse(utils.RequiredPluginVersion)) {
+		return errors.Errorf("API version %s is less than the minimum supported version %s",
+			suite.apiVersion, utils.RequiredPluginVersion)
+	}
+	return nil
+}
+
+func testVersion(suite *Suite) error {
+	output, err := suite.run([]string{"--version"}, nil)
+	if err != nil {
+		return err
+	}
+	versionStr := strings.TrimSpace(string(output))
+	fields := strings.Split(versionStr, " ")
+	if len(fields) != 3 || fields[1] != "version" || fields[0] == "" || fields[2] == "" {
+		return errors.Errorf(`Version %q is not in the format "<plugin name> version <version>"`, versionStr)
+	}
+	return nil
+}
+
+func testCapabilities(suite *Suite) error {
+	if suite.apiVersion.LT(semver.MustParse(utils.PluginCapabilitiesVersion)) {
+		// gpbackup infers only these capabilities for plugins that cannot report them
+		suite.capabilities = &utils.PluginCapabilities{DeleteBackup: suite.apiVersion.GE(semver.MustParse("0.4.0"))}
+		return nil
+	}
+	output, err := suite.runCommand("plugin_capabilities")
+	if err != nil {
+		return err
+	}
+	suite.capabilities, err = utils.ParsePluginCapabilities(string(output))
+	return err
+}
+
+func testBackupHooks(suite *Suite) error {
+	backupDir, _, err := suite.newBackupDir()
+	if err != nil {
+		return err
+	}
+	err = suite.runHooks("setup_plugin_for_backup", backupDir)
+	if err != nil {
+		return err
+	}
+	return suite.runHooks("cleanup_plugin_for_backup", backupDir)
+}
+
+func testRestoreHooks(suite *Suite) error {
+	backupDir, _, err := suite.newBackupDir()
+	if err != nil {
+		return err
+	}
+	err = suite.runHooks("setup_plugin_for_restore", backupDir)
+	if err != nil {
+		return err
+	}
+	return suite.runHooks("cleanup_plugin_for_restore", backupDir)
+}
+
+func testBackupAndRestoreFile(suite *Suite) error {
+	// Every byte value, so that nothing is lost to text processing
+	data := suite.randomData(64 * 1024)
+	for i := 0; i < 256; i++ {
+		data[i] = byte(i)
+	}
+	_, _, filename, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Errorf("backup_file must leave the local file in place: %v", err)
+	}
+	err = compareBytes("The local file after backup_file", data, contents)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(filename)
+	if err != nil {
+		return err
+	}
+	err = suite.runHooks("setup_plugin_for_restore", path.Dir(filename))
+	if err != nil {
+		return err
+	}
+	_, err = suite.runCommand("restore_file", filename)
+	if err != nil {
+		return err
+	}
+	contents, err = ioutil.ReadFile(filename)
+	if err != nil {
+		return errors.Errorf("restore_file did not restore %s: %v", filename, err)
+	}
+	err = compareBytes("The restored file", data, contents)
+	if err != nil {
+		return err
+	}
+	return suite.runHooks("cleanup_plugin_for_restore", path.Dir(filename))
+}
+
+func testRestoreMissingFile(suite *Suite) error {
+	backupDir, _, err := suite.newBackupDir()
+	if err != nil {
+		return err
+	}
+	_, err = suite.runCommand("restore_file", path.Join(backupDir, "there_is_no_file_to_restore"))
+	if err == nil {
+		return errors.New("restore_file of a file that was not backed up must fail")
+	}
+	return nil
+}
+
+func testBackupAndRestoreData(suite *Suite) error {
+	// Large enough to be written and read in several pieces by most plugins
+	data := suite.randomData(3*1024*1024 + 17)
+	_, dataFile, _, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	output, err := suite.runCommand("restore_data", dataFile)
+	if err != nil {
+		return err
+	}
+	return compareBytes("The output of restore_data", data, output)
+}
+
+func testBackupAndRestoreNoData(suite *Suite) error {
+	_, dataFile, _, err := suite.backUpDataAndFile([]byte{})
+	if err != nil {
+		return err
+	}
+	output, err := suite.runCommand("restore_data", dataFile)
+	if err != nil {
+		return err
+	}
+	return compareBytes("The output of restore_data", []byte{}, output)
+}
+
+func testRestoreMissingData(suite *Suite) error {
+	backupDir, timestamp, err := suite.newBackupDir()
+	if err != nil {
+		return err
+	}
+	_, err = suite.runCommand("restore_data", path.Join(backupDir, fmt.Sprintf("gpbackup_0_%s", timestamp)))
+	if err == nil {
+		return errors.New("restore_data of data that was not backed up must fail")
+	}
+	return nil
+}
+
+func skipUnlessRestoreSubset(suite *Suite) string {
+	if suite.capabilities == nil || !suite.capabilities.RestoreSubset {
+		return "the plugin does not report the restore_subset capability"
+	}
+	return ""
+}
+
+func testRestoreDataSubset(suite *Suite) error {
+	data := suite.randomData(1000000)
+	_, dataFile, _, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	for _, ranges := range [][][2]int{
+		{{3, 10}},
+		{{900000, 900001}},
+		{{0, 700000}, {900000, 900001}},
+		{{10, 20}, {20, 30}, {999990, 1000000}},
+	} {
+		var offsets strings.Builder
+		expected := make([]byte, 0)
+		offsets.WriteString(fmt.Sprintf("%d", len(ranges)))
+		for _, r := range ranges {
+			offsets.WriteString(fmt.Sprintf(" %d %d", r[0], r[1]))
+			expected = append(expected, data[r[0]:r[1]]...)
+		}
+		offsetsFile := path.Join(path.Dir(dataFile), "offsets")
+		err = ioutil.WriteFile(offsetsFile, []byte(offsets.String()), 0644)
+		if err != nil {
+			return err
+		}
+		output, err := suite.runCommand("restore_data_subset", dataFile, offsetsFile)
+		if err != nil {
+			return err
+		}
+		err = compareBytes(fmt.Sprintf("The output of restore_data_subset with offsets %q", offsets.String()), expected, output)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func skipUnlessDeleteBackup(suite *Suite) string {
+	if suite.capabilities == nil || !suite.capabilities.DeleteBackup {
+		return "the plugin does not report the delete_backup capability"
+	}
+	return ""
+}
+
+func testDeleteBackup(suite *Suite) error {
+	data := suite.randomData(1000)
+	timestamp, dataFile, filename, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	_, siblingDataFile, _, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = suite.runCommand("delete_backup", timestamp)
+	if err != nil {
+		return err
+	}
+	_, err = suite.runCommand("restore_data", dataFile)
+	if err == nil {
+		return errors.New("restore_data of data in a deleted backup must fail")
+	}
+	err = os.Remove(filename)
+	if err != nil {
+		return err
+	}
+	_, err = suite.runCommand("restore_file", filename)
+	if err == nil {
+		return errors.New("restore_file of a file in a deleted backup must fail")
+	}
+	output, err := suite.runCommand("restore_data", siblingDataFile)
+	if err != nil {
+		return errors.Wrap(err, "delete_backup must not delete other backups")
+	}
+	return compareBytes("The output of restore_data for another backup", data, output)
+}
+
+func skipUnlessListBackups(suite *Suite) string {
+	if suite.capabilities == nil || !suite.capabilities.ListBackups {
+		return "the plugin does not report the list_backups capability"
+	}
+	return ""
+}
+
+func testListBackups(suite *Suite) error {
+	data := suite.randomData(1000)
+	timestamp, _, _, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	otherTimestamp, _, _, err := suite.backUpDataAndFile(data)
+	if err != nil {
+		return err
+	}
+	timestamps, err := suite.listBackups()
+	if err != nil {
+		return err
+	}
+	for _, expected := range []string{timestamp, otherTimestamp} {
+		if !containsTimestamp(timestamps, expected) {
+			return errors.Errorf("list_backups did not list backup %s", expected)
+		}
+	}
+	if !suite.capabilities.DeleteBackup {
+		return nil
+	}
+
+	_, err = suite.runCommand("delete_backup", timestamp)
+	if err != nil {
+		return err
+	}
+	timestamps, err = suite.listBackups()
+	if err != nil {
+		return err
+	}
+	if containsTimestamp(timestamps, timestamp) {
+		return errors.Errorf("list_backups listed backup %s after it was deleted", timestamp)
+	}
+	if !containsTimestamp(timestamps, otherTimestamp) {
+		return errors.Errorf("list_backups did not list backup %s", otherTimestamp)
+	}
+	return nil
+}
+
+func (suite *Suite) listBackups() ([]string, error) {
+	output, err := suite.runCommand("list_backups")
+	if err != nil {
+		return nil, err
+	}
+	return utils.ParseBackupList(string(output))
+}
+
+func containsTimestamp(timestamps []string, timestamp string) bool {
+	for _, listed := range timestamps {
+		if listed == timestamp {
+			return true
+		}
+	}
+	return false
+}
+
+func testUnknownCommand(suite *Suite) error {
+	_, err := suite.runCommand("unknown_command")
+	if err == nil {
+		return errors.New("An unknown command must fail")
+	}
+	return nil
+}
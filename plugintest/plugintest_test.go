@@ -0,0 +1,120 @@
+package plugintest_test
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	path "path/filepath"
+	"testing"
+
+	"github.com/greenplum-db/gpbackup/localplugin"
+	"github.com/greenplum-db/gpbackup/plugintest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func TestPluginTest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "plugintest tests")
+}
+
+var _ = Describe("plugintest tests", func() {
+	var (
+		destinationDir string
+		configPath     string
+		output         *bytes.Buffer
+	)
+	// Runs the reference plugin in this process, as though it were executed
+	localPlugin := func(args []string, stdin io.Reader) ([]byte, error) {
+		if stdin == nil {
+			stdin = &bytes.Buffer{}
+		}
+		stdout := &bytes.Buffer{}
+		err := localplugin.Run(args, stdin, stdout)
+		return stdout.Bytes(), err
+	}
+	BeforeEach(func() {
+		var err error
+		destinationDir, err = ioutil.TempDir("", "local_plugin_destination")
+		Expect(err).ToNot(HaveOccurred())
+		configPath = path.Join(destinationDir, "local_plugin_config.yaml")
+		config := fmt.Sprintf("executablepath: /bin/gpbackup_local_plugin\noptions:\n  directory: %s\n", destinationDir)
+		Expect(ioutil.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+		output = &bytes.Buffer{}
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(destinationDir)
+	})
+
+	It("passes every test for the reference plugin and deletes its backups", func() {
+		numFailed := plugintest.NewSuite(localPlugin, configPath, output).Run()
+
+		Expect(numFailed).To(Equal(0), output.String())
+		Expect(output.String()).To(ContainSubstring("[PASSED] restore_data_subset\n"))
+		Expect(output.String()).To(ContainSubstring("[PASSED] delete_backup\n"))
+		Expect(output.String()).To(ContainSubstring("[PASSED] list_backups\n"))
+		Expect(output.String()).To(HaveSuffix("14 passed, 0 failed, 0 skipped\n"))
+		Expect(path.Join(destinationDir, "backups")).To(BeADirectory())
+		entries, err := ioutil.ReadDir(path.Join(destinationDir, "backups"))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(entries).To(BeEmpty())
+	})
+	It("fails the tests of a plugin that does not restore data byte for byte", func() {
+		corruptingPlugin := func(args []string, stdin io.Reader) ([]byte, error) {
+			stdout, err := localPlugin(args, stdin)
+			if err == nil && args[0] == "restore_data" && len(stdout) > 1000 {
+				stdout[1000]++
+			}
+			return stdout, err
+		}
+
+		numFailed := plugintest.NewSuite(corruptingPlugin, configPath, output).Run()
+
+		Expect(numFailed).To(Equal(1))
+		Expect(output.String()).To(ContainSubstring("[FAILED] backup_data and restore_data: " +
+			"The output of restore_data differs from what was backed up at byte 1000\n"))
+	})
+	It("skips the tests of capabilities the plugin does not report", func() {
+		basicPlugin := func(args []string, stdin io.Reader) ([]byte, error) {
+			if args[0] == "plugin_capabilities" {
+				return []byte("max_concurrency: 0\n"), nil
+			}
+			return localPlugin(args, stdin)
+		}
+
+		numFailed := plugintest.NewSuite(basicPlugin, configPath, output).Run()
+
+		Expect(numFailed).To(Equal(0), output.String())
+		Expect(output.String()).To(ContainSubstring("[SKIPPED] restore_data_subset: the plugin does not report the restore_subset capability\n"))
+		Expect(output.String()).To(ContainSubstring("[SKIPPED] delete_backup: the plugin does not report the delete_backup capability\n"))
+		Expect(output.String()).To(ContainSubstring("[SKIPPED] list_backups: the plugin does not report the list_backups capability\n"))
+	})
+	It("infers the capabilities of a plugin that does not report them", func() {
+		legacyPlugin := func(args []string, stdin io.Reader) ([]byte, error) {
+			if args[0] == "plugin_api_version" {
+				return []byte("0.3.0\n"), nil
+			}
+			return localPlugin(args, stdin)
+		}
+
+		numFailed := plugintest.NewSuite(legacyPlugin, configPath, output).Run()
+
+		Expect(numFailed).To(Equal(0), output.String())
+		Expect(output.String()).To(ContainSubstring("[SKIPPED] restore_data_subset: the plugin does not report the restore_subset capability\n"))
+	})
+	It("stops if the plugin API version is not supported", func() {
+		oldPlugin := func(args []string, stdin io.Reader) ([]byte, error) {
+			return []byte("0.2.0\n"), nil
+		}
+
+		numFailed := plugintest.NewSuite(oldPlugin, configPath, output).Run()
+
+		Expect(numFailed).To(Equal(1))
+		Expect(output.String()).To(Equal("[RUNNING] plugin_api_version\n" +
+			"[FAILED] plugin_api_version: API version 0.2.0 is less than the minimum supported version 0.3.0\n" +
+			"0 passed, 1 failed, 0 skipped\n"))
+	})
+})
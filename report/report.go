@@ -16,6 +16,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
 	"gopkg.in/yaml.v2"
@@ -29,6 +30,7 @@ import (
 type Report struct {
 	BackupParamsString string
 	DatabaseSize       string
+	PluginRetries      int
 	history.BackupConfig
 }
 
@@ -81,11 +83,21 @@ func (report *Report) ConstructBackupParamsString() {
 		sectionStr = "Metadata Only"
 	}
 	filesStr := "Multiple Data Files Per Segment"
-	if report.MetadataOnly {
+	if report.Format == options.FORMAT_PLAIN {
+		filesStr = "Plain SQL Script"
+	} else if report.MetadataOnly {
 		filesStr = "No Data Files"
 	} else if report.SingleDataFile {
 		filesStr = "Single Data File Per Segment"
 	}
+	subsetStr := "No"
+	if report.DataSubset {
+		subsetStr = "Yes (rows filtered by table predicates)"
+	}
+	maskingStr := "None"
+	if len(report.MaskedColumns) > 0 {
+		maskingStr = fmt.Sprintf("%d masked column(s)", len(report.MaskedColumns))
+	}
 	statsStr := "No"
 	if report.WithStatistics {
 		statsStr = "Yes"
@@ -94,11 +106,13 @@ func (report *Report) ConstructBackupParamsString() {
 plugin executable: %s
 backup section: %s
 object filtering: %s
+data subset: %s
+column masking: %s
 includes statistics: %s
 data file format: %s
 %s`
 	report.BackupParamsString = fmt.Sprintf(backupParamsTemplate, compressStr, pluginStr, sectionStr, filterStr,
-		statsStr, filesStr, report.constructIncrementalSection())
+		subsetStr, maskingStr, statsStr, filesStr, report.constructIncrementalSection())
 }
 
 func (report *Report) constructIncrementalSection() string {
@@ -151,11 +165,16 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 			LineInfo{},
 			LineInfo{Key: "backup status:", Value: history.BackupStatusSucceed})
 	}
+	for _, backupCopy := range report.Copies {
+		reportInfo = append(reportInfo,
+			LineInfo{Key: "backup copy:", Value: fmt.Sprintf("%s: %s", backupCopy, backupCopy.Status)})
+	}
 	if report.DatabaseSize != "" {
 		reportInfo = append(reportInfo,
 			LineInfo{},
 			LineInfo{Key: "database size:", Value: strings.ToUpper(report.DatabaseSize)})
 	}
+	reportInfo = appendPluginRetries(reportInfo, report.PluginRetries)
 
 	_, err = fmt.Fprint(reportFile, "Greenplum Database Backup Report\n\n")
 	if err != nil {
@@ -172,7 +191,7 @@ func (report *Report) WriteBackupReportFile(reportFilename string, timestamp str
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
-func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string) {
+func WriteRestoreReportFile(reportFilename string, backupTimestamp string, startTimestamp string, connectionPool *dbconn.DBConn, restoreVersion string, errMsg string, pluginRetries int) {
 	reportFile, err := iohelper.OpenFileForWriting(reportFilename)
 	if err != nil {
 		gplog.Error("Unable to open restore report file %s", reportFilename)
@@ -213,6 +232,7 @@ func WriteRestoreReportFile(reportFilename string, backupTimestamp string, start
 			LineInfo{},
 			LineInfo{Key: "restore status:", Value: "Success"})
 	}
+	reportInfo = appendPluginRetries(reportInfo, pluginRetries)
 
 	logOutputReport(reportFile, reportInfo)
 
@@ -221,6 +241,16 @@ func WriteRestoreReportFile(reportFilename string, backupTimestamp string, start
 	_ = operating.System.Chmod(reportFilename, 0444)
 }
 
+// Plugin command retries are only reported if there were any, as most runs have none
+func appendPluginRetries(reportInfo []LineInfo, pluginRetries int) []LineInfo {
+	if pluginRetries == 0 {
+		return reportInfo
+	}
+	return append(reportInfo,
+		LineInfo{},
+		LineInfo{Key: "plugin retries:", Value: fmt.Sprintf("%d", pluginRetries)})
+}
+
 func logOutputReport(reportFile io.WriteCloser, reportInfo []LineInfo) {
 	maxSize := 0
 	for _, lineInfo := range reportInfo {
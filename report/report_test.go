@@ -59,6 +59,28 @@ var _ = Describe("utils/report tests", func() {
 			Expect(errMsg).To(Equal(""))
 		})
 	})
+	Describe("ConstructBackupParamsString", func() {
+		It("marks a backup taken with table predicates as a data subset", func() {
+			backupReport := &Report{BackupConfig: history.BackupConfig{DataSubset: true}}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("data subset: Yes (rows filtered by table predicates)"))
+		})
+		It("does not mark a backup taken without table predicates as a data subset", func() {
+			backupReport := &Report{BackupConfig: history.BackupConfig{}}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("data subset: No"))
+		})
+		It("reports a plain format backup as a plain SQL script", func() {
+			backupReport := &Report{BackupConfig: history.BackupConfig{Format: options.FORMAT_PLAIN}}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("data file format: Plain SQL Script"))
+		})
+		It("reports the number of masked columns", func() {
+			backupReport := &Report{BackupConfig: history.BackupConfig{MaskedColumns: []string{"public.users.email", "public.users.name"}}}
+			backupReport.ConstructBackupParamsString()
+			Expect(backupReport.BackupParamsString).To(ContainSubstring("column masking: 2 masked column(s)"))
+		})
+	})
 	Describe("WriteBackupReportFile", func() {
 		timestamp := "20170101010101"
 		endtime := time.Date(2017, 1, 1, 5, 4, 3, 2, time.Local)
@@ -119,6 +141,29 @@ count of database objects in backup:
 sequences   1
 tables      42
 types       1000`))
+		})
+		It("writes a report for a backup with plugin command retries", func() {
+			backupReport.PluginRetries = 2
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`backup status:         Success
+
+database size:         42 MB
+
+plugin retries:        2
+
+count of database objects in backup:`))
+		})
+		It("writes a report for a backup with several copies", func() {
+			backupReport.Copies = []history.BackupCopy{
+				{BackupDir: "/nfs/backups", Status: history.BackupStatusSucceed},
+				{Plugin: "s3_plugin", Status: history.BackupStatusFailed},
+			}
+			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "")
+			Expect(buffer).To(Say(`backup status:         Success
+backup copy:           backup directory /nfs/backups: Success
+backup copy:           plugin s3_plugin: Failure
+
+database size:         42 MB`))
 		})
 		It("writes a report for a failed backup", func() {
 			backupReport.WriteBackupReportFile("filename", timestamp, endtime, objectCounts, "Cannot access /tmp/backups: Permission denied")
@@ -239,7 +284,7 @@ incremental backup set:
 
 		It("writes a report for a failed restore", func() {
 			gplog.SetErrorCode(2)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "Cannot access /tmp/backups: Permission denied", 0)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -258,7 +303,7 @@ restore error:       Cannot access /tmp/backups: Permission denied`))
 		})
 		It("writes a report for a successful restore", func() {
 			gplog.SetErrorCode(0)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", 0)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -276,7 +321,7 @@ restore status:      Success`))
 		})
 		It("writes a report for a successful restore with errors", func() {
 			gplog.SetErrorCode(1)
-			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "")
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", 0)
 			Expect(buffer).To(Say(`Greenplum Database Restore Report
 
 timestamp key:       20170101010101
@@ -292,6 +337,12 @@ duration:            4:03:01
 
 restore status:      Success but non-fatal errors occurred. See log file .+ for details.`))
 		})
+		It("writes a report for a restore with plugin command retries", func() {
+			WriteRestoreReportFile("filename", timestamp, restoreStartTime, connectionPool, restoreVersion, "", 3)
+			Expect(buffer).To(Say(`restore status:      Success
+
+plugin retries:      3`))
+		})
 	})
 	Describe("SetBackupParamFromFlags", func() {
 		AfterEach(func() {
@@ -303,6 +354,7 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 			backup.SetCmdFlags(backupCmdFlags)
 			err := backupCmdFlags.Set(options.INCLUDE_RELATION, "public.foobar")
 			Expect(err).ToNot(HaveOccurred())
+			backup.RecordFlagValues()
 			opts, err := options.NewOptions(backupCmdFlags)
 			Expect(err).ToNot(HaveOccurred())
 			opts.AddIncludedRelation("public.baz")
@@ -319,12 +371,17 @@ restore status:      Success but non-fatal errors occurred. See log file .+ for
 				DatabaseVersion:      "5.0.0 build test",
 				IncludeSchemas:       []string{},
 				IncludeRelations:     []string{"public.foobar"},
+				IncludeObjectTypes:   []string{},
 				ExcludeSchemas:       []string{},
 				ExcludeRelations:     []string{},
+				ExcludeObjectTypes:   []string{},
+				Format:               "directory",
+				MaskedColumns:        []string{},
 				Plugin:               "/tmp/plugin.sh",
 				Timestamp:            "timestamp1",
 				IncludeTableFiltered: true,
 				Status:               history.BackupStatusFailed,
+				Flags:                map[string][]string{options.INCLUDE_RELATION: {"public.foobar"}},
 			}, backupConfig)
 		})
 	})
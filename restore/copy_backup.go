@@ -0,0 +1,241 @@
+package restore
+
+/*
+ * This file contains the functions for --copy-to-dir and
+ * --copy-to-plugin-config, which copy a finished backup from its backup
+ * directory, or from the plugin in --plugin-config, to another destination and
+ * record the new copy of the backup, so that it can be restored from either.
+ */
+
+import (
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func isCopyMode() bool {
+	return MustGetFlagString(options.COPY_TO_DIR) != "" || MustGetFlagString(options.COPY_TO_PLUGIN_CONFIG) != ""
+}
+
+/*
+ * The files of each segment are copied by gpbackup_helper on its host, so a
+ * connection is only needed to read the segment configuration.  The config
+ * file, which records the new copy, is written to the destination last, so
+ * that a copy that fails partway through cannot be restored.
+ */
+func copyBackup() {
+	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	gplog.Info("Copying backup %s", backupTimestamp)
+
+	CreateConnectionPool("postgres")
+	state.globalCluster = cluster.NewCluster(cluster.MustGetSegmentConfiguration(state.connectionPool))
+	state.globalCluster.Executor = &utils.ContextExecutor{Context: state.runCtx}
+	segPrefix := filepath.GetSegPrefix(state.connectionPool)
+	state.connectionPool.Close()
+	state.connectionPool = nil
+	state.globalFPInfo = GetBackupFPInfoForTimestamp(backupTimestamp)
+
+	sourcePluginConfigPath := ""
+	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+		state.pluginConfig = readCopyPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG), state.restoreStartTime)
+		state.pluginConfig.SetBackupPluginVersion(backupTimestamp, FindHistoricalPluginVersion(backupTimestamp))
+		state.pluginConfig.CopyPluginConfigToAllHosts(state.globalCluster)
+		state.pluginConfig.SetupPluginForRestore(state.globalCluster, state.globalFPInfo)
+		state.pluginConfig.MustRestoreFile(state.globalFPInfo.GetConfigFilePath())
+		state.pluginConfig.MustRestoreFile(state.globalFPInfo.GetTOCFilePath())
+		sourcePluginConfigPath = state.pluginConfig.ConfigPath
+	}
+	state.backupConfig = history.ReadConfigFile(state.globalFPInfo.GetConfigFilePath())
+	report.EnsureBackupVersionCompatibility(state.backupConfig.BackupVersion, version)
+	if state.backupConfig.Failed() {
+		gplog.Fatal(errors.Errorf("Backup %s failed, so it cannot be copied.", backupTimestamp), "")
+	}
+	validateBackupFlagPluginCombinations()
+	if state.backupConfig.Incremental {
+		gplog.Warn("Backup %s is incremental, so the backups in its restore plan must be copied as well to restore it from the copy", backupTimestamp)
+	}
+	utils.InitializePipeThroughParameters(state.backupConfig.Compressed, 0)
+	state.globalTOC = toc.NewTOC(state.globalFPInfo.GetTOCFilePath())
+
+	destinationFPInfo := state.globalFPInfo
+	destinationPluginConfigPath := ""
+	newCopy := history.BackupCopy{Status: history.BackupStatusSucceed}
+	if copyToDir := MustGetFlagString(options.COPY_TO_DIR); copyToDir != "" {
+		destinationFPInfo = filepath.NewFilePathInfo(state.globalCluster, copyToDir, backupTimestamp, segPrefix)
+		if state.pluginConfig == nil && destinationFPInfo.GetDirForContent(-1) == state.globalFPInfo.GetDirForContent(-1) {
+			gplog.Fatal(errors.Errorf("Backup %s is already in %s", backupTimestamp, copyToDir), "")
+		}
+		newCopy.BackupDir = copyToDir
+	} else {
+		// The plugin stores each file under the path it is read from
+		state.copyPluginConfig = readCopyPluginConfig(MustGetFlagString(options.COPY_TO_PLUGIN_CONFIG), state.restoreStartTime+"_copy")
+		state.copyPluginConfig.CopyPluginConfigToAllHosts(state.globalCluster)
+		state.copyPluginConfig.SetupPluginForBackup(state.globalCluster, destinationFPInfo)
+		defer state.copyPluginConfig.CleanupPluginForBackup(state.globalCluster, destinationFPInfo)
+		_, newCopy.Plugin = path.Split(state.copyPluginConfig.ExecutablePath)
+		newCopy.Destination = state.copyPluginConfig.Destination()
+		destinationPluginConfigPath = state.copyPluginConfig.ConfigPath
+	}
+
+	files := GetBackupFilesToCopy(state.globalCluster, state.backupConfig, state.globalTOC, state.globalFPInfo, destinationFPInfo, utils.GetPipeThroughProgram().Extension)
+	gplog.Info("Copying backup %s to %s", backupTimestamp, newCopy)
+	utils.CopyBackupFilesOnAllHosts(state.globalCluster, files, sourcePluginConfigPath, destinationPluginConfigPath)
+
+	sourceDestination := ""
+	if state.pluginConfig != nil {
+		sourceDestination = state.pluginConfig.Destination()
+	}
+	AddBackupCopy(state.backupConfig, sourceDestination, newCopy)
+	writeCopiedConfigFile(destinationFPInfo)
+	recordBackupCopyInHistory()
+	gplog.Info("Copied backup %s to %s", backupTimestamp, newCopy)
+}
+
+func readCopyPluginConfig(configFile string, runID string) *utils.PluginConfig {
+	config, err := utils.ReadPluginConfig(configFile)
+	gplog.FatalOnError(err)
+	if config.Storage == utils.CopiesStorage {
+		gplog.Fatal(errors.Errorf("Cannot copy a backup with plugin config %s, as it uses storage %s.  Pass the config of one of the plugins it copies backups with instead.",
+			configFile, utils.CopiesStorage), "")
+	}
+	config.SetContext(state.runCtx)
+	config.SetHostConfigPath(runID)
+	config.CheckPluginExistsOnAllHosts(state.globalCluster)
+	return config
+}
+
+/*
+ * Returns the files of the backup to copy for each segment, by content ID,
+ * which are every file but the config file, which is written separately.
+ */
+func GetBackupFilesToCopy(c *cluster.Cluster, config *history.BackupConfig, tocfile *toc.TOC,
+	sourceFPInfo filepath.FilePathInfo, destinationFPInfo filepath.FilePathInfo, extension string) map[int][]utils.BackupFileCopy {
+	files := make(map[int][]utils.BackupFileCopy)
+	addFile := func(contentID int, getPath func(fpInfo filepath.FilePathInfo) string) {
+		files[contentID] = append(files[contentID], utils.BackupFileCopy{Source: getPath(sourceFPInfo), Destination: getPath(destinationFPInfo)})
+	}
+
+	coordinatorFiles := []string{"table of contents", "metadata", "report"}
+	if config.WithStatistics {
+		coordinatorFiles = append(coordinatorFiles, "statistics")
+	}
+	if config.Format == options.FORMAT_PLAIN {
+		coordinatorFiles = append(coordinatorFiles, "plain script")
+	}
+	if config.Plugin != "" {
+		coordinatorFiles = append(coordinatorFiles, "plugin_config")
+	}
+	for _, filetype := range coordinatorFiles {
+		filetype := filetype
+		addFile(-1, func(fpInfo filepath.FilePathInfo) string {
+			return fpInfo.GetBackupFilePath(filetype)
+		})
+	}
+
+	if config.MetadataOnly {
+		return files
+	}
+	for _, contentID := range c.ContentIDs {
+		contentID := contentID
+		if contentID == -1 {
+			continue
+		}
+		if config.SingleDataFile {
+			addFile(contentID, func(fpInfo filepath.FilePathInfo) string {
+				return fpInfo.GetTableBackupFilePath(contentID, 0, extension, true)
+			})
+			addFile(contentID, func(fpInfo filepath.FilePathInfo) string {
+				return fpInfo.GetSegmentTOCFilePath(contentID)
+			})
+			continue
+		}
+		for _, entry := range tocfile.DataEntries {
+			oid := entry.Oid
+			addFile(contentID, func(fpInfo filepath.FilePathInfo) string {
+				return fpInfo.GetTableBackupFilePath(contentID, oid, extension, false)
+			})
+		}
+	}
+	return files
+}
+
+/*
+ * Adds newCopy to the copies of the backup, replacing an earlier copy to the
+ * same destination.  A backup copied for the first time is recorded with the
+ * destination it was taken to as well.
+ */
+func AddBackupCopy(config *history.BackupConfig, sourceDestination string, newCopy history.BackupCopy) {
+	if len(config.Copies) == 0 {
+		firstCopy := history.BackupCopy{BackupDir: config.BackupDir, Status: history.BackupStatusSucceed}
+		if config.Plugin != "" {
+			firstCopy = history.BackupCopy{Plugin: config.Plugin, Destination: sourceDestination, Status: history.BackupStatusSucceed}
+		}
+		config.Copies = []history.BackupCopy{firstCopy}
+	}
+	for i, backupCopy := range config.Copies {
+		if backupCopy.BackupDir == newCopy.BackupDir && backupCopy.Plugin == newCopy.Plugin && backupCopy.Destination == newCopy.Destination {
+			config.Copies[i] = newCopy
+			return
+		}
+	}
+	config.Copies = append(config.Copies, newCopy)
+}
+
+/*
+ * Restoring a backup with copies checks that the copy restored from is
+ * recorded in its config file, so the config file with the new copy is written
+ * to the destination.  It replaces the config file the backup was copied from
+ * as well, which is the one in the backup directory or restored from the
+ * plugin, and which the plugin destination is written from.
+ */
+func writeCopiedConfigFile(destinationFPInfo filepath.FilePathInfo) {
+	configFilenames := []string{state.globalFPInfo.GetConfigFilePath()}
+	if state.copyPluginConfig == nil {
+		configFilenames = append(configFilenames, destinationFPInfo.GetConfigFilePath())
+	}
+	for _, configFilename := range configFilenames {
+		err := utils.RemoveFileIfExists(configFilename)
+		gplog.FatalOnError(err)
+		history.WriteConfigFile(state.backupConfig, configFilename)
+	}
+	if state.copyPluginConfig != nil {
+		state.copyPluginConfig.MustBackupFile(state.globalFPInfo.GetConfigFilePath())
+	}
+}
+
+func recordBackupCopyInHistory() {
+	historyFilename := state.globalFPInfo.GetBackupHistoryFilePath()
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		var err error
+		backupHistory, err = history.NewHistory(historyFilename)
+		gplog.FatalOnError(err)
+	}
+	RecordBackupCopies(backupHistory, state.backupConfig)
+	err := backupHistory.RewriteHistoryFile(historyFilename)
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Records the copies of the backup in its entry in the history, adding the
+ * backup if it is missing, such as a backup copied from another cluster.
+ */
+func RecordBackupCopies(backupHistory *history.History, config *history.BackupConfig) {
+	for i := range backupHistory.BackupConfigs {
+		if backupHistory.BackupConfigs[i].Timestamp == config.Timestamp {
+			backupHistory.BackupConfigs[i].Copies = config.Copies
+			return
+		}
+	}
+	gplog.Verbose("Adding backup %s to the backup history file", config.Timestamp)
+	backupHistory.AddBackupConfig(config)
+}
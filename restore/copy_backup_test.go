@@ -0,0 +1,171 @@
+package restore_test
+
+import (
+	"context"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/copy_backup tests", func() {
+	Describe("GetBackupFilesToCopy", func() {
+		var (
+			testCluster       *cluster.Cluster
+			sourceFPInfo      filepath.FilePathInfo
+			destinationFPInfo filepath.FilePathInfo
+			tocfile           *toc.TOC
+		)
+		BeforeEach(func() {
+			testCluster = cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master"},
+				{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1"},
+				{ContentID: 1, DataDir: "/data/gpseg1", Hostname: "segment2"},
+			})
+			sourceFPInfo = filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+			destinationFPInfo = filepath.NewFilePathInfo(testCluster, "/copy", "20170101010101", "gpseg")
+			tocfile = &toc.TOC{DataEntries: []toc.MasterDataEntry{{Oid: 16384}, {Oid: 16390}}}
+		})
+
+		It("copies the coordinator files and a data file for each table on each segment", func() {
+			config := &history.BackupConfig{Timestamp: "20170101010101"}
+
+			files := restore.GetBackupFilesToCopy(testCluster, config, tocfile, sourceFPInfo, destinationFPInfo, ".gz")
+
+			Expect(files[-1]).To(Equal([]utils.BackupFileCopy{
+				{Source: "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_toc.yaml", Destination: "/copy/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_toc.yaml"},
+				{Source: "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_metadata.sql", Destination: "/copy/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_metadata.sql"},
+				{Source: "/data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report", Destination: "/copy/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_report"},
+			}))
+			Expect(files[1]).To(Equal([]utils.BackupFileCopy{
+				{Source: "/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_16384.gz", Destination: "/copy/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_16384.gz"},
+				{Source: "/data/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_16390.gz", Destination: "/copy/gpseg1/backups/20170101/20170101010101/gpbackup_1_20170101010101_16390.gz"},
+			}))
+			Expect(files[0]).To(HaveLen(2))
+		})
+		It("copies the optional coordinator files the backup has", func() {
+			config := &history.BackupConfig{Timestamp: "20170101010101", WithStatistics: true, Format: options.FORMAT_PLAIN, Plugin: "gpbackup_s3_plugin", MetadataOnly: true}
+
+			files := restore.GetBackupFilesToCopy(testCluster, config, tocfile, sourceFPInfo, destinationFPInfo, "")
+
+			Expect(files[-1]).To(HaveLen(6))
+			Expect(files[-1][3].Source).To(HaveSuffix("gpbackup_20170101010101_statistics.sql"))
+			Expect(files[-1][4].Source).To(HaveSuffix("gpbackup_20170101010101_script.sql"))
+			Expect(files[-1][5].Source).To(HaveSuffix("gpbackup_20170101010101_plugin_config.yaml"))
+			Expect(files).ToNot(HaveKey(0))
+		})
+		It("copies the data file and table of contents of each segment of a backup with a single data file", func() {
+			config := &history.BackupConfig{Timestamp: "20170101010101", SingleDataFile: true}
+
+			files := restore.GetBackupFilesToCopy(testCluster, config, tocfile, sourceFPInfo, destinationFPInfo, ".gz")
+
+			Expect(files[0]).To(Equal([]utils.BackupFileCopy{
+				{Source: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101.gz", Destination: "/copy/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101.gz"},
+				{Source: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_toc.yaml", Destination: "/copy/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_toc.yaml"},
+			}))
+		})
+	})
+	Describe("AddBackupCopy", func() {
+		It("records the destination a backup was taken to along with its first copy", func() {
+			config := &history.BackupConfig{Plugin: "gpbackup_s3_plugin"}
+
+			restore.AddBackupCopy(config, "/home/gpadmin/s3.yaml", history.BackupCopy{BackupDir: "/copy", Status: history.BackupStatusSucceed})
+
+			Expect(config.Copies).To(Equal([]history.BackupCopy{
+				{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusSucceed},
+				{BackupDir: "/copy", Status: history.BackupStatusSucceed},
+			}))
+		})
+		It("replaces an earlier copy to the same destination", func() {
+			config := &history.BackupConfig{BackupDir: "/backups", Copies: []history.BackupCopy{
+				{BackupDir: "/backups", Status: history.BackupStatusSucceed},
+				{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusFailed},
+			}}
+
+			restore.AddBackupCopy(config, "", history.BackupCopy{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusSucceed})
+
+			Expect(config.Copies).To(Equal([]history.BackupCopy{
+				{BackupDir: "/backups", Status: history.BackupStatusSucceed},
+				{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusSucceed},
+			}))
+		})
+		It("adds a copy with the same plugin to another destination", func() {
+			config := &history.BackupConfig{BackupDir: "/backups", Copies: []history.BackupCopy{
+				{BackupDir: "/backups", Status: history.BackupStatusSucceed},
+				{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusSucceed},
+			}}
+
+			restore.AddBackupCopy(config, "", history.BackupCopy{Plugin: "gpbackup_s3_plugin", Destination: "/home/gpadmin/s3_offsite.yaml", Status: history.BackupStatusSucceed})
+
+			Expect(config.Copies).To(HaveLen(3))
+			Expect(config.Copies[2].Destination).To(Equal("/home/gpadmin/s3_offsite.yaml"))
+		})
+	})
+	Describe("RecordBackupCopies", func() {
+		copies := []history.BackupCopy{{Status: history.BackupStatusSucceed}, {BackupDir: "/copy", Status: history.BackupStatusSucceed}}
+
+		It("records the copies in the entry of the backup", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{{Timestamp: "20170202020202"}, {Timestamp: "20170101010101", DatabaseName: "testdb"}}}
+
+			restore.RecordBackupCopies(backupHistory, &history.BackupConfig{Timestamp: "20170101010101", Copies: copies})
+
+			Expect(backupHistory.BackupConfigs).To(Equal([]history.BackupConfig{
+				{Timestamp: "20170202020202"},
+				{Timestamp: "20170101010101", DatabaseName: "testdb", Copies: copies},
+			}))
+		})
+		It("adds a backup missing from the history", func() {
+			backupHistory := &history.History{BackupConfigs: []history.BackupConfig{{Timestamp: "20170202020202"}}}
+
+			restore.RecordBackupCopies(backupHistory, &history.BackupConfig{Timestamp: "20170101010101", Copies: copies})
+
+			Expect(backupHistory.BackupConfigs).To(HaveLen(2))
+			Expect(backupHistory.BackupConfigs[1].Copies).To(Equal(copies))
+		})
+	})
+	Describe("Run with --copy-to-dir or --copy-to-plugin-config", func() {
+		BeforeEach(func() {
+			restore.SetVersion("1.0.0")
+		})
+		AfterEach(func() {
+			restore.SetVersion("")
+			gplog.SetErrorCode(0)
+		})
+
+		It("returns an error with both destinations", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:             {"20170101010101"},
+				options.COPY_TO_DIR:           {"/copy"},
+				options.COPY_TO_PLUGIN_CONFIG: {"/tmp/s3_config.yaml"},
+			}})
+
+			Expect(err).To(MatchError("The following flags may not be specified together: copy-to-dir, copy-to-plugin-config"))
+		})
+		It("returns an error with flags for restoring a backup", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:   {"20170101010101"},
+				options.COPY_TO_DIR: {"/copy"},
+				options.DATA_ONLY:   {"true"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --data-only with --copy-to-dir"))
+		})
+		It("returns an error when copying to the plugin config the backup is read with", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:             {"20170101010101"},
+				options.PLUGIN_CONFIG:         {"/tmp/s3_config.yaml"},
+				options.COPY_TO_PLUGIN_CONFIG: {"/tmp/s3_config.yaml"},
+			}})
+
+			Expect(err).To(MatchError("Cannot copy a backup to the plugin config it is read with"))
+		})
+	})
+})
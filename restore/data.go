@@ -5,6 +5,7 @@ package restore
  */
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
@@ -24,7 +25,7 @@ var (
 	tableDelim = ","
 )
 
-func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
+func CopyTableIn(ctx context.Context, connectionPool *dbconn.DBConn, tableName string, tableAttributes string, destinationToRead string, singleDataFile bool, whichConn int) (int64, error) {
 	whichConn = connectionPool.ValidateConnNum(whichConn)
 	copyCommand := ""
 	readFromDestinationCommand := "cat"
@@ -34,14 +35,14 @@ func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttribute
 		//helper.go handles compression, so we don't want to set it here
 		customPipeThroughCommand = "cat -"
 	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
-		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", pluginConfig.ExecutablePath, pluginConfig.ConfigPath)
+		readFromDestinationCommand = fmt.Sprintf("%s restore_data %s", state.pluginConfig.ExecutablePath, state.pluginConfig.ConfigPath)
 	}
 
 	copyCommand = fmt.Sprintf("PROGRAM '%s %s | %s'", readFromDestinationCommand, destinationToRead, customPipeThroughCommand)
 
 	query := fmt.Sprintf("COPY %s%s FROM %s WITH CSV DELIMITER '%s' ON SEGMENT;", tableName, tableAttributes, copyCommand, tableDelim)
 	gplog.Verbose(query)
-	result, err := connectionPool.Exec(query, whichConn)
+	result, err := connectionPool.ExecContext(ctx, query, whichConn)
 	if err != nil {
 		errStr := fmt.Sprintf("Error loading data into table %s", tableName)
 
@@ -58,14 +59,16 @@ func CopyTableIn(connectionPool *dbconn.DBConn, tableName string, tableAttribute
 
 func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry, tableName string, whichConn int) error {
 	destinationToRead := ""
-	if backupConfig.SingleDataFile {
+	if state.backupConfig.SingleDataFile {
 		destinationToRead = fmt.Sprintf("%s_%d", fpInfo.GetSegmentPipePathForCopyCommand(), entry.Oid)
 	} else {
-		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, backupConfig.SingleDataFile)
+		destinationToRead = fpInfo.GetTableBackupFilePathForCopyCommand(entry.Oid, utils.GetPipeThroughProgram().Extension, state.backupConfig.SingleDataFile)
 	}
-	numRowsRestored, err := CopyTableIn(connectionPool, tableName, entry.AttributeString, destinationToRead, backupConfig.SingleDataFile, whichConn)
+	copyCtx, cancelCopy := utils.NewTimeoutContext(state.runCtx, MustGetFlagInt(options.COPY_TIMEOUT))
+	numRowsRestored, err := CopyTableIn(copyCtx, state.connectionPool, tableName, entry.AttributeString, destinationToRead, state.backupConfig.SingleDataFile, whichConn)
+	cancelCopy()
 	if err != nil {
-		return err
+		return getCopyError(copyCtx, tableName, err)
 	}
 	numRowsBackedUp := entry.RowsCopied
 	err = CheckRowsRestored(numRowsRestored, numRowsBackedUp, tableName)
@@ -75,6 +78,17 @@ func restoreSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataE
 	return nil
 }
 
+// The error of a COPY canceled by a timeout does not say which timeout expired
+func getCopyError(copyCtx context.Context, tableName string, err error) error {
+	if copyCtx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" {
+		return errors.Errorf("%s while restoring data to table %s", timeoutMsg, tableName)
+	}
+	return errors.Errorf("Restoring data to table %s took more than the --%s of %d seconds", tableName, options.COPY_TIMEOUT, MustGetFlagInt(options.COPY_TIMEOUT))
+}
+
 func CheckRowsRestored(rowsRestored int64, rowsBackedUp int64, tableName string) error {
 	if rowsRestored != rowsBackedUp {
 		rowsErrMsg := fmt.Sprintf("Expected to restore %d rows to table %s, but restored %d instead", rowsBackedUp, tableName, rowsRestored)
@@ -91,24 +105,26 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 		return
 	}
 
-	if backupConfig.SingleDataFile {
+	if state.backupConfig.SingleDataFile {
 		gplog.Verbose("Initializing pipes and gpbackup_helper on segments for single data file restore")
-		utils.VerifyHelperVersionOnSegments(version, globalCluster)
+		utils.VerifyHelperVersionOnSegments(version, state.globalCluster)
 		filteredOids := make([]string, totalTables)
 		for i, entry := range dataEntries {
 			filteredOids[i] = fmt.Sprintf("%d", entry.Oid)
 		}
-		utils.WriteOidListToSegments(filteredOids, globalCluster, fpInfo)
+		utils.WriteOidListToSegments(filteredOids, state.globalCluster, fpInfo)
 		firstOid := fmt.Sprintf("%d", dataEntries[0].Oid)
-		utils.CreateFirstSegmentPipeOnAllHosts(firstOid, globalCluster, fpInfo)
-		if wasTerminated {
+		utils.CreateFirstSegmentPipeOnAllHosts(firstOid, state.globalCluster, fpInfo)
+		if wasCanceled() {
 			return
 		}
 		isFilter := false
-		if len(opts.IncludedRelations) > 0 || len(opts.ExcludedRelations) > 0 || len(opts.IncludedSchemas) > 0 || len(opts.ExcludedSchemas) > 0 {
+		if len(state.opts.IncludedRelations) > 0 || len(state.opts.ExcludedRelations) > 0 || len(state.opts.IncludedSchemas) > 0 || len(state.opts.ExcludedSchemas) > 0 {
 			isFilter = true
 		}
-		utils.StartGpbackupHelpers(globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), "", MustGetFlagBool(options.ON_ERROR_CONTINUE), isFilter, &wasTerminated)
+		utils.StartGpbackupHelpers(state.runCtx, state.globalCluster, fpInfo, "--restore-agent", MustGetFlagString(options.PLUGIN_CONFIG), "", MustGetFlagBool(options.ON_ERROR_CONTINUE), isFilter)
+	} else if isMigrateMode() {
+		CreateMigrationPipesOnAllHosts(state.globalCluster, fpInfo, dataEntries)
 	}
 	/*
 	 * We break when an interrupt is received and rely on
@@ -121,28 +137,34 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 	var numErrors int32
 	var mutex = &sync.Mutex{}
 
-	for i := 0; i < connectionPool.NumConns; i++ {
+	numWorkers := state.connectionPool.NumConns
+	if state.pluginConfig != nil && !state.backupConfig.SingleDataFile {
+		// Each table is copied through its own plugin process
+		numWorkers = state.pluginConfig.LimitConcurrency(numWorkers)
+	}
+	for i := 0; i < numWorkers; i++ {
 		workerPool.Add(1)
 		go func(whichConn int) {
 			defer workerPool.Done()
 
 			setGUCsForConnection(gucStatements, whichConn)
 			for entry := range tasks {
-				if wasTerminated {
+				if state.runCtx.Err() != nil {
 					dataProgressBar.(*pb.ProgressBar).NotPrint = true
 					return
 				}
-				tableName := utils.MakeFQN(entry.Schema, entry.Name)
-				if opts.RedirectSchema != "" {
-					tableName = utils.MakeFQN(opts.RedirectSchema, entry.Name)
-				}
+				tableName := utils.MakeFQN(redirectedTableName(entry.Schema, entry.Name))
 				// Truncate table before restore, if needed
 				var err error
 				if MustGetFlagBool(options.INCREMENTAL) || MustGetFlagBool(options.TRUNCATE_TABLE) {
 					err = TruncateTable(tableName, whichConn)
 				}
 				if err == nil {
-					err = restoreSingleTableData(&fpInfo, entry, tableName, whichConn)
+					if isMigrateMode() {
+						err = migrateSingleTableData(&fpInfo, entry, tableName, whichConn)
+					} else {
+						err = restoreSingleTableData(&fpInfo, entry, tableName, whichConn)
+					}
 
 					atomic.AddInt64(&tableNum, 1)
 					if gplog.GetVerbosity() > gplog.LOGINFO {
@@ -161,12 +183,12 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 						return
 					}
 					mutex.Lock()
-					errorTablesData[tableName] = Empty{}
+					state.errorTablesData[tableName] = Empty{}
 					mutex.Unlock()
 				}
 
-				if backupConfig.SingleDataFile {
-					agentErr := utils.CheckAgentErrorsOnSegments(globalCluster, globalFPInfo)
+				if state.backupConfig.SingleDataFile {
+					agentErr := utils.CheckAgentErrorsOnSegments(state.globalCluster, state.globalFPInfo)
 					if agentErr != nil {
 						gplog.Error(agentErr.Error())
 						return
@@ -182,6 +204,10 @@ func restoreDataFromTimestamp(fpInfo filepath.FilePathInfo, dataEntries []toc.Ma
 	}
 	close(tasks)
 	workerPool.Wait()
+	checkTimeout()
+	if state.backupConfig.SingleDataFile && state.pluginConfig != nil && state.pluginConfig.BuffersData() {
+		state.pluginConfig.CollectHelperRetries(state.globalCluster, fpInfo)
+	}
 
 	if numErrors > 0 {
 		fmt.Println("")
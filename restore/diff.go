@@ -0,0 +1,165 @@
+package restore
+
+/*
+ * This file contains functions for comparing the metadata in a backup with
+ * the metadata of the database it would be restored into with --diff, or
+ * with the metadata and data of another backup with --diff-timestamp.
+ */
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * The metadata of the database is generated by the same code gpbackup uses,
+ * so objects that have not changed since the backup have identical
+ * statements on both sides.  Both sides are then filtered the same way a
+ * restore would filter the backup.
+ */
+func diffBackupWithDatabase(unquotedDBName string) {
+	gplog.Info("Comparing backup %s with database %s", state.globalFPInfo.Timestamp, unquotedDBName)
+	state.connectionPool = dbconn.NewDBConnFromEnvironment(unquotedDBName)
+	state.connectionPool.MustConnect(1)
+	utils.ValidateGPDBVersionCompatibility(state.connectionPool)
+
+	databaseMetadata := bytes.NewBuffer(nil)
+	databaseTOC := backup.GenerateMetadata(state.connectionPool, utils.NewFileWithByteCount(databaseMetadata), MustGetFlagBool(options.WITH_GLOBALS))
+	databaseFile := bytes.NewReader(databaseMetadata.Bytes())
+	backupFile := iohelper.MustOpenFileForReading(state.globalFPInfo.GetMetadataFilePath())
+	defer backupFile.Close()
+
+	diffReport := toc.DiffReport{Old: fmt.Sprintf("backup %s", state.globalFPInfo.Timestamp), New: fmt.Sprintf("database %s", unquotedDBName)}
+	quotedDBName := utils.QuoteIdent(state.connectionPool, unquotedDBName)
+	diffMetadataSections(&diffReport, state.globalTOC, backupFile, databaseTOC, databaseFile, state.backupConfig.DatabaseName, quotedDBName)
+	gplog.Info("%d added, %d removed, %d changed", diffReport.Added, diffReport.Removed, diffReport.Changed)
+	err := writeDiffReport(os.Stdout, &diffReport, MustGetFlagString(options.DIFF_FORMAT))
+	gplog.FatalOnError(err)
+}
+
+/*
+ * The backup passed with --timestamp is the old side of the comparison and
+ * the backup passed with --diff-timestamp is the new side.  Along with the
+ * metadata, the rows copied for each table and the modification counts of
+ * append-optimized tables are compared, as these show which tables an
+ * incremental backup taken at the later time would have backed up.
+ */
+func diffBackups(newTimestamp string) {
+	gplog.Info("Comparing backup %s with backup %s", state.globalFPInfo.Timestamp, newTimestamp)
+	newFPInfo, newConfig, newTOC := loadBackupWithoutConnection(newTimestamp)
+	oldFile := iohelper.MustOpenFileForReading(state.globalFPInfo.GetMetadataFilePath())
+	defer oldFile.Close()
+	newFile := iohelper.MustOpenFileForReading(newFPInfo.GetMetadataFilePath())
+	defer newFile.Close()
+
+	diffReport := toc.DiffReport{Old: fmt.Sprintf("backup %s", state.globalFPInfo.Timestamp), New: fmt.Sprintf("backup %s", newTimestamp)}
+	diffMetadataSections(&diffReport, state.globalTOC, oldFile, newTOC, newFile, state.backupConfig.DatabaseName, newConfig.DatabaseName)
+
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
+	diffReport.Tables = toc.DiffDataEntries(getRestorePlanDataEntries(state.backupConfig, state.globalTOC, filters),
+		getRestorePlanDataEntries(newConfig, newTOC, filters))
+	diffReport.AOTables = toc.DiffIncrementalMetadata(getAOEntriesToDiff(state.globalTOC, filters), getAOEntriesToDiff(newTOC, filters))
+	gplog.Info("%d added, %d removed, %d changed", diffReport.Added, diffReport.Removed, diffReport.Changed)
+	err := writeDiffReport(os.Stdout, &diffReport, MustGetFlagString(options.DIFF_FORMAT))
+	gplog.FatalOnError(err)
+}
+
+/*
+ * Global objects that reference the database, such as its GUCs, name the old
+ * database in the old statements, so oldDBName is replaced with newDBName
+ * there before comparing them.
+ */
+func diffMetadataSections(diffReport *toc.DiffReport, oldTOC *toc.TOC, oldFile io.ReaderAt, newTOC *toc.TOC, newFile io.ReaderAt, oldDBName string, newDBName string) {
+	for _, section := range []string{"global", "predata", "postdata"} {
+		if section == "global" && !MustGetFlagBool(options.WITH_GLOBALS) {
+			continue
+		}
+		oldStatements := getStatementsToDiff(oldTOC, section, oldFile)
+		newStatements := getStatementsToDiff(newTOC, section, newFile)
+		if section == "global" {
+			oldStatements = toc.SubstituteRedirectDatabaseInStatements(oldStatements, oldDBName, newDBName)
+		}
+		diffReport.AddObjectDiffs(toc.DiffStatements(section, oldStatements, newStatements))
+	}
+}
+
+/*
+ * Returns the statements a restore would run for the section, other than the
+ * session GUCs and the CREATE DATABASE statement, which only configure the
+ * restore itself.
+ */
+func getStatementsToDiff(tocfile *toc.TOC, section string, metadataFile io.ReaderAt) []toc.StatementWithType {
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
+	getStatements := func(includeObjectTypes []string, excludeObjectTypes []string) []toc.StatementWithType {
+		inSchemas, exSchemas, inRelations, exRelations := getFilterLists(includeObjectTypes, filters)
+		return tocfile.GetSQLStatementForObjectTypes(section, metadataFile, includeObjectTypes, excludeObjectTypes, inSchemas, exSchemas, inRelations, exRelations)
+	}
+
+	var statements []toc.StatementWithType
+	switch section {
+	case "global":
+		statements = getStatements([]string{"DATABASE GUC", "DATABASE METADATA", "RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GUCS", "ROLE GRANT", "TABLESPACE"}, []string{})
+	case "predata":
+		statements = getStatements([]string{"SCHEMA"}, []string{})
+		statements = append(statements, getStatements([]string{}, []string{"SCHEMA"})...)
+	default:
+		statements = getStatements([]string{}, []string{})
+	}
+	return FilterStatementsByUserObjectTypes(statements)
+}
+
+func writeDiffReport(writer io.Writer, diffReport *toc.DiffReport, format string) error {
+	if format == options.DIFF_FORMAT_JSON {
+		return diffReport.WriteJSON(writer)
+	}
+	return diffReport.WriteText(writer)
+}
+
+/*
+ * The incremental metadata is keyed by the quoted FQN of each table, so the
+ * schema of each table is taken from its FQN to filter it.  Tables are not
+ * looked up in the data entries, which leave out tables such as those whose
+ * data was excluded from the backup.
+ */
+func getAOEntriesToDiff(tocfile *toc.TOC, filters Filters) map[string]toc.AOEntry {
+	aoEntries := make(map[string]toc.AOEntry)
+	for tableFQN, aoEntry := range tocfile.IncrementalMetadata.AO {
+		if utils.SchemaIsExcludedByUser(filters.includeSchemas, filters.excludeSchemas, getSchemaFromFQN(tableFQN)) {
+			continue
+		}
+		if utils.RelationIsExcludedByUser(filters.includeRelations, filters.excludeRelations, tableFQN) {
+			continue
+		}
+		aoEntries[tableFQN] = aoEntry
+	}
+	return aoEntries
+}
+
+// Returns the quoted schema of a quoted FQN, whose schema may contain dots
+func getSchemaFromFQN(tableFQN string) string {
+	if !strings.HasPrefix(tableFQN, `"`) {
+		return strings.SplitN(tableFQN, ".", 2)[0]
+	}
+	for i := 1; i < len(tableFQN); i++ {
+		if tableFQN[i] != '"' {
+			continue
+		}
+		if i+1 < len(tableFQN) && tableFQN[i+1] == '"' {
+			i++
+			continue
+		}
+		return tableFQN[:i+1]
+	}
+	return tableFQN
+}
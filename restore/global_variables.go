@@ -1,6 +1,7 @@
 package restore
 
 import (
+	"context"
 	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -24,94 +25,120 @@ type Empty struct{}
  */
 
 /*
- * Non-flag variables
+ * The state of a restore, which a new restore replaces as a whole so that
+ * nothing is left over from a previous restore in the same process.  As the
+ * functions of this package share the state of the restore in progress, only
+ * one restore may run in a process at a time.
  */
-
-var (
+type runState struct {
 	backupConfig        *history.BackupConfig
+	backupDirMap        map[int]string
 	connectionPool      *dbconn.DBConn
 	globalCluster       *cluster.Cluster
 	globalFPInfo        filepath.FilePathInfo
 	globalTOC           *toc.TOC
 	pluginConfig        *utils.PluginConfig
+	copyPluginConfig    *utils.PluginConfig
+	migrationSourcePool *dbconn.DBConn
 	restoreStartTime    string
-	version             string
+	/*
+	 * The restore is terminated if it is canceled before it completes.  The
+	 * mutex orders the two, as the restore is canceled on another goroutine.
+	 */
+	terminationMutex    sync.Mutex
 	wasTerminated       bool
+	completed           bool
 	errorTablesMetadata map[string]Empty
 	errorTablesData     map[string]Empty
 	opts                *options.Options
+	// Maps the FQN of each table selected with --use-list to its position in the list file
+	listedDataEntries map[string]int
+	cmdFlags          *pflag.FlagSet
 	/*
-	 * Used for synchronizing DoCleanup.  In DoInit() we increment the group
-	 * and then wait for at least one DoCleanup to finish, either in DoTeardown
-	 * or the signal handler.
+	 * Canceled when the restore is canceled or --timeout expires, which cancels
+	 * the COPY commands, statements, cluster commands, and plugin commands in
+	 * progress.
 	 */
-	CleanupGroup *sync.WaitGroup
-)
+	runCtx    context.Context
+	cancelRun context.CancelFunc
+	/*
+	 * Used for synchronizing DoCleanup.  The group is incremented when the
+	 * state is created, and a canceled restore waits for the DoCleanup of the
+	 * cancellation to finish before returning.
+	 */
+	cleanupGroup *sync.WaitGroup
+}
 
-func init() {
-	// Initialize global variables
-	errorTablesMetadata = make(map[string]Empty)
-	errorTablesData = make(map[string]Empty)
+func newRunState(ctx context.Context) *runState {
+	cleanupGroup := &sync.WaitGroup{}
+	cleanupGroup.Add(1)
+	return &runState{
+		errorTablesMetadata: make(map[string]Empty),
+		errorTablesData:     make(map[string]Empty),
+		runCtx:              ctx,
+		cancelRun:           func() {},
+		cleanupGroup:        cleanupGroup,
+	}
 }
 
-/*
- * Command-line flags
- */
-var cmdFlags *pflag.FlagSet
+var (
+	state   = newRunState(context.Background())
+	version string
+)
 
 /*
  * Setter functions
  */
 
 func SetCmdFlags(flagSet *pflag.FlagSet) {
-	cmdFlags = flagSet
-	options.SetRestoreFlagDefaults(cmdFlags)
+	state.cmdFlags = flagSet
+	options.SetRestoreFlagDefaults(state.cmdFlags)
 }
 
 func SetBackupConfig(config *history.BackupConfig) {
-	backupConfig = config
+	state.backupConfig = config
 }
 
 func SetConnection(conn *dbconn.DBConn) {
-	connectionPool = conn
+	state.connectionPool = conn
 }
 
 func SetCluster(cluster *cluster.Cluster) {
-	globalCluster = cluster
+	state.globalCluster = cluster
 }
 
 func SetFPInfo(fpInfo filepath.FilePathInfo) {
-	globalFPInfo = fpInfo
+	state.globalFPInfo = fpInfo
 }
 
 func SetPluginConfig(config *utils.PluginConfig) {
-	pluginConfig = config
+	state.pluginConfig = config
 }
 
 func SetTOC(toc *toc.TOC) {
-	globalTOC = toc
+	state.globalTOC = toc
 }
 
 // Util functions to enable ease of access to global flag values
 
 func MustGetFlagString(flagName string) string {
-	return options.MustGetFlagString(cmdFlags, flagName)
+	return options.MustGetFlagString(state.cmdFlags, flagName)
 }
 
 func MustGetFlagInt(flagName string) int {
-	return options.MustGetFlagInt(cmdFlags, flagName)
+	return options.MustGetFlagInt(state.cmdFlags, flagName)
 }
 
 func MustGetFlagBool(flagName string) bool {
-	return options.MustGetFlagBool(cmdFlags, flagName)
+	return options.MustGetFlagBool(state.cmdFlags, flagName)
 }
 
 func MustGetFlagStringSlice(flagName string) []string {
-	return options.MustGetFlagStringSlice(cmdFlags, flagName)
+	return options.MustGetFlagStringSlice(state.cmdFlags, flagName)
 }
 
 func MustGetFlagStringArray(flagName string) []string {
-	return options.MustGetFlagStringArray(cmdFlags, flagName)
+	return options.MustGetFlagStringArray(state.cmdFlags, flagName)
 }
 
 func GetVersion() string {
@@ -0,0 +1,86 @@
+package restore
+
+/*
+ * This file contains functions for listing the entries in a backup with
+ * --list and for restoring only the entries selected with --use-list.
+ */
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Returns the data entries for every table in the restore plan of a backup
+ * that match the filters, across all backups in an incremental set, where
+ * tocfile is the table of contents of the backup itself.
+ */
+func getRestorePlanDataEntries(config *history.BackupConfig, tocfile *toc.TOC, filters Filters) []toc.MasterDataEntry {
+	dataEntries := make([]toc.MasterDataEntry, 0)
+	if config.MetadataOnly {
+		return dataEntries
+	}
+	for _, entry := range config.RestorePlan {
+		if len(entry.TableFQNs) == 0 {
+			continue
+		}
+		entryTOC := tocfile
+		if entry.Timestamp != config.Timestamp {
+			fpInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
+			entryTOC = toc.NewTOC(fpInfo.GetTOCFilePath())
+		}
+		dataEntries = append(dataEntries, entryTOC.GetDataEntriesMatching(filters.includeSchemas, filters.excludeSchemas,
+			filters.includeRelations, filters.excludeRelations, entry.TableFQNs)...)
+	}
+	return dataEntries
+}
+
+func printRestoreList() {
+	fmt.Printf(";\n; Backup timestamp: %s\n; Database: %s\n; Backup version: %s\n;\n", state.globalFPInfo.Timestamp, state.backupConfig.DatabaseName, state.backupConfig.BackupVersion)
+	fmt.Printf("; Comment out entries with a leading semicolon and pass this file to\n; gprestore --use-list to restore only the remaining entries.  Entries are\n; restored section by section, in the order they are listed within each section.\n;\n")
+	fmt.Printf("; ID; Section; Object Type; Schema; Name; Reference Object\n;\n")
+	err := toc.WriteListEntries(os.Stdout, state.globalTOC.GetListEntries(getRestorePlanDataEntries(state.backupConfig, state.globalTOC, Filters{})))
+	gplog.FatalOnError(err)
+}
+
+/*
+ * The TOC is reduced to the selected metadata entries before anything is
+ * restored, so every later step only sees those entries, and table data is
+ * filtered by the selected data entries in restoreData.  Sections are still
+ * restored one after another, but the entries within each section, schemas
+ * and post-data objects included, are restored in the order they were listed.
+ */
+func applyRestoreList(listFilename string) {
+	gplog.Info("Restoring entries selected in list file %s", listFilename)
+	ids, err := toc.ReadListFile(listFilename)
+	gplog.FatalOnError(err)
+	dataEntries, err := state.globalTOC.SelectListEntries(state.globalTOC.GetListEntries(getRestorePlanDataEntries(state.backupConfig, state.globalTOC, Filters{})), ids)
+	gplog.FatalOnError(err)
+	state.listedDataEntries = make(map[string]int, len(dataEntries))
+	for i, entry := range dataEntries {
+		state.listedDataEntries[utils.MakeFQN(entry.Schema, entry.Name)] = i
+	}
+}
+
+func filterDataEntriesByList(entries []toc.MasterDataEntry) []toc.MasterDataEntry {
+	if state.listedDataEntries == nil {
+		return entries
+	}
+	filteredEntries := make([]toc.MasterDataEntry, 0)
+	for _, entry := range entries {
+		if _, ok := state.listedDataEntries[utils.MakeFQN(entry.Schema, entry.Name)]; ok {
+			filteredEntries = append(filteredEntries, entry)
+		}
+	}
+	sort.SliceStable(filteredEntries, func(i, j int) bool {
+		return state.listedDataEntries[utils.MakeFQN(filteredEntries[i].Schema, filteredEntries[i].Name)] <
+			state.listedDataEntries[utils.MakeFQN(filteredEntries[j].Schema, filteredEntries[j].Name)]
+	})
+	return filteredEntries
+}
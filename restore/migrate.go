@@ -0,0 +1,229 @@
+package restore
+
+/*
+ * This file contains the functions for --migrate-from-dbname, which restores a
+ * database of another cluster without backing it up first.  The metadata of
+ * the database is generated as gpbackup would back it up and written to the
+ * master data directory, from which it is restored as the metadata of a
+ * backup would be and removed once the restore ends.  The data of each table
+ * is copied out of each segment of the other cluster straight into the
+ * matching segment of this cluster.
+ */
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/backup"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func isMigrateMode() bool {
+	return MustGetFlagString(options.MIGRATE_FROM_DBNAME) != ""
+}
+
+/*
+ * Connects to the database to migrate with as many connections as --jobs, so
+ * that each connection restoring data has one to copy the data out of, and
+ * writes its metadata and TOC under the timestamp in globalFPInfo.
+ */
+func generateMigrationMetadata() {
+	sourceDBName := MustGetFlagString(options.MIGRATE_FROM_DBNAME)
+	state.migrationSourcePool = dbconn.NewDBConnFromEnvironment(sourceDBName)
+	if host := MustGetFlagString(options.MIGRATE_FROM_HOST); host != "" {
+		state.migrationSourcePool.Host = host
+	}
+	if port := MustGetFlagInt(options.MIGRATE_FROM_PORT); port != 0 {
+		state.migrationSourcePool.Port = port
+	}
+	state.migrationSourcePool.MustConnect(MustGetFlagInt(options.JOBS))
+	utils.ValidateGPDBVersionCompatibility(state.migrationSourcePool)
+	gplog.Info("Migrating database %s from %s:%d", sourceDBName, state.migrationSourcePool.Host, state.migrationSourcePool.Port)
+
+	sourceCluster := cluster.NewCluster(cluster.MustGetSegmentConfiguration(state.migrationSourcePool))
+	err := ValidateMigrationSegmentCount(sourceCluster, state.globalCluster)
+	gplog.FatalOnError(err)
+	quotedDBName := dbconn.MustSelectString(state.migrationSourcePool, fmt.Sprintf("SELECT quote_ident(datname) AS string FROM pg_database WHERE datname='%s'", utils.EscapeSingleQuotes(sourceDBName)))
+
+	_, err = state.globalCluster.ExecuteLocalCommand(fmt.Sprintf("mkdir -p %s", state.globalFPInfo.GetDirForContent(-1)))
+	gplog.FatalOnError(err)
+	metadataFilename := state.globalFPInfo.GetMetadataFilePath()
+	gplog.Info("Metadata will be written to %s", metadataFilename)
+	metadataFile := utils.NewFileWithByteCountFromFile(metadataFilename)
+	migrationTOC := backup.GenerateMigrationMetadata(state.migrationSourcePool, metadataFile, state.globalFPInfo.Timestamp)
+	metadataFile.Close()
+	migrationTOC.WriteToFileAndMakeReadOnly(state.globalFPInfo.GetTOCFilePath())
+
+	state.backupConfig = NewMigrationConfig(quotedDBName, state.migrationSourcePool.Version.VersionString, state.globalFPInfo.Timestamp, migrationTOC)
+	// The data is not compressed, as it is never written to a file
+	utils.InitializePipeThroughParameters(false, 0)
+	report.EnsureDatabaseVersionCompatibility(state.backupConfig.DatabaseVersion, state.connectionPool.Version)
+}
+
+/*
+ * The generated metadata and TOC are only of use to the restore that generated
+ * them, so they are removed when it ends, while the restore report and the
+ * lists of tables with errors written alongside them are kept.
+ */
+func RemoveMigrationMetadataFiles(fpInfo filepath.FilePathInfo) {
+	for _, filename := range []string{fpInfo.GetMetadataFilePath(), fpInfo.GetTOCFilePath()} {
+		err := utils.RemoveFileIfExists(filename)
+		if err != nil {
+			gplog.Warn("Unable to remove %s: %v", filename, err)
+		}
+	}
+}
+
+/*
+ * The data of each segment is copied into the segment of this cluster with
+ * the same content ID, so the clusters must have the same number of segments.
+ */
+func ValidateMigrationSegmentCount(sourceCluster *cluster.Cluster, targetCluster *cluster.Cluster) error {
+	numSourceSegments := len(sourceCluster.ContentIDs) - 1
+	numTargetSegments := len(targetCluster.ContentIDs) - 1
+	if numSourceSegments != numTargetSegments {
+		return errors.Errorf("Cannot migrate a database from a cluster with %d segments to a cluster with %d segments.  The clusters must have the same number of segments.",
+			numSourceSegments, numTargetSegments)
+	}
+	return nil
+}
+
+// Describes the generated metadata as a full backup of the database to migrate
+func NewMigrationConfig(quotedDBName string, dbVersion string, timestamp string, tocfile *toc.TOC) *history.BackupConfig {
+	config := &history.BackupConfig{
+		BackupVersion:   version,
+		DatabaseName:    quotedDBName,
+		DatabaseVersion: dbVersion,
+		MetadataOnly:    len(tocfile.DataEntries) == 0,
+		Timestamp:       timestamp,
+		Status:          history.BackupStatusSucceed,
+	}
+	SetRestorePlanForLegacyBackup(tocfile, timestamp, config)
+	return config
+}
+
+/*
+ * Returns the command that each segment of the cluster being migrated from
+ * runs to send the data of a table to the segment of this cluster with the
+ * same content ID, which writes it over ssh to the pipe that segment reads the
+ * table from.  Each segment only has its own content ID substituted into the
+ * command, so the host and pipe of every segment are listed in it.
+ */
+func ConstructMigrationSendProgram(c *cluster.Cluster, fpInfo filepath.FilePathInfo, oid uint32) string {
+	var segmentCases strings.Builder
+	for _, contentID := range c.ContentIDs {
+		if contentID == -1 {
+			continue
+		}
+		segmentCases.WriteString(fmt.Sprintf("%d) host=%s; pipe=%s_%d;; ", contentID, c.GetHostForContent(contentID), fpInfo.GetSegmentPipeFilePath(contentID), oid))
+	}
+	return fmt.Sprintf(`case <SEGID> in %sesac; ssh -o BatchMode=yes $host "cat > $pipe"`, segmentCases.String())
+}
+
+func CreateMigrationPipesOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo, dataEntries []toc.MasterDataEntry) {
+	oids := make([]string, len(dataEntries))
+	for i, entry := range dataEntries {
+		oids[i] = fmt.Sprintf("%d", entry.Oid)
+	}
+	remoteOutput := c.GenerateAndExecuteCommand("Creating segment data pipes", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("for oid in %s; do mkfifo %s_$oid || exit 1; done", strings.Join(oids, " "), fpInfo.GetSegmentPipeFilePath(contentID))
+	})
+	c.CheckClusterError(remoteOutput, "Unable to create segment data pipes", func(contentID int) string {
+		return "Unable to create segment data pipes"
+	})
+}
+
+/*
+ * Opening a pipe for both reading and writing does not block, so doing so
+ * lets a COPY on either cluster that is waiting for the other cluster to open
+ * the pipe go on, and end, when the other cluster's COPY has already failed.
+ */
+func unblockMigrationPipesCommand(pipePattern string) string {
+	return fmt.Sprintf(`for pipe in %s; do if [[ -p "$pipe" ]]; then : <> "$pipe"; fi; done`, pipePattern)
+}
+
+func unblockMigrationPipeOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo, oid uint32) {
+	remoteOutput := c.GenerateAndExecuteCommand("Unblocking segment data pipes", cluster.ON_SEGMENTS, func(contentID int) string {
+		return unblockMigrationPipesCommand(fmt.Sprintf("%s_%d", fpInfo.GetSegmentPipeFilePath(contentID), oid))
+	})
+	c.CheckClusterError(remoteOutput, "Unable to unblock segment data pipes", func(contentID int) string {
+		return "Unable to unblock segment data pipe"
+	}, true)
+}
+
+func CleanUpMigrationPipesOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+	remoteOutput := c.GenerateAndExecuteCommand("Removing segment data pipes", cluster.ON_SEGMENTS, func(contentID int) string {
+		pipePattern := fmt.Sprintf("%s_*", fpInfo.GetSegmentPipeFilePath(contentID))
+		return fmt.Sprintf("%s; rm -f %s", unblockMigrationPipesCommand(pipePattern), pipePattern)
+	})
+	errMsg := fmt.Sprintf("Unable to remove segment data pipes. See %s for a complete list of segments with errors and remove manually.",
+		gplog.GetLogFilePath())
+	c.CheckClusterError(remoteOutput, errMsg, func(contentID int) string {
+		return fmt.Sprintf("Unable to remove segment data pipes on segment %d on host %s", contentID, c.GetHostForContent(contentID))
+	}, true)
+}
+
+/*
+ * Copies the data of a table out of the cluster being migrated from and into
+ * this cluster at the same time, through the pipe of each segment.  If either
+ * COPY fails, the other one ends with the rows sent so far rather than with an
+ * error, so the COPY into this cluster runs in a transaction that is only
+ * committed once both have succeeded and copied the same number of rows.
+ */
+func migrateSingleTableData(fpInfo *filepath.FilePathInfo, entry toc.MasterDataEntry, tableName string, whichConn int) error {
+	sourceTable := backup.Table{Relation: backup.Relation{Schema: entry.Schema, Name: entry.Name}}
+	sendProgram := ConstructMigrationSendProgram(state.globalCluster, *fpInfo, entry.Oid)
+	pipeToRead := fmt.Sprintf("%s_%d", fpInfo.GetSegmentPipePathForCopyCommand(), entry.Oid)
+
+	err := state.connectionPool.Begin(whichConn)
+	if err != nil {
+		return err
+	}
+	copyCtx, cancelCopy := utils.NewTimeoutContext(state.runCtx, MustGetFlagInt(options.COPY_TIMEOUT))
+	defer cancelCopy()
+	var copyErr error
+	var failOnce sync.Once
+	fail := func(err error) {
+		failOnce.Do(func() {
+			copyErr = err
+			cancelCopy()
+			unblockMigrationPipeOnAllHosts(state.globalCluster, *fpInfo, entry.Oid)
+		})
+	}
+
+	var rowsSent int64
+	var sendDone sync.WaitGroup
+	sendDone.Add(1)
+	go func() {
+		defer sendDone.Done()
+		var sendErr error
+		rowsSent, sendErr = backup.CopyTableOutToProgram(copyCtx, state.migrationSourcePool, sourceTable, sendProgram, whichConn)
+		if sendErr != nil {
+			fail(errors.Wrapf(sendErr, "Error copying data out of table %s", utils.MakeFQN(entry.Schema, entry.Name)))
+		}
+	}()
+	rowsRestored, err := CopyTableIn(copyCtx, state.connectionPool, tableName, entry.AttributeString, pipeToRead, true, whichConn)
+	if err != nil {
+		fail(err)
+	}
+	sendDone.Wait()
+
+	if copyErr == nil {
+		copyErr = CheckRowsRestored(rowsRestored, rowsSent, tableName)
+	}
+	if copyErr != nil {
+		_ = state.connectionPool.Rollback(whichConn)
+		return getCopyError(copyCtx, tableName, copyErr)
+	}
+	return state.connectionPool.Commit(whichConn)
+}
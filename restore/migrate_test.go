@@ -0,0 +1,152 @@
+package restore_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/migrate tests", func() {
+	var (
+		testCluster *cluster.Cluster
+		testFPInfo  filepath.FilePathInfo
+	)
+	BeforeEach(func() {
+		testCluster = cluster.NewCluster([]cluster.SegConfig{
+			{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master"},
+			{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1"},
+			{ContentID: 1, DataDir: "/data/gpseg1", Hostname: "segment2"},
+		})
+		testFPInfo = filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+		testFPInfo.PID = 1234
+	})
+
+	Describe("ConstructMigrationSendProgram", func() {
+		It("sends the data of each segment to the pipe of the segment with the same content ID", func() {
+			program := restore.ConstructMigrationSendProgram(testCluster, testFPInfo, 16384)
+
+			Expect(program).To(Equal(`case <SEGID> in ` +
+				`0) host=segment1; pipe=/data/gpseg0/gpbackup_0_20170101010101_pipe_1234_16384;; ` +
+				`1) host=segment2; pipe=/data/gpseg1/gpbackup_1_20170101010101_pipe_1234_16384;; ` +
+				`esac; ssh -o BatchMode=yes $host "cat > $pipe"`))
+		})
+	})
+	Describe("ValidateMigrationSegmentCount", func() {
+		It("accepts clusters with the same number of segments", func() {
+			sourceCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/old/gpseg-1", Hostname: "oldmaster"},
+				{ContentID: 0, DataDir: "/old/gpseg0", Hostname: "oldsegment"},
+				{ContentID: 1, DataDir: "/old/gpseg1", Hostname: "oldsegment"},
+			})
+
+			Expect(restore.ValidateMigrationSegmentCount(sourceCluster, testCluster)).To(Succeed())
+		})
+		It("returns an error for clusters with different numbers of segments", func() {
+			sourceCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/old/gpseg-1", Hostname: "oldmaster"},
+				{ContentID: 0, DataDir: "/old/gpseg0", Hostname: "oldsegment"},
+			})
+
+			err := restore.ValidateMigrationSegmentCount(sourceCluster, testCluster)
+
+			Expect(err).To(MatchError("Cannot migrate a database from a cluster with 1 segments to a cluster with 2 segments.  The clusters must have the same number of segments."))
+		})
+	})
+	Describe("NewMigrationConfig", func() {
+		It("describes a full backup that restores the data of every table", func() {
+			tocfile := &toc.TOC{DataEntries: []toc.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 16384}, {Schema: "public", Name: "bar", Oid: 16390}}}
+
+			config := restore.NewMigrationConfig("testdb", "6.20.0", "20170101010101", tocfile)
+
+			Expect(config.DatabaseName).To(Equal("testdb"))
+			Expect(config.DatabaseVersion).To(Equal("6.20.0"))
+			Expect(config.MetadataOnly).To(BeFalse())
+			Expect(config.RestorePlan).To(Equal([]history.RestorePlanEntry{
+				{Timestamp: "20170101010101", TableFQNs: []string{"public.foo", "public.bar"}},
+			}))
+		})
+		It("describes a metadata-only backup if no table has data to copy", func() {
+			config := restore.NewMigrationConfig("testdb", "6.20.0", "20170101010101", &toc.TOC{})
+
+			Expect(config.MetadataOnly).To(BeTrue())
+		})
+	})
+	Describe("CreateMigrationPipesOnAllHosts", func() {
+		It("creates a pipe for each table on each segment", func() {
+			executor := testutils.TestExecutorMultiple{ClusterOutputs: []*cluster.RemoteOutput{{}}}
+			testCluster.Executor = &executor
+
+			restore.CreateMigrationPipesOnAllHosts(testCluster, testFPInfo, []toc.MasterDataEntry{{Oid: 16384}, {Oid: 16390}})
+
+			commands := executor.ClusterCommands[0]
+			Expect(commands).To(HaveLen(2))
+			Expect(commands[0].CommandString).To(ContainSubstring("for oid in 16384 16390; do mkfifo /data/gpseg0/gpbackup_0_20170101010101_pipe_1234_$oid || exit 1; done"))
+			Expect(commands[1].CommandString).To(ContainSubstring("mkfifo /data/gpseg1/gpbackup_1_20170101010101_pipe_1234_$oid"))
+		})
+	})
+	Describe("RemoveMigrationMetadataFiles", func() {
+		It("removes the generated metadata and TOC but keeps the restore report", func() {
+			tempDir, err := ioutil.TempDir("", "migrate")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(tempDir)
+			fpInfo := filepath.NewFilePathInfo(testCluster, tempDir, "20170101010101", "gpseg")
+			reportFilename := fpInfo.GetRestoreReportFilePath("20170101010101")
+			Expect(os.MkdirAll(fpInfo.GetDirForContent(-1), 0755)).To(Succeed())
+			for _, filename := range []string{fpInfo.GetMetadataFilePath(), fpInfo.GetTOCFilePath(), reportFilename} {
+				Expect(ioutil.WriteFile(filename, []byte{}, 0444)).To(Succeed())
+			}
+
+			restore.RemoveMigrationMetadataFiles(fpInfo)
+
+			Expect(fpInfo.GetMetadataFilePath()).ToNot(BeAnExistingFile())
+			Expect(fpInfo.GetTOCFilePath()).ToNot(BeAnExistingFile())
+			Expect(reportFilename).To(BeAnExistingFile())
+		})
+	})
+	Describe("Run with --migrate-from-dbname", func() {
+		BeforeEach(func() {
+			restore.SetVersion("1.0.0")
+		})
+		AfterEach(func() {
+			restore.SetVersion("")
+			gplog.SetErrorCode(0)
+		})
+
+		It("returns an error with a backup to restore", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.MIGRATE_FROM_DBNAME: {"olddb"},
+				options.TIMESTAMP:           {"20170101010101"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --timestamp with --migrate-from-dbname"))
+		})
+		It("returns an error with --on-error-continue", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.MIGRATE_FROM_DBNAME: {"olddb"},
+				options.ON_ERROR_CONTINUE:   {"true"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --on-error-continue with --migrate-from-dbname"))
+		})
+		It("returns an error for a host to migrate from without a database", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:         {"20170101010101"},
+				options.MIGRATE_FROM_HOST: {"oldmaster"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --migrate-from-host without --migrate-from-dbname"))
+		})
+	})
+})
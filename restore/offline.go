@@ -0,0 +1,117 @@
+package restore
+
+/*
+ * This file contains functions for the gprestore modes that only read the
+ * files of one or more backups, such as --print-ddl and --diff-timestamp,
+ * and so do not connect to any database.
+ */
+
+import (
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+func isOfflineMode() bool {
+	return MustGetFlagBool(options.PRINT_DDL) || MustGetFlagString(options.DIFF_TIMESTAMP) != ""
+}
+
+/*
+ * Without a connection there is no segment configuration to read, so the
+ * cluster only contains the coordinator, whose data directory is used to
+ * locate the backup when --backup-dir is not passed.
+ */
+func setupWithoutConnection(backupTimestamp string) {
+	var err error
+	state.opts, err = options.NewOptions(state.cmdFlags)
+	gplog.FatalOnError(err)
+
+	backupDir := MustGetFlagString(options.BACKUP_DIR)
+	coordinatorDataDir := operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	if backupDir == "" && coordinatorDataDir == "" {
+		gplog.Fatal(errors.Errorf("Cannot locate backup %s without a database connection.  Pass --%s or set MASTER_DATA_DIRECTORY.", backupTimestamp, options.BACKUP_DIR), "")
+	}
+	state.globalCluster = cluster.NewCluster([]cluster.SegConfig{{DbID: 1, ContentID: -1, Role: "p", DataDir: coordinatorDataDir}})
+	state.globalFPInfo = GetBackupFPInfoForTimestamp(backupTimestamp)
+
+	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+		state.pluginConfig, err = utils.ReadPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG))
+		gplog.FatalOnError(err)
+		state.pluginConfig.SetContext(state.runCtx)
+		state.pluginConfig.SetBackupPluginVersion(backupTimestamp, FindHistoricalPluginVersion(backupTimestamp))
+	}
+	state.globalFPInfo, state.backupConfig, state.globalTOC = loadBackupWithoutConnection(backupTimestamp)
+	gplog.Info("gpbackup version = %s", state.backupConfig.BackupVersion)
+	gplog.Info("gprestore version = %s", GetVersion())
+	ValidateBackupFlagCombinations()
+
+	state.opts.IncludedRelations = quoteRelationsInBackupSet(state.opts.GetIncludedTables())
+	expandFilterPatternsInBackupSet()
+	validateFilterListsInBackupSet()
+}
+
+/*
+ * With a plugin, only the files needed to read the backup's metadata are
+ * retrieved, and the plugin is run on this host alone, so plugin setup and
+ * cleanup hooks are not called.  The table of contents of each backup in the
+ * restore plan is retrieved as well, for its data entries.
+ */
+func loadBackupWithoutConnection(timestamp string) (filepath.FilePathInfo, *history.BackupConfig, *toc.TOC) {
+	fpInfo := GetBackupFPInfoForTimestamp(timestamp)
+	if state.pluginConfig != nil {
+		state.pluginConfig.MustRestoreFile(fpInfo.GetConfigFilePath())
+	}
+	config := history.ReadConfigFile(fpInfo.GetConfigFilePath())
+	report.EnsureBackupVersionCompatibility(config.BackupVersion, version)
+	if state.pluginConfig != nil {
+		metadataFiles := []string{fpInfo.GetMetadataFilePath(), fpInfo.GetTOCFilePath()}
+		if MustGetFlagBool(options.WITH_STATS) {
+			metadataFiles = append(metadataFiles, fpInfo.GetStatisticsFilePath())
+		}
+		for _, entry := range config.RestorePlan {
+			if entry.Timestamp != timestamp {
+				entryFPInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
+				metadataFiles = append(metadataFiles, entryFPInfo.GetTOCFilePath())
+			}
+		}
+		for _, filename := range metadataFiles {
+			state.pluginConfig.MustRestoreFile(filename)
+		}
+	}
+
+	verifyMetadataFilePathsForBackup(fpInfo, MustGetFlagBool(options.WITH_STATS))
+	tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
+	tocfile.InitializeMetadataEntryMap()
+	if isLegacyBackup := config.RestorePlan == nil; isLegacyBackup {
+		SetRestorePlanForLegacyBackup(tocfile, timestamp, config)
+	}
+	return fpInfo, config, tocfile
+}
+
+/*
+ * Relations passed with --include-table are quoted by the database in a
+ * normal restore.  Every relation that can be restored is in the TOC, so its
+ * quoted name can be looked up there instead.  Relations that are not in the
+ * TOC are left as they are, to be reported by validateFilterListsInBackupSet.
+ */
+func quoteRelationsInBackupSet(relations []string) []string {
+	if len(relations) == 0 {
+		return relations
+	}
+	backupSetRelations, _ := state.globalTOC.GetRelationsAndSchemas()
+	quotedRelations := make([]string, 0, len(relations))
+	for _, relation := range relations {
+		if quotedRelation, ok := backupSetRelations[relation]; ok {
+			relation = quotedRelation
+		}
+		quotedRelations = append(quotedRelations, relation)
+	}
+	return quotedRelations
+}
@@ -22,21 +22,21 @@ var (
 
 func executeStatementsForConn(statements chan toc.StatementWithType, fatalErr *error, numErrors *int32, progressBar utils.ProgressBar, whichConn int, executeInParallel bool) {
 	for statement := range statements {
-		if wasTerminated || *fatalErr != nil {
+		if state.runCtx.Err() != nil || *fatalErr != nil {
 			return
 		}
-		_, err := connectionPool.Exec(statement.Statement, whichConn)
+		_, err := state.connectionPool.ExecContext(state.runCtx, statement.Statement, whichConn)
 		if err != nil {
 			gplog.Verbose("Error encountered when executing statement: %s Error was: %s", strings.TrimSpace(statement.Statement), err.Error())
 			if MustGetFlagBool(options.ON_ERROR_CONTINUE) {
 				if executeInParallel {
 					atomic.AddInt32(numErrors, 1)
 					mutex.Lock()
-					errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
+					state.errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
 					mutex.Unlock()
 				} else {
 					*numErrors = *numErrors + 1
-					errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
+					state.errorTablesMetadata[statement.Schema+"."+statement.Name] = Empty{}
 				}
 			} else {
 				*fatalErr = err
@@ -61,19 +61,24 @@ func ExecuteStatements(statements []toc.StatementWithType, progressBar utils.Pro
 	close(tasks)
 
 	if !executeInParallel {
-		connNum := connectionPool.ValidateConnNum(whichConn...)
+		connNum := state.connectionPool.ValidateConnNum(whichConn...)
 		executeStatementsForConn(tasks, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
 	} else {
-		for i := 0; i < connectionPool.NumConns; i++ {
+		for i := 0; i < state.connectionPool.NumConns; i++ {
 			workerPool.Add(1)
 			go func(connNum int) {
 				defer workerPool.Done()
-				connNum = connectionPool.ValidateConnNum(connNum)
+				connNum = state.connectionPool.ValidateConnNum(connNum)
 				executeStatementsForConn(tasks, &fatalErr, &numErrors, progressBar, connNum, executeInParallel)
 			}(i)
 		}
 		workerPool.Wait()
 	}
+	reportStatementErrors(fatalErr, numErrors)
+}
+
+func reportStatementErrors(fatalErr error, numErrors int32) {
+	checkTimeout()
 	if fatalErr != nil {
 		fmt.Println("")
 		gplog.Fatal(fatalErr, "")
@@ -83,6 +88,170 @@ func ExecuteStatements(statements []toc.StatementWithType, progressBar utils.Pro
 	}
 }
 
+/*
+ * Statements written to the TOC with an ObjectID are executed as a dependency
+ * graph across all connections: the statements for each object run in order
+ * on one connection as soon as every object it depends on has been created.
+ * Statements without an ObjectID, including all statements from backups taken
+ * before dependency information was recorded, act as barriers and run in
+ * their original order on a single connection.
+ */
+func ExecuteStatementsWithDependencies(statements []toc.StatementWithType, dependencies map[toc.UniqueID][]toc.UniqueID, progressBar utils.ProgressBar) {
+	batch := make([]toc.StatementWithType, 0)
+	batchHasDependencies := false
+	for _, statement := range statements {
+		hasDependencies := statement.ObjectID != (toc.UniqueID{})
+		if len(batch) > 0 && hasDependencies != batchHasDependencies {
+			executeStatementBatch(batch, batchHasDependencies, dependencies, progressBar)
+			batch = make([]toc.StatementWithType, 0)
+		}
+		batch = append(batch, statement)
+		batchHasDependencies = hasDependencies
+	}
+	if len(batch) > 0 {
+		executeStatementBatch(batch, batchHasDependencies, dependencies, progressBar)
+	}
+}
+
+func executeStatementBatch(statements []toc.StatementWithType, hasDependencies bool, dependencies map[toc.UniqueID][]toc.UniqueID, progressBar utils.ProgressBar) {
+	if wasCanceled() {
+		return
+	}
+	if hasDependencies {
+		executeDependencyGraph(statements, dependencies, progressBar)
+	} else {
+		ExecuteStatements(statements, progressBar, false)
+	}
+}
+
+type dependencyNode struct {
+	statements []toc.StatementWithType
+	dependents []int
+	inDegree   int
+	scheduled  bool
+}
+
+func executeDependencyGraph(statements []toc.StatementWithType, dependencies map[toc.UniqueID][]toc.UniqueID, progressBar utils.ProgressBar) {
+	nodes := make([]*dependencyNode, 0)
+	nodeIndexes := make(map[toc.UniqueID]int)
+	for _, statement := range statements {
+		index, ok := nodeIndexes[statement.ObjectID]
+		if !ok {
+			index = len(nodes)
+			nodeIndexes[statement.ObjectID] = index
+			nodes = append(nodes, &dependencyNode{})
+		}
+		nodes[index].statements = append(nodes[index].statements, statement)
+	}
+	// Dependencies on objects outside of this batch were either created earlier or filtered out of the restore
+	for objectID, index := range nodeIndexes {
+		for _, dependency := range dependencies[objectID] {
+			if dependencyIndex, ok := nodeIndexes[dependency]; ok && dependencyIndex != index {
+				nodes[dependencyIndex].dependents = append(nodes[dependencyIndex].dependents, index)
+				nodes[index].inDegree++
+			}
+		}
+	}
+
+	var fatalErr error
+	var numErrors int32
+	var graphMutex sync.Mutex
+	ready := make(chan int, len(nodes))
+	numScheduled := 0
+	numFinished := 0
+	isClosed := false
+	// Must be called with graphMutex held
+	schedule := func(index int) {
+		if !isClosed && !nodes[index].scheduled {
+			nodes[index].scheduled = true
+			numScheduled++
+			ready <- index
+		}
+	}
+	/*
+	 * If no object is running or ready but some have not been created, the
+	 * remaining objects must have circular dependencies, so fall back to
+	 * creating them in their original order.  Must be called with graphMutex
+	 * held.
+	 */
+	scheduleIfStuck := func() {
+		if numFinished < len(nodes) && numFinished == numScheduled {
+			for index, node := range nodes {
+				if !node.scheduled {
+					gplog.Verbose("Unable to resolve dependencies for %s.%s; restoring it in backup order", node.statements[0].Schema, node.statements[0].Name)
+					schedule(index)
+					return
+				}
+			}
+		}
+	}
+	for index, node := range nodes {
+		if node.inDegree == 0 {
+			schedule(index)
+		}
+	}
+	scheduleIfStuck()
+
+	var workerPool sync.WaitGroup
+	for i := 0; i < state.connectionPool.NumConns; i++ {
+		workerPool.Add(1)
+		go func(connNum int) {
+			defer workerPool.Done()
+			connNum = state.connectionPool.ValidateConnNum(connNum)
+			for index := range ready {
+				nodeStatements := make(chan toc.StatementWithType, len(nodes[index].statements))
+				for _, statement := range nodes[index].statements {
+					nodeStatements <- statement
+				}
+				close(nodeStatements)
+				executeStatementsForConn(nodeStatements, &fatalErr, &numErrors, progressBar, connNum, true)
+
+				graphMutex.Lock()
+				numFinished++
+				for _, dependent := range nodes[index].dependents {
+					nodes[dependent].inDegree--
+					if nodes[dependent].inDegree == 0 {
+						schedule(dependent)
+					}
+				}
+				scheduleIfStuck()
+				if !isClosed && (numFinished == len(nodes) || state.runCtx.Err() != nil || fatalErr != nil) {
+					isClosed = true
+					close(ready)
+				}
+				graphMutex.Unlock()
+			}
+		}(i)
+	}
+	workerPool.Wait()
+	reportStatementErrors(fatalErr, numErrors)
+}
+
+/*
+ * Statements selected with --use-list run one at a time in the order they
+ * were listed.  Consecutive CREATE SCHEMA statements are restored together
+ * with RestoreSchemas, so schemas that already exist are only a warning as
+ * they are in any other restore.
+ */
+func ExecuteStatementsInListOrder(statements []toc.StatementWithType, progressBar utils.ProgressBar) {
+	start := 0
+	for i := range statements {
+		isSchema := statements[i].ObjectType == "SCHEMA"
+		if i+1 < len(statements) && (statements[i+1].ObjectType == "SCHEMA") == isSchema {
+			continue
+		}
+		if wasCanceled() {
+			return
+		}
+		if isSchema {
+			RestoreSchemas(statements[start:i+1], progressBar)
+		} else {
+			ExecuteStatements(statements[start:i+1], progressBar, false)
+		}
+		start = i + 1
+	}
+}
+
 func ExecuteStatementsAndCreateProgressBar(statements []toc.StatementWithType, objectsTitle string, showProgressBar int, executeInParallel bool, whichConn ...int) {
 	progressBar := utils.NewProgressBar(len(statements), fmt.Sprintf("%s restored: ", objectsTitle), showProgressBar)
 	progressBar.Start()
@@ -1,8 +1,14 @@
 package restore_test
 
 import (
+	"regexp"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
 	"github.com/greenplum-db/gpbackup/restore"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
@@ -34,4 +40,84 @@ var _ = Describe("restore/parallel tests", func() {
 		})
 
 	})
+	Describe("ExecuteStatementsWithDependencies", func() {
+		typeID := toc.UniqueID{ClassID: 1247, Oid: 1}
+		functionID := toc.UniqueID{ClassID: 1255, Oid: 2}
+		tableID := toc.UniqueID{ClassID: 1259, Oid: 3}
+		createType := toc.StatementWithType{ObjectType: "TYPE", Statement: "CREATE TYPE public.mytype AS (i int);", ObjectID: typeID}
+		createFunction := toc.StatementWithType{ObjectType: "FUNCTION", Statement: "CREATE FUNCTION public.myfunc(public.mytype) RETURNS int AS 'SELECT 1' LANGUAGE sql;", ObjectID: functionID}
+		commentOnFunction := toc.StatementWithType{ObjectType: "FUNCTION", Statement: "COMMENT ON FUNCTION public.myfunc(public.mytype) IS 'my function';", ObjectID: functionID}
+		createTable := toc.StatementWithType{ObjectType: "TABLE", Statement: "CREATE TABLE public.mytable (t public.mytype);", ObjectID: tableID}
+		createConversion := toc.StatementWithType{ObjectType: "CONVERSION", Statement: "CREATE CONVERSION public.myconv FOR 'LATIN1' TO 'MULE_INTERNAL' FROM latin1_to_mic;"}
+		var progressBar utils.ProgressBar
+		BeforeEach(func() {
+			progressBar = utils.NewProgressBar(0, "", utils.PB_NONE)
+		})
+		expectStatements := func(statements ...toc.StatementWithType) {
+			for _, statement := range statements {
+				mock.ExpectExec(regexp.QuoteMeta(statement.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			}
+		}
+		It("creates objects after the objects they depend on", func() {
+			dependencies := map[toc.UniqueID][]toc.UniqueID{functionID: {typeID}, tableID: {typeID, functionID}}
+			expectStatements(createType, createFunction, commentOnFunction, createTable)
+
+			restore.ExecuteStatementsWithDependencies([]toc.StatementWithType{createTable, createFunction, commentOnFunction, createType}, dependencies, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("ignores dependencies on objects that are not being restored", func() {
+			dependencies := map[toc.UniqueID][]toc.UniqueID{tableID: {typeID}}
+			expectStatements(createTable)
+
+			restore.ExecuteStatementsWithDependencies([]toc.StatementWithType{createTable}, dependencies, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("executes statements without dependency information in their original order", func() {
+			dependencies := map[toc.UniqueID][]toc.UniqueID{functionID: {typeID}}
+			expectStatements(createConversion, createType, createFunction, commentOnFunction, createConversion)
+
+			restore.ExecuteStatementsWithDependencies([]toc.StatementWithType{createConversion, createFunction, commentOnFunction, createType, createConversion}, dependencies, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("falls back to the original order for objects with circular dependencies", func() {
+			dependencies := map[toc.UniqueID][]toc.UniqueID{functionID: {typeID}, typeID: {functionID}}
+			expectStatements(createFunction, commentOnFunction, createType)
+
+			restore.ExecuteStatementsWithDependencies([]toc.StatementWithType{createFunction, commentOnFunction, createType}, dependencies, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+	})
+	Describe("ExecuteStatementsInListOrder", func() {
+		createSchema := toc.StatementWithType{ObjectType: "SCHEMA", Name: "foo", Statement: "CREATE SCHEMA foo;"}
+		createOtherSchema := toc.StatementWithType{ObjectType: "SCHEMA", Name: "bar", Statement: "CREATE SCHEMA bar;"}
+		createTable := toc.StatementWithType{ObjectType: "TABLE", Statement: "CREATE TABLE foo.mytable (i int);"}
+		createIndex := toc.StatementWithType{ObjectType: "INDEX", Statement: "CREATE INDEX myindex ON foo.mytable USING btree (i);"}
+		var progressBar utils.ProgressBar
+		BeforeEach(func() {
+			progressBar = utils.NewProgressBar(0, "", utils.PB_NONE)
+		})
+		It("executes schemas and other statements in the order they were listed", func() {
+			mock.ExpectExec(regexp.QuoteMeta(createTable.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(createSchema.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(createOtherSchema.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(regexp.QuoteMeta(createIndex.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			restore.ExecuteStatementsInListOrder([]toc.StatementWithType{createTable, createSchema, createOtherSchema, createIndex}, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+		})
+		It("only warns about listed schemas that already exist", func() {
+			mock.ExpectExec(regexp.QuoteMeta(createSchema.Statement)).WillReturnError(errors.New(`schema "foo" already exists`))
+			mock.ExpectExec(regexp.QuoteMeta(createTable.Statement)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+			restore.ExecuteStatementsInListOrder([]toc.StatementWithType{createSchema, createTable}, progressBar)
+
+			Expect(mock.ExpectationsWereMet()).To(Succeed())
+			testhelper.ExpectRegexp(logfile, "[WARNING]:-Schema foo already exists")
+		})
+	})
 })
@@ -0,0 +1,77 @@
+package restore
+
+/*
+ * This file contains functions for printing the metadata statements in a
+ * backup with --print-ddl.
+ */
+
+import (
+	"os"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+)
+
+/*
+ * The statements are returned in the order a restore would execute them,
+ * with the same filtering, so the output can be replayed with psql.
+ */
+func getPrintDDLStatements() []toc.StatementWithType {
+	metadataFilename := state.globalFPInfo.GetMetadataFilePath()
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
+
+	statements := GetRestoreMetadataStatements("global", metadataFilename, []string{"SESSION GUCS"}, []string{})
+	if MustGetFlagBool(options.WITH_GLOBALS) {
+		globalObjectTypes := []string{"DATABASE GUC", "DATABASE METADATA", "RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GUCS", "ROLE GRANT", "TABLESPACE"}
+		globalStatements := GetRestoreMetadataStatements("global", metadataFilename, globalObjectTypes, []string{})
+		statements = append(statements, FilterStatementsByUserObjectTypes(globalStatements)...)
+	}
+
+	predataStatements := make([]toc.StatementWithType, 0)
+	if state.opts.RedirectSchema == "" {
+		predataStatements = GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SCHEMA"}, []string{}, filters)
+	}
+	predataStatements = append(predataStatements, GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{"SCHEMA"}, filters)...)
+	postdataStatements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{}, filters)
+	objectStatements := append(predataStatements, postdataStatements...)
+	if MustGetFlagBool(options.WITH_STATS) && state.backupConfig.WithStatistics {
+		statisticsStatements := GetRestoreMetadataStatementsFiltered("statistics", state.globalFPInfo.GetStatisticsFilePath(), []string{}, []string{}, filters)
+		objectStatements = append(objectStatements, statisticsStatements...)
+	}
+	objectStatements = FilterStatementsByUserObjectTypes(objectStatements)
+	editStatementsRedirect(objectStatements)
+
+	return append(statements, objectStatements...)
+}
+
+func validateBackupForPrintDDL() {
+	if state.backupConfig.DataOnly {
+		gplog.Fatal(errors.Errorf("Backup %s is a data-only backup and contains no metadata to print.", state.globalFPInfo.Timestamp), "")
+	}
+}
+
+func printDDL() {
+	statements := getPrintDDLStatements()
+	outputFilename := MustGetFlagString(options.PRINT_DDL_FILE)
+	if outputFilename == "" {
+		writeDDLStatements(utils.NewFileWithByteCount(os.Stdout), statements)
+		return
+	}
+	outputFile, err := os.Create(outputFilename)
+	gplog.FatalOnError(err)
+	writeDDLStatements(utils.NewFileWithByteCount(outputFile), statements)
+	err = outputFile.Close()
+	gplog.FatalOnError(err)
+	gplog.Info("Wrote %d metadata statements to %s", len(statements), outputFilename)
+}
+
+func writeDDLStatements(outputFile *utils.FileWithByteCount, statements []toc.StatementWithType) {
+	outputFile.MustPrintf("--\n-- Metadata from backup %s of database %s\n--\n", state.globalFPInfo.Timestamp, state.backupConfig.DatabaseName)
+	for _, statement := range statements {
+		outputFile.MustPrint(statement.Statement)
+	}
+	outputFile.MustPrintln()
+}
@@ -0,0 +1,120 @@
+package restore
+
+/*
+ * This file contains the functions for --rebuild-history, which recovers the
+ * backup history file on the coordinator from the backups stored through a
+ * plugin, such as after the history file or the coordinator was lost.
+ */
+
+import (
+	"io/ioutil"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/utils"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+/*
+ * The plugin is only run on the coordinator, so no database connection is
+ * needed, and the plugin setup and cleanup hooks are not called, as when
+ * reading a backup without a connection.  The plugin config is not copied to
+ * the hosts either, so the plugin is passed the path it was read from.
+ */
+func rebuildHistory() {
+	coordinatorDataDir := operating.System.Getenv("MASTER_DATA_DIRECTORY")
+	if coordinatorDataDir == "" {
+		gplog.Fatal(errors.Errorf("MASTER_DATA_DIRECTORY must be set to locate the backup history file"), "")
+	}
+	state.globalCluster = cluster.NewCluster([]cluster.SegConfig{{DbID: 1, ContentID: -1, Role: "p", DataDir: coordinatorDataDir}})
+	state.globalCluster.Executor = &utils.ContextExecutor{Context: state.runCtx}
+
+	var err error
+	state.pluginConfig, err = utils.ReadPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG))
+	gplog.FatalOnError(err)
+	state.pluginConfig.SetContext(state.runCtx)
+	state.pluginConfig.CheckPluginExistsOnAllHosts(state.globalCluster)
+	if !state.pluginConfig.CanListBackups() {
+		gplog.Fatal(errors.Errorf("Plugin %s does not support listing its backups, so the backup history cannot be rebuilt", state.pluginConfig.ExecutablePath), "")
+	}
+	timestamps, err := state.pluginConfig.ListBackups(state.globalCluster)
+	gplog.FatalOnError(err)
+	gplog.Info("Found %d backups with plugin %s", len(timestamps), state.pluginConfig.ExecutablePath)
+
+	fpInfo := filepath.NewFilePathInfo(state.globalCluster, "", "", "")
+	historyFilename := fpInfo.GetBackupHistoryFilePath()
+	backupHistory := &history.History{BackupConfigs: make([]history.BackupConfig, 0)}
+	if iohelper.FileExistsAndIsReadable(historyFilename) {
+		backupHistory, err = history.NewHistory(historyFilename)
+		gplog.FatalOnError(err)
+	}
+	numAdded := AddBackupsToHistory(backupHistory, timestamps, restoreBackupConfig)
+	if numAdded == 0 {
+		gplog.Info("Backup history file %s already contains every backup", historyFilename)
+		return
+	}
+	err = backupHistory.RewriteHistoryFile(historyFilename)
+	gplog.FatalOnError(err)
+	gplog.Info("Added %d backups to backup history file %s", numAdded, historyFilename)
+}
+
+/*
+ * Adds the backups with the given timestamps that are not already in the
+ * history, reading the config file of each with readConfig.  Backups whose
+ * config file cannot be read, such as backups that failed before writing it,
+ * are skipped with a warning.  Returns the number of backups added.
+ */
+func AddBackupsToHistory(backupHistory *history.History, timestamps []string,
+	readConfig func(timestamp string) (*history.BackupConfig, error)) int {
+	inHistory := make(map[string]bool, len(backupHistory.BackupConfigs))
+	for _, backupConfig := range backupHistory.BackupConfigs {
+		inHistory[backupConfig.Timestamp] = true
+	}
+	numAdded := 0
+	for _, timestamp := range timestamps {
+		if inHistory[timestamp] {
+			gplog.Verbose("Backup %s is already in the backup history file", timestamp)
+			continue
+		}
+		backupConfig, err := readConfig(timestamp)
+		if err != nil {
+			gplog.Warn("Unable to read the config file of backup %s, so it is not added to the backup history file: %v", timestamp, err)
+			continue
+		}
+		if backupConfig.Timestamp != timestamp {
+			gplog.Warn("The config file of backup %s is for backup %s, so it is not added to the backup history file", timestamp, backupConfig.Timestamp)
+			continue
+		}
+		gplog.Verbose("Adding backup %s to the backup history file", timestamp)
+		backupHistory.AddBackupConfig(backupConfig)
+		inHistory[timestamp] = true
+		numAdded++
+	}
+	return numAdded
+}
+
+// The config file is restored to the backup directory on the coordinator, as for a restore
+func restoreBackupConfig(timestamp string) (*history.BackupConfig, error) {
+	fpInfo := filepath.NewFilePathInfo(state.globalCluster, "", timestamp, "")
+	configFilename := fpInfo.GetConfigFilePath()
+	err := state.pluginConfig.RestoreFile(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	contents, err := ioutil.ReadFile(configFilename)
+	if err != nil {
+		return nil, err
+	}
+	backupConfig := &history.BackupConfig{}
+	err = yaml.Unmarshal(contents, backupConfig)
+	if err != nil {
+		return nil, err
+	}
+	return backupConfig, nil
+}
@@ -0,0 +1,155 @@
+package restore_test
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("restore/rebuild_history tests", func() {
+	Describe("AddBackupsToHistory", func() {
+		var backupHistory *history.History
+		readConfig := func(timestamp string) (*history.BackupConfig, error) {
+			switch timestamp {
+			case "20170303030303":
+				return nil, errors.New("config file not found")
+			case "20170404040404":
+				return &history.BackupConfig{Timestamp: "20170505050505"}, nil
+			}
+			return &history.BackupConfig{Timestamp: timestamp, DatabaseName: "testdb"}, nil
+		}
+		BeforeEach(func() {
+			backupHistory = &history.History{BackupConfigs: []history.BackupConfig{{Timestamp: "20170101010101", DatabaseName: "olddb"}}}
+		})
+
+		It("adds the backups missing from the history, newest first", func() {
+			numAdded := restore.AddBackupsToHistory(backupHistory, []string{"20170101010101", "20170202020202", "20170606060606"}, readConfig)
+
+			Expect(numAdded).To(Equal(2))
+			Expect(backupHistory.BackupConfigs).To(Equal([]history.BackupConfig{
+				{Timestamp: "20170606060606", DatabaseName: "testdb"},
+				{Timestamp: "20170202020202", DatabaseName: "testdb"},
+				{Timestamp: "20170101010101", DatabaseName: "olddb"},
+			}))
+		})
+		It("skips backups whose config file cannot be read or is for another backup", func() {
+			numAdded := restore.AddBackupsToHistory(backupHistory, []string{"20170303030303", "20170404040404"}, readConfig)
+
+			Expect(numAdded).To(Equal(0))
+			Expect(backupHistory.BackupConfigs).To(HaveLen(1))
+			Expect(logfile).To(Say("Unable to read the config file of backup 20170303030303, so it is not added to the backup history file: config file not found"))
+			Expect(logfile).To(Say("The config file of backup 20170404040404 is for backup 20170505050505, so it is not added to the backup history file"))
+		})
+	})
+	Describe("Run with --rebuild-history", func() {
+		var (
+			tempDir     string
+			pluginDir   string
+			configPath  string
+			historyPath string
+			callsPath   string
+		)
+		BeforeEach(func() {
+			restore.SetVersion("1.0.0")
+			var err error
+			tempDir, err = ioutil.TempDir("", "rebuild_history")
+			Expect(err).ToNot(HaveOccurred())
+			pluginDir = path.Join(tempDir, "plugin_destination")
+			Expect(os.MkdirAll(pluginDir, 0755)).To(Succeed())
+			Expect(os.MkdirAll(path.Join(tempDir, "coordinator"), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(path.Join(tempDir, "greenplum_path.sh"), []byte{}, 0644)).To(Succeed())
+
+			configPath = path.Join(tempDir, "plugin_config.yaml")
+			callsPath = path.Join(tempDir, "plugin_calls")
+			// A plugin storing config files in a directory, keeping their names, that records the config path of each command
+			plugin := fmt.Sprintf(`#!/bin/bash
+case "$1" in
+list_backups|restore_file) echo "$1 $2" >> %s ;;
+esac
+case "$1" in
+plugin_api_version) echo %s ;;
+plugin_capabilities) echo "list_backups: true" ;;
+--version) echo "fake_plugin version 1.0" ;;
+list_backups) echo 20170303030303; echo 20170101010101; echo 20170202020202 ;;
+restore_file) cp "%s/$(basename "$3")" "$3" ;;
+*) exit 1 ;;
+esac
+`, callsPath, "0.5.0", pluginDir)
+			pluginPath := path.Join(tempDir, "fake_plugin")
+			Expect(ioutil.WriteFile(pluginPath, []byte(plugin), 0755)).To(Succeed())
+			Expect(ioutil.WriteFile(configPath, []byte("executablepath: "+pluginPath+"\n"), 0644)).To(Succeed())
+			for _, timestamp := range []string{"20170101010101", "20170202020202"} {
+				history.WriteConfigFile(&history.BackupConfig{Timestamp: timestamp, DatabaseName: "testdb", Plugin: pluginPath,
+					Status: history.BackupStatusSucceed}, path.Join(pluginDir, "gpbackup_"+timestamp+"_config.yaml"))
+			}
+
+			historyPath = path.Join(tempDir, "coordinator", "gpbackup_history.yaml")
+			existingHistory := &history.History{BackupConfigs: []history.BackupConfig{{Timestamp: "20170101010101", DatabaseName: "olddb"}}}
+			Expect(existingHistory.WriteToFileAndMakeReadOnly(historyPath)).To(Succeed())
+			os.Setenv("GPHOME", tempDir)
+			os.Setenv("MASTER_DATA_DIRECTORY", path.Join(tempDir, "coordinator"))
+		})
+		AfterEach(func() {
+			restore.SetVersion("")
+			gplog.SetErrorCode(0)
+			os.Unsetenv("MASTER_DATA_DIRECTORY")
+			_ = os.RemoveAll(tempDir)
+		})
+
+		It("adds the backups listed by the plugin to the history file", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.REBUILD_HISTORY: {"true"},
+				options.PLUGIN_CONFIG:   {configPath},
+			}})
+
+			Expect(err).ToNot(HaveOccurred())
+			backupHistory, err := history.NewHistory(historyPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(backupHistory.BackupConfigs).To(HaveLen(2))
+			Expect(backupHistory.BackupConfigs[0].Timestamp).To(Equal("20170202020202"))
+			Expect(backupHistory.BackupConfigs[0].Status).To(Equal(history.BackupStatusSucceed))
+			Expect(backupHistory.BackupConfigs[1].DatabaseName).To(Equal("olddb"))
+			Expect(logfile).To(Say("Unable to read the config file of backup 20170303030303"))
+			Expect(logfile).To(Say("Added 1 backups to backup history file " + historyPath))
+		})
+		It("passes the plugin the config file it was given, as the plugin only runs on the coordinator", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.REBUILD_HISTORY: {"true"},
+				options.PLUGIN_CONFIG:   {configPath},
+			}})
+
+			Expect(err).ToNot(HaveOccurred())
+			calls, err := ioutil.ReadFile(callsPath)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(calls)).To(Equal(fmt.Sprintf("list_backups %[1]s\nrestore_file %[1]s\nrestore_file %[1]s\n", configPath)))
+		})
+		It("returns an error without --plugin-config", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.REBUILD_HISTORY: {"true"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --rebuild-history without --plugin-config"))
+		})
+		It("returns an error with flags for restoring a backup", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.REBUILD_HISTORY: {"true"},
+				options.PLUGIN_CONFIG:   {configPath},
+				options.TIMESTAMP:       {"20170101010101"},
+			}})
+
+			Expect(err).To(MatchError("Cannot use --timestamp with --rebuild-history"))
+		})
+	})
+})
@@ -8,6 +8,7 @@ import (
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gp-common-go-libs/iohelper"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/pkg/errors"
 )
@@ -17,23 +18,27 @@ import (
  */
 
 func VerifyBackupDirectoriesExistOnAllHosts() {
-	_, err := globalCluster.ExecuteLocalCommand(fmt.Sprintf("test -d %s", globalFPInfo.GetDirForContent(-1)))
-	gplog.FatalOnError(err, "Backup directory %s missing or inaccessible", globalFPInfo.GetDirForContent(-1))
-	if MustGetFlagString(options.PLUGIN_CONFIG) == "" || backupConfig.SingleDataFile {
-		remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup directories exist", cluster.ON_SEGMENTS, func(contentID int) string {
-			return fmt.Sprintf("test -d %s", globalFPInfo.GetDirForContent(contentID))
+	VerifyCoordinatorBackupDirectoryExists()
+	if MustGetFlagString(options.PLUGIN_CONFIG) == "" || state.backupConfig.SingleDataFile {
+		remoteOutput := state.globalCluster.GenerateAndExecuteCommand("Verifying backup directories exist", cluster.ON_SEGMENTS, func(contentID int) string {
+			return fmt.Sprintf("test -d %s", state.globalFPInfo.GetDirForContent(contentID))
 		})
-		globalCluster.CheckClusterError(remoteOutput, "Backup directories missing or inaccessible", func(contentID int) string {
-			return fmt.Sprintf("Backup directory %s missing or inaccessible", globalFPInfo.GetDirForContent(contentID))
+		state.globalCluster.CheckClusterError(remoteOutput, "Backup directories missing or inaccessible", func(contentID int) string {
+			return fmt.Sprintf("Backup directory %s missing or inaccessible", state.globalFPInfo.GetDirForContent(contentID))
 		})
 	}
 }
 
+func VerifyCoordinatorBackupDirectoryExists() {
+	_, err := state.globalCluster.ExecuteLocalCommand(fmt.Sprintf("test -d %s", state.globalFPInfo.GetDirForContent(-1)))
+	gplog.FatalOnError(err, "Backup directory %s missing or inaccessible", state.globalFPInfo.GetDirForContent(-1))
+}
+
 func VerifyBackupFileCountOnSegments(fileCount int) {
-	remoteOutput := globalCluster.GenerateAndExecuteCommand("Verifying backup file count", cluster.ON_SEGMENTS, func(contentID int) string {
-		return fmt.Sprintf("find %s -type f | wc -l", globalFPInfo.GetDirForContent(contentID))
+	remoteOutput := state.globalCluster.GenerateAndExecuteCommand("Verifying backup file count", cluster.ON_SEGMENTS, func(contentID int) string {
+		return fmt.Sprintf("find %s -type f | wc -l", state.globalFPInfo.GetDirForContent(contentID))
 	})
-	globalCluster.CheckClusterError(remoteOutput, "Could not verify backup file count", func(contentID int) string {
+	state.globalCluster.CheckClusterError(remoteOutput, "Could not verify backup file count", func(contentID int) string {
 		return "Could not verify backup file count"
 	})
 
@@ -41,7 +46,7 @@ func VerifyBackupFileCountOnSegments(fileCount int) {
 	for contentID, cmd := range remoteOutput.Commands {
 		numFound, _ := strconv.Atoi(strings.TrimSpace(cmd.Stdout))
 		if numFound != fileCount {
-			gplog.Verbose("Expected to find %d file(s) on segment %d on host %s, but found %d instead.", fileCount, contentID, globalCluster.GetHostForContent(contentID), numFound)
+			gplog.Verbose("Expected to find %d file(s) on segment %d on host %s, but found %d instead.", fileCount, contentID, state.globalCluster.GetHostForContent(contentID), numFound)
 			numIncorrect++
 		}
 	}
@@ -51,17 +56,21 @@ func VerifyBackupFileCountOnSegments(fileCount int) {
 }
 
 func VerifyMetadataFilePaths(withStats bool) {
+	verifyMetadataFilePathsForBackup(state.globalFPInfo, withStats)
+}
+
+func verifyMetadataFilePathsForBackup(fpInfo filepath.FilePathInfo, withStats bool) {
 	filetypes := []string{"config", "table of contents", "metadata"}
 	missing := false
 	for _, filetype := range filetypes {
-		filepath := globalFPInfo.GetBackupFilePath(filetype)
+		filepath := fpInfo.GetBackupFilePath(filetype)
 		if !iohelper.FileExistsAndIsReadable(filepath) {
 			missing = true
 			gplog.Error("Cannot access %s file %s", filetype, filepath)
 		}
 	}
 	if withStats {
-		filepath := globalFPInfo.GetStatisticsFilePath()
+		filepath := fpInfo.GetStatisticsFilePath()
 		if !iohelper.FileExistsAndIsReadable(filepath) {
 			missing = true
 			gplog.Error("Cannot access statistics file %s", filepath)
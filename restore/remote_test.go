@@ -32,6 +32,32 @@ var _ = Describe("restore/remote tests", func() {
 		testFPInfo = filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
 		restore.SetFPInfo(testFPInfo)
 	})
+	Describe("VerifyBackupDirectoriesExistOnAllHosts", func() {
+		It("checks the directory of each content ID in the backup directory map", func() {
+			testExecutor.ClusterOutput = &cluster.RemoteOutput{}
+			testFPInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0", 1: "/mnt/disk2/seg1"}
+			restore.SetFPInfo(testFPInfo)
+			restore.SetCluster(testCluster)
+
+			restore.VerifyBackupDirectoriesExistOnAllHosts()
+
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"test -d /mnt/coordinator/backups/20170101/20170101010101"}))
+			Expect(testExecutor.ClusterCommands[0][0].CommandString).To(ContainSubstring("test -d /mnt/disk1/seg0/backups/20170101/20170101010101"))
+			Expect(testExecutor.ClusterCommands[0][1].CommandString).To(ContainSubstring("test -d /mnt/disk2/seg1/backups/20170101/20170101010101"))
+		})
+	})
+	Describe("VerifyCoordinatorBackupDirectoryExists", func() {
+		It("checks only the directory of the coordinator", func() {
+			testFPInfo.BackupDirMap = map[int]string{-1: "/mnt/coordinator", 0: "/mnt/disk1/seg0", 1: "/mnt/disk2/seg1"}
+			restore.SetFPInfo(testFPInfo)
+			restore.SetCluster(testCluster)
+
+			restore.VerifyCoordinatorBackupDirectoryExists()
+
+			Expect(testExecutor.LocalCommands).To(Equal([]string{"test -d /mnt/coordinator/backups/20170101/20170101010101"}))
+			Expect(testExecutor.ClusterCommands).To(BeEmpty())
+		})
+	})
 	Describe("VerifyBackupFileCountOnSegments", func() {
 		It("successfully verifies all backup file counts", func() {
 			testExecutor.ClusterOutput = &cluster.RemoteOutput{
@@ -2,12 +2,12 @@ package restore
 
 import (
 	"bufio"
+	"context"
 	"fmt"
 	"os"
 	"regexp"
 	"runtime/debug"
 	"strings"
-	"sync"
 
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
@@ -20,31 +20,44 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
-// This function handles setup that can be done before parsing flags.
+/*
+ * This function handles setup that can be done before parsing flags.  The
+ * parsed flags are passed to Run, which sets them on flags of its own.
+ */
 func DoInit(cmd *cobra.Command) {
-	CleanupGroup = &sync.WaitGroup{}
-	CleanupGroup.Add(1)
 	gplog.InitializeLogging("gprestore", "")
 	SetCmdFlags(cmd.Flags())
-	_ = cmd.MarkFlagRequired(options.TIMESTAMP)
-	utils.InitializeSignalHandler(DoCleanup, "restore process", &wasTerminated)
 }
 
 /*
 * This function handles argument parsing and validation, e.g. checking that a passed filename exists.
 * It should only validate; initialization with any sort of side effects should go in DoInit or DoSetup.
  */
-func DoValidation(cmd *cobra.Command) {
-	ValidateFlagCombinations(cmd.Flags())
+func validateFlags(flags *pflag.FlagSet) {
+	ValidateFlagCombinations(flags)
 	err := utils.ValidateFullPath(MustGetFlagString(options.BACKUP_DIR))
 	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.BACKUP_DIR_MAP_FILE))
+	gplog.FatalOnError(err)
 	err = utils.ValidateFullPath(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
-	if !filepath.IsValidTimestamp(MustGetFlagString(options.TIMESTAMP)) {
+	err = utils.ValidateFullPath(MustGetFlagString(options.COPY_TO_DIR))
+	gplog.FatalOnError(err)
+	err = utils.ValidateFullPath(MustGetFlagString(options.COPY_TO_PLUGIN_CONFIG))
+	gplog.FatalOnError(err)
+	if !MustGetFlagBool(options.REBUILD_HISTORY) && !isMigrateMode() && !filepath.IsValidTimestamp(MustGetFlagString(options.TIMESTAMP)) {
 		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", MustGetFlagString(options.TIMESTAMP)), "")
 	}
+	if diffTimestamp := MustGetFlagString(options.DIFF_TIMESTAMP); diffTimestamp != "" && !filepath.IsValidTimestamp(diffTimestamp) {
+		gplog.Fatal(errors.Errorf("Timestamp %s is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS.", diffTimestamp), "")
+	}
+	err = utils.ValidateTimeout(options.TIMEOUT, MustGetFlagInt(options.TIMEOUT))
+	gplog.FatalOnError(err)
+	err = utils.ValidateTimeout(options.COPY_TIMEOUT, MustGetFlagInt(options.COPY_TIMEOUT))
+	gplog.FatalOnError(err)
 }
 
 // This function handles setup that must be done after parsing flags.
@@ -52,55 +65,104 @@ func DoSetup() {
 	SetLoggerVerbosity()
 	gplog.Verbose("Restore Command: %s", os.Args)
 
+	parentCtx := state.runCtx
+	state.runCtx, state.cancelRun = utils.NewTimeoutContext(parentCtx, MustGetFlagInt(options.TIMEOUT))
+	if MustGetFlagBool(options.REBUILD_HISTORY) {
+		rebuildHistory()
+		return
+	}
+	if isCopyMode() {
+		state.restoreStartTime = history.CurrentTimestamp()
+		copyBackup()
+		return
+	}
+	if isOfflineMode() {
+		state.restoreStartTime = history.CurrentTimestamp()
+		setupWithoutConnection(MustGetFlagString(options.TIMESTAMP))
+		if MustGetFlagBool(options.PRINT_DDL) {
+			validateBackupForPrintDDL()
+		} else {
+			diffBackups(MustGetFlagString(options.DIFF_TIMESTAMP))
+		}
+		return
+	}
+
 	utils.CheckGpexpandRunning(utils.RestorePreventedByGpexpandMessage)
-	restoreStartTime = history.CurrentTimestamp()
+	state.restoreStartTime = history.CurrentTimestamp()
 	backupTimestamp := MustGetFlagString(options.TIMESTAMP)
+	if isMigrateMode() {
+		// The metadata of the database to migrate is written under the timestamp of the restore
+		backupTimestamp = state.restoreStartTime
+	}
 	gplog.Info("Restore Key = %s", backupTimestamp)
 
 	CreateConnectionPool("postgres")
 
 	var err error
-	opts, err = options.NewOptions(cmdFlags)
+	state.opts, err = options.NewOptions(state.cmdFlags)
 	gplog.FatalOnError(err)
 
-	err = opts.QuoteIncludeRelations(connectionPool)
+	err = state.opts.QuoteIncludeRelations(state.connectionPool)
 	gplog.FatalOnError(err)
 
-	segConfig := cluster.MustGetSegmentConfiguration(connectionPool)
-	globalCluster = cluster.NewCluster(segConfig)
-	segPrefix := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), backupTimestamp)
-	globalFPInfo = filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), backupTimestamp, segPrefix)
+	segConfig := cluster.MustGetSegmentConfiguration(state.connectionPool)
+	state.globalCluster = cluster.NewCluster(segConfig)
+	state.globalCluster.Executor = &utils.ContextExecutor{Context: state.runCtx}
+	if mapFile := MustGetFlagString(options.BACKUP_DIR_MAP_FILE); mapFile != "" {
+		state.backupDirMap, err = filepath.ReadBackupDirMapFile(mapFile, state.globalCluster)
+		gplog.FatalOnError(err)
+	}
+	state.globalFPInfo = GetBackupFPInfoForTimestamp(backupTimestamp)
+	if state.globalFPInfo.IsBackupDirMapped() {
+		// Check the mapped coordinator directory before the config file is read from it
+		VerifyCoordinatorBackupDirectoryExists()
+	}
 
-	// Get restore metadata from plugin
-	if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+	// Get restore metadata from the database to migrate or from plugin
+	if isMigrateMode() {
+		generateMigrationMetadata()
+	} else if MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		RecoverMetadataFilesUsingPlugin()
 	} else {
 		InitializeBackupConfig()
 	}
 
-	gplog.Info("gpbackup version = %s", backupConfig.BackupVersion)
+	gplog.Info("gpbackup version = %s", state.backupConfig.BackupVersion)
 	gplog.Info("gprestore version = %s", GetVersion())
-	gplog.Info("Greenplum Database Version = %s", connectionPool.Version.VersionString)
+	gplog.Info("Greenplum Database Version = %s", state.connectionPool.Version.VersionString)
 
 	BackupConfigurationValidation()
-	metadataFilename := globalFPInfo.GetMetadataFilePath()
-	if !backupConfig.DataOnly {
+	if MustGetFlagBool(options.LIST) {
+		printRestoreList()
+		return
+	}
+	if MustGetFlagString(options.USE_LIST) != "" {
+		applyRestoreList(MustGetFlagString(options.USE_LIST))
+	}
+	metadataFilename := state.globalFPInfo.GetMetadataFilePath()
+	if !state.backupConfig.DataOnly {
 		gplog.Verbose("Metadata will be restored from %s", metadataFilename)
 	}
-	unquotedRestoreDatabase := utils.UnquoteIdent(backupConfig.DatabaseName)
+	unquotedRestoreDatabase := utils.UnquoteIdent(state.backupConfig.DatabaseName)
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
 		unquotedRestoreDatabase = MustGetFlagString(options.REDIRECT_DB)
 	}
-	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(options.CREATE_DB), backupConfig.IncludeTableFiltered || backupConfig.DataOnly)
+	ValidateDatabaseExistence(unquotedRestoreDatabase, MustGetFlagBool(options.CREATE_DB), state.backupConfig.IncludeTableFiltered || state.backupConfig.DataOnly)
+	if MustGetFlagBool(options.DIFF) {
+		state.connectionPool.Close()
+		diffBackupWithDatabase(unquotedRestoreDatabase)
+		return
+	}
 	if MustGetFlagBool(options.WITH_GLOBALS) {
 		restoreGlobal(metadataFilename)
 	} else if MustGetFlagBool(options.CREATE_DB) {
 		createDatabase(metadataFilename)
 	}
-	if connectionPool != nil {
-		connectionPool.Close()
+	if state.connectionPool != nil {
+		state.connectionPool.Close()
 	}
-	InitializeConnectionPool(backupTimestamp, restoreStartTime, unquotedRestoreDatabase)
+	InitializeConnectionPool(backupTimestamp, state.restoreStartTime, unquotedRestoreDatabase)
+	go cancelQueriesOnTimeout(state.runCtx, parentCtx, unquotedRestoreDatabase, backupTimestamp, state.restoreStartTime)
 
 	/*
 	 * We don't need to validate anything if we're creating the database; we
@@ -109,35 +171,55 @@ func DoSetup() {
 	 * but since they will not stop the restore, it is not necessary to log them twice.
 	 */
 	if !MustGetFlagBool(options.CREATE_DB) && !MustGetFlagBool(options.ON_ERROR_CONTINUE) && !MustGetFlagBool(options.INCREMENTAL) {
-		relationsToRestore := GenerateRestoreRelationList(*opts)
-		if opts.RedirectSchema != "" {
+		relationsToRestore := GenerateRestoreRelationList(*state.opts)
+		if state.opts.RedirectSchema != "" || state.opts.RedirectTable != "" {
 			fqns, err := options.SeparateSchemaAndTable(relationsToRestore)
 			gplog.FatalOnError(err)
 			redirectRelationsToRestore := make([]string, 0)
 			for _, fqn := range fqns {
-				redirectRelationsToRestore = append(redirectRelationsToRestore, utils.MakeFQN(opts.RedirectSchema, fqn.TableName))
+				redirectRelationsToRestore = append(redirectRelationsToRestore, utils.MakeFQN(redirectedTableName(fqn.SchemaName, fqn.TableName)))
 			}
 			relationsToRestore = redirectRelationsToRestore
 		}
-		ValidateRelationsInRestoreDatabase(connectionPool, relationsToRestore)
+		ValidateRelationsInRestoreDatabase(state.connectionPool, relationsToRestore)
 	}
 
-	if opts.RedirectSchema != "" {
-		ValidateRedirectSchema(connectionPool, opts.RedirectSchema)
+	if state.opts.RedirectSchema != "" {
+		ValidateRedirectSchema(state.connectionPool, state.opts.RedirectSchema)
 	}
 }
 
 func DoRestore() {
+	if MustGetFlagBool(options.LIST) || MustGetFlagBool(options.DIFF) || MustGetFlagBool(options.REBUILD_HISTORY) || isCopyMode() {
+		return
+	}
+	if MustGetFlagBool(options.PRINT_DDL) {
+		printDDL()
+		return
+	}
 	var filteredDataEntries map[string][]toc.MasterDataEntry
-	metadataFilename := globalFPInfo.GetMetadataFilePath()
-	isDataOnly := backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
-	isMetadataOnly := backupConfig.MetadataOnly || MustGetFlagBool(options.METADATA_ONLY)
+	metadataFilename := state.globalFPInfo.GetMetadataFilePath()
+	isDataOnly := state.backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY)
+	isMetadataOnly := state.backupConfig.MetadataOnly || MustGetFlagBool(options.METADATA_ONLY)
 	isIncremental := MustGetFlagBool(options.INCREMENTAL)
 
 	if isIncremental {
 		verifyIncrementalState()
 	}
 
+	if len(state.backupConfig.MaskedColumns) > 0 && !isMetadataOnly {
+		gplog.Info("Backup %s contains masked data for %d column(s)", state.globalFPInfo.Timestamp, len(state.backupConfig.MaskedColumns))
+	}
+	if state.backupConfig.DataSubset && !isMetadataOnly {
+		gplog.Warn("Backup %s is a data subset; tables backed up with a table predicate contain only the rows matching that predicate", state.globalFPInfo.Timestamp)
+	}
+
+	if !isDataOnly {
+		objectTypes := state.globalTOC.GetMetadataObjectTypes()
+		objectTypeSet := toc.NewObjectTypeSet(state.opts.IncludedObjectTypes, state.opts.ExcludedObjectTypes)
+		toc.LogExcludedDependencyWarnings(objectTypes, objectTypeSet, objectTypes)
+	}
+
 	if !isDataOnly && !isIncremental {
 		restorePredata(metadataFilename)
 	} else if isDataOnly {
@@ -149,10 +231,10 @@ func DoRestore() {
 
 	totalTablesRestored := 0
 	if !isMetadataOnly {
-		if MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		if MustGetFlagString(options.PLUGIN_CONFIG) == "" && !isMigrateMode() {
 			backupFileCount := 2 // 1 for the actual data file, 1 for the segment TOC file
-			if !backupConfig.SingleDataFile {
-				backupFileCount = len(globalTOC.DataEntries)
+			if !state.backupConfig.SingleDataFile {
+				backupFileCount = len(state.globalTOC.DataEntries)
 			}
 			VerifyBackupFileCountOnSegments(backupFileCount)
 		}
@@ -163,7 +245,7 @@ func DoRestore() {
 		restorePostdata(metadataFilename)
 	}
 
-	if MustGetFlagBool(options.WITH_STATS) && backupConfig.WithStatistics {
+	if MustGetFlagBool(options.WITH_STATS) && state.backupConfig.WithStatistics {
 		restoreStatistics()
 	} else if MustGetFlagBool(options.RUN_ANALYZE) && totalTablesRestored > 0 {
 		runAnalyze(filteredDataEntries)
@@ -172,13 +254,13 @@ func DoRestore() {
 
 func createDatabase(metadataFilename string) {
 	objectTypes := []string{"SESSION GUCS", "DATABASE GUC", "DATABASE", "DATABASE METADATA"}
-	dbName := backupConfig.DatabaseName
+	dbName := state.backupConfig.DatabaseName
 	gplog.Info("Creating database")
 	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(options.REDIRECT_DB))
+		quotedDBName := utils.QuoteIdent(state.connectionPool, MustGetFlagString(options.REDIRECT_DB))
 		dbName = quotedDBName
-		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		statements = toc.SubstituteRedirectDatabaseInStatements(statements, state.backupConfig.DatabaseName, quotedDBName)
 	}
 	ExecuteRestoreMetadataStatements(statements, "", nil, utils.PB_NONE, false)
 	gplog.Info("Database creation complete for: %s", dbName)
@@ -191,17 +273,18 @@ func restoreGlobal(metadataFilename string) {
 	}
 	gplog.Info("Restoring global metadata")
 	statements := GetRestoreMetadataStatements("global", metadataFilename, objectTypes, []string{})
+	statements = FilterStatementsByUserObjectTypes(statements)
 	if MustGetFlagString(options.REDIRECT_DB) != "" {
-		quotedDBName := utils.QuoteIdent(connectionPool, MustGetFlagString(options.REDIRECT_DB))
-		statements = toc.SubstituteRedirectDatabaseInStatements(statements, backupConfig.DatabaseName, quotedDBName)
+		quotedDBName := utils.QuoteIdent(state.connectionPool, MustGetFlagString(options.REDIRECT_DB))
+		statements = toc.SubstituteRedirectDatabaseInStatements(statements, state.backupConfig.DatabaseName, quotedDBName)
 	}
-	statements = toc.RemoveActiveRole(connectionPool.User, statements)
+	statements = toc.RemoveActiveRole(state.connectionPool.User, statements)
 	ExecuteRestoreMetadataStatements(statements, "Global objects", nil, utils.PB_VERBOSE, false)
 	gplog.Info("Global database metadata restore complete")
 }
 
 func verifyIncrementalState() {
-	lastRestorePlanEntry := backupConfig.RestorePlan[len(backupConfig.RestorePlan)-1]
+	lastRestorePlanEntry := state.backupConfig.RestorePlan[len(state.backupConfig.RestorePlan)-1]
 	tableFQNsToRestore := lastRestorePlanEntry.TableFQNs
 
 	existingSchemas, err := GetExistingSchemas()
@@ -224,7 +307,7 @@ func verifyIncrementalState() {
 	var tablesExcludedByUserInput []string
 	for _, table := range tableFQNsToRestore {
 		schemaName := strings.Split(table, ".")[0]
-		if utils.SchemaIsExcludedByUser(opts.IncludedSchemas, opts.ExcludedSchemas, schemaName) {
+		if utils.SchemaIsExcludedByUser(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, schemaName) {
 			if !utils.Exists(schemasExcludedByUserInput, schemaName) {
 				schemasExcludedByUserInput = append(schemasExcludedByUserInput, schemaName)
 			}
@@ -233,7 +316,7 @@ func verifyIncrementalState() {
 		}
 
 		if _, exists := existingTablesMap[table]; !exists {
-			if utils.RelationIsExcludedByUser(opts.IncludedRelations, opts.ExcludedRelations, table) {
+			if utils.RelationIsExcludedByUser(state.opts.IncludedRelations, state.opts.ExcludedRelations, table) {
 				tablesExcludedByUserInput = append(tablesExcludedByUserInput, table)
 			} else {
 				_, schemaExists := existingSchemasMap[schemaName]
@@ -260,27 +343,40 @@ func verifyIncrementalState() {
 }
 
 func restorePredata(metadataFilename string) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Restoring pre-data metadata")
 	// if not incremental restore - assume database is empty and just filter based on user input
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
+	useList := MustGetFlagString(options.USE_LIST) != ""
 	var schemaStatements []toc.StatementWithType
-	if opts.RedirectSchema == "" {
+	excludeObjectTypes := []string{"SCHEMA"}
+	if state.opts.RedirectSchema == "" && useList {
+		// Schemas selected with --use-list are restored in the order they were listed, along with everything else
+		excludeObjectTypes = []string{}
+	} else if state.opts.RedirectSchema == "" {
 		schemaStatements = GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SCHEMA"}, []string{}, filters)
+		schemaStatements = FilterStatementsByUserObjectTypes(schemaStatements)
 	}
-	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, []string{"SCHEMA"}, filters)
+	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{}, excludeObjectTypes, filters)
+	statements = FilterStatementsByUserObjectTypes(statements)
 
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	editStatementsRedirect(statements)
 	progressBar := utils.NewProgressBar(len(schemaStatements)+len(statements), "Pre-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
 
 	RestoreSchemas(schemaStatements, progressBar)
-	ExecuteRestoreMetadataStatements(statements, "Pre-data objects", progressBar, utils.PB_VERBOSE, false)
+	if useList {
+		ExecuteStatementsInListOrder(statements, progressBar)
+	} else if state.connectionPool.NumConns > 1 {
+		ExecuteStatementsWithDependencies(statements, state.globalTOC.GetPredataDependencies(), progressBar)
+	} else {
+		ExecuteRestoreMetadataStatements(statements, "Pre-data objects", progressBar, utils.PB_VERBOSE, false)
+	}
 
 	progressBar.Finish()
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("Pre-data metadata restore incomplete")
 	} else {
 		gplog.Info("Pre-data metadata restore complete")
@@ -288,17 +384,19 @@ func restorePredata(metadataFilename string) {
 }
 
 func restoreSequenceValues(metadataFilename string) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Restoring sequence values")
 
 	// if not incremental restore - assume database is empty and just filter based on user input
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
 
 	// Extract out the setval calls for each SEQUENCE object
 	var sequenceValueStatements []toc.StatementWithType
 	statements := GetRestoreMetadataStatementsFiltered("predata", metadataFilename, []string{"SEQUENCE"}, []string{}, filters)
+	statements = FilterStatementsByUserObjectTypes(statements)
+	editStatementsRedirect(statements)
 	re := regexp.MustCompile(`SELECT pg_catalog.setval\(.*`)
 	for _, statement := range statements {
 		matches := re.FindStringSubmatch(statement.Statement)
@@ -317,39 +415,54 @@ func restoreSequenceValues(metadataFilename string) {
 		progressBar.Finish()
 	}
 
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("Sequence values restore incomplete")
 	} else {
 		gplog.Info("Sequence values restore complete")
 	}
 }
 
-func editStatementsRedirectSchema(statements []toc.StatementWithType, redirectSchema string) {
-	if redirectSchema == "" {
-		return
+/*
+ * Moves the statements to the schema given with --redirect-schema and renames
+ * the table given with --include-table to the name given with --redirect-table.
+ */
+func editStatementsRedirect(statements []toc.StatementWithType) {
+	toc.RedirectSchemaInStatements(statements, state.opts.RedirectSchema)
+	if state.opts.RedirectTable != "" {
+		fqns, err := options.SeparateSchemaAndTable(state.opts.IncludedRelations)
+		gplog.FatalOnError(err)
+		schema, _ := redirectedTableName(fqns[0].SchemaName, fqns[0].TableName)
+		toc.RedirectTableInStatements(statements, schema, fqns[0].TableName, state.opts.RedirectTable)
 	}
+}
 
-	for i, statement := range statements {
-		oldSchema := fmt.Sprintf("%s.", statement.Schema)
-		newSchema := fmt.Sprintf("%s.", redirectSchema)
-		statements[i].Schema = redirectSchema
-		statements[i].Statement = strings.Replace(statement.Statement, oldSchema, newSchema, 1)
-		// only postdata will have a reference object
-		if statement.ReferenceObject != "" {
-			statements[i].ReferenceObject = strings.Replace(statement.ReferenceObject, oldSchema, newSchema, 1)
-		}
+/*
+ * Returns the schema and name a table is restored to, which differ from those
+ * it was backed up with when --redirect-schema or --redirect-table is used.
+ */
+func redirectedTableName(schema string, name string) (string, string) {
+	if state.opts.RedirectTable != "" && utils.MakeFQN(schema, name) == state.opts.IncludedRelations[0] {
+		name = state.opts.RedirectTable
 	}
+	if state.opts.RedirectSchema != "" {
+		schema = state.opts.RedirectSchema
+	}
+	return schema, name
+}
+
+func withFilterPatterns(names []string, patterns []string) []string {
+	return append(append([]string{}, names...), patterns...)
 }
 
 func restoreData() (int, map[string][]toc.MasterDataEntry) {
-	if wasTerminated {
+	if wasCanceled() {
 		return -1, nil
 	}
-	restorePlan := backupConfig.RestorePlan
+	restorePlan := state.backupConfig.RestorePlan
 	restorePlanEntries := make([]history.RestorePlanEntry, 0)
 	if MustGetFlagBool(options.INCREMENTAL) {
 		restorePlanEntries = append(restorePlanEntries,
-			restorePlan[len(backupConfig.RestorePlan)-1])
+			restorePlan[len(state.backupConfig.RestorePlan)-1])
 	} else {
 		for _, restorePlanEntry := range restorePlan {
 			restorePlanEntries = append(restorePlanEntries, restorePlanEntry)
@@ -362,8 +475,13 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 		fpInfo := GetBackupFPInfoForTimestamp(entry.Timestamp)
 		tocfile := toc.NewTOC(fpInfo.GetTOCFilePath())
 		restorePlanTableFQNs := entry.TableFQNs
-		filteredDataEntriesForTimestamp := tocfile.GetDataEntriesMatching(opts.IncludedSchemas,
-			opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations, restorePlanTableFQNs)
+		// The patterns are resolved against each backup's own TOC as well, which may have tables the last backup does not
+		filteredDataEntriesForTimestamp := tocfile.GetDataEntriesMatching(
+			withFilterPatterns(state.opts.IncludedSchemas, state.opts.IncludedSchemaPatterns), withFilterPatterns(state.opts.ExcludedSchemas, state.opts.ExcludedSchemaPatterns),
+			withFilterPatterns(state.opts.IncludedRelations, state.opts.IncludedRelationPatterns), withFilterPatterns(state.opts.ExcludedRelations, state.opts.ExcludedRelationPatterns),
+			restorePlanTableFQNs)
+		filteredDataEntriesForTimestamp = toc.FilterDataEntriesByObjectType(filteredDataEntriesForTimestamp, state.opts.IncludedObjectTypes, state.opts.ExcludedObjectTypes)
+		filteredDataEntriesForTimestamp = filterDataEntriesByList(filteredDataEntriesForTimestamp)
 		filteredDataEntries[entry.Timestamp] = filteredDataEntriesForTimestamp
 		totalTables += len(filteredDataEntriesForTimestamp)
 	}
@@ -377,7 +495,7 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 	}
 
 	dataProgressBar.Finish()
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("Data restore incomplete")
 	} else {
 		gplog.Info("Data restore complete")
@@ -387,22 +505,27 @@ func restoreData() (int, map[string][]toc.MasterDataEntry) {
 }
 
 func restorePostdata(metadataFilename string) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Restoring post-data metadata")
 
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
 
 	statements := GetRestoreMetadataStatementsFiltered("postdata", metadataFilename, []string{}, []string{}, filters)
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
-	firstBatch, secondBatch := BatchPostdataStatements(statements)
+	statements = FilterStatementsByUserObjectTypes(statements)
+	editStatementsRedirect(statements)
 	progressBar := utils.NewProgressBar(len(statements), "Post-data objects restored: ", utils.PB_VERBOSE)
 	progressBar.Start()
-	ExecuteRestoreMetadataStatements(firstBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
-	ExecuteRestoreMetadataStatements(secondBatch, "", progressBar, utils.PB_VERBOSE, connectionPool.NumConns > 1)
+	if MustGetFlagString(options.USE_LIST) != "" {
+		ExecuteStatementsInListOrder(statements, progressBar)
+	} else {
+		firstBatch, secondBatch := BatchPostdataStatements(statements)
+		ExecuteRestoreMetadataStatements(firstBatch, "", progressBar, utils.PB_VERBOSE, state.connectionPool.NumConns > 1)
+		ExecuteRestoreMetadataStatements(secondBatch, "", progressBar, utils.PB_VERBOSE, state.connectionPool.NumConns > 1)
+	}
 	progressBar.Finish()
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("Post-data metadata restore incomplete")
 	} else {
 		gplog.Info("Post-data metadata restore complete")
@@ -410,22 +533,23 @@ func restorePostdata(metadataFilename string) {
 }
 
 func restoreStatistics() {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
-	statisticsFilename := globalFPInfo.GetStatisticsFilePath()
+	statisticsFilename := state.globalFPInfo.GetStatisticsFilePath()
 	gplog.Info("Restoring query planner statistics from %s", statisticsFilename)
 
-	filters := NewFilters(opts.IncludedSchemas, opts.ExcludedSchemas, opts.IncludedRelations, opts.ExcludedRelations)
+	filters := NewFilters(state.opts.IncludedSchemas, state.opts.ExcludedSchemas, state.opts.IncludedRelations, state.opts.ExcludedRelations)
 
 	statements := GetRestoreMetadataStatementsFiltered("statistics", statisticsFilename, []string{}, []string{}, filters)
-	editStatementsRedirectSchema(statements, opts.RedirectSchema)
+	statements = FilterStatementsByUserObjectTypes(statements)
+	editStatementsRedirect(statements)
 	ExecuteRestoreMetadataStatements(statements, "Table statistics", nil, utils.PB_VERBOSE, false)
 	gplog.Info("Query planner statistics restore complete")
 }
 
 func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
-	if wasTerminated {
+	if wasCanceled() {
 		return
 	}
 	gplog.Info("Running ANALYZE on restored tables")
@@ -433,16 +557,13 @@ func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
 	var analyzeStatements []toc.StatementWithType
 	for _, dataEntries := range filteredDataEntries {
 		for _, entry := range dataEntries {
-			tableSchema := entry.Schema
-			if opts.RedirectSchema != "" {
-				tableSchema = opts.RedirectSchema
-			}
-			tableFQN := utils.MakeFQN(tableSchema, entry.Name)
+			tableSchema, tableName := redirectedTableName(entry.Schema, entry.Name)
+			tableFQN := utils.MakeFQN(tableSchema, tableName)
 			analyzeCommand := fmt.Sprintf("ANALYZE %s", tableFQN)
 
 			newAnalyzeStatement := toc.StatementWithType{
 				Schema:    tableSchema,
-				Name:      entry.Name,
+				Name:      tableName,
 				Statement: analyzeCommand,
 			}
 			analyzeStatements = append(analyzeStatements, newAnalyzeStatement)
@@ -454,42 +575,39 @@ func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
 	// from the leaf partition info and run ANALYZE ROOTPARTITION on the root
 	// partitions. These particular ANALYZE ROOTPARTITION statements should run
 	// last so add them to the end of the analyzeStatements list.
-	if connectionPool.Version.Is("4") {
+	if state.connectionPool.Version.Is("4") {
 		// Create root partition set
-		partitionRootSet := map[toc.StatementWithType]struct{}{}
+		partitionRootSet := map[string]toc.StatementWithType{}
 		for _, dataEntries := range filteredDataEntries {
 			for _, entry := range dataEntries {
 				if entry.PartitionRoot != "" {
-					tableSchema := entry.Schema
-					if opts.RedirectSchema != "" {
-						tableSchema = opts.RedirectSchema
-					}
-					rootFQN := utils.MakeFQN(tableSchema, entry.PartitionRoot)
+					tableSchema, rootName := redirectedTableName(entry.Schema, entry.PartitionRoot)
+					rootFQN := utils.MakeFQN(tableSchema, rootName)
 					analyzeCommand := fmt.Sprintf("ANALYZE ROOTPARTITION %s", rootFQN)
 					rootStatement := toc.StatementWithType{
 						Schema:    tableSchema,
-						Name:      entry.PartitionRoot,
+						Name:      rootName,
 						Statement: analyzeCommand,
 					}
 
-					if _, ok := partitionRootSet[rootStatement]; !ok {
-						partitionRootSet[rootStatement] = struct{}{}
+					if _, ok := partitionRootSet[analyzeCommand]; !ok {
+						partitionRootSet[analyzeCommand] = rootStatement
 					}
 				}
 			}
 		}
 
-		for rootAnalyzeStatement, _ := range partitionRootSet {
+		for _, rootAnalyzeStatement := range partitionRootSet {
 			analyzeStatements = append(analyzeStatements, rootAnalyzeStatement)
 		}
 	}
 
 	progressBar := utils.NewProgressBar(len(analyzeStatements), "Tables analyzed: ", utils.PB_VERBOSE)
 	progressBar.Start()
-	ExecuteStatements(analyzeStatements, progressBar, connectionPool.NumConns > 1)
+	ExecuteStatements(analyzeStatements, progressBar, state.connectionPool.NumConns > 1)
 	progressBar.Finish()
 
-	if wasTerminated {
+	if state.runCtx.Err() != nil {
 		gplog.Info("ANALYZE on restored tables incomplete")
 	} else {
 		gplog.Info("ANALYZE on restored tables complete")
@@ -497,67 +615,120 @@ func runAnalyze(filteredDataEntries map[string][]toc.MasterDataEntry) {
 
 }
 
-func DoTeardown() {
-	restoreFailed := false
-	defer func() {
-		DoCleanup(restoreFailed)
+/*
+ * Returns the message of a panic caused by gplog.Fatal, or logs the stack of
+ * a panic with any other cause and returns an empty string.
+ */
+func getFatalErrorMessage(panicValue interface{}) string {
+	// Check if gplog.Fatal did not cause the panic
+	if gplog.GetErrorCode() != 2 {
+		gplog.Error(fmt.Sprintf("%v: %s", panicValue, debug.Stack()))
+		gplog.SetErrorCode(2)
+		return ""
+	}
+	errStr := fmt.Sprintf("%v", panicValue)
+	// The error of a statement canceled by --timeout does not say why it was canceled
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" && !strings.Contains(errStr, timeoutMsg) {
+		errStr = strings.Replace(errStr, "[CRITICAL]:-", fmt.Sprintf("[CRITICAL]:-%s: ", timeoutMsg), 1)
+	}
+	return errStr
+}
 
-		errorCode := gplog.GetErrorCode()
-		if errorCode == 0 {
-			gplog.Info("Restore completed successfully")
-		}
-		os.Exit(errorCode)
+// Returns a message saying how long the restore ran for if --timeout expired, or "" otherwise
+func getTimeoutMessage() string {
+	if state.runCtx.Err() != context.DeadlineExceeded {
+		return ""
+	}
+	return fmt.Sprintf("Restore timed out after %d seconds", MustGetFlagInt(options.TIMEOUT))
+}
 
-	}()
+// Stops the restore once --timeout expires, rather than continuing on to the next step
+func checkTimeout() {
+	if timeoutMsg := getTimeoutMessage(); timeoutMsg != "" {
+		gplog.Fatal(errors.New(timeoutMsg), "")
+	}
+}
 
-	errStr := ""
-	if err := recover(); err != nil {
-		// Check if gplog.Fatal did not cause the panic
-		if gplog.GetErrorCode() != 2 {
-			gplog.Error(fmt.Sprintf("%v: %s", err, debug.Stack()))
-			gplog.SetErrorCode(2)
-		} else {
-			errStr = fmt.Sprintf("%v", err)
-		}
-		restoreFailed = true
+// Returns whether the restore was canceled, so the steps left are skipped, or stops it if --timeout expired
+func wasCanceled() bool {
+	checkTimeout()
+	return state.runCtx.Err() != nil
+}
+
+/*
+ * Catalog queries and lock waits cannot be canceled through a context, so
+ * they are canceled from another session once --timeout expires or the
+ * restore is canceled, which cancels runCtx through its parent context.  The
+ * queries are left alone when runCtx is canceled by the cleanup of a restore
+ * that was not canceled.
+ */
+func cancelQueriesOnTimeout(runCtx context.Context, parentCtx context.Context, dbname string, backupTimestamp string, restoreTimestamp string) {
+	<-runCtx.Done()
+	if runCtx.Err() == context.DeadlineExceeded {
+		gplog.Warn("Restore timed out, canceling queries in progress")
+	} else if parentCtx.Err() != nil {
+		gplog.Warn("Restore canceled, canceling queries in progress")
+	} else {
+		return
 	}
-	if wasTerminated {
+	utils.CancelApplicationQueries(dbname, fmt.Sprintf("gprestore_%s_%s", backupTimestamp, restoreTimestamp))
+}
+
+/*
+ * Writes the report and error table files of the restore and cleans up the
+ * plugin, unless the restore was canceled.  Returns whether the restore
+ * failed, which it has if it was canceled.
+ */
+func finishRestore(restoreFailed bool, errStr string) bool {
+	if state.wasTerminated {
 		/*
-		 * Don't print an error if the restore was canceled, as the signal handler
-		 * will take care of cleanup and return codes.  Just wait until the signal
-		 * handler's DoCleanup completes so the main goroutine doesn't exit while
-		 * cleanup is still in progress.
+		 * Don't print an error if the restore was canceled, as Run returns the
+		 * context's error instead.  Just wait until the DoCleanup started by the
+		 * cancellation completes so that Run doesn't return while cleanup is
+		 * still in progress.
 		 */
-		CleanupGroup.Wait()
-		restoreFailed = true
-		return
+		state.cleanupGroup.Wait()
+		return true
+	}
+	// The report is still written and the plugin cleaned up if --timeout canceled the restore's commands
+	state.globalCluster = utils.ClusterWithoutContext(state.globalCluster)
+	if state.pluginConfig != nil {
+		state.pluginConfig.SetContext(context.Background())
 	}
 	if errStr != "" {
 		fmt.Println(errStr)
 	}
 	errMsg := report.ParseErrorMessage(errStr)
 
-	if globalFPInfo.Timestamp != "" {
-		_, statErr := os.Stat(globalFPInfo.GetDirForContent(-1))
+	if state.globalFPInfo.Timestamp != "" {
+		_, statErr := os.Stat(state.globalFPInfo.GetDirForContent(-1))
 		if statErr != nil { // Even if this isn't os.IsNotExist, don't try to write a report file in case of further errors
-			return
+			return restoreFailed
+		}
+		// Listing, printing, comparing, or copying a backup does not restore anything, so there is nothing to report
+		isRestoring := !MustGetFlagBool(options.LIST) && !MustGetFlagBool(options.PRINT_DDL) && !MustGetFlagBool(options.DIFF) && !isCopyMode()
+		if isRestoring {
+			reportFilename := state.globalFPInfo.GetRestoreReportFilePath(state.restoreStartTime)
+			pluginRetries := 0
+			if state.pluginConfig != nil {
+				pluginRetries = state.pluginConfig.NumRetries()
+			}
+			report.WriteRestoreReportFile(reportFilename, state.globalFPInfo.Timestamp, state.restoreStartTime, state.connectionPool, version, errMsg, pluginRetries)
+			report.EmailReport(state.globalCluster, state.globalFPInfo.Timestamp, reportFilename, "gprestore", !restoreFailed)
 		}
-		reportFilename := globalFPInfo.GetRestoreReportFilePath(restoreStartTime)
-		report.WriteRestoreReportFile(reportFilename, globalFPInfo.Timestamp, restoreStartTime, connectionPool, version, errMsg)
-		report.EmailReport(globalCluster, globalFPInfo.Timestamp, reportFilename, "gprestore", !restoreFailed)
-		if pluginConfig != nil {
-			pluginConfig.CleanupPluginForRestore(globalCluster, globalFPInfo)
-			pluginConfig.DeletePluginConfigWhenEncrypting(globalCluster)
+		if state.pluginConfig != nil && !isOfflineMode() {
+			state.pluginConfig.CleanupPluginForRestore(state.globalCluster, state.globalFPInfo)
 		}
-		if len(errorTablesMetadata) > 0 {
+		if len(state.errorTablesMetadata) > 0 {
 			// tables with metadata errors
 			writeErrorTables(true)
 		}
-		if len(errorTablesData) > 0 {
+		if len(state.errorTablesData) > 0 {
 			// tables with data errors
 			writeErrorTables(false)
 		}
 	}
+	return restoreFailed
 }
 
 func writeErrorTables(isMetadata bool) {
@@ -565,12 +736,12 @@ func writeErrorTables(isMetadata bool) {
 	var errorFilename string
 
 	if isMetadata == true {
-		errorFilename = globalFPInfo.GetErrorTablesMetadataFilePath(restoreStartTime)
-		errorTables = &errorTablesMetadata
+		errorFilename = state.globalFPInfo.GetErrorTablesMetadataFilePath(state.restoreStartTime)
+		errorTables = &state.errorTablesMetadata
 		gplog.Verbose("Logging error tables during metadata restore in %s", errorFilename)
 	} else {
-		errorFilename = globalFPInfo.GetErrorTablesDataFilePath(restoreStartTime)
-		errorTables = &errorTablesData
+		errorFilename = state.globalFPInfo.GetErrorTablesDataFilePath(state.restoreStartTime)
+		errorTables = &state.errorTablesData
 		gplog.Verbose("Logging error tables during data restore in %s", errorFilename)
 	}
 
@@ -599,24 +770,43 @@ func DoCleanup(restoreFailed bool) {
 			gplog.Warn("Encountered error during cleanup: %v", err)
 		}
 		gplog.Verbose("Cleanup complete")
-		CleanupGroup.Done()
+		state.cleanupGroup.Done()
 	}()
 
 	gplog.Verbose("Beginning cleanup")
-	if backupConfig != nil && backupConfig.SingleDataFile {
+	// Cancel the statements and commands in progress before cleaning up after them
+	state.cancelRun()
+	cleanupCluster := utils.ClusterWithoutContext(state.globalCluster)
+	// No helper processes are started without a connection, and there are no segment hosts to clean up
+	if state.backupConfig != nil && state.backupConfig.SingleDataFile && !isOfflineMode() && !isCopyMode() {
 		fpInfoList := GetBackupFPInfoListFromRestorePlan()
 		for _, fpInfo := range fpInfoList {
 			if restoreFailed {
-				utils.CleanUpSegmentHelperProcesses(globalCluster, fpInfo, "restore")
+				utils.CleanUpSegmentHelperProcesses(cleanupCluster, fpInfo, "restore")
 			}
-			utils.CleanUpHelperFilesOnAllHosts(globalCluster, fpInfo)
-			if wasTerminated { // These should all end on their own in a successful restore
-				utils.TerminateHangingCopySessions(connectionPool, fpInfo, "gprestore")
+			utils.CleanUpHelperFilesOnAllHosts(cleanupCluster, fpInfo)
+			if state.wasTerminated { // These should all end on their own in a successful restore
+				utils.TerminateHangingCopySessions(state.connectionPool, fpInfo, "gprestore")
 			}
 		}
 	}
+	if state.pluginConfig != nil {
+		state.pluginConfig.DeletePluginConfigOnAllHosts(cleanupCluster)
+	}
+	if state.copyPluginConfig != nil {
+		state.copyPluginConfig.DeletePluginConfigOnAllHosts(cleanupCluster)
+	}
+	if isMigrateMode() && state.backupConfig != nil {
+		CleanUpMigrationPipesOnAllHosts(cleanupCluster, state.globalFPInfo)
+	}
+	if isMigrateMode() && state.globalFPInfo.Timestamp != "" {
+		RemoveMigrationMetadataFiles(state.globalFPInfo)
+	}
+	if state.migrationSourcePool != nil {
+		state.migrationSourcePool.Close()
+	}
 
-	if connectionPool != nil {
-		connectionPool.Close()
+	if state.connectionPool != nil {
+		state.connectionPool.Close()
 	}
 }
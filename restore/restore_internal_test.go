@@ -1,14 +1,25 @@
 package restore
 
 import (
+	"bytes"
+	"context"
+
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
 
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 )
 
 var _ = Describe("restore internal tests", func() {
-	Describe("editStatementsRedirectStatements", func() {
+	Describe("editStatementsRedirect", func() {
+		BeforeEach(func() {
+			state.opts = &options.Options{}
+		})
 		It("does not alter schemas if no redirect was specified", func() {
 			statements := []toc.StatementWithType{
 				{ // simple table
@@ -25,7 +36,7 @@ var _ = Describe("restore internal tests", func() {
 				},
 			}
 
-			editStatementsRedirectSchema(statements, "")
+			editStatementsRedirect(statements)
 			Expect(statements).To(Equal(statements))
 		})
 		It("changes schema in the sql statement", func() {
@@ -40,7 +51,8 @@ var _ = Describe("restore internal tests", func() {
 				},
 			}
 
-			editStatementsRedirectSchema(statements, "foo2")
+			state.opts.RedirectSchema = "foo2"
+			editStatementsRedirect(statements)
 
 			expectedStatements := []toc.StatementWithType{
 				{
@@ -54,5 +66,177 @@ var _ = Describe("restore internal tests", func() {
 			}
 			Expect(statements).To(Equal(expectedStatements))
 		})
+		It("renames the included table in the redirect schema", func() {
+			statements := []toc.StatementWithType{
+				{
+					Schema: "foo", Name: "bar", ObjectType: "TABLE",
+					Statement: "\n\nCREATE TABLE foo.bar (\n\ti integer\n) DISTRIBUTED BY (i);\n",
+				},
+				{
+					Schema: "foo", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "foo.bar",
+					Statement: "\n\nCREATE INDEX bar_idx ON foo.bar USING btree (i);\n",
+				},
+			}
+
+			state.opts.IncludedRelations = []string{"foo.bar"}
+			state.opts.RedirectSchema = "foo2"
+			state.opts.RedirectTable = "baz"
+			editStatementsRedirect(statements)
+
+			expectedStatements := []toc.StatementWithType{
+				{
+					Schema: "foo2", Name: "baz", ObjectType: "TABLE",
+					Statement: "\n\nCREATE TABLE foo2.baz (\n\ti integer\n) DISTRIBUTED BY (i);\n",
+				},
+				{
+					Schema: "foo2", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "foo2.baz",
+					Statement: "\n\nCREATE INDEX bar_idx ON foo2.baz USING btree (i);\n",
+				},
+			}
+			Expect(statements).To(Equal(expectedStatements))
+		})
+	})
+	Describe("redirectedTableName", func() {
+		BeforeEach(func() {
+			state.opts = &options.Options{IncludedRelations: []string{"foo.bar"}}
+		})
+		It("returns the name the table was backed up with if no redirect was specified", func() {
+			Expect(utils.MakeFQN(redirectedTableName("foo", "bar"))).To(Equal("foo.bar"))
+		})
+		It("moves every table to the redirect schema", func() {
+			state.opts.RedirectSchema = "foo2"
+			Expect(utils.MakeFQN(redirectedTableName("foo", "bar"))).To(Equal("foo2.bar"))
+			Expect(utils.MakeFQN(redirectedTableName("foo", "bar_1_prt_1"))).To(Equal("foo2.bar_1_prt_1"))
+		})
+		It("renames only the included table to the redirect table", func() {
+			state.opts.RedirectSchema = "foo2"
+			state.opts.RedirectTable = "baz"
+			Expect(utils.MakeFQN(redirectedTableName("foo", "bar"))).To(Equal("foo2.baz"))
+			Expect(utils.MakeFQN(redirectedTableName("foo", "bar_1_prt_1"))).To(Equal("foo2.bar_1_prt_1"))
+		})
+	})
+	Describe("filterDataEntriesByList", func() {
+		entries := []toc.MasterDataEntry{{Schema: "public", Name: "foo"}, {Schema: "public", Name: "bar"}, {Schema: "public", Name: "baz"}}
+		AfterEach(func() {
+			state.listedDataEntries = nil
+		})
+		It("returns all entries if no list file was used", func() {
+			Expect(filterDataEntriesByList(entries)).To(Equal(entries))
+		})
+		It("returns only the listed entries in the listed order", func() {
+			state.listedDataEntries = map[string]int{"public.baz": 0, "public.foo": 1}
+
+			Expect(filterDataEntriesByList(entries)).To(Equal([]toc.MasterDataEntry{{Schema: "public", Name: "baz"}, {Schema: "public", Name: "foo"}}))
+		})
+	})
+	Describe("quoteRelationsInBackupSet", func() {
+		BeforeEach(func() {
+			state.globalTOC = &toc.TOC{PredataEntries: []toc.MetadataEntry{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE"},
+				{Schema: `"MySchema"`, Name: `"MyTable"`, ObjectType: "TABLE"},
+			}}
+		})
+		It("returns the quoted names of relations in the backup set", func() {
+			Expect(quoteRelationsInBackupSet([]string{"public.foo", "MySchema.MyTable"})).To(Equal([]string{"public.foo", `"MySchema"."MyTable"`}))
+		})
+		It("leaves relations that are not in the backup set unchanged", func() {
+			Expect(quoteRelationsInBackupSet([]string{"public.bar", "myschema.mytable"})).To(Equal([]string{"public.bar", "myschema.mytable"}))
+		})
+	})
+	Describe("writeDDLStatements", func() {
+		It("writes a header followed by the statements", func() {
+			state.globalFPInfo = filepath.FilePathInfo{Timestamp: "20170101010101"}
+			state.backupConfig = &history.BackupConfig{DatabaseName: "testdb"}
+			statements := []toc.StatementWithType{
+				{Schema: "public", Name: "foo", ObjectType: "TABLE", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n"},
+				{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", Statement: "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\n"},
+			}
+			outputBuffer := bytes.NewBuffer(nil)
+
+			writeDDLStatements(utils.NewFileWithByteCount(outputBuffer), statements)
+
+			Expect(outputBuffer.String()).To(Equal(`--
+-- Metadata from backup 20170101010101 of database testdb
+--
+
+
+CREATE TABLE public.foo (
+	i integer
+) DISTRIBUTED BY (i);
+
+
+CREATE INDEX foo_idx ON public.foo USING btree (i);
+
+`))
+		})
+	})
+	Describe("getAOEntriesToDiff", func() {
+		tocfile := &toc.TOC{
+			DataEntries: []toc.MasterDataEntry{{Schema: "public", Name: "foo"}},
+			IncrementalMetadata: toc.IncrementalEntries{AO: map[string]toc.AOEntry{
+				"public.foo":               {Modcount: 1},
+				"excluded.bar":             {Modcount: 2},
+				`"my.schema"."baz"`:        {Modcount: 3},
+				`"my ""quoted"" schema".q`: {Modcount: 4},
+			}},
+		}
+		It("filters tables by schema whether or not their data was backed up", func() {
+			filters := NewFilters(nil, []string{"excluded", `"my ""quoted"" schema"`}, nil, nil)
+
+			Expect(getAOEntriesToDiff(tocfile, filters)).To(Equal(map[string]toc.AOEntry{
+				"public.foo":        {Modcount: 1},
+				`"my.schema"."baz"`: {Modcount: 3},
+			}))
+		})
+		It("takes the schema of a quoted FQN from before its first unquoted dot", func() {
+			filters := NewFilters([]string{`"my.schema"`}, nil, nil, nil)
+
+			Expect(getAOEntriesToDiff(tocfile, filters)).To(Equal(map[string]toc.AOEntry{`"my.schema"."baz"`: {Modcount: 3}}))
+		})
+	})
+	Describe("runState", func() {
+		It("terminates a restore canceled before it completes", func() {
+			runState := newRunState(context.Background())
+
+			Expect(runState.terminate()).To(BeTrue())
+			Expect(runState.complete()).To(BeTrue())
+			Expect(runState.wasTerminated).To(BeTrue())
+		})
+		It("does not terminate a restore canceled after it completes", func() {
+			runState := newRunState(context.Background())
+
+			Expect(runState.complete()).To(BeFalse())
+			Expect(runState.terminate()).To(BeFalse())
+			Expect(runState.wasTerminated).To(BeFalse())
+		})
+	})
+	Describe("wasCanceled", func() {
+		var runCtx context.Context
+		BeforeEach(func() {
+			runCtx = state.runCtx
+		})
+		AfterEach(func() {
+			state.runCtx = runCtx
+		})
+		It("returns false while the restore is running", func() {
+			state.runCtx = context.Background()
+
+			Expect(wasCanceled()).To(BeFalse())
+		})
+		It("returns true once the restore is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			state.runCtx = ctx
+
+			Expect(wasCanceled()).To(BeTrue())
+		})
+		It("stops the restore once --timeout expires", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 0)
+			defer cancel()
+			state.runCtx = ctx
+
+			defer testhelper.ShouldPanicWithMessage("timed out after")
+			wasCanceled()
+		})
 	})
 })
@@ -0,0 +1,205 @@
+package restore
+
+/*
+ * This file contains the API for running a restore from another Go program
+ * instead of from the gprestore command line.
+ */
+
+import (
+	"context"
+	"sort"
+	"sync"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/report"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+/*
+ * Flags holds the values of gprestore's command-line flags, keyed by the flag
+ * names in the options package, e.g. options.TIMESTAMP.  Flags that may be
+ * passed more than once, such as --include-table, take each of their values
+ * in turn, and boolean flags take "true" or "false".
+ *
+ * LogDir is the directory the log file is written to, which defaults to
+ * gpAdminLogs in the home directory as with gprestore.  It is only used if
+ * logging has not already been initialized in this process.
+ */
+type Config struct {
+	Flags  map[string][]string
+	LogDir string
+}
+
+/*
+ * The error tables are the tables whose metadata or data could not be
+ * restored with --on-error-continue, as written to the error table files.
+ */
+type Result struct {
+	Timestamp           string
+	StartTime           string
+	ErrorTablesMetadata []string
+	ErrorTablesData     []string
+}
+
+// Restores in the same process share the package state, so only one may run at a time
+var runMutex sync.Mutex
+
+/*
+ * Runs a restore as gprestore would with the flags in config, but returns an
+ * error instead of exiting the process if the restore fails.  The version
+ * checked against the backup's version must have been set with SetVersion.
+ *
+ * Canceling ctx before the restore completes aborts it in the same way as
+ * sending gprestore a termination signal, in which case the error returned is
+ * ctx.Err().  Canceling ctx after that does not affect the result.  Run
+ * returns once cleanup is complete.
+ */
+func Run(ctx context.Context, config Config) (*Result, error) {
+	runMutex.Lock()
+	defer runMutex.Unlock()
+
+	if version == "" {
+		return nil, errors.New("The gprestore version must be set with SetVersion before running a restore")
+	}
+	state = newRunState(ctx)
+	// The state of this run, including its canceled context, must not be left for later runs in the process
+	defer func() {
+		state = newRunState(context.Background())
+	}()
+	SetCmdFlags(pflag.NewFlagSet("gprestore", pflag.ContinueOnError))
+	err := options.SetFlagValues(state.cmdFlags, config.Flags)
+	if err != nil {
+		return nil, err
+	}
+	err = applyConfigFile(state.cmdFlags)
+	if err != nil {
+		return nil, err
+	}
+	gplog.InitializeLogging("gprestore", config.LogDir)
+	gplog.SetErrorCode(0)
+
+	var cleanupOnce sync.Once
+	cleanup := func(restoreFailed bool) {
+		cleanupOnce.Do(func() { DoCleanup(restoreFailed) })
+	}
+	restoreDone := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			if !state.terminate() {
+				return
+			}
+			cleanupOnce.Do(func() {
+				gplog.Warn("Context canceled, aborting restore process")
+				DoCleanup(true)
+			})
+		case <-restoreDone:
+		}
+	}()
+
+	restoreFailed := false
+	errStr, runErr := runRecovering(func() {
+		validateFlags(state.cmdFlags)
+		DoSetup()
+		DoRestore()
+	})
+	terminated := state.complete()
+	close(restoreDone)
+	if runErr != nil {
+		restoreFailed = true
+	}
+	_, teardownErr := runRecovering(func() {
+		restoreFailed = finishRestore(restoreFailed, errStr)
+	})
+	var result *Result
+	if !terminated && runErr == nil && teardownErr == nil {
+		result = &Result{
+			Timestamp:           state.globalFPInfo.Timestamp,
+			StartTime:           state.restoreStartTime,
+			ErrorTablesMetadata: getSortedTables(state.errorTablesMetadata),
+			ErrorTablesData:     getSortedTables(state.errorTablesData),
+		}
+	}
+	cleanup(restoreFailed)
+
+	switch {
+	case terminated:
+		return nil, ctx.Err()
+	case runErr != nil:
+		return nil, runErr
+	case teardownErr != nil:
+		return nil, teardownErr
+	}
+	if gplog.GetErrorCode() == 0 {
+		gplog.Info("Restore completed successfully")
+	}
+	return result, nil
+}
+
+/*
+ * Marks the restore as terminated, unless it has already completed, as by
+ * then the report of a successful restore may already have been written.
+ * Returns whether the restore was terminated.
+ */
+func (s *runState) terminate() bool {
+	s.terminationMutex.Lock()
+	defer s.terminationMutex.Unlock()
+	if s.completed {
+		return false
+	}
+	s.wasTerminated = true
+	return true
+}
+
+// Marks the restore as completed and returns whether it was terminated first
+func (s *runState) complete() bool {
+	s.terminationMutex.Lock()
+	defer s.terminationMutex.Unlock()
+	s.completed = true
+	return s.wasTerminated
+}
+
+/*
+ * Returns the code gprestore exits with once Run returns err, which is the
+ * error code of the restore, or 2 if it failed or was canceled.  An error that
+ * was not already logged, such as that of an invalid config file, is logged.
+ */
+func GetExitCode(err error) int {
+	if err == nil {
+		return gplog.GetErrorCode()
+	}
+	if gplog.GetErrorCode() != 2 && err != context.Canceled {
+		gplog.Error(err.Error())
+	}
+	return 2
+}
+
+/*
+ * Runs f and returns the error of any panic it causes, along with the message
+ * to record in the restore report, which is only set if gplog.Fatal caused it.
+ */
+func runRecovering(f func()) (errStr string, err error) {
+	defer func() {
+		if panicValue := recover(); panicValue != nil {
+			errStr = getFatalErrorMessage(panicValue)
+			if errStr != "" {
+				err = errors.New(report.ParseErrorMessage(errStr))
+			} else {
+				err = errors.Errorf("%v", panicValue)
+			}
+		}
+	}()
+	f()
+	return "", nil
+}
+
+func getSortedTables(tables map[string]Empty) []string {
+	sortedTables := make([]string, 0, len(tables))
+	for table := range tables {
+		sortedTables = append(sortedTables, table)
+	}
+	sort.Strings(sortedTables)
+	return sortedTables
+}
@@ -0,0 +1,103 @@
+package restore_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/history"
+	"github.com/greenplum-db/gpbackup/options"
+	"github.com/greenplum-db/gpbackup/restore"
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/pkg/errors"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("restore/run tests", func() {
+	Describe("Run", func() {
+		timestamp := "20170101010101"
+		BeforeEach(func() {
+			restore.SetVersion("1.0.0")
+		})
+		AfterEach(func() {
+			restore.SetVersion("")
+			gplog.SetErrorCode(0)
+		})
+		It("returns an error if the timestamp is not set", func() {
+			_, err := restore.Run(context.Background(), restore.Config{})
+
+			Expect(err).To(MatchError("The --timestamp flag must be set"))
+		})
+		It("returns the error that would cause gprestore to exit instead of exiting", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{options.TIMESTAMP: {"foo"}}})
+
+			Expect(err).To(MatchError("Timestamp foo is invalid.  Timestamps must be in the format YYYYMMDDHHMMSS."))
+		})
+		It("returns an error for a backup directory map with a backup directory", func() {
+			_, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:           {timestamp},
+				options.BACKUP_DIR:          {"/backups"},
+				options.BACKUP_DIR_MAP_FILE: {"/backups/dirmap.yaml"},
+			}})
+
+			Expect(err).To(MatchError("The following flags may not be specified together: plugin-config, backup-dir, backup-dir-map-file"))
+		})
+		It("runs a restore that does not connect to a database", func() {
+			backupDir, err := ioutil.TempDir("", "temp")
+			Expect(err).ToNot(HaveOccurred())
+			defer os.RemoveAll(backupDir)
+			timestampDir := path.Join(backupDir, "gpseg-1", "backups", timestamp[0:8], timestamp)
+			Expect(os.MkdirAll(timestampDir, 0777)).To(Succeed())
+			metadata := "\n\nCREATE SCHEMA schema1;\n"
+			Expect(ioutil.WriteFile(path.Join(timestampDir, "gpbackup_"+timestamp+"_metadata.sql"), []byte(metadata), 0644)).To(Succeed())
+			backupTOC := &toc.TOC{}
+			backupTOC.InitializeMetadataEntryMap()
+			backupTOC.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "schema1", ObjectType: "SCHEMA"}, 0, uint64(len(metadata)))
+			backupTOC.WriteToFileAndMakeReadOnly(path.Join(timestampDir, "gpbackup_"+timestamp+"_toc.yaml"))
+			history.WriteConfigFile(&history.BackupConfig{BackupVersion: "1.0.0", DatabaseName: "testdb", Timestamp: timestamp, MetadataOnly: true,
+				RestorePlan: []history.RestorePlanEntry{{Timestamp: timestamp, TableFQNs: []string{}}}}, path.Join(timestampDir, "gpbackup_"+timestamp+"_config.yaml"))
+			ddlFile := path.Join(backupDir, "ddl.sql")
+
+			result, err := restore.Run(context.Background(), restore.Config{Flags: map[string][]string{
+				options.TIMESTAMP:      {timestamp},
+				options.BACKUP_DIR:     {backupDir},
+				options.PRINT_DDL:      {"true"},
+				options.PRINT_DDL_FILE: {ddlFile},
+			}})
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(result.Timestamp).To(Equal(timestamp))
+			Expect(result.ErrorTablesMetadata).To(BeEmpty())
+			ddl, err := ioutil.ReadFile(ddlFile)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(ddl)).To(ContainSubstring("CREATE SCHEMA schema1;"))
+		})
+	})
+	Describe("GetExitCode", func() {
+		AfterEach(func() {
+			gplog.SetErrorCode(0)
+		})
+		It("returns the error code of a restore that did not fail", func() {
+			gplog.SetErrorCode(1)
+
+			Expect(restore.GetExitCode(nil)).To(Equal(1))
+		})
+		It("logs an error that was not already logged and returns 2", func() {
+			_, stderr, _ := testhelper.SetupTestLogger()
+
+			Expect(restore.GetExitCode(errors.New("Invalid config file"))).To(Equal(2))
+			Expect(string(stderr.Contents())).To(ContainSubstring("[ERROR]:-Invalid config file"))
+		})
+		It("returns 2 without logging an error for a canceled restore", func() {
+			_, stderr, _ := testhelper.SetupTestLogger()
+
+			Expect(restore.GetExitCode(context.Canceled)).To(Equal(2))
+			Expect(string(stderr.Contents())).To(BeEmpty())
+		})
+	})
+})
@@ -2,11 +2,13 @@ package restore
 
 import (
 	"fmt"
+	"path"
 	"strconv"
 	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/utils"
 	"github.com/pkg/errors"
@@ -17,11 +19,41 @@ import (
  * This file contains functions related to validating user input.
  */
 
+/*
+ * Sets the flags given in the --config file, which must be done before any
+ * other flags are validated, and checks that the required flags were set on
+ * the command line or in the file.
+ */
+func applyConfigFile(flags *pflag.FlagSet) error {
+	err := options.ApplyConfigFile(flags)
+	if err != nil {
+		return err
+	}
+	if !flags.Changed(options.TIMESTAMP) && !flags.Changed(options.REBUILD_HISTORY) && !flags.Changed(options.MIGRATE_FROM_DBNAME) {
+		return errors.Errorf("The --%s flag must be set", options.TIMESTAMP)
+	}
+	return nil
+}
+
+/*
+ * Expands the filter patterns against the relations and schemas in the TOC.
+ * Patterns match unquoted names, while the TOC and the quoted filter lists use
+ * quoted names, so matches are added to the filter lists in their quoted form.
+ */
+func expandFilterPatternsInBackupSet() {
+	if !state.opts.HasFilterPatterns() {
+		return
+	}
+	relations, schemas := state.globalTOC.GetRelationsAndSchemas()
+	err := state.opts.ExpandFilterPatterns(state.cmdFlags, relations, schemas)
+	gplog.FatalOnError(err)
+}
+
 func validateFilterListsInBackupSet() {
-	ValidateIncludeSchemasInBackupSet(opts.IncludedSchemas)
-	ValidateExcludeSchemasInBackupSet(opts.ExcludedSchemas)
-	ValidateIncludeRelationsInBackupSet(opts.IncludedRelations)
-	ValidateExcludeRelationsInBackupSet(opts.ExcludedRelations)
+	ValidateIncludeSchemasInBackupSet(state.opts.IncludedSchemas)
+	ValidateExcludeSchemasInBackupSet(state.opts.ExcludedSchemas)
+	ValidateIncludeRelationsInBackupSet(state.opts.IncludedRelations)
+	ValidateExcludeRelationsInBackupSet(state.opts.ExcludedRelations)
 }
 
 func ValidateIncludeSchemasInBackupSet(schemaList []string) {
@@ -48,8 +80,8 @@ func getFilterSchemasInBackupSet(schemaList []string) []string {
 	for _, schema := range schemaList {
 		schemaMap[schema] = true
 	}
-	if !backupConfig.DataOnly {
-		for _, entry := range globalTOC.PredataEntries {
+	if !state.backupConfig.DataOnly {
+		for _, entry := range state.globalTOC.PredataEntries {
 			if _, ok := schemaMap[entry.Schema]; ok {
 				delete(schemaMap, entry.Schema)
 			}
@@ -58,7 +90,7 @@ func getFilterSchemasInBackupSet(schemaList []string) []string {
 			}
 		}
 	} else {
-		for _, entry := range globalTOC.DataEntries {
+		for _, entry := range state.globalTOC.DataEntries {
 			if _, ok := schemaMap[entry.Schema]; ok {
 				delete(schemaMap, entry.Schema)
 			}
@@ -88,10 +120,10 @@ func GenerateRestoreRelationList(opts options.Options) []string {
 	excludedSchemaSet := utils.NewExcludeSet(opts.ExcludedSchemas)
 	excludedRelationsSet := utils.NewExcludeSet(opts.ExcludedRelations)
 
-	if len(globalTOC.DataEntries) == 0 {
+	if len(state.globalTOC.DataEntries) == 0 {
 		return []string{}
 	}
-	for _, entry := range globalTOC.DataEntries {
+	for _, entry := range state.globalTOC.DataEntries {
 		fqn := utils.MakeFQN(entry.Schema, entry.Name)
 
 		if includedSchemaSet.MatchesFilter(entry.Schema) &&
@@ -123,7 +155,7 @@ WHERE quote_ident(n.nspname) || '.' || quote_ident(c.relname) IN (%s)`, quotedTa
 	 * are not already in the database so we don't get duplicate data.
 	 */
 	var errMsg string
-	if backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY) {
+	if state.backupConfig.DataOnly || MustGetFlagBool(options.DATA_ONLY) {
 		if len(relationsInDB) < len(relationList) {
 			dbRelationsSet := utils.NewSet(relationsInDB)
 			for _, restoreRelation := range relationList {
@@ -170,7 +202,7 @@ func getFilterRelationsInBackupSet(relationList []string) []string {
 	for _, relation := range relationList {
 		relationMap[relation] = true
 	}
-	for _, entry := range globalTOC.PredataEntries {
+	for _, entry := range state.globalTOC.PredataEntries {
 		if entry.ObjectType != "TABLE" && entry.ObjectType != "SEQUENCE" && entry.ObjectType != "VIEW" && entry.ObjectType != "MATERIALIZED VIEW" {
 			continue
 		}
@@ -184,7 +216,7 @@ func getFilterRelationsInBackupSet(relationList []string) []string {
 	}
 
 	dataEntries := make([]string, 0)
-	for _, restorePlanEntry := range backupConfig.RestorePlan {
+	for _, restorePlanEntry := range state.backupConfig.RestorePlan {
 		dataEntries = append(dataEntries, restorePlanEntry.TableFQNs...)
 	}
 	for _, fqn := range dataEntries {
@@ -211,7 +243,7 @@ SELECT CASE
 	WHEN EXISTS (SELECT 1 FROM pg_database WHERE datname='%s') THEN 'true'
 	ELSE 'false'
 END AS string;`, utils.EscapeSingleQuotes(unquotedDBName))
-	databaseExists, err := strconv.ParseBool(dbconn.MustSelectString(connectionPool, qry))
+	databaseExists, err := strconv.ParseBool(dbconn.MustSelectString(state.connectionPool, qry))
 	gplog.FatalOnError(err)
 	if !databaseExists {
 		if isFiltered {
@@ -225,62 +257,257 @@ END AS string;`, utils.EscapeSingleQuotes(unquotedDBName))
 }
 
 func ValidateBackupFlagCombinations() {
-	if backupConfig.SingleDataFile && MustGetFlagInt(options.JOBS) != 1 {
+	if state.backupConfig.Format == options.FORMAT_PLAIN {
+		gplog.Fatal(errors.Errorf("Backup %s was taken with --format %s and cannot be restored with gprestore.  Replay %s with psql instead.",
+			state.backupConfig.Timestamp, options.FORMAT_PLAIN, state.globalFPInfo.GetPlainScriptFilePath()), "")
+	}
+	if state.backupConfig.SingleDataFile && MustGetFlagInt(options.JOBS) != 1 {
 		gplog.Fatal(errors.Errorf("Cannot use jobs flag when restoring backups with a single data file per segment."), "")
 	}
-	if (backupConfig.IncludeTableFiltered || backupConfig.DataOnly) && MustGetFlagBool(options.WITH_GLOBALS) {
+	if (state.backupConfig.IncludeTableFiltered || state.backupConfig.DataOnly) && MustGetFlagBool(options.WITH_GLOBALS) {
 		gplog.Fatal(errors.Errorf("Global metadata is not backed up in table-filtered or data-only backups."), "")
 	}
-	if backupConfig.MetadataOnly && MustGetFlagBool(options.DATA_ONLY) {
+	if state.backupConfig.MetadataOnly && MustGetFlagBool(options.DATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use data-only flag when restoring metadata-only backup"), "")
 	}
-	if backupConfig.DataOnly && MustGetFlagBool(options.METADATA_ONLY) {
+	if state.backupConfig.DataOnly && MustGetFlagBool(options.METADATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use metadata-only flag when restoring data-only backup"), "")
 	}
 	validateBackupFlagPluginCombinations()
 }
 
 func validateBackupFlagPluginCombinations() {
-	if backupConfig.Plugin != "" && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
-		gplog.Fatal(errors.Errorf("Backup was taken with plugin %s. The --plugin-config flag must be used to restore.", backupConfig.Plugin), "")
-	} else if backupConfig.Plugin == "" && MustGetFlagString(options.PLUGIN_CONFIG) != "" {
+	if len(state.backupConfig.Copies) > 0 {
+		validateBackupCopy()
+		return
+	}
+	if state.backupConfig.Plugin != "" && MustGetFlagString(options.PLUGIN_CONFIG) == "" {
+		gplog.Fatal(errors.Errorf("Backup was taken with plugin %s. The --plugin-config flag must be used to restore.", state.backupConfig.Plugin), "")
+	} else if state.backupConfig.Plugin == "" && MustGetFlagString(options.PLUGIN_CONFIG) != "" {
 		gplog.Fatal(errors.Errorf("The --plugin-config flag cannot be used to restore a backup taken without a plugin."), "")
 	}
 }
 
+/*
+ * A backup taken to several destinations may be restored from the copy in
+ * any of them, but not from one whose copy failed during the backup.  The
+ * destination of most plugins is the path of their config, which may have
+ * been moved since the backup, so a plugin config that matches no copy of
+ * the plugin only causes a warning if a copy of the plugin succeeded.
+ */
+func validateBackupCopy() {
+	source := history.BackupCopy{BackupDir: state.globalFPInfo.UserSpecifiedBackupDir}
+	if state.pluginConfig != nil {
+		source = history.BackupCopy{Destination: state.pluginConfig.Destination()}
+		_, source.Plugin = path.Split(state.pluginConfig.ExecutablePath)
+	}
+	sourceName := source.String()
+	if state.pluginConfig == nil && state.globalFPInfo.IsBackupDirMapped() {
+		sourceName = "the mapped backup directories"
+	}
+	matchesSource := func(backupCopy history.BackupCopy) bool {
+		if state.pluginConfig == nil && state.globalFPInfo.IsBackupDirMapped() {
+			// The directories of a backup moved with a map file are not recorded
+			return backupCopy.Plugin == ""
+		}
+		return backupCopy.SameDestination(source)
+	}
+	succeeded := make([]string, 0)
+	succeededWithPlugin := make([]string, 0)
+	copiedToSource := false
+	for _, backupCopy := range state.backupConfig.Copies {
+		if matchesSource(backupCopy) {
+			if backupCopy.Status == history.BackupStatusSucceed {
+				return
+			}
+			copiedToSource = true
+		} else if backupCopy.Status == history.BackupStatusSucceed {
+			succeeded = append(succeeded, backupCopy.String())
+			if state.pluginConfig != nil && backupCopy.Plugin == source.Plugin && backupCopy.BackupDir == "" {
+				succeededWithPlugin = append(succeededWithPlugin, backupCopy.String())
+			}
+		}
+	}
+	if !copiedToSource && len(succeededWithPlugin) > 0 {
+		gplog.Warn("Backup %s was not copied to %s, but was copied to %s.  Restoring it with the plugin config given.",
+			state.globalFPInfo.Timestamp, sourceName, strings.Join(succeededWithPlugin, ", "))
+		return
+	}
+	if len(succeeded) == 0 {
+		gplog.Fatal(errors.Errorf("Every copy of backup %s failed during the backup, so it cannot be restored.", state.globalFPInfo.Timestamp), "")
+	} else if copiedToSource {
+		gplog.Fatal(errors.Errorf("The copy of backup %s in %s failed during the backup.  Restore it from a copy that succeeded: %s.",
+			state.globalFPInfo.Timestamp, sourceName, strings.Join(succeeded, ", ")), "")
+	}
+	gplog.Fatal(errors.Errorf("Backup %s was not copied to %s.  Restore it from one of its copies: %s.",
+		state.globalFPInfo.Timestamp, sourceName, strings.Join(succeeded, ", ")), "")
+}
+
 func ValidateFlagCombinations(flags *pflag.FlagSet) {
+	if flags.Changed(options.REBUILD_HISTORY) {
+		validateRebuildHistoryFlags(flags)
+		return
+	}
+	if flags.Changed(options.COPY_TO_DIR) || flags.Changed(options.COPY_TO_PLUGIN_CONFIG) {
+		validateCopyBackupFlags(flags)
+		return
+	}
+	validateMigrateFlags(flags)
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.WITH_GLOBALS)
 	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.CREATE_DB)
 	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
 
-	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE)
-	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.INCLUDE_SCHEMA)
-	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE)
+	options.CheckExclusiveFlags(flags, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_PATTERN, options.INCLUDE_RELATION, options.INCLUDE_RELATION_FILE, options.INCLUDE_RELATION_PATTERN)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_PATTERN, options.INCLUDE_SCHEMA, options.INCLUDE_SCHEMA_PATTERN)
+	options.CheckExclusiveFlags(flags, options.EXCLUDE_SCHEMA, options.EXCLUDE_SCHEMA_PATTERN, options.EXCLUDE_RELATION, options.INCLUDE_RELATION, options.EXCLUDE_RELATION_FILE, options.INCLUDE_RELATION_FILE, options.EXCLUDE_RELATION_PATTERN, options.INCLUDE_RELATION_PATTERN)
 
 	options.CheckExclusiveFlags(flags, options.METADATA_ONLY, options.DATA_ONLY)
-	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR, options.BACKUP_DIR_MAP_FILE)
+	options.CheckExclusiveFlags(flags, options.INCLUDE_OBJECT_TYPE, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.INCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.DATA_ONLY, options.EXCLUDE_OBJECT_TYPE)
+	options.CheckExclusiveFlags(flags, options.DIFF, options.PRINT_DDL, options.LIST, options.USE_LIST)
+	for _, flag := range []string{options.DATA_ONLY, options.CREATE_DB, options.REDIRECT_DB, options.INCREMENTAL,
+		options.TRUNCATE_TABLE, options.RUN_ANALYZE, options.ON_ERROR_CONTINUE, options.BACKUP_DIR_MAP_FILE} {
+		options.CheckExclusiveFlags(flags, options.PRINT_DDL, flag)
+	}
+	if flags.Changed(options.PRINT_DDL_FILE) && !flags.Changed(options.PRINT_DDL) {
+		gplog.Fatal(errors.Errorf("Cannot use --%s without --%s", options.PRINT_DDL_FILE, options.PRINT_DDL), "")
+	}
+	for _, flag := range []string{options.DATA_ONLY, options.CREATE_DB, options.INCREMENTAL, options.TRUNCATE_TABLE,
+		options.RUN_ANALYZE, options.ON_ERROR_CONTINUE, options.REDIRECT_SCHEMA, options.REDIRECT_TABLE} {
+		options.CheckExclusiveFlags(flags, options.DIFF, flag)
+	}
+	if flags.Changed(options.DIFF_TIMESTAMP) {
+		if !flags.Changed(options.DIFF) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s without --%s", options.DIFF_TIMESTAMP, options.DIFF), "")
+		}
+		options.CheckExclusiveFlags(flags, options.DIFF_TIMESTAMP, options.REDIRECT_DB)
+		options.CheckExclusiveFlags(flags, options.DIFF_TIMESTAMP, options.BACKUP_DIR_MAP_FILE)
+	}
+	if flags.Changed(options.DIFF_FORMAT) {
+		if !flags.Changed(options.DIFF) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s without --%s", options.DIFF_FORMAT, options.DIFF), "")
+		}
+		diffFormat, _ := flags.GetString(options.DIFF_FORMAT)
+		if diffFormat != options.DIFF_FORMAT_TEXT && diffFormat != options.DIFF_FORMAT_JSON {
+			gplog.Fatal(errors.Errorf("Invalid diff format %s.  Valid formats are %s and %s.", diffFormat, options.DIFF_FORMAT_TEXT, options.DIFF_FORMAT_JSON), "")
+		}
+	}
 
 	if flags.Changed(options.REDIRECT_SCHEMA) {
 		// Redirect schema not compatible with any exclude flags and include schema flags
-		if flags.Changed(options.EXCLUDE_SCHEMA) || flags.Changed(options.EXCLUDE_SCHEMA_FILE) ||
-			flags.Changed(options.EXCLUDE_RELATION) || flags.Changed(options.EXCLUDE_RELATION_FILE) ||
-			flags.Changed(options.INCLUDE_SCHEMA) || flags.Changed(options.INCLUDE_SCHEMA_FILE) {
+		if flags.Changed(options.EXCLUDE_SCHEMA) || flags.Changed(options.EXCLUDE_SCHEMA_FILE) || flags.Changed(options.EXCLUDE_SCHEMA_PATTERN) ||
+			flags.Changed(options.EXCLUDE_RELATION) || flags.Changed(options.EXCLUDE_RELATION_FILE) || flags.Changed(options.EXCLUDE_RELATION_PATTERN) ||
+			flags.Changed(options.INCLUDE_SCHEMA) || flags.Changed(options.INCLUDE_SCHEMA_FILE) || flags.Changed(options.INCLUDE_SCHEMA_PATTERN) {
 			gplog.Fatal(errors.Errorf("Cannot use --redirect-schema with exclude flags or include schema flags"), "")
 		}
 		// Redirect schema requires include relation
-		if !(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) {
-			gplog.Fatal(errors.Errorf("Cannot use --redirect-schema without --include-table or --include-table-file"), "")
+		if !(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE) || flags.Changed(options.INCLUDE_RELATION_PATTERN)) {
+			gplog.Fatal(errors.Errorf("Cannot use --redirect-schema without --include-table, --include-table-file, or --include-table-pattern"), "")
+		}
+	}
+	if flags.Changed(options.REDIRECT_TABLE) {
+		// Redirect table renames the one table being restored
+		if flags.Changed(options.EXCLUDE_SCHEMA) || flags.Changed(options.EXCLUDE_SCHEMA_FILE) || flags.Changed(options.EXCLUDE_SCHEMA_PATTERN) ||
+			flags.Changed(options.EXCLUDE_RELATION) || flags.Changed(options.EXCLUDE_RELATION_FILE) || flags.Changed(options.EXCLUDE_RELATION_PATTERN) ||
+			flags.Changed(options.INCLUDE_SCHEMA) || flags.Changed(options.INCLUDE_SCHEMA_FILE) || flags.Changed(options.INCLUDE_SCHEMA_PATTERN) ||
+			flags.Changed(options.INCLUDE_RELATION_FILE) || flags.Changed(options.INCLUDE_RELATION_PATTERN) {
+			gplog.Fatal(errors.Errorf("Cannot use --redirect-table with exclude flags, include schema flags, --include-table-file, or --include-table-pattern"), "")
+		}
+		if includedRelations, _ := flags.GetStringArray(options.INCLUDE_RELATION); len(includedRelations) != 1 {
+			gplog.Fatal(errors.Errorf("Cannot use --redirect-table without exactly one --include-table"), "")
 		}
 	}
 	options.CheckExclusiveFlags(flags,
 		options.TRUNCATE_TABLE, options.METADATA_ONLY, options.INCREMENTAL, options.REDIRECT_SCHEMA)
+	options.CheckExclusiveFlags(flags, options.TRUNCATE_TABLE, options.INCREMENTAL, options.REDIRECT_TABLE)
 	if flags.Changed(options.TRUNCATE_TABLE) &&
-		!(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE)) &&
+		!(flags.Changed(options.INCLUDE_RELATION) || flags.Changed(options.INCLUDE_RELATION_FILE) || flags.Changed(options.INCLUDE_RELATION_PATTERN)) &&
 		!flags.Changed(options.DATA_ONLY) {
-		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table or --include-table-file and without --data-only"), "")
+		gplog.Fatal(errors.Errorf("Cannot use --truncate-table without --include-table, --include-table-file, or --include-table-pattern and without --data-only"), "")
 	}
 	if flags.Changed(options.INCREMENTAL) && !flags.Changed(options.DATA_ONLY) {
 		gplog.Fatal(errors.Errorf("Cannot use --incremental without --data-only"), "")
 	}
 	options.CheckExclusiveFlags(flags, options.RUN_ANALYZE, options.WITH_STATS)
 }
+
+// Rebuilding the history only reads the backups stored through the plugin
+func validateRebuildHistoryFlags(flags *pflag.FlagSet) {
+	if !flags.Changed(options.PLUGIN_CONFIG) {
+		gplog.Fatal(errors.Errorf("Cannot use --%s without --%s", options.REBUILD_HISTORY, options.PLUGIN_CONFIG), "")
+	}
+	allowedFlags := map[string]bool{
+		options.REBUILD_HISTORY: true,
+		options.PLUGIN_CONFIG:   true,
+		options.CONFIG:          true,
+		options.CONFIG_PROFILE:  true,
+		options.TIMEOUT:         true,
+		options.DEBUG:           true,
+		options.QUIET:           true,
+		options.VERBOSE:         true,
+	}
+	flags.Visit(func(flag *pflag.Flag) {
+		if !allowedFlags[flag.Name] {
+			gplog.Fatal(errors.Errorf("Cannot use --%s with --%s", flag.Name, options.REBUILD_HISTORY), "")
+		}
+	})
+	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
+}
+
+/*
+ * A migration generates the metadata it restores instead of reading a backup,
+ * and a COPY that fails aborts the transaction the data of the other tables
+ * is copied out of the database to migrate in, so restoring cannot continue.
+ */
+func validateMigrateFlags(flags *pflag.FlagSet) {
+	if !flags.Changed(options.MIGRATE_FROM_DBNAME) {
+		for _, flag := range []string{options.MIGRATE_FROM_HOST, options.MIGRATE_FROM_PORT} {
+			if flags.Changed(flag) {
+				gplog.Fatal(errors.Errorf("Cannot use --%s without --%s", flag, options.MIGRATE_FROM_DBNAME), "")
+			}
+		}
+		return
+	}
+	for _, flag := range []string{options.TIMESTAMP, options.BACKUP_DIR, options.BACKUP_DIR_MAP_FILE, options.PLUGIN_CONFIG, options.INCREMENTAL,
+		options.WITH_STATS, options.ON_ERROR_CONTINUE, options.LIST, options.USE_LIST, options.DIFF, options.PRINT_DDL} {
+		if flags.Changed(flag) {
+			gplog.Fatal(errors.Errorf("Cannot use --%s with --%s", flag, options.MIGRATE_FROM_DBNAME), "")
+		}
+	}
+}
+
+// Copying a backup only reads it from its backup directory or plugin
+func validateCopyBackupFlags(flags *pflag.FlagSet) {
+	options.CheckExclusiveFlags(flags, options.COPY_TO_DIR, options.COPY_TO_PLUGIN_CONFIG)
+	options.CheckExclusiveFlags(flags, options.PLUGIN_CONFIG, options.BACKUP_DIR)
+	options.CheckExclusiveFlags(flags, options.DEBUG, options.QUIET, options.VERBOSE)
+	allowedFlags := map[string]bool{
+		options.COPY_TO_DIR:           true,
+		options.COPY_TO_PLUGIN_CONFIG: true,
+		options.TIMESTAMP:             true,
+		options.BACKUP_DIR:            true,
+		options.PLUGIN_CONFIG:         true,
+		options.CONFIG:                true,
+		options.CONFIG_PROFILE:        true,
+		options.TIMEOUT:               true,
+		options.DEBUG:                 true,
+		options.QUIET:                 true,
+		options.VERBOSE:               true,
+	}
+	copyFlag := options.COPY_TO_DIR
+	if flags.Changed(options.COPY_TO_PLUGIN_CONFIG) {
+		copyFlag = options.COPY_TO_PLUGIN_CONFIG
+	}
+	flags.Visit(func(flag *pflag.Flag) {
+		if !allowedFlags[flag.Name] {
+			gplog.Fatal(errors.Errorf("Cannot use --%s with --%s", flag.Name, copyFlag), "")
+		}
+	})
+	sourcePluginConfig, _ := flags.GetString(options.PLUGIN_CONFIG)
+	destinationPluginConfig, _ := flags.GetString(options.COPY_TO_PLUGIN_CONFIG)
+	if sourcePluginConfig != "" && sourcePluginConfig == destinationPluginConfig {
+		gplog.Fatal(errors.Errorf("Cannot copy a backup to the plugin config it is read with"), "")
+	}
+}
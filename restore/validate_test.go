@@ -3,6 +3,7 @@ package restore_test
 import (
 	"github.com/DATA-DOG/go-sqlmock"
 	"github.com/greenplum-db/gp-common-go-libs/testhelper"
+	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/greenplum-db/gpbackup/history"
 	"github.com/greenplum-db/gpbackup/options"
 	"github.com/greenplum-db/gpbackup/restore"
@@ -32,10 +33,10 @@ var _ = Describe("restore/validate tests", func() {
 			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "predata")
 			backupfile.ByteCount = table1Len
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "table1", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", "", nil)
 			backupfile.ByteCount += table2Len
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}, table1Len, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "", "", nil)
 			backupfile.ByteCount += sequenceLen
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "somesequence", ObjectType: "SEQUENCE"}, table1Len+table2Len, backupfile.ByteCount)
 			restore.SetTOC(tocfile)
@@ -74,10 +75,10 @@ var _ = Describe("restore/validate tests", func() {
 		var opts *options.Options
 		BeforeEach(func() {
 			tocfile, _ = testutils.InitializeTestTOC(buffer, "metadata")
-			tocfile.AddMasterDataEntry("s1", "table1", 1, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s1", "table2", 2, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s2", "table1", 3, "(j)", 0, "")
-			tocfile.AddMasterDataEntry("s2", "table2", 4, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("s1", "table1", 1, "(j)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("s1", "table2", 2, "(j)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("s2", "table1", 3, "(j)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("s2", "table2", 4, "(j)", 0, "", "", nil)
 			restore.SetTOC(tocfile)
 
 			opts = &options.Options{}
@@ -195,10 +196,10 @@ var _ = Describe("restore/validate tests", func() {
 		BeforeEach(func() {
 			tocfile, backupfile = testutils.InitializeTestTOC(buffer, "predata")
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "table1", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", "", nil)
 
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema2", Name: "table2", ObjectType: "TABLE"}, 0, backupfile.ByteCount)
-			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "")
+			tocfile.AddMasterDataEntry("schema2", "table2", 2, "(j)", 0, "", "", nil)
 
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "somesequence", ObjectType: "SEQUENCE"}, 0, backupfile.ByteCount)
 			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema1", Name: "someview", ObjectType: "VIEW"}, 0, backupfile.ByteCount)
@@ -291,4 +292,65 @@ var _ = Describe("restore/validate tests", func() {
 			restore.ValidateDatabaseExistence("testdb", false, false)
 		})
 	})
+	Describe("ValidateBackupFlagCombinations", func() {
+		It("panics when restoring a plain format backup", func() {
+			restore.SetBackupConfig(&history.BackupConfig{Timestamp: "20170101010101", Format: options.FORMAT_PLAIN})
+			restore.SetFPInfo(filepath.FilePathInfo{SegDirMap: map[int]string{-1: "/data/gpseg-1"}, Timestamp: "20170101010101"})
+			defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 was taken with --format plain and cannot be restored with gprestore.  Replay /data/gpseg-1/backups/20170101/20170101010101/gpbackup_20170101010101_script.sql with psql instead.")
+			restore.ValidateBackupFlagCombinations()
+		})
+		Context("backups with several copies", func() {
+			BeforeEach(func() {
+				restore.SetBackupConfig(&history.BackupConfig{Timestamp: "20170101010101", Plugin: "s3_plugin", Copies: []history.BackupCopy{
+					{BackupDir: "/nfs/backups", Status: history.BackupStatusSucceed},
+					{Plugin: "s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusFailed},
+					{Plugin: "s3_plugin", Destination: "/home/gpadmin/s3_offsite.yaml", Status: history.BackupStatusSucceed},
+					{Plugin: "ddboost_plugin", Status: history.BackupStatusSucceed},
+				}})
+				restore.SetFPInfo(filepath.FilePathInfo{Timestamp: "20170101010101", UserSpecifiedBackupDir: "/nfs/backups"})
+				restore.SetPluginConfig(nil)
+			})
+			It("restores from the backup directory without a plugin", func() {
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("panics when the backup was not copied to the backup directory", func() {
+				restore.SetFPInfo(filepath.FilePathInfo{Timestamp: "20170101010101", UserSpecifiedBackupDir: "/data/backups"})
+				defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 was not copied to backup directory /data/backups.  Restore it from one of its copies: backup directory /nfs/backups, plugin s3_plugin at /home/gpadmin/s3_offsite.yaml, plugin ddboost_plugin.")
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("restores from a plugin whose copy succeeded", func() {
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/ddboost_plugin", ConfigPath: "/home/gpadmin/ddboost.yaml"})
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("restores from the destination of a plugin whose copy succeeded", func() {
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/s3_plugin", ConfigPath: "/home/gpadmin/s3_offsite.yaml"})
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("panics when the copy with the plugin failed", func() {
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/s3_plugin", ConfigPath: "/home/gpadmin/s3.yaml"})
+				defer testhelper.ShouldPanicWithMessage("The copy of backup 20170101010101 in plugin s3_plugin at /home/gpadmin/s3.yaml failed during the backup.  Restore it from a copy that succeeded: backup directory /nfs/backups, plugin s3_plugin at /home/gpadmin/s3_offsite.yaml, plugin ddboost_plugin.")
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("warns when the backup was not copied to the destination of the plugin but another copy of the plugin succeeded", func() {
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/s3_plugin", ConfigPath: "/home/gpadmin/moved/s3_offsite.yaml"})
+				restore.ValidateBackupFlagCombinations()
+				Expect(string(logfile.Contents())).To(ContainSubstring("Backup 20170101010101 was not copied to plugin s3_plugin at /home/gpadmin/moved/s3_offsite.yaml, " +
+					"but was copied to plugin s3_plugin at /home/gpadmin/s3_offsite.yaml.  Restoring it with the plugin config given."))
+			})
+			It("panics when the backup was not copied to the destination of the plugin and every copy of the plugin failed", func() {
+				restore.SetBackupConfig(&history.BackupConfig{Timestamp: "20170101010101", Plugin: "s3_plugin", Copies: []history.BackupCopy{
+					{BackupDir: "/nfs/backups", Status: history.BackupStatusSucceed},
+					{Plugin: "s3_plugin", Destination: "/home/gpadmin/s3.yaml", Status: history.BackupStatusFailed},
+				}})
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/s3_plugin", ConfigPath: "/home/gpadmin/s3_other.yaml"})
+				defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 was not copied to plugin s3_plugin at /home/gpadmin/s3_other.yaml.  Restore it from one of its copies: backup directory /nfs/backups.")
+				restore.ValidateBackupFlagCombinations()
+			})
+			It("panics when the backup was not copied with the plugin", func() {
+				restore.SetPluginConfig(&utils.PluginConfig{ExecutablePath: "/usr/local/bin/gcs_plugin", ConfigPath: "/home/gpadmin/gcs.yaml"})
+				defer testhelper.ShouldPanicWithMessage("Backup 20170101010101 was not copied to plugin gcs_plugin at /home/gpadmin/gcs.yaml.  Restore it from one of its copies: backup directory /nfs/backups, plugin s3_plugin at /home/gpadmin/s3_offsite.yaml, plugin ddboost_plugin.")
+				restore.ValidateBackupFlagCombinations()
+			})
+		})
+	})
 })
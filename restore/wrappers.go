@@ -2,7 +2,6 @@ package restore
 
 import (
 	"fmt"
-	path "path/filepath"
 	"strconv"
 	"strings"
 
@@ -52,7 +51,10 @@ func filtersEmpty(filters Filters) bool {
 }
 
 func SetLoggerVerbosity() {
-	if MustGetFlagBool(options.QUIET) {
+	// Only errors are logged with --list, so that its output can be used as a list file,
+	// and likewise with --diff and with --print-ddl when the statements are printed to stdout
+	isPrintingDDLToStdout := MustGetFlagBool(options.PRINT_DDL) && MustGetFlagString(options.PRINT_DDL_FILE) == ""
+	if MustGetFlagBool(options.QUIET) || MustGetFlagBool(options.LIST) || MustGetFlagBool(options.DIFF) || isPrintingDDLToStdout {
 		gplog.SetVerbosity(gplog.LOGERROR)
 	} else if MustGetFlagBool(options.DEBUG) {
 		gplog.SetVerbosity(gplog.LOGDEBUG)
@@ -62,9 +64,9 @@ func SetLoggerVerbosity() {
 }
 
 func CreateConnectionPool(unquotedDBName string) {
-	connectionPool = dbconn.NewDBConnFromEnvironment(unquotedDBName)
-	connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
-	utils.ValidateGPDBVersionCompatibility(connectionPool)
+	state.connectionPool = dbconn.NewDBConnFromEnvironment(unquotedDBName)
+	state.connectionPool.MustConnect(MustGetFlagInt(options.JOBS))
+	utils.ValidateGPDBVersionCompatibility(state.connectionPool)
 }
 
 func InitializeConnectionPool(backupTimestamp string, restoreTimestamp string, unquotedDBName string) {
@@ -79,16 +81,16 @@ SET client_min_messages = error;
 SET standard_conforming_strings = on;
 SET default_with_oids = off;
 `
-	if connectionPool.Version.Is("4") {
+	if state.connectionPool.Version.Is("4") {
 		setupQuery += "SET gp_strict_xml_parse = off;\n"
 	}
-	if connectionPool.Version.AtLeast("5") {
+	if state.connectionPool.Version.AtLeast("5") {
 		setupQuery += "SET gp_ignore_error_table = on;\n"
 	}
-	if connectionPool.Version.Before("6") {
+	if state.connectionPool.Version.Before("6") {
 		setupQuery += "SET allow_system_table_mods = 'DML';\n"
 	}
-	if connectionPool.Version.AtLeast("6") {
+	if state.connectionPool.Version.AtLeast("6") {
 		setupQuery += "SET allow_system_table_mods = true;\n"
 		setupQuery += "SET lock_timeout = 0;\n"
 		setupQuery += "SET default_transaction_read_only = off;\n"
@@ -96,7 +98,7 @@ SET default_with_oids = off;
 		// If the backup is from a GPDB version less than 6.0,
 		// we need to use legacy hash operators when restoring
 		// the tables.
-		backupConfigMajorVer, _ := strconv.Atoi(strings.Split(backupConfig.DatabaseVersion, ".")[0])
+		backupConfigMajorVer, _ := strconv.Atoi(strings.Split(state.backupConfig.DatabaseVersion, ".")[0])
 		if backupConfigMajorVer < 6 {
 			setupQuery += "SET gp_use_legacy_hashops = on;\n"
 			gplog.Warn("This backup set was taken on a version of Greenplum prior to 6.x. This restore will use the legacy hash operators when loading data.")
@@ -104,14 +106,14 @@ SET default_with_oids = off;
 			gplog.Warn("For more information, refer to the migration guide located as https://docs.greenplum.org/latest/install_guide/migrate.html.")
 		}
 	}
-	setupQuery += SetMaxCsvLineLengthQuery(connectionPool)
+	setupQuery += SetMaxCsvLineLengthQuery(state.connectionPool)
 
 	// Always disable gp_autostats_mode to prevent automatic ANALYZE
 	// during COPY FROM SEGMENT. ANALYZE should be run separately.
 	setupQuery += "SET gp_autostats_mode = 'none';\n"
 
-	for i := 0; i < connectionPool.NumConns; i++ {
-		connectionPool.MustExec(setupQuery, i)
+	for i := 0; i < state.connectionPool.NumConns; i++ {
+		state.connectionPool.MustExec(setupQuery, i)
 	}
 }
 
@@ -133,31 +135,33 @@ func SetMaxCsvLineLengthQuery(connectionPool *dbconn.DBConn) string {
 }
 
 func InitializeBackupConfig() {
-	backupConfig = history.ReadConfigFile(globalFPInfo.GetConfigFilePath())
-	utils.InitializePipeThroughParameters(backupConfig.Compressed, 0)
-	report.EnsureBackupVersionCompatibility(backupConfig.BackupVersion, version)
-	report.EnsureDatabaseVersionCompatibility(backupConfig.DatabaseVersion, connectionPool.Version)
+	state.backupConfig = history.ReadConfigFile(state.globalFPInfo.GetConfigFilePath())
+	utils.InitializePipeThroughParameters(state.backupConfig.Compressed, 0)
+	report.EnsureBackupVersionCompatibility(state.backupConfig.BackupVersion, version)
+	report.EnsureDatabaseVersionCompatibility(state.backupConfig.DatabaseVersion, state.connectionPool.Version)
 }
 
 func BackupConfigurationValidation() {
-	if !backupConfig.MetadataOnly {
+	// A migration only writes its metadata to the master data directory
+	if !state.backupConfig.MetadataOnly && !isMigrateMode() {
 		gplog.Verbose("Gathering information on backup directories")
 		VerifyBackupDirectoriesExistOnAllHosts()
 	}
 
 	VerifyMetadataFilePaths(MustGetFlagBool(options.WITH_STATS))
 
-	tocFilename := globalFPInfo.GetTOCFilePath()
-	globalTOC = toc.NewTOC(tocFilename)
-	globalTOC.InitializeMetadataEntryMap()
+	tocFilename := state.globalFPInfo.GetTOCFilePath()
+	state.globalTOC = toc.NewTOC(tocFilename)
+	state.globalTOC.InitializeMetadataEntryMap()
 
 	// Legacy backups prior to the incremental feature would have no restoreplan yaml element
-	if isLegacyBackup := backupConfig.RestorePlan == nil; isLegacyBackup {
-		SetRestorePlanForLegacyBackup(globalTOC, globalFPInfo.Timestamp, backupConfig)
+	if isLegacyBackup := state.backupConfig.RestorePlan == nil; isLegacyBackup {
+		SetRestorePlanForLegacyBackup(state.globalTOC, state.globalFPInfo.Timestamp, state.backupConfig)
 	}
 
 	ValidateBackupFlagCombinations()
 
+	expandFilterPatternsInBackupSet()
 	validateFilterListsInBackupSet()
 }
 
@@ -174,45 +178,44 @@ func SetRestorePlanForLegacyBackup(toc *toc.TOC, backupTimestamp string, backupC
 
 func RecoverMetadataFilesUsingPlugin() {
 	var err error
-	pluginConfig, err = utils.ReadPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG))
+	state.pluginConfig, err = utils.ReadPluginConfig(MustGetFlagString(options.PLUGIN_CONFIG))
 	gplog.FatalOnError(err)
-	configFilename := path.Base(pluginConfig.ConfigPath)
-	configDirname := path.Dir(pluginConfig.ConfigPath)
-	pluginConfig.ConfigPath = path.Join(configDirname, history.CurrentTimestamp()+"_"+configFilename)
-	_ = cmdFlags.Set(options.PLUGIN_CONFIG, pluginConfig.ConfigPath)
-	gplog.Info("plugin config path: %s", pluginConfig.ConfigPath)
+	state.pluginConfig.SetContext(state.runCtx)
+	state.pluginConfig.SetHostConfigPath(history.CurrentTimestamp())
+	_ = state.cmdFlags.Set(options.PLUGIN_CONFIG, state.pluginConfig.ConfigPath)
+	gplog.Info("plugin config path: %s", state.pluginConfig.ConfigPath)
 
-	pluginConfig.CheckPluginExistsOnAllHosts(globalCluster)
+	state.pluginConfig.CheckPluginExistsOnAllHosts(state.globalCluster)
 
 	timestamp := MustGetFlagString(options.TIMESTAMP)
 	historicalPluginVersion := FindHistoricalPluginVersion(timestamp)
-	pluginConfig.SetBackupPluginVersion(timestamp, historicalPluginVersion)
+	state.pluginConfig.SetBackupPluginVersion(timestamp, historicalPluginVersion)
 
-	pluginConfig.CopyPluginConfigToAllHosts(globalCluster)
-	pluginConfig.SetupPluginForRestore(globalCluster, globalFPInfo)
+	state.pluginConfig.CopyPluginConfigToAllHosts(state.globalCluster)
+	state.pluginConfig.SetupPluginForRestore(state.globalCluster, state.globalFPInfo)
 
-	metadataFiles := []string{globalFPInfo.GetConfigFilePath(), globalFPInfo.GetMetadataFilePath(),
-		globalFPInfo.GetBackupReportFilePath()}
+	metadataFiles := []string{state.globalFPInfo.GetConfigFilePath(), state.globalFPInfo.GetMetadataFilePath(),
+		state.globalFPInfo.GetBackupReportFilePath()}
 	if MustGetFlagBool(options.WITH_STATS) {
-		metadataFiles = append(metadataFiles, globalFPInfo.GetStatisticsFilePath())
+		metadataFiles = append(metadataFiles, state.globalFPInfo.GetStatisticsFilePath())
 	}
 	for _, filename := range metadataFiles {
-		pluginConfig.MustRestoreFile(filename)
+		state.pluginConfig.MustRestoreFile(filename)
 	}
 
 	InitializeBackupConfig()
 
 	var fpInfoList []filepath.FilePathInfo
-	if backupConfig.MetadataOnly {
-		fpInfoList = []filepath.FilePathInfo{globalFPInfo}
+	if state.backupConfig.MetadataOnly {
+		fpInfoList = []filepath.FilePathInfo{state.globalFPInfo}
 	} else {
 		fpInfoList = GetBackupFPInfoListFromRestorePlan()
 	}
 
 	for _, fpInfo := range fpInfoList {
-		pluginConfig.MustRestoreFile(fpInfo.GetTOCFilePath())
-		if backupConfig.SingleDataFile {
-			pluginConfig.RestoreSegmentTOCs(globalCluster, fpInfo)
+		state.pluginConfig.MustRestoreFile(fpInfo.GetTOCFilePath())
+		if state.backupConfig.SingleDataFile {
+			state.pluginConfig.RestoreSegmentTOCs(state.globalCluster, fpInfo)
 		}
 	}
 }
@@ -224,8 +227,8 @@ func FindHistoricalPluginVersion(timestamp string) string {
 
 	// adapted from incremental GetLatestMatchingBackupTimestamp
 	var historicalPluginVersion string
-	if iohelper.FileExistsAndIsReadable(globalFPInfo.GetBackupHistoryFilePath()) {
-		hist, err := history.NewHistory(globalFPInfo.GetBackupHistoryFilePath())
+	if iohelper.FileExistsAndIsReadable(state.globalFPInfo.GetBackupHistoryFilePath()) {
+		hist, err := history.NewHistory(state.globalFPInfo.GetBackupHistoryFilePath())
 		gplog.FatalOnError(err)
 		foundBackupConfig := hist.FindBackupConfig(timestamp)
 		if foundBackupConfig != nil {
@@ -248,6 +251,13 @@ func GetRestoreMetadataStatements(section string, filename string, includeObject
 func GetRestoreMetadataStatementsFiltered(section string, filename string, includeObjectTypes []string, excludeObjectTypes []string, filters Filters) []toc.StatementWithType {
 	metadataFile := iohelper.MustOpenFileForReading(filename)
 	var statements []toc.StatementWithType
+	inSchemas, exSchemas, inRelations, exRelations := getFilterLists(includeObjectTypes, filters)
+	statements = state.globalTOC.GetSQLStatementForObjectTypes(section, metadataFile, includeObjectTypes, excludeObjectTypes, inSchemas, exSchemas, inRelations, exRelations)
+	return statements
+}
+
+// Returns the schema and relation lists to filter TOC entries of the given object types with
+func getFilterLists(includeObjectTypes []string, filters Filters) ([]string, []string, []string, []string) {
 	var inSchemas, exSchemas, inRelations, exRelations []string
 	if !filtersEmpty(filters) {
 		inSchemas = filters.includeSchemas
@@ -273,8 +283,16 @@ func GetRestoreMetadataStatementsFiltered(section string, filename string, inclu
 			exRelations = nil
 		}
 	}
-	statements = globalTOC.GetSQLStatementForObjectTypes(section, metadataFile, includeObjectTypes, excludeObjectTypes, inSchemas, exSchemas, inRelations, exRelations)
-	return statements
+	return inSchemas, exSchemas, inRelations, exRelations
+}
+
+/*
+ * Applies --include-object-type and --exclude-object-type, which unlike the
+ * object types passed to GetRestoreMetadataStatements also match the ACL,
+ * COMMENT, OWNER, and SECURITY LABEL pseudo types.
+ */
+func FilterStatementsByUserObjectTypes(statements []toc.StatementWithType) []toc.StatementWithType {
+	return toc.FilterStatementsByObjectType(statements, state.opts.IncludedObjectTypes, state.opts.ExcludedObjectTypes)
 }
 
 func ExecuteRestoreMetadataStatements(statements []toc.StatementWithType, objectsTitle string, progressBar utils.ProgressBar, showProgressBar int, executeInParallel bool) {
@@ -287,19 +305,21 @@ func ExecuteRestoreMetadataStatements(statements []toc.StatementWithType, object
 
 func GetBackupFPInfoListFromRestorePlan() []filepath.FilePathInfo {
 	fpInfoList := make([]filepath.FilePathInfo, 0)
-	for _, entry := range backupConfig.RestorePlan {
-		segPrefix := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), entry.Timestamp)
-
-		fpInfo := filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), entry.Timestamp, segPrefix)
-		fpInfoList = append(fpInfoList, fpInfo)
+	for _, entry := range state.backupConfig.RestorePlan {
+		fpInfoList = append(fpInfoList, GetBackupFPInfoForTimestamp(entry.Timestamp))
 	}
 
 	return fpInfoList
 }
 
 func GetBackupFPInfoForTimestamp(timestamp string) filepath.FilePathInfo {
+	if state.backupDirMap != nil {
+		fpInfo := filepath.NewFilePathInfo(state.globalCluster, "", timestamp, "")
+		fpInfo.BackupDirMap = state.backupDirMap
+		return fpInfo
+	}
 	segPrefix := filepath.ParseSegPrefix(MustGetFlagString(options.BACKUP_DIR), timestamp)
-	fpInfo := filepath.NewFilePathInfo(globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
+	fpInfo := filepath.NewFilePathInfo(state.globalCluster, MustGetFlagString(options.BACKUP_DIR), timestamp, segPrefix)
 	return fpInfo
 }
 
@@ -311,7 +331,7 @@ func GetBackupFPInfoForTimestamp(timestamp string) filepath.FilePathInfo {
 func setGUCsForConnection(gucStatements []toc.StatementWithType, whichConn int) []toc.StatementWithType {
 	if gucStatements == nil {
 		objectTypes := []string{"SESSION GUCS"}
-		gucStatements = GetRestoreMetadataStatements("global", globalFPInfo.GetMetadataFilePath(), objectTypes, []string{})
+		gucStatements = GetRestoreMetadataStatements("global", state.globalFPInfo.GetMetadataFilePath(), objectTypes, []string{})
 	}
 	ExecuteStatementsAndCreateProgressBar(gucStatements, "", utils.PB_NONE, false, whichConn)
 	return gucStatements
@@ -320,7 +340,7 @@ func setGUCsForConnection(gucStatements []toc.StatementWithType, whichConn int)
 func RestoreSchemas(schemaStatements []toc.StatementWithType, progressBar utils.ProgressBar) {
 	numErrors := 0
 	for _, schema := range schemaStatements {
-		_, err := connectionPool.Exec(schema.Statement, 0)
+		_, err := state.connectionPool.Exec(schema.Statement, 0)
 		if err != nil {
 			if strings.Contains(err.Error(), "already exists") {
 				gplog.Warn("Schema %s already exists", schema.Name)
@@ -356,7 +376,7 @@ func GetExistingTableFQNs() ([]string, error) {
 				 AND n.nspname !~ '^pg_toast'
 			  ORDER BY 1;`
 
-	err := connectionPool.Select(&existingTableFQNs, query)
+	err := state.connectionPool.Select(&existingTableFQNs, query)
 	return existingTableFQNs, err
 }
 
@@ -368,12 +388,12 @@ func GetExistingSchemas() ([]string, error) {
 			  WHERE n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'
 			  ORDER BY 1;`
 
-	err := connectionPool.Select(&existingSchemas, query)
+	err := state.connectionPool.Select(&existingSchemas, query)
 	return existingSchemas, err
 }
 
 func TruncateTable(tableFQN string, whichConn int) error {
 	gplog.Verbose("Truncating table %s prior to restoring data", tableFQN)
-	_, err := connectionPool.Exec(`TRUNCATE ` + tableFQN, whichConn)
+	_, err := state.connectionPool.Exec(`TRUNCATE ` + tableFQN, whichConn)
 	return err
 }
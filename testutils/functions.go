@@ -1,6 +1,7 @@
 package testutils
 
 import (
+	"bytes"
 	"fmt"
 	"io"
 	"os"
@@ -382,6 +383,40 @@ func AssertBufferContents(entries []toc.MetadataEntry, buffer *Buffer, expected
 	}
 }
 
+/*
+ * Records the names printed to the buffer in the TOC as a backup does, then
+ * reads the statements of the section back and redirects them as a restore
+ * does.
+ */
+func redirectInBuffer(tocfile *toc.TOC, backupfile *utils.FileWithByteCount, buffer *Buffer, section string, redirect func([]toc.StatementWithType) []toc.StatementWithType) []string {
+	tocfile.RecordIdentifierReferences(section, backupfile.References())
+	statements := tocfile.GetSQLStatementForObjectTypes(section, bytes.NewReader(buffer.Contents()), []string{}, []string{}, []string{}, []string{}, []string{}, []string{})
+	statements = redirect(statements)
+	redirected := make([]string, 0)
+	for _, statement := range statements {
+		redirected = append(redirected, strings.TrimSpace(statement.Statement))
+	}
+	return redirected
+}
+
+func RedirectSchemaInBuffer(tocfile *toc.TOC, backupfile *utils.FileWithByteCount, buffer *Buffer, section string, redirectSchema string) []string {
+	return redirectInBuffer(tocfile, backupfile, buffer, section, func(statements []toc.StatementWithType) []toc.StatementWithType {
+		return toc.RedirectSchemaInStatements(statements, redirectSchema)
+	})
+}
+
+func RedirectTableInBuffer(tocfile *toc.TOC, backupfile *utils.FileWithByteCount, buffer *Buffer, section string, schema string, oldName string, newName string) []string {
+	return redirectInBuffer(tocfile, backupfile, buffer, section, func(statements []toc.StatementWithType) []toc.StatementWithType {
+		return toc.RedirectTableInStatements(statements, schema, oldName, newName)
+	})
+}
+
+func RedirectDatabaseInBuffer(tocfile *toc.TOC, backupfile *utils.FileWithByteCount, buffer *Buffer, section string, oldName string, newName string) []string {
+	return redirectInBuffer(tocfile, backupfile, buffer, section, func(statements []toc.StatementWithType) []toc.StatementWithType {
+		return toc.SubstituteRedirectDatabaseInStatements(statements, oldName, newName)
+	})
+}
+
 func ExpectEntry(entries []toc.MetadataEntry, index int, schema, referenceObject, name, objectType string) {
 	Expect(len(entries)).To(BeNumerically(">", index))
 	structmatcher.ExpectStructsToMatchExcluding(entries[index], toc.MetadataEntry{Schema: schema, Name: name, ObjectType: objectType, ReferenceObject: referenceObject, StartByte: 0, EndByte: 0}, "StartByte", "EndByte")
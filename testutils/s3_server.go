@@ -0,0 +1,235 @@
+package testutils
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ * A FakeS3Server serves the subset of the S3 API used by utils.S3Client from
+ * memory, for testing against in place of an S3-compatible store like MinIO.
+ * Objects are addressed in path style, as /<bucket>/<key>.
+ */
+type FakeS3Server struct {
+	*httptest.Server
+	Objects map[string][]byte
+	// The number of requests that will fail with a 500 error before any succeed
+	FailNextRequests int
+	// The number of bytes of the next GET response sent before the connection is dropped
+	TruncateNextGet int
+	MaxKeys         int
+	Requests        []string
+	bucket          string
+	uploads         map[string]map[int][]byte
+	nextUploadID    int
+	mutex           sync.Mutex
+}
+
+func NewFakeS3Server(bucket string) *FakeS3Server {
+	server := &FakeS3Server{
+		Objects:         make(map[string][]byte),
+		TruncateNextGet: -1,
+		MaxKeys:         1000,
+		bucket:          bucket,
+		uploads:         make(map[string]map[int][]byte),
+	}
+	server.Server = httptest.NewServer(http.HandlerFunc(server.handle))
+	return server
+}
+
+func (server *FakeS3Server) handle(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	query := r.URL.Query()
+	server.Requests = append(server.Requests, fmt.Sprintf("%s %s", r.Method, r.URL.RequestURI()))
+
+	if server.FailNextRequests > 0 {
+		server.FailNextRequests--
+		writeS3Error(w, http.StatusInternalServerError, "InternalError", "We encountered an internal error. Please try again.")
+		return
+	}
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=") ||
+		r.Header.Get("X-Amz-Date") == "" || r.Header.Get("X-Amz-Content-Sha256") == "" {
+		writeS3Error(w, http.StatusForbidden, "AccessDenied", "Access Denied")
+		return
+	}
+	pathParts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if pathParts[0] != server.bucket {
+		writeS3Error(w, http.StatusNotFound, "NoSuchBucket", "The specified bucket does not exist")
+		return
+	}
+	if len(pathParts) == 1 || pathParts[1] == "" {
+		switch r.Method {
+		case "HEAD":
+			w.WriteHeader(http.StatusOK)
+		case "GET":
+			server.listObjects(w, query.Get("prefix"), query.Get("continuation-token"))
+		default:
+			writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+		}
+		return
+	}
+	key := pathParts[1]
+	body, _ := ioutil.ReadAll(r.Body)
+	_, isInitiate := query["uploads"]
+	uploadID := query.Get("uploadId")
+	switch {
+	case r.Method == "POST" && isInitiate:
+		server.nextUploadID++
+		uploadID = strconv.Itoa(server.nextUploadID)
+		server.uploads[uploadID] = make(map[int][]byte)
+		writeS3XML(w, struct {
+			XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+			Bucket   string
+			Key      string
+			UploadId string
+		}{Bucket: server.bucket, Key: key, UploadId: uploadID})
+	case r.Method == "PUT" && uploadID != "":
+		parts, ok := server.uploads[uploadID]
+		if !ok {
+			writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+			return
+		}
+		partNumber, _ := strconv.Atoi(query.Get("partNumber"))
+		parts[partNumber] = body
+		w.Header().Set("ETag", fmt.Sprintf(`"etag%d"`, partNumber))
+	case r.Method == "POST" && uploadID != "":
+		server.completeUpload(w, key, uploadID, body)
+	case r.Method == "DELETE" && uploadID != "":
+		delete(server.uploads, uploadID)
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "PUT":
+		server.Objects[key] = body
+		w.Header().Set("ETag", `"etag"`)
+	case r.Method == "GET":
+		server.getObject(w, r, key)
+	case r.Method == "DELETE":
+		delete(server.Objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeS3Error(w, http.StatusMethodNotAllowed, "MethodNotAllowed", "The specified method is not allowed")
+	}
+}
+
+func (server *FakeS3Server) completeUpload(w http.ResponseWriter, key string, uploadID string, body []byte) {
+	parts, ok := server.uploads[uploadID]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchUpload", "The specified upload does not exist")
+		return
+	}
+	request := struct {
+		Parts []struct {
+			PartNumber int
+			ETag       string
+		} `xml:"Part"`
+	}{}
+	if xml.Unmarshal(body, &request) != nil || len(request.Parts) == 0 {
+		writeS3Error(w, http.StatusBadRequest, "MalformedXML", "The XML you provided was not well-formed")
+		return
+	}
+	object := make([]byte, 0)
+	for _, part := range request.Parts {
+		partBody, ok := parts[part.PartNumber]
+		if !ok || part.ETag != fmt.Sprintf(`"etag%d"`, part.PartNumber) {
+			writeS3Error(w, http.StatusBadRequest, "InvalidPart", "One or more of the specified parts could not be found")
+			return
+		}
+		object = append(object, partBody...)
+	}
+	server.Objects[key] = object
+	delete(server.uploads, uploadID)
+	writeS3XML(w, struct {
+		XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+		Key     string
+	}{Key: key})
+}
+
+func (server *FakeS3Server) getObject(w http.ResponseWriter, r *http.Request, key string) {
+	object, ok := server.Objects[key]
+	if !ok {
+		writeS3Error(w, http.StatusNotFound, "NoSuchKey", "The specified key does not exist.")
+		return
+	}
+	status := http.StatusOK
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+		var start, end int
+		bounds := strings.SplitN(strings.TrimPrefix(rangeHeader, "bytes="), "-", 2)
+		start, _ = strconv.Atoi(bounds[0])
+		end = len(object) - 1
+		if len(bounds) == 2 && bounds[1] != "" {
+			end, _ = strconv.Atoi(bounds[1])
+		}
+		if start >= len(object) {
+			writeS3Error(w, http.StatusRequestedRangeNotSatisfiable, "InvalidRange", "The requested range is not satisfiable")
+			return
+		}
+		if end >= len(object) {
+			end = len(object) - 1
+		}
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(object)))
+		object = object[start : end+1]
+		status = http.StatusPartialContent
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(object)))
+	w.WriteHeader(status)
+	if server.TruncateNextGet >= 0 && server.TruncateNextGet < len(object) {
+		object = object[:server.TruncateNextGet]
+		server.TruncateNextGet = -1
+	}
+	_, _ = w.Write(object)
+}
+
+func (server *FakeS3Server) listObjects(w http.ResponseWriter, prefix string, continuationToken string) {
+	keys := make([]string, 0)
+	for key := range server.Objects {
+		if strings.HasPrefix(key, prefix) && key > continuationToken {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	type contents struct {
+		Key  string
+		Size int
+	}
+	result := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Name                  string
+		Prefix                string
+		IsTruncated           bool
+		NextContinuationToken string `xml:",omitempty"`
+		Contents              []contents
+	}{Name: server.bucket, Prefix: prefix}
+	if len(keys) > server.MaxKeys {
+		keys = keys[:server.MaxKeys]
+		result.IsTruncated = true
+		result.NextContinuationToken = keys[len(keys)-1]
+	}
+	for _, key := range keys {
+		result.Contents = append(result.Contents, contents{Key: key, Size: len(server.Objects[key])})
+	}
+	writeS3XML(w, result)
+}
+
+func writeS3XML(w http.ResponseWriter, value interface{}) {
+	contents, _ := xml.Marshal(value)
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write(append([]byte(xml.Header), contents...))
+}
+
+func writeS3Error(w http.ResponseWriter, status int, code string, message string) {
+	contents, _ := xml.Marshal(struct {
+		XMLName xml.Name `xml:"Error"`
+		Code    string
+		Message string
+	}{Code: code, Message: message})
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+	_, _ = w.Write(contents)
+}
@@ -0,0 +1,373 @@
+package toc
+
+/*
+ * This file contains functions for comparing the metadata statements of two
+ * sets of TOC entries object by object, such as a backup and the database it
+ * is about to be restored into, and for comparing the data entries and
+ * incremental metadata of two backups.
+ */
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+const (
+	DIFF_ADDED   = "added"
+	DIFF_REMOVED = "removed"
+	DIFF_CHANGED = "changed"
+)
+
+type ObjectDiff struct {
+	Status          string `json:"status"`
+	Section         string `json:"section"`
+	ObjectType      string `json:"object_type"`
+	Schema          string `json:"schema,omitempty"`
+	Name            string `json:"name"`
+	ReferenceObject string `json:"reference_object,omitempty"`
+	OldDefinition   string `json:"old_definition,omitempty"`
+	NewDefinition   string `json:"new_definition,omitempty"`
+}
+
+type TableDataDiff struct {
+	Status        string `json:"status"`
+	Schema        string `json:"schema"`
+	Name          string `json:"name"`
+	OldRowsCopied int64  `json:"old_rows_copied"`
+	NewRowsCopied int64  `json:"new_rows_copied"`
+}
+
+type AOTableDiff struct {
+	Status              string `json:"status"`
+	Table               string `json:"table"`
+	OldModcount         int64  `json:"old_modcount"`
+	NewModcount         int64  `json:"new_modcount"`
+	OldLastDDLTimestamp string `json:"old_last_ddl_timestamp,omitempty"`
+	NewLastDDLTimestamp string `json:"new_last_ddl_timestamp,omitempty"`
+}
+
+/*
+ * Tables and AOTables are only set when comparing two backups, as a database
+ * has no row counts or incremental metadata recorded to compare with.
+ */
+type DiffReport struct {
+	Old      string          `json:"old"`
+	New      string          `json:"new"`
+	Added    int             `json:"added"`
+	Removed  int             `json:"removed"`
+	Changed  int             `json:"changed"`
+	Objects  []ObjectDiff    `json:"objects"`
+	Tables   []TableDataDiff `json:"tables,omitempty"`
+	AOTables []AOTableDiff   `json:"ao_tables,omitempty"`
+}
+
+type diffObjectKey struct {
+	ObjectType      string
+	Schema          string
+	Name            string
+	ReferenceObject string
+}
+
+func (key diffObjectKey) less(other diffObjectKey) bool {
+	if key.ObjectType != other.ObjectType {
+		return key.ObjectType < other.ObjectType
+	}
+	if key.Schema != other.Schema {
+		return key.Schema < other.Schema
+	}
+	if key.Name != other.Name {
+		return key.Name < other.Name
+	}
+	return key.ReferenceObject < other.ReferenceObject
+}
+
+/*
+ * An object's comment, owner, privileges, and security label are written as
+ * separate statements with the same TOC entry fields as the object itself,
+ * so all of those statements together make up the object's definition.
+ */
+func groupStatementsByObject(statements []StatementWithType) (map[diffObjectKey]string, []diffObjectKey) {
+	definitions := make(map[diffObjectKey]string)
+	keys := make([]diffObjectKey, 0)
+	for _, statement := range statements {
+		key := diffObjectKey{statement.ObjectType, statement.Schema, statement.Name, statement.ReferenceObject}
+		definition, ok := definitions[key]
+		if !ok {
+			keys = append(keys, key)
+		} else {
+			definition += "\n"
+		}
+		definitions[key] = definition + strings.TrimSpace(statement.Statement)
+	}
+	return definitions, keys
+}
+
+/*
+ * Returns the objects in one section that are only in newStatements (added),
+ * only in oldStatements (removed), or in both with different definitions
+ * (changed), sorted by object type and name.
+ */
+func DiffStatements(section string, oldStatements []StatementWithType, newStatements []StatementWithType) []ObjectDiff {
+	oldDefinitions, oldKeys := groupStatementsByObject(oldStatements)
+	newDefinitions, newKeys := groupStatementsByObject(newStatements)
+
+	keys := oldKeys
+	for _, key := range newKeys {
+		if _, ok := oldDefinitions[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		return keys[i].less(keys[j])
+	})
+
+	diffs := make([]ObjectDiff, 0)
+	for _, key := range keys {
+		oldDefinition, inOld := oldDefinitions[key]
+		newDefinition, inNew := newDefinitions[key]
+		diff := ObjectDiff{Section: section, ObjectType: key.ObjectType, Schema: key.Schema, Name: key.Name,
+			ReferenceObject: key.ReferenceObject, OldDefinition: oldDefinition, NewDefinition: newDefinition}
+		switch {
+		case !inOld:
+			diff.Status = DIFF_ADDED
+		case !inNew:
+			diff.Status = DIFF_REMOVED
+		case oldDefinition != newDefinition:
+			diff.Status = DIFF_CHANGED
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+/*
+ * Returns the tables whose data is only in newEntries (added), only in
+ * oldEntries (removed), or in both with a different number of rows copied
+ * (changed), sorted by name.
+ */
+func DiffDataEntries(oldEntries []MasterDataEntry, newEntries []MasterDataEntry) []TableDataDiff {
+	type tableKey struct{ Schema, Name string }
+	oldRows := make(map[tableKey]int64, len(oldEntries))
+	newRows := make(map[tableKey]int64, len(newEntries))
+	keys := make([]tableKey, 0)
+	for _, entry := range oldEntries {
+		key := tableKey{entry.Schema, entry.Name}
+		oldRows[key] = entry.RowsCopied
+		keys = append(keys, key)
+	}
+	for _, entry := range newEntries {
+		key := tableKey{entry.Schema, entry.Name}
+		newRows[key] = entry.RowsCopied
+		if _, ok := oldRows[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.SliceStable(keys, func(i, j int) bool {
+		if keys[i].Schema != keys[j].Schema {
+			return keys[i].Schema < keys[j].Schema
+		}
+		return keys[i].Name < keys[j].Name
+	})
+
+	diffs := make([]TableDataDiff, 0)
+	for _, key := range keys {
+		oldRowsCopied, inOld := oldRows[key]
+		newRowsCopied, inNew := newRows[key]
+		diff := TableDataDiff{Schema: key.Schema, Name: key.Name, OldRowsCopied: oldRowsCopied, NewRowsCopied: newRowsCopied}
+		switch {
+		case !inOld:
+			diff.Status = DIFF_ADDED
+		case !inNew:
+			diff.Status = DIFF_REMOVED
+		case oldRowsCopied != newRowsCopied:
+			diff.Status = DIFF_CHANGED
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+/*
+ * Returns the append-optimized tables that are only in newEntries (added),
+ * only in oldEntries (removed), or in both with a different modification
+ * count or last DDL timestamp (changed), sorted by name.
+ */
+func DiffIncrementalMetadata(oldEntries map[string]AOEntry, newEntries map[string]AOEntry) []AOTableDiff {
+	tables := make([]string, 0)
+	for table := range oldEntries {
+		tables = append(tables, table)
+	}
+	for table := range newEntries {
+		if _, ok := oldEntries[table]; !ok {
+			tables = append(tables, table)
+		}
+	}
+	sort.Strings(tables)
+
+	diffs := make([]AOTableDiff, 0)
+	for _, table := range tables {
+		oldEntry, inOld := oldEntries[table]
+		newEntry, inNew := newEntries[table]
+		diff := AOTableDiff{Table: table, OldModcount: oldEntry.Modcount, NewModcount: newEntry.Modcount,
+			OldLastDDLTimestamp: oldEntry.LastDDLTimestamp, NewLastDDLTimestamp: newEntry.LastDDLTimestamp}
+		switch {
+		case !inOld:
+			diff.Status = DIFF_ADDED
+		case !inNew:
+			diff.Status = DIFF_REMOVED
+		case oldEntry != newEntry:
+			diff.Status = DIFF_CHANGED
+		default:
+			continue
+		}
+		diffs = append(diffs, diff)
+	}
+	return diffs
+}
+
+func (report *DiffReport) AddObjectDiffs(diffs []ObjectDiff) {
+	if report.Objects == nil {
+		report.Objects = make([]ObjectDiff, 0)
+	}
+	for _, diff := range diffs {
+		switch diff.Status {
+		case DIFF_ADDED:
+			report.Added++
+		case DIFF_REMOVED:
+			report.Removed++
+		case DIFF_CHANGED:
+			report.Changed++
+		}
+		report.Objects = append(report.Objects, diff)
+	}
+}
+
+func (diff ObjectDiff) objectString() string {
+	name := diff.Name
+	if diff.Schema != "" && diff.ObjectType != "SCHEMA" {
+		name = fmt.Sprintf("%s.%s", diff.Schema, diff.Name)
+	}
+	if diff.ReferenceObject != "" {
+		return fmt.Sprintf("%s %s ON %s", diff.ObjectType, name, diff.ReferenceObject)
+	}
+	return fmt.Sprintf("%s %s", diff.ObjectType, name)
+}
+
+/*
+ * Changed objects are followed by a line diff of their definitions, with
+ * lines only in the old definition prefixed by "-" and lines only in the new
+ * definition prefixed by "+".
+ */
+func (report *DiffReport) WriteText(writer io.Writer) error {
+	lines := []string{fmt.Sprintf("Comparing %s (old) with %s (new)", report.Old, report.New), ""}
+	for _, diff := range report.Objects {
+		lines = append(lines, fmt.Sprintf("%s%s: %s", strings.ToUpper(diff.Status[:1]), diff.Status[1:], diff.objectString()))
+		if diff.Status == DIFF_CHANGED {
+			for _, line := range diffLines(strings.Split(diff.OldDefinition, "\n"), strings.Split(diff.NewDefinition, "\n")) {
+				lines = append(lines, "    "+line)
+			}
+		}
+	}
+	for _, diff := range report.Tables {
+		lines = append(lines, fmt.Sprintf("Table data %s: %s", diff.Status, diff.tableDataString()))
+	}
+	for _, diff := range report.AOTables {
+		lines = append(lines, fmt.Sprintf("Append-optimized table %s: %s", diff.Status, diff.aoTableString()))
+	}
+	if len(report.Objects) > 0 || len(report.Tables) > 0 || len(report.AOTables) > 0 {
+		lines = append(lines, "")
+	}
+	lines = append(lines, fmt.Sprintf("%d added, %d removed, %d changed", report.Added, report.Removed, report.Changed))
+	if report.Tables != nil {
+		lines = append(lines, "Table data: "+countDiffStatuses(len(report.Tables), func(i int) string { return report.Tables[i].Status }))
+	}
+	if report.AOTables != nil {
+		lines = append(lines, "Append-optimized tables: "+countDiffStatuses(len(report.AOTables), func(i int) string { return report.AOTables[i].Status }))
+	}
+	_, err := fmt.Fprintln(writer, strings.Join(lines, "\n"))
+	return err
+}
+
+func (diff TableDataDiff) tableDataString() string {
+	fqn := fmt.Sprintf("%s.%s", diff.Schema, diff.Name)
+	switch diff.Status {
+	case DIFF_ADDED:
+		return fmt.Sprintf("%s (%d rows)", fqn, diff.NewRowsCopied)
+	case DIFF_REMOVED:
+		return fmt.Sprintf("%s (%d rows)", fqn, diff.OldRowsCopied)
+	}
+	return fmt.Sprintf("%s (%d rows -> %d rows)", fqn, diff.OldRowsCopied, diff.NewRowsCopied)
+}
+
+func (diff AOTableDiff) aoTableString() string {
+	switch diff.Status {
+	case DIFF_ADDED:
+		return fmt.Sprintf("%s (modcount %d, last DDL %s)", diff.Table, diff.NewModcount, diff.NewLastDDLTimestamp)
+	case DIFF_REMOVED:
+		return fmt.Sprintf("%s (modcount %d, last DDL %s)", diff.Table, diff.OldModcount, diff.OldLastDDLTimestamp)
+	}
+	return fmt.Sprintf("%s (modcount %d -> %d, last DDL %s -> %s)", diff.Table, diff.OldModcount, diff.NewModcount,
+		diff.OldLastDDLTimestamp, diff.NewLastDDLTimestamp)
+}
+
+func countDiffStatuses(numDiffs int, getStatus func(i int) string) string {
+	counts := make(map[string]int)
+	for i := 0; i < numDiffs; i++ {
+		counts[getStatus(i)]++
+	}
+	return fmt.Sprintf("%d added, %d removed, %d changed", counts[DIFF_ADDED], counts[DIFF_REMOVED], counts[DIFF_CHANGED])
+}
+
+func (report *DiffReport) WriteJSON(writer io.Writer) error {
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(report)
+}
+
+// Returns a line diff of oldLines and newLines based on their longest common subsequence
+func diffLines(oldLines []string, newLines []string) []string {
+	common := make([][]int, len(oldLines)+1)
+	for i := range common {
+		common[i] = make([]int, len(newLines)+1)
+	}
+	for i := len(oldLines) - 1; i >= 0; i-- {
+		for j := len(newLines) - 1; j >= 0; j-- {
+			if oldLines[i] == newLines[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else if common[i+1][j] >= common[i][j+1] {
+				common[i][j] = common[i+1][j]
+			} else {
+				common[i][j] = common[i][j+1]
+			}
+		}
+	}
+	lines := make([]string, 0)
+	i, j := 0, 0
+	for i < len(oldLines) && j < len(newLines) {
+		if oldLines[i] == newLines[j] {
+			lines = append(lines, " "+oldLines[i])
+			i++
+			j++
+		} else if common[i+1][j] >= common[i][j+1] {
+			lines = append(lines, "-"+oldLines[i])
+			i++
+		} else {
+			lines = append(lines, "+"+newLines[j])
+			j++
+		}
+	}
+	for ; i < len(oldLines); i++ {
+		lines = append(lines, "-"+oldLines[i])
+	}
+	for ; j < len(newLines); j++ {
+		lines = append(lines, "+"+newLines[j])
+	}
+	return lines
+}
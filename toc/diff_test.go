@@ -0,0 +1,147 @@
+package toc_test
+
+import (
+	"bytes"
+
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("toc/diff tests", func() {
+	table := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "foo", Statement: "\n\nCREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\n"}
+	tableOwner := toc.StatementWithType{ObjectType: "TABLE", Schema: "public", Name: "foo", Statement: "\n\nALTER TABLE public.foo OWNER TO testrole;\n"}
+	view := toc.StatementWithType{ObjectType: "VIEW", Schema: "public", Name: "myview", Statement: "\n\nCREATE VIEW public.myview AS  SELECT 1;\n"}
+	index := toc.StatementWithType{ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo", Statement: "\n\nCREATE INDEX foo_idx ON public.foo USING btree (i);\n"}
+	Describe("DiffStatements", func() {
+		It("returns no differences for identical statements", func() {
+			Expect(toc.DiffStatements("predata", []toc.StatementWithType{table, tableOwner, view}, []toc.StatementWithType{table, tableOwner, view})).To(BeEmpty())
+		})
+		It("returns added, removed, and changed objects sorted by object type and name", func() {
+			changedView := view
+			changedView.Statement = "\n\nCREATE VIEW public.myview AS  SELECT 2;\n"
+
+			diffs := toc.DiffStatements("predata", []toc.StatementWithType{view, table}, []toc.StatementWithType{changedView, index})
+
+			Expect(diffs).To(Equal([]toc.ObjectDiff{
+				{Status: toc.DIFF_ADDED, Section: "predata", ObjectType: "INDEX", Schema: "public", Name: "foo_idx", ReferenceObject: "public.foo",
+					NewDefinition: "CREATE INDEX foo_idx ON public.foo USING btree (i);"},
+				{Status: toc.DIFF_REMOVED, Section: "predata", ObjectType: "TABLE", Schema: "public", Name: "foo",
+					OldDefinition: "CREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);"},
+				{Status: toc.DIFF_CHANGED, Section: "predata", ObjectType: "VIEW", Schema: "public", Name: "myview",
+					OldDefinition: "CREATE VIEW public.myview AS  SELECT 1;", NewDefinition: "CREATE VIEW public.myview AS  SELECT 2;"},
+			}))
+		})
+		It("compares the metadata statements of an object along with its definition", func() {
+			diffs := toc.DiffStatements("predata", []toc.StatementWithType{table, tableOwner}, []toc.StatementWithType{table})
+
+			Expect(diffs).To(HaveLen(1))
+			Expect(diffs[0].Status).To(Equal(toc.DIFF_CHANGED))
+			Expect(diffs[0].OldDefinition).To(Equal("CREATE TABLE public.foo (\n\ti integer\n) DISTRIBUTED BY (i);\nALTER TABLE public.foo OWNER TO testrole;"))
+		})
+	})
+	Describe("DiffDataEntries", func() {
+		It("returns tables that were added, removed, or have a different number of rows", func() {
+			oldEntries := []toc.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 10},
+				{Schema: "public", Name: "bar", Oid: 2, RowsCopied: 5},
+				{Schema: "public", Name: "same", Oid: 3, RowsCopied: 7},
+			}
+			newEntries := []toc.MasterDataEntry{
+				{Schema: "public", Name: "foo", Oid: 1, RowsCopied: 20},
+				{Schema: "public", Name: "same", Oid: 4, RowsCopied: 7},
+				{Schema: "other", Name: "baz", Oid: 5, RowsCopied: 3},
+			}
+
+			Expect(toc.DiffDataEntries(oldEntries, newEntries)).To(Equal([]toc.TableDataDiff{
+				{Status: toc.DIFF_ADDED, Schema: "other", Name: "baz", NewRowsCopied: 3},
+				{Status: toc.DIFF_REMOVED, Schema: "public", Name: "bar", OldRowsCopied: 5},
+				{Status: toc.DIFF_CHANGED, Schema: "public", Name: "foo", OldRowsCopied: 10, NewRowsCopied: 20},
+			}))
+		})
+	})
+	Describe("DiffIncrementalMetadata", func() {
+		It("returns append-optimized tables that were added, removed, or modified", func() {
+			oldEntries := map[string]toc.AOEntry{
+				"public.ao1": {Modcount: 1, LastDDLTimestamp: "00000"},
+				"public.ao2": {Modcount: 2, LastDDLTimestamp: "00000"},
+				"public.ao3": {Modcount: 3, LastDDLTimestamp: "00000"},
+			}
+			newEntries := map[string]toc.AOEntry{
+				"public.ao1": {Modcount: 1, LastDDLTimestamp: "00000"},
+				"public.ao2": {Modcount: 2, LastDDLTimestamp: "11111"},
+				"public.ao4": {Modcount: 4, LastDDLTimestamp: "00000"},
+			}
+
+			Expect(toc.DiffIncrementalMetadata(oldEntries, newEntries)).To(Equal([]toc.AOTableDiff{
+				{Status: toc.DIFF_CHANGED, Table: "public.ao2", OldModcount: 2, NewModcount: 2, OldLastDDLTimestamp: "00000", NewLastDDLTimestamp: "11111"},
+				{Status: toc.DIFF_REMOVED, Table: "public.ao3", OldModcount: 3, OldLastDDLTimestamp: "00000"},
+				{Status: toc.DIFF_ADDED, Table: "public.ao4", NewModcount: 4, NewLastDDLTimestamp: "00000"},
+			}))
+		})
+	})
+	Describe("DiffReport", func() {
+		var report toc.DiffReport
+		BeforeEach(func() {
+			changedTable := table
+			changedTable.Statement = "\n\nCREATE TABLE public.foo (\n\ti integer,\n\tj text\n) DISTRIBUTED BY (i);\n"
+			report = toc.DiffReport{Old: "backup 20170101010101", New: "database testdb"}
+			report.AddObjectDiffs(toc.DiffStatements("predata", []toc.StatementWithType{table, view}, []toc.StatementWithType{changedTable}))
+			report.AddObjectDiffs(toc.DiffStatements("postdata", []toc.StatementWithType{}, []toc.StatementWithType{index}))
+		})
+		It("counts the differences by status", func() {
+			Expect(report.Added).To(Equal(1))
+			Expect(report.Removed).To(Equal(1))
+			Expect(report.Changed).To(Equal(1))
+		})
+		It("writes the differences as text with a line diff of changed objects", func() {
+			outputBuffer := bytes.NewBuffer(nil)
+
+			Expect(report.WriteText(outputBuffer)).To(Succeed())
+
+			Expect(outputBuffer.String()).To(Equal(`Comparing backup 20170101010101 (old) with database testdb (new)
+
+Changed: TABLE public.foo
+     CREATE TABLE public.foo (
+    -	i integer
+    +	i integer,
+    +	j text
+     ) DISTRIBUTED BY (i);
+Removed: VIEW public.myview
+Added: INDEX public.foo_idx ON public.foo
+
+1 added, 1 removed, 1 changed
+`))
+		})
+		It("writes the table data and append-optimized table differences as text", func() {
+			report.Tables = []toc.TableDataDiff{{Status: toc.DIFF_CHANGED, Schema: "public", Name: "foo", OldRowsCopied: 10, NewRowsCopied: 20}}
+			report.AOTables = []toc.AOTableDiff{}
+			outputBuffer := bytes.NewBuffer(nil)
+
+			Expect(report.WriteText(outputBuffer)).To(Succeed())
+
+			Expect(outputBuffer.String()).To(HaveSuffix(`Added: INDEX public.foo_idx ON public.foo
+Table data changed: public.foo (10 rows -> 20 rows)
+
+1 added, 1 removed, 1 changed
+Table data: 0 added, 0 removed, 1 changed
+Append-optimized tables: 0 added, 0 removed, 0 changed
+`))
+		})
+		It("writes the differences as JSON", func() {
+			outputBuffer := bytes.NewBuffer(nil)
+
+			Expect(report.WriteJSON(outputBuffer)).To(Succeed())
+
+			Expect(outputBuffer.String()).To(ContainSubstring(`"old": "backup 20170101010101"`))
+			Expect(outputBuffer.String()).To(ContainSubstring(`"status": "removed",
+      "section": "predata",
+      "object_type": "VIEW",
+      "schema": "public",
+      "name": "myview",
+      "old_definition": "CREATE VIEW public.myview AS  SELECT 1;"`))
+			Expect(outputBuffer.String()).To(ContainSubstring(`"reference_object": "public.foo"`))
+		})
+	})
+})
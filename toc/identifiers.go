@@ -0,0 +1,198 @@
+package toc
+
+/*
+ * This file contains functions for rewriting the schema, table, and database
+ * names in backed-up statements when redirecting objects to a different
+ * schema, table, or database.  Backups record where each of those names was
+ * printed, so restore can rewrite exactly those names and leave aliases,
+ * columns, and strings that happen to look like them alone.
+ */
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/utils"
+)
+
+/*
+ * Offset and Length give the location of the name as it appears in the
+ * statement, and Name is its quoted value.  Schema is the quoted schema of a
+ * RELATION reference.  A reference with InLiteral set appears inside a string
+ * literal, such as the 'schema.table'::regclass in a column default or the
+ * body of a function, so it must be escaped as a string when it is rewritten.
+ * A RELATION reference with Unaliased set is listed in a FROM clause without
+ * an alias, so renaming it keeps its old name as an alias for the columns
+ * qualified with that name.
+ */
+type IdentifierReference struct {
+	ObjectType string
+	Schema     string `yaml:",omitempty"`
+	Name       string
+	Offset     int
+	Length     int
+	InLiteral  bool `yaml:",omitempty"`
+	Unaliased  bool `yaml:",omitempty"`
+}
+
+/*
+ * Records the references of each entry in a section of the TOC from the names
+ * printed to the file the section was written to, which are in the order they
+ * were printed.
+ */
+func (toc *TOC) RecordIdentifierReferences(section string, references []utils.PrintedReference) {
+	toc.ReferencesRecorded = true
+	entries := *toc.metadataEntryMap[section]
+	for i, entry := range entries {
+		first := sort.Search(len(references), func(j int) bool { return references[j].Offset >= entry.StartByte })
+		entryReferences := make([]IdentifierReference, 0)
+		for _, identifier := range references[first:] {
+			if identifier.Offset+uint64(identifier.Length) > entry.EndByte {
+				break
+			}
+			entryReferences = append(entryReferences, IdentifierReference{
+				ObjectType: identifier.ObjectType,
+				Schema:     identifier.Schema,
+				Name:       identifier.Name,
+				Offset:     int(identifier.Offset - entry.StartByte),
+				Length:     identifier.Length,
+				InLiteral:  identifier.InLiteral,
+				Unaliased:  identifier.Unaliased,
+			})
+		}
+		if len(entryReferences) > 0 {
+			entries[i].References = entryReferences
+		}
+	}
+}
+
+/*
+ * Replaces each reference that matches with the new quoted name, adjusting
+ * the remaining references to match the rewritten statement.
+ */
+func rewriteIdentifierReferences(statement StatementWithType, matches func(reference IdentifierReference) bool, newQuotedName string) StatementWithType {
+	var builder strings.Builder
+	newReferences := make([]IdentifierReference, 0, len(statement.References))
+	position := 0
+	shift := 0
+	for _, reference := range statement.References {
+		if matches(reference) {
+			replacement := newQuotedName
+			alias := ""
+			if reference.Unaliased && newQuotedName != reference.Name {
+				alias = " " + reference.Name
+				reference.Unaliased = false
+			}
+			if reference.InLiteral {
+				replacement = utils.EscapeSingleQuotes(newQuotedName)
+				alias = utils.EscapeSingleQuotes(alias)
+			}
+			builder.WriteString(statement.Statement[position:reference.Offset])
+			builder.WriteString(replacement + alias)
+			position = reference.Offset + reference.Length
+			reference.Offset += shift
+			shift += len(replacement) + len(alias) - reference.Length
+			reference.Length = len(replacement)
+			reference.Name = newQuotedName
+		} else {
+			reference.Offset += shift
+		}
+		newReferences = append(newReferences, reference)
+	}
+	builder.WriteString(statement.Statement[position:])
+	statement.Statement = builder.String()
+	statement.References = newReferences
+	return statement
+}
+
+/*
+ * Moves the objects in the given statements to the redirect schema, along
+ * with every reference to the schemas those objects are being moved from.
+ * References to other schemas are left alone, since objects in those schemas
+ * are not being restored.  Backups that did not record their references only
+ * have the first schema-qualified name in each statement rewritten.
+ */
+func RedirectSchemaInStatements(statements []StatementWithType, redirectSchema string) []StatementWithType {
+	if redirectSchema == "" {
+		return statements
+	}
+	oldSchemas := make(map[string]bool)
+	for _, statement := range statements {
+		if statement.Schema != "" {
+			oldSchemas[statement.Schema] = true
+		}
+	}
+	isOldSchema := func(reference IdentifierReference) bool {
+		return reference.ObjectType == "SCHEMA" && oldSchemas[reference.Name]
+	}
+	for i, statement := range statements {
+		oldSchema := fmt.Sprintf("%s.", statement.Schema)
+		newSchema := fmt.Sprintf("%s.", redirectSchema)
+		if statement.References != nil {
+			statements[i] = rewriteIdentifierReferences(statement, isOldSchema, redirectSchema)
+			for j, reference := range statements[i].References {
+				if reference.ObjectType == "RELATION" && oldSchemas[reference.Schema] {
+					statements[i].References[j].Schema = redirectSchema
+				}
+			}
+		} else {
+			statements[i].Statement = strings.Replace(statement.Statement, oldSchema, newSchema, 1)
+		}
+		statements[i].Schema = redirectSchema
+		// only postdata will have a reference object
+		if statement.ReferenceObject != "" {
+			statements[i].ReferenceObject = strings.Replace(statement.ReferenceObject, oldSchema, newSchema, 1)
+		}
+	}
+	return statements
+}
+
+/*
+ * Renames a table in the given statements, along with every reference to it,
+ * such as those in the indexes on it, the views that select from it, and the
+ * functions that use it.  Backups that did not record their references only
+ * have the first occurrence of the qualified name of the table in each
+ * statement rewritten.
+ */
+func RedirectTableInStatements(statements []StatementWithType, quotedSchema string, oldQuotedName string, newQuotedName string) []StatementWithType {
+	oldFQN := utils.MakeFQN(quotedSchema, oldQuotedName)
+	newFQN := utils.MakeFQN(quotedSchema, newQuotedName)
+	isOldTable := func(reference IdentifierReference) bool {
+		return reference.ObjectType == "RELATION" && reference.Schema == quotedSchema && reference.Name == oldQuotedName
+	}
+	for i, statement := range statements {
+		if statement.References != nil {
+			statements[i] = rewriteIdentifierReferences(statement, isOldTable, newQuotedName)
+		} else {
+			statements[i].Statement = strings.Replace(statement.Statement, oldFQN, newFQN, 1)
+		}
+		if statement.Schema == quotedSchema && statement.Name == oldQuotedName {
+			statements[i].Name = newQuotedName
+		}
+		if statement.ReferenceObject == oldFQN {
+			statements[i].ReferenceObject = newFQN
+		}
+	}
+	return statements
+}
+
+func SubstituteRedirectDatabaseInStatements(statements []StatementWithType, oldQuotedName string, newQuotedName string) []StatementWithType {
+	shouldReplace := map[string]bool{"DATABASE GUC": true, "DATABASE": true, "DATABASE METADATA": true}
+	pattern := regexp.MustCompile(fmt.Sprintf("DATABASE %s(;| OWNER| SET| TO| FROM| IS| TEMPLATE)", regexp.QuoteMeta(oldQuotedName)))
+	isOldDatabase := func(reference IdentifierReference) bool {
+		return reference.ObjectType == "DATABASE" && reference.Name == oldQuotedName
+	}
+	for i, statement := range statements {
+		if !shouldReplace[statement.ObjectType] {
+			continue
+		}
+		if statement.References != nil {
+			statements[i] = rewriteIdentifierReferences(statement, isOldDatabase, newQuotedName)
+		} else {
+			statements[i].Statement = pattern.ReplaceAllString(statement.Statement, fmt.Sprintf("DATABASE %s$1", newQuotedName))
+		}
+	}
+	return statements
+}
@@ -0,0 +1,216 @@
+package toc_test
+
+import (
+	"strings"
+
+	"github.com/greenplum-db/gpbackup/toc"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("toc/identifiers tests", func() {
+	Describe("RecordIdentifierReferences", func() {
+		It("records the names printed within each entry relative to the start of the entry", func() {
+			tocfile := &toc.TOC{}
+			tocfile.InitializeMetadataEntryMap()
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "foo", Name: "bar", ObjectType: "TABLE"}, 10, 50)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "foo", Name: "baz", ObjectType: "TABLE"}, 50, 60)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "foo", Name: "qux", ObjectType: "TABLE"}, 60, 90)
+			references := []utils.PrintedReference{
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 24, Length: 3},
+				{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 28, Length: 3},
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 40, Length: 3, InLiteral: true},
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 72, Length: 3},
+			}
+
+			tocfile.RecordIdentifierReferences("predata", references)
+
+			Expect(tocfile.PredataEntries[0].References).To(Equal([]toc.IdentifierReference{
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 14, Length: 3},
+				{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 18, Length: 3},
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 30, Length: 3, InLiteral: true},
+			}))
+			Expect(tocfile.PredataEntries[1].References).To(BeNil())
+			Expect(tocfile.PredataEntries[2].References).To(Equal([]toc.IdentifierReference{
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 12, Length: 3},
+			}))
+		})
+		It("leaves the statements of entries without recorded references alone once references are recorded", func() {
+			tocfile := &toc.TOC{}
+			tocfile.InitializeMetadataEntryMap()
+			statement := "COMMENT ON TABLE foo.bar IS 'Copied from foo.baz';"
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "foo", Name: "bar", ObjectType: "TABLE"}, 0, uint64(len(statement)))
+			tocfile.RecordIdentifierReferences("predata", []utils.PrintedReference{})
+
+			statements := tocfile.GetSQLStatementForObjectTypes("predata", strings.NewReader(statement), []string{}, []string{}, []string{}, []string{}, []string{}, []string{})
+			statements = toc.RedirectSchemaInStatements(statements, "foo2")
+
+			Expect(statements[0].Statement).To(Equal(statement))
+			Expect(statements[0].Schema).To(Equal("foo2"))
+		})
+	})
+	Describe("RedirectSchemaInStatements", func() {
+		It("does not alter statements if no redirect schema was specified", func() {
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "bar", ObjectType: "TABLE", Statement: "CREATE TABLE foo.bar (i integer);",
+				References: []toc.IdentifierReference{{ObjectType: "SCHEMA", Name: "foo", Offset: 13, Length: 3}}}}
+
+			Expect(toc.RedirectSchemaInStatements(statements, "")).To(Equal([]toc.StatementWithType{{Schema: "foo", Name: "bar", ObjectType: "TABLE", Statement: "CREATE TABLE foo.bar (i integer);",
+				References: []toc.IdentifierReference{{ObjectType: "SCHEMA", Name: "foo", Offset: 13, Length: 3}}}}))
+		})
+		It("rewrites only the recorded references to the schemas being redirected", func() {
+			statement := "CREATE VIEW foo.myview AS  SELECT foo.i\n   FROM foo.foo, other.bar;"
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "myview", ObjectType: "VIEW", Statement: statement,
+				References: []toc.IdentifierReference{
+					{ObjectType: "SCHEMA", Name: "foo", Offset: 12, Length: 3},
+					{ObjectType: "SCHEMA", Name: "other", Offset: 57, Length: 5},
+				}}}
+
+			statements = toc.RedirectSchemaInStatements(statements, "foo2")
+
+			Expect(statements[0].Statement).To(Equal("CREATE VIEW foo2.myview AS  SELECT foo.i\n   FROM foo.foo, other.bar;"))
+			Expect(statements[0].Schema).To(Equal("foo2"))
+			Expect(statements[0].References).To(Equal([]toc.IdentifierReference{
+				{ObjectType: "SCHEMA", Name: "foo2", Offset: 12, Length: 4},
+				{ObjectType: "SCHEMA", Name: "other", Offset: 58, Length: 5},
+			}))
+		})
+		It("moves the references to relations in the schemas being redirected", func() {
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "bar", ObjectType: "TABLE", Statement: "ALTER TABLE foo.bar INHERIT other.bar;",
+				References: []toc.IdentifierReference{
+					{ObjectType: "SCHEMA", Name: "foo", Offset: 12, Length: 3},
+					{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 16, Length: 3},
+					{ObjectType: "SCHEMA", Name: "other", Offset: 28, Length: 5},
+					{ObjectType: "RELATION", Schema: "other", Name: "bar", Offset: 34, Length: 3},
+				}}}
+
+			statements = toc.RedirectSchemaInStatements(statements, "foo2")
+
+			Expect(statements[0].Statement).To(Equal("ALTER TABLE foo2.bar INHERIT other.bar;"))
+			Expect(statements[0].References).To(Equal([]toc.IdentifierReference{
+				{ObjectType: "SCHEMA", Name: "foo2", Offset: 12, Length: 4},
+				{ObjectType: "RELATION", Schema: "foo2", Name: "bar", Offset: 17, Length: 3},
+				{ObjectType: "SCHEMA", Name: "other", Offset: 29, Length: 5},
+				{ObjectType: "RELATION", Schema: "other", Name: "bar", Offset: 35, Length: 3},
+			}))
+		})
+		It("rewrites references to every schema being redirected", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "foo", Name: "bar", ObjectType: "TABLE", Statement: "ALTER TABLE foo.bar INHERIT baz.parent;",
+					References: []toc.IdentifierReference{{ObjectType: "SCHEMA", Name: "foo", Offset: 12, Length: 3}, {ObjectType: "SCHEMA", Name: "baz", Offset: 28, Length: 3}}},
+				{Schema: "baz", Name: "parent", ObjectType: "TABLE", Statement: "CREATE TABLE baz.parent (i integer);",
+					References: []toc.IdentifierReference{{ObjectType: "SCHEMA", Name: "baz", Offset: 13, Length: 3}}},
+			}
+
+			statements = toc.RedirectSchemaInStatements(statements, "foo2")
+
+			Expect(statements[0].Statement).To(Equal("ALTER TABLE foo2.bar INHERIT foo2.parent;"))
+			Expect(statements[1].Statement).To(Equal("CREATE TABLE foo2.parent (i integer);"))
+		})
+		It("escapes the new schema in references inside string literals", func() {
+			statement := `SELECT pg_catalog.setval('"Foo Schema"."Bar_i_seq"', 1, true);`
+			statements := []toc.StatementWithType{{Schema: `"Foo Schema"`, Name: `"Bar_i_seq"`, ObjectType: "SEQUENCE", Statement: statement,
+				References: []toc.IdentifierReference{{ObjectType: "SCHEMA", Name: `"Foo Schema"`, Offset: 26, Length: 12, InLiteral: true}}}}
+
+			statements = toc.RedirectSchemaInStatements(statements, `"it's"`)
+
+			Expect(statements[0].Statement).To(Equal(`SELECT pg_catalog.setval('"it''s"."Bar_i_seq"', 1, true);`))
+		})
+		It("rewrites the first schema-qualified name in statements from backups without recorded references", func() {
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "foo.bar",
+				Statement: "CREATE INDEX bar_idx ON foo.bar USING btree (i) WHERE (foo.i > 0);"}}
+
+			statements = toc.RedirectSchemaInStatements(statements, "foo2")
+
+			Expect(statements[0].Statement).To(Equal("CREATE INDEX bar_idx ON foo2.bar USING btree (i) WHERE (foo.i > 0);"))
+			Expect(statements[0].ReferenceObject).To(Equal("foo2.bar"))
+		})
+	})
+	Describe("RedirectTableInStatements", func() {
+		It("renames the table and rewrites only the recorded references to it", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "foo", Name: "bar", ObjectType: "TABLE", Statement: "CREATE TABLE foo.bar (bar integer DEFAULT nextval('foo.bar_seq'::regclass));",
+					References: []toc.IdentifierReference{
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 13, Length: 3},
+						{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 17, Length: 3},
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 51, Length: 3, InLiteral: true},
+						{ObjectType: "RELATION", Schema: "foo", Name: "bar_seq", Offset: 55, Length: 7, InLiteral: true},
+					}},
+				{Schema: "foo", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "foo.bar", Statement: "CREATE INDEX bar_idx ON foo.bar USING btree (bar);",
+					References: []toc.IdentifierReference{
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 24, Length: 3},
+						{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 28, Length: 3},
+					}},
+				{Schema: "other", Name: "bar", ObjectType: "TABLE", Statement: "CREATE TABLE other.bar (i integer);",
+					References: []toc.IdentifierReference{
+						{ObjectType: "SCHEMA", Name: "other", Offset: 13, Length: 5},
+						{ObjectType: "RELATION", Schema: "other", Name: "bar", Offset: 19, Length: 3},
+					}},
+			}
+
+			statements = toc.RedirectTableInStatements(statements, "foo", "bar", `"It's Bar"`)
+
+			Expect(statements[0].Statement).To(Equal(`CREATE TABLE foo."It's Bar" (bar integer DEFAULT nextval('foo.bar_seq'::regclass));`))
+			Expect(statements[0].Name).To(Equal(`"It's Bar"`))
+			Expect(statements[1].Statement).To(Equal(`CREATE INDEX bar_idx ON foo."It's Bar" USING btree (bar);`))
+			Expect(statements[1].Name).To(Equal("bar_idx"))
+			Expect(statements[1].ReferenceObject).To(Equal(`foo."It's Bar"`))
+			Expect(statements[2].Statement).To(Equal("CREATE TABLE other.bar (i integer);"))
+			Expect(statements[2].Name).To(Equal("bar"))
+		})
+		It("escapes the new name in references inside string literals", func() {
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "bar_seq", ObjectType: "SEQUENCE", Statement: "SELECT pg_catalog.setval('foo.bar_seq', 1, true);",
+				References: []toc.IdentifierReference{
+					{ObjectType: "SCHEMA", Name: "foo", Offset: 26, Length: 3, InLiteral: true},
+					{ObjectType: "RELATION", Schema: "foo", Name: "bar_seq", Offset: 30, Length: 7, InLiteral: true},
+				}}}
+
+			statements = toc.RedirectTableInStatements(statements, "foo", "bar_seq", `"it's_seq"`)
+
+			Expect(statements[0].Statement).To(Equal(`SELECT pg_catalog.setval('foo."it''s_seq"', 1, true);`))
+		})
+		It("keeps the old name as an alias of the renamed table where it is listed in a FROM clause without one", func() {
+			statements := []toc.StatementWithType{
+				{Schema: "foo", Name: "myview", ObjectType: "VIEW", Statement: "CREATE VIEW foo.myview AS SELECT bar.i FROM foo.bar WHERE bar.i > 0;",
+					References: []toc.IdentifierReference{
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 12, Length: 3},
+						{ObjectType: "RELATION", Schema: "foo", Name: "myview", Offset: 16, Length: 6},
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 44, Length: 3},
+						{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 48, Length: 3, Unaliased: true},
+					}},
+				{Schema: "foo", Name: "f", ObjectType: "FUNCTION", Statement: "CREATE FUNCTION foo.f() RETURNS bigint AS 'SELECT count(*) FROM foo.bar' LANGUAGE sql;",
+					References: []toc.IdentifierReference{
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 16, Length: 3},
+						{ObjectType: "SCHEMA", Name: "foo", Offset: 64, Length: 3, InLiteral: true},
+						{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 68, Length: 3, InLiteral: true, Unaliased: true},
+					}},
+			}
+
+			statements = toc.RedirectTableInStatements(statements, "foo", "bar", `"It's Bar"`)
+
+			Expect(statements[0].Statement).To(Equal(`CREATE VIEW foo.myview AS SELECT bar.i FROM foo."It's Bar" bar WHERE bar.i > 0;`))
+			Expect(statements[1].Statement).To(Equal(`CREATE FUNCTION foo.f() RETURNS bigint AS 'SELECT count(*) FROM foo."It''s Bar" bar' LANGUAGE sql;`))
+		})
+		It("rewrites the first occurrence of the table name in statements from backups without recorded references", func() {
+			statements := []toc.StatementWithType{{Schema: "foo", Name: "bar_idx", ObjectType: "INDEX", ReferenceObject: "foo.bar",
+				Statement: "CREATE INDEX bar_idx ON foo.bar USING btree (i);"}}
+
+			statements = toc.RedirectTableInStatements(statements, "foo", "bar", "baz")
+
+			Expect(statements[0].Statement).To(Equal("CREATE INDEX bar_idx ON foo.baz USING btree (i);"))
+			Expect(statements[0].ReferenceObject).To(Equal("foo.baz"))
+		})
+	})
+	Describe("SubstituteRedirectDatabaseInStatements", func() {
+		It("rewrites the recorded references to the database", func() {
+			statement := `COMMENT ON DATABASE "My DB" IS 'DATABASE "My DB" IS old';`
+			statements := []toc.StatementWithType{{Name: `"My DB"`, ObjectType: "DATABASE METADATA", Statement: statement,
+				References: []toc.IdentifierReference{{ObjectType: "DATABASE", Name: `"My DB"`, Offset: 20, Length: 7}}}}
+
+			statements = toc.SubstituteRedirectDatabaseInStatements(statements, `"My DB"`, "newdb")
+
+			Expect(statements[0].Statement).To(Equal(`COMMENT ON DATABASE newdb IS 'DATABASE "My DB" IS old';`))
+		})
+	})
+})
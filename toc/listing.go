@@ -0,0 +1,139 @@
+package toc
+
+/*
+ * This file contains functions for listing the entries in a backup and for
+ * selecting the entries to restore from a list file, in the manner of
+ * pg_restore --list and --use-list.
+ */
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type ListEntry struct {
+	ID              int
+	Section         string
+	ObjectType      string
+	Schema          string
+	Name            string
+	ReferenceObject string
+	index           int
+}
+
+var listSections = []string{"global", "predata", "data", "postdata", "statistics"}
+
+/*
+ * Entries are numbered in the order they are restored: global metadata,
+ * pre-data metadata, table data, post-data metadata, and then statistics.
+ * The numbering depends only on the contents of the backup, so a list file
+ * can be used for any restore of the backup it was generated from.
+ */
+func (toc *TOC) GetListEntries(dataEntries []MasterDataEntry) []ListEntry {
+	entries := make([]ListEntry, 0)
+	for _, section := range listSections {
+		if section == "data" {
+			for i, entry := range dataEntries {
+				entries = append(entries, ListEntry{ID: len(entries) + 1, Section: section, ObjectType: "TABLE DATA", Schema: entry.Schema, Name: entry.Name, index: i})
+			}
+			continue
+		}
+		for i, entry := range *toc.metadataEntryMap[section] {
+			entries = append(entries, ListEntry{ID: len(entries) + 1, Section: section, ObjectType: entry.ObjectType, Schema: entry.Schema,
+				Name: entry.Name, ReferenceObject: entry.ReferenceObject, index: i})
+		}
+	}
+	return entries
+}
+
+func WriteListEntries(writer io.Writer, entries []ListEntry) error {
+	for _, entry := range entries {
+		line := fmt.Sprintf("%d; %s; %s; %s; %s; %s", entry.ID, entry.Section, entry.ObjectType, entry.Schema, entry.Name, entry.ReferenceObject)
+		_, err := fmt.Fprintln(writer, strings.TrimRight(line, " "))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var listEntryID = regexp.MustCompile(`^\s*(\d+)\s*;`)
+
+/*
+ * Returns the IDs of the entries in a list file in the order they appear.
+ * Lines starting with a semicolon are comments, so entries can be left out
+ * of a restore by commenting them out.
+ */
+func ReadListFile(filename string) ([]int, error) {
+	contents, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]int, 0)
+	for i, line := range strings.Split(string(contents), "\n") {
+		trimmedLine := strings.TrimSpace(line)
+		if trimmedLine == "" || strings.HasPrefix(trimmedLine, ";") {
+			continue
+		}
+		matches := listEntryID.FindStringSubmatch(line)
+		if matches == nil {
+			return nil, errors.Errorf("Invalid entry on line %d of list file %s: %s", i+1, filename, trimmedLine)
+		}
+		id, err := strconv.Atoi(matches[1])
+		if err != nil {
+			return nil, errors.Errorf("Invalid entry on line %d of list file %s: %s", i+1, filename, trimmedLine)
+		}
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
+
+/*
+ * Reduces the metadata sections of the TOC to the selected entries, in the
+ * order they were selected, and returns the selected data entries in order.
+ * Session GUCs are always kept, as every restore connection needs them.
+ */
+func (toc *TOC) SelectListEntries(entries []ListEntry, ids []int) ([]ListEntry, error) {
+	entriesByID := make(map[int]ListEntry, len(entries))
+	for _, entry := range entries {
+		entriesByID[entry.ID] = entry
+	}
+	selectedIDs := make(map[int]bool, len(ids))
+	selectedEntries := make(map[string][]MetadataEntry)
+	dataEntries := make([]ListEntry, 0)
+	for _, entry := range *toc.metadataEntryMap["global"] {
+		if entry.ObjectType == "SESSION GUCS" {
+			selectedEntries["global"] = append(selectedEntries["global"], entry)
+		}
+	}
+	for _, id := range ids {
+		entry, ok := entriesByID[id]
+		if !ok {
+			return nil, errors.Errorf("Entry %d in list file does not exist in the backup", id)
+		}
+		if selectedIDs[id] {
+			return nil, errors.Errorf("Entry %d appears more than once in list file", id)
+		}
+		selectedIDs[id] = true
+		if entry.Section == "data" {
+			dataEntries = append(dataEntries, entry)
+			continue
+		}
+		metadataEntry := (*toc.metadataEntryMap[entry.Section])[entry.index]
+		if metadataEntry.ObjectType != "SESSION GUCS" {
+			selectedEntries[entry.Section] = append(selectedEntries[entry.Section], metadataEntry)
+		}
+	}
+	for _, section := range listSections {
+		if section != "data" {
+			*toc.metadataEntryMap[section] = selectedEntries[section]
+		}
+	}
+	return dataEntries, nil
+}
@@ -0,0 +1,94 @@
+package toc_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/toc"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("toc/listing tests", func() {
+	var tocfile *toc.TOC
+	dataEntries := []toc.MasterDataEntry{{Schema: "public", Name: "foo", Oid: 1}, {Schema: "public", Name: "bar", Oid: 2}}
+	BeforeEach(func() {
+		tocfile, _ = testutils.InitializeTestTOC(buffer, "predata")
+		tocfile.AddMetadataEntry("global", toc.MetadataEntry{ObjectType: "SESSION GUCS"}, 0, 10)
+		tocfile.AddMetadataEntry("global", toc.MetadataEntry{Name: "testrole", ObjectType: "ROLE"}, 10, 20)
+		tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "foo", ObjectType: "TABLE"}, 20, 30)
+		tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "public", Name: "bar", ObjectType: "TABLE"}, 30, 40)
+		tocfile.AddMetadataEntry("postdata", toc.MetadataEntry{Schema: "public", Name: "foo_idx", ObjectType: "INDEX", ReferenceObject: "public.foo"}, 40, 50)
+	})
+	writeListFile := func(contents string) string {
+		file, err := ioutil.TempFile("/tmp", "gpbackup_test_list*.txt")
+		Expect(err).To(Not(HaveOccurred()))
+		_, err = file.WriteString(contents)
+		Expect(err).To(Not(HaveOccurred()))
+		Expect(file.Close()).To(Succeed())
+		return file.Name()
+	}
+	Describe("GetListEntries", func() {
+		It("numbers entries in restore order", func() {
+			entries := tocfile.GetListEntries(dataEntries)
+
+			listBuffer := bytes.NewBuffer(nil)
+			Expect(toc.WriteListEntries(listBuffer, entries)).To(Succeed())
+			Expect(listBuffer.String()).To(Equal(`1; global; SESSION GUCS; ; ;
+2; global; ROLE; ; testrole;
+3; predata; TABLE; public; foo;
+4; predata; TABLE; public; bar;
+5; data; TABLE DATA; public; foo;
+6; data; TABLE DATA; public; bar;
+7; postdata; INDEX; public; foo_idx; public.foo
+`))
+		})
+	})
+	Describe("ReadListFile", func() {
+		It("returns the IDs of uncommented entries in order", func() {
+			filename := writeListFile(";\n; Backup timestamp: 20170101010101\n;\n4; predata; TABLE; public; bar;\n;3; predata; TABLE; public; foo;\n\n  2; global; ROLE; ; testrole;\n")
+			defer os.Remove(filename)
+
+			ids, err := toc.ReadListFile(filename)
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(ids).To(Equal([]int{4, 2}))
+		})
+		It("returns an error for a line that is not an entry or a comment", func() {
+			filename := writeListFile("3; predata; TABLE; public; foo;\nCREATE TABLE public.foo();\n")
+			defer os.Remove(filename)
+
+			_, err := toc.ReadListFile(filename)
+
+			Expect(err).To(MatchError(ContainSubstring("Invalid entry on line 2 of list file")))
+		})
+	})
+	Describe("SelectListEntries", func() {
+		It("keeps only the selected entries in the selected order", func() {
+			selectedData, err := tocfile.SelectListEntries(tocfile.GetListEntries(dataEntries), []int{4, 6, 3, 7})
+
+			Expect(err).To(Not(HaveOccurred()))
+			Expect(tocfile.GlobalEntries).To(HaveLen(1))
+			Expect(tocfile.GlobalEntries[0].ObjectType).To(Equal("SESSION GUCS"))
+			Expect(tocfile.PredataEntries).To(HaveLen(2))
+			Expect(tocfile.PredataEntries[0].Name).To(Equal("bar"))
+			Expect(tocfile.PredataEntries[1].Name).To(Equal("foo"))
+			Expect(tocfile.PostdataEntries).To(HaveLen(1))
+			Expect(selectedData).To(HaveLen(1))
+			Expect(selectedData[0].Name).To(Equal("bar"))
+		})
+		It("returns an error for an entry that is not in the backup", func() {
+			_, err := tocfile.SelectListEntries(tocfile.GetListEntries(dataEntries), []int{3, 8})
+
+			Expect(err).To(MatchError("Entry 8 in list file does not exist in the backup"))
+		})
+		It("returns an error for an entry that is listed twice", func() {
+			_, err := tocfile.SelectListEntries(tocfile.GetListEntries(dataEntries), []int{3, 3})
+
+			Expect(err).To(MatchError("Entry 3 appears more than once in list file"))
+		})
+	})
+})
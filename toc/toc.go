@@ -1,10 +1,10 @@
 package toc
 
 import (
-	"fmt"
 	"io"
 	"io/ioutil"
 	"regexp"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 	"github.com/greenplum-db/gpbackup/utils"
@@ -19,6 +19,7 @@ type TOC struct {
 	StatisticsEntries   []MetadataEntry
 	DataEntries         []MasterDataEntry
 	IncrementalMetadata IncrementalEntries
+	ReferencesRecorded  bool `yaml:",omitempty"`
 }
 
 type SegmentTOC struct {
@@ -32,6 +33,19 @@ type MetadataEntry struct {
 	ReferenceObject string
 	StartByte       uint64
 	EndByte         uint64
+	ObjectID        UniqueID              `yaml:",omitempty"`
+	Dependencies    []UniqueID            `yaml:",omitempty"`
+	References      []IdentifierReference `yaml:",omitempty"`
+}
+
+/*
+ * Identifies a database object by the oid of the catalog table it is stored
+ * in and its own oid, as in pg_depend.  Only pre-data objects that are sorted
+ * by their dependencies are written to the TOC with an ObjectID.
+ */
+type UniqueID struct {
+	ClassID uint32
+	Oid     uint32
 }
 
 type MasterDataEntry struct {
@@ -41,6 +55,8 @@ type MasterDataEntry struct {
 	AttributeString string
 	RowsCopied      int64
 	PartitionRoot   string
+	Predicate       string            `yaml:",omitempty"`
+	MaskedColumns   map[string]string `yaml:",omitempty"`
 }
 
 type SegmentDataEntry struct {
@@ -96,6 +112,8 @@ type StatementWithType struct {
 	ObjectType      string
 	ReferenceObject string
 	Statement       string
+	ObjectID        UniqueID
+	References      []IdentifierReference
 }
 
 func GetIncludedPartitionRoots(tocDataEntries []MasterDataEntry, includeRelations []string) []string {
@@ -130,7 +148,12 @@ func (toc *TOC) GetSQLStatementForObjectTypes(section string, metadataFile io.Re
 			contents := make([]byte, entry.EndByte-entry.StartByte)
 			_, err := metadataFile.ReadAt(contents, int64(entry.StartByte))
 			gplog.FatalOnError(err)
-			statements = append(statements, StatementWithType{Schema: entry.Schema, Name: entry.Name, ObjectType: entry.ObjectType, ReferenceObject: entry.ReferenceObject, Statement: string(contents)})
+			references := entry.References
+			if references == nil && toc.ReferencesRecorded {
+				// The statement was printed without any names that a redirect rewrites
+				references = []IdentifierReference{}
+			}
+			statements = append(statements, StatementWithType{Schema: entry.Schema, Name: entry.Name, ObjectType: entry.ObjectType, ReferenceObject: entry.ReferenceObject, Statement: string(contents), ObjectID: entry.ObjectID, References: references})
 		}
 	}
 	return statements
@@ -185,8 +208,75 @@ func getLeafPartitions(tableFQNs []string, tocDataEntries []MasterDataEntry) (le
 	return leafPartitions
 }
 
+/*
+ * Returns the relations and schemas in the TOC as maps from their unquoted
+ * names, which filter patterns match, to their quoted names, in which they are
+ * added to filter lists.  Leaf partitions are left out, as they are filtered
+ * along with their root partition.
+ */
+func (toc *TOC) GetRelationsAndSchemas() (map[string]string, map[string]string) {
+	relations := make(map[string]string)
+	schemas := make(map[string]string)
+	addRelation := func(schema string, name string) {
+		relations[utils.UnquoteIdent(schema)+"."+utils.UnquoteIdent(name)] = utils.MakeFQN(schema, name)
+		schemas[utils.UnquoteIdent(schema)] = schema
+	}
+	for _, entry := range toc.PredataEntries {
+		switch entry.ObjectType {
+		case "SCHEMA":
+			schemas[utils.UnquoteIdent(entry.Name)] = entry.Name
+		case "TABLE", "SEQUENCE", "VIEW", "MATERIALIZED VIEW":
+			addRelation(entry.Schema, entry.Name)
+		default:
+			if entry.Schema != "" {
+				schemas[utils.UnquoteIdent(entry.Schema)] = entry.Schema
+			}
+		}
+	}
+	for _, entry := range toc.DataEntries {
+		if entry.PartitionRoot == "" {
+			addRelation(entry.Schema, entry.Name)
+		}
+	}
+	return relations, schemas
+}
+
+/*
+ * Replaces each filter pattern in a filter list with the candidates it
+ * matches.  A pattern that matches nothing, or is invalid, is kept in the
+ * list, where it matches no name, so that an include list of patterns
+ * matching nothing does not turn into an empty list, which matches every name.
+ */
+func expandFilterPatterns(names []string, candidates map[string]string) []string {
+	expanded := make([]string, 0, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, utils.GlobPatternPrefix) && !strings.HasPrefix(name, utils.RegexPatternPrefix) {
+			expanded = append(expanded, name)
+			continue
+		}
+		matches, _, err := utils.MatchFilterPatterns(candidates, []string{name})
+		if err != nil || len(matches) == 0 {
+			expanded = append(expanded, name)
+			continue
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded
+}
+
+/*
+ * The schema and table filter lists may contain filter patterns, such as
+ * "glob:sales.orders_2026*", which are resolved against the entries of this
+ * TOC, so that each backup of an incremental set is filtered by the tables it
+ * contains.
+ */
 func (toc *TOC) GetDataEntriesMatching(includeSchemas []string, excludeSchemas []string,
 	includeTableFQNs []string, excludeTableFQNs []string, restorePlanTableFQNs []string) []MasterDataEntry {
+	relations, schemas := toc.GetRelationsAndSchemas()
+	includeSchemas = expandFilterPatterns(includeSchemas, schemas)
+	excludeSchemas = expandFilterPatterns(excludeSchemas, schemas)
+	includeTableFQNs = expandFilterPatterns(includeTableFQNs, relations)
+	excludeTableFQNs = expandFilterPatterns(excludeTableFQNs, relations)
 
 	schemaSet := utils.NewIncludeSet([]string{})
 	if len(includeSchemas) > 0 {
@@ -220,17 +310,6 @@ func (toc *TOC) GetDataEntriesMatching(includeSchemas []string, excludeSchemas [
 	return matchingEntries
 }
 
-func SubstituteRedirectDatabaseInStatements(statements []StatementWithType, oldQuotedName string, newQuotedName string) []StatementWithType {
-	shouldReplace := map[string]bool{"DATABASE GUC": true, "DATABASE": true, "DATABASE METADATA": true}
-	pattern := regexp.MustCompile(fmt.Sprintf("DATABASE %s(;| OWNER| SET| TO| FROM| IS| TEMPLATE)", regexp.QuoteMeta(oldQuotedName)))
-	for i := range statements {
-		if shouldReplace[statements[i].ObjectType] {
-			statements[i].Statement = pattern.ReplaceAllString(statements[i].Statement, fmt.Sprintf("DATABASE %s$1", newQuotedName))
-		}
-	}
-	return statements
-}
-
 func RemoveActiveRole(activeUser string, statements []StatementWithType) []StatementWithType {
 	newStatements := make([]StatementWithType, 0)
 	for _, statement := range statements {
@@ -265,11 +344,223 @@ func (toc *TOC) AddMetadataEntry(section string, entry MetadataEntry, start, end
 	*toc.metadataEntryMap[section] = append(*toc.metadataEntryMap[section], entry)
 }
 
-func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string) {
-	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot})
+func (toc *TOC) AddMasterDataEntry(schema string, name string, oid uint32, attributeString string, rowsCopied int64, PartitionRoot string, predicate string, maskedColumns map[string]string) {
+	toc.DataEntries = append(toc.DataEntries, MasterDataEntry{schema, name, oid, attributeString, rowsCopied, PartitionRoot, predicate, maskedColumns})
+}
+
+// Sets the dependency information for the pre-data entries from index start onward, which were all written for one object
+func (toc *TOC) SetPredataEntryDependencies(start int, objectID UniqueID, dependencies []UniqueID) {
+	for i := start; i < len(toc.PredataEntries); i++ {
+		toc.PredataEntries[i].ObjectID = objectID
+		toc.PredataEntries[i].Dependencies = dependencies
+	}
+}
+
+// Returns the dependencies of each pre-data object that was written with dependency information
+func (toc *TOC) GetPredataDependencies() map[UniqueID][]UniqueID {
+	dependencies := make(map[UniqueID][]UniqueID)
+	for _, entry := range toc.PredataEntries {
+		if entry.ObjectID != (UniqueID{}) {
+			dependencies[entry.ObjectID] = entry.Dependencies
+		}
+	}
+	return dependencies
 }
 
 func (toc *SegmentTOC) AddSegmentDataEntry(oid uint, startByte uint64, endByte uint64) {
 	// We use uint for oid since the flags package does not have a uint32 flag
 	toc.DataEntries[oid] = SegmentDataEntry{startByte, endByte}
 }
+
+/*
+ * Comments, owners, privileges, and security labels are written to the TOC
+ * under the object type of the object they belong to, so they are identified
+ * by the leading keywords of the statement instead.  These "pseudo types" can
+ * be passed to the object type filters alongside regular object types.
+ */
+var MetadataPseudoTypes = []string{"ACL", "COMMENT", "OWNER", "SECURITY LABEL"}
+
+var ObjectTypes = []string{"SESSION GUCS", "DATABASE GUC", "DATABASE", "DATABASE METADATA",
+	"RESOURCE QUEUE", "RESOURCE GROUP", "ROLE", "ROLE GUCS", "ROLE GRANT", "TABLESPACE",
+	"SCHEMA", "EXTENSION", "COLLATION", "TYPE", "DOMAIN", "LANGUAGE", "FUNCTION", "AGGREGATE",
+	"CAST", "PROTOCOL", "TABLE", "FOREIGN TABLE", "VIEW", "MATERIALIZED VIEW", "SEQUENCE",
+	"SEQUENCE OWNER", "TEXT SEARCH PARSER", "TEXT SEARCH TEMPLATE", "TEXT SEARCH DICTIONARY",
+	"TEXT SEARCH CONFIGURATION", "OPERATOR", "OPERATOR FAMILY", "OPERATOR CLASS", "CONVERSION",
+	"FOREIGN DATA WRAPPER", "FOREIGN SERVER", "USER MAPPING", "EXCHANGE PARTITION", "CONSTRAINT",
+	"INDEX", "RULE", "TRIGGER", "EVENT TRIGGER", "DEFAULT PRIVILEGES", "STATISTICS"}
+
+/*
+ * The object types each object type may depend on.  This is intentionally
+ * coarse, as the TOC does not record dependencies between individual objects;
+ * it is only used to warn users that an object type filter may leave objects
+ * without something they need.
+ */
+var objectTypeDependencies = map[string][]string{
+	"ACL":                       {"ROLE"},
+	"OWNER":                     {"ROLE"},
+	"ROLE GUCS":                 {"ROLE"},
+	"ROLE GRANT":                {"ROLE"},
+	"DEFAULT PRIVILEGES":        {"ROLE", "SCHEMA"},
+	"EXTENSION":                 {"SCHEMA"},
+	"COLLATION":                 {"SCHEMA"},
+	"TYPE":                      {"SCHEMA", "FUNCTION"},
+	"DOMAIN":                    {"SCHEMA", "TYPE", "FUNCTION", "COLLATION"},
+	"LANGUAGE":                  {"FUNCTION"},
+	"FUNCTION":                  {"SCHEMA", "TYPE", "LANGUAGE"},
+	"AGGREGATE":                 {"SCHEMA", "TYPE", "FUNCTION", "OPERATOR"},
+	"CAST":                      {"TYPE", "FUNCTION"},
+	"PROTOCOL":                  {"FUNCTION"},
+	"TABLE":                     {"SCHEMA", "TYPE", "DOMAIN", "FUNCTION", "COLLATION", "SEQUENCE", "PROTOCOL", "TABLESPACE"},
+	"FOREIGN TABLE":             {"SCHEMA", "TYPE", "DOMAIN", "FOREIGN SERVER"},
+	"VIEW":                      {"SCHEMA", "TABLE", "FOREIGN TABLE", "VIEW", "MATERIALIZED VIEW", "FUNCTION", "TYPE"},
+	"MATERIALIZED VIEW":         {"SCHEMA", "TABLE", "FOREIGN TABLE", "VIEW", "MATERIALIZED VIEW", "FUNCTION", "TYPE", "TABLESPACE"},
+	"SEQUENCE":                  {"SCHEMA"},
+	"SEQUENCE OWNER":            {"SEQUENCE", "TABLE"},
+	"TEXT SEARCH PARSER":        {"SCHEMA", "FUNCTION"},
+	"TEXT SEARCH TEMPLATE":      {"SCHEMA", "FUNCTION"},
+	"TEXT SEARCH DICTIONARY":    {"SCHEMA", "TEXT SEARCH TEMPLATE"},
+	"TEXT SEARCH CONFIGURATION": {"SCHEMA", "TEXT SEARCH PARSER", "TEXT SEARCH DICTIONARY"},
+	"OPERATOR":                  {"SCHEMA", "TYPE", "FUNCTION"},
+	"OPERATOR FAMILY":           {"SCHEMA"},
+	"OPERATOR CLASS":            {"SCHEMA", "TYPE", "OPERATOR", "OPERATOR FAMILY", "FUNCTION"},
+	"CONVERSION":                {"SCHEMA", "FUNCTION"},
+	"FOREIGN DATA WRAPPER":      {"FUNCTION"},
+	"FOREIGN SERVER":            {"FOREIGN DATA WRAPPER"},
+	"USER MAPPING":              {"FOREIGN SERVER"},
+	"EXCHANGE PARTITION":        {"TABLE"},
+	"CONSTRAINT":                {"TABLE", "DOMAIN", "FUNCTION", "INDEX"},
+	"INDEX":                     {"TABLE", "MATERIALIZED VIEW", "FUNCTION", "OPERATOR CLASS", "TABLESPACE"},
+	"RULE":                      {"TABLE", "VIEW", "FUNCTION"},
+	"TRIGGER":                   {"TABLE", "FUNCTION"},
+	"EVENT TRIGGER":             {"FUNCTION"},
+	"STATISTICS":                {"TABLE"},
+}
+
+var ownerStatementRegex = regexp.MustCompile(`^ALTER .+ OWNER TO `)
+
+/*
+ * Returns the metadata pseudo type of a statement, or an empty string if the
+ * statement creates or alters the object itself.
+ */
+func GetMetadataPseudoType(objectType string, statement string) string {
+	if objectType == "ROLE GRANT" || objectType == "DEFAULT PRIVILEGES" {
+		return ""
+	}
+	statement = strings.TrimSpace(statement)
+	switch {
+	case strings.HasPrefix(statement, "COMMENT ON "):
+		return "COMMENT"
+	case strings.HasPrefix(statement, "SECURITY LABEL "):
+		return "SECURITY LABEL"
+	case strings.HasPrefix(statement, "REVOKE "), strings.HasPrefix(statement, "GRANT "):
+		return "ACL"
+	case ownerStatementRegex.MatchString(statement):
+		return "OWNER"
+	}
+	return ""
+}
+
+func NewObjectTypeSet(includeObjectTypes []string, excludeObjectTypes []string) *utils.FilterSet {
+	if len(includeObjectTypes) > 0 {
+		return utils.NewIncludeSet(includeObjectTypes)
+	}
+	return utils.NewExcludeSet(excludeObjectTypes)
+}
+
+/*
+ * A comment, owner, privilege, or security label statement is included if its
+ * object is included or its pseudo type is explicitly included, so that e.g.
+ * including only ACL returns every GRANT regardless of the object type, and is
+ * excluded if either its object type or its pseudo type is excluded.
+ */
+func ShouldIncludeObjectType(objectSet *utils.FilterSet, objectType string, statement string) bool {
+	pseudoType := GetMetadataPseudoType(objectType, statement)
+	if pseudoType == "" {
+		return objectSet.MatchesFilter(objectType)
+	}
+	if objectSet.IsExclude {
+		return objectSet.MatchesFilter(objectType) && objectSet.MatchesFilter(pseudoType)
+	}
+	return objectSet.MatchesFilter(objectType) || objectSet.MatchesFilter(pseudoType)
+}
+
+func FilterStatementsByObjectType(statements []StatementWithType, includeObjectTypes []string, excludeObjectTypes []string) []StatementWithType {
+	objectSet := NewObjectTypeSet(includeObjectTypes, excludeObjectTypes)
+	filteredStatements := make([]StatementWithType, 0)
+	for _, statement := range statements {
+		if ShouldIncludeObjectType(objectSet, statement.ObjectType, statement.Statement) {
+			filteredStatements = append(filteredStatements, statement)
+		}
+	}
+	return filteredStatements
+}
+
+/*
+ * The data of a table filtered out by object type could not be restored
+ * without the table, so it is filtered out as well, as gpbackup does when
+ * backing up.  Every data entry is of a table, as the partitions whose data is
+ * backed up are created along with their root table.
+ */
+func FilterDataEntriesByObjectType(entries []MasterDataEntry, includeObjectTypes []string, excludeObjectTypes []string) []MasterDataEntry {
+	if NewObjectTypeSet(includeObjectTypes, excludeObjectTypes).MatchesFilter("TABLE") {
+		return entries
+	}
+	return []MasterDataEntry{}
+}
+
+/*
+ * For each of the given object types that is included by objectSet, returns
+ * the object types it may depend on that objectSet filters out.
+ */
+func GetExcludedDependencyTypes(objectTypes []string, objectSet *utils.FilterSet) map[string][]string {
+	excludedDependencies := make(map[string][]string)
+	if objectSet.AlwaysMatchesFilter {
+		return excludedDependencies
+	}
+	for _, objectType := range objectTypes {
+		if !objectSet.MatchesFilter(objectType) {
+			continue
+		}
+		for _, dependencyType := range objectTypeDependencies[objectType] {
+			if dependencyType != objectType && !objectSet.MatchesFilter(dependencyType) {
+				excludedDependencies[objectType] = append(excludedDependencies[objectType], dependencyType)
+			}
+		}
+	}
+	return excludedDependencies
+}
+
+/*
+ * Warns about included object types that may depend on filtered-out object
+ * types.  If availableTypes is non-nil, only filtered-out object types in that
+ * list are reported, e.g. the object types actually present in a backup.
+ */
+func LogExcludedDependencyWarnings(objectTypes []string, objectSet *utils.FilterSet, availableTypes []string) {
+	excludedDependencies := GetExcludedDependencyTypes(objectTypes, objectSet)
+	for _, objectType := range objectTypes {
+		dependencyTypes := make([]string, 0)
+		for _, dependencyType := range excludedDependencies[objectType] {
+			if availableTypes == nil || utils.Exists(availableTypes, dependencyType) {
+				dependencyTypes = append(dependencyTypes, dependencyType)
+			}
+		}
+		if len(dependencyTypes) > 0 {
+			gplog.Warn("Objects of type %s may depend on objects of type(s) %s, which are filtered out by the object type filter", objectType, strings.Join(dependencyTypes, ", "))
+		}
+	}
+}
+
+// Returns the distinct object types in the metadata sections of the TOC, in the order they appear
+func (toc *TOC) GetMetadataObjectTypes() []string {
+	objectTypes := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, entries := range [][]MetadataEntry{toc.GlobalEntries, toc.PredataEntries, toc.PostdataEntries, toc.StatisticsEntries} {
+		for _, entry := range entries {
+			if !seen[entry.ObjectType] {
+				seen[entry.ObjectType] = true
+				objectTypes = append(objectTypes, entry.ObjectType)
+			}
+		}
+	}
+	return objectTypes
+}
@@ -195,11 +195,11 @@ var _ = Describe("utils/toc tests", func() {
 	})
 	Describe("GetDataEntriesMatching", func() {
 		BeforeEach(func() {
-			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema2", "table2", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema3", "table3", 1, "(i)", 0, "")
-			tocfile.AddMasterDataEntry("schema3", "table3_partition1", 1, "(i)", 0, "table3")
-			tocfile.AddMasterDataEntry("schema3", "table3_partition2", 1, "(i)", 0, "table3")
+			tocfile.AddMasterDataEntry("schema1", "table1", 1, "(i)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("schema2", "table2", 1, "(i)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "table3", 1, "(i)", 0, "", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "table3_partition1", 1, "(i)", 0, "table3", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "table3_partition2", 1, "(i)", 0, "table3", "", nil)
 		})
 		Context("Non-empty restore plan", func() {
 			restorePlanTableFQNs := []string{"schema1.table1", "schema2.table2", "schema3.table3", "schema3.table3_partition1", "schema3.table3_partition2"}
@@ -231,6 +231,30 @@ var _ = Describe("utils/toc tests", func() {
 					},
 				))
 			})
+			It("returns the entries matching an include table pattern along with their leaf partitions", func() {
+				matchingEntries := tocfile.GetDataEntriesMatching([]string{}, []string{},
+					[]string{"glob:schema3.table*"}, []string{}, restorePlanTableFQNs)
+
+				Expect(matchingEntries).To(ConsistOf(
+					[]toc.MasterDataEntry{
+						{Schema: "schema3", Name: "table3", Oid: 1, AttributeString: "(i)"},
+						{Schema: "schema3", Name: "table3_partition1", Oid: 1, AttributeString: "(i)", PartitionRoot: "table3"},
+						{Schema: "schema3", Name: "table3_partition2", Oid: 1, AttributeString: "(i)", PartitionRoot: "table3"},
+					},
+				))
+			})
+			It("returns the entries not matching an exclude schema pattern", func() {
+				matchingEntries := tocfile.GetDataEntriesMatching([]string{}, []string{"regex:schema[23]"},
+					[]string{}, []string{}, restorePlanTableFQNs)
+
+				Expect(matchingEntries).To(Equal([]toc.MasterDataEntry{{Schema: "schema1", Name: "table1", Oid: 1, AttributeString: "(i)"}}))
+			})
+			It("returns no entries for an include table pattern matching no table", func() {
+				matchingEntries := tocfile.GetDataEntriesMatching([]string{}, []string{},
+					[]string{"glob:schema9.*"}, []string{}, restorePlanTableFQNs)
+
+				Expect(matchingEntries).To(BeEmpty())
+			})
 			It("returns matching entry on include table", func() {
 				includeTables := []string{"schema1.table1"}
 
@@ -341,6 +365,99 @@ var _ = Describe("utils/toc tests", func() {
 			})
 		})
 	})
+	Describe("GetMetadataPseudoType", func() {
+		It("identifies comment, owner, privileges, and security label statements", func() {
+			Expect(toc.GetMetadataPseudoType("TABLE", "\n\nCOMMENT ON TABLE schema.table1 IS 'comment';\n")).To(Equal("COMMENT"))
+			Expect(toc.GetMetadataPseudoType("TABLE", "ALTER TABLE schema.table1 OWNER TO testrole;")).To(Equal("OWNER"))
+			Expect(toc.GetMetadataPseudoType("TABLE", "REVOKE ALL ON TABLE schema.table1 FROM PUBLIC;\nGRANT ALL ON TABLE schema.table1 TO testrole;")).To(Equal("ACL"))
+			Expect(toc.GetMetadataPseudoType("TABLE", "SECURITY LABEL FOR dummy ON TABLE schema.table1 IS 'unclassified';")).To(Equal("SECURITY LABEL"))
+		})
+		It("does not identify object definitions as pseudo types", func() {
+			Expect(toc.GetMetadataPseudoType("TABLE", "CREATE TABLE schema.table1 (i int);")).To(Equal(""))
+			Expect(toc.GetMetadataPseudoType("TABLE", "ALTER TABLE schema.table1 SET SCHEMA schema2;")).To(Equal(""))
+			Expect(toc.GetMetadataPseudoType("ROLE GRANT", "GRANT role1 TO role2;")).To(Equal(""))
+			Expect(toc.GetMetadataPseudoType("DEFAULT PRIVILEGES", "GRANT ALL ON TABLES TO testrole;")).To(Equal(""))
+		})
+	})
+	Describe("FilterStatementsByObjectType", func() {
+		function := toc.StatementWithType{Schema: "schema", Name: "func", ObjectType: "FUNCTION", Statement: "CREATE FUNCTION schema.func() RETURNS integer AS 'SELECT 1' LANGUAGE sql;"}
+		tableComment := toc.StatementWithType{Schema: "schema", Name: "table1", ObjectType: "TABLE", Statement: "COMMENT ON TABLE schema.table1 IS 'comment';"}
+		tableACL := toc.StatementWithType{Schema: "schema", Name: "table1", ObjectType: "TABLE", Statement: "REVOKE ALL ON TABLE schema.table1 FROM PUBLIC;"}
+		functionACL := toc.StatementWithType{Schema: "schema", Name: "func", ObjectType: "FUNCTION", Statement: "GRANT ALL ON FUNCTION schema.func() TO testrole;"}
+		statements := []toc.StatementWithType{table1, tableComment, tableACL, function, functionACL}
+
+		It("returns all statements when no object types are specified", func() {
+			Expect(toc.FilterStatementsByObjectType(statements, []string{}, []string{})).To(Equal(statements))
+		})
+		It("returns an object and its metadata when its object type is included", func() {
+			Expect(toc.FilterStatementsByObjectType(statements, []string{"TABLE"}, []string{})).To(Equal([]toc.StatementWithType{table1, tableComment, tableACL}))
+		})
+		It("returns metadata statements for every object type when a pseudo type is included", func() {
+			Expect(toc.FilterStatementsByObjectType(statements, []string{"ACL"}, []string{})).To(Equal([]toc.StatementWithType{tableACL, functionACL}))
+		})
+		It("does not return an object or its metadata when its object type is excluded", func() {
+			Expect(toc.FilterStatementsByObjectType(statements, []string{}, []string{"FUNCTION"})).To(Equal([]toc.StatementWithType{table1, tableComment, tableACL}))
+		})
+		It("does not return metadata statements when a pseudo type is excluded", func() {
+			Expect(toc.FilterStatementsByObjectType(statements, []string{}, []string{"ACL", "COMMENT"})).To(Equal([]toc.StatementWithType{table1, function}))
+		})
+	})
+	Describe("FilterDataEntriesByObjectType", func() {
+		entries := []toc.MasterDataEntry{{Schema: "schema", Name: "table1", Oid: 1}, {Schema: "schema", Name: "table2", Oid: 2}}
+
+		It("returns every data entry when no object types are specified", func() {
+			Expect(toc.FilterDataEntriesByObjectType(entries, []string{}, []string{})).To(Equal(entries))
+		})
+		It("returns every data entry when tables are included", func() {
+			Expect(toc.FilterDataEntriesByObjectType(entries, []string{"TABLE", "FUNCTION"}, []string{})).To(Equal(entries))
+		})
+		It("returns no data entries when tables are not included", func() {
+			Expect(toc.FilterDataEntriesByObjectType(entries, []string{"FUNCTION"}, []string{})).To(BeEmpty())
+		})
+		It("returns no data entries when tables are excluded", func() {
+			Expect(toc.FilterDataEntriesByObjectType(entries, []string{}, []string{"TABLE"})).To(BeEmpty())
+		})
+	})
+	Describe("GetExcludedDependencyTypes", func() {
+		It("returns nothing when no object types are filtered", func() {
+			dependencies := toc.GetExcludedDependencyTypes([]string{"TABLE", "TRIGGER"}, toc.NewObjectTypeSet([]string{}, []string{}))
+			Expect(dependencies).To(BeEmpty())
+		})
+		It("returns excluded object types that included object types may depend on", func() {
+			dependencies := toc.GetExcludedDependencyTypes([]string{"TABLE", "TRIGGER", "FUNCTION"}, toc.NewObjectTypeSet([]string{}, []string{"FUNCTION"}))
+			Expect(dependencies).To(HaveLen(2))
+			Expect(dependencies["TABLE"]).To(Equal([]string{"FUNCTION"}))
+			Expect(dependencies["TRIGGER"]).To(Equal([]string{"FUNCTION"}))
+		})
+		It("returns object types missing from an include list", func() {
+			dependencies := toc.GetExcludedDependencyTypes([]string{"SCHEMA", "TRIGGER", "FUNCTION"}, toc.NewObjectTypeSet([]string{"SCHEMA", "TRIGGER"}, []string{}))
+			Expect(dependencies).To(Equal(map[string][]string{"TRIGGER": {"TABLE", "FUNCTION"}}))
+		})
+	})
+	Describe("GetPredataDependencies", func() {
+		It("returns the dependencies recorded for each pre-data object", func() {
+			typeID := toc.UniqueID{ClassID: 1247, Oid: 1}
+			tableID := toc.UniqueID{ClassID: 1259, Oid: 2}
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "conversion", ObjectType: "CONVERSION"}, 0, 1)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "type", ObjectType: "TYPE"}, 1, 2)
+			tocfile.SetPredataEntryDependencies(1, typeID, []toc.UniqueID{})
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE"}, 2, 3)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE"}, 3, 4)
+			tocfile.SetPredataEntryDependencies(2, tableID, []toc.UniqueID{typeID})
+
+			Expect(tocfile.PredataEntries[0].ObjectID).To(Equal(toc.UniqueID{}))
+			Expect(tocfile.PredataEntries[3].ObjectID).To(Equal(tableID))
+			Expect(tocfile.GetPredataDependencies()).To(Equal(map[toc.UniqueID][]toc.UniqueID{typeID: {}, tableID: {typeID}}))
+		})
+	})
+	Describe("GetMetadataObjectTypes", func() {
+		It("returns the distinct object types in the metadata sections", func() {
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table1", ObjectType: "TABLE"}, 0, 1)
+			tocfile.AddMetadataEntry("predata", toc.MetadataEntry{Schema: "schema", Name: "table2", ObjectType: "TABLE"}, 1, 2)
+			tocfile.AddMetadataEntry("postdata", toc.MetadataEntry{Schema: "schema", Name: "someindex", ObjectType: "INDEX"}, 2, 3)
+			Expect(tocfile.GetMetadataObjectTypes()).To(Equal([]string{"TABLE", "INDEX"}))
+		})
+	})
 	Describe("SubstituteRedirectDatabaseInStatements", func() {
 		create := toc.StatementWithType{Schema: "", Name: "somedatabase", ObjectType: "DATABASE", Statement: "CREATE DATABASE somedatabase TEMPLATE template0;\n"}
 		wrongCreate := toc.StatementWithType{ObjectType: "TABLE", Statement: "CREATE DATABASE somedatabase;\n"}
@@ -400,22 +517,22 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 	})
 	Describe("GetIncludedPartitionRoots", func() {
 		It("does not return anything if relations are not leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", "", nil)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema0.name0", "schema1.name1"})
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns root parition of leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 2, "attribute0", 1, "root0")
-			tocfile.AddMasterDataEntry("schema1", "name1", 3, "attribute0", 1, "root1")
+			tocfile.AddMasterDataEntry("schema0", "name0", 2, "attribute0", 1, "root0", "", nil)
+			tocfile.AddMasterDataEntry("schema1", "name1", 3, "attribute0", 1, "root1", "", nil)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema0.name0", "schema1.name1"})
 			Expect(roots).To(ConsistOf("schema0.root0", "schema1.root1"))
 		})
 		It("only returns root partitions of leaf partitions", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", "", nil)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema2.name2", "schema3.name3"})
 			Expect(roots).To(ConsistOf("schema2.root2", "schema3.root3"))
 		})
@@ -424,18 +541,18 @@ COMMENT ON DATABASE "db-special-chär$" IS 'this is a database comment';`}
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns nothing if relation is not part of TOC data entries", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", "", nil)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{"schema4.name4", "schema5.name5"})
 			Expect(roots).To(BeEmpty())
 		})
 		It("returns empty if no relations are passed in", func() {
-			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "")
-			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2")
-			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3")
+			tocfile.AddMasterDataEntry("schema0", "name0", 0, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema1", "name1", 1, "attribute0", 1, "", "", nil)
+			tocfile.AddMasterDataEntry("schema2", "name2", 2, "attribute0", 1, "root2", "", nil)
+			tocfile.AddMasterDataEntry("schema3", "name3", 3, "attribute0", 1, "root3", "", nil)
 			roots := toc.GetIncludedPartitionRoots(tocfile.DataEntries, []string{})
 			Expect(roots).To(BeEmpty())
 		})
@@ -1,9 +1,9 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"io"
-	path "path/filepath"
 	"strings"
 	"sync"
 
@@ -114,22 +114,22 @@ func VerifyHelperVersionOnSegments(version string, c *cluster.Cluster) {
 	}
 }
 
-func StartGpbackupHelpers(c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool, isFilter bool, wasTerminated *bool) {
+func StartGpbackupHelpers(ctx context.Context, c *cluster.Cluster, fpInfo filepath.FilePathInfo, operation string, pluginConfigFile string, compressStr string, onErrorContinue bool, isFilter bool) {
 	// A mutex lock for cleaning up and starting gpbackup helpers prevents a
 	// race condition that causes gpbackup_helpers to be orphaned if
-	// gpbackup_helper cleanup happens before they are started.
+	// gpbackup_helper cleanup happens before they are started.  ctx is
+	// canceled before cleanup begins, so no helpers are started after it.
 	helperMutex.Lock()
-	if *wasTerminated {
-		helperMutex.Unlock()
-		select {} // Pause forever and wait for cleanup to exit program.
-	}
 	defer helperMutex.Unlock()
+	if ctx.Err() != nil {
+		gplog.Fatal(errors.Wrap(ctx.Err(), "Not starting gpbackup_helper agents"), "")
+	}
 
 	gphomePath := operating.System.Getenv("GPHOME")
 	pluginStr := ""
 	if pluginConfigFile != "" {
-		_, configFilename := path.Split(pluginConfigFile)
-		pluginStr = fmt.Sprintf(" --plugin-config /tmp/%s", configFilename)
+		// This is the path of the plugin config copied to each host
+		pluginStr = fmt.Sprintf(" --plugin-config %s", pluginConfigFile)
 	}
 	onErrorContinueStr := ""
 	if onErrorContinue {
@@ -166,7 +166,8 @@ func CleanUpHelperFilesOnAllHosts(c *cluster.Cluster, fpInfo filepath.FilePathIn
 		errorFile := fmt.Sprintf("%s_error", fpInfo.GetSegmentPipeFilePath(contentID))
 		oidFile := fpInfo.GetSegmentHelperFilePath(contentID, "oid")
 		scriptFile := fpInfo.GetSegmentHelperFilePath(contentID, "script")
-		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile)
+		retriesFile := GetHelperRetriesFilePath(fpInfo, contentID)
+		return fmt.Sprintf("rm -f %s && rm -f %s && rm -f %s && rm -f %s", errorFile, oidFile, scriptFile, retriesFile)
 	})
 	errMsg := fmt.Sprintf("Unable to remove segment helper file(s). See %s for a complete list of segments with errors and remove manually.",
 		gplog.GetLogFilePath())
@@ -1,6 +1,7 @@
 package utils_test
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
@@ -125,12 +126,18 @@ var _ = Describe("agent remote", func() {
 	})
 	Describe("StartGpbackupHelpers()", func() {
 		It("Correctly propagates --on-error-continue flag to gpbackup_helper", func() {
-			wasTerminated := false
-			utils.StartGpbackupHelpers(testCluster, fpInfo, "operation", "/tmp/pluginConfigFile.yml", " compressStr", true, false, &wasTerminated)
+			utils.StartGpbackupHelpers(context.Background(), testCluster, fpInfo, "operation", "/tmp/pluginConfigFile.yml", " compressStr", true, false)
 
 			cc := testExecutor.ClusterCommands[0]
 			Expect(cc[1].CommandString).To(ContainSubstring(" --on-error-continue"))
 		})
+		It("does not start gpbackup_helper if the context is canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			defer testhelper.ShouldPanicWithMessage("Not starting gpbackup_helper agents: context canceled")
+			utils.StartGpbackupHelpers(ctx, testCluster, fpInfo, "operation", "/tmp/pluginConfigFile.yml", " compressStr", true, false)
+		})
 	})
 	Describe("CheckAgentErrorsOnSegments", func() {
 		It("constructs the correct ssh call to check for the existance of an error file on each segment", func() {
@@ -0,0 +1,76 @@
+package utils
+
+/*
+ * This file contains the functions for copying the files of a finished
+ * backup to another destination, which gprestore does by running
+ * gpbackup_helper --copy-agent for every segment and the coordinator at once.
+ * Each agent is sent the files it copies on its stdin, one per line as the
+ * path to read the file from and the path to write it to separated by a tab,
+ * and verifies each file by reading it back from the destination.
+ */
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/pkg/errors"
+)
+
+type BackupFileCopy struct {
+	Source      string
+	Destination string
+}
+
+func FormatBackupFileCopies(files []BackupFileCopy) string {
+	var contents strings.Builder
+	for _, file := range files {
+		contents.WriteString(fmt.Sprintf("%s\t%s\n", file.Source, file.Destination))
+	}
+	return contents.String()
+}
+
+func ParseBackupFileCopies(contents string) ([]BackupFileCopy, error) {
+	files := make([]BackupFileCopy, 0)
+	for _, line := range strings.Split(contents, "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		if len(fields) != 2 || fields[0] == "" || fields[1] == "" {
+			return nil, errors.Errorf("Invalid line in list of files to copy: %s", line)
+		}
+		files = append(files, BackupFileCopy{Source: fields[0], Destination: fields[1]})
+	}
+	return files, nil
+}
+
+/*
+ * Copies the files of each segment, given by content ID, with the agents for
+ * all segments running in parallel.  The plugin configs are the paths of the
+ * configs copied to each host, or "" to read from or write to local files.
+ */
+func CopyBackupFilesOnAllHosts(c *cluster.Cluster, files map[int][]BackupFileCopy, sourcePluginConfig string, destinationPluginConfig string) {
+	pluginStr := ""
+	if sourcePluginConfig != "" {
+		pluginStr += fmt.Sprintf(" --plugin-config %s", sourcePluginConfig)
+	}
+	if destinationPluginConfig != "" {
+		pluginStr += fmt.Sprintf(" --copy-to-plugin-config %s", destinationPluginConfig)
+	}
+	gphome := operating.System.Getenv("GPHOME")
+	scope := cluster.ON_SEGMENTS | cluster.INCLUDE_MASTER
+	commandList := c.GenerateSSHCommandList(scope, func(contentID int) string {
+		return fmt.Sprintf("source %[1]s/greenplum_path.sh && %[1]s/bin/gpbackup_helper --copy-agent --content %[2]d%[3]s", gphome, contentID, pluginStr)
+	})
+	for i := range commandList {
+		commandList[i].Command.Stdin = strings.NewReader(FormatBackupFileCopies(files[commandList[i].Content]))
+	}
+	gplog.Verbose("Copying backup files on all segments")
+	remoteOutput := c.ExecuteClusterCommand(scope, commandList)
+	c.CheckClusterError(remoteOutput, "Unable to copy backup files", func(contentID int) string {
+		return "Unable to copy backup files"
+	})
+}
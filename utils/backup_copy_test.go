@@ -0,0 +1,61 @@
+package utils_test
+
+import (
+	"io/ioutil"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/backup_copy tests", func() {
+	files := []utils.BackupFileCopy{
+		{Source: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16384.gz", Destination: "/copy/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16384.gz"},
+		{Source: "/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16390.gz", Destination: "/copy/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16390.gz"},
+	}
+
+	Describe("ParseBackupFileCopies", func() {
+		It("parses the files written by FormatBackupFileCopies", func() {
+			parsed, err := utils.ParseBackupFileCopies(utils.FormatBackupFileCopies(files))
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(parsed).To(Equal(files))
+		})
+		It("returns an error for a line without a destination", func() {
+			_, err := utils.ParseBackupFileCopies("/data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16384.gz\n")
+
+			Expect(err).To(MatchError("Invalid line in list of files to copy: /data/gpseg0/backups/20170101/20170101010101/gpbackup_0_20170101010101_16384.gz"))
+		})
+	})
+	Describe("CopyBackupFilesOnAllHosts", func() {
+		AfterEach(func() {
+			operating.InitializeSystemFunctions()
+		})
+		It("sends each copy agent the files of its segment", func() {
+			operating.System.Getenv = func(string) string { return "/usr/local/gpdb" }
+			executor := testutils.TestExecutorMultiple{ClusterOutputs: []*cluster.RemoteOutput{{}}}
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master"},
+				{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1"},
+			})
+			testCluster.Executor = &executor
+
+			utils.CopyBackupFilesOnAllHosts(testCluster, map[int][]utils.BackupFileCopy{0: files}, "/tmp/plugin_config.yaml", "")
+
+			commands := executor.ClusterCommands[0]
+			Expect(commands).To(HaveLen(2))
+			Expect(commands[1].CommandString).To(ContainSubstring("/usr/local/gpdb/bin/gpbackup_helper --copy-agent --content 0 --plugin-config /tmp/plugin_config.yaml"))
+			Expect(commands[1].CommandString).ToNot(ContainSubstring("--copy-to-plugin-config"))
+			segmentFiles, err := ioutil.ReadAll(commands[1].Command.Stdin)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(segmentFiles)).To(Equal(utils.FormatBackupFileCopies(files)))
+			coordinatorFiles, err := ioutil.ReadAll(commands[0].Command.Stdin)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(coordinatorFiles).To(BeEmpty())
+		})
+	})
+})
@@ -0,0 +1,158 @@
+package utils
+
+/*
+ * This file contains functions for canceling the commands and queries a backup
+ * or restore is running when it is canceled or one of its timeouts expires.
+ */
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/dbconn"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+)
+
+// Returns a context that is canceled after the given number of seconds, or only along with its parent if seconds is 0
+func NewTimeoutContext(parent context.Context, seconds int) (context.Context, context.CancelFunc) {
+	if seconds == 0 {
+		return context.WithCancel(parent)
+	}
+	return context.WithTimeout(parent, time.Duration(seconds)*time.Second)
+}
+
+/*
+ * Returns a context that is canceled when the process receives SIGINT or
+ * SIGTERM, in place of any handling of those signals set up before.  A second
+ * signal is handled as it would be by default, which terminates the process.
+ */
+func NewSignalContext(parent context.Context, procDesc string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(parent)
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+	signalChan := make(chan os.Signal, 1)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		select {
+		case <-signalChan:
+			fmt.Println() // Add newline after "^C" is printed
+			gplog.Warn("Received a termination signal, aborting %s", procDesc)
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(signalChan)
+	}()
+	return ctx, cancel
+}
+
+/*
+ * ContextExecutor runs commands in the same way as cluster.GPDBExecutor, but
+ * kills any that are still running when its context is canceled, in which case
+ * the error of each killed command is the context's error.
+ */
+type ContextExecutor struct {
+	Context context.Context
+}
+
+func (executor *ContextExecutor) ExecuteLocalCommand(commandStr string) (string, error) {
+	output, err := exec.CommandContext(executor.Context, "bash", "-c", commandStr).CombinedOutput()
+	if ctxErr := executor.Context.Err(); err != nil && ctxErr != nil {
+		err = ctxErr
+	}
+	return string(output), err
+}
+
+func (executor *ContextExecutor) ExecuteClusterCommand(scope cluster.Scope, commandList []cluster.ShellCommand) *cluster.RemoteOutput {
+	finished := make(chan int)
+	for i := range commandList {
+		go func(index int) {
+			command := commandList[index]
+			command.Stdout, command.Stderr, command.Error = executor.runCommand(command.Command)
+			commandList[index] = command
+			finished <- index
+		}(i)
+	}
+	numErrors := 0
+	for range commandList {
+		index := <-finished
+		if commandList[index].Error != nil {
+			numErrors++
+		}
+	}
+	return cluster.NewRemoteOutput(scope, numErrors, commandList)
+}
+
+/*
+ * A killed command is not waited for, as the ssh processes it starts may keep
+ * its output open, so its output is discarded.
+ */
+func (executor *ContextExecutor) runCommand(cmd *exec.Cmd) (string, string, error) {
+	if err := executor.Context.Err(); err != nil {
+		return "", "", err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return "", "", err
+	}
+	waitErr := make(chan error, 1)
+	go func() {
+		waitErr <- cmd.Wait()
+	}()
+	select {
+	case err := <-waitErr:
+		return stdout.String(), stderr.String(), err
+	case <-executor.Context.Done():
+		_ = cmd.Process.Kill()
+		return "", "", executor.Context.Err()
+	}
+}
+
+/*
+ * Returns a copy of the cluster that runs commands without a ContextExecutor's
+ * context, for cleanup that must run after the context is canceled.
+ */
+func ClusterWithoutContext(c *cluster.Cluster) *cluster.Cluster {
+	if c == nil {
+		return nil
+	}
+	if _, ok := c.Executor.(*ContextExecutor); !ok {
+		return c
+	}
+	clusterCopy := *c
+	clusterCopy.Executor = &cluster.GPDBExecutor{}
+	return &clusterCopy
+}
+
+/*
+ * Cancels the queries running in every session with the given application
+ * name, such as catalog queries or lock waits, which cannot be canceled with
+ * a context.  A new connection is used, as every connection of the backup or
+ * restore may be busy.
+ */
+func CancelApplicationQueries(dbname string, applicationName string) {
+	conn := dbconn.NewDBConnFromEnvironment(dbname)
+	err := conn.Connect(1)
+	if err != nil {
+		gplog.Warn("Unable to connect to cancel queries in progress: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	pidColumn := "pid"
+	if conn.Version.Before("6") {
+		pidColumn = "procpid"
+	}
+	query := fmt.Sprintf("SELECT pg_cancel_backend(%[1]s) FROM pg_stat_activity WHERE application_name = '%[2]s' AND %[1]s <> pg_backend_pid()", pidColumn, EscapeSingleQuotes(applicationName))
+	_, err = conn.Exec(query)
+	if err != nil {
+		gplog.Warn("Unable to cancel queries in progress: %v", err)
+	}
+}
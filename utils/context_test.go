@@ -0,0 +1,116 @@
+package utils_test
+
+import (
+	"context"
+	"os/exec"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/context tests", func() {
+	Describe("NewTimeoutContext", func() {
+		It("returns a context without a deadline if the timeout is 0", func() {
+			ctx, cancel := utils.NewTimeoutContext(context.Background(), 0)
+			defer cancel()
+
+			_, hasDeadline := ctx.Deadline()
+			Expect(hasDeadline).To(BeFalse())
+			Expect(ctx.Err()).ToNot(HaveOccurred())
+		})
+		It("returns a context that expires after the timeout", func() {
+			ctx, cancel := utils.NewTimeoutContext(context.Background(), 1)
+			defer cancel()
+
+			deadline, hasDeadline := ctx.Deadline()
+			Expect(hasDeadline).To(BeTrue())
+			Expect(deadline).To(BeTemporally("~", time.Now().Add(time.Second), 500*time.Millisecond))
+		})
+		It("returns a context that is canceled along with its parent", func() {
+			parent, cancelParent := context.WithCancel(context.Background())
+			ctx, cancel := utils.NewTimeoutContext(parent, 0)
+			defer cancel()
+
+			cancelParent()
+			Expect(ctx.Err()).To(Equal(context.Canceled))
+		})
+	})
+	Describe("ContextExecutor", func() {
+		It("runs a local command", func() {
+			executor := &utils.ContextExecutor{Context: context.Background()}
+
+			output, err := executor.ExecuteLocalCommand("echo foo")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(output).To(Equal("foo\n"))
+		})
+		It("kills a local command when its context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			executor := &utils.ContextExecutor{Context: ctx}
+
+			start := time.Now()
+			_, err := executor.ExecuteLocalCommand("sleep 10")
+			Expect(err).To(Equal(context.DeadlineExceeded))
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+		})
+		It("runs cluster commands and records their output", func() {
+			executor := &utils.ContextExecutor{Context: context.Background()}
+			commands := []cluster.ShellCommand{
+				cluster.NewShellCommand(cluster.ON_SEGMENTS, 0, "localhost", []string{"bash", "-c", "echo foo"}),
+				cluster.NewShellCommand(cluster.ON_SEGMENTS, 1, "localhost", []string{"bash", "-c", "echo bar >&2; exit 1"}),
+			}
+
+			output := executor.ExecuteClusterCommand(cluster.ON_SEGMENTS, commands)
+			Expect(output.NumErrors).To(Equal(1))
+			Expect(output.Commands[0].Stdout).To(Equal("foo\n"))
+			Expect(output.Commands[1].Stderr).To(Equal("bar\n"))
+			Expect(output.Commands[1].Error).To(HaveOccurred())
+		})
+		It("kills cluster commands when its context is canceled", func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			executor := &utils.ContextExecutor{Context: ctx}
+			commands := []cluster.ShellCommand{
+				cluster.NewShellCommand(cluster.ON_SEGMENTS, 0, "localhost", []string{"sleep", "10"}),
+				cluster.NewShellCommand(cluster.ON_SEGMENTS, 1, "localhost", []string{"sleep", "10"}),
+			}
+
+			start := time.Now()
+			output := executor.ExecuteClusterCommand(cluster.ON_SEGMENTS, commands)
+			Expect(time.Since(start)).To(BeNumerically("<", 5*time.Second))
+			Expect(output.NumErrors).To(Equal(2))
+			Expect(output.Commands[0].Error).To(Equal(context.DeadlineExceeded))
+		})
+		It("does not start cluster commands if its context is already canceled", func() {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			executor := &utils.ContextExecutor{Context: ctx}
+			command := cluster.ShellCommand{Content: 0, Host: "localhost", Command: exec.Command("touch", "/tmp/should_not_exist")}
+
+			output := executor.ExecuteClusterCommand(cluster.ON_SEGMENTS, []cluster.ShellCommand{command})
+			Expect(output.NumErrors).To(Equal(1))
+			Expect(output.Commands[0].Error).To(Equal(context.Canceled))
+			Expect(output.Commands[0].Command.Process).To(BeNil())
+		})
+	})
+	Describe("ClusterWithoutContext", func() {
+		It("returns a copy of the cluster that does not use the context", func() {
+			testCluster := cluster.NewCluster([]cluster.SegConfig{{DbID: 1, ContentID: -1, Hostname: "localhost"}})
+			testCluster.Executor = &utils.ContextExecutor{Context: context.Background()}
+
+			clusterCopy := utils.ClusterWithoutContext(testCluster)
+			Expect(clusterCopy.Executor).To(Equal(&cluster.GPDBExecutor{}))
+			Expect(clusterCopy.ContentIDs).To(Equal(testCluster.ContentIDs))
+			Expect(testCluster.Executor).To(BeAssignableToTypeOf(&utils.ContextExecutor{}))
+		})
+		It("returns a cluster that does not use a context unchanged", func() {
+			testCluster := cluster.NewCluster([]cluster.SegConfig{{DbID: 1, ContentID: -1, Hostname: "localhost"}})
+
+			Expect(utils.ClusterWithoutContext(testCluster)).To(BeIdenticalTo(testCluster))
+		})
+	})
+})
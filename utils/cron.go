@@ -0,0 +1,183 @@
+package utils
+
+/*
+ * This file contains functions for parsing cron-style schedules and finding
+ * the next time they are due.
+ */
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// A CronSchedule is parsed from the five fields of a crontab entry: minute,
+// hour, day of month, month, and day of week.  Each field is "*", a value, a
+// range such as "1-5", or a comma-separated list of these, and each "*" or
+// range may be followed by a step such as "*/15".  Months and days of the
+// week may also be given by their first three letters, and Sunday is both 0
+// and 7.  As with cron, if both the day of month and the day of week are
+// restricted, a day matching either is due.
+//
+// The macros @yearly, @annually, @monthly, @weekly, @daily, @midnight, and
+// @hourly are also accepted.
+type CronSchedule struct {
+	minutes       []bool
+	hours         []bool
+	daysOfMonth   []bool
+	months        []bool
+	daysOfWeek    []bool
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+}
+
+type cronField struct {
+	name  string
+	min   int
+	max   int
+	names []string
+}
+
+var (
+	cronMacros = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+	cronFields = []cronField{
+		{name: "minute", min: 0, max: 59},
+		{name: "hour", min: 0, max: 23},
+		{name: "day of month", min: 1, max: 31},
+		{name: "month", min: 1, max: 12, names: []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}},
+		{name: "day of week", min: 0, max: 7, names: []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}},
+	}
+)
+
+func ParseCronSchedule(spec string) (*CronSchedule, error) {
+	expandedSpec := strings.TrimSpace(spec)
+	if macroSpec, ok := cronMacros[strings.ToLower(expandedSpec)]; ok {
+		expandedSpec = macroSpec
+	}
+	fieldStrs := strings.Fields(expandedSpec)
+	if len(fieldStrs) != len(cronFields) {
+		return nil, errors.Errorf("Invalid schedule %q: expected 5 fields but found %d", spec, len(fieldStrs))
+	}
+	values := make([][]bool, len(cronFields))
+	for i, field := range cronFields {
+		var err error
+		values[i], err = field.parse(fieldStrs[i])
+		if err != nil {
+			return nil, errors.Errorf("Invalid schedule %q: %v", spec, err)
+		}
+	}
+	schedule := &CronSchedule{
+		minutes:       values[0],
+		hours:         values[1],
+		daysOfMonth:   values[2],
+		months:        values[3],
+		daysOfWeek:    values[4],
+		anyDayOfMonth: strings.HasPrefix(fieldStrs[2], "*"),
+		anyDayOfWeek:  strings.HasPrefix(fieldStrs[4], "*"),
+	}
+	// Sunday is both 0 and 7
+	schedule.daysOfWeek[0] = schedule.daysOfWeek[0] || schedule.daysOfWeek[7]
+	if schedule.Next(time.Now()).IsZero() {
+		return nil, errors.Errorf("Invalid schedule %q: the schedule is never due", spec)
+	}
+	return schedule, nil
+}
+
+func (field cronField) parse(fieldStr string) ([]bool, error) {
+	values := make([]bool, field.max+1)
+	for _, part := range strings.Split(fieldStr, ",") {
+		rangeStr, step := part, 1
+		if slashIndex := strings.Index(part, "/"); slashIndex != -1 {
+			rangeStr = part[:slashIndex]
+			var err error
+			step, err = strconv.Atoi(part[slashIndex+1:])
+			if err != nil || step < 1 {
+				return nil, errors.Errorf("invalid step in %s %q", field.name, part)
+			}
+		}
+		start, end := field.min, field.max
+		if rangeStr != "*" {
+			bounds := strings.SplitN(rangeStr, "-", 2)
+			var err error
+			start, err = field.parseValue(bounds[0])
+			if err != nil {
+				return nil, err
+			}
+			end = start
+			if len(bounds) == 2 {
+				end, err = field.parseValue(bounds[1])
+				if err != nil {
+					return nil, err
+				}
+			} else if step > 1 {
+				// A step after a single value, as in "5/15", runs from that value to the end of the range
+				end = field.max
+			}
+			if end < start {
+				return nil, errors.Errorf("invalid range in %s %q", field.name, part)
+			}
+		}
+		for value := start; value <= end; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+func (field cronField) parseValue(valueStr string) (int, error) {
+	for i, name := range field.names {
+		if strings.ToLower(valueStr) == name {
+			return i + field.min, nil
+		}
+	}
+	value, err := strconv.Atoi(valueStr)
+	if err != nil || value < field.min || value > field.max {
+		return 0, errors.Errorf("%s %q must be between %d and %d", field.name, valueStr, field.min, field.max)
+	}
+	return value, nil
+}
+
+func (schedule *CronSchedule) isDayDue(t time.Time) bool {
+	dayOfMonthDue := schedule.daysOfMonth[t.Day()]
+	dayOfWeekDue := schedule.daysOfWeek[int(t.Weekday())]
+	if !schedule.anyDayOfMonth && !schedule.anyDayOfWeek {
+		return dayOfMonthDue || dayOfWeekDue
+	}
+	return dayOfMonthDue && dayOfWeekDue
+}
+
+/*
+ * Returns the first minute after the given time at which the schedule is due,
+ * or the zero time if it is not due in the next five years, e.g. because it is
+ * only due on February 30.
+ */
+func (schedule *CronSchedule) Next(after time.Time) time.Time {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(5, 0, 0)
+	for t.Before(limit) {
+		year, month, day := t.Date()
+		switch {
+		case !schedule.months[int(month)]:
+			t = time.Date(year, month+1, 1, 0, 0, 0, 0, t.Location())
+		case !schedule.isDayDue(t):
+			t = time.Date(year, month, day+1, 0, 0, 0, 0, t.Location())
+		case !schedule.hours[t.Hour()]:
+			t = time.Date(year, month, day, t.Hour()+1, 0, 0, 0, t.Location())
+		case !schedule.minutes[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,87 @@
+package utils_test
+
+import (
+	"time"
+
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/cron tests", func() {
+	// A Monday
+	start := time.Date(2024, time.January, 1, 10, 30, 0, 0, time.UTC)
+	next := func(spec string, after time.Time) time.Time {
+		schedule, err := utils.ParseCronSchedule(spec)
+		Expect(err).ToNot(HaveOccurred())
+		return schedule.Next(after)
+	}
+	Describe("CronSchedule.Next", func() {
+		It("returns the next minute for a schedule that is always due", func() {
+			Expect(next("* * * * *", start)).To(Equal(start.Add(time.Minute)))
+		})
+		It("does not return the given time even if the schedule is due at that time", func() {
+			Expect(next("30 10 * * *", start)).To(Equal(start.AddDate(0, 0, 1)))
+		})
+		It("ignores the seconds of the given time", func() {
+			Expect(next("31 10 * * *", start.Add(59*time.Second))).To(Equal(start.Add(time.Minute)))
+		})
+		It("returns the next time for a daily schedule", func() {
+			Expect(next("0 1 * * *", start)).To(Equal(time.Date(2024, time.January, 2, 1, 0, 0, 0, time.UTC)))
+		})
+		It("returns the next time for a weekly schedule", func() {
+			Expect(next("0 1 * * 0", start)).To(Equal(time.Date(2024, time.January, 7, 1, 0, 0, 0, time.UTC)))
+			Expect(next("0 1 * * 7", start)).To(Equal(time.Date(2024, time.January, 7, 1, 0, 0, 0, time.UTC)))
+			Expect(next("0 1 * * sun", start)).To(Equal(time.Date(2024, time.January, 7, 1, 0, 0, 0, time.UTC)))
+		})
+		It("returns the next time for ranges and lists of days", func() {
+			Expect(next("0 1 * * 1-6", time.Date(2024, time.January, 6, 2, 0, 0, 0, time.UTC))).To(Equal(time.Date(2024, time.January, 8, 1, 0, 0, 0, time.UTC)))
+			Expect(next("0 1 * * mon,wed", start)).To(Equal(time.Date(2024, time.January, 3, 1, 0, 0, 0, time.UTC)))
+		})
+		It("returns the next time for steps", func() {
+			Expect(next("*/15 * * * *", start)).To(Equal(start.Add(15 * time.Minute)))
+			Expect(next("5/20 * * * *", start)).To(Equal(start.Add(15 * time.Minute)))
+			Expect(next("0 0-12/6 * * *", start)).To(Equal(time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)))
+		})
+		It("returns the next time for a monthly schedule, skipping months without the day", func() {
+			Expect(next("0 0 31 * *", time.Date(2024, time.February, 1, 0, 0, 0, 0, time.UTC))).To(Equal(time.Date(2024, time.March, 31, 0, 0, 0, 0, time.UTC)))
+			Expect(next("0 0 1 jun *", start)).To(Equal(time.Date(2024, time.June, 1, 0, 0, 0, 0, time.UTC)))
+		})
+		It("returns days matching either the day of month or the day of week if both are restricted", func() {
+			Expect(next("0 0 15 * fri", start)).To(Equal(time.Date(2024, time.January, 5, 0, 0, 0, 0, time.UTC)))
+			Expect(next("0 0 15 * fri", time.Date(2024, time.January, 13, 0, 0, 0, 0, time.UTC))).To(Equal(time.Date(2024, time.January, 15, 0, 0, 0, 0, time.UTC)))
+		})
+		It("returns the next time for macros", func() {
+			Expect(next("@weekly", start)).To(Equal(time.Date(2024, time.January, 7, 0, 0, 0, 0, time.UTC)))
+			Expect(next("@daily", start)).To(Equal(time.Date(2024, time.January, 2, 0, 0, 0, 0, time.UTC)))
+			Expect(next("@hourly", start)).To(Equal(time.Date(2024, time.January, 1, 11, 0, 0, 0, time.UTC)))
+		})
+	})
+	Describe("ParseCronSchedule", func() {
+		It("returns an error for the wrong number of fields", func() {
+			_, err := utils.ParseCronSchedule("0 1 * *")
+			Expect(err).To(MatchError(`Invalid schedule "0 1 * *": expected 5 fields but found 4`))
+		})
+		It("returns an error for a value out of range", func() {
+			_, err := utils.ParseCronSchedule("0 24 * * *")
+			Expect(err).To(MatchError(`Invalid schedule "0 24 * * *": hour "24" must be between 0 and 23`))
+		})
+		It("returns an error for an unknown name", func() {
+			_, err := utils.ParseCronSchedule("0 0 * * someday")
+			Expect(err).To(MatchError(`Invalid schedule "0 0 * * someday": day of week "someday" must be between 0 and 7`))
+		})
+		It("returns an error for an invalid step", func() {
+			_, err := utils.ParseCronSchedule("*/0 * * * *")
+			Expect(err).To(MatchError(`Invalid schedule "*/0 * * * *": invalid step in minute "*/0"`))
+		})
+		It("returns an error for a reversed range", func() {
+			_, err := utils.ParseCronSchedule("0 0 * * 5-1")
+			Expect(err).To(MatchError(`Invalid schedule "0 0 * * 5-1": invalid range in day of week "5-1"`))
+		})
+		It("returns an error for a schedule that is never due", func() {
+			_, err := utils.ParseCronSchedule("0 0 30 feb *")
+			Expect(err).To(MatchError(`Invalid schedule "0 0 30 feb *": the schedule is never due`))
+		})
+	})
+})
@@ -10,6 +10,7 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"strings"
 
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
 )
@@ -43,16 +44,21 @@ type FileWithByteCount struct {
 	Writer    io.Writer
 	File      *os.File
 	ByteCount uint64
+	Names     *ObjectNames
+
+	references      []PrintedReference
+	unscanned       string
+	unscannedOffset uint64
 }
 
 func NewFileWithByteCount(writer io.Writer) *FileWithByteCount {
-	return &FileWithByteCount{"", writer, nil, 0}
+	return &FileWithByteCount{Filename: "", Writer: writer}
 }
 
 func NewFileWithByteCountFromFile(filename string) *FileWithByteCount {
 	file, err := OpenFileForWrite(filename)
 	gplog.FatalOnError(err)
-	return &FileWithByteCount{filename, file, file, 0}
+	return &FileWithByteCount{Filename: filename, Writer: file, File: file}
 }
 
 func (file *FileWithByteCount) Close() {
@@ -69,23 +75,65 @@ func (file *FileWithByteCount) Close() {
 }
 
 func (file *FileWithByteCount) MustPrintln(v ...interface{}) {
-	bytesWritten, err := fmt.Fprintln(file.Writer, v...)
-	gplog.FatalOnError(err, "Unable to write to file")
-	file.ByteCount += uint64(bytesWritten)
+	file.mustWrite(fmt.Sprintln(v...))
 }
 
 func (file *FileWithByteCount) MustPrintf(s string, v ...interface{}) {
-	bytesWritten, err := fmt.Fprintf(file.Writer, s, v...)
-	gplog.FatalOnError(err, "Unable to write to file")
-	file.ByteCount += uint64(bytesWritten)
+	file.mustWrite(fmt.Sprintf(s, v...))
 }
 
 func (file *FileWithByteCount) MustPrint(s string) {
-	bytesWritten, err := fmt.Fprint(file.Writer, s)
+	file.mustWrite(s)
+}
+
+func (file *FileWithByteCount) mustWrite(output string) {
+	bytesWritten, err := io.WriteString(file.Writer, output)
 	gplog.FatalOnError(err, "Unable to write to file")
+	if file.Names != nil {
+		file.findReferences(output)
+	}
 	file.ByteCount += uint64(bytesWritten)
 }
 
+/*
+ * Restore rewrites schema, relation, and database names when redirecting
+ * objects, so if Names is set, the location of each of those names is
+ * recorded as the statements are printed.  A statement may be printed in
+ * several pieces, so the output is held until a complete statement has been
+ * printed, and the names in it are found then.
+ */
+func (file *FileWithByteCount) findReferences(output string) {
+	if file.unscanned == "" {
+		file.unscannedOffset = file.ByteCount
+	}
+	file.unscanned += output
+	if !strings.Contains(output, ";") {
+		return
+	}
+	if end := lastStatementEnd(file.unscanned); end > 0 {
+		file.recordReferences(file.unscanned[:end])
+		file.unscanned = file.unscanned[end:]
+		file.unscannedOffset += uint64(end)
+	}
+}
+
+func (file *FileWithByteCount) recordReferences(statements string) {
+	for _, reference := range file.Names.FindReferences(statements) {
+		reference.Offset += file.unscannedOffset
+		file.references = append(file.references, reference)
+	}
+}
+
+// Returns the names printed to the file so far, in the order they were printed
+func (file *FileWithByteCount) References() []PrintedReference {
+	if file.unscanned != "" {
+		file.recordReferences(file.unscanned)
+		file.unscannedOffset += uint64(len(file.unscanned))
+		file.unscanned = ""
+	}
+	return file.references
+}
+
 func CopyFile(src, dest string) error {
 	info, err := os.Stat(src)
 	if err == nil {
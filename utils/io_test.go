@@ -49,6 +49,46 @@ var _ = Describe("utils/io tests", func() {
 			file.MustPrintf("message")
 		})
 	})
+	Describe("FileWithByteCount references", func() {
+		var file *utils.FileWithByteCount
+		BeforeEach(func() {
+			file = utils.NewFileWithByteCount(buffer)
+			file.Names = utils.NewObjectNames(`"My DB"`, []utils.ObjectName{{Schema: "foo", Name: "bar", IsRelation: true}})
+		})
+		It("records where each name was printed once the statement is complete", func() {
+			file.MustPrint("\n\nCREATE TABLE foo.bar (")
+			file.MustPrintln("\n\ti integer\n);")
+			file.MustPrintf("ALTER DATABASE %s SET search_path TO foo;", `"My DB"`)
+
+			Expect(string(buffer.Contents())).To(Equal("\n\nCREATE TABLE foo.bar (\n\ti integer\n);\nALTER DATABASE \"My DB\" SET search_path TO foo;"))
+			Expect(file.ByteCount).To(Equal(uint64(len(buffer.Contents()))))
+			Expect(file.References()).To(Equal([]utils.PrintedReference{
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 15, Length: 3},
+				{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 19, Length: 3},
+				{ObjectType: "DATABASE", Name: `"My DB"`, Offset: 54, Length: 7},
+			}))
+		})
+		It("finds the names in a statement split across several prints", func() {
+			file.MustPrint("SELECT 1;\nCREATE FUNCTION foo.f() RETURNS integer AS $$ SELECT count(*) FROM foo.")
+			file.MustPrint("bar; $$ LANGUAGE sql;")
+
+			Expect(file.References()).To(Equal([]utils.PrintedReference{
+				{ObjectType: "SCHEMA", Name: "foo", Offset: 77, Length: 3},
+				{ObjectType: "RELATION", Schema: "foo", Name: "bar", Offset: 81, Length: 3, Unaliased: true},
+			}))
+		})
+		It("records names in a statement that was not completed", func() {
+			file.MustPrint("COMMENT ON TABLE foo.bar IS 'comment'")
+
+			Expect(file.References()).To(HaveLen(2))
+		})
+		It("does not record names if no object names were given", func() {
+			file.Names = nil
+			file.MustPrint("CREATE TABLE foo.bar (i integer);")
+
+			Expect(file.References()).To(BeEmpty())
+		})
+	})
 	Describe("CopyFile", func() {
 		var sourceFilePath = "/tmp/test_file.txt"
 		var destFilePath = "/tmp/dest_test_file.txt"
@@ -0,0 +1,123 @@
+package utils
+
+/*
+ * This file contains functions for matching object names against the patterns
+ * passed to the --include-table-pattern, --exclude-schema-pattern, etc. flags.
+ */
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	GlobPatternPrefix  = "glob:"
+	RegexPatternPrefix = "regex:"
+)
+
+/*
+ * Many patterns are valid in both syntaxes but match different names, e.g.
+ * "sales.*" as a glob matches every table in the sales schema while as a
+ * regular expression it also matches "salesforce.x", so each pattern must
+ * state its syntax with a prefix.  A "glob:" pattern supports "*", "?", and
+ * "[...]", and a "regex:" pattern is a regular expression.  Either way, the
+ * pattern must match the entire name.
+ */
+func CompileFilterPattern(pattern string) (*regexp.Regexp, error) {
+	var expr string
+	switch {
+	case strings.HasPrefix(pattern, GlobPatternPrefix):
+		expr = globToRegex(strings.TrimPrefix(pattern, GlobPatternPrefix))
+	case strings.HasPrefix(pattern, RegexPatternPrefix):
+		expr = strings.TrimPrefix(pattern, RegexPatternPrefix)
+	default:
+		return nil, errors.Errorf(`Filter pattern %s must start with "%s" for a glob or "%s" for a regular expression`, pattern, GlobPatternPrefix, RegexPatternPrefix)
+	}
+	if expr == "" {
+		return nil, errors.Errorf("Filter pattern %s cannot be empty", pattern)
+	}
+	compiled, err := regexp.Compile("^(?:" + expr + ")$")
+	if err != nil {
+		return nil, errors.Errorf("Invalid filter pattern %s: %v", pattern, err)
+	}
+	return compiled, nil
+}
+
+/*
+ * A glob matches each part of a schema-qualified name separately, so "*", "?",
+ * and a negated character class never match the "." between the schema and
+ * the name, and the characters in a class are matched literally apart from
+ * ranges.
+ */
+func globToRegex(glob string) string {
+	var expr strings.Builder
+	chars := []rune(glob)
+	for i := 0; i < len(chars); i++ {
+		switch chars[i] {
+		case '*':
+			expr.WriteString("[^.]*")
+		case '?':
+			expr.WriteString("[^.]")
+		case '[':
+			end := strings.IndexRune(string(chars[i+1:]), ']')
+			if end <= 0 {
+				expr.WriteString(regexp.QuoteMeta("["))
+				continue
+			}
+			class := []rune(string(chars[i+1:])[:end])
+			i += len(class) + 1
+			expr.WriteString("[")
+			if class[0] == '!' {
+				expr.WriteString("^.")
+				class = class[1:]
+			}
+			for _, char := range class {
+				if char == '-' {
+					expr.WriteRune(char)
+				} else {
+					expr.WriteString(regexp.QuoteMeta(string(char)))
+				}
+			}
+			expr.WriteString("]")
+		default:
+			expr.WriteString(regexp.QuoteMeta(string(chars[i])))
+		}
+	}
+	return expr.String()
+}
+
+/*
+ * Matches the keys of candidates against each pattern and returns the sorted
+ * values of all matching candidates, along with any patterns that did not
+ * match anything.  Keys are the unquoted names users write patterns against,
+ * while values are the form in which matches are added to filter lists.
+ */
+func MatchFilterPatterns(candidates map[string]string, patterns []string) ([]string, []string, error) {
+	matchedSet := make(map[string]bool)
+	unmatchedPatterns := make([]string, 0)
+	for _, pattern := range patterns {
+		compiled, err := CompileFilterPattern(pattern)
+		if err != nil {
+			return nil, nil, err
+		}
+		patternMatched := false
+		for name, value := range candidates {
+			if compiled.MatchString(name) {
+				matchedSet[value] = true
+				patternMatched = true
+			}
+		}
+		if !patternMatched {
+			unmatchedPatterns = append(unmatchedPatterns, pattern)
+		}
+	}
+	matches := make([]string, 0, len(matchedSet))
+	for value := range matchedSet {
+		matches = append(matches, value)
+	}
+	sort.Strings(matches)
+	return matches, unmatchedPatterns, nil
+}
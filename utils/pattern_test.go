@@ -0,0 +1,108 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/pattern tests", func() {
+	Describe("CompileFilterPattern", func() {
+		It("compiles a glob: pattern as a glob", func() {
+			pattern, err := utils.CompileFilterPattern("glob:sales.orders_2026*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("sales.orders_20260101")).To(BeTrue())
+			Expect(pattern.MatchString("sales.orders_2025")).To(BeFalse())
+			Expect(pattern.MatchString("salesXorders_2026")).To(BeFalse())
+		})
+		It("supports ? and character classes in globs", func() {
+			pattern, err := utils.CompileFilterPattern("glob:tmp_?[0-9][!a]")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("tmp_x1b")).To(BeTrue())
+			Expect(pattern.MatchString("tmp_x1a")).To(BeFalse())
+			Expect(pattern.MatchString("tmp_xy1b")).To(BeFalse())
+		})
+		It("does not match across the schema and table of a name with a glob", func() {
+			pattern, err := utils.CompileFilterPattern("glob:sales*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("sales_2026")).To(BeTrue())
+			Expect(pattern.MatchString("sales.orders_2026")).To(BeFalse())
+
+			pattern, err = utils.CompileFilterPattern("glob:sales?orders")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("sales_orders")).To(BeTrue())
+			Expect(pattern.MatchString("sales.orders")).To(BeFalse())
+
+			pattern, err = utils.CompileFilterPattern("glob:sales[!_]orders")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("sales-orders")).To(BeTrue())
+			Expect(pattern.MatchString("sales.orders")).To(BeFalse())
+		})
+		It("matches the characters of a glob character class literally", func() {
+			pattern, err := utils.CompileFilterPattern(`glob:tmp_[\w^]`)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString(`tmp_\`)).To(BeTrue())
+			Expect(pattern.MatchString("tmp_w")).To(BeTrue())
+			Expect(pattern.MatchString("tmp_^")).To(BeTrue())
+			Expect(pattern.MatchString("tmp_x")).To(BeFalse())
+		})
+		It("compiles a regex: pattern as a regular expression", func() {
+			pattern, err := utils.CompileFilterPattern("regex:tmp_.*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("tmp_schema")).To(BeTrue())
+			Expect(pattern.MatchString("tmp_")).To(BeTrue())
+			Expect(pattern.MatchString("public")).To(BeFalse())
+		})
+		It("matches a pattern that is valid in both syntaxes according to its prefix", func() {
+			glob, err := utils.CompileFilterPattern("glob:sales.*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(glob.MatchString("sales.orders")).To(BeTrue())
+			Expect(glob.MatchString("salesforce.x")).To(BeFalse())
+
+			regex, err := utils.CompileFilterPattern("regex:sales.*")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(regex.MatchString("sales.orders")).To(BeTrue())
+			Expect(regex.MatchString("salesforce.x")).To(BeTrue())
+		})
+		It("treats regular expression syntax in a glob literally", func() {
+			pattern, err := utils.CompileFilterPattern("glob:tmp_(a|b)")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("tmp_(a|b)")).To(BeTrue())
+			Expect(pattern.MatchString("tmp_a")).To(BeFalse())
+		})
+		It("requires the pattern to match the entire name", func() {
+			pattern, err := utils.CompileFilterPattern("regex:(foo|bar)")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(pattern.MatchString("foo")).To(BeTrue())
+			Expect(pattern.MatchString("foobar")).To(BeFalse())
+		})
+		It("returns an error for a pattern without a syntax prefix", func() {
+			_, err := utils.CompileFilterPattern("sales.*")
+			Expect(err).To(MatchError(`Filter pattern sales.* must start with "glob:" for a glob or "regex:" for a regular expression`))
+		})
+		It("returns an error for an invalid regular expression", func() {
+			_, err := utils.CompileFilterPattern("regex:tmp_(.*")
+			Expect(err).To(MatchError(ContainSubstring("Invalid filter pattern regex:tmp_(.*")))
+		})
+		It("returns an error for an empty pattern", func() {
+			_, err := utils.CompileFilterPattern("glob:")
+			Expect(err).To(MatchError("Filter pattern glob: cannot be empty"))
+		})
+	})
+	Describe("MatchFilterPatterns", func() {
+		candidates := map[string]string{"public.foo": "public.foo", "public.Bar": `public."Bar"`, "other.foo": "other.foo"}
+		It("returns the sorted values of all candidates matching any pattern", func() {
+			matches, unmatched, err := utils.MatchFilterPatterns(candidates, []string{"glob:public.*", "glob:*.foo"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(matches).To(Equal([]string{"other.foo", `public."Bar"`, "public.foo"}))
+			Expect(unmatched).To(BeEmpty())
+		})
+		It("returns the patterns that did not match any candidates", func() {
+			matches, unmatched, err := utils.MatchFilterPatterns(candidates, []string{"glob:public.B*", "regex:nothing_.*"})
+			Expect(err).ToNot(HaveOccurred())
+			Expect(matches).To(Equal([]string{`public."Bar"`}))
+			Expect(unmatched).To(Equal([]string{"regex:nothing_.*"}))
+		})
+	})
+})
@@ -1,18 +1,19 @@
 package utils
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
 	path "path/filepath"
+	"sort"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/blang/semver"
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
 	"github.com/greenplum-db/gp-common-go-libs/gplog"
-	"github.com/greenplum-db/gp-common-go-libs/iohelper"
 	"github.com/greenplum-db/gp-common-go-libs/operating"
 	"github.com/greenplum-db/gpbackup/filepath"
 	"github.com/pkg/errors"
@@ -20,13 +21,45 @@ import (
 )
 
 const RequiredPluginVersion = "0.3.0"
+
+// Plugins of at least this API version report their capabilities with plugin_capabilities
+const PluginCapabilitiesVersion = "0.5.0"
 const SecretKeyFile = ".encrypt"
 
 type PluginConfig struct {
-	ExecutablePath      string            `yaml:"executablepath"`
-	ConfigPath          string            `yaml:"-"`
-	Options             map[string]string `yaml:"options"`
-	backupPluginVersion string            `yaml:"-"`
+	ExecutablePath      string              `yaml:"executablepath"`
+	Storage             string              `yaml:"storage,omitempty"`
+	ConfigPath          string              `yaml:"-"`
+	Options             map[string]string   `yaml:"options"`
+	Capabilities        *PluginCapabilities `yaml:"capabilities,omitempty"`
+	Retry               *PluginRetryPolicy  `yaml:"retry,omitempty"`
+	CopyConfigs         []string            `yaml:"copies,omitempty"`
+	LocalCopy           bool                `yaml:"local_copy,omitempty"`
+	backupPluginVersion string              `yaml:"-"`
+	sourceConfigPath    string              `yaml:"-"`
+	apiVersion          semver.Version      `yaml:"-"`
+	hostConfigDir       string              `yaml:"-"`
+	copiedToHosts       bool                `yaml:"-"`
+	copies              []*PluginConfig     `yaml:"-"`
+	ctx                 context.Context
+	numRetries          int32
+}
+
+/*
+ * The features a plugin supports, as reported by plugin_capabilities.  They
+ * are written to the plugin config copied to each host, so that
+ * gpbackup_helper acts on the same capabilities as gpbackup and gprestore.
+ *
+ * There is no capability for streaming the TOC through a plugin, as the TOC
+ * is written on the master once the backup completes and is backed up and
+ * restored with backup_file and restore_file like every other metadata file.
+ */
+type PluginCapabilities struct {
+	RestoreSubset  bool `yaml:"restore_subset"`
+	DeleteBackup   bool `yaml:"delete_backup"`
+	ListBackups    bool `yaml:"list_backups"`
+	Encryption     bool `yaml:"encryption"`
+	MaxConcurrency int  `yaml:"max_concurrency"`
 }
 
 type PluginScope string
@@ -48,28 +81,91 @@ func ReadPluginConfig(configFile string) (*PluginConfig, error) {
 	if err != nil {
 		return nil, errors.New("plugin config file is formatted incorrectly")
 	}
-	if config.ExecutablePath == "" {
-		return nil, errors.New("executablepath is required in config file")
-	}
 	if config.Options == nil {
 		config.Options = make(map[string]string)
 	}
+	if config.Retry != nil {
+		err = config.Retry.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.Storage != "" {
+		err = config.useBuiltInStorage()
+		if err != nil {
+			return nil, err
+		}
+	} else if config.ExecutablePath == "" {
+		return nil, errors.New("executablepath is required in config file")
+	}
 	config.ExecutablePath = os.ExpandEnv(config.ExecutablePath)
 	err = ValidateFullPath(config.ExecutablePath)
 	if err != nil {
 		return nil, err
 	}
-	configFilename := path.Base(configFile)
-	config.ConfigPath = path.Join("/tmp", configFilename)
+	if config.Storage == CopiesStorage {
+		err = config.readCopyConfigs()
+		if err != nil {
+			return nil, err
+		}
+	}
+	// Plugin commands are passed the config read until it is copied to each host
+	config.ConfigPath = configFile
+	config.sourceConfigPath = configFile
 	return config, nil
 }
 
+/*
+ * A config with a storage type in place of an executablepath uses a storage
+ * backend built into gpbackup_helper, which implements the plugin commands
+ * itself, so nothing has to be installed on the cluster beyond gpbackup.
+ */
+func (plugin *PluginConfig) useBuiltInStorage() error {
+	if plugin.ExecutablePath != "" {
+		return errors.Errorf("executablepath may not be specified with storage %s", plugin.Storage)
+	}
+	switch plugin.Storage {
+	case S3Storage:
+		_, err := NewS3Client(plugin.Options)
+		if err != nil {
+			return err
+		}
+	case CopiesStorage:
+		if len(plugin.CopyConfigs) == 0 && len(plugin.copies) == 0 {
+			return errors.Errorf("storage %s requires the configs of the plugins to copy the backup with", CopiesStorage)
+		}
+	default:
+		return errors.Errorf("storage %s is not supported; the supported storage is %s", plugin.Storage, S3Storage)
+	}
+	gphome := operating.System.Getenv("GPHOME")
+	if gphome == "" {
+		return errors.Errorf("GPHOME must be set to use storage %s", plugin.Storage)
+	}
+	plugin.ExecutablePath = path.Join(gphome, "bin", "gpbackup_helper")
+	return nil
+}
+
+/*
+ * Plugin commands run on this host are killed if ctx is canceled.  Commands
+ * run on the cluster are killed along with the context of its executor.
+ */
+func (plugin *PluginConfig) SetContext(ctx context.Context) {
+	plugin.ctx = ctx
+}
+
+func (plugin *PluginConfig) context() context.Context {
+	if plugin.ctx == nil {
+		return context.Background()
+	}
+	return plugin.ctx
+}
+
 func (plugin *PluginConfig) BackupFile(filenamePath string) error {
 	command := fmt.Sprintf("%s backup_file %s %s", plugin.ExecutablePath, plugin.ConfigPath, filenamePath)
 	gplog.Debug("%s", command)
-	output, err := exec.Command("bash", "-c", command).CombinedOutput()
+	output, err := plugin.runLocalCommand("backup_file", command)
 	if err != nil {
-		return fmt.Errorf("ERROR: Plugin failed to process %s. %s", filenamePath, string(output))
+		return fmt.Errorf("ERROR: Plugin failed to process %s. %s", filenamePath, output)
 	}
 	err = operating.System.Chmod(filenamePath, 0755)
 	return err
@@ -80,18 +176,74 @@ func (plugin *PluginConfig) MustBackupFile(filenamePath string) {
 	gplog.FatalOnError(err)
 }
 
-func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
+func (plugin *PluginConfig) RestoreFile(filenamePath string) error {
 	directory, _ := path.Split(filenamePath)
 	err := operating.System.MkdirAll(directory, 0755)
-	gplog.FatalOnError(err)
+	if err != nil {
+		return err
+	}
 	command := fmt.Sprintf("%s restore_file %s %s", plugin.ExecutablePath, plugin.ConfigPath, filenamePath)
 	gplog.Debug("%s", command)
-	output, err := exec.Command("bash", "-c", command).CombinedOutput()
-	gplog.FatalOnError(err, string(output))
+	output, err := plugin.runLocalCommand("restore_file", command)
+	if err != nil {
+		return fmt.Errorf("ERROR: Plugin failed to process %s. %s", filenamePath, output)
+	}
+	return nil
+}
+
+func (plugin *PluginConfig) MustRestoreFile(filenamePath string) {
+	err := plugin.RestoreFile(filenamePath)
+	gplog.FatalOnError(err)
+}
+
+func (plugin *PluginConfig) runLocalCommand(description string, command string) (string, error) {
+	return plugin.RunWithRetries(description, func() (string, error) {
+		output, err := exec.CommandContext(plugin.context(), "bash", "-c", command).CombinedOutput()
+		return string(output), err
+	})
+}
+
+/*
+ * Returns the timestamps of the backups stored at the plugin's destination,
+ * in order, which plugins with the list_backups capability print one per line.
+ */
+func (plugin *PluginConfig) ListBackups(c *cluster.Cluster) ([]string, error) {
+	command := fmt.Sprintf("source %s/greenplum_path.sh && %s list_backups %s",
+		operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.ConfigPath)
+	gplog.Debug("%s", command)
+	output, err := plugin.RunWithRetries("list_backups", func() (string, error) {
+		return c.ExecuteLocalCommand(command)
+	})
+	if err != nil {
+		return nil, errors.Errorf("Unable to list backups with plugin %s: %s", plugin.ExecutablePath, strings.TrimSpace(output))
+	}
+	return ParseBackupList(output)
+}
+
+func ParseBackupList(output string) ([]string, error) {
+	timestamps := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		timestamp := strings.TrimSpace(line)
+		if timestamp == "" || seen[timestamp] {
+			continue
+		}
+		if !filepath.IsValidTimestamp(timestamp) {
+			return nil, errors.Errorf("Plugin listed a backup with invalid timestamp %s", timestamp)
+		}
+		seen[timestamp] = true
+		timestamps = append(timestamps, timestamp)
+	}
+	sort.Strings(timestamps)
+	return timestamps, nil
 }
 
 func (plugin *PluginConfig) CheckPluginExistsOnAllHosts(c *cluster.Cluster) string {
+	if plugin.Storage == CopiesStorage {
+		return plugin.checkCopyPluginsExistOnAllHosts(c)
+	}
 	plugin.checkPluginAPIVersion(c)
+	plugin.negotiateCapabilities(c)
 
 	return plugin.getPluginNativeVersion(c)
 }
@@ -101,7 +253,7 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 		operating.System.Getenv("GPHOME"), plugin.ExecutablePath)
 	remoteOutput := c.GenerateAndExecuteCommand(
 		"Checking plugin api version on all hosts",
-		cluster.ON_HOSTS&cluster.INCLUDE_MASTER,
+		cluster.ON_HOSTS|cluster.INCLUDE_MASTER,
 		func(contentID int) string {
 			return command
 		})
@@ -130,7 +282,7 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 					"with version on another segment", plugin.ExecutablePath, contentID, version)
 				cluster.LogFatalClusterError("Plugin API version is inconsistent "+
 					"across segments; please reinstall plugin across segments",
-					cluster.ON_HOSTS&cluster.INCLUDE_MASTER, numIncorrect)
+					cluster.ON_HOSTS|cluster.INCLUDE_MASTER, numIncorrect)
 			}
 		}
 
@@ -150,6 +302,76 @@ func (plugin *PluginConfig) checkPluginAPIVersion(c *cluster.Cluster) {
 		cluster.LogFatalClusterError("Plugin API version incorrect",
 			cluster.ON_HOSTS|cluster.INCLUDE_MASTER, numIncorrect)
 	}
+	plugin.apiVersion = version
+}
+
+/*
+ * Plugins older than PluginCapabilitiesVersion cannot report their
+ * capabilities, so those are inferred from the plugin config as before.
+ */
+func (plugin *PluginConfig) negotiateCapabilities(c *cluster.Cluster) {
+	if plugin.apiVersion.LT(semver.MustParse(PluginCapabilitiesVersion)) {
+		gplog.Verbose("Plugin %s API version %s does not report its capabilities; inferring them from the plugin config",
+			plugin.ExecutablePath, plugin.apiVersion)
+		plugin.Capabilities = plugin.legacyCapabilities()
+		return
+	}
+	command := fmt.Sprintf("source %s/greenplum_path.sh && %s plugin_capabilities %s",
+		operating.System.Getenv("GPHOME"), plugin.ExecutablePath, plugin.sourceConfigPath)
+	gplog.Debug("%s", command)
+	output, err := c.ExecuteLocalCommand(command)
+	if err != nil {
+		gplog.Fatal(err, "Unable to get capabilities of plugin %s: %s", plugin.ExecutablePath, output)
+	}
+	plugin.Capabilities, err = ParsePluginCapabilities(output)
+	gplog.FatalOnError(err)
+	if reportsStreamingTOC(output) {
+		gplog.Warn("Plugin %s reports the streaming_toc capability, which gpbackup does not support; "+
+			"the TOC is copied with backup_file and restore_file instead", plugin.ExecutablePath)
+	}
+	gplog.Verbose("Plugin %s capabilities: %+v", plugin.ExecutablePath, *plugin.Capabilities)
+}
+
+/*
+ * Capabilities missing from the output are unsupported, and capabilities
+ * this version does not know of are ignored, so that capabilities can be
+ * added to the plugin API without breaking older plugins or utilities.
+ */
+func ParsePluginCapabilities(output string) (*PluginCapabilities, error) {
+	capabilities := &PluginCapabilities{}
+	err := yaml.Unmarshal([]byte(output), capabilities)
+	if err != nil {
+		return nil, errors.Errorf("Unable to parse plugin capabilities: %v", err)
+	}
+	if capabilities.MaxConcurrency < 0 {
+		return nil, errors.Errorf("Plugin max_concurrency must not be negative, but is %d", capabilities.MaxConcurrency)
+	}
+	return capabilities, nil
+}
+
+func reportsStreamingTOC(output string) bool {
+	unsupported := struct {
+		StreamingTOC bool `yaml:"streaming_toc"`
+	}{}
+	_ = yaml.Unmarshal([]byte(output), &unsupported)
+	return unsupported.StreamingTOC
+}
+
+func (plugin *PluginConfig) legacyCapabilities() *PluginCapabilities {
+	return &PluginCapabilities{
+		RestoreSubset: plugin.Options["restore_subset"] == "on" ||
+			(strings.HasSuffix(plugin.ExecutablePath, "ddboost_plugin") && plugin.Options["restore_subset"] != "off"),
+		DeleteBackup: plugin.apiVersion.GE(semver.MustParse("0.4.0")),
+		Encryption: plugin.Options["password_encryption"] == "on" ||
+			(plugin.Options["replication"] == "on" && plugin.Options["remote_password_encryption"] == "on"),
+	}
+}
+
+func (plugin *PluginConfig) capabilities() *PluginCapabilities {
+	if plugin.Capabilities == nil {
+		return plugin.legacyCapabilities()
+	}
+	return plugin.Capabilities
 }
 
 func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
@@ -182,7 +404,7 @@ func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
 					"with version on another segment", plugin.ExecutablePath, contentID, pluginVersion)
 				cluster.LogFatalClusterError("Plugin --version is inconsistent "+
 					"across segments; please reinstall plugin across segments",
-					cluster.ON_HOSTS&cluster.INCLUDE_MASTER, numIncorrect)
+					cluster.ON_HOSTS|cluster.INCLUDE_MASTER, numIncorrect)
 			}
 		}
 
@@ -197,7 +419,7 @@ func (plugin *PluginConfig) getPluginNativeVersion(c *cluster.Cluster) string {
 	}
 	if numIncorrect > 0 || pluginVersion == "" {
 		cluster.LogFatalClusterError(fmt.Sprintf("Plugin --version response '%s' incorrect", badPluginVersion),
-			cluster.ON_HOSTS&cluster.INCLUDE_MASTER, numIncorrect)
+			cluster.ON_HOSTS|cluster.INCLUDE_MASTER, numIncorrect)
 	}
 	return parts[2]
 }
@@ -235,8 +457,9 @@ func (plugin *PluginConfig) executeHook(c *cluster.Cluster, verboseCommandMsg st
 	scope := MASTER
 	_, _ = plugin.buildHookErrorMsgAndFunc(command, scope)
 	masterContentID := -1
-	masterOutput, masterErr := c.ExecuteLocalCommand(
-		plugin.buildHookString(command, fpInfo, scope, masterContentID))
+	masterOutput, masterErr := plugin.RunWithRetries(command, func() (string, error) {
+		return c.ExecuteLocalCommand(plugin.buildHookString(command, fpInfo, scope, masterContentID))
+	})
 	if masterErr != nil {
 		if noFatal {
 			gplog.Error(masterOutput)
@@ -250,7 +473,7 @@ func (plugin *PluginConfig) executeHook(c *cluster.Cluster, verboseCommandMsg st
 	hookFunc := plugin.buildHookFunc(command, fpInfo, scope)
 	verboseErrorMsg, errorMsgFunc := plugin.buildHookErrorMsgAndFunc(command, scope)
 	verboseCommandHostMasterMsg := fmt.Sprintf(verboseCommandMsg, "segment hosts")
-	remoteOutput := c.GenerateAndExecuteCommand(verboseCommandHostMasterMsg, cluster.ON_HOSTS, hookFunc)
+	remoteOutput := plugin.executeClusterCommandWithRetries(c, command, verboseCommandHostMasterMsg, cluster.ON_HOSTS, hookFunc)
 	gplog.Debug("Execute Hook: %s", command)
 	c.CheckClusterError(remoteOutput, verboseErrorMsg, errorMsgFunc, noFatal)
 
@@ -259,7 +482,7 @@ func (plugin *PluginConfig) executeHook(c *cluster.Cluster, verboseCommandMsg st
 	hookFunc = plugin.buildHookFunc(command, fpInfo, scope)
 	verboseErrorMsg, errorMsgFunc = plugin.buildHookErrorMsgAndFunc(command, scope)
 	verboseCommandSegMsg := fmt.Sprintf(verboseCommandMsg, "segments")
-	remoteOutput = c.GenerateAndExecuteCommand(verboseCommandSegMsg, cluster.ON_SEGMENTS, hookFunc)
+	remoteOutput = plugin.executeClusterCommandWithRetries(c, command, verboseCommandSegMsg, cluster.ON_SEGMENTS, hookFunc)
 	c.CheckClusterError(remoteOutput, verboseErrorMsg, errorMsgFunc, noFatal)
 }
 
@@ -294,41 +517,88 @@ func (plugin *PluginConfig) buildHookErrorMsgAndFunc(command string,
 
 /*---------------------------------------------------------------------------------------------------*/
 
+/*
+ * Plugin commands are passed the path of the plugin config on each host,
+ * which is in a directory private to this run, as the config may hold secrets
+ * such as the key of a plugin using encryption.  runID names the directory
+ * along with the process ID, so that concurrent runs do not share it.
+ */
+func (plugin *PluginConfig) SetHostConfigPath(runID string) {
+	plugin.hostConfigDir = path.Join("/tmp", fmt.Sprintf("gpbackup_plugin_%s_%d", runID, operating.System.Getpid()))
+	plugin.ConfigPath = path.Join(plugin.hostConfigDir, path.Base(plugin.ConfigPath))
+	// The configs of the plugins used by storage copies are written alongside its own
+	plugin.CopyConfigs = make([]string, len(plugin.copies))
+	for i, copyConfig := range plugin.copies {
+		copyConfig.hostConfigDir = plugin.hostConfigDir
+		copyConfig.ConfigPath = path.Join(plugin.hostConfigDir, fmt.Sprintf("copy%d_%s", i, path.Base(copyConfig.ConfigPath)))
+		plugin.CopyConfigs[i] = copyConfig.ConfigPath
+	}
+}
+
+/*
+ * The config is written through the stdin of a command run on each host, so
+ * that it is never written to disk on the coordinator or passed on a command
+ * line, and is only readable by the user on each host.  The directory is
+ * only written to if the user owns it, in case another user created it first.
+ */
 func (plugin *PluginConfig) CopyPluginConfigToAllHosts(c *cluster.Cluster) {
-	// create a unique config file per segment in order to convey the PGPORT for the segment
-	// to the plugin.  At some point in the future, the plugin MAY be able to get PGPORT as
-	// an environmental var, at which time the code to write *specific* config files per segment
-	// can be removed
-	var command string
-	remoteOutput := c.GenerateAndExecuteCommand(
-		"Copying plugin config to all hosts",
-		cluster.ON_LOCAL|cluster.ON_HOSTS|cluster.INCLUDE_MASTER,
-		func(contentIDForSegmentOnHost int) string {
-			hostConfigFile := plugin.createHostPluginConfig(contentIDForSegmentOnHost, c)
-			command = fmt.Sprintf("scp %[1]s %s:%s; rm %[1]s", hostConfigFile,
-				c.GetHostForContent(contentIDForSegmentOnHost), plugin.ConfigPath)
-			return command
-		})
+	if plugin.hostConfigDir == "" {
+		gplog.Fatal(errors.New("The path of the plugin config on each host has not been set"), "")
+	}
+	// DeletePluginConfigOnAllHosts removes any config copied before a failure, too
+	plugin.copiedToHosts = true
+	for _, copyConfig := range plugin.copies {
+		copyConfig.writeConfigToAllHosts(c)
+	}
+	plugin.writeConfigToAllHosts(c)
+}
+
+func (plugin *PluginConfig) writeConfigToAllHosts(c *cluster.Cluster) {
+	scope := cluster.ON_HOSTS | cluster.INCLUDE_MASTER
+	command := fmt.Sprintf("umask 077 && mkdir -p %[1]s && test -O %[1]s && chmod 0700 %[1]s && cat > %[2]s",
+		plugin.hostConfigDir, plugin.ConfigPath)
+	commandList := c.GenerateSSHCommandList(scope, func(host string) string {
+		return command
+	})
+	for i := range commandList {
+		hostConfig := plugin.createHostPluginConfig(contentIDForHost(c, commandList[i].Host), c)
+		commandList[i].Command.Stdin = bytes.NewReader(hostConfig)
+	}
+	gplog.Verbose("Copying plugin config to all hosts")
 	gplog.Debug("%s", command)
+	remoteOutput := c.ExecuteClusterCommand(scope, commandList)
 	errMsg := "Unable to copy plugin config"
 	c.CheckClusterError(
 		remoteOutput,
 		errMsg,
-		func(contentID int) string {
+		func(host string) string {
 			return errMsg
 		},
 	)
 }
 
-func (plugin *PluginConfig) DeletePluginConfigWhenEncrypting(c *cluster.Cluster) {
-	if !plugin.UsesEncryption() {
+// The config on each host gives the port of one of its segments, for plugins that connect to the database
+func contentIDForHost(c *cluster.Cluster, host string) int {
+	contentIDs := c.GetContentsForHost(host)
+	if len(contentIDs) == 0 {
+		return -1
+	}
+	return contentIDs[0]
+}
+
+/*
+ * The copied plugin config is removed during cleanup, so that it is removed
+ * even if the run fails or is terminated.
+ */
+func (plugin *PluginConfig) DeletePluginConfigOnAllHosts(c *cluster.Cluster) {
+	if !plugin.copiedToHosts {
 		return
 	}
 
 	verboseMsg := "Removing plugin config from all hosts"
 	scope := cluster.ON_HOSTS | cluster.INCLUDE_MASTER
-	command := fmt.Sprintf("rm -f %s", plugin.ConfigPath)
-	f := func(contentIDForSegmentOnHost int) string {
+	command := fmt.Sprintf("rm -rf %s", plugin.hostConfigDir)
+	f := func(host string) string {
 		return command
 	}
 	remoteOutput := c.GenerateAndExecuteCommand(verboseMsg, scope, f)
@@ -337,21 +607,17 @@ func (plugin *PluginConfig) DeletePluginConfigWhenEncrypting(c *cluster.Cluster)
 	c.CheckClusterError(
 		remoteOutput,
 		errMsg,
-		func(contentID int) string {
+		func(host string) string {
 			return errMsg
 		},
 		true,
 	)
+	plugin.copiedToHosts = false
 }
 
-// Creates a valid segment-specific plugin configuration file with unique name
+// Returns the plugin config for the host of the given segment
 func (plugin *PluginConfig) createHostPluginConfig(contentIDForSegmentOnHost int,
-	c *cluster.Cluster) string {
-	// copy "general" config file to temp, and add segment-specific PGPORT value
-
-	segmentSpecificConfigFile := plugin.ConfigPath + "_" + strconv.FormatInt(time.Now().UnixNano(), 10) + "_" + strconv.Itoa(contentIDForSegmentOnHost)
-	file := iohelper.MustOpenFileForWriting(segmentSpecificConfigFile)
-
+	c *cluster.Cluster) []byte {
 	// add current pgport as attribute
 	plugin.Options["pgport"] = strconv.Itoa(c.GetPortForContent(contentIDForSegmentOnHost))
 	plugin.Options["backup_plugin_version"] = plugin.BackupPluginVersion()
@@ -369,14 +635,14 @@ func (plugin *PluginConfig) createHostPluginConfig(contentIDForSegmentOnHost int
 		}
 		plugin.Options[pluginName] = secret
 	}
-	out, err := yaml.Marshal(plugin)
-	gplog.FatalOnError(err)
-	bytes, err := file.Write(out)
-	gplog.FatalOnError(err)
-	err = file.Close()
+	hostConfig := *plugin
+	if plugin.Storage != "" {
+		// Each host finds gpbackup_helper under its own GPHOME
+		hostConfig.ExecutablePath = ""
+	}
+	out, err := yaml.Marshal(hostConfig)
 	gplog.FatalOnError(err)
-	gplog.Debug("Wrote %d bytes to plugin config %s", bytes, segmentSpecificConfigFile)
-	return segmentSpecificConfigFile
+	return out
 }
 
 func GetSecretKey(pluginName string, mdd string) (string, error) {
@@ -412,8 +678,11 @@ func (plugin *PluginConfig) BackupSegmentTOCs(c *cluster.Cluster, fpInfo filepat
 	c.CheckClusterError(remoteOutput, "Error occurred in gpbackup_helper", func(contentID int) string {
 		return "See gpAdminLog for gpbackup_helper on segment host for details: Error occurred with plugin"
 	})
+	if plugin.BuffersData() {
+		plugin.CollectHelperRetries(c, fpInfo)
+	}
 
-	remoteOutput = c.GenerateAndExecuteCommand("Processing segment TOC files with plugin", cluster.ON_SEGMENTS,
+	remoteOutput = plugin.executeClusterCommandWithRetries(c, "backup_file", "Processing segment TOC files with plugin", cluster.ON_SEGMENTS,
 		func(contentID int) string {
 			tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
 			return fmt.Sprintf("source %s/greenplum_path.sh && %s backup_file %s %s && "+
@@ -426,7 +695,7 @@ func (plugin *PluginConfig) BackupSegmentTOCs(c *cluster.Cluster, fpInfo filepat
 
 func (plugin *PluginConfig) RestoreSegmentTOCs(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
 	var command string
-	remoteOutput := c.GenerateAndExecuteCommand("Processing segment TOC files with plugin", cluster.ON_SEGMENTS, func(contentID int) string {
+	remoteOutput := plugin.executeClusterCommandWithRetries(c, "restore_file", "Processing segment TOC files with plugin", cluster.ON_SEGMENTS, func(contentID int) string {
 		tocFile := fpInfo.GetSegmentTOCFilePath(contentID)
 		command = fmt.Sprintf("mkdir -p %s && source %s/greenplum_path.sh && %s restore_file %s %s",
 			fpInfo.GetDirForContent(contentID), operating.System.Getenv("GPHOME"),
@@ -439,9 +708,33 @@ func (plugin *PluginConfig) RestoreSegmentTOCs(c *cluster.Cluster, fpInfo filepa
 	})
 }
 
+/*
+ * Returns where the plugin stores backups: the bucket and prefix of the
+ * built-in S3 storage, or else the absolute path of the config the user gave,
+ * since the options a plugin stores backups by are only known to the plugin.
+ * The config copied to each host is not used, as its name is not stable.
+ */
+func (plugin *PluginConfig) Destination() string {
+	if plugin.Storage == S3Storage {
+		prefix := strings.Trim(plugin.Options["prefix"], "/")
+		return strings.TrimSuffix(fmt.Sprintf("s3://%s/%s", plugin.Options["bucket"], prefix), "/")
+	}
+	configPath := plugin.sourceConfigPath
+	if configPath == "" {
+		configPath = plugin.ConfigPath
+	}
+	if configPath == "" {
+		return ""
+	}
+	absPath, err := path.Abs(configPath)
+	if err != nil {
+		return configPath
+	}
+	return absPath
+}
+
 func (plugin *PluginConfig) UsesEncryption() bool {
-	return plugin.Options["password_encryption"] == "on" ||
-		(plugin.Options["replication"] == "on" && plugin.Options["remote_password_encryption"] == "on")
+	return plugin.capabilities().Encryption
 }
 
 func (plugin *PluginConfig) GetPluginName(c *cluster.Cluster) (pluginName string, err error) {
@@ -477,7 +770,23 @@ func (plugin *PluginConfig) SetBackupPluginVersion(timestamp string, historicalP
 }
 
 func (plugin *PluginConfig) CanRestoreSubset() bool {
-	return (plugin.Options["restore_subset"] == "on") ||
-		(strings.HasSuffix(plugin.ExecutablePath, "ddboost_plugin") &&
-			plugin.Options["restore_subset"] != "off")
+	return plugin.capabilities().RestoreSubset && plugin.Options["restore_subset"] != "off"
+}
+
+func (plugin *PluginConfig) CanListBackups() bool {
+	return plugin.capabilities().ListBackups
+}
+
+/*
+ * Returns the number of tables to copy through the plugin at once, which is
+ * the number of jobs unless the plugin limits its concurrency to fewer.
+ */
+func (plugin *PluginConfig) LimitConcurrency(numJobs int) int {
+	maxConcurrency := plugin.capabilities().MaxConcurrency
+	if maxConcurrency > 0 && maxConcurrency < numJobs {
+		gplog.Verbose("Plugin %s supports at most %d concurrent copies; copying %d tables at a time instead of %d",
+			plugin.ExecutablePath, maxConcurrency, maxConcurrency, numJobs)
+		return maxConcurrency
+	}
+	return numJobs
 }
@@ -0,0 +1,172 @@
+package utils
+
+/*
+ * This file contains the built-in storage that copies a backup to more than
+ * one destination, used when gpbackup is given a --backup-dir along with a
+ * plugin config or more than one plugin config.  gpbackup passes its plugin
+ * commands to gpbackup_helper with a config such as
+ *
+ *   storage: copies
+ *   local_copy: true
+ *   copies: [/tmp/gpbackup_plugin_<timestamp>_<pid>/copy0_s3_config.yaml]
+ *
+ * which runs each command with every plugin in copies, and for backup_data
+ * tees the data to all of them and to the backup directory if local_copy is
+ * set.  A destination that fails is recorded in the copy failures file of the
+ * backup directory and skipped from then on, and the command only fails if
+ * every destination has failed, so that the backup can be restored from any
+ * copy that succeeded.
+ */
+
+import (
+	"fmt"
+	path "path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/pkg/errors"
+)
+
+const (
+	CopiesStorage    = "copies"
+	CopyFailuresFile = "gpbackup_copy_failures"
+)
+
+/*
+ * Returns a config using storage copies for the given plugin configs, which
+ * also keeps the data in the backup directory if localCopy is set.
+ */
+func NewCopiesPluginConfig(copies []*PluginConfig, localCopy bool) (*PluginConfig, error) {
+	config := &PluginConfig{
+		Storage:    CopiesStorage,
+		ConfigPath: "gpbackup_copies_config.yaml",
+		Options:    make(map[string]string),
+		LocalCopy:  localCopy,
+		copies:     copies,
+	}
+	err := config.useBuiltInStorage()
+	if err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (plugin *PluginConfig) readCopyConfigs() error {
+	plugin.copies = make([]*PluginConfig, len(plugin.CopyConfigs))
+	for i, configPath := range plugin.CopyConfigs {
+		copyConfig, err := ReadPluginConfig(configPath)
+		if err != nil {
+			return err
+		}
+		if copyConfig.Storage == CopiesStorage {
+			return errors.Errorf("Plugin config %s may not use storage %s", configPath, CopiesStorage)
+		}
+		plugin.copies[i] = copyConfig
+	}
+	return nil
+}
+
+// Returns the configs of the plugins a config using storage copies copies the backup with
+func (plugin *PluginConfig) Copies() []*PluginConfig {
+	return plugin.copies
+}
+
+/*
+ * One of the destinations of a backup, which is the backup directory if
+ * Plugin is nil.  Destinations are numbered from 0 in the order they are
+ * recorded in the backup config, with the backup directory first.
+ */
+type CopyDestination struct {
+	Index  int
+	Plugin *PluginConfig
+}
+
+func (plugin *PluginConfig) CopyDestinations() []CopyDestination {
+	destinations := make([]CopyDestination, 0)
+	if plugin.LocalCopy {
+		destinations = append(destinations, CopyDestination{Index: 0})
+	}
+	for _, copyConfig := range plugin.copies {
+		destinations = append(destinations, CopyDestination{Index: len(destinations), Plugin: copyConfig})
+	}
+	return destinations
+}
+
+func (destination CopyDestination) String() string {
+	if destination.Plugin == nil {
+		return "the backup directory"
+	}
+	return fmt.Sprintf("plugin %s", destination.Plugin.ExecutablePath)
+}
+
+/*
+ * Checks each plugin as CheckPluginExistsOnAllHosts does.  Returns the
+ * version of the first, which is the one given by --plugin-config.
+ */
+func (plugin *PluginConfig) checkCopyPluginsExistOnAllHosts(c *cluster.Cluster) string {
+	capabilities := &PluginCapabilities{}
+	versions := make([]string, len(plugin.copies))
+	for i, copyConfig := range plugin.copies {
+		versions[i] = copyConfig.CheckPluginExistsOnAllHosts(c)
+		maxConcurrency := copyConfig.capabilities().MaxConcurrency
+		if maxConcurrency > 0 && (capabilities.MaxConcurrency == 0 || maxConcurrency < capabilities.MaxConcurrency) {
+			capabilities.MaxConcurrency = maxConcurrency
+		}
+	}
+	plugin.Capabilities = capabilities
+	return versions[0]
+}
+
+func GetCopyFailuresFilePath(backupDir string) string {
+	return path.Join(backupDir, CopyFailuresFile)
+}
+
+// Returns the line recording a failed destination in the copy failures file
+func FormatCopyFailure(index int, err error) string {
+	message := strings.Join(strings.Fields(err.Error()), " ")
+	return fmt.Sprintf("%d %s\n", index, message)
+}
+
+// Returns the error of each failed destination in the copy failures file, by its index
+func ParseCopyFailures(contents string) map[int]string {
+	failures := make(map[int]string)
+	for _, line := range strings.Split(contents, "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+		index, err := strconv.Atoi(fields[0])
+		if err != nil {
+			continue
+		}
+		if _, found := failures[index]; !found {
+			failures[index] = ""
+			if len(fields) > 1 {
+				failures[index] = fields[1]
+			}
+		}
+	}
+	return failures
+}
+
+/*
+ * Returns the error of each destination that failed in the backup directory
+ * of any segment, by its index, and removes the copy failures files.
+ */
+func (plugin *PluginConfig) CollectCopyFailures(c *cluster.Cluster, fpInfo filepath.FilePathInfo) map[int]string {
+	remoteOutput := c.GenerateAndExecuteCommand("Checking for failed copies of the backup", cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER, func(contentID int) string {
+		failuresFile := GetCopyFailuresFilePath(fpInfo.GetDirForContent(contentID))
+		return fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi; rm -f %[1]s", failuresFile)
+	})
+	c.CheckClusterError(remoteOutput, "Unable to check for failed copies of the backup", func(contentID int) string {
+		return fmt.Sprintf("Unable to check for failed copies of the backup on segment %d", contentID)
+	}, true)
+	failures := make(map[int]string)
+	for _, command := range remoteOutput.Commands {
+		for index, message := range ParseCopyFailures(command.Stdout) {
+			if _, found := failures[index]; !found {
+				failures[index] = fmt.Sprintf("segment %d: %s", command.Content, message)
+			}
+		}
+	}
+	return failures
+}
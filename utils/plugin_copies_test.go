@@ -0,0 +1,153 @@
+package utils_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/plugin_copies tests", func() {
+	var tempDir string
+	var testCluster *cluster.Cluster
+	var executor testutils.TestExecutorMultiple
+
+	BeforeEach(func() {
+		operating.InitializeSystemFunctions()
+		operating.System.Getenv = func(string) string { return "/usr/local/gpdb" }
+		tempDir, _ = ioutil.TempDir("", "plugin_copies")
+		executor = testutils.TestExecutorMultiple{}
+		testCluster = cluster.NewCluster([]cluster.SegConfig{
+			{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master", Port: 100},
+			{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1", Port: 101},
+			{ContentID: 1, DataDir: "/data/gpseg1", Hostname: "segment2", Port: 102},
+		})
+		testCluster.Executor = &executor
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	writeConfig := func(name string, contents string) string {
+		configPath := path.Join(tempDir, name)
+		Expect(ioutil.WriteFile(configPath, []byte(contents), 0600)).To(Succeed())
+		return configPath
+	}
+	readConfig := func(configPath string) *utils.PluginConfig {
+		config, err := utils.ReadPluginConfig(configPath)
+		Expect(err).ToNot(HaveOccurred())
+		return config
+	}
+
+	Describe("ReadPluginConfig", func() {
+		It("reads the config of each plugin a config using storage copies copies the backup with", func() {
+			s3Config := writeConfig("s3_config.yaml", "executablepath: /usr/local/bin/s3_plugin\n")
+			ddboostConfig := writeConfig("ddboost_config.yaml", "executablepath: /usr/local/bin/ddboost_plugin\n")
+			copiesConfig := writeConfig("copies_config.yaml", fmt.Sprintf("storage: copies\nlocal_copy: true\ncopies: [%s, %s]\n", s3Config, ddboostConfig))
+
+			config := readConfig(copiesConfig)
+
+			Expect(config.ExecutablePath).To(Equal("/usr/local/gpdb/bin/gpbackup_helper"))
+			Expect(config.Copies()).To(HaveLen(2))
+			Expect(config.Copies()[0].ExecutablePath).To(Equal("/usr/local/bin/s3_plugin"))
+			Expect(config.Copies()[1].ExecutablePath).To(Equal("/usr/local/bin/ddboost_plugin"))
+		})
+		It("returns an error if no plugins are given", func() {
+			copiesConfig := writeConfig("copies_config.yaml", "storage: copies\nlocal_copy: true\n")
+
+			_, err := utils.ReadPluginConfig(copiesConfig)
+			Expect(err).To(MatchError("storage copies requires the configs of the plugins to copy the backup with"))
+		})
+		It("returns an error if a plugin also uses storage copies", func() {
+			nestedConfig := writeConfig("nested_config.yaml", "storage: copies\ncopies: [/tmp/s3_config.yaml]\n")
+			copiesConfig := writeConfig("copies_config.yaml", fmt.Sprintf("storage: copies\ncopies: [%s]\n", nestedConfig))
+
+			_, err := utils.ReadPluginConfig(copiesConfig)
+			Expect(err).To(HaveOccurred())
+		})
+	})
+	Describe("CopyDestinations", func() {
+		It("numbers the backup directory first and then each plugin", func() {
+			s3Config := readConfig(writeConfig("s3_config.yaml", "executablepath: /usr/local/bin/s3_plugin\n"))
+			ddboostConfig := readConfig(writeConfig("ddboost_config.yaml", "executablepath: /usr/local/bin/ddboost_plugin\n"))
+			config, err := utils.NewCopiesPluginConfig([]*utils.PluginConfig{s3Config, ddboostConfig}, true)
+			Expect(err).ToNot(HaveOccurred())
+
+			destinations := config.CopyDestinations()
+
+			Expect(destinations).To(Equal([]utils.CopyDestination{
+				{Index: 0},
+				{Index: 1, Plugin: s3Config},
+				{Index: 2, Plugin: ddboostConfig},
+			}))
+			Expect(destinations[0].String()).To(Equal("the backup directory"))
+			Expect(destinations[1].String()).To(Equal("plugin /usr/local/bin/s3_plugin"))
+		})
+	})
+	Describe("CopyPluginConfigToAllHosts", func() {
+		It("writes the config of each plugin alongside the config using storage copies", func() {
+			s3Config := readConfig(writeConfig("s3_config.yaml", "executablepath: /usr/local/bin/s3_plugin\n"))
+			config, err := utils.NewCopiesPluginConfig([]*utils.PluginConfig{s3Config}, true)
+			Expect(err).ToNot(HaveOccurred())
+			configDir := fmt.Sprintf("/tmp/gpbackup_plugin_20170101010101_%d", os.Getpid())
+			executor.ClusterOutputs = []*cluster.RemoteOutput{{}, {}}
+
+			config.SetHostConfigPath("20170101010101")
+			config.CopyPluginConfigToAllHosts(testCluster)
+
+			Expect(s3Config.ConfigPath).To(Equal(configDir + "/copy0_s3_config.yaml"))
+			Expect(config.ConfigPath).To(Equal(configDir + "/gpbackup_copies_config.yaml"))
+			Expect(executor.NumRemoteExecutions).To(Equal(2))
+			Expect(executor.ClusterCommands[0][0].CommandString).To(HaveSuffix("cat > " + s3Config.ConfigPath))
+			Expect(executor.ClusterCommands[1][0].CommandString).To(HaveSuffix("cat > " + config.ConfigPath))
+			hostConfig, err := ioutil.ReadAll(executor.ClusterCommands[1][0].Command.Stdin)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(hostConfig)).To(ContainSubstring("storage: copies\n"))
+			Expect(string(hostConfig)).To(ContainSubstring(fmt.Sprintf("copies:\n- %s\nlocal_copy: true\n", s3Config.ConfigPath)))
+		})
+	})
+	Describe("ParseCopyFailures", func() {
+		It("returns the first error recorded for each destination", func() {
+			contents := utils.FormatCopyFailure(1, errors.New("exit status 1: connection\nrefused")) +
+				utils.FormatCopyFailure(0, errors.New("no space left on device")) +
+				utils.FormatCopyFailure(1, errors.New("exit status 1: timed out"))
+
+			Expect(utils.ParseCopyFailures(contents)).To(Equal(map[int]string{
+				0: "no space left on device",
+				1: "exit status 1: connection refused",
+			}))
+		})
+	})
+	Describe("CollectCopyFailures", func() {
+		It("returns the destinations that failed on any segment and removes the copy failures files", func() {
+			executor.ClusterOutputs = []*cluster.RemoteOutput{
+				cluster.NewRemoteOutput(cluster.ON_SEGMENTS|cluster.INCLUDE_MASTER, 0, []cluster.ShellCommand{
+					{Content: -1},
+					{Content: 0, Stdout: "2 exit status 1: timed out\n"},
+					{Content: 1, Stdout: "2 exit status 1: connection refused\n0 no space left on device\n"},
+				}),
+			}
+			config := &utils.PluginConfig{Storage: utils.CopiesStorage}
+			fpInfo := filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg")
+
+			failures := config.CollectCopyFailures(testCluster, fpInfo)
+
+			Expect(failures).To(Equal(map[int]string{
+				0: "segment 1: no space left on device",
+				2: "segment 0: exit status 1: timed out",
+			}))
+			Expect(executor.ClusterCommands[0][1].CommandString).To(ContainSubstring(
+				"rm -f /data/gpseg0/backups/20170101/20170101010101/gpbackup_copy_failures"))
+		})
+	})
+})
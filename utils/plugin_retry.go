@@ -0,0 +1,253 @@
+package utils
+
+/*
+ * This file contains the retry policy for plugin commands, given by the retry
+ * section of the plugin config:
+ *
+ *   retry:
+ *     retries: 3
+ *     initial_delay: 5s
+ *     max_delay: 1m
+ *     exit_codes: [75]
+ *     stderr_patterns: ["connection reset", "(?i)timed out"]
+ *     buffer_data: true
+ *
+ * A failed command is retried if its exit code is one of exit_codes or its
+ * error output matches one of stderr_patterns, or on any failure if neither
+ * is given.  The delay before each retry doubles from initial_delay up to
+ * max_delay.
+ */
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/gplog"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/pkg/errors"
+)
+
+const (
+	DefaultRetryInitialDelay = time.Second
+	DefaultRetryMaxDelay     = time.Minute
+)
+
+type PluginRetryPolicy struct {
+	Retries        int      `yaml:"retries"`
+	InitialDelay   string   `yaml:"initial_delay,omitempty"`
+	MaxDelay       string   `yaml:"max_delay,omitempty"`
+	ExitCodes      []int    `yaml:"exit_codes,omitempty"`
+	StderrPatterns []string `yaml:"stderr_patterns,omitempty"`
+	// gpbackup_helper buffers data in the backup directory so that backup_data and restore_data can be retried
+	BufferData   bool `yaml:"buffer_data,omitempty"`
+	initialDelay time.Duration
+	maxDelay     time.Duration
+	patterns     []*regexp.Regexp
+}
+
+func (policy *PluginRetryPolicy) validate() error {
+	if policy.Retries < 0 {
+		return errors.New("retries in the retry section of the plugin config may not be negative")
+	}
+	var err error
+	policy.initialDelay, err = parseRetryDelay("initial_delay", policy.InitialDelay, DefaultRetryInitialDelay)
+	if err != nil {
+		return err
+	}
+	policy.maxDelay, err = parseRetryDelay("max_delay", policy.MaxDelay, DefaultRetryMaxDelay)
+	if err != nil {
+		return err
+	}
+	if policy.maxDelay < policy.initialDelay {
+		return errors.New("max_delay in the retry section of the plugin config may not be less than initial_delay")
+	}
+	policy.patterns = make([]*regexp.Regexp, len(policy.StderrPatterns))
+	for i, pattern := range policy.StderrPatterns {
+		policy.patterns[i], err = regexp.Compile(pattern)
+		if err != nil {
+			return errors.Errorf("Invalid stderr pattern %s in the retry section of the plugin config: %v", pattern, err)
+		}
+	}
+	return nil
+}
+
+func parseRetryDelay(key string, value string, defaultDelay time.Duration) (time.Duration, error) {
+	if value == "" {
+		return defaultDelay, nil
+	}
+	delay, err := time.ParseDuration(value)
+	if err != nil || delay < 0 {
+		return 0, errors.Errorf("%s in the retry section of the plugin config must be a duration such as 30s, not %s", key, value)
+	}
+	return delay, nil
+}
+
+func (policy *PluginRetryPolicy) isRetryable(err error, stderr string) bool {
+	if len(policy.ExitCodes) == 0 && len(policy.patterns) == 0 {
+		return true
+	}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		for _, exitCode := range policy.ExitCodes {
+			if exitErr.ExitCode() == exitCode {
+				return true
+			}
+		}
+	}
+	for _, pattern := range policy.patterns {
+		if pattern.MatchString(stderr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the delay before the given retry, counting from 0
+func (policy *PluginRetryPolicy) delay(retry int) time.Duration {
+	delay := policy.initialDelay
+	for i := 0; i < retry && delay < policy.maxDelay; i++ {
+		delay *= 2
+	}
+	if delay > policy.maxDelay {
+		return policy.maxDelay
+	}
+	return delay
+}
+
+func (plugin *PluginConfig) retries() int {
+	if plugin.Retry == nil {
+		return 0
+	}
+	return plugin.Retry.Retries
+}
+
+func (plugin *PluginConfig) BuffersData() bool {
+	return plugin.Retry != nil && plugin.Retry.BufferData
+}
+
+// Returns the number of times a plugin command has been retried
+func (plugin *PluginConfig) NumRetries() int {
+	return int(atomic.LoadInt32(&plugin.numRetries))
+}
+
+func (plugin *PluginConfig) AddRetries(numRetries int) {
+	atomic.AddInt32(&plugin.numRetries, int32(numRetries))
+}
+
+/*
+ * Runs a plugin command on this host with run, which returns the command's
+ * output, retrying it as the retry policy allows.  Returns the output and
+ * error of the last attempt.
+ */
+func (plugin *PluginConfig) RunWithRetries(description string, run func() (string, error)) (string, error) {
+	for retry := 0; ; retry++ {
+		output, err := run()
+		if err == nil || retry >= plugin.retries() || plugin.context().Err() != nil || !plugin.Retry.isRetryable(err, output) {
+			return output, err
+		}
+		delay := plugin.Retry.delay(retry)
+		gplog.Warn("Plugin command %s failed, retrying in %v (retry %d of %d): %s",
+			description, delay, retry+1, plugin.Retry.Retries, strings.TrimSpace(output))
+		plugin.AddRetries(1)
+		if !sleepUnlessCanceled(plugin.context(), delay) {
+			return output, err
+		}
+	}
+}
+
+/*
+ * Runs a plugin command on the cluster in the same way as
+ * GenerateAndExecuteCommand, then runs the commands that failed again as the
+ * retry policy allows.  Returns the output of the last attempt on each
+ * segment or host.
+ */
+func (plugin *PluginConfig) executeClusterCommandWithRetries(c *cluster.Cluster, description string,
+	verboseMsg string, scope cluster.Scope, generator func(contentID int) string) *cluster.RemoteOutput {
+	remoteOutput := c.GenerateAndExecuteCommand(verboseMsg, scope, generator)
+	for retry := 0; retry < plugin.retries() && remoteOutput.NumErrors > 0; retry++ {
+		if plugin.context().Err() != nil {
+			break
+		}
+		delay := plugin.Retry.delay(retry)
+		retryCommands := make([]cluster.ShellCommand, 0)
+		for _, failedCommand := range remoteOutput.FailedCommands {
+			if !plugin.Retry.isRetryable(failedCommand.Error, failedCommand.Stderr) {
+				continue
+			}
+			gplog.Warn("Plugin command %s failed on segment %d, retrying in %v (retry %d of %d): %s",
+				description, failedCommand.Content, delay, retry+1, plugin.Retry.Retries, strings.TrimSpace(failedCommand.Stderr))
+			// A command cannot be started again, so a new one is made with the same arguments
+			retryCommands = append(retryCommands, cluster.NewShellCommand(failedCommand.Scope,
+				failedCommand.Content, failedCommand.Host, failedCommand.Command.Args))
+		}
+		if len(retryCommands) == 0 {
+			break
+		}
+		plugin.AddRetries(len(retryCommands))
+		if !sleepUnlessCanceled(plugin.context(), delay) {
+			break
+		}
+		retryOutput := c.ExecuteClusterCommand(scope, retryCommands)
+		remoteOutput = mergeRetryOutput(remoteOutput, retryOutput)
+	}
+	return remoteOutput
+}
+
+// Replaces the output of each retried command with that of its retry
+func mergeRetryOutput(remoteOutput *cluster.RemoteOutput, retryOutput *cluster.RemoteOutput) *cluster.RemoteOutput {
+	commands := make([]cluster.ShellCommand, len(remoteOutput.Commands))
+	copy(commands, remoteOutput.Commands)
+	for _, retryCommand := range retryOutput.Commands {
+		for i, command := range commands {
+			if command.Content == retryCommand.Content && command.Host == retryCommand.Host {
+				commands[i] = retryCommand
+			}
+		}
+	}
+	numErrors := 0
+	for _, command := range commands {
+		if command.Error != nil {
+			numErrors++
+		}
+	}
+	return cluster.NewRemoteOutput(remoteOutput.Scope, numErrors, commands)
+}
+
+func sleepUnlessCanceled(ctx context.Context, delay time.Duration) bool {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+/*
+ * gpbackup_helper writes the number of times it retried a plugin command to
+ * this file, so that its retries are counted in the report with the others.
+ */
+func GetHelperRetriesFilePath(fpInfo filepath.FilePathInfo, contentID int) string {
+	return fmt.Sprintf("%s_retries", fpInfo.GetSegmentPipeFilePath(contentID))
+}
+
+func (plugin *PluginConfig) CollectHelperRetries(c *cluster.Cluster, fpInfo filepath.FilePathInfo) {
+	remoteOutput := c.GenerateAndExecuteCommand("Counting plugin command retries of segment agents", cluster.ON_SEGMENTS, func(contentID int) string {
+		retriesFile := GetHelperRetriesFilePath(fpInfo, contentID)
+		return fmt.Sprintf("if [[ -f %[1]s ]]; then cat %[1]s; fi; rm -f %[1]s", retriesFile)
+	})
+	for _, command := range remoteOutput.Commands {
+		var numRetries int
+		_, err := fmt.Sscanf(strings.TrimSpace(command.Stdout), "%d", &numRetries)
+		if err == nil && numRetries > 0 {
+			gplog.Verbose("Plugin commands were retried %d times by the agent on segment %d", numRetries, command.Content)
+			plugin.AddRetries(numRetries)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package utils_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+
+	"github.com/greenplum-db/gp-common-go-libs/cluster"
+	"github.com/greenplum-db/gp-common-go-libs/operating"
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/greenplum-db/gpbackup/testutils"
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/ginkgo/extensions/table"
+	. "github.com/onsi/gomega"
+	. "github.com/onsi/gomega/gbytes"
+)
+
+var _ = Describe("utils/plugin_retry tests", func() {
+	var tempDir string
+
+	BeforeEach(func() {
+		operating.InitializeSystemFunctions()
+		tempDir, _ = ioutil.TempDir("", "plugin_retry")
+	})
+	AfterEach(func() {
+		_ = os.RemoveAll(tempDir)
+	})
+
+	// Reads a plugin config for a plugin that fails the given number of times before succeeding
+	readFlakyPluginConfig := func(numFailures int, retrySection string) *utils.PluginConfig {
+		plugin := fmt.Sprintf(`#!/bin/bash
+count=$(cat %[1]s/count 2>/dev/null || echo 0)
+echo $((count + 1)) > %[1]s/count
+if [ $count -lt %[2]d ]; then echo "connection reset by peer" >&2; exit 75; fi
+`, tempDir, numFailures)
+		pluginPath := path.Join(tempDir, "flaky_plugin")
+		Expect(ioutil.WriteFile(pluginPath, []byte(plugin), 0755)).To(Succeed())
+		configPath := path.Join(tempDir, "plugin_config.yaml")
+		config := fmt.Sprintf("executablepath: %s\n%s", pluginPath, retrySection)
+		Expect(ioutil.WriteFile(configPath, []byte(config), 0644)).To(Succeed())
+		pluginConfig, err := utils.ReadPluginConfig(configPath)
+		Expect(err).ToNot(HaveOccurred())
+		return pluginConfig
+	}
+	numAttempts := func() string {
+		contents, _ := ioutil.ReadFile(path.Join(tempDir, "count"))
+		return string(contents)
+	}
+
+	Describe("ReadPluginConfig", func() {
+		DescribeTable("returns an error for an invalid retry section",
+			func(retrySection string, expectedErr string) {
+				operating.System.ReadFile = func(string) ([]byte, error) {
+					return []byte("executablepath: /usr/local/gpdb/bin/myPlugin\nretry:\n" + retrySection), nil
+				}
+
+				_, err := utils.ReadPluginConfig("myconfigpath")
+				Expect(err).To(MatchError(expectedErr))
+			},
+			Entry("negative retries", "  retries: -1", "retries in the retry section of the plugin config may not be negative"),
+			Entry("invalid delay", "  retries: 1\n  initial_delay: soon", "initial_delay in the retry section of the plugin config must be a duration such as 30s, not soon"),
+			Entry("max delay below initial delay", "  retries: 1\n  initial_delay: 1m\n  max_delay: 10s", "max_delay in the retry section of the plugin config may not be less than initial_delay"),
+			Entry("invalid stderr pattern", "  retries: 1\n  stderr_patterns: [\"(\"]", "Invalid stderr pattern ( in the retry section of the plugin config: error parsing regexp: missing closing ): `(`"),
+		)
+	})
+	Describe("BackupFile", func() {
+		var filename string
+		BeforeEach(func() {
+			filename = path.Join(tempDir, "gpbackup_20170101010101_config.yaml")
+			Expect(ioutil.WriteFile(filename, []byte{}, 0644)).To(Succeed())
+		})
+
+		It("retries a failed command until it succeeds", func() {
+			pluginConfig := readFlakyPluginConfig(2, "retry:\n  retries: 3\n  initial_delay: 0s\n")
+
+			Expect(pluginConfig.BackupFile(filename)).To(Succeed())
+			Expect(numAttempts()).To(Equal("3\n"))
+			Expect(pluginConfig.NumRetries()).To(Equal(2))
+			Expect(logfile).To(Say(`Plugin command backup_file failed, retrying in 0s \(retry 1 of 3\): connection reset by peer`))
+			Expect(logfile).To(Say(`Plugin command backup_file failed, retrying in 0s \(retry 2 of 3\)`))
+		})
+		It("returns an error once the retries are used up", func() {
+			pluginConfig := readFlakyPluginConfig(3, "retry:\n  retries: 2\n  initial_delay: 0s\n")
+
+			err := pluginConfig.BackupFile(filename)
+			Expect(err).To(MatchError(fmt.Sprintf("ERROR: Plugin failed to process %s. connection reset by peer\n", filename)))
+			Expect(numAttempts()).To(Equal("3\n"))
+			Expect(pluginConfig.NumRetries()).To(Equal(2))
+		})
+		It("does not retry without a retry section", func() {
+			pluginConfig := readFlakyPluginConfig(1, "")
+
+			Expect(pluginConfig.BackupFile(filename)).ToNot(Succeed())
+			Expect(numAttempts()).To(Equal("1\n"))
+			Expect(pluginConfig.NumRetries()).To(Equal(0))
+		})
+		DescribeTable("only retries failures with a retryable exit code or error output",
+			func(retrySection string, expectedAttempts string) {
+				pluginConfig := readFlakyPluginConfig(1, "retry:\n  retries: 1\n  initial_delay: 0s\n"+retrySection)
+
+				_ = pluginConfig.BackupFile(filename)
+				Expect(numAttempts()).To(Equal(expectedAttempts))
+			},
+			Entry("retryable exit code", "  exit_codes: [1, 75]", "2\n"),
+			Entry("other exit code", "  exit_codes: [1]", "1\n"),
+			Entry("matching stderr pattern", "  stderr_patterns: [\"(?i)Connection reset\"]", "2\n"),
+			Entry("other stderr pattern", "  stderr_patterns: [\"timed out\"]", "1\n"),
+		)
+	})
+	Describe("SetupPluginForBackup", func() {
+		It("retries the hook on the segments where it failed", func() {
+			pluginConfig := readFlakyPluginConfig(0, "retry:\n  retries: 2\n  initial_delay: 0s\n")
+			failedCommand := exec.Command("bash", "-c", "setup_plugin_for_backup")
+			executor := testutils.TestExecutorMultiple{
+				ClusterOutputs: []*cluster.RemoteOutput{
+					cluster.NewRemoteOutput(cluster.ON_HOSTS, 0, []cluster.ShellCommand{{Content: 0}, {Content: 1}}),
+					cluster.NewRemoteOutput(cluster.ON_SEGMENTS, 1, []cluster.ShellCommand{
+						{Content: 0},
+						{Content: 1, Command: failedCommand, Stderr: "connection reset by peer", Error: fmt.Errorf("exit status 1")},
+					}),
+					cluster.NewRemoteOutput(cluster.ON_SEGMENTS, 0, []cluster.ShellCommand{{Content: 1}}),
+				},
+			}
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master"},
+				{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1"},
+				{ContentID: 1, DataDir: "/data/gpseg1", Hostname: "segment2"},
+			})
+			testCluster.Executor = &executor
+
+			pluginConfig.SetupPluginForBackup(testCluster, filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg"))
+
+			Expect(executor.NumRemoteExecutions).To(Equal(3))
+			Expect(executor.ClusterCommands[2]).To(HaveLen(1))
+			Expect(executor.ClusterCommands[2][0].Content).To(Equal(1))
+			Expect(executor.ClusterCommands[2][0].Command.Args).To(Equal(failedCommand.Args))
+			Expect(pluginConfig.NumRetries()).To(Equal(1))
+			Expect(logfile).To(Say(`Plugin command setup_plugin_for_backup failed on segment 1, retrying in 0s \(retry 1 of 2\): connection reset by peer`))
+		})
+	})
+	Describe("CollectHelperRetries", func() {
+		It("counts the retries of the agent on each segment", func() {
+			pluginConfig := readFlakyPluginConfig(0, "retry:\n  retries: 2\n")
+			executor := testutils.TestExecutorMultiple{
+				ClusterOutputs: []*cluster.RemoteOutput{
+					cluster.NewRemoteOutput(cluster.ON_SEGMENTS, 0, []cluster.ShellCommand{{Content: 0, Stdout: "2\n"}, {Content: 1}}),
+				},
+			}
+			testCluster := cluster.NewCluster([]cluster.SegConfig{
+				{ContentID: -1, DataDir: "/data/gpseg-1", Hostname: "master"},
+				{ContentID: 0, DataDir: "/data/gpseg0", Hostname: "segment1"},
+				{ContentID: 1, DataDir: "/data/gpseg1", Hostname: "segment2"},
+			})
+			testCluster.Executor = &executor
+			pluginConfig.AddRetries(1)
+
+			pluginConfig.CollectHelperRetries(testCluster, filepath.NewFilePathInfo(testCluster, "", "20170101010101", "gpseg"))
+
+			Expect(pluginConfig.NumRetries()).To(Equal(3))
+			Expect(executor.ClusterCommands[0][0].CommandString).To(MatchRegexp(`/data/gpseg0/gpbackup_0_20170101010101_pipe_\d+_retries`))
+		})
+	})
+})
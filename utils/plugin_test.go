@@ -4,10 +4,9 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
-	"regexp"
 	"strconv"
-	"strings"
 
 	"github.com/blang/semver"
 	"github.com/greenplum-db/gp-common-go-libs/cluster"
@@ -100,96 +99,165 @@ var _ = Describe("utils/plugin tests", func() {
 			}
 		})
 	})
-	Describe("creates segment-specific plugin config and copies it to all hosts", func() {
-		It("appends PGPORT and the --version of the plugin", func() {
-			testConfigPath := "/tmp/my_plugin_config.yaml"
-			testConfigContents := `
-executablepath: /tmp/fake_path
-options:
-    field1: 12
-    field2: hello
-    field3: 567
-`
-			err := ioutil.WriteFile(testConfigPath, []byte(testConfigContents), 0777)
-			Expect(err).To(Not(HaveOccurred()))
+	Describe("plugin capabilities via CheckPluginExistsOnAllHosts()", func() {
+		It("asks a plugin that supports it for its capabilities", func() {
+			for i := range executor.ClusterOutputs[0].Commands {
+				executor.ClusterOutputs[0].Commands[i].Stdout = utils.PluginCapabilitiesVersion
+			}
+			executor.LocalOutput = "restore_subset: true\nmax_concurrency: 2\nsome_future_capability: true\n"
+
+			_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(executor.LocalCommands).To(HaveLen(1))
+			Expect(executor.LocalCommands[0]).To(ContainSubstring("/a/b/myPlugin plugin_capabilities"))
+			Expect(*subject.Capabilities).To(Equal(utils.PluginCapabilities{RestoreSubset: true, MaxConcurrency: 2}))
+			Expect(subject.CanRestoreSubset()).To(BeTrue())
+			Expect(subject.LimitConcurrency(4)).To(Equal(2))
+			Expect(subject.LimitConcurrency(1)).To(Equal(1))
+		})
+		It("infers the capabilities of a plugin that does not support it", func() {
+			subject.ExecutablePath = "/a/b/gpbackup_ddboost_plugin"
+
+			_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(executor.LocalCommands).To(BeEmpty())
+			Expect(*subject.Capabilities).To(Equal(utils.PluginCapabilities{RestoreSubset: true}))
+			Expect(subject.LimitConcurrency(4)).To(Equal(4))
+		})
+		It("does not infer capabilities a plugin that supports it does not report from its name or options", func() {
+			for i := range executor.ClusterOutputs[0].Commands {
+				executor.ClusterOutputs[0].Commands[i].Stdout = utils.PluginCapabilitiesVersion
+			}
+			subject.ExecutablePath = "/a/b/gpbackup_ddboost_plugin"
+			subject.Options["restore_subset"] = "on"
+			subject.Options["password_encryption"] = "on"
+			executor.LocalOutput = "max_concurrency: 0\n"
+
+			_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(*subject.Capabilities).To(Equal(utils.PluginCapabilities{}))
+			Expect(subject.CanRestoreSubset()).To(BeFalse())
+			Expect(subject.UsesEncryption()).To(BeFalse())
+			Expect(subject.LimitConcurrency(4)).To(Equal(4))
+		})
+		It("warns that the TOC is not streamed if the plugin reports the streaming_toc capability", func() {
+			for i := range executor.ClusterOutputs[0].Commands {
+				executor.ClusterOutputs[0].Commands[i].Stdout = utils.PluginCapabilitiesVersion
+			}
+			executor.LocalOutput = "streaming_toc: true\nlist_backups: true\n"
+
+			_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+
+			Expect(*subject.Capabilities).To(Equal(utils.PluginCapabilities{ListBackups: true}))
+			Expect(string(logfile.Contents())).To(ContainSubstring("reports the streaming_toc capability, which gpbackup does not support"))
+		})
+		It("does not restore a subset if restore_subset is off, even if the plugin supports it", func() {
+			subject.Capabilities = &utils.PluginCapabilities{RestoreSubset: true}
+			subject.Options["restore_subset"] = "off"
+
+			Expect(subject.CanRestoreSubset()).To(BeFalse())
+		})
+		It("panics if the capabilities cannot be parsed", func() {
+			for i := range executor.ClusterOutputs[0].Commands {
+				executor.ClusterOutputs[0].Commands[i].Stdout = utils.PluginCapabilitiesVersion
+			}
+			executor.LocalOutput = "max_concurrency: -1\n"
+
+			defer testhelper.ShouldPanicWithMessage("Plugin max_concurrency must not be negative, but is -1")
+			_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+		})
+	})
+	Describe("ListBackups", func() {
+		It("returns the timestamps the plugin lists, in order and without duplicates", func() {
+			executor.LocalOutput = "20240102030405\n\n20230102030405\n20240102030405\n"
+
+			timestamps, err := subject.ListBackups(testCluster)
+
+			Expect(err).ToNot(HaveOccurred())
+			Expect(timestamps).To(Equal([]string{"20230102030405", "20240102030405"}))
+			Expect(executor.LocalCommands).To(HaveLen(1))
+			Expect(executor.LocalCommands[0]).To(HaveSuffix(fmt.Sprintf("/a/b/myPlugin list_backups %s", subject.ConfigPath)))
+		})
+		It("returns an error if the plugin lists an invalid timestamp", func() {
+			executor.LocalOutput = "20240102030405\nsome warning\n"
+
+			_, err := subject.ListBackups(testCluster)
+
+			Expect(err).To(MatchError("Plugin listed a backup with invalid timestamp some warning"))
+		})
+		It("returns an error with the output of the plugin if it fails", func() {
+			executor.LocalOutput = "cannot reach destination\n"
+			executor.LocalError = errors.New("exit status 1")
+
+			_, err := subject.ListBackups(testCluster)
+
+			Expect(err).To(MatchError("Unable to list backups with plugin /a/b/myPlugin: cannot reach destination"))
+		})
+	})
+	Describe("CopyPluginConfigToAllHosts", func() {
+		var configDir string
+		readHostConfigs := func(commands []cluster.ShellCommand) []string {
+			contents := make([]string, len(commands))
+			for i, command := range commands {
+				config, err := ioutil.ReadAll(command.Command.Stdin)
+				Expect(err).ToNot(HaveOccurred())
+				contents[i] = string(config)
+			}
+			return contents
+		}
+		BeforeEach(func() {
+			configDir = fmt.Sprintf("/tmp/gpbackup_plugin_20170101010101_%d", os.Getpid())
+			subject.SetHostConfigPath("20170101010101")
+		})
+
+		It("sets the path of the config on each host to a directory for the run", func() {
+			Expect(subject.ConfigPath).To(Equal(configDir + "/my_plugin_config.yaml"))
+		})
+		It("writes the config of each host through the stdin of a command run on it, with PGPORT and the --version of the plugin", func() {
 			subject.SetBackupPluginVersion("myTimestamp", "my.test.version")
 			subject.CopyPluginConfigToAllHosts(testCluster)
 
 			Expect(executor.NumRemoteExecutions).To(Equal(1))
 			cc := executor.ClusterCommands[0]
-			Expect(len(cc)).To(Equal(3))
-			Expect(cc[0].Content).To(Equal(-1))
-			Expect(cc[0].CommandString).To(MatchRegexp(`scp .*-1 master:\/tmp\/my_plugin_config\.yaml; rm .*-1`))
-			Expect(cc[1].Content).To(Equal(0))
-			Expect(cc[1].CommandString).To(MatchRegexp(`scp .*0 segment1:\/tmp\/my_plugin_config\.yaml; rm .*0`))
-			Expect(cc[2].Content).To(Equal(1))
-			Expect(cc[2].CommandString).To(MatchRegexp(`scp .*1 segment2:\/tmp\/my_plugin_config\.yaml; rm .*1`))
-
-			rgx := regexp.MustCompile(`scp (.*-1) master:\/tmp\/my_plugin_config\.yaml; rm .*-1`)
-			rs := rgx.FindStringSubmatch(cc[0].CommandString)
-			masterConfigPath := rs[1]
-			rgx = regexp.MustCompile(`scp (.*0) segment1:\/tmp\/my_plugin_config\.yaml; rm .*0`)
-			rs = rgx.FindStringSubmatch(cc[1].CommandString)
-			segmentOneConfigPath := rs[1]
-			rgx = regexp.MustCompile(`scp (.*1) segment2:\/tmp\/my_plugin_config\.yaml; rm .*1`)
-			rs = rgx.FindStringSubmatch(cc[2].CommandString)
-			segmentTwoConfigPath := rs[1]
-
-			// check contents
-			contents := strings.Join(iohelper.MustReadLinesFromFile(masterConfigPath), "\n")
-			Expect(contents).To(ContainSubstring("\n  pgport: \"100\""))
-			Expect(contents).To(ContainSubstring("\n  backup_plugin_version: my.test.version"))
-			contents = strings.Join(iohelper.MustReadLinesFromFile(segmentOneConfigPath), "\n")
-			Expect(contents).To(ContainSubstring("\n  pgport: \"101\""))
-			Expect(contents).To(ContainSubstring("\n  backup_plugin_version: my.test.version"))
-			contents = strings.Join(iohelper.MustReadLinesFromFile(segmentTwoConfigPath), "\n")
-			Expect(contents).To(ContainSubstring("\n  pgport: \"102\""))
-			Expect(contents).To(ContainSubstring("\n  backup_plugin_version: my.test.version"))
+			Expect(cc).To(HaveLen(3))
+			contents := readHostConfigs(cc)
+			for i, host := range []string{"master", "segment1", "segment2"} {
+				Expect(cc[i].Host).To(Equal(host))
+				Expect(cc[i].CommandString).To(ContainSubstring(fmt.Sprintf(
+					"umask 077 && mkdir -p %[1]s && test -O %[1]s && chmod 0700 %[1]s && cat > %[1]s/my_plugin_config.yaml", configDir)))
+				Expect(contents[i]).To(ContainSubstring(fmt.Sprintf("\n  pgport: \"%d\"", 100+i)))
+				Expect(contents[i]).To(ContainSubstring("\n  backup_plugin_version: my.test.version"))
+			}
+		})
+		It("writes the config to a directory only the user can read", func() {
+			subject.CopyPluginConfigToAllHosts(testCluster)
+			defer os.RemoveAll(configDir)
+
+			command := executor.ClusterCommands[0][0].Command
+			Expect(command.Args[:2]).To(Equal([]string{"bash", "-c"}))
+			output, err := exec.Command("bash", "-c", command.Args[2]+" && stat -c %a "+configDir+" "+subject.ConfigPath).CombinedOutput()
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(output)).To(Equal("700\n600\n"))
 		})
 		When("copying for a plugin with encryption", func() {
 			It("copies the encryption key", func() {
 				executor.LocalOutput = "gpbackup_fake_plugin version 1.0.1+dev.28.g00c877e"
-				testConfigPath := "/tmp/my_plugin_config.yaml"
-				testConfigContents := `
-executablepath: /tmp/foobar
-options:
-    field1: 12
-    field2: hello
-    field3: 567
-`
-				err := ioutil.WriteFile(testConfigPath, []byte(testConfigContents), 0777)
-				subject.Options["password_encryption"] = "on"
+				subject.Capabilities = &utils.PluginCapabilities{Encryption: true}
 				mdd := testCluster.GetDirForContent(-1)
 				_ = os.MkdirAll(mdd, 0777)
 				secretFilePath := filepath.Join(mdd, utils.SecretKeyFile)
 				secretFile := iohelper.MustOpenFileForWriting(secretFilePath)
-				_, err = secretFile.Write([]byte(`gpbackup_fake_plugin: 0123456789`))
+				_, err := secretFile.Write([]byte(`gpbackup_fake_plugin: 0123456789`))
 				Expect(err).To(Not(HaveOccurred()))
 
 				subject.CopyPluginConfigToAllHosts(testCluster)
 
-				// check contents
-				cc := executor.ClusterCommands[0]
-				rgx := regexp.MustCompile(`scp (.*-1) master:\/tmp\/my_plugin_config\.yaml; rm .*-1`)
-				rs := rgx.FindStringSubmatch(cc[0].CommandString)
-				masterConfigPath := rs[1]
-				rgx = regexp.MustCompile(`scp (.*0) segment1:\/tmp\/my_plugin_config\.yaml; rm .*0`)
-				rs = rgx.FindStringSubmatch(cc[1].CommandString)
-				segmentOneConfigPath := rs[1]
-				rgx = regexp.MustCompile(`scp (.*1) segment2:\/tmp\/my_plugin_config\.yaml; rm .*1`)
-				rs = rgx.FindStringSubmatch(cc[2].CommandString)
-				segmentTwoConfigPath := rs[1]
-
-				// check contents
-				contents := strings.Join(iohelper.MustReadLinesFromFile(masterConfigPath), "\n")
-				Expect(contents).To(ContainSubstring("\n  gpbackup_fake_plugin: \"0123456789\""))
-				contents = strings.Join(iohelper.MustReadLinesFromFile(segmentOneConfigPath), "\n")
-				Expect(contents).To(ContainSubstring("\n  gpbackup_fake_plugin: \"0123456789\""))
-				contents = strings.Join(iohelper.MustReadLinesFromFile(segmentTwoConfigPath), "\n")
-				Expect(contents).To(ContainSubstring("\n  gpbackup_fake_plugin: \"0123456789\""))
+				for _, contents := range readHostConfigs(executor.ClusterCommands[0]) {
+					Expect(contents).To(ContainSubstring("\n  gpbackup_fake_plugin: \"0123456789\""))
+				}
 			})
 			It("writes a stdout message when encrypt key is not found", func() {
-				subject.Options["password_encryption"] = "on"
+				subject.Capabilities = &utils.PluginCapabilities{Encryption: true}
 				executor.LocalOutput = "gpbackup_fake_plugin version 1.0.1+dev.28.g00c877e"
 				pluginName, err := subject.GetPluginName(testCluster)
 				Expect(err).To(Not(HaveOccurred()))
@@ -233,7 +301,7 @@ options:
 				co[0].Stdout = "0.2.0"
 				co[1].Stdout = "0.2.0"
 				co[2].Stdout = "0.2.0"
-				defer testhelper.ShouldPanicWithMessage("Plugin API version incorrect")
+				defer testhelper.ShouldPanicWithMessage("Plugin API version incorrect on 3 hosts")
 
 				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
 			})
@@ -261,7 +329,25 @@ options:
 		When("version inconsistent", func() {
 			It("panics with message", func() {
 				executor.ClusterOutputs[0].Commands[0].Stdout = "99.99.9999"
-				defer testhelper.ShouldPanicWithMessage("Plugin API version is inconsistent across segments")
+				defer testhelper.ShouldPanicWithMessage("Plugin API version is inconsistent across segments; please reinstall plugin across segments on 0 hosts")
+
+				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+			})
+		})
+		When("--version is incorrect", func() {
+			It("panics with a message counting hosts", func() {
+				for i := range executor.ClusterOutputs[1].Commands {
+					executor.ClusterOutputs[1].Commands[i].Stdout = "myPlugin"
+				}
+				defer testhelper.ShouldPanicWithMessage("Plugin --version response 'myPlugin' incorrect on 3 hosts")
+
+				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
+			})
+		})
+		When("--version is inconsistent", func() {
+			It("panics with a message counting hosts", func() {
+				executor.ClusterOutputs[1].Commands[2].Stdout = "myPlugin version 4.5.6"
+				defer testhelper.ShouldPanicWithMessage("Plugin --version is inconsistent across segments; please reinstall plugin across segments on 0 hosts")
 
 				_ = subject.CheckPluginExistsOnAllHosts(testCluster)
 			})
@@ -280,6 +366,35 @@ options:
 			subject.Options["remote_password_encryption"] = "on"
 			Expect(subject.UsesEncryption()).To(BeTrue())
 		})
+		It("returns false when the plugin does not report the encryption capability", func() {
+			subject.Capabilities = &utils.PluginCapabilities{}
+			subject.Options["password_encryption"] = "on"
+			Expect(subject.UsesEncryption()).To(BeFalse())
+		})
+		It("returns true when the plugin reports the encryption capability", func() {
+			subject.Capabilities = &utils.PluginCapabilities{Encryption: true}
+			Expect(subject.UsesEncryption()).To(BeTrue())
+		})
+	})
+	Describe("Destination", func() {
+		It("returns the path of the config of a plugin", func() {
+			Expect(subject.Destination()).To(Equal("/tmp/my_plugin_config.yaml"))
+		})
+		It("returns the bucket and prefix of the built-in s3 storage", func() {
+			subject.Storage = utils.S3Storage
+			subject.Options["bucket"] = "mybucket"
+			subject.Options["prefix"] = "/greenplum_backups/"
+			Expect(subject.Destination()).To(Equal("s3://mybucket/greenplum_backups"))
+		})
+		It("returns the path of the config read rather than the config copied to each host", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`executablepath: /a/b/myPlugin`), nil
+			}
+			config, err := utils.ReadPluginConfig("/home/gpadmin/myconfig.yaml")
+			Expect(err).ToNot(HaveOccurred())
+			config.SetHostConfigPath("20170101010101")
+			Expect(config.Destination()).To(Equal("/home/gpadmin/myconfig.yaml"))
+		})
 	})
 	Describe("GetSecretKey", func() {
 		It("returns a secret key when one exists for the given name", func() {
@@ -330,30 +445,25 @@ options:
 			Expect(err.Error()).To(Equal(fmt.Sprintf("Cannot find encryption key for plugin %s. Please re-encrypt password(s) so that key becomes available.", pluginName)))
 		})
 	})
-	Describe("DeleteConfigFileOnSegments", func() {
-		When("config has encryption", func() {
-			It("sends the correct cluster command to delete config file", func() {
-				subject.Options["password_encryption"] = "on"
-
-				subject.DeletePluginConfigWhenEncrypting(testCluster)
-
-				Expect(executor.NumRemoteExecutions).To(Equal(1))
-				cc := executor.ClusterCommands[0]
-				Expect(len(cc)).To(Equal(3))
-				Expect(cc[0].Content).To(Equal(-1))
-				Expect(cc[0].CommandString).To(ContainSubstring("rm -f /tmp/my_plugin_config.yaml"))
-				Expect(cc[1].Content).To(Equal(0))
-				Expect(cc[1].CommandString).To(ContainSubstring("rm -f /tmp/my_plugin_config.yaml"))
-				Expect(cc[2].Content).To(Equal(1))
-				Expect(cc[2].CommandString).To(ContainSubstring("rm -f /tmp/my_plugin_config.yaml"))
-			})
+	Describe("DeletePluginConfigOnAllHosts", func() {
+		It("removes the directory of the copied config from each host", func() {
+			subject.SetHostConfigPath("20170101010101")
+			subject.CopyPluginConfigToAllHosts(testCluster)
+
+			subject.DeletePluginConfigOnAllHosts(testCluster)
+
+			Expect(executor.NumRemoteExecutions).To(Equal(2))
+			cc := executor.ClusterCommands[1]
+			Expect(cc).To(HaveLen(3))
+			for i, host := range []string{"master", "segment1", "segment2"} {
+				Expect(cc[i].Host).To(Equal(host))
+				Expect(cc[i].CommandString).To(ContainSubstring(fmt.Sprintf("rm -rf /tmp/gpbackup_plugin_20170101010101_%d", os.Getpid())))
+			}
 		})
-		When("config does not have encryption", func() {
-			It("does not send a cluster command to delete config file", func() {
-				subject.DeletePluginConfigWhenEncrypting(testCluster)
+		It("does not send a cluster command if the config was not copied", func() {
+			subject.DeletePluginConfigOnAllHosts(testCluster)
 
-				Expect(executor.NumLocalExecutions).To(Equal(0))
-			})
+			Expect(executor.NumRemoteExecutions).To(Equal(0))
 		})
 	})
 	Describe("GetPluginName", func() {
@@ -404,5 +514,48 @@ hostname: "myhostname"`), nil
 			Expect(err).To(HaveOccurred())
 			Expect(err.Error()).To(Equal("plugin config file is formatted incorrectly"))
 		})
+		It("uses gpbackup_helper as the executable for a built-in storage type", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`storage: s3
+options:
+  bucket: mybucket
+  aws_access_key_id: mykey
+  aws_secret_access_key: mysecret`), nil
+			}
+			operating.System.Getenv = func(string) string { return "/usr/local/gpdb" }
+
+			config, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).ToNot(HaveOccurred())
+			Expect(config.ExecutablePath).To(Equal("/usr/local/gpdb/bin/gpbackup_helper"))
+		})
+		It("returns an error if executablepath is specified with a storage type", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`executablepath: /usr/local/gpdb/bin/gpbackup_s3_plugin
+storage: s3
+options:
+  bucket: mybucket`), nil
+			}
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("executablepath may not be specified with storage s3"))
+		})
+		It("returns an error for an unsupported storage type", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`storage: tape`), nil
+			}
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("storage tape is not supported; the supported storage is s3"))
+		})
+		It("returns an error for invalid storage options", func() {
+			operating.System.ReadFile = func(string) ([]byte, error) {
+				return []byte(`storage: s3
+options:
+  aws_access_key_id: mykey`), nil
+			}
+
+			_, err := utils.ReadPluginConfig("myconfigpath")
+			Expect(err).To(MatchError("bucket is required in the options of an s3 storage config"))
+		})
 	})
 })
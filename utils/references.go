@@ -0,0 +1,492 @@
+package utils
+
+/*
+ * This file contains structs and functions for finding the schema, relation,
+ * and database names in the statements printed to a backup file, so restore
+ * can rewrite exactly those names when redirecting objects.
+ */
+
+import (
+	"strings"
+)
+
+/*
+ * A name printed to a backup file.  ObjectType is SCHEMA, RELATION, or
+ * DATABASE, and Name is the quoted name of the object as the catalog gives it.
+ * Schema is the quoted schema of a RELATION.  Offset and Length give the
+ * location of the name as it was printed, and a name printed inside a string
+ * literal, such as the 'schema.table'::regclass in a column default, is
+ * escaped as part of that literal.  Unaliased is set for a RELATION listed
+ * in a FROM clause without an alias, whose name then also qualifies the
+ * columns that refer to it, as in the definitions pg_get_viewdef prints.
+ */
+type PrintedReference struct {
+	ObjectType string
+	Schema     string
+	Name       string
+	Offset     uint64
+	Length     int
+	InLiteral  bool
+	Unaliased  bool
+}
+
+/*
+ * The quoted schema and name of an object that can be referenced by a
+ * schema-qualified name, such as a relation, function, type, or operator.
+ */
+type ObjectName struct {
+	Schema     string
+	Name       string
+	IsRelation bool
+}
+
+/*
+ * The names of the objects in the database being backed up.  A pair of names
+ * in a statement is only taken to be a schema-qualified name if the schema
+ * contains an object with that name, so that an alias or column that happens
+ * to be named like a schema is not mistaken for one.
+ */
+type ObjectNames struct {
+	database string
+	objects  map[string]map[string]ObjectName
+}
+
+func NewObjectNames(quotedDatabase string, objects []ObjectName) *ObjectNames {
+	names := ObjectNames{database: quotedDatabase, objects: make(map[string]map[string]ObjectName)}
+	for _, object := range objects {
+		schema := unquoteIdentifier(object.Schema)
+		if names.objects[schema] == nil {
+			names.objects[schema] = make(map[string]ObjectName)
+		}
+		name := unquoteIdentifier(object.Name)
+		// Functions and relations may share a name, and only the relation can be redirected
+		if existing, ok := names.objects[schema][name]; ok && existing.IsRelation {
+			continue
+		}
+		names.objects[schema][name] = object
+	}
+	return &names
+}
+
+func unquoteIdentifier(identifier string) string {
+	if len(identifier) >= 2 && identifier[0] == '"' && identifier[len(identifier)-1] == '"' {
+		return strings.Replace(identifier[1:len(identifier)-1], `""`, `"`, -1)
+	}
+	return strings.Map(func(r rune) rune {
+		if r >= 'A' && r <= 'Z' {
+			return r + ('a' - 'A')
+		}
+		return r
+	}, identifier)
+}
+
+/*
+ * Finds the names of known objects in the statement: schema-qualified names,
+ * including those in column defaults, constraints, view definitions, and
+ * function bodies, the schema-qualified names in literals cast to an object
+ * identifier type or passed to the sequence functions, and the name of the
+ * database following the DATABASE keyword.  Comments and other literals are
+ * skipped.  Offsets are relative to the start of the statement.
+ */
+func (names *ObjectNames) FindReferences(statement string) []PrintedReference {
+	scanner := referenceScanner{names: names}
+	scanner.scan(statement, 0, nil, false)
+	return scanner.references
+}
+
+type referenceScanner struct {
+	names      *ObjectNames
+	references []PrintedReference
+}
+
+/*
+ * Scans text that is either part of the statement starting at base or, when
+ * offsets is set, the contents of a literal in the statement, in which case
+ * offsets gives the location in the statement of each byte of the text.
+ */
+func (scanner *referenceScanner) scan(text string, base int, offsets []int, inLiteral bool) {
+	location := func(i int) int {
+		if offsets != nil {
+			return offsets[i]
+		}
+		return base + i
+	}
+	record := func(token sqlToken, objectType string, schema string, name string) *PrintedReference {
+		start, end := location(token.start), location(token.end)
+		scanner.references = append(scanner.references, PrintedReference{ObjectType: objectType, Schema: schema, Name: name,
+			Offset: uint64(start), Length: end - start, InLiteral: inLiteral})
+		return &scanner.references[len(scanner.references)-1]
+	}
+
+	tokens := tokenizeSQL(text)
+	fromLists := fromListTracker{}
+	for i, token := range tokens {
+		previous, next := sqlToken{}, sqlToken{}
+		if i > 0 {
+			previous = tokens[i-1]
+		}
+		if i+1 < len(tokens) {
+			next = tokens[i+1]
+		}
+		fromLists.advance(text, token)
+		switch token.kind {
+		case tokenIdentifier, tokenQuotedIdentifier:
+			if next.is(text, ".") && !previous.is(text, ".") && i+2 < len(tokens) {
+				objectToken := tokens[i+2]
+				if objectToken.kind != tokenIdentifier && objectToken.kind != tokenQuotedIdentifier && objectToken.kind != tokenOperator {
+					continue
+				}
+				object, ok := scanner.names.objects[unquoteIdentifier(token.text(text))][unquoteIdentifier(objectToken.text(text))]
+				if !ok {
+					continue
+				}
+				record(token, "SCHEMA", "", object.Schema)
+				if object.IsRelation {
+					reference := record(objectToken, "RELATION", object.Schema, object.Name)
+					reference.Unaliased = fromLists.isListed(text, tokens, i) && !hasAlias(text, tokens, i+3)
+				}
+			} else if scanner.names.database != "" && token.kind == tokenIdentifier && strings.EqualFold(token.text(text), "DATABASE") &&
+				(next.kind == tokenIdentifier || next.kind == tokenQuotedIdentifier) &&
+				unquoteIdentifier(next.text(text)) == unquoteIdentifier(scanner.names.database) {
+				record(next, "DATABASE", "", scanner.names.database)
+			}
+		case tokenString, tokenDollarString:
+			if inLiteral {
+				continue
+			}
+			isFunctionBody := previous.kind == tokenIdentifier && strings.EqualFold(previous.text(text), "AS")
+			if token.kind == tokenDollarString {
+				if isFunctionBody {
+					contentStart, contentEnd := token.dollarContents(text)
+					if offsets != nil {
+						scanner.scan(text[contentStart:contentEnd], 0, offsets[contentStart:contentEnd+1], false)
+					} else {
+						scanner.scan(text[contentStart:contentEnd], base+contentStart, nil, false)
+					}
+				}
+				continue
+			}
+			if isFunctionBody || isObjectNameLiteral(text, tokens, i) {
+				contents, contentOffsets := token.stringContents(text)
+				for j := range contentOffsets {
+					contentOffsets[j] = location(contentOffsets[j])
+				}
+				scanner.scan(contents, 0, contentOffsets, true)
+			}
+		}
+	}
+}
+
+/*
+ * Follows the FROM clauses the tokens are in, keeping the parenthesis depth
+ * of each clause so that a subquery in a FROM clause does not end it.
+ */
+type fromListTracker struct {
+	depth     int
+	fromLists []int
+}
+
+var fromListEnds = map[string]bool{"where": true, "group": true, "having": true, "window": true, "order": true, "limit": true,
+	"offset": true, "fetch": true, "for": true, "union": true, "intersect": true, "except": true, "returning": true, "set": true,
+	"select": true, "on": true, "using": true}
+
+func (tracker *fromListTracker) advance(text string, token sqlToken) {
+	keyword := ""
+	if token.kind == tokenIdentifier {
+		keyword = strings.ToLower(token.text(text))
+	}
+	top := len(tracker.fromLists) - 1
+	switch {
+	case token.is(text, "("):
+		tracker.depth++
+	case token.is(text, ")"):
+		tracker.depth--
+		for top >= 0 && tracker.fromLists[top] > tracker.depth {
+			tracker.fromLists = tracker.fromLists[:top]
+			top--
+		}
+	case token.is(text, ";"):
+		tracker.fromLists = tracker.fromLists[:0]
+	case keyword == "from" || keyword == "join" || keyword == "update":
+		if top < 0 || tracker.fromLists[top] != tracker.depth {
+			tracker.fromLists = append(tracker.fromLists, tracker.depth)
+		}
+	case fromListEnds[keyword]:
+		if top >= 0 && tracker.fromLists[top] == tracker.depth {
+			tracker.fromLists = tracker.fromLists[:top]
+		}
+	}
+}
+
+// Returns whether the name starting at token i is one of the relations listed in a FROM clause
+func (tracker *fromListTracker) isListed(text string, tokens []sqlToken, i int) bool {
+	if i > 0 && strings.EqualFold(tokens[i-1].text(text), "ONLY") {
+		i--
+	}
+	if i == 0 {
+		return false
+	}
+	switch previous := tokens[i-1]; {
+	case previous.kind == tokenIdentifier:
+		switch strings.ToLower(previous.text(text)) {
+		case "from", "join", "update":
+			return true
+		}
+	case previous.is(text, ","):
+		top := len(tracker.fromLists) - 1
+		return top >= 0 && tracker.fromLists[top] == tracker.depth
+	}
+	return false
+}
+
+var keywordsAfterFromListItem = map[string]bool{"join": true, "inner": true, "left": true, "right": true, "full": true,
+	"cross": true, "natural": true, "tablesample": true}
+
+// Returns whether token i is an alias for the relation before it
+func hasAlias(text string, tokens []sqlToken, i int) bool {
+	if i >= len(tokens) {
+		return false
+	}
+	switch tokens[i].kind {
+	case tokenQuotedIdentifier:
+		return true
+	case tokenIdentifier:
+		keyword := strings.ToLower(tokens[i].text(text))
+		return keyword == "as" || !(fromListEnds[keyword] || keywordsAfterFromListItem[keyword])
+	}
+	return false
+}
+
+// Returns whether the literal is cast to an object identifier type, such as regclass, or names a sequence
+func isObjectNameLiteral(text string, tokens []sqlToken, i int) bool {
+	if i+2 < len(tokens) && tokens[i+1].is(text, "::") {
+		typeName := tokens[i+2]
+		if i+4 < len(tokens) && strings.EqualFold(typeName.text(text), "pg_catalog") && tokens[i+3].is(text, ".") {
+			typeName = tokens[i+4]
+		}
+		return typeName.kind == tokenIdentifier && strings.HasPrefix(strings.ToLower(typeName.text(text)), "reg")
+	}
+	if i >= 2 && tokens[i-1].is(text, "(") && tokens[i-2].kind == tokenIdentifier {
+		switch strings.ToLower(tokens[i-2].text(text)) {
+		case "nextval", "currval", "setval":
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	tokenIdentifier = iota + 1
+	tokenQuotedIdentifier
+	tokenString
+	tokenEscapeString
+	tokenDollarString
+	tokenOperator
+	tokenOther
+)
+
+type sqlToken struct {
+	kind  int
+	start int
+	end   int
+}
+
+func (token sqlToken) text(text string) string {
+	return text[token.start:token.end]
+}
+
+// Returns whether the token is the given punctuation
+func (token sqlToken) is(text string, value string) bool {
+	return token.kind == tokenOther && token.text(text) == value
+}
+
+// Returns the contents of a dollar-quoted string without its opening and closing tags
+func (token sqlToken) dollarContents(text string) (int, int) {
+	tagEnd := strings.Index(text[token.start+1:token.end], "$") + token.start + 2
+	tag := text[token.start:tagEnd]
+	contentEnd := token.end - len(tag)
+	if contentEnd < tagEnd || !strings.HasSuffix(text[token.start:token.end], tag) {
+		contentEnd = token.end
+	}
+	return tagEnd, contentEnd
+}
+
+/*
+ * Returns the contents of a quoted string with its doubled quotes undone,
+ * along with the offset in text of each byte of the contents and of the end
+ * of the contents.
+ */
+func (token sqlToken) stringContents(text string) (string, []int) {
+	var contents strings.Builder
+	offsets := make([]int, 0, token.end-token.start)
+	i := token.start + 1
+	for i < token.end {
+		if text[i] == '\'' {
+			if i+1 < token.end && text[i+1] == '\'' {
+				contents.WriteByte('\'')
+				offsets = append(offsets, i)
+				i += 2
+				continue
+			}
+			break
+		}
+		contents.WriteByte(text[i])
+		offsets = append(offsets, i)
+		i++
+	}
+	offsets = append(offsets, i)
+	return contents.String(), offsets
+}
+
+func isIdentifierStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
+
+func isIdentifierPart(c byte) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9') || c == '$'
+}
+
+func isOperatorCharacter(c byte) bool {
+	return strings.IndexByte("+-*/<>=~!@#%^&|`?", c) >= 0
+}
+
+/*
+ * Splits SQL text into tokens, skipping whitespace and comments.  A string or
+ * comment that is not closed runs to the end of the text.
+ */
+func tokenizeSQL(text string) []sqlToken {
+	tokens := make([]sqlToken, 0)
+	i := 0
+	for i < len(text) {
+		c := text[i]
+		start := i
+		kind := tokenOther
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			i++
+			continue
+		case strings.HasPrefix(text[i:], "--"):
+			if end := strings.IndexByte(text[i:], '\n'); end >= 0 {
+				i += end + 1
+			} else {
+				i = len(text)
+			}
+			continue
+		case strings.HasPrefix(text[i:], "/*"):
+			i = skipBlockComment(text, i)
+			continue
+		case c == '"':
+			kind = tokenQuotedIdentifier
+			i = skipQuoted(text, i, '"', false)
+		case c == '\'':
+			kind = tokenString
+			i = skipQuoted(text, i, '\'', false)
+		case isIdentifierStart(c):
+			for i < len(text) && isIdentifierPart(text[i]) {
+				i++
+			}
+			kind = tokenIdentifier
+			if i < len(text) && text[i] == '\'' && i-start == 1 {
+				// An escape, bit, hex, or national character string such as E'...'
+				kind = tokenEscapeString
+				i = skipQuoted(text, i, '\'', c == 'e' || c == 'E')
+			}
+		case c == '$':
+			if end := dollarStringEnd(text, i); end > 0 {
+				kind = tokenDollarString
+				i = end
+			} else {
+				i++
+				for i < len(text) && text[i] >= '0' && text[i] <= '9' {
+					i++
+				}
+			}
+		case c >= '0' && c <= '9':
+			for i < len(text) && ((text[i] >= '0' && text[i] <= '9') || text[i] == '.' && i+1 < len(text) && text[i+1] >= '0' && text[i+1] <= '9') {
+				i++
+			}
+		case c == ':' && strings.HasPrefix(text[i:], "::"):
+			i += 2
+		case isOperatorCharacter(c):
+			kind = tokenOperator
+			for i < len(text) && isOperatorCharacter(text[i]) && !strings.HasPrefix(text[i:], "--") && !strings.HasPrefix(text[i:], "/*") {
+				i++
+			}
+		default:
+			i++
+		}
+		tokens = append(tokens, sqlToken{kind: kind, start: start, end: i})
+	}
+	return tokens
+}
+
+func skipBlockComment(text string, i int) int {
+	depth := 0
+	for i < len(text) {
+		if strings.HasPrefix(text[i:], "/*") {
+			depth++
+			i += 2
+		} else if strings.HasPrefix(text[i:], "*/") {
+			depth--
+			i += 2
+			if depth == 0 {
+				return i
+			}
+		} else {
+			i++
+		}
+	}
+	return i
+}
+
+func skipQuoted(text string, i int, quote byte, backslashEscapes bool) int {
+	i++
+	for i < len(text) {
+		switch {
+		case backslashEscapes && text[i] == '\\':
+			i += 2
+		case text[i] == quote && i+1 < len(text) && text[i+1] == quote:
+			i += 2
+		case text[i] == quote:
+			return i + 1
+		default:
+			i++
+		}
+	}
+	return len(text)
+}
+
+// Returns the end of the dollar-quoted string starting at i, or 0 if there is none
+func dollarStringEnd(text string, i int) int {
+	j := i + 1
+	if j < len(text) && text[j] != '$' {
+		if !isIdentifierStart(text[j]) {
+			return 0
+		}
+		for j < len(text) && text[j] != '$' {
+			if !isIdentifierPart(text[j]) {
+				return 0
+			}
+			j++
+		}
+	}
+	if j >= len(text) {
+		return 0
+	}
+	tag := text[i : j+1]
+	if end := strings.Index(text[j+1:], tag); end >= 0 {
+		return j + 1 + end + len(tag)
+	}
+	return len(text)
+}
+
+// Returns the end of the last complete statement in the text, or 0 if there is none
+func lastStatementEnd(text string) int {
+	tokens := tokenizeSQL(text)
+	for i := len(tokens) - 1; i >= 0; i-- {
+		if tokens[i].kind == tokenOther && tokens[i].text(text) == ";" {
+			return tokens[i].end
+		}
+	}
+	return 0
+}
@@ -0,0 +1,98 @@
+package utils_test
+
+import (
+	"github.com/greenplum-db/gpbackup/utils"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("utils/references tests", func() {
+	names := utils.NewObjectNames(`"My DB"`, []utils.ObjectName{
+		{Schema: "foo", Name: "bar", IsRelation: true},
+		{Schema: "foo", Name: "bar_seq", IsRelation: true},
+		{Schema: "foo", Name: "add_one"},
+		{Schema: "foo", Name: "+"},
+		{Schema: `"it's"`, Name: `"Bar's"`, IsRelation: true},
+		{Schema: `"it's"`, Name: `"Bar's"`},
+	})
+	schema := func(name string, offset uint64, length int) utils.PrintedReference {
+		return utils.PrintedReference{ObjectType: "SCHEMA", Name: name, Offset: offset, Length: length}
+	}
+	relation := func(schemaName string, name string, offset uint64, length int) utils.PrintedReference {
+		return utils.PrintedReference{ObjectType: "RELATION", Schema: schemaName, Name: name, Offset: offset, Length: length}
+	}
+	inLiteral := func(reference utils.PrintedReference) utils.PrintedReference {
+		reference.InLiteral = true
+		return reference
+	}
+	unaliased := func(reference utils.PrintedReference) utils.PrintedReference {
+		reference.Unaliased = true
+		return reference
+	}
+
+	Describe("FindReferences", func() {
+		It("finds the schema and relation of a schema-qualified name", func() {
+			Expect(names.FindReferences(`ALTER TABLE foo.bar INHERIT "it's"."Bar's";`)).To(Equal([]utils.PrintedReference{
+				schema("foo", 12, 3), relation("foo", "bar", 16, 3),
+				schema(`"it's"`, 28, 6), relation(`"it's"`, `"Bar's"`, 35, 7),
+			}))
+		})
+		It("finds only the schema of a function or operator", func() {
+			Expect(names.FindReferences("SELECT foo.add_one(i) OPERATOR(foo.+) 1;")).To(Equal([]utils.PrintedReference{
+				schema("foo", 7, 3), schema("foo", 31, 3),
+			}))
+		})
+		It("matches names regardless of how they are quoted", func() {
+			Expect(names.FindReferences(`SELECT * FROM FOO."bar";`)).To(Equal([]utils.PrintedReference{
+				schema("foo", 14, 3), unaliased(relation("foo", "bar", 18, 5)),
+			}))
+		})
+		It("does not take an alias or column named like a schema for a schema", func() {
+			Expect(names.FindReferences("SELECT foo.i, foo.bar.i FROM foo.bar foo WHERE foo.baz > 0;")).To(Equal([]utils.PrintedReference{
+				schema("foo", 14, 3), relation("foo", "bar", 18, 3),
+				schema("foo", 29, 3), relation("foo", "bar", 33, 3),
+			}))
+		})
+		It("finds the relations listed in a FROM clause without an alias", func() {
+			Expect(names.FindReferences("SELECT 1 FROM foo.bar, ONLY foo.bar_seq JOIN foo.bar b ON true WHERE i IN (SELECT i FROM foo.bar AS b2), foo.bar;")).To(Equal([]utils.PrintedReference{
+				schema("foo", 14, 3), unaliased(relation("foo", "bar", 18, 3)),
+				schema("foo", 28, 3), unaliased(relation("foo", "bar_seq", 32, 7)),
+				schema("foo", 45, 3), relation("foo", "bar", 49, 3),
+				schema("foo", 89, 3), relation("foo", "bar", 93, 3),
+				schema("foo", 105, 3), relation("foo", "bar", 109, 3),
+			}))
+			Expect(names.FindReferences("UPDATE foo.bar SET i = 1 FROM (SELECT 1) s, foo.bar_seq WHERE foo.bar.i = 0;")).To(Equal([]utils.PrintedReference{
+				schema("foo", 7, 3), unaliased(relation("foo", "bar", 11, 3)),
+				schema("foo", 44, 3), unaliased(relation("foo", "bar_seq", 48, 7)),
+				schema("foo", 62, 3), relation("foo", "bar", 66, 3),
+			}))
+		})
+		It("skips comments and literals that do not name an object", func() {
+			Expect(names.FindReferences("-- foo.bar\nCOMMENT ON TABLE /* foo.bar */ foo.bar IS 'Copied from foo.bar' || E'foo.bar\\'';")).To(Equal([]utils.PrintedReference{
+				schema("foo", 42, 3), relation("foo", "bar", 46, 3),
+			}))
+		})
+		It("finds names in literals cast to object identifier types and passed to sequence functions", func() {
+			Expect(names.FindReferences(`SELECT '"it''s"."Bar''s"'::regclass, nextval('foo.bar_seq'::pg_catalog.regclass), setval('foo.bar_seq', 1);`)).To(Equal([]utils.PrintedReference{
+				inLiteral(schema(`"it's"`, 8, 7)), inLiteral(relation(`"it's"`, `"Bar's"`, 16, 8)),
+				inLiteral(schema("foo", 46, 3)), inLiteral(relation("foo", "bar_seq", 50, 7)),
+				inLiteral(schema("foo", 90, 3)), inLiteral(relation("foo", "bar_seq", 94, 7)),
+			}))
+		})
+		It("finds names in function bodies", func() {
+			Expect(names.FindReferences("CREATE FUNCTION foo.f() RETURNS bigint AS $_$\nSELECT count(*) FROM foo.bar -- foo.bar\n$_$ LANGUAGE sql;")).To(Equal([]utils.PrintedReference{
+				schema("foo", 67, 3), unaliased(relation("foo", "bar", 71, 3)),
+			}))
+			Expect(names.FindReferences("CREATE FUNCTION f() RETURNS bigint AS 'SELECT count(*) FROM \"it''s\".\"Bar''s\" WHERE ''foo.bar'' <> ''''' LANGUAGE sql;")).To(Equal([]utils.PrintedReference{
+				inLiteral(schema(`"it's"`, 60, 7)), unaliased(inLiteral(relation(`"it's"`, `"Bar's"`, 68, 8))),
+			}))
+		})
+		It("finds the name of the database following the DATABASE keyword", func() {
+			Expect(names.FindReferences(`COMMENT ON DATABASE "My DB" IS 'DATABASE "My DB"';`)).To(Equal([]utils.PrintedReference{
+				{ObjectType: "DATABASE", Name: `"My DB"`, Offset: 20, Length: 7},
+			}))
+			Expect(names.FindReferences(`ALTER DATABASE "Other DB" OWNER TO testrole;`)).To(BeEmpty())
+		})
+	})
+})
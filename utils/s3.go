@@ -0,0 +1,623 @@
+package utils
+
+/*
+ * This file contains a client for S3-compatible object storage, used by the
+ * built-in s3 storage backend in place of a plugin executable.
+ */
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	path "path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greenplum-db/gpbackup/filepath"
+	"github.com/pkg/errors"
+)
+
+const (
+	S3Storage = "s3"
+
+	defaultS3Region         = "us-east-1"
+	defaultS3ChunkSizeMB    = 64
+	defaultS3Retries        = 3
+	minS3ChunkSizeMB        = 5
+	maxS3ChunkSizeMB        = 5120
+	s3EmptyPayloadHash      = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3SigningAlgorithm      = "AWS4-HMAC-SHA256"
+	s3TimeFormat            = "20060102T150405Z"
+	s3DateFormat            = "20060102"
+	s3DefaultEndpointFormat = "https://s3.%s.amazonaws.com"
+)
+
+/*
+ * An S3Client stores backup files in a bucket of an S3-compatible object
+ * store, such as Amazon S3 or MinIO.  Objects are addressed in path style, as
+ * <endpoint>/<bucket>/<key>, so any endpoint serving the S3 API may be used.
+ *
+ * It is configured by the options section of the plugin config:
+ *
+ *   storage: s3
+ *   options:
+ *     bucket: my_bucket               (required)
+ *     prefix: greenplum_backups       (prepended to every key)
+ *     region: us-west-2               (default us-east-1)
+ *     endpoint: http://minio:9000     (default https://s3.<region>.amazonaws.com)
+ *     aws_access_key_id: ...          (default $AWS_ACCESS_KEY_ID)
+ *     aws_secret_access_key: ...      (default $AWS_SECRET_ACCESS_KEY)
+ *     aws_session_token: ...          (default $AWS_SESSION_TOKEN)
+ *     multipart_chunksize: 64         (size of each uploaded part, in MB)
+ *     retries: 3                      (retries of each failed request)
+ */
+type S3Client struct {
+	Endpoint        *url.URL
+	Region          string
+	Bucket          string
+	Prefix          string
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	ChunkSize       int
+	Retries         int
+	RetryDelay      time.Duration
+	client          *http.Client
+}
+
+func NewS3Client(options map[string]string) (*S3Client, error) {
+	s3 := &S3Client{
+		Region:          options["region"],
+		Bucket:          options["bucket"],
+		Prefix:          strings.Trim(options["prefix"], "/"),
+		AccessKeyID:     options["aws_access_key_id"],
+		SecretAccessKey: options["aws_secret_access_key"],
+		SessionToken:    options["aws_session_token"],
+		ChunkSize:       defaultS3ChunkSizeMB * 1024 * 1024,
+		Retries:         defaultS3Retries,
+		RetryDelay:      time.Second,
+		client:          &http.Client{},
+	}
+	if s3.Bucket == "" {
+		return nil, errors.New("bucket is required in the options of an s3 storage config")
+	}
+	if s3.Region == "" {
+		s3.Region = defaultS3Region
+	}
+	if s3.AccessKeyID == "" && s3.SecretAccessKey == "" {
+		s3.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		s3.SecretAccessKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s3.SessionToken = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+		return nil, errors.New("aws_access_key_id and aws_secret_access_key are required in the options " +
+			"of an s3 storage config or in the environment")
+	}
+
+	endpoint := options["endpoint"]
+	if endpoint == "" {
+		endpoint = fmt.Sprintf(s3DefaultEndpointFormat, s3.Region)
+	}
+	var err error
+	s3.Endpoint, err = url.Parse(strings.TrimRight(endpoint, "/"))
+	if err != nil || (s3.Endpoint.Scheme != "http" && s3.Endpoint.Scheme != "https") || s3.Endpoint.Host == "" {
+		return nil, errors.Errorf("endpoint %s must be an http or https URL", endpoint)
+	}
+
+	if chunkSizeStr := options["multipart_chunksize"]; chunkSizeStr != "" {
+		chunkSizeMB, err := strconv.Atoi(chunkSizeStr)
+		if err != nil || chunkSizeMB < minS3ChunkSizeMB || chunkSizeMB > maxS3ChunkSizeMB {
+			return nil, errors.Errorf("multipart_chunksize must be a number of MB between %d and %d",
+				minS3ChunkSizeMB, maxS3ChunkSizeMB)
+		}
+		s3.ChunkSize = chunkSizeMB * 1024 * 1024
+	}
+	if retriesStr := options["retries"]; retriesStr != "" {
+		s3.Retries, err = strconv.Atoi(retriesStr)
+		if err != nil || s3.Retries < 0 {
+			return nil, errors.New("retries must be a non-negative number")
+		}
+	}
+	return s3, nil
+}
+
+/*
+ * Backup files are stored under <prefix>/backups/<date>/<timestamp>/, matching
+ * the directory they are written to locally, so that a file is found by the
+ * same path on restore whichever host or backup directory it came from.
+ */
+func (s3 *S3Client) KeyForFile(filename string) string {
+	timestampDir := path.Dir(filename)
+	dateDir := path.Dir(timestampDir)
+	return s3.key("backups", path.Base(dateDir), path.Base(timestampDir), path.Base(filename))
+}
+
+func (s3 *S3Client) KeyPrefixForBackup(timestamp string) string {
+	if len(timestamp) < 8 {
+		return s3.key("backups", timestamp) + "/"
+	}
+	return s3.key("backups", timestamp[0:8], timestamp) + "/"
+}
+
+func (s3 *S3Client) key(elements ...string) string {
+	if s3.Prefix != "" {
+		elements = append([]string{s3.Prefix}, elements...)
+	}
+	return strings.Join(elements, "/")
+}
+
+/*
+ * Returns an error if the bucket does not exist or cannot be accessed with the
+ * configured credentials.
+ */
+func (s3 *S3Client) CheckBucket() error {
+	resp, err := s3.do("HEAD", "", nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+/*
+ * Stores everything read from reader in the object with the given key.  Data
+ * larger than one chunk is sent with a multipart upload, so that only a
+ * single chunk is held in memory at a time.
+ */
+func (s3 *S3Client) Upload(key string, reader io.Reader) error {
+	chunk := make([]byte, s3.ChunkSize)
+	numBytes, err := io.ReadFull(reader, chunk)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return s3.putObject(key, chunk[:numBytes])
+	} else if err != nil {
+		return err
+	}
+
+	uploadID, err := s3.createMultipartUpload(key)
+	if err != nil {
+		return err
+	}
+	parts := make([]s3CompletedPart, 0)
+	for partNumber := 1; numBytes > 0; partNumber++ {
+		var etag string
+		etag, err = s3.uploadPart(key, uploadID, partNumber, chunk[:numBytes])
+		if err != nil {
+			break
+		}
+		parts = append(parts, s3CompletedPart{PartNumber: partNumber, ETag: etag})
+		numBytes, err = io.ReadFull(reader, chunk)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			err = nil
+		} else if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = s3.completeMultipartUpload(key, uploadID, parts)
+	}
+	if err != nil {
+		// The parts already uploaded are stored, and charged for, until the upload is aborted
+		_ = s3.abortMultipartUpload(key, uploadID)
+		return err
+	}
+	return nil
+}
+
+func (s3 *S3Client) UploadFile(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return s3.Upload(s3.KeyForFile(filename), file)
+}
+
+/*
+ * Writes the contents of the object with the given key to writer.  If the
+ * connection fails partway through, the rest of the object is requested
+ * again with a ranged GET, so nothing already written is written twice.
+ */
+func (s3 *S3Client) Download(key string, writer io.Writer) error {
+	return s3.DownloadRange(key, 0, -1, writer)
+}
+
+/*
+ * Writes bytes [start, end) of the object with the given key to writer, or
+ * everything from start onward if end is negative.
+ */
+func (s3 *S3Client) DownloadRange(key string, start int64, end int64, writer io.Writer) error {
+	if end >= 0 && end <= start {
+		return nil
+	}
+	for attempt := 0; ; attempt++ {
+		header := http.Header{}
+		if end >= 0 {
+			header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+		} else if start > 0 {
+			header.Set("Range", fmt.Sprintf("bytes=%d-", start))
+		}
+		resp, err := s3.do("GET", key, nil, header, nil)
+		if err != nil {
+			return err
+		}
+		numBytes, err := io.Copy(writer, resp.Body)
+		_ = resp.Body.Close()
+		start += numBytes
+		if err == nil && end >= 0 && start < end {
+			err = io.ErrUnexpectedEOF
+		}
+		if err == nil {
+			return nil
+		}
+		if attempt >= s3.Retries {
+			return errors.Wrapf(err, "Unable to download %s", key)
+		}
+		s3.waitToRetry(attempt)
+	}
+}
+
+func (s3 *S3Client) DownloadFile(filename string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	err = s3.Download(s3.KeyForFile(filename), file)
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(filename)
+		return err
+	}
+	return file.Close()
+}
+
+func (s3 *S3Client) ListObjects(prefix string) ([]string, error) {
+	keys := make([]string, 0)
+	continuationToken := ""
+	for {
+		query := map[string]string{"list-type": "2", "prefix": prefix}
+		if continuationToken != "" {
+			query["continuation-token"] = continuationToken
+		}
+		result := s3ListBucketResult{}
+		err := s3.doXML("GET", "", query, nil, &result)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		continuationToken = result.NextContinuationToken
+	}
+}
+
+/*
+ * Returns the timestamps of the backups in the bucket, in order, found from
+ * the keys of their files under <prefix>/backups/<date>/<timestamp>/.
+ */
+func (s3 *S3Client) ListBackups() ([]string, error) {
+	backupsPrefix := s3.key("backups") + "/"
+	keys, err := s3.ListObjects(backupsPrefix)
+	if err != nil {
+		return nil, err
+	}
+	timestamps := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		dirs := strings.Split(strings.TrimPrefix(key, backupsPrefix), "/")
+		if len(dirs) != 3 || seen[dirs[1]] || !filepath.IsValidTimestamp(dirs[1]) || !strings.HasPrefix(dirs[1], dirs[0]) {
+			continue
+		}
+		seen[dirs[1]] = true
+		timestamps = append(timestamps, dirs[1])
+	}
+	sort.Strings(timestamps)
+	return timestamps, nil
+}
+
+func (s3 *S3Client) DeleteObject(key string) error {
+	resp, err := s3.do("DELETE", key, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s3 *S3Client) DeleteBackup(timestamp string) error {
+	keys, err := s3.ListObjects(s3.KeyPrefixForBackup(timestamp))
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return errors.Errorf("Backup %s not found in bucket %s", timestamp, s3.Bucket)
+	}
+	for _, key := range keys {
+		err = s3.DeleteObject(key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+/*
+ * Multipart upload requests
+ */
+
+type s3InitiateMultipartUploadResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+type s3CompletedPart struct {
+	PartNumber int
+	ETag       string
+}
+
+type s3CompleteMultipartUpload struct {
+	XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+	Parts   []s3CompletedPart `xml:"Part"`
+}
+
+type s3ListBucketResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []struct {
+		Key string
+	}
+}
+
+type s3Error struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string
+	Message string
+}
+
+func (s3 *S3Client) putObject(key string, body []byte) error {
+	resp, err := s3.do("PUT", key, nil, nil, body)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+func (s3 *S3Client) createMultipartUpload(key string) (string, error) {
+	result := s3InitiateMultipartUploadResult{}
+	err := s3.doXML("POST", key, map[string]string{"uploads": ""}, nil, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.UploadID == "" {
+		return "", errors.Errorf("No upload ID returned for multipart upload of %s", key)
+	}
+	return result.UploadID, nil
+}
+
+func (s3 *S3Client) uploadPart(key string, uploadID string, partNumber int, body []byte) (string, error) {
+	query := map[string]string{"partNumber": strconv.Itoa(partNumber), "uploadId": uploadID}
+	resp, err := s3.do("PUT", key, query, nil, body)
+	if err != nil {
+		return "", err
+	}
+	_ = resp.Body.Close()
+	return resp.Header.Get("ETag"), nil
+}
+
+func (s3 *S3Client) completeMultipartUpload(key string, uploadID string, parts []s3CompletedPart) error {
+	body, err := xml.Marshal(s3CompleteMultipartUpload{Parts: parts})
+	if err != nil {
+		return err
+	}
+	resp, err := s3.do("POST", key, map[string]string{"uploadId": uploadID}, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 may report a failure to complete the upload in the body of a 200 response
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	s3Err := s3Error{}
+	if xml.Unmarshal(contents, &s3Err) == nil {
+		return errors.Errorf("Unable to complete upload of %s: %s: %s", key, s3Err.Code, s3Err.Message)
+	}
+	return nil
+}
+
+func (s3 *S3Client) abortMultipartUpload(key string, uploadID string) error {
+	resp, err := s3.do("DELETE", key, map[string]string{"uploadId": uploadID}, nil, nil)
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+/*
+ * Sending and signing requests
+ */
+
+func (s3 *S3Client) doXML(method string, key string, query map[string]string, body []byte, result interface{}) error {
+	resp, err := s3.do(method, key, query, nil, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	contents, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	err = xml.Unmarshal(contents, result)
+	if err != nil {
+		return errors.Wrapf(err, "Unable to parse response to %s %s", method, s3.objectPath(key))
+	}
+	return nil
+}
+
+/*
+ * Sends a request for the given key, or for the bucket itself if key is empty,
+ * and returns the response if it succeeded.  Connection errors, server errors,
+ * and throttling are retried with a doubling delay between attempts.
+ */
+func (s3 *S3Client) do(method string, key string, query map[string]string, header http.Header, body []byte) (*http.Response, error) {
+	payloadHash := s3EmptyPayloadHash
+	if len(body) > 0 {
+		hash := sha256.Sum256(body)
+		payloadHash = hex.EncodeToString(hash[:])
+	}
+	objectPath := s3.objectPath(key)
+	for attempt := 0; ; attempt++ {
+		requestURL := *s3.Endpoint
+		requestURL.Path = s3.Endpoint.Path + objectPath
+		requestURL.RawPath = s3.Endpoint.EscapedPath() + s3EscapePath(objectPath)
+		requestURL.RawQuery = s3CanonicalQuery(query)
+		req, err := http.NewRequest(method, requestURL.String(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		s3.SignRequest(req, payloadHash, time.Now())
+
+		resp, err := s3.client.Do(req)
+		if err == nil && resp.StatusCode/100 == 2 {
+			return resp, nil
+		}
+		if err == nil {
+			err = s3ResponseError(method, objectPath, resp)
+			if resp.StatusCode/100 != 5 && resp.StatusCode != http.StatusTooManyRequests {
+				return nil, err
+			}
+		}
+		if attempt >= s3.Retries {
+			return nil, err
+		}
+		s3.waitToRetry(attempt)
+	}
+}
+
+func (s3 *S3Client) waitToRetry(attempt int) {
+	time.Sleep(s3.RetryDelay << uint(attempt))
+}
+
+func (s3 *S3Client) objectPath(key string) string {
+	if key == "" {
+		return "/" + s3.Bucket
+	}
+	return "/" + s3.Bucket + "/" + key
+}
+
+func s3ResponseError(method string, objectPath string, resp *http.Response) error {
+	defer resp.Body.Close()
+	contents, _ := ioutil.ReadAll(resp.Body)
+	s3Err := s3Error{}
+	if xml.Unmarshal(contents, &s3Err) != nil || s3Err.Code == "" {
+		return errors.Errorf("S3 request %s %s failed: %s", method, objectPath, resp.Status)
+	}
+	return errors.Errorf("S3 request %s %s failed: %s: %s: %s", method, objectPath, resp.Status, s3Err.Code, s3Err.Message)
+}
+
+/*
+ * Signs the request with AWS Signature Version 4, as described in
+ * https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+ */
+func (s3 *S3Client) SignRequest(req *http.Request, payloadHash string, now time.Time) {
+	amzTime := now.UTC().Format(s3TimeFormat)
+	req.Header.Set("X-Amz-Date", amzTime)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s3.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s3.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		name = strings.ToLower(name)
+		if name == "range" || strings.HasPrefix(name, "x-amz-") {
+			headers[name] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	headerNames := make([]string, 0, len(headers))
+	for name := range headers {
+		headerNames = append(headerNames, name)
+	}
+	sort.Strings(headerNames)
+	var canonicalHeaders strings.Builder
+	for _, name := range headerNames {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(headerNames, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	canonicalRequestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := strings.Join([]string{now.UTC().Format(s3DateFormat), s3.Region, "s3", "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{
+		s3SigningAlgorithm,
+		amzTime,
+		scope,
+		hex.EncodeToString(canonicalRequestHash[:]),
+	}, "\n")
+
+	signingKey := []byte("AWS4" + s3.SecretAccessKey)
+	for _, element := range strings.Split(scope, "/") {
+		signingKey = s3HMAC(signingKey, element)
+	}
+	signature := hex.EncodeToString(s3HMAC(signingKey, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3SigningAlgorithm, s3.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// Escapes everything but unreserved characters and the given separator, as SigV4 requires
+func s3Escape(str string, keepSlash bool) string {
+	var escaped strings.Builder
+	for _, char := range []byte(str) {
+		if ('A' <= char && char <= 'Z') || ('a' <= char && char <= 'z') || ('0' <= char && char <= '9') ||
+			char == '-' || char == '_' || char == '.' || char == '~' || (keepSlash && char == '/') {
+			escaped.WriteByte(char)
+		} else {
+			escaped.WriteString(fmt.Sprintf("%%%02X", char))
+		}
+	}
+	return escaped.String()
+}
+
+func s3EscapePath(objectPath string) string {
+	return s3Escape(objectPath, true)
+}
+
+// The query string is sent exactly as it is signed: sorted by name, with every name and value escaped
+func s3CanonicalQuery(query map[string]string) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	params := make([]string, len(names))
+	for i, name := range names {
+		params[i] = s3Escape(name, false) + "=" + s3Escape(query[name], false)
+	}
+	return strings.Join(params, "&")
+}
@@ -8,10 +8,8 @@ package utils
 import (
 	"fmt"
 	"os"
-	"os/signal"
 	"regexp"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/greenplum-db/gp-common-go-libs/dbconn"
@@ -116,18 +114,11 @@ func ValidateCompressionLevel(compressionLevel int) error {
 	return nil
 }
 
-func InitializeSignalHandler(cleanupFunc func(bool), procDesc string, termFlag *bool) {
-	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		for range signalChan {
-			fmt.Println() // Add newline after "^C" is printed
-			gplog.Warn("Received a termination signal, aborting %s", procDesc)
-			*termFlag = true
-			cleanupFunc(true)
-			os.Exit(2)
-		}
-	}()
+func ValidateTimeout(flagName string, seconds int) error {
+	if seconds < 0 {
+		return errors.Errorf("--%s must be 0 or greater", flagName)
+	}
+	return nil
 }
 
 // TODO: Uniquely identify COPY commands in the multiple data file case to allow terminating sessions
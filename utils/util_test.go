@@ -120,6 +120,16 @@ var _ = Describe("utils/util tests", func() {
 			Expect(err).To(MatchError("Compression level must be between 1 and 9"))
 		})
 	})
+	Describe("ValidateTimeout", func() {
+		It("validates a timeout of 0 or more seconds", func() {
+			Expect(utils.ValidateTimeout("timeout", 0)).To(Succeed())
+			Expect(utils.ValidateTimeout("timeout", 60)).To(Succeed())
+		})
+		It("returns an error if given a negative timeout", func() {
+			err := utils.ValidateTimeout("copy-timeout", -1)
+			Expect(err).To(MatchError("--copy-timeout must be 0 or greater"))
+		})
+	})
 	Describe("UnquoteIdent", func() {
 		It("returns unchanged ident when passed a single char", func() {
 			dbname := `a`